@@ -1,8 +1,43 @@
+import (
+    "runtime"
+    "sort"
+    "sync"
+)
+
 func program() map[int]int {
-    result := make(map[int]int)
-    for x := 1; x < 100000; x += 1 {
-        if !(x % 3 == 0) { continue }
-        result[x] = x
+    numWorkers := runtime.GOMAXPROCS(0)
+    total := 99999
+    chunkSize := (total + numWorkers - 1) / numWorkers
+
+    shards := make([]map[int]int, numWorkers)
+    var wg sync.WaitGroup
+
+    for w := 0; w < numWorkers; w++ {
+        wg.Add(1)
+        go func(workerID int) {
+            defer wg.Done()
+            lo := workerID * chunkSize
+            hi := lo + chunkSize
+            if hi > total { hi = total }
+            if lo > hi { lo = hi }
+
+            shard := make(map[int]int, 33333/numWorkers+1)
+            for x := 1 + lo*1; x < 1 + hi*1; x += 1 {
+                if !(x % 3 == 0) { continue }
+                shard[x] = x * x
+            }
+            shards[workerID] = shard
+        }(w)
+    }
+    wg.Wait()
+
+    // Largest shards first into a destination sized for every entry
+    size := 0
+    for _, shard := range shards { size += len(shard) }
+    sort.Slice(shards, func(i, j int) bool { return len(shards[i]) > len(shards[j]) })
+    result := make(map[int]int, size)
+    for _, shard := range shards {
+        for k, v := range shard { result[k] = v }
     }
     return result
 }
@@ -2,7 +2,17 @@ func program() int {
     acc := 0
     for x := 1; x < 1000; x += 1 {
         if !(x % 3 == 0) { continue }
-        acc += sum((x * y for y in range(1, 100) if y % 2 == 0))
+        acc += programInner0(x)
     }
     return acc
 }
+
+func programInner0(x int) int {
+    acc := 0
+    for y := 1; y < 100; y += 1 {
+        if !(y % 2 == 0) { continue }
+        acc += x * y
+    }
+    return acc
+}
+
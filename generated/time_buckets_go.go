@@ -1,7 +1,17 @@
 func program() int {
     acc := 0
     for i := 0; i < 1000; i += 1 {
-        acc += len([x for x in range(10000) if (x + i) % 1000 == 0])
+        acc += programInner0(i)
     }
     return acc
 }
+
+func programInner0(i int) int {
+    acc := 0
+    for x := 0; x < 10000; x += 1 {
+        if !((x + i) % 1000 == 0) { continue }
+        acc += 1
+    }
+    return acc
+}
+
@@ -0,0 +1,135 @@
+// pcs_helpers.go — generic helpers for PCS-generated Go code.
+//
+// Emitted with `--go-emit helpers`: a comprehension becomes a chain of calls
+// such as Sum(Map(Filter(Range(1, n, 1), keep), f)) instead of inline loops.
+// Copy this file next to the generated program (same package). Every step
+// materializes a slice, so the default loops emission stays the one to use
+// where speed matters; the helpers keep long emissions short and each step
+// testable on its own. Requires Go 1.21+ (cmp.Ordered).
+package main
+
+import "cmp"
+
+// Number is any integer or floating-point type Sum accepts.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Range returns the values of Python's range(start, stop, step). step must
+// not be zero.
+func Range(start, stop, step int) []int {
+	n := 0
+	switch {
+	case step > 0 && stop > start:
+		n = (stop - start + step - 1) / step
+	case step < 0 && stop < start:
+		n = (start - stop - step - 1) / -step
+	}
+	out := make([]int, n)
+	for i := range out {
+		out[i] = start + i*step
+	}
+	return out
+}
+
+// Filter returns the elements of xs for which keep is true, in order.
+func Filter[T any](xs []T, keep func(T) bool) []T {
+	out := make([]T, 0, len(xs))
+	for _, x := range xs {
+		if keep(x) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// Map returns f applied to every element of xs.
+func Map[T, U any](xs []T, f func(T) U) []U {
+	out := make([]U, len(xs))
+	for i, x := range xs {
+		out[i] = f(x)
+	}
+	return out
+}
+
+// MapKV builds a map from the key/value pair kv returns for every element
+// of xs; as in a dict comprehension, a later pair wins over an earlier one
+// with the same key.
+func MapKV[T any, K comparable, V any](xs []T, kv func(T) (K, V)) map[K]V {
+	out := make(map[K]V, len(xs))
+	for _, x := range xs {
+		k, v := kv(x)
+		out[k] = v
+	}
+	return out
+}
+
+// SetOf returns the distinct elements of xs.
+func SetOf[T comparable](xs []T) map[T]struct{} {
+	out := make(map[T]struct{}, len(xs))
+	for _, x := range xs {
+		out[x] = struct{}{}
+	}
+	return out
+}
+
+// Reduce folds xs into init from the left with f.
+func Reduce[T, A any](xs []T, init A, f func(A, T) A) A {
+	acc := init
+	for _, x := range xs {
+		acc = f(acc, x)
+	}
+	return acc
+}
+
+// Sum returns the sum of xs, 0 when it is empty.
+func Sum[T Number](xs []T) T {
+	return Reduce(xs, 0, func(acc, x T) T { return acc + x })
+}
+
+// Max returns the largest element of xs. Python's max raises on an empty
+// sequence; Max returns the zero value instead.
+func Max[T cmp.Ordered](xs []T) T {
+	var m T
+	for i, x := range xs {
+		if i == 0 || x > m {
+			m = x
+		}
+	}
+	return m
+}
+
+// Min returns the smallest element of xs, the zero value when it is empty.
+func Min[T cmp.Ordered](xs []T) T {
+	var m T
+	for i, x := range xs {
+		if i == 0 || x < m {
+			m = x
+		}
+	}
+	return m
+}
+
+// Any reports whether pred holds for some element of xs, stopping at the
+// first that does.
+func Any[T any](xs []T, pred func(T) bool) bool {
+	for _, x := range xs {
+		if pred(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// All reports whether pred holds for every element of xs, stopping at the
+// first that does not.
+func All[T any](xs []T, pred func(T) bool) bool {
+	for _, x := range xs {
+		if !pred(x) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+// pcs_swiss.go — vendored SwissTable-style map for PCS-generated Go code.
+//
+// Emitted with `--go-map-impl swiss`: dict comprehensions build into a
+// *swissMap instead of a built-in map[int]int. Copy this file next to the
+// generated program (same package). Go 1.24+ already backs built-in maps
+// with a swiss table, so this mostly pays off on older toolchains or when
+// the size hint is exact; benchmark before adopting it.
+package main
+
+import "math/bits"
+
+const (
+	swissGroupSize = 8
+	swissEmpty     = 0x80
+	swissLSB       = 0x0101010101010101
+	swissMSB       = 0x8080808080808080
+)
+
+// swissGroup holds eight slots plus one control byte per slot. A control
+// byte is swissEmpty or the low 7 bits of the key's hash (h2). Comprehensions
+// never delete, so there are no tombstones.
+type swissGroup struct {
+	ctrl uint64
+	keys [swissGroupSize]int
+	vals [swissGroupSize]int
+}
+
+type swissMap struct {
+	groups []swissGroup
+	mask   uint64
+	n      int
+	limit  int
+}
+
+// newSwissMap returns a map that holds at least hint entries without growing.
+func newSwissMap(hint int) *swissMap {
+	groups := 1
+	for groups*swissGroupSize*7/8 < hint {
+		groups <<= 1
+	}
+	m := &swissMap{}
+	m.init(groups)
+	return m
+}
+
+func (m *swissMap) init(groups int) {
+	m.groups = make([]swissGroup, groups)
+	for i := range m.groups {
+		m.groups[i].ctrl = swissEmpty * swissLSB
+	}
+	m.mask = uint64(groups - 1)
+	m.limit = groups * swissGroupSize * 7 / 8
+	m.n = 0
+}
+
+func swissHash(k int) uint64 {
+	h := uint64(k) * 0x9E3779B97F4A7C15
+	return h ^ (h >> 29)
+}
+
+// swissMatch returns a mask with the high bit set in every byte of ctrl
+// equal to h2. False positives are possible and resolved by comparing keys.
+func swissMatch(ctrl, h2 uint64) uint64 {
+	x := ctrl ^ (swissLSB * h2)
+	return (x - swissLSB) &^ x & swissMSB
+}
+
+// Put inserts or overwrites the value for k.
+func (m *swissMap) Put(k, v int) {
+	if m.n >= m.limit {
+		m.grow()
+	}
+	h := swissHash(k)
+	h2 := h & 0x7f
+	for g := (h >> 7) & m.mask; ; g = (g + 1) & m.mask {
+		grp := &m.groups[g]
+		for match := swissMatch(grp.ctrl, h2); match != 0; match &= match - 1 {
+			i := bits.TrailingZeros64(match) / 8
+			if grp.keys[i] == k {
+				grp.vals[i] = v
+				return
+			}
+		}
+		if empty := grp.ctrl & swissMSB; empty != 0 {
+			i := bits.TrailingZeros64(empty) / 8
+			grp.ctrl = grp.ctrl&^(0xff<<(i*8)) | h2<<(i*8)
+			grp.keys[i] = k
+			grp.vals[i] = v
+			m.n++
+			return
+		}
+	}
+}
+
+// Get returns the value stored for k and whether it was present.
+func (m *swissMap) Get(k int) (int, bool) {
+	h := swissHash(k)
+	h2 := h & 0x7f
+	for g := (h >> 7) & m.mask; ; g = (g + 1) & m.mask {
+		grp := &m.groups[g]
+		for match := swissMatch(grp.ctrl, h2); match != 0; match &= match - 1 {
+			i := bits.TrailingZeros64(match) / 8
+			if grp.keys[i] == k {
+				return grp.vals[i], true
+			}
+		}
+		if grp.ctrl&swissMSB != 0 {
+			return 0, false
+		}
+	}
+}
+
+// Len returns the number of entries.
+func (m *swissMap) Len() int {
+	return m.n
+}
+
+// Range calls f for every entry until f returns false. Order is unspecified.
+func (m *swissMap) Range(f func(k, v int) bool) {
+	for g := range m.groups {
+		grp := &m.groups[g]
+		for i := 0; i < swissGroupSize; i++ {
+			if (grp.ctrl>>(i*8))&swissEmpty != 0 {
+				continue
+			}
+			if !f(grp.keys[i], grp.vals[i]) {
+				return
+			}
+		}
+	}
+}
+
+func (m *swissMap) grow() {
+	old := m.groups
+	m.init(len(old) * 2)
+	for g := range old {
+		grp := &old[g]
+		for i := 0; i < swissGroupSize; i++ {
+			if (grp.ctrl>>(i*8))&swissEmpty == 0 {
+				m.Put(grp.keys[i], grp.vals[i])
+			}
+		}
+	}
+}
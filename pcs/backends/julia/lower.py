@@ -2,6 +2,8 @@
 IR → Julia lowering rules for loops and broadcast modes
 """
 
+import hashlib
+
 from ...core import IRComp, IRGenerator, IRRange
 from .emitter import JL, gensym, reset_gensym
 from .strategy import choose_strategy, get_elem_type, get_op_kind, size_hint
@@ -21,10 +23,11 @@ def lower_program(
 
     jl = JL(code=[])
 
-    # Generate stable module name to avoid collisions
+    # Generate stable module name to avoid collisions. hash() is salted per
+    # process (PYTHONHASHSEED), so use a content digest instead.
     ir_text = str(ir)  # Simple string representation for hashing
-    mod_hash = hash(ir_text) & 0xFFFF
-    mod_name = f"PCS_Generated_{mod_hash:04x}"
+    mod_hash = hashlib.sha256(ir_text.encode()).hexdigest()[:4]
+    mod_name = f"PCS_Generated_{mod_hash}"
 
     # Header
     jl.w("# Generated by PCS: Julia backend")
@@ -3,10 +3,33 @@ Command-line interface for Polyglot Code Sampler
 """
 
 import argparse
+import json
 import sys
 
 from .core import PyToIR
+from .header import DEFAULT_CONFIG, load_config, render_header
+from .renderer_api import capabilities
 from .renderer_api import render as render_generic
+from .renderers.go import (
+    GO_EMIT_STYLES,
+    GO_FOLD_MODES,
+    GO_INPUT_TYPES,
+    GO_MAP_IMPLS,
+    GO_CHUNKINGS,
+    GO_PARALLEL_STYLES,
+    GO_RESULT_TYPES,
+    GO_DICT_RESULTS,
+    GO_EMPTY_MODES,
+    GO_OVERFLOW_MODES,
+    GO_SET_RESULTS,
+    go_result_shape,
+    render_go_benchmark,
+    render_go_multi,
+    render_go_package,
+    render_go_pipeline,
+    render_go_stream,
+    render_go_test,
+)
 
 
 def main():
@@ -20,16 +43,47 @@ Examples:
   pcs --code "[x*x for x in range(5)]" --target ts --parallel
   pcs --code "{x: x*x for x in range(3)}" --target csharp
   pcs --code "sum(i for i in range(100))" --target sql --execute-sql
+  pcs --code "[x*x for x in range(5)]" --target go --header --license MIT
+  pcs --code "sum(i for i in range(9))" --code "max(i%4 for i in range(9))" --target go --fuse
+  pcs --stage "sq=[x*x for x in range(9)]" --stage "n=sum(1 for y in sq if y%2==1)" --target go
+  pcs --code "[x*x for x in range(5)]" --target go --go-package > main.go && go run main.go
+  pcs --code "sum(i*i for i in range(9))" --target go --go-package metrics --func-name SumSquares --go-result-type int64
+  pcs --capabilities
         """,
     )
 
     parser.add_argument(
-        "--code", required=True, help="Python comprehension to transform"
+        "--code",
+        action="append",
+        help="Python comprehension to transform; repeat to render several "
+        "reductions over the same range into one Go function",
+    )
+
+    parser.add_argument(
+        "--stage",
+        action="append",
+        metavar="NAME=EXPR",
+        help="Go: one named stage of a pipeline; repeat in order, each stage "
+        "iterating over the previous one by name (instead of --code)",
+    )
+
+    parser.add_argument(
+        "--fuse",
+        action="store_true",
+        help="Go: compute repeated --code reductions in a single fused loop "
+        "instead of one pass each, or run --stage pipelines as one loop instead "
+        "of materializing each intermediate stage",
+    )
+
+    parser.add_argument(
+        "--capabilities",
+        action="store_true",
+        help="Print the backend x construct capability matrix as JSON and exit",
     )
 
     parser.add_argument(
         "--target",
-        choices=["rust", "ts", "go", "csharp", "sql", "julia"],
+        choices=["rust", "ts", "go", "csharp", "sql", "julia", "c"],
         default="rust",
         help="Target language (default: rust)",
     )
@@ -80,24 +134,439 @@ Examples:
         "--strict-types", action="store_true", help="Enable strict type checking"
     )
 
+    parser.add_argument(
+        "--no-presize",
+        action="store_true",
+        help="Go: do not pre-size result maps and slices (benchmark the size hints)",
+    )
+
+    parser.add_argument(
+        "--go-map-impl",
+        choices=GO_MAP_IMPLS,
+        default="builtin",
+        help="Go: map implementation for dict comprehensions (swiss uses the vendored "
+        "pcs_swiss.go; sync builds a sync.Map for concurrent consumers)",
+    )
+
+    parser.add_argument(
+        "--go-shard-merge",
+        choices=["ordered", "sized", "adopt", "wrap"],
+        default="sized",
+        help="Go: how parallel dict shards are merged; wrap returns a read-only shardedMap (default: sized)",
+    )
+
+    parser.add_argument(
+        "--go-parallel-style",
+        choices=GO_PARALLEL_STYLES,
+        default="waitgroup",
+        help="Go: run --parallel workers under a sync.WaitGroup (default), a "
+        "golang.org/x/sync/errgroup taking a context.Context and returning "
+        "worker panics as errors, or as a pool whose size is a parameter",
+    )
+
+    parser.add_argument(
+        "--go-chunking",
+        choices=GO_CHUNKINGS,
+        default="even",
+        help="Go: split a --parallel range into one equal chunk per worker "
+        "(default), or auto: size chunks at run time from the range's length and "
+        "GOMAXPROCS, at least a few thousand values each",
+    )
+
+    parser.add_argument(
+        "--go-context",
+        action="store_true",
+        help="Go: give --parallel functions a context.Context parameter and an "
+        "error result; workers stop once it is cancelled",
+    )
+
+    parser.add_argument(
+        "--go-return-error",
+        action="store_true",
+        help="Go: return (result, error), with run-time panics and --go-overflow "
+        "panic checks as the error",
+    )
+
+    parser.add_argument(
+        "--go-no-optimize",
+        action="store_true",
+        help="Go: skip the optimizer (comprehension source fusion, strided modulo "
+        "filters, invariant hoisting), to debug the loops as written",
+    )
+
+    parser.add_argument(
+        "--go-fold",
+        choices=GO_FOLD_MODES,
+        default="off",
+        help="Go: const returns a reduction over constant ranges as its value, "
+        "computed now, under the build constraint !pcs_verify; verify renders the "
+        "loops under pcs_verify, to build in its place with -tags pcs_verify",
+    )
+
+    parser.add_argument(
+        "--go-version",
+        metavar="1.N",
+        help="Go: the oldest Go release the code must build with; from 1.21 the "
+        "slices and maps packages replace hand-written sorts, merges and "
+        "membership tests, before 1.21 sorting goes through sort.Slice",
+    )
+
+    parser.add_argument(
+        "--go-input",
+        action="append",
+        metavar="NAME=TYPE",
+        help="Go: the input NAME the expression iterates is a string, looped over "
+        "by rune, bytes or an Arrow int64 column, by index, or the int64 column "
+        "NAME of a Parquet file whose path the function takes as NAMEPath "
+        f"({', '.join(GO_INPUT_TYPES)}); repeat for several, others are []int",
+    )
+
+    parser.add_argument(
+        "--go-test",
+        action="store_true",
+        help="Go: print a _test.go file for the function instead, asserting the "
+        "value Python computes for the expression (package from --go-package, "
+        "default main)",
+    )
+
+    parser.add_argument(
+        "--go-bench",
+        action="store_true",
+        help="Go: print a _test.go file with a benchmark of the function instead "
+        "(with --go-test, after its test)",
+    )
+
+    parser.add_argument(
+        "--go-zero-alloc",
+        action="store_true",
+        help="Go: guarantee a scalar reduction allocates nothing per call, failing "
+        "if its code would; --go-bench then adds a test failing on any allocation",
+    )
+
+    parser.add_argument(
+        "--go-shape",
+        metavar="FILE",
+        help="Go: also write a JSON description of the function's result to FILE: "
+        "its Go type, error result, accumulator and shape (scalar, list, map, "
+        "set, ...), for tools comparing results without knowing the expression",
+    )
+
+    parser.add_argument(
+        "--go-protocol",
+        action="store_true",
+        help="Go: print a program taking -n, -reps and -format text|json that times "
+        "the function and prints its result, or as json the timings and the "
+        "result's SHA-256, so one build serves every n (package main)",
+    )
+
+    parser.add_argument(
+        "--go-stream",
+        choices=["lines", "binary"],
+        help="Go: emit a complete stdin-to-stdout filter program instead of a function; "
+        "lines reads/writes one integer per line, binary uses length-prefixed int64 frames",
+    )
+
+    parser.add_argument(
+        "--go-package",
+        nargs="?",
+        const="main",
+        metavar="NAME",
+        help="Go: emit a complete source file of package NAME (default: main) "
+        "instead of a bare function; package main gets a main() printing the "
+        "result, runnable with go run, that reads an input slice such as the "
+        "data of `for x in data` from stdin (JSON array or whitespace-separated)",
+    )
+
+    parser.add_argument(
+        "--go-emit",
+        choices=GO_EMIT_STYLES,
+        default="loops",
+        help="Go: inline loops (default), calls into the generic helpers of "
+        "pcs/backends/go/pcs_helpers.go, lazy iter.Seq iterators (Go 1.23+), or "
+        "values streamed over a channel; only loops have a --parallel form",
+    )
+
+    parser.add_argument(
+        "--go-result-type",
+        choices=GO_RESULT_TYPES,
+        default="int",
+        help="Go: declare a sum/prod/max/min result as this type (default: int)",
+    )
+
+    parser.add_argument(
+        "--go-number-type",
+        choices=GO_RESULT_TYPES,
+        default="int",
+        help="Go: build list and set elements, dict values and sum/prod/max/min "
+        "accumulators as this type (default: int)",
+    )
+
+    parser.add_argument(
+        "--go-overflow",
+        choices=GO_OVERFLOW_MODES,
+        default="wrap",
+        help="Go: on sum/prod overflow wrap around as int does (default), or "
+        "check an int64 accumulator and panic, saturate or switch to math/big",
+    )
+
+    parser.add_argument(
+        "--go-empty",
+        choices=GO_EMPTY_MODES,
+        default="zero",
+        help="Go: what max()/min() of no values without default= does: return 0 "
+        "(default) or panic as Python raises ValueError",
+    )
+
+    parser.add_argument(
+        "--go-set-result",
+        choices=GO_SET_RESULTS,
+        default="map",
+        help="Go: return a set comprehension as a map[int]struct{} (default) or "
+        "as its elements in an ascending []int",
+    )
+    parser.add_argument(
+        "--go-dict-result",
+        choices=GO_DICT_RESULTS,
+        default="map",
+        help="Go: return a dict comprehension as a map (default) or as its "
+        "[key, value] pairs in ascending key order",
+    )
+
+    parser.add_argument(
+        "--func-name",
+        help="Name of the generated function (default: the backend's own)",
+    )
+
+    parser.add_argument(
+        "--config",
+        help=f"JSON config file (default: {DEFAULT_CONFIG} in the working directory, if present)",
+    )
+
+    parser.add_argument(
+        "--header",
+        action="store_true",
+        default=None,
+        help="Prepend a 'Code generated by pcs ... DO NOT EDIT.' provenance line (overrides config)",
+    )
+    parser.add_argument(
+        "--no-header",
+        dest="header",
+        action="store_false",
+        help="Omit the provenance line even if the config enables it",
+    )
+
+    parser.add_argument(
+        "--header-source",
+        action="store_true",
+        default=None,
+        help="Record the Python expression in the header and, for Go, in the "
+        "function's doc comment (overrides config)",
+    )
+    parser.add_argument(
+        "--header-flags",
+        action="store_true",
+        default=None,
+        help="Record the pcs options in the header (overrides config)",
+    )
+    parser.add_argument(
+        "--header-timestamp",
+        action="store_true",
+        default=None,
+        help="Record the generation time, UTC or SOURCE_DATE_EPOCH, in the header "
+        "(overrides config)",
+    )
+
+    parser.add_argument(
+        "--license",
+        help="SPDX license identifier for the generated file header (overrides config)",
+    )
+
+    parser.add_argument(
+        "--license-file",
+        help="File whose text is prepended, commented, to the generated file (overrides config)",
+    )
+
     args = parser.parse_args()
 
+    if args.capabilities:
+        print(json.dumps(capabilities(), indent=2))
+        return
+    if args.stage:
+        if args.code is not None or args.go_stream:
+            parser.error("--stage cannot be combined with --code or --go-stream")
+        if args.target != "go":
+            parser.error("--stage pipelines are only supported with --target go")
+        stages = []
+        for spec in args.stage:
+            name, sep, code = spec.partition("=")
+            if not sep:
+                parser.error(f"--stage expects NAME=EXPR, got {spec!r}")
+            stages.append((name.strip(), code.strip()))
+        args.code = [code for _, code in stages]
+    elif args.code is None:
+        parser.error("the following arguments are required: --code")
+    elif len(args.code) > 1 and args.target != "go":
+        parser.error("multiple --code expressions are only supported with --target go")
+    elif args.fuse and len(args.code) < 2:
+        parser.error("--fuse needs at least two --code expressions")
+    if args.go_stream and (args.target != "go" or len(args.code) > 1):
+        parser.error("--go-stream needs --target go and a single --code expression")
+    if args.go_package and (args.target != "go" or args.go_stream):
+        parser.error("--go-package needs --target go and cannot be combined with --go-stream")
+    input_types = {}
+    for spec in args.go_input or []:
+        name, sep, kind = spec.partition("=")
+        if not sep or kind not in GO_INPUT_TYPES:
+            parser.error(
+                f"--go-input expects NAME={'|'.join(GO_INPUT_TYPES)}, got {spec!r}"
+            )
+        input_types[name.strip()] = kind
+
+    def go_only(options: list[str], needs: str, invalid: bool) -> None:
+        """Rejects the first of options set off its default when invalid."""
+        for option in options:
+            dest = option[2:].replace("-", "_")
+            if invalid and getattr(args, dest) != parser.get_default(dest):
+                parser.error(f"{option} needs {needs}")
+
+    go_only(
+        [
+            "--go-result-type",
+            "--go-set-result",
+            "--go-dict-result",
+            "--go-number-type",
+            "--go-overflow",
+            "--go-empty",
+            "--go-return-error",
+            "--go-no-optimize",
+            "--go-fold",
+            "--go-version",
+            "--go-input",
+            "--go-test",
+            "--go-bench",
+            "--go-zero-alloc",
+            "--go-shape",
+        ],
+        "--target go and a single --code expression",
+        args.target != "go"
+        or bool(args.stage)
+        or len(args.code) > 1
+        or bool(args.go_stream),
+    )
+    if args.go_protocol and (
+        args.target != "go"
+        or args.stage
+        or len(args.code) > 1
+        or args.go_stream
+        or args.go_test
+        or args.go_bench
+        or args.go_package not in (None, "main")
+    ):
+        parser.error(
+            "--go-protocol needs --target go, package main and a single --code "
+            "expression, and cannot be combined with --go-test or --go-bench"
+        )
+    go_only(
+        ["--go-context", "--go-parallel-style", "--go-chunking"],
+        "--target go, --parallel and a single --code expression",
+        args.target != "go"
+        or not args.parallel
+        or bool(args.stage)
+        or len(args.code) > 1,
+    )
+
     try:
+        header = load_config(args.config)
+        if args.header is not None:
+            header.provenance = args.header
+        for key in ("source", "flags", "timestamp"):
+            if getattr(args, f"header_{key}") is not None:
+                setattr(header, key, True)
+        if args.license is not None:
+            header.license = args.license
+        if args.license_file is not None:
+            header.license_file = args.license_file
+
         # Parse Python code to IR
         parser_obj = PyToIR()
-        ir = parser_obj.parse(args.code)
+        irs = [parser_obj.parse(code) for code in args.code]
 
         # Generate target code using the adapter
-        output = render_generic(
-            args.target,
-            ir,
-            parallel=args.parallel,
-            mode=getattr(args, "mode", None),
-            unsafe=getattr(args, "unsafe", False),
-            explain=not getattr(args, "no_explain", False),
-            dialect=getattr(args, "sql_dialect", None),
-            int_type=getattr(args, "int_type", None),
-        )
+        extra = {"func_name": args.func_name} if args.func_name else {}
+        if args.stage:
+            output = render_go_pipeline(
+                [(name, ir) for (name, _), ir in zip(stages, irs)],
+                fuse=args.fuse,
+                **extra,
+            )
+        elif args.go_stream:
+            output = render_go_stream(irs[0], stream_format=args.go_stream)
+        elif len(irs) > 1:
+            output = render_go_multi(irs, fuse=args.fuse, sources=args.code, **extra)
+        else:
+            output = render_generic(
+                args.target,
+                irs[0],
+                **extra,
+                parallel=args.parallel,
+                mode=getattr(args, "mode", None),
+                unsafe=getattr(args, "unsafe", False),
+                explain=not getattr(args, "no_explain", False),
+                dialect=getattr(args, "sql_dialect", None),
+                int_type=getattr(args, "int_type", None),
+                presize=not getattr(args, "no_presize", False),
+                map_impl=getattr(args, "go_map_impl", "builtin"),
+                shard_merge=getattr(args, "go_shard_merge", "sized"),
+                result_type=args.go_result_type,
+                emit=args.go_emit,
+                parallel_style=args.go_parallel_style,
+                cancellable=args.go_context,
+                set_result=args.go_set_result,
+                dict_result=args.go_dict_result,
+                number_type=args.go_number_type,
+                overflow=args.go_overflow,
+                empty=args.go_empty,
+                return_error=args.go_return_error,
+                optimize=not args.go_no_optimize,
+                fold=args.go_fold,
+                go_version=args.go_version,
+                input_types=input_types,
+                doc=args.code[0] if header.source else None,
+                chunking=args.go_chunking,
+                zero_alloc=args.go_zero_alloc,
+            )
+        if args.go_shape:
+            shape = go_result_shape(output, args.func_name or "program")
+            with open(args.go_shape, "w") as f:
+                json.dump(shape, f, indent=2)
+                f.write("\n")
+        if args.go_test:
+            output = render_go_test(
+                output,
+                irs[0],
+                args.func_name or "program",
+                args.go_package or "main",
+                benchmark=args.go_bench,
+                zero_alloc=args.go_zero_alloc,
+            )
+        elif args.go_bench:
+            output = render_go_benchmark(
+                output,
+                args.func_name or "program",
+                args.go_package or "main",
+                zero_alloc=args.go_zero_alloc,
+            )
+        elif args.go_package or args.go_protocol:
+            output = render_go_package(
+                output,
+                args.func_name or "program",
+                args.go_package or "main",
+                protocol=args.go_protocol,
+            )
+
+        source = "\n".join(args.stage or args.code)
+        flags = _recorded_flags(sys.argv[1:])
+        output = render_header(args.target, source, header, flags) + output
 
         if args.target == "sql" and args.execute_sql:
             execute_sql_and_display(output)
@@ -110,6 +579,20 @@ Examples:
         sys.exit(1)
 
 
+def _recorded_flags(argv: list[str]) -> list[str]:
+    """The command-line options a header records: all but the expressions."""
+    flags = []
+    skip = False
+    for arg in argv:
+        if skip:
+            skip = False
+        elif arg in ("--code", "--stage"):
+            skip = True
+        elif not arg.startswith(("--code=", "--stage=")):
+            flags.append(arg)
+    return flags
+
+
 def execute_sql_and_display(sql: str):
     """Execute SQL and display results"""
     import subprocess
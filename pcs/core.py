@@ -6,7 +6,8 @@ from __future__ import annotations
 
 import ast
 import json
-from dataclasses import asdict, dataclass
+import operator
+from dataclasses import asdict, dataclass, field
 from typing import Any
 
 
@@ -22,6 +23,10 @@ class IRGenerator:
     var: str
     source: IRRange | str
     filters: list[str]
+    # Conditions of itertools.takewhile() around the source, innermost
+    # first, in the loop variable: the loop ends at the first value failing
+    # one, before the filters see it
+    take_while: list[str] = field(default_factory=list)
 
 
 @dataclass
@@ -47,6 +52,8 @@ class IRComp:
     val_expr: str | None = None
     reduce: IRReduce | None = None
     provenance: dict = None
+    # sorted() of the comprehension: its values, or a dict's keys, ascending
+    sort: bool = False
 
     def to_json(self) -> str:
         def to_dict(obj: Any):
@@ -62,6 +69,60 @@ class IRComp:
         return json.dumps(to_dict(self), indent=2)
 
 
+_INT_OPS = {
+    ast.Add: operator.add,
+    ast.Sub: operator.sub,
+    ast.Mult: operator.mul,
+    ast.FloorDiv: operator.floordiv,
+    ast.Mod: operator.mod,
+    ast.Pow: operator.pow,
+    ast.LShift: operator.lshift,
+    ast.RShift: operator.rshift,
+    ast.BitAnd: operator.and_,
+    ast.BitOr: operator.or_,
+    ast.BitXor: operator.xor,
+    ast.USub: operator.neg,
+    ast.UAdd: operator.pos,
+    ast.Invert: operator.invert,
+}
+
+
+def const_int(node: ast.AST) -> int | None:
+    """
+    The value of an int expression of literals, such as -2 or 10**6, None
+    for anything else: a name, a call, a float or a bool, an operation
+    Python would raise on, or a power or shift by more than 64.
+    """
+    try:
+        if isinstance(node, ast.Constant):
+            return node.value if type(node.value) is int else None
+        if isinstance(node, ast.UnaryOp):
+            operand = const_int(node.operand)
+            if operand is None:
+                return None
+            return _INT_OPS[type(node.op)](operand)
+        if isinstance(node, ast.BinOp):
+            left, right = const_int(node.left), const_int(node.right)
+            if left is None or right is None:
+                return None
+            # Powers and shifts too large for a Go int are not computed
+            if isinstance(node.op, (ast.Pow, ast.LShift)) and right > 64:
+                return None
+            value = _INT_OPS[type(node.op)](left, right)
+            return value if type(value) is int else None
+    except (KeyError, ArithmeticError, ValueError):
+        return None
+    return None
+
+
+def is_takewhile(node: ast.AST) -> bool:
+    """Whether node calls takewhile() or itertools.takewhile()."""
+    return isinstance(node, ast.Call) and ast.unparse(node.func) in (
+        "takewhile",
+        "itertools.takewhile",
+    )
+
+
 class PyToIR:
     def parse(self, code: str) -> IRComp:
         tree = ast.parse(code)
@@ -135,18 +196,53 @@ class PyToIR:
         )
 
     def _parse_call(self, node: ast.Call) -> IRComp:
-        """Parse function calls like sum(), max(), min(), any(), all()"""
-        if not isinstance(node.func, ast.Name):
+        """Parse calls like sum(), math.prod(), max(), any(), sorted() and next()"""
+        if (
+            isinstance(node.func, ast.Attribute)
+            and node.func.attr == "join"
+            and isinstance(node.func.value, ast.Constant)
+            and isinstance(node.func.value.value, str)
+        ):
+            return self._parse_join(node)
+        if isinstance(node.func, ast.Name):
+            func_name = node.func.id
+        elif ast.unparse(node.func) == "math.prod":
+            func_name = "prod"
+        else:
             raise ValueError(f"Unsupported function call: {ast.unparse(node)}")
 
-        func_name = node.func.id
-        if func_name not in ("sum", "max", "min", "any", "all"):
+        if func_name not in (
+            "sum",
+            "prod",
+            "max",
+            "min",
+            "any",
+            "all",
+            "sorted",
+            "next",
+        ):
             raise ValueError(f"Unsupported function: {func_name}")
 
-        if len(node.args) != 1:
+        if func_name == "next":
+            return self._parse_next(node)
+        initial = None
+        if func_name != "sorted":
+            initial = self._reduce_initial(func_name, node)
+        if len(node.args) - (func_name == "sum" and len(node.args) == 2) != 1:
             raise ValueError(f"Function {func_name} expects exactly one argument")
 
         arg = node.args[0]
+        if func_name == "sorted":
+            if node.keywords:
+                raise ValueError("sorted() with key or reverse is not supported")
+            if not isinstance(
+                arg, (ast.ListComp, ast.SetComp, ast.DictComp, ast.GeneratorExp)
+            ):
+                raise ValueError("Function sorted expects a comprehension")
+            ir = self._parse_expr(arg)
+            ir.sort = True
+            ir.provenance = {"origin": "call_sorted"}
+            return ir
         if isinstance(arg, ast.GeneratorExp):
             # Parse the generator expression
             generators = [self._parse_generator(gen) for gen in arg.generators]
@@ -156,43 +252,139 @@ class PyToIR:
                 kind="generator",
                 generators=generators,
                 element=element,
-                reduce=IRReduce(kind=func_name),
+                reduce=IRReduce(kind=func_name, initial=initial),
                 provenance={"origin": f"call_{func_name}"},
             )
         else:
             raise ValueError(f"Function {func_name} expects a generator expression")
 
+    @staticmethod
+    def _reduce_initial(func_name: str, node: ast.Call) -> str | None:
+        """
+        The value the reduction of node starts from, as Python takes it:
+        sum()'s start, positional or by keyword, math.prod()'s start=, or
+        the default= that max() and min() return for no values; None when
+        there is none.
+        """
+        name = {"sum": "start", "prod": "start", "max": "default", "min": "default"}
+        values = [k.value for k in node.keywords if k.arg == name.get(func_name)]
+        if len(values) != len(node.keywords):
+            raise ValueError(f"Function {func_name} takes no such keyword argument")
+        if func_name == "sum" and len(node.args) == 2:
+            values.append(node.args[1])
+        if len(values) > 1:
+            raise ValueError(f"Function {func_name} got {name[func_name]} twice")
+        return ast.unparse(values[0]) if values else None
+
+    def _parse_next(self, node: ast.Call) -> IRComp:
+        """Parse next() of a generator expression, with a default or without"""
+        if not 1 <= len(node.args) <= 2 or node.keywords:
+            raise ValueError(
+                "Function next expects a generator and an optional default"
+            )
+        arg = node.args[0]
+        if not isinstance(arg, ast.GeneratorExp):
+            raise ValueError("Function next expects a generator expression")
+        generators = [self._parse_generator(gen) for gen in arg.generators]
+        # The reduction's initial value is the default, None when there is
+        # none and next() raises StopIteration
+        initial = ast.unparse(node.args[1]) if len(node.args) == 2 else None
+        return IRComp(
+            kind="generator",
+            generators=generators,
+            element=ast.unparse(arg.elt),
+            reduce=IRReduce(kind="next", initial=initial),
+            provenance={"origin": "call_next"},
+        )
+
+    def _parse_join(self, node: ast.Call) -> IRComp:
+        """Parse sep.join() of a generator expression or list comprehension"""
+        if len(node.args) != 1 or node.keywords:
+            raise ValueError("Function join expects exactly one argument")
+        arg = node.args[0]
+        if not isinstance(arg, (ast.GeneratorExp, ast.ListComp)):
+            raise ValueError(
+                "Function join expects a generator expression or list comprehension"
+            )
+        generators = [self._parse_generator(gen) for gen in arg.generators]
+        return IRComp(
+            kind="generator",
+            generators=generators,
+            element=ast.unparse(arg.elt),
+            # The reduction's op is the separator the strings are joined with
+            reduce=IRReduce(kind="join", op=node.func.value.value),
+            provenance={"origin": "call_join"},
+        )
+
     def _parse_generator(self, node: ast.comprehension) -> IRGenerator:
-        var = node.target.id if isinstance(node.target, ast.Name) else "x"
-        source = self._parse_source(node.iter)
+        # A tuple target, as of zip() or enumerate(), is kept as written
+        target = node.target
+        var = target.id if isinstance(target, ast.Name) else ast.unparse(target)
+        iterable, take_while = node.iter, []
+        while is_takewhile(iterable):
+            take_while.insert(0, self._parse_predicate(iterable, target))
+            iterable = iterable.args[1]
+        if take_while and isinstance(
+            iterable, (ast.ListComp, ast.SetComp, ast.DictComp, ast.GeneratorExp)
+        ):
+            raise ValueError("takewhile() over a comprehension is not supported")
+        source = self._parse_source(iterable)
         filters = [ast.unparse(f) for f in node.ifs]
 
-        return IRGenerator(var=var, source=source, filters=filters)
+        return IRGenerator(
+            var=var, source=source, filters=filters, take_while=take_while
+        )
+
+    def _parse_predicate(self, node: ast.Call, target: ast.expr) -> str:
+        """
+        The condition of takewhile(lambda v: cond, ...) in the loop variable
+        target: cond with v renamed to it.
+        """
+        if len(node.args) != 2 or node.keywords:
+            raise ValueError("Function takewhile expects a predicate and an iterable")
+        pred = node.args[0]
+        params = pred.args if isinstance(pred, ast.Lambda) else None
+        if not (
+            params
+            and len(params.args) == 1
+            and not (params.posonlyargs or params.vararg or params.kwonlyargs)
+            and not (params.kwarg or params.defaults)
+        ):
+            raise ValueError(
+                "Function takewhile expects a lambda of one argument: "
+                f"{ast.unparse(pred)}"
+            )
+        if not isinstance(target, ast.Name):
+            raise ValueError(
+                f"takewhile() needs a single loop variable: {ast.unparse(target)}"
+            )
+        param = params.args[0].arg
+        names = {n.id for n in ast.walk(pred.body) if isinstance(n, ast.Name)}
+        if param != target.id and target.id in names:
+            # The loop variable is shadowed inside the lambda
+            raise ValueError(
+                f"takewhile() predicate reads {target.id}, the loop variable, "
+                f"as another name: {ast.unparse(pred)}"
+            )
+
+        class Rename(ast.NodeTransformer):
+            def visit_Name(self, n: ast.Name) -> ast.Name:
+                return ast.Name(target.id) if n.id == param else n
+
+        return ast.unparse(Rename().visit(pred.body))
 
     def _parse_source(self, node: ast.AST) -> IRRange | str:
         if (
             isinstance(node, ast.Call)
             and isinstance(node.func, ast.Name)
             and node.func.id == "range"
+            and 1 <= len(node.args) <= 3
         ):
-            args = node.args
-            if len(args) == 1:
-                return IRRange(0, self._eval_const(args[0]))
-            elif len(args) == 2:
-                return IRRange(self._eval_const(args[0]), self._eval_const(args[1]))
-            elif len(args) == 3:
-                return IRRange(
-                    self._eval_const(args[0]),
-                    self._eval_const(args[1]),
-                    self._eval_const(args[2]),
-                )
+            bounds = [const_int(a) for a in node.args]
+            # A bound read from a variable, such as the outer loop's in
+            # range(x, 2 * x), is kept as written with the source
+            if None not in bounds:
+                if len(bounds) == 1:
+                    bounds.insert(0, 0)
+                return IRRange(*bounds)
         return ast.unparse(node)
-
-    def _eval_const(self, node: ast.AST) -> int:
-        if isinstance(node, ast.Constant):
-            return node.value
-        elif isinstance(node, ast.Num):  # Python < 3.8
-            return node.n
-        else:
-            # For non-constant expressions, return a placeholder
-            return 10
@@ -4,6 +4,7 @@ import inspect
 from collections.abc import Callable
 from typing import Any, Protocol
 
+from pcs.renderers.c import render_c  # noqa: F401
 from pcs.renderers.csharp import render_csharp  # noqa: F401
 from pcs.renderers.go import render_go  # noqa: F401
 from pcs.renderers.julia import render_julia  # noqa: F401
@@ -28,9 +29,46 @@ _BACKENDS: dict[str, RendererFn] = {
     "csharp": render_csharp,
     "julia": render_julia,
     "sql": render_sql,
+    "c": render_c,
 }
 
 
+# Constructs a backend may declare in its module-level CAPABILITIES set.
+CONSTRUCTS = (
+    "list",
+    "set",
+    "dict",
+    "reduce",
+    "nested",
+    "parallel",
+    "sharded_dict",
+    "fusion",
+    "stream",
+    "pipeline",
+    "float",
+    "strings",
+    "sorted",
+    "early_exit",
+    "reduce_initial",
+)
+
+
+def capabilities(target: str | None = None) -> dict[str, dict[str, bool]]:
+    """
+    Capability matrix: backend -> construct -> supported.
+    Backends without a CAPABILITIES declaration report nothing as supported.
+    """
+    targets = [target] if target is not None else sorted(_BACKENDS)
+    matrix = {}
+    for name in targets:
+        if name not in _BACKENDS:
+            raise ValueError(f"Unknown target: {name}. Known: {sorted(_BACKENDS)}")
+        module = inspect.getmodule(_BACKENDS[name])
+        declared = getattr(module, "CAPABILITIES", frozenset())
+        matrix[name] = {c: c in declared for c in CONSTRUCTS}
+    return matrix
+
+
 def _filter_kwargs(fn: Callable[..., Any], **kwargs) -> dict[str, Any]:
     """Return only the kwargs that `fn` actually accepts (tolerates mismatches)."""
     sig = inspect.signature(fn)
@@ -48,6 +86,26 @@ def render(target: str, ir: Any, **kwargs) -> str:
     if target not in _BACKENDS:
         raise ValueError(f"Unknown target: {target}. Known: {sorted(_BACKENDS)}")
     fn = _BACKENDS[target]
+    if getattr(ir, "sort", False) and not capabilities(target)[target]["sorted"]:
+        raise ValueError(f"sorted() is not supported by the {target} backend")
+    reduce = getattr(ir, "reduce", None)
+    if reduce and reduce.kind == "join" and not capabilities(target)[target]["strings"]:
+        raise ValueError(f"str.join() is not supported by the {target} backend")
+    early = reduce and reduce.kind == "next" or any(
+        getattr(g, "take_while", None) for g in getattr(ir, "generators", [])
+    )
+    if early and not capabilities(target)[target]["early_exit"]:
+        raise ValueError(f"takewhile()/next() is not supported by the {target} backend")
+    if (
+        reduce
+        and reduce.kind in ("sum", "prod", "max", "min")
+        and getattr(reduce, "initial", None) is not None
+        and not capabilities(target)[target]["reduce_initial"]
+    ):
+        raise ValueError(
+            f"sum()/math.prod() start and max()/min() default= are not supported "
+            f"by the {target} backend"
+        )
     safe_kwargs = _filter_kwargs(fn, **kwargs)
     return fn(ir, **safe_kwargs)
 
@@ -75,3 +133,7 @@ def render_julia(ir: Any, **kwargs) -> str:
 
 def render_sql(ir: Any, **kwargs) -> str:
     return render("sql", ir, **kwargs)
+
+
+def render_c(ir: Any, **kwargs) -> str:
+    return render("c", ir, **kwargs)
@@ -0,0 +1,249 @@
+"""
+C renderer for Polyglot Code Sampler
+"""
+
+from __future__ import annotations
+
+import ast
+
+from ..core import IRComp, IRRange, const_int
+
+# Reductions to one value only: C has no built-in list, set or map to
+# return, and the cgo runner of pcs-bench calls these from Go.
+CAPABILITIES = frozenset({"reduce", "nested", "reduce_initial"})
+
+# C precedences, higher binds tighter: ?: 1, || 2, && 3, | 4, ^ 5, & 6,
+# == != 7, < <= > >= 8, << >> 9, + - 10, * / % 11, unary 12, operands 13
+_BIN_OPS = {
+    ast.Add: ("+", 10),
+    ast.Sub: ("-", 10),
+    ast.Mult: ("*", 11),
+    ast.FloorDiv: ("/", 11),
+    ast.Mod: ("%", 11),
+    ast.LShift: ("<<", 9),
+    ast.RShift: (">>", 9),
+    ast.BitAnd: ("&", 6),
+    ast.BitXor: ("^", 5),
+    ast.BitOr: ("|", 4),
+}
+_CMP_OPS = {
+    ast.Eq: ("==", 7),
+    ast.NotEq: ("!=", 7),
+    ast.Lt: ("<", 8),
+    ast.LtE: ("<=", 8),
+    ast.Gt: (">", 8),
+    ast.GtE: (">=", 8),
+}
+
+_ABS_HELPER = "static inline int64_t pcs_abs(int64_t v) { return v < 0 ? -v : v; }"
+
+
+class _CExpr:
+    """
+    Python int expressions over the loop variables as C: arithmetic in
+    int64_t, and, or and not as &&, || and !, a chained comparison one
+    comparison per pair, an int's Python truth as != 0. As in the Go
+    backend, // and % truncate toward zero, which agrees with Python for
+    the non-negative operands of the benchmark snippets, and arithmetic
+    wraps (the code is built with -fwrapv).
+    """
+
+    def __init__(self, names: set[str]):
+        self.names = names
+        self.helpers: list[str] = []
+
+    def value(self, expr: str) -> str:
+        return self._expr(ast.parse(expr, mode="eval").body)[0]
+
+    def cond(self, expr: str) -> str:
+        return self._cond(ast.parse(expr, mode="eval").body)[0]
+
+    def _wrap(self, part: tuple[str, int], prec: int) -> str:
+        text, own = part
+        return f"({text})" if own < prec else text
+
+    def _expr(self, node: ast.expr) -> tuple[str, int]:
+        if isinstance(node, ast.Constant) and type(node.value) is int:
+            if not -(2**63) <= node.value < 2**63:
+                raise ValueError(f"C has no int64_t literal {node.value}")
+            return str(node.value), 13
+        if isinstance(node, ast.Constant) and isinstance(node.value, bool):
+            return str(int(node.value)), 13
+        if isinstance(node, ast.Name):
+            if node.id not in self.names:
+                raise ValueError(f"C renders loop variables only, not {node.id}")
+            return node.id, 13
+        if isinstance(node, ast.UnaryOp) and isinstance(node.op, (ast.USub, ast.UAdd, ast.Invert)):
+            op = {ast.USub: "-", ast.UAdd: "+", ast.Invert: "~"}[type(node.op)]
+            return op + self._wrap(self._expr(node.operand), 12), 12
+        if isinstance(node, ast.BinOp) and isinstance(node.op, ast.Pow):
+            exponent = const_int(node.right)
+            if exponent is None or not 1 <= exponent <= 8:
+                raise ValueError(
+                    f"C renders ** with a constant exponent of 1 to 8 only: {ast.unparse(node)}"
+                )
+            base = self._wrap(self._expr(node.left), 12)
+            return " * ".join([base] * exponent), 11
+        if isinstance(node, ast.BinOp) and type(node.op) in _BIN_OPS:
+            op, prec = _BIN_OPS[type(node.op)]
+            left = self._wrap(self._expr(node.left), prec)
+            right = self._wrap(self._expr(node.right), prec + 1)
+            return f"{left} {op} {right}", prec
+        if isinstance(node, ast.IfExp):
+            test = self._wrap(self._cond(node.test), 2)
+            body = self._wrap(self._expr(node.body), 2)
+            orelse = self._wrap(self._expr(node.orelse), 1)
+            return f"{test} ? {body} : {orelse}", 1
+        if (
+            isinstance(node, ast.Call)
+            and isinstance(node.func, ast.Name)
+            and node.func.id == "abs"
+            and len(node.args) == 1
+            and not node.keywords
+        ):
+            if _ABS_HELPER not in self.helpers:
+                self.helpers.append(_ABS_HELPER)
+            return f"pcs_abs({self._expr(node.args[0])[0]})", 13
+        if isinstance(node, (ast.Compare, ast.BoolOp)) or (
+            isinstance(node, ast.UnaryOp) and isinstance(node.op, ast.Not)
+        ):
+            # A condition used as an int is 0 or 1, as a Python bool
+            return self._cond(node)
+        raise ValueError(f"C has no translation of {ast.unparse(node)}")
+
+    def _cond(self, node: ast.expr) -> tuple[str, int]:
+        if isinstance(node, ast.BoolOp):
+            op, prec = ("&&", 3) if isinstance(node.op, ast.And) else ("||", 2)
+            return f" {op} ".join(self._wrap(self._cond(v), prec) for v in node.values), prec
+        if isinstance(node, ast.UnaryOp) and isinstance(node.op, ast.Not):
+            return "!" + self._wrap(self._cond(node.operand), 12), 12
+        if isinstance(node, ast.Compare):
+            if not all(type(op) in _CMP_OPS for op in node.ops):
+                raise ValueError(f"C has no translation of {ast.unparse(node)}")
+            operands = [node.left, *node.comparators]
+            pairs = []
+            for a, op, b in zip(operands, node.ops, operands[1:]):
+                symbol, prec = _CMP_OPS[type(op)]
+                left = self._wrap(self._expr(a), prec)
+                right = self._wrap(self._expr(b), prec + 1)
+                pairs.append((f"{left} {symbol} {right}", prec))
+            if len(pairs) == 1:
+                return pairs[0]
+            return " && ".join(self._wrap(p, 3) for p in pairs), 3
+        if isinstance(node, ast.Constant) and isinstance(node.value, bool):
+            return str(node.value).lower(), 13
+        return f"{self._wrap(self._expr(node), 8)} != 0", 7
+
+
+def _range_args(gen, exprs: _CExpr) -> tuple[str, str, int]:
+    """
+    The start, stop and constant step of a generator's range, as C over
+    the loop variables outside it.
+    """
+    if isinstance(gen.source, IRRange) or hasattr(gen.source, "stop"):
+        return str(gen.source.start), str(gen.source.stop), gen.source.step
+    node = ast.parse(gen.source, mode="eval").body
+    if not (
+        isinstance(node, ast.Call)
+        and isinstance(node.func, ast.Name)
+        and node.func.id == "range"
+        and 1 <= len(node.args) <= 3
+        and not node.keywords
+    ):
+        raise ValueError(f"C loops over range() only, not {gen.source}")
+    args = list(node.args)
+    step = const_int(args[2]) if len(args) == 3 else 1
+    if not step:
+        raise ValueError(f"C needs a constant, non-zero range() step: {gen.source}")
+    if len(args) == 1:
+        args.insert(0, ast.Constant(0))
+    return exprs.value(ast.unparse(args[0])), exprs.value(ast.unparse(args[1])), step
+
+
+def render_c(ir: IRComp, func_name: str = "program", parallel: bool = False) -> str:
+    """
+    C backend for reductions to one value:
+      sum/prod/max/min -> int64_t, any/all -> bool
+    Notes:
+      - Nested for loops over range() with the filters as continue, as the
+        Go backend's loops; any/all return once decided
+      - max/min start from the first value, and a max/min of no values is
+        0 unless it has a default=, as in the Go backend
+      - sum()'s and math.prod()'s start and max()'s and min()'s default=
+        seed the accumulator and must be int literals
+      - Built with -fwrapv, int64_t arithmetic wraps as Go's int does
+      - Sequential only: the point is a C loop next to the Go one, which
+        the cgo runner of pcs-bench times through cgo (see
+        scripts/bench_go_cgo.go)
+    """
+    if parallel:
+        raise ValueError("the C backend renders sequential loops only")
+    reduce = ir.reduce
+    if reduce is None or reduce.kind not in ("sum", "prod", "max", "min", "any", "all"):
+        raise ValueError("C renders sum/prod/max/min/any/all reductions only")
+    if getattr(ir, "sort", False):
+        raise ValueError("sorted() is not supported by the C backend")
+
+    names: set[str] = set()
+    exprs = _CExpr(names)
+    loops: list[str] = []
+    indent = "    "
+    for gen in ir.generators:
+        if getattr(gen, "take_while", None):
+            raise ValueError("takewhile() is not supported by the C backend")
+        if not gen.var.isidentifier():
+            raise ValueError(f"C loops with one variable: for {gen.var}")
+        start, stop, step = _range_args(gen, exprs)
+        names.add(gen.var)
+        test = "<" if step > 0 else ">"
+        loops.append(
+            f"{indent}for (int64_t {gen.var} = {start}; {gen.var} {test} {stop}; "
+            f"{gen.var} += {step}) {{"
+        )
+        indent += "    "
+        loops += [f"{indent}if (!({exprs.cond(f)})) continue;" for f in gen.filters]
+
+    kind = reduce.kind
+    element = ir.element or "0"
+    if kind in ("any", "all"):
+        return_type = "bool"
+        test = exprs.cond(element if kind == "any" else f"not ({element})")
+        body = [f"if ({test}) return {'true' if kind == 'any' else 'false'};"]
+        init, tail = [], ["false" if kind == "any" else "true"]
+    else:
+        return_type = "int64_t"
+        initial = {"prod": "1"}.get(kind, "0")
+        if reduce.initial is not None:
+            value = const_int(ast.parse(reduce.initial, mode="eval").body)
+            if value is None:
+                raise ValueError(
+                    f"C needs an int literal to start {kind}() from: {reduce.initial}"
+                )
+            initial = str(value)
+        init = [f"int64_t acc = {initial};"]
+        value = exprs.value(element)
+        if kind == "sum":
+            body = [f"acc += {value};"]
+        elif kind == "prod":
+            body = [f"acc *= {value};"]
+        else:
+            init.append("bool seen = false;")
+            better = ">" if kind == "max" else "<"
+            body = [
+                f"int64_t pcs_v = {value};",
+                f"if (!seen || pcs_v {better} acc) {{ acc = pcs_v; seen = true; }}",
+            ]
+        tail = ["acc"]
+
+    lines = ["#include <stdbool.h>", "#include <stdint.h>", ""]
+    if exprs.helpers:
+        lines += exprs.helpers + [""]
+    lines.append(f"{return_type} {func_name}(void) {{")
+    lines += [f"    {s}" for s in init]
+    lines += loops
+    lines += [f"{indent}{s}" for s in body]
+    for depth in range(len(ir.generators), 0, -1):
+        lines.append("    " * depth + "}")
+    lines.append(f"    return {tail[0]};")
+    lines.append("}")
+    return "\n".join(lines) + "\n"
@@ -4,6 +4,9 @@ C# renderer for Polyglot Code Sampler
 
 from ..core import IRComp
 
+# LINQ pipelines are int-typed and nested generators are stubbed out.
+CAPABILITIES = frozenset({"list", "set", "dict", "reduce", "parallel"})
+
 
 def render_csharp(
     ir: IRComp, func_name: str = "Program", parallel: bool = False
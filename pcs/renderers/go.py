@@ -2,46 +2,3815 @@
 Go renderer for Polyglot Code Sampler
 """
 
-from ..core import IRComp
+from __future__ import annotations
+
+import ast
+import json
+import itertools
+import math
+import operator
+import re
+import types
+from dataclasses import dataclass, replace
+
+from ..core import IRComp, IRGenerator, IRRange, IRReduce, const_int, is_takewhile
+
+# Elements are ints, or collections of ints built by inner comprehensions;
+# strings are built by str.join() only.
+CAPABILITIES = frozenset(
+    {
+        "list",
+        "set",
+        "dict",
+        "reduce",
+        "nested",
+        "parallel",
+        "sharded_dict",
+        "fusion",
+        "stream",
+        "pipeline",
+        "strings",
+        "sorted",
+        "early_exit",
+        "reduce_initial",
+    }
+)
+
+
+def _range_len(start: int, stop: int, step: int) -> int:
+    """Number of values produced by range(start, stop, step)."""
+    if step > 0 and stop > start:
+        return (stop - start + step - 1) // step
+    if step < 0 and stop < start:
+        return (start - stop - step - 1) // -step
+    return 0
+
+
+def _size_hint(gen: IRGenerator, start: int, stop: int, step: int) -> int | None:
+    """
+    Estimate how many values survive the generator's filters.
+    Comparisons of the variable with int constants (`var > c`, `a <= var < b`)
+    narrow the range, and `var % k == c` / `var % k != c` filters divide what
+    is left; any other filter makes the cardinality unknown and no hint is
+    emitted.
+    """
+    var = re.escape(gen.var)
+    modulo = re.compile(rf"^\(?\s*{var}\s*%\s*(\d+)\s*(==|!=)\s*\d+\s*\)?$")
+    compare = re.compile(
+        rf"^\(?\s*(?:(-?\d+)\s*([<>]=?)\s*)?{var}\s*(?:([<>]=?)\s*(-?\d+))?\s*\)?$"
+    )
+    lo = hi = None
+    moduli = []
+    for filter_expr in gen.filters:
+        m = modulo.match(filter_expr.strip())
+        if m:
+            if int(m.group(1)) == 0:
+                return None
+            moduli.append((int(m.group(1)), m.group(2)))
+            continue
+        m = compare.match(filter_expr.strip())
+        if not m or not (m.group(1) or m.group(4)):
+            return None
+        bounds = []
+        if m.group(1):
+            # `c < var` bounds var as `var > c` does
+            flip = {"<": ">", "<=": ">=", ">": "<", ">=": "<="}
+            bounds.append((flip[m.group(2)], int(m.group(1))))
+        if m.group(4):
+            bounds.append((m.group(3), int(m.group(4))))
+        for op, c in bounds:
+            if op[0] == ">":
+                low = c + 1 if op == ">" else c
+                lo = low if lo is None else max(lo, low)
+            else:
+                high = c - 1 if op == "<" else c
+                hi = high if hi is None else min(hi, high)
+    # The values of the range inside [lo, hi]
+    if step > 0:
+        if lo is not None and lo > start:
+            start += (lo - start + step - 1) // step * step
+        if hi is not None:
+            stop = min(stop, hi + 1)
+    elif step < 0:
+        if hi is not None and hi < start:
+            start += (start - hi - step - 1) // -step * step
+        if lo is not None:
+            stop = max(stop, lo - 1)
+    size = _range_len(start, stop, step)
+    for k, op in moduli:
+        if op == "==":
+            size = (size + k - 1) // k
+        else:
+            size = size - size // k
+    return size
+
+
+def _nested_size_hint(generators: list[IRGenerator]) -> int | None:
+    """
+    _size_hint of nested generators: the product of each one's, when every
+    range has constant bounds.
+    """
+    size = 1
+    for gen in generators:
+        bounds = _loop_bounds(gen)
+        if bounds is None or not all(type(b) is int for b in bounds):
+            return None
+        hint = _size_hint(gen, *bounds)
+        if hint is None:
+            return None
+        size *= hint
+    return size
+
+
+def _make_map(map_type: str, hint: int | None) -> str:
+    if hint is None:
+        return f"make({map_type})"
+    return f"make({map_type}, {hint})"
+
+
+SHARD_MERGE_STRATEGIES = ("ordered", "sized", "adopt", "wrap")
+
+# render_go forms of a set comprehension's result: the map[int]struct{} set
+# itself, or its elements as an ascending []int
+GO_SET_RESULTS = ("map", "sorted")
+
+# render_go forms of a dict comprehension's result: the map itself, or its
+# entries as [key, value] pairs in ascending key order
+GO_DICT_RESULTS = ("map", "sorted")
+
+# render_go map implementations for dict results: Go's built-in map, the
+# vendored swissMap of pcs_swiss.go, or a sync.Map for concurrent consumers
+GO_MAP_IMPLS = ("builtin", "swiss", "sync")
+
+# Numeric types render_go can declare a reduction's result as (result_type) and
+# build a comprehension's values in (number_type)
+GO_RESULT_TYPES = (
+    "int",
+    "int8",
+    "int16",
+    "int32",
+    "int64",
+    "uint",
+    "uint8",
+    "uint16",
+    "uint32",
+    "uint64",
+    "float32",
+    "float64",
+)
+
+# render_go handling of sum/prod overflow: int arithmetic wrapping silently,
+# or an int64 accumulator checked on every step that panics, saturates at
+# the int64 bounds or carries on in a math/big.Int
+GO_OVERFLOW_MODES = ("wrap", "panic", "saturate", "big")
+
+# render_go handling of a max() or min() of no values without a default=:
+# return 0, or panic with the message of the ValueError Python raises
+GO_EMPTY_MODES = ("zero", "panic")
+
+# render_go constant folding of reductions: none, the precomputed value
+# returned under the build constraint !pcs_verify, or the loops as usual
+# under pcs_verify, to build against it with -tags pcs_verify
+GO_FOLD_MODES = ("off", "const", "verify")
+
+# The most values fold evaluates one by one; a sum over more folds only in
+# closed form
+_FOLD_LIMIT = 10**6
+
+# render_go emission styles: inline loops, calls into pcs_helpers.go, lazy
+# range-over-func iterators, or values streamed over a channel
+GO_EMIT_STYLES = ("loops", "helpers", "iter", "chan")
+
+# Buffer of the channel emit="chan" returns, letting the producer run ahead
+# of its consumer by this many values
+_CHAN_BUFFER = 256
+
+
+# render_go types of the inputs a comprehension may iterate besides []int:
+# a string, looped over by rune, a []byte, by index, an Arrow int64 column,
+# or the path of a Parquet file holding an int64 column of the input's name
+GO_INPUT_TYPES = {
+    "string": "string",
+    "bytes": "[]byte",
+    "arrow": "*array.Int64",
+    "parquet": "string",
+}
+
+# The Go module of the Arrow and Parquet packages columns are read with
+_ARROW_MODULE = "github.com/apache/arrow-go/v18"
+
+# Python str methods of a character and the Go unicode functions of a rune
+# testing the same; ASCII characters agree, others may not (Python's
+# isdigit() takes superscripts, unicode.IsDigit does not)
+_RUNE_TESTS = {
+    "isdigit": ["IsDigit"],
+    "isalpha": ["IsLetter"],
+    "isalnum": ["IsLetter", "IsDigit"],
+    "isspace": ["IsSpace"],
+    "isupper": ["IsUpper"],
+    "islower": ["IsLower"],
+}
+_RUNE_MAPS = {"upper": "ToUpper", "lower": "ToLower"}
+
+# The most bytes strconv writes for a Go int: an int64's 19 digits and sign
+_INT_DIGITS = 20
+
+
+# render_go parallel styles: a goroutine per chunk under a sync.WaitGroup or
+# golang.org/x/sync/errgroup (a context parameter, worker panics returned as
+# errors), or a pool of a given number of workers taking chunks off a channel
+GO_PARALLEL_STYLES = ("waitgroup", "errgroup", "pool")
+
+# Chunks per worker of parallel_style="pool", so that workers finishing early
+# take over the rest of the work
+_POOL_CHUNKS_PER_WORKER = 4
+
+
+# render_go chunkings of a parallel range: an equal chunk per worker (per
+# chunk of a pool), or sized at run time from the range's length and
+# GOMAXPROCS, never below _MIN_CHUNK_SIZE values
+GO_CHUNKINGS = ("even", "auto")
+
+# Fewest values chunking="auto" hands a goroutine: a few microseconds of
+# loop at a nanosecond or so a value, against the microsecond or so it takes
+# to start one and combine its partial
+_MIN_CHUNK_SIZE = 4096
+
+
+def _parallel_imports(
+    style: str, imports: set[str], cancellable: bool
+) -> list[str]:
+    """Import block of a parallel function in the given style."""
+    if style == "errgroup":
+        imports = imports | {"context", "fmt", "golang.org/x/sync/errgroup"}
+    else:
+        imports = imports | {"sync"}
+    if cancellable:
+        imports = imports | {"context"}
+    lines = ["import ("]
+    lines += [f'    "{imp}"' for imp in sorted(imports | {"runtime"})]
+    return lines + [")", ""]
+
+
+def _parallel_signature(
+    func_name: str, return_type: str, style: str, cancellable: bool
+) -> str:
+    """
+    A parallel function's signature: a cancellable one (always errgroup's)
+    takes a context first and returns an error next to its result.
+    """
+    params = ["workers int"] if style == "pool" else []
+    if cancellable or style == "errgroup":
+        params.insert(0, "ctx context.Context")
+        return_type = f"({return_type}, error)"
+    return f"func {func_name}({', '.join(params)}) {return_type} {{"
+
+
+def _parallel_chunks(style: str, total: int) -> tuple[list[str], str]:
+    """
+    Lines splitting the range's total values into chunks of chunkSize, and
+    the variable holding their number: one chunk per GOMAXPROCS, or for
+    style="pool" several per worker (GOMAXPROCS workers when workers < 1).
+    Chunk partials are indexed by _chunk_id.
+    """
+    if style == "pool":
+        return [
+            "    if workers < 1 { workers = runtime.GOMAXPROCS(0) }",
+            f"    total := {total}",
+            f"    numChunks := {_POOL_CHUNKS_PER_WORKER} * workers",
+            "    chunkSize := (total + numChunks - 1) / numChunks",
+        ], "numChunks"
+    return [
+        "    numWorkers := runtime.GOMAXPROCS(0)",
+        f"    total := {total}",
+        "    chunkSize := (total + numWorkers - 1) / numWorkers",
+    ], "numWorkers"
+
+
+# Reductions zero_alloc applies to: a scalar accumulated, or found, in
+# registers or on the stack
+_ZERO_ALLOC_REDUCTIONS = ("sum", "prod", "max", "min", "any", "all", "next")
+
+# Go that allocates on the heap, or may: zero_alloc rejects a function, or
+# a helper it calls, with any of it
+_HEAP_CONSTRUCTS = {
+    "make": r"\bmake\(",
+    "append": r"\bappend\(",
+    "new": r"\bnew\(",
+    "a goroutine": r"^\s*go ",
+    "a map": r"\bmap\[",
+    "a slice literal": r"\[\]\w+\{",
+    "a pointer literal": r"&\w+\{",
+    "a string conversion": r"\bstring\(",
+    "math/big": r"\bbig\.",
+    "a channel": r"\bchan\b",
+}
+
+
+def _check_zero_alloc(code: str) -> None:
+    """
+    Raise ValueError when code, a function rendered with zero_alloc=True
+    and the helpers it calls, holds a construct that allocates.
+    """
+    for name, pattern in _HEAP_CONSTRUCTS.items():
+        m = re.search(pattern, code, re.M)
+        if m:
+            line = code[: m.start()].count("\n") + 1
+            raise ValueError(f"zero_alloc: the Go code allocates with {name} (line {line})")
+
+
+def _adaptive_chunks(code: str) -> str:
+    """
+    code, a parallel function, with chunking="auto": the even chunk size
+    raised to _MIN_CHUNK_SIZE, and the number of workers, or of a pool's
+    chunks, cut to the chunks the range then fills, at least one. A range
+    too short to pay for the goroutines runs on fewer of them, down to one.
+    """
+    for count in ("numWorkers", "numChunks"):
+        even = f"    chunkSize := (total + {count} - 1) / {count}\n"
+        if even not in code:
+            continue
+        adaptive = [
+            even.rstrip("\n"),
+            f"    if chunkSize < {_MIN_CHUNK_SIZE} {{ chunkSize = {_MIN_CHUNK_SIZE} }}",
+            f"    {count} = (total + chunkSize - 1) / chunkSize",
+            f"    if {count} < 1 {{ {count} = 1 }}",
+        ]
+        if count == "numChunks":
+            adaptive.append("    if workers > numChunks { workers = numChunks }")
+        return code.replace(even, "\n".join(adaptive) + "\n", 1)
+    raise ValueError("chunking='auto' found no parallel chunks to size")
+
+
+def _chunk_id(style: str) -> str:
+    return "c.id" if style == "pool" else "workerID"
+
+
+def _worker_pool(
+    style: str,
+    setup: list[str],
+    loop: str,
+    body: list[str],
+    finish: list[str],
+    zero: str,
+    cancellable: bool = False,
+) -> list[str]:
+    """
+    One goroutine per chunk [lo, hi) of the range's total values, running
+    setup, loop over body, then finish, and the wait for all of them. With
+    style="errgroup" a panic in a worker becomes its error; the first error
+    is returned next to zero. With style="pool" the chunks are queued on a
+    channel instead, drained by a fixed number of workers. Cancellable
+    workers, and errgroup's, check ctx every few thousand values and stop
+    once it is cancelled, and the function then returns ctx's error.
+    """
+    cancellable = cancellable or style == "errgroup"
+    stop = "return ctx.Err()" if style == "errgroup" else "return"
+    indent = " " * 12
+    if style == "pool":
+        indent = " " * 16
+        lines = ["    type chunk struct{ id, lo, hi int }"]
+        lines.append("    chunks := make(chan chunk, numChunks)")
+        lines.append("    for id := 0; id < numChunks; id++ {")
+        lines.append("        lo := id * chunkSize")
+        lines.append("        hi := lo + chunkSize")
+        lines.append("        if hi > total { hi = total }")
+        lines.append("        if lo > hi { lo = hi }")
+        lines.append("        chunks <- chunk{id, lo, hi}")
+        lines.append("    }")
+        lines.append("    close(chunks)")
+        lines.append("    var wg sync.WaitGroup")
+        lines.append("")
+        lines.append("    for w := 0; w < workers; w++ {")
+        lines.append("        wg.Add(1)")
+        lines.append("        go func() {")
+        lines.append("            defer wg.Done()")
+        lines.append("            for c := range chunks {")
+        if cancellable:
+            lines.append("                if ctx.Err() != nil { return }")
+        lines.append("                lo, hi := c.lo, c.hi")
+    elif style == "errgroup":
+        lines = ["    g, ctx := errgroup.WithContext(ctx)"]
+        lines.append("")
+        lines.append("    for w := 0; w < numWorkers; w++ {")
+        lines.append("        workerID := w")
+        lines.append("        g.Go(func() (err error) {")
+        lines.append("            defer func() {")
+        lines.append("                if r := recover(); r != nil {")
+        lines.append(
+            '                    err = fmt.Errorf("worker %d: panic: %v", workerID, r)'
+        )
+        lines.append("                }")
+        lines.append("            }()")
+    else:
+        lines = ["    var wg sync.WaitGroup"]
+        lines.append("")
+        lines.append("    for w := 0; w < numWorkers; w++ {")
+        lines.append("        wg.Add(1)")
+        lines.append("        go func(workerID int) {")
+        lines.append("            defer wg.Done()")
+    if style != "pool":
+        lines.append("            lo := workerID * chunkSize")
+        lines.append("            hi := lo + chunkSize")
+        lines.append("            if hi > total { hi = total }")
+        lines.append("            if lo > hi { lo = hi }")
+        lines.append("")
+    lines += [indent + line for line in setup]
+    if cancellable:
+        lines.append(indent + "steps := 0")
+    lines.append(f"{indent}{loop} {{")
+    if cancellable:
+        lines.append(
+            f"{indent}    if steps++; steps&4095 == 0 && ctx.Err() != nil "
+            f"{{ {stop} }}"
+        )
+    lines += [f"{indent}    {line}" for line in body]
+    lines.append(indent + "}")
+    lines += [indent + line for line in finish]
+    if style == "errgroup":
+        lines.append(indent + "return nil")
+        lines.append("        })")
+        lines.append("    }")
+        lines.append("    if err := g.Wait(); err != nil {")
+        lines.append(f"        return {zero}, err")
+        lines.append("    }")
+    else:
+        if style == "pool":
+            lines.append("            }")
+            lines.append("        }()")
+        else:
+            lines.append("        }(w)")
+        lines.append("    }")
+        lines.append("    wg.Wait()")
+        if cancellable:
+            lines.append("    if err := ctx.Err(); err != nil {")
+            lines.append(f"        return {zero}, err")
+            lines.append("    }")
+    return lines
+
+
+def _tuple_value(ir: IRComp) -> str | None:
+    """
+    The first tuple ir, or a comprehension within it, holds other than as a
+    dict key or set element of its own (see _tuple_key): a list element, a
+    dict value or a reduced value, for which Go has no type. None if there
+    is none.
+    """
+    values = [ir.val_expr]
+    if ir.kind != "set" or ir.reduce:
+        values.append(ir.element)
+    for expr in [ir.element, ir.key_expr, ir.val_expr]:
+        if not expr:
+            continue
+        for node in ast.walk(ast.parse(expr, mode="eval")):
+            if isinstance(node, (ast.ListComp, ast.GeneratorExp, ast.SetComp)):
+                values.append(ast.unparse(node.elt))
+            elif isinstance(node, ast.DictComp):
+                values += [ast.unparse(node.key), ast.unparse(node.value)]
+    for value in values:
+        if value and isinstance(ast.parse(value, mode="eval").body, ast.Tuple):
+            return value
+    return None
+
+
+def _check_tuple_values(ir: IRComp) -> None:
+    tuple_value = _tuple_value(ir)
+    if tuple_value:
+        raise ValueError(
+            "Go holds tuples only as the keys of a dict comprehension or the "
+            f"elements of a set comprehension: {tuple_value}"
+        )
+
+
+def _tuple_key(key_expr: str | None) -> tuple[str, list[str], str] | None:
+    """
+    A dict key or set element written as a tuple, such as (x, y), as a
+    comparable Go struct: the type's name (keyXY, after the names it holds,
+    or key2 for other elements), its definition and the composite literal
+    building one key. None for any other key.
+    """
+    if not key_expr:
+        return None
+    node = ast.parse(key_expr, mode="eval").body
+    if not isinstance(node, ast.Tuple):
+        return None
+    if not node.elts or any(isinstance(e, ast.Tuple) for e in node.elts):
+        raise ValueError(f"Unsupported tuple key for Go: {key_expr}")
+    names = [e.id for e in node.elts if isinstance(e, ast.Name)]
+    if len(names) == len(node.elts) and len(set(names)) == len(names):
+        type_name = "key" + "".join(n[:1].upper() + n[1:] for n in names)
+        fields = names
+    else:
+        type_name = f"key{len(node.elts)}"
+        fields = [f"f{i}" for i in range(len(node.elts))]
+    definition = [
+        f"// {type_name} holds a {key_expr} tuple of the comprehension.",
+        f"type {type_name} struct {{",
+        f"    {', '.join(fields)} int",
+        "}",
+        "",
+    ]
+    values = ", ".join(ast.unparse(e) for e in node.elts)
+    return type_name, definition, f"{type_name}{{{values}}}"
+
+
+def _render_sharded_dict(
+    ir: IRComp,
+    func_name: str,
+    start: int,
+    stop: int,
+    step: int,
+    hint: int | None,
+    shard_merge: str,
+    parallel_style: str = "waitgroup",
+    cancellable: bool = False,
+    value_type: str = "int",
+    dict_result: str = "map",
+) -> str:
+    """
+    Parallel dict comprehension: each worker fills its own shard map over a
+    contiguous slice of the range, then the shards are merged, and with
+    dict_result="sorted" the merged map's entries sorted by key.
+
+    shard_merge selects the merge strategy:
+      ordered - merge shards in worker order into an un-sized map
+      sized   - merge largest shards first into a map sized for all entries
+      adopt   - reuse the largest shard as the result and merge the rest in
+      wrap    - skip the merge and return a read-only *shardedMap over the
+                shards (Get/Len/Range, safe for concurrent readers)
+    When the key is the loop variable the shards are disjoint and the merge
+    order cannot change the result. Any other key can repeat across shards,
+    where Python keeps the last value: sized and adopt then merge in chunk
+    order like ordered, and wrap, whose Get finds a key's shard from the
+    range, is rejected. Workers run as _worker_pool starts them.
+    """
+    gen = ir.generators[0]
+    var = gen.var
+    key = ir.key_expr or var
+    value = ir.val_expr or var
+    total = _range_len(start, stop, step)
+    tuple_key = _tuple_key(ir.key_expr)
+    key_type = "int"
+    if tuple_key:
+        key_type, definition, key = tuple_key
+    if key != var:
+        if shard_merge == "wrap":
+            raise ValueError("shard_merge='wrap' needs the loop variable as key")
+        shard_merge = "ordered"
+    if shard_merge == "wrap" and value_type != "int":
+        raise ValueError("shard_merge='wrap' needs int values")
+
+    wrap = shard_merge == "wrap"
+    ok = ", nil" if cancellable or parallel_style == "errgroup" else ""
+
+    imports = {"sort"} if shard_merge in ("sized", "adopt") else set()
+    if dict_result == "sorted":
+        imports.add("slices")
+    lines = _parallel_imports(parallel_style, imports, cancellable)
+    if wrap:
+        lines.extend(_sharded_map_type(start, step))
+    if tuple_key:
+        lines.extend(definition)
+    map_type = f"map[{key_type}]{value_type}"
+    return_type = "*shardedMap" if wrap else map_type
+    if dict_result == "sorted":
+        return_type = "[][2]int"
+    lines.append(
+        _parallel_signature(func_name, return_type, parallel_style, cancellable)
+    )
+    chunking, num_chunks = _parallel_chunks(parallel_style, total)
+    lines += chunking
+    lines.append("")
+    lines.append(f"    shards := make([]{map_type}, {num_chunks})")
+    if hint is None:
+        setup = [f"shard := make({map_type})"]
+    else:
+        setup = [f"shard := make({map_type}, {hint}/{num_chunks}+1)"]
+    loop = _chunk_loop(var, start, step)
+    body = [f"if !({f}) {{ continue }}" for f in gen.filters]
+    body += _inner_loops(ir.generators[1:], [f"shard[{key}] = {value}"])
+    finish = [f"shards[{_chunk_id(parallel_style)}] = shard"]
+    lines += _worker_pool(
+        parallel_style, setup, loop, body, finish, "nil", cancellable
+    )
+    lines.append("")
+
+    if wrap:
+        lines.append("    n := 0")
+        lines.append("    for _, shard := range shards { n += len(shard) }")
+        lines.append(
+            "    return &shardedMap{shards: shards, chunkSize: chunkSize, total: total, n: n}"
+            + ok
+        )
+        lines.append("}")
+        return "\n".join(lines) + "\n"
+
+    if shard_merge == "ordered":
+        lines.append(f"    result := make({map_type})")
+        lines.append("    for _, shard := range shards {")
+    elif shard_merge == "sized":
+        lines.append("    // Largest shards first into a destination sized for every entry")
+        lines.append("    size := 0")
+        lines.append("    for _, shard := range shards { size += len(shard) }")
+        lines.append(
+            "    sort.Slice(shards, func(i, j int) bool { return len(shards[i]) > len(shards[j]) })"
+        )
+        lines.append(f"    result := make({map_type}, size)")
+        lines.append("    for _, shard := range shards {")
+    else:
+        lines.append("    // Adopt the largest shard as the result and merge the rest into it")
+        lines.append(
+            "    sort.Slice(shards, func(i, j int) bool { return len(shards[i]) > len(shards[j]) })"
+        )
+        lines.append("    result := shards[0]")
+        lines.append("    for _, shard := range shards[1:] {")
+    lines.append("        for k, v := range shard { result[k] = v }")
+    lines.append("    }")
+    if dict_result == "sorted":
+        lines += _sorted_pairs(ok)
+    else:
+        lines.append(f"    return result{ok}")
+    lines.append("}")
+    return "\n".join(lines) + "\n"
+
+
+def _sharded_map_type(start: int, step: int) -> list[str]:
+    """Read-only view over per-worker shards emitted for shard_merge="wrap"."""
+    if step == 1:
+        bounds = [
+            f"    if k < {start} {{ return 0, false }}",
+            f"    i := k - {start}",
+        ]
+    else:
+        # Keys run down from start on a negative step
+        before = "<" if step > 0 else ">"
+        bounds = [
+            f"    if k {before} {start} || (k-{start})%{step} != 0 "
+            "{ return 0, false }",
+            f"    i := (k - {start}) / {step}",
+        ]
+    return [
+        "// shardedMap is a read-only view over per-worker shard maps. Shard i",
+        "// holds the keys of the i-th contiguous chunk of the range, so Get goes",
+        "// straight to one shard. It is safe for concurrent readers.",
+        "type shardedMap struct {",
+        "    shards    []map[int]int",
+        "    chunkSize int",
+        "    total     int",
+        "    n         int",
+        "}",
+        "",
+        "func (m *shardedMap) Get(k int) (int, bool) {",
+        *bounds,
+        "    if i >= m.total || m.chunkSize == 0 { return 0, false }",
+        "    v, ok := m.shards[i/m.chunkSize][k]",
+        "    return v, ok",
+        "}",
+        "",
+        "func (m *shardedMap) Len() int { return m.n }",
+        "",
+        "// Range calls f for every entry until f returns false, shard by shard.",
+        "func (m *shardedMap) Range(f func(k, v int) bool) {",
+        "    for _, shard := range m.shards {",
+        "        for k, v := range shard {",
+        "            if !f(k, v) { return }",
+        "        }",
+        "    }",
+        "}",
+        "",
+    ]
+
+
+def _render_sync_map(
+    ir: IRComp,
+    func_name: str,
+    start: int,
+    stop: int,
+    step: int,
+    parallel: bool,
+    parallel_style: str = "waitgroup",
+    cancellable: bool = False,
+) -> str:
+    """
+    Dict comprehension built into a *sync.Map (map_impl="sync"). Parallel
+    workers Store straight into it, with no shards to merge, which only
+    keeps Python's last-value-wins when every key is stored once: the key
+    must then be the loop variable.
+    """
+    gen = ir.generators[0]
+    var = gen.var
+    key = ir.key_expr or var
+    value = ir.val_expr or var
+    comment = [
+        "// The result is a sync.Map, safe for concurrent Load and Store by its",
+        "// consumers. Every entry is boxed in an interface and each access",
+        "// goes through atomics, so building and reading it costs several",
+        "// times a built-in map[int]int; use it only when the map is shared.",
+    ]
+    tuple_key = _tuple_key(ir.key_expr)
+    definition = []
+    if tuple_key:
+        _, definition, key = tuple_key
+    body = [f"if !({f}) {{ continue }}" for f in gen.filters]
+    body += _inner_loops(ir.generators[1:], [f"result.Store({key}, {value})"])
+    if not parallel:
+        params = _signature_params(_input_params(ir))
+        lines = ["import (", '    "sync"', ")", "", *definition, *comment]
+        lines.append(f"func {func_name}({params}) *sync.Map {{")
+        lines.append("    result := new(sync.Map)")
+        lines.append(f"    {_loop_clause(gen, body)} {{")
+        lines += [f"        {line}" for line in body]
+        lines.append("    }")
+        lines.append("    return result")
+        lines.append("}")
+        return "\n".join(lines) + "\n"
+
+    if key != var:
+        raise ValueError("map_impl='sync' in parallel needs the loop variable as key")
+    ok = ", nil" if cancellable or parallel_style == "errgroup" else ""
+    lines = _parallel_imports(parallel_style, {"sync"}, cancellable) + comment
+    lines.append(
+        _parallel_signature(func_name, "*sync.Map", parallel_style, cancellable)
+    )
+    chunking, _ = _parallel_chunks(parallel_style, _range_len(start, stop, step))
+    lines += chunking
+    lines.append("")
+    lines.append("    result := new(sync.Map)")
+    loop = _chunk_loop(var, start, step)
+    lines += _worker_pool(parallel_style, [], loop, body, [], "nil", cancellable)
+    lines.append(f"    return result{ok}")
+    lines.append("}")
+    return "\n".join(lines) + "\n"
+
+
+def _sorted_set(ok: str = "", element_type: str = "int") -> list[str]:
+    """Lines returning the set built in result as an ascending slice."""
+    return [
+        f"    values := make([]{element_type}, 0, len(result))",
+        "    for v := range result { values = append(values, v) }",
+        "    slices.Sort(values)",
+        f"    return values{ok}",
+    ]
+
+
+def _typed(value: str, go_type: str) -> str:
+    """The constant value converted to go_type, as is for int and bool."""
+    return value if go_type in ("int", "bool") else f"{go_type}({value})"
+
+
+def _reduce_initial(reduce: IRReduce, go_type: str = "int") -> str:
+    """
+    The Go value the accumulator of reduce starts from:
+    sum()'s or math.prod()'s start, or max()'s or min()'s default=, which
+    must be int literals, converted to go_type; else 0, 1, false or true.
+    A max or min only keeps its start while it has seen no value.
+    """
+    if reduce.initial is None:
+        initial = {"prod": "1", "any": "false", "all": "true"}.get(reduce.kind, "0")
+    else:
+        value = const_int(ast.parse(reduce.initial, mode="eval").body)
+        if value is None:
+            raise ValueError(
+                f"Go needs an int literal to start {reduce.kind}() from: {reduce.initial}"
+            )
+        initial = str(value)
+    return _typed(initial, go_type) if reduce.kind not in ("any", "all") else initial
+
+
+def _empty_check(
+    reduce: IRReduce, empty: str, seen: str = "seen", indent: str = "    "
+) -> list[str]:
+    """
+    With empty="panic", the lines a max or min without a default= runs
+    after its loops, to panic as Python raises when it has seen no value.
+    """
+    if empty != "panic" or reduce.kind not in ("max", "min") or reduce.initial is not None:
+        return []
+    return [f'{indent}if !{seen} {{ panic("{reduce.kind}() iterable argument is empty") }}']
+
+
+def _is_sorted(ir: IRComp) -> bool:
+    """Whether ir is of sorted(); the IRs of pcs_step3_ts have no sort field."""
+    return getattr(ir, "sort", False)
+
+
+def _sorted_pairs(ok: str = "") -> list[str]:
+    """Lines returning the dict built in result as pairs sorted by key."""
+    return [
+        "    keys := make([]int, 0, len(result))",
+        "    for k := range result { keys = append(keys, k) }",
+        "    slices.Sort(keys)",
+        "    pairs := make([][2]int, len(keys))",
+        "    for i, k := range keys { pairs[i] = [2]int{k, result[k]} }",
+        f"    return pairs{ok}",
+    ]
+
+
+def _render_parallel(
+    ir: IRComp,
+    func_name: str,
+    start: int,
+    stop: int,
+    step: int,
+    return_type: str,
+    result_type: str,
+    parallel_style: str = "waitgroup",
+    cancellable: bool = False,
+    set_result: str = "map",
+    element_type: str = "int",
+    overflow: str = "wrap",
+    lets: dict[str, list[str]] | None = None,
+    empty: str = "zero",
+) -> str:
+    """
+    Parallel list, set or reduction: the range is split into one contiguous
+    chunk per GOMAXPROCS, each reduced by a goroutine into a local partial
+    (a slice or set for collections), and once every worker is done the
+    partials are combined in chunk order, so a list keeps the range's order.
+    any/all stop a worker at the first value that decides its chunk. Workers
+    run as _worker_pool starts them; the range split is the first
+    for-clause's, and any further ones loop in full inside each worker.
+    With overflow checks (see _checked_stmt) a sum or prod and its partials
+    are int64, checked on every step in the workers and in the merge.
+    Each loop runs the hoisted statements lets has for its variable (see
+    _hoist_invariants).
+    """
+    sort_set = ir.kind == "set" and set_result == "sorted"
+    gen = ir.generators[0]
+    var = gen.var
+    element = ir.element or var
+    tuple_key = _tuple_key(ir.element) if ir.kind == "set" else None
+    if tuple_key:
+        element_type, definition, element = tuple_key
+    total = _range_len(start, stop, step)
+    k = ir.reduce.kind if ir.reduce else None
+
+    if k in ("any", "all"):
+        partial_type = "bool"
+    elif k and overflow != "wrap":
+        partial_type = "int64"
+    elif k:
+        partial_type = element_type
+    elif ir.kind == "set":
+        partial_type = f"map[{element_type}]struct{{}}"
+    else:
+        partial_type = f"[]{element_type}"
+
+    ok = ", nil" if cancellable or parallel_style == "errgroup" else ""
+
+    imports = {"slices"} if sort_set or _is_sorted(ir) else set()
+    if overflow != "wrap":
+        imports.add("math")
+    lines = _parallel_imports(parallel_style, imports, cancellable)
+    if tuple_key:
+        lines += definition
+    lines.append(
+        _parallel_signature(func_name, return_type, parallel_style, cancellable)
+    )
+    chunking, num_chunks = _parallel_chunks(parallel_style, total)
+    lines += chunking
+    lines.append("")
+    lines.append(f"    partials := make([]{partial_type}, {num_chunks})")
+    if k in ("max", "min"):
+        lines.append(f"    seen := make([]bool, {num_chunks})")
+    chunk = _chunk_id(parallel_style)
+    # any/all break out of every loop of a nest at once
+    label = "values" if k in ("any", "all") and len(ir.generators) > 1 else ""
+    if k:
+        initial = {"prod": "1", "any": "false", "all": "true"}.get(k, "0")
+        setup = [f"acc := {_typed(initial, partial_type)}"]
+        if k in ("max", "min"):
+            setup.append("found := false")
+        if overflow != "wrap":
+            body, checked_ops = _checked_value(overflow, k, func_name, element)
+            body += _checked_stmt(overflow, k, func_name, "v")
+        else:
+            body = _reduce_stmt(k, "acc", "found", element, True, label)
+        finish = [f"partials[{chunk}] = acc"]
+        if k in ("max", "min"):
+            finish.append(f"seen[{chunk}] = found")
+    else:
+        if ir.kind == "set":
+            setup = [f"part := make({partial_type})"]
+            body = [f"part[{element}] = struct{{}}{{}}"]
+        else:
+            capacity = "" if gen.filters or len(ir.generators) > 1 else ", hi-lo"
+            setup = [f"part := make([]{element_type}, 0{capacity})"]
+            body = [f"part = append(part, {element})"]
+        finish = [f"partials[{chunk}] = part"]
+    body = (
+        [f"if !({f}) {{ continue }}" for f in gen.filters]
+        + (lets or {}).get(var, [])
+        + _inner_loops(ir.generators[1:], body, lets)
+    )
+    loop = _chunk_loop(var, start, step)
+    if label:
+        loop = f"{label}: {loop}"
+    zero = "false" if k in ("any", "all") else "0" if k else "nil"
+    lines += _worker_pool(
+        parallel_style, setup, loop, body, finish, zero, cancellable
+    )
+    lines.append("")
+
+    if k in ("any", "all"):
+        decided = "p" if k == "any" else "!p"
+        lines.append("    for _, p := range partials {")
+        lines.append(f"        if {decided} {{ return {str(k == 'any').lower()}{ok} }}")
+        lines.append("    }")
+        lines.append(f"    return {str(k == 'all').lower()}{ok}")
+    elif k:
+        result = "acc"
+        if result_type not in ("int", partial_type):
+            result = f"{result_type}(acc)"
+        # The workers start from the identity, the partials from the start
+        initial = _reduce_initial(ir.reduce, partial_type)
+        if k in ("max", "min"):
+            lines.append(f"    acc, found := {initial}, false")
+            lines.append("    for w, p := range partials {")
+            lines.append("        if !seen[w] { continue }")
+            for stmt in _reduce_stmt(k, "acc", "found", "p", early_exit=False):
+                lines.append(f"        {stmt}")
+        else:
+            op = "+=" if k == "sum" else "*="
+            lines.append(f"    acc := {initial}")
+            lines.append("    for _, p := range partials {")
+            if overflow != "wrap":
+                for stmt in _checked_stmt(overflow, k, func_name, "p"):
+                    lines.append(f"        {stmt}")
+            else:
+                lines.append(f"        acc {op} p")
+        lines.append("    }")
+        lines += _empty_check(ir.reduce, empty, "found")
+        lines.append(f"    return {result}{ok}")
+    elif ir.kind == "set":
+        lines.append("    result := partials[0]")
+        lines.append("    for _, part := range partials[1:] {")
+        lines.append("        for v := range part { result[v] = struct{}{} }")
+        lines.append("    }")
+        if sort_set:
+            lines += _sorted_set(ok, element_type)
+        else:
+            lines.append(f"    return result{ok}")
+    else:
+        lines.append("    n := 0")
+        lines.append("    for _, part := range partials { n += len(part) }")
+        lines.append(f"    result := make([]{element_type}, 0, n)")
+        lines.append("    for _, part := range partials {")
+        lines.append("        result = append(result, part...)")
+        lines.append("    }")
+        if _is_sorted(ir):
+            lines.append("    slices.Sort(result)")
+        lines.append(f"    return result{ok}")
+    lines.append("}")
+    if k and overflow != "wrap":
+        checked_ops.add("Add" if k == "sum" else "Mul")
+        lines += ["", _checked_helpers(checked_ops, func_name).rstrip("\n")]
+    return "\n".join(lines) + "\n"
+
+
+_NESTED_REDUCTIONS = ("sum", "prod", "max", "min", "any", "all")
+_COMPREHENSIONS = (ast.GeneratorExp, ast.ListComp, ast.SetComp, ast.DictComp)
+
+
+def _reduction_name(func: ast.expr) -> str | None:
+    """The function a call names, "prod" for math.prod; None for others."""
+    if isinstance(func, ast.Name):
+        return func.id
+    return "prod" if ast.unparse(func) == "math.prod" else None
+
+
+def _lower_nested(
+    expr: str | None, prefix: str, helpers: dict[str, str]
+) -> str | None:
+    """
+    Replace each reduction over an inner comprehension in expr, such as the
+    `sum(x * y for y in range(1, 100))` of a nested comprehension or a
+    `len([...])` count, with a call to a helper function that computes it in
+    a loop of its own. Helpers take the outer variables they read as int
+    parameters and are added to helpers (name -> source), named prefix +
+    "Inner" + index. A list, set or dict comprehension used as a value, such
+    as the rows of a list of lists, becomes a helper building that
+    collection (see _render_collection_helper) when it is the whole of expr.
+    Other comprehensions, such as a generator expression that is no
+    reduction's argument, have no Go form and are rejected. Go has no
+    conditional operator either: each `a if cond else b` becomes a helper
+    named prefix + "Cond" + index (see _render_cond_helper).
+    """
+    if not expr:
+        return expr
+    tree = ast.parse(expr, mode="eval")
+    if not any(isinstance(n, (*_COMPREHENSIONS, ast.IfExp)) for n in ast.walk(tree)):
+        return expr
+
+    class Lower(ast.NodeTransformer):
+        def visit_Call(self, node: ast.Call) -> ast.AST:
+            kind = _reduction_name(node.func)
+            if not (
+                len(node.args) == 1
+                and not node.keywords
+                and (
+                    kind in _NESTED_REDUCTIONS
+                    and isinstance(node.args[0], (ast.GeneratorExp, ast.ListComp))
+                    or kind == "len"
+                    and isinstance(node.args[0], ast.ListComp)
+                )
+            ):
+                return self.generic_visit(node)
+            comp = node.args[0]
+            if kind == "len":
+                kind, comp.elt = "sum", ast.Constant(1)
+            name = self.helper_name()
+            params = _render_nested_helper(name, kind, comp, helpers)
+            return self.call(name, params)
+
+        def visit_collection(self, node: ast.AST) -> ast.AST:
+            # Go has no operators or builtins over the helper's result
+            if node is not tree.body:
+                return self.reject(node)
+            name = self.helper_name()
+            return self.call(name, _render_collection_helper(name, node, helpers))
+
+        def reject(self, node: ast.AST) -> ast.AST:
+            raise ValueError(
+                f"Go backend cannot lower nested comprehension: {ast.unparse(node)}"
+            )
+
+        def visit_IfExp(self, node: ast.IfExp) -> ast.AST:
+            # Comprehensions in the branches become helpers of their own first
+            self.generic_visit(node)
+            name = self.helper_name("Cond")
+            return self.call(name, _render_cond_helper(name, node, helpers))
+
+        def helper_name(self, kind: str = "Inner") -> str:
+            index = sum(n.rpartition(kind)[0] == prefix for n in helpers)
+            return f"{prefix}{kind}{index}"
+
+        def call(self, name: str, params: list[str]) -> ast.Call:
+            return ast.Call(
+                func=ast.Name(id=name, ctx=ast.Load()),
+                args=[ast.Name(id=p, ctx=ast.Load()) for p in params],
+                keywords=[],
+            )
+
+        visit_GeneratorExp = reject
+        visit_ListComp = visit_SetComp = visit_DictComp = visit_collection
+
+    return ast.unparse(Lower().visit(tree))
+
+
+def _render_nested_helper(
+    name: str,
+    kind: str,
+    node: ast.GeneratorExp | ast.ListComp,
+    helpers: dict[str, str],
+) -> list[str]:
+    """
+    Add the helper computing `kind(node)` to helpers and return its
+    parameters: the names node reads without binding, in order of use.
+    Only a single generator over a range with a constant step is supported.
+    """
+    loop, params = _nested_loop(node)
+
+    # Comprehensions nested deeper become helpers of this one
+    comp = node.generators[0]
+    element = _lower_nested(ast.unparse(node.elt), name, helpers)
+    filters = [
+        _go_cond(_lower_nested(ast.unparse(f), name, helpers), helpers)
+        for f in comp.ifs
+    ]
+
+    go_type = "bool" if kind in ("any", "all") else "int"
+    initial = {"prod": "1", "any": "false", "all": "true"}.get(kind, "0")
+    signature = f"{', '.join(params)} int" if params else ""
+    lines = [f"func {name}({signature}) {go_type} {{", f"    acc := {initial}"]
+    if kind in ("max", "min"):
+        lines.append("    seen := false")
+    lines.append(f"    {loop} {{")
+    for f in filters:
+        lines.append(f"        if !({f}) {{ continue }}")
+    for stmt in _reduce_stmt(kind, "acc", "seen", element, early_exit=True):
+        lines.append(f"        {stmt}")
+    lines.append("    }")
+    lines.append("    return acc")
+    lines.append("}")
+    helpers[name] = "\n".join(lines) + "\n"
+    return params
+
+
+def _render_collection_helper(
+    name: str, node: ast.ListComp | ast.SetComp | ast.DictComp, helpers: dict[str, str]
+) -> list[str]:
+    """
+    Add the helper building the list, set or dict of node, an inner
+    comprehension used as a value, to helpers and return its parameters as
+    _render_nested_helper does. The helper's result type nests the types of
+    collections nested deeper, e.g. [][]int for a list of lists.
+    """
+    loop, params = _nested_loop(node)
+    comp = node.generators[0]
+    filters = [
+        _go_cond(_lower_nested(ast.unparse(f), name, helpers), helpers)
+        for f in comp.ifs
+    ]
+    if isinstance(node, ast.DictComp):
+        key = _lower_nested(ast.unparse(node.key), name, helpers)
+        value = _lower_nested(ast.unparse(node.value), name, helpers)
+        if _expr_type(key, helpers) != "int":
+            raise ValueError(f"Go map keys cannot be collections: {ast.unparse(node)}")
+        go_type = f"map[int]{_expr_type(value, helpers)}"
+        add = f"result[{key}] = {value}"
+    else:
+        element = _lower_nested(ast.unparse(node.elt), name, helpers)
+        elem_type = _expr_type(element, helpers)
+        if isinstance(node, ast.SetComp):
+            if elem_type != "int":
+                raise ValueError(
+                    f"Go set elements cannot be collections: {ast.unparse(node)}"
+                )
+            go_type = "map[int]struct{}"
+            add = f"result[{element}] = struct{{}}{{}}"
+        else:
+            go_type = f"[]{elem_type}"
+            add = f"result = append(result, {element})"
+    init = f"make({go_type}, 0)" if go_type[0] == "[" else f"make({go_type})"
+    signature = f"{', '.join(params)} int" if params else ""
+    lines = [f"func {name}({signature}) {go_type} {{", f"    result := {init}"]
+    lines.append(f"    {loop} {{")
+    for f in filters:
+        lines.append(f"        if !({f}) {{ continue }}")
+    lines.append(f"        {add}")
+    lines.append("    }")
+    lines.append("    return result")
+    lines.append("}")
+    helpers[name] = "\n".join(lines) + "\n"
+    return params
+
+
+def _render_cond_helper(
+    name: str, node: ast.IfExp, helpers: dict[str, str]
+) -> list[str]:
+    """
+    Add the helper returning one branch of node, a conditional expression
+    whose inner comprehensions are lowered already, to helpers and return
+    its parameters: the names node reads, in order of use. The helper
+    returns a bool when both branches are conditions, an int otherwise.
+    """
+    branches = [node.body, node.orelse]
+    conditions = [_is_condition(b, helpers) for b in branches]
+    if conditions[0] != conditions[1]:
+        raise ValueError(
+            f"Go conditional branches must both be conditions: {ast.unparse(node)}"
+        )
+    if any(_expr_type(ast.unparse(b), helpers) != "int" for b in branches):
+        raise ValueError(
+            f"Go conditional branches cannot be collections: {ast.unparse(node)}"
+        )
+    if conditions[0]:
+        go_type = "bool"
+        body, orelse = (_go_cond(ast.unparse(b), helpers) for b in branches)
+    else:
+        go_type = "int"
+        body, orelse = (ast.unparse(b) for b in branches)
+    # Parse the source again: helper calls made in place have no positions
+    params = _free_names(ast.parse(ast.unparse(node), mode="eval"))
+    signature = f"{', '.join(params)} int" if params else ""
+    lines = [
+        f"func {name}({signature}) {go_type} {{",
+        f"    if {_go_cond(ast.unparse(node.test), helpers)} {{ return {body} }}",
+        f"    return {orelse}",
+        "}",
+    ]
+    helpers[name] = "\n".join(lines) + "\n"
+    return params
+
+
+def _expr_type(expr: str | None, helpers: dict[str, str]) -> str:
+    """
+    Go type of a value expression lowered by _lower_nested: the collection a
+    collection helper called on its own returns, int otherwise.
+    """
+    if not expr:
+        return "int"
+    node = ast.parse(expr, mode="eval").body
+    if not (
+        isinstance(node, ast.Call)
+        and isinstance(node.func, ast.Name)
+        and node.func.id in helpers
+    ):
+        return "int"
+    m = re.match(r"func \w+\([^)]*\) (\S+) \{", helpers[node.func.id])
+    go_type = m.group(1) if m else "int"
+    return go_type if go_type.startswith(("[]", "map[")) else "int"
+
+
+def _nested_loop(
+    node: ast.GeneratorExp | ast.ListComp | ast.SetComp | ast.DictComp,
+) -> tuple[str, list[str]]:
+    """
+    The Go for-clause of an inner comprehension's single range generator and
+    the helper parameters it needs: the names node reads without binding, in
+    order of use.
+    """
+    comp = node.generators[0]
+    bounds = _range_args(comp.iter)
+    if not (
+        len(node.generators) == 1
+        and isinstance(comp.target, ast.Name)
+        and bounds is not None
+    ):
+        raise ValueError(
+            "Go backend can only lower nested comprehensions with one generator "
+            f"over a range: {ast.unparse(node)}"
+        )
+    start, stop, step = bounds
+    step = _range_step(step, ast.unparse(comp.iter))
+    loop = _for_clause(comp.target.id, start, stop, step)
+    return loop, _free_names(node)
+
+
+def _free_names(node: ast.AST) -> list[str]:
+    """
+    The variables node reads without binding them in a comprehension of its
+    own, in order of use; names called as functions are left out.
+    """
+    called = {
+        n.func.id
+        for n in ast.walk(node)
+        if isinstance(n, ast.Call) and isinstance(n.func, ast.Name)
+    }
+    bound = {
+        t.id
+        for n in ast.walk(node)
+        if isinstance(n, ast.comprehension)
+        for t in ast.walk(n.target)
+        if isinstance(t, ast.Name)
+    }
+    params: list[str] = []
+    for n in sorted(
+        (n for n in ast.walk(node) if isinstance(n, ast.Name)),
+        key=lambda n: (n.lineno, n.col_offset),
+    ):
+        if n.id not in bound and n.id not in called and n.id not in params:
+            params.append(n.id)
+    return params
+
+
+def _grouped_aggregate(
+    ir: IRComp,
+) -> tuple[str, ast.GeneratorExp | ast.ListComp, ast.expr] | None:
+    """
+    Recognise a dict comprehension aggregating values by group, as in
+    `{k: sum(x for x in data if x % 10 == k) for k in range(10)}`: one key
+    per value of a single generator, each the reduction of the inner values
+    whose group expression (x % 10) equals it, which is what
+    itertools.groupby() over sorted values is used for. Return the reduction
+    kind, the inner comprehension with the group filter removed and the
+    group expression; None for any other comprehension.
+    """
+    if ir.kind != "dict" or ir.reduce or len(ir.generators) != 1:
+        return None
+    key = ir.generators[0].var
+    if ir.key_expr != key or not key.isidentifier() or not ir.val_expr:
+        return None
+    call = ast.parse(ir.val_expr, mode="eval").body
+    if not (isinstance(call, ast.Call) and len(call.args) == 1 and not call.keywords):
+        return None
+    kind, comp = _reduction_name(call.func), call.args[0]
+    if kind == "len" and isinstance(comp, ast.ListComp):
+        kind, comp.elt = "sum", ast.Constant(1)
+    elif kind not in _NESTED_REDUCTIONS or not isinstance(
+        comp, (ast.GeneratorExp, ast.ListComp)
+    ):
+        return None
+    inner = comp.generators[0]
+    if not (
+        len(comp.generators) == 1
+        and isinstance(inner.target, ast.Name)
+        and inner.target.id != key
+        and (_range_args(inner.iter) or isinstance(inner.iter, ast.Name))
+    ):
+        return None
+
+    # The group filter compares the key with an expression of the inner
+    # values; nothing else may read the key or need lowering
+    group = None
+    for f in inner.ifs:
+        if (
+            group is None
+            and isinstance(f, ast.Compare)
+            and len(f.ops) == 1
+            and isinstance(f.ops[0], ast.Eq)
+        ):
+            for this, other in ((f.left, f.comparators[0]), (f.comparators[0], f.left)):
+                if isinstance(this, ast.Name) and this.id == key:
+                    group = other
+                    inner.ifs.remove(f)
+                    break
+    rest = [comp.elt, inner.iter, *inner.ifs]
+    if group is not None:
+        rest.append(group)
+    if group is None or _uses(key, [ast.unparse(n) for n in rest]):
+        return None
+    if any(
+        isinstance(n, (*_COMPREHENSIONS, ast.IfExp)) for e in rest for n in ast.walk(e)
+    ):
+        return None
+    return kind, comp, group
+
+
+def _render_grouped(
+    ir: IRComp,
+    func_name: str,
+    kind: str,
+    comp: ast.GeneratorExp | ast.ListComp,
+    group: ast.expr,
+    presize: bool,
+    number_type: str = "int",
+) -> str:
+    """
+    The dict of _grouped_aggregate in one pass over the inner values instead
+    of one per key: every key starts from the reduction's initial value,
+    then each value that passes the inner filters is reduced into the entry
+    of its group, unless no key has that group. A max or min of a group
+    with no values is 0, as elsewhere. Entries of sum/prod/max/min are of
+    number_type.
+    """
+    gen = ir.generators[0]
+    gen = replace(gen, filters=[_go_cond(f) for f in gen.filters])
+    inner = comp.generators[0]
+    values = IRGenerator(
+        var=inner.target.id,
+        source=ast.unparse(inner.iter),
+        filters=[_go_cond(ast.unparse(f)) for f in inner.ifs],
+    )
+    key = gen.var
+    value_type = "bool" if kind in ("any", "all") else number_type
+    initial = {"prod": "1", "any": "false", "all": "true"}.get(kind, "0")
+    element = ast.unparse(comp.elt)
+    if value_type != "bool":
+        element = _number_expr(element, number_type)
+
+    bounds = _loop_bounds(gen)
+    hint = None
+    if presize and bounds and all(type(b) is int for b in bounds):
+        hint = _size_hint(gen, *bounds)
+    elif presize and _input_slice(gen) and not gen.filters:
+        hint = f"len({_input_slice(gen)})"
+
+    params = _signature_params(_input_params(replace(ir, generators=[gen, values])))
+    lines = [
+        f"func {func_name}({params}) map[int]{value_type} {{",
+        f"    result := {_make_map(f'map[int]{value_type}', hint)}",
+    ]
+    init = [f"result[{key}] = {initial}"]
+    lines.append(f"    {_loop_clause(gen, init)} {{")
+    lines += [f"        if !({f}) {{ continue }}" for f in gen.filters]
+    lines += [f"        {s}" for s in init]
+    lines.append("    }")
+    if kind in ("max", "min"):
+        lines.append("    seen := make(map[int]bool, len(result))")
+    body = [
+        f"{key} := {ast.unparse(group)}",
+        f"if _, ok := result[{key}]; !ok {{ continue }}",
+    ]
+    body += _reduce_stmt(kind, f"result[{key}]", f"seen[{key}]", element, False)
+    lines.append(f"    {_loop_clause(values, body)} {{")
+    lines += [f"        if !({f}) {{ continue }}" for f in values.filters]
+    lines += [f"        {s}" for s in body]
+    lines.append("    }")
+    lines.append("    return result")
+    lines.append("}")
+    return "\n".join(lines) + "\n"
+
+
+def _go_cond(
+    expr: str, helpers: dict[str, str] | None = None, contains: bool = False
+) -> str:
+    """
+    A Python filter as a Go condition: and, or and not become the
+    short-circuiting &&, || and !, a chained comparison such as 0 < x < 9
+    one comparison per pair joined by &&, and an int tests its Python truth
+    (x != 0, or x == 0 under not). Calls of the helpers that return a bool,
+    such as an inner any(), are conditions already. With contains, a test
+    of membership in a literal tuple, list or set, as in x in (1, 2, 3), is
+    a call of slices.Contains (Go 1.21).
+    """
+
+    # Go precedences: || 1, && 2, comparisons 3, operands of ! 6
+    def cond(node: ast.expr) -> tuple[str, int]:
+        if isinstance(node, ast.BoolOp):
+            op, prec = ("&&", 2) if isinstance(node.op, ast.And) else ("||", 1)
+            return f" {op} ".join(wrap(v, prec) for v in node.values), prec
+        if isinstance(node, ast.UnaryOp) and isinstance(node.op, ast.Not):
+            if not _is_condition(node.operand, helpers):
+                return f"{ast.unparse(node.operand)} == 0", 3
+            return "!" + wrap(node.operand, 6), 6
+        if isinstance(node, ast.Compare) and len(node.ops) > 1:
+            operands = [node.left, *node.comparators]
+            pairs = [
+                ast.unparse(ast.Compare(a, [op], [b]))
+                for a, op, b in zip(operands, node.ops, operands[1:])
+            ]
+            return " && ".join(pairs), 2
+        if isinstance(node, ast.Constant) and isinstance(node.value, bool):
+            return str(node.value).lower(), 6
+        if (
+            contains
+            and isinstance(node, ast.Compare)
+            and isinstance(node.ops[0], (ast.In, ast.NotIn))
+            and isinstance(node.comparators[0], (ast.Tuple, ast.List, ast.Set))
+        ):
+            values = ", ".join(ast.unparse(e) for e in node.comparators[0].elts)
+            test = f"slices.Contains([]int{{{values}}}, {ast.unparse(node.left)})"
+            return ("!" if isinstance(node.ops[0], ast.NotIn) else "") + test, 6
+        if isinstance(node, ast.Compare):
+            return ast.unparse(node), 3
+        if _is_condition(node, helpers):
+            return ast.unparse(node), 6
+        return f"{ast.unparse(node)} != 0", 3
+
+    def wrap(node: ast.expr, prec: int) -> str:
+        text, own = cond(node)
+        return f"({text})" if own < prec else text
+
+    return cond(ast.parse(expr, mode="eval").body)[0]
+
+
+def _is_condition(node: ast.expr, helpers: dict[str, str] | None) -> bool:
+    """
+    Whether node is a Go bool: a comparison, and, or, not, True or False, a
+    unicode test of _RUNE_TESTS such as unicode.IsDigit(c), the validity
+    test col.IsValid(i) of an Arrow column, or a call of one of the helpers
+    that returns a bool.
+    """
+    if isinstance(node, ast.Call) and isinstance(node.func, ast.Attribute):
+        tests = {t for names in _RUNE_TESTS.values() for t in names}
+        receiver = node.func.value
+        if isinstance(receiver, ast.Name) and receiver.id == "unicode":
+            return node.func.attr in tests
+        return node.func.attr == "IsValid" and isinstance(receiver, ast.Name)
+    if isinstance(node, ast.Call) and isinstance(node.func, ast.Name):
+        source = (helpers or {}).get(node.func.id, "")
+        return re.match(r"func \w+\([^)]*\) bool \{", source) is not None
+    return (
+        isinstance(node, (ast.Compare, ast.BoolOp))
+        or isinstance(node, ast.UnaryOp)
+        and isinstance(node.op, ast.Not)
+        or isinstance(node, ast.Constant)
+        and isinstance(node.value, bool)
+    )
+
+
+def _makes_floats(ir: IRComp) -> bool:
+    """
+    Whether ir's values, which number_type builds, use true division or a
+    float literal: Python makes them floats, where a Go integer type would
+    divide toward zero or not compile.
+    """
+    if ir.reduce and ir.reduce.kind in ("any", "all", "join"):
+        return False
+    for expr in (ir.element, ir.val_expr):
+        if not expr:
+            continue
+        for node in ast.walk(ast.parse(expr, mode="eval")):
+            if isinstance(node, ast.BinOp) and isinstance(node.op, ast.Div):
+                return True
+            if isinstance(node, ast.Constant) and type(node.value) is float:
+                return True
+    return False
+
+
+def _non_negative_vars(ir: IRComp) -> set[str]:
+    """
+    The loop variables of ir, and of the comprehensions within its
+    expressions, that every loop binding them runs over a range of constant
+    non-negative values.
+    """
+    bindings: list[tuple[str, tuple[int | str, int | str, int | str] | None]] = []
+    exprs = [ir.element, ir.key_expr, ir.val_expr]
+    for gen in ir.generators:
+        exprs += [*gen.filters, *gen.take_while]
+        bounds = _loop_bounds(gen)
+        for n in ast.walk(ast.parse(gen.var, mode="eval")):
+            if isinstance(n, ast.Name):
+                bindings.append((n.id, bounds if gen.var.isidentifier() else None))
+    for expr in exprs:
+        if not expr:
+            continue
+        for node in ast.walk(ast.parse(expr, mode="eval")):
+            if isinstance(node, ast.comprehension):
+                args = _range_args(node.iter)
+                for n in ast.walk(node.target):
+                    if isinstance(n, ast.Name):
+                        simple = isinstance(node.target, ast.Name)
+                        bindings.append((n.id, args if simple else None))
+            elif isinstance(node, ast.NamedExpr):
+                bindings.append((node.target.id, None))
+
+    def non_negative(bounds) -> bool:
+        if bounds is None:
+            return False
+        start, stop, step = (
+            b if isinstance(b, int) else const_int(ast.parse(b, mode="eval").body)
+            for b in bounds
+        )
+        if start is None or stop is None or not step:
+            return False
+        # A range counting down stays above its stop
+        return start >= 0 if step > 0 else stop >= -1
+
+    names = {name for name, _ in bindings}
+    return {
+        name
+        for name in names
+        if all(non_negative(b) for n, b in bindings if n == name)
+    }
+
+
+def _int_division(ir: IRComp, func_name: str) -> IRComp:
+    """
+    ir with Python's // and % of ints written for Go, whose / and % truncate
+    toward zero where Python's floor: // as a call of the FloorDiv helper of
+    _division_helpers, % as one of its Mod helper unless both operands are
+    non-negative, as the loop variables of stock ranges are, or the
+    remainder is only tested for zero: there the two agree. A // of int
+    constants is computed here, and an operation on a float is left for
+    _number_expr to refuse.
+    """
+    non_negative_vars = _non_negative_vars(ir)
+
+    def non_negative(node: ast.expr) -> bool:
+        if isinstance(node, ast.Constant):
+            return type(node.value) is int and node.value >= 0
+        if isinstance(node, ast.Name):
+            return node.id in non_negative_vars
+        if isinstance(node, ast.Call) and isinstance(node.func, ast.Name):
+            return node.func.id in ("abs", "len")
+        if isinstance(node, ast.BinOp) and isinstance(node.op, ast.Mod):
+            # A Python remainder takes the sign of the divisor
+            return non_negative(node.right)
+        if isinstance(node, ast.BinOp) and isinstance(node.op, (ast.Add, ast.Mult)):
+            return non_negative(node.left) and non_negative(node.right)
+        return False
+
+    def is_float(node: ast.expr) -> bool:
+        return any(
+            isinstance(n, ast.Constant) and type(n.value) is float
+            or isinstance(n, ast.BinOp) and isinstance(n.op, ast.Div)
+            for n in ast.walk(node)
+        )
+
+    def zero_tests(tree: ast.expr, condition: bool) -> set[int]:
+        """
+        The remainders of tree only tested for zero, as conditions or in
+        comparisons with 0, whose sign does not matter.
+        """
+        tests = [tree] if condition else []
+        found: set[int] = set()
+        for node in ast.walk(tree):
+            if isinstance(node, ast.comprehension):
+                tests += node.ifs
+            elif isinstance(node, ast.IfExp):
+                tests.append(node.test)
+            elif (
+                isinstance(node, ast.Compare)
+                and len(node.ops) == 1
+                and isinstance(node.ops[0], (ast.Eq, ast.NotEq))
+                and const_int(node.comparators[0]) == 0
+            ):
+                tests.append(node.left)
+        while tests:
+            node = tests.pop()
+            if isinstance(node, ast.BoolOp):
+                tests += node.values
+            elif isinstance(node, ast.UnaryOp) and isinstance(node.op, ast.Not):
+                tests.append(node.operand)
+            elif isinstance(node, ast.BinOp) and isinstance(node.op, ast.Mod):
+                found.add(id(node))
+        return found
+
+    class Divide(ast.NodeTransformer):
+        def __init__(self, zero_tests: set[int]):
+            self.zero_tests = zero_tests
+
+        def visit_BinOp(self, node: ast.BinOp) -> ast.expr:
+            self.generic_visit(node)
+            if not isinstance(node.op, (ast.FloorDiv, ast.Mod)) or is_float(node):
+                return node
+            if isinstance(node.left, (ast.Constant, ast.JoinedStr)) and isinstance(
+                getattr(node.left, "value", ""), str
+            ):
+                # String formatting
+                return node
+            left, right = const_int(node.left), const_int(node.right)
+            if isinstance(node.op, ast.FloorDiv) and left is not None and right:
+                return ast.Constant(left // right)
+            if isinstance(node.op, ast.Mod) and (
+                id(node) in self.zero_tests
+                or non_negative(node.left)
+                and non_negative(node.right)
+            ):
+                return node
+            helper = "FloorDiv" if isinstance(node.op, ast.FloorDiv) else "Mod"
+            return ast.Call(ast.Name(func_name + helper), [node.left, node.right], [])
+
+    def divide(expr: str | None, condition: bool = False) -> str | None:
+        if not expr or not re.search(r"//|%", expr):
+            return expr
+        tree = ast.parse(expr, mode="eval").body
+        return ast.unparse(Divide(zero_tests(tree, condition)).visit(tree))
+
+    predicate = ir.reduce is not None and ir.reduce.kind in ("any", "all")
+    return replace(
+        ir,
+        element=divide(ir.element, predicate),
+        key_expr=divide(ir.key_expr),
+        val_expr=divide(ir.val_expr),
+        generators=[
+            replace(
+                g,
+                filters=[divide(f, True) for f in g.filters],
+                take_while=[divide(c, True) for c in g.take_while],
+            )
+            for g in ir.generators
+        ],
+    )
+
+
+def _division_helpers(code: str, func_name: str) -> str:
+    """The Go floor division and modulo helpers code calls, if any."""
+    helpers = []
+    if f"{func_name}FloorDiv(" in code:
+        name = f"{func_name}FloorDiv"
+        helpers.append([
+            f"// {name} returns a // b as Python computes it, rounding the",
+            "// quotient toward negative infinity where Go's / truncates it.",
+            f"func {name}(a, b int) int {{",
+            "    q := a / b",
+            "    if a%b != 0 && (a < 0) != (b < 0) {",
+            "        q--",
+            "    }",
+            "    return q",
+            "}",
+        ])
+    if f"{func_name}Mod(" in code:
+        name = f"{func_name}Mod"
+        helpers.append([
+            f"// {name} returns a % b as Python computes it, with the sign of b",
+            "// where Go's % takes the sign of a.",
+            f"func {name}(a, b int) int {{",
+            "    r := a % b",
+            "    if r != 0 && (r < 0) != (b < 0) {",
+            "        r += b",
+            "    }",
+            "    return r",
+            "}",
+        ])
+    return "".join("\n" + "\n".join(lines) + "\n" for lines in helpers)
+
+
+def _go_filters(
+    ir: IRComp, helpers: dict[str, str] | None = None, contains: bool = False
+) -> IRComp:
+    """
+    ir with every generator's filters and takewhile() conditions, and the
+    predicate of an any() or all(), written as Go conditions.
+    """
+    element = ir.element
+    if ir.reduce and ir.reduce.kind in ("any", "all") and element is not None:
+        element = _go_cond(element, helpers, contains)
+    return replace(
+        ir,
+        element=element,
+        generators=[
+            replace(
+                g,
+                filters=[_go_cond(f, helpers, contains) for f in g.filters],
+                take_while=[_go_cond(c, helpers, contains) for c in g.take_while],
+            )
+            for g in ir.generators
+        ],
+    )
+
+
+def _substitute_names(expr: str | None, values: dict[str, ast.expr]) -> str | None:
+    """expr with each name in values replaced by its expression."""
+    if not expr or not values:
+        return expr
+
+    class Substitute(ast.NodeTransformer):
+        def visit_Name(self, node: ast.Name) -> ast.expr:
+            return values.get(node.id, node)
+
+    return ast.unparse(Substitute().visit(ast.parse(expr, mode="eval")))
+
+
+def _unpack_sources(ir: IRComp) -> IRComp:
+    """
+    ir with each generator over zip() or enumerate() of constant ranges, such
+    as `for a, b in zip(range(5), range(3, 9))`, turned into a generator over
+    the index of their values. Go walks the ranges in step by that index, so
+    a, b and an enumerate() count become expressions of it, and the loop
+    stops at the end of the shortest range, as zip() does.
+    """
+    names = {
+        n.id
+        for expr in [ir.element, ir.key_expr, ir.val_expr]
+        + [e for g in ir.generators for e in [g.var, *g.filters]]
+        + [g.source for g in ir.generators if isinstance(g.source, str)]
+        if expr
+        for n in ast.walk(ast.parse(expr, mode="eval"))
+        if isinstance(n, ast.Name)
+    }
+    values: dict[str, ast.expr] = {}
+
+    def substitute(expr: str | None) -> str | None:
+        return _substitute_names(expr, values)
+
+    generators = []
+    for gen in ir.generators:
+        source = substitute(gen.source) if isinstance(gen.source, str) else gen.source
+        call = ast.parse(source, mode="eval").body if isinstance(source, str) else None
+        if not (
+            isinstance(call, ast.Call)
+            and isinstance(call.func, ast.Name)
+            and call.func.id in ("zip", "enumerate")
+        ):
+            if not gen.var.isidentifier():
+                raise ValueError(
+                    f"Go can only unpack zip() and enumerate(): for {gen.var} in "
+                    f"{source}"
+                )
+            filters = [substitute(f) for f in gen.filters]
+            take_while = [substitute(c) for c in gen.take_while]
+            generators.append(
+                replace(gen, source=source, filters=filters, take_while=take_while)
+            )
+            continue
+        index, targets, count_start = _unpack_target(gen.var, call, names)
+        names.add(index)
+        if call.func.id == "enumerate":
+            count, value = targets
+            start, stop, step = _const_range(call.args[0], source)
+            length = _range_len(start, stop, step)
+            values[value] = _index_expr(index, start, step)
+            if count != index:
+                values[count] = _index_expr(index, count_start, 1)
+        else:
+            lengths = []
+            for target, arg in zip(targets, call.args):
+                start, stop, step = _const_range(arg, source)
+                lengths.append(_range_len(start, stop, step))
+                values[target] = _index_expr(index, start, step)
+            length = min(lengths)
+        generators.append(
+            IRGenerator(
+                var=index,
+                source=IRRange(0, length, 1),
+                filters=[substitute(f) for f in gen.filters],
+            )
+        )
+    if not values:
+        return ir
+    return replace(
+        ir,
+        generators=generators,
+        element=substitute(ir.element),
+        key_expr=substitute(ir.key_expr),
+        val_expr=substitute(ir.val_expr),
+    )
+
+
+def _unpack_target(
+    var: str, call: ast.Call, names: set[str]
+) -> tuple[str, list[str], int]:
+    """
+    The index variable of a zip() or enumerate() generator, the names its
+    tuple target var binds (an enumerate() count first) and where the count
+    starts. The count itself indexes the loop when it starts at 0; otherwise,
+    and for zip(), the index is the first of i, j, k, i0, i1, ... not in names.
+    """
+    target = ast.parse(var, mode="eval").body
+    what = f"for {var} in {ast.unparse(call)}"
+    if call.keywords and not (
+        call.func.id == "enumerate"
+        and len(call.keywords) == 1
+        and call.keywords[0].arg == "start"
+    ):
+        raise ValueError(f"Go does not support keyword arguments here: {what}")
+    count_start = 0
+    if call.func.id == "enumerate":
+        args = call.args + [k.value for k in call.keywords]
+        if len(args) not in (1, 2):
+            raise ValueError(f"enumerate() takes a range and a start: {what}")
+        if len(args) == 2:
+            count_start = const_int(args[1])
+            if count_start is None:
+                raise ValueError(f"Go needs a constant enumerate() start: {what}")
+        arity = 2
+    else:
+        arity = len(call.args)
+    if not (
+        isinstance(target, ast.Tuple)
+        and len(target.elts) == arity
+        and all(isinstance(t, ast.Name) for t in target.elts)
+    ):
+        raise ValueError(f"Go needs one loop variable per value of the tuple: {what}")
+    targets = [t.id for t in target.elts]
+    if call.func.id == "enumerate" and count_start == 0:
+        return targets[0], targets, 0
+    candidates = ["i", "j", "k"] + [f"i{n}" for n in range(len(names) + 1)]
+    index = next(c for c in candidates if c not in names and c not in targets)
+    return index, targets, count_start
+
+
+@dataclass
+class _StringSource:
+    """
+    The source of a generator over a string: the Go expression of the
+    string, a literal or an input, and the most runes it has, None when
+    only known at run time.
+    """
+
+    expr: str
+    length: int | None
+
+
+def _typed_sources(
+    ir: IRComp, func_name: str, input_types: dict[str, str]
+) -> tuple[IRComp, list[str], dict[str, str], list[str]]:
+    """
+    ir with its generators over a str or bytes literal, or an input of
+    input_types, made loops Go runs as Python does, the const declarations
+    of the bytes literals, the Go types of the inputs by name, []int ones
+    too, and the inputs read from Parquet files. A string loops with for
+    range, which yields its runes: the loop variable is a rune, and the
+    element and filters test and convert it through _rune_expr. Bytes and
+    Arrow columns loop by index, i as in `for i := 0; i < len(b); i += 1`,
+    and the variable, an int in Python, becomes int(b[i]) or
+    int(col.Value(i)) wherever it is read; a column's nulls are skipped. A
+    bytes literal is a const named after func_name, and a Parquet input
+    the path parameter of its column, data read from dataPath.
+    """
+    names = {
+        n.id
+        for expr in [ir.element, ir.key_expr, ir.val_expr]
+        + [e for g in ir.generators for e in [g.var, *g.filters]]
+        + [g.source for g in ir.generators if isinstance(g.source, str)]
+        if expr
+        for n in ast.walk(ast.parse(expr, mode="eval"))
+        if isinstance(n, ast.Name)
+    }
+    values: dict[str, ast.expr] = {}
+    runes: set[str] = set()
+    consts: list[str] = []
+    inputs: dict[str, str] = {}
+    columns: list[str] = []
+    generators = []
+
+    def index_var() -> str:
+        candidates = ["i", "j", "k"] + [f"i{n}" for n in range(len(names) + 1)]
+        index = next(c for c in candidates if c not in names)
+        names.add(index)
+        return index
+
+    for gen in ir.generators:
+        node = None
+        if isinstance(gen.source, str):
+            node = ast.parse(_substitute_names(gen.source, values), mode="eval").body
+        literal = node.value if isinstance(node, ast.Constant) else None
+        kind = input_types.get(node.id) if isinstance(node, ast.Name) else None
+        if isinstance(node, ast.Name) and not kind and _input_slice(gen):
+            inputs[node.id] = "[]int"
+        filters = [_substitute_names(f, values) for f in gen.filters]
+        take_while = [_substitute_names(c, values) for c in gen.take_while]
+        if isinstance(literal, str) or kind == "string":
+            if not gen.var.isidentifier():
+                raise ValueError(f"Go loops over a string with one variable: {gen.var}")
+            if isinstance(literal, str):
+                source = _StringSource(_go_string(literal), len(literal))
+            else:
+                source = _StringSource(node.id, None)
+                inputs[node.id] = GO_INPUT_TYPES[kind]
+            runes.add(gen.var)
+            generators.append(
+                replace(gen, source=source, filters=filters, take_while=take_while)
+            )
+        elif isinstance(literal, bytes) or kind == "bytes":
+            if isinstance(literal, bytes):
+                name = f"{func_name}Bytes{len(consts) or ''}"
+                consts.append(f"const {name} = {_go_bytes(literal)}")
+                source = IRRange(0, len(literal), 1)
+            else:
+                name = node.id
+                inputs[name] = GO_INPUT_TYPES[kind]
+                source = f"range(len({name}))"
+            index = index_var()
+            values[gen.var] = ast.parse(f"int({name}[{index}])", mode="eval").body
+            filters = [_substitute_names(f, values) for f in gen.filters]
+            take_while = [_substitute_names(c, values) for c in gen.take_while]
+            generators.append(
+                IRGenerator(
+                    var=index, source=source, filters=filters, take_while=take_while
+                )
+            )
+        elif kind in ("arrow", "parquet"):
+            if gen.take_while:
+                # A null would be tested before the validity filter skips it
+                raise ValueError(f"takewhile() over a {kind} column is not supported")
+            name = node.id
+            if kind == "parquet":
+                columns.append(name)
+                name_type = (f"{name}Path", GO_INPUT_TYPES[kind])
+            else:
+                name_type = (name, GO_INPUT_TYPES[kind])
+            inputs[name_type[0]] = name_type[1]
+            index = index_var()
+            value = f"int({name}.Value({index}))"
+            values[gen.var] = ast.parse(value, mode="eval").body
+            filters = [f"{name}.IsValid({index})"]
+            filters += [_substitute_names(f, values) for f in gen.filters]
+            generators.append(
+                IRGenerator(var=index, source=f"range({name}.Len())", filters=filters)
+            )
+        else:
+            source = ast.unparse(node) if node else gen.source
+            generators.append(
+                replace(gen, source=source, filters=filters, take_while=take_while)
+            )
+    if not runes and not values:
+        return ir, [], {}, []
+
+    def convert(expr: str | None, value: str | None = None) -> str | None:
+        if expr is None:
+            return None
+        return _rune_expr(_substitute_names(expr, values), runes, value)
+
+    join = ir.reduce is not None and ir.reduce.kind == "join"
+    # next() returns a value as a collection holds it
+    collection = not ir.reduce and ir.kind in ("list", "set")
+    collection = collection or ir.reduce is not None and ir.reduce.kind == "next"
+    generators = [
+        replace(
+            g,
+            filters=[convert(f) for f in g.filters],
+            take_while=[convert(c) for c in g.take_while],
+        )
+        for g in generators
+    ]
+    return (
+        replace(
+            ir,
+            generators=generators,
+            element=convert(
+                ir.element, "chr" if join else "string" if collection else None
+            ),
+            key_expr=convert(ir.key_expr),
+            val_expr=convert(ir.val_expr),
+        ),
+        consts,
+        inputs,
+        columns,
+    )
+
+
+def _go_bytes(value: bytes) -> str:
+    """value as a Go string literal of the same bytes."""
+    text = "".join(
+        chr(b) if 0x20 <= b < 0x7F and b not in b'"\\' else f"\\x{b:02x}"
+        for b in value
+    )
+    return f'"{text}"'
+
+
+def _rune_expr(expr: str, runes: set[str], value: str | None = None) -> str:
+    """
+    expr, reading the rune variables runes of loops over strings, as Go
+    reads them. ord(c) is int(c), a comparison with a one-character string
+    compares with its rune literal, c in "aeiou" is c == 'a' || c == 'e'
+    ..., and c.isdigit(), c.upper() and the like call the unicode package
+    (see _RUNE_TESTS). A character as a value, when value names a function,
+    is passed to it: string, for the []string of a list, or chr, for
+    str.join(); with value None a character can only be tested, not kept.
+    """
+    tree = ast.parse(expr, mode="eval")
+
+    def is_char(node: ast.expr) -> bool:
+        if isinstance(node, ast.Name):
+            return node.id in runes
+        return (
+            isinstance(node, ast.Call)
+            and ast.unparse(node.func).startswith("unicode.To")
+            and len(node.args) == 1
+        )
+
+    def rune(node: ast.expr) -> ast.expr:
+        if isinstance(node, ast.Constant) and node.value == "'":
+            return ast.Constant(ord("'"))
+        return node
+
+    class Convert(ast.NodeTransformer):
+        def visit_Call(self, node: ast.Call) -> ast.expr:
+            self.generic_visit(node)
+            func = node.func
+            if isinstance(func, ast.Name) and func.id == "ord" and len(node.args) == 1:
+                arg = node.args[0]
+                if isinstance(arg, ast.Constant) and isinstance(arg.value, str):
+                    return ast.Constant(ord(arg.value)) if len(arg.value) == 1 else node
+                if is_char(arg):
+                    return ast.Call(ast.Name("int"), node.args, [])
+            if not (
+                isinstance(func, ast.Attribute)
+                and is_char(func.value)
+                and not node.args
+            ):
+                return node
+            if func.attr in _RUNE_MAPS:
+                call = f"unicode.{_RUNE_MAPS[func.attr]}"
+                return ast.Call(ast.Name(call), [func.value], [])
+            if func.attr in _RUNE_TESTS:
+                tests = [
+                    ast.Call(ast.Name(f"unicode.{t}"), [func.value], [])
+                    for t in _RUNE_TESTS[func.attr]
+                ]
+                return tests[0] if len(tests) == 1 else ast.BoolOp(ast.Or(), tests)
+            raise ValueError(f"Go has no rune form of str.{func.attr}(): {expr}")
+
+        def visit_Compare(self, node: ast.Compare) -> ast.expr:
+            self.generic_visit(node)
+            operands = [node.left, *node.comparators]
+            if not any(is_char(o) for o in operands):
+                return node
+            if (
+                len(node.ops) == 1
+                and isinstance(node.ops[0], (ast.In, ast.NotIn))
+                and isinstance(node.comparators[0], ast.Constant)
+                and isinstance(node.comparators[0].value, str)
+            ):
+                chars = dict.fromkeys(node.comparators[0].value)
+                if not chars:
+                    return ast.Constant(isinstance(node.ops[0], ast.NotIn))
+                op, join = (
+                    (ast.Eq(), ast.Or())
+                    if isinstance(node.ops[0], ast.In)
+                    else (ast.NotEq(), ast.And())
+                )
+                tests = [
+                    ast.Compare(node.left, [op], [rune(ast.Constant(c))]) for c in chars
+                ]
+                return tests[0] if len(tests) == 1 else ast.BoolOp(join, tests)
+            for o in operands:
+                if isinstance(o, ast.Constant) and not (
+                    isinstance(o.value, str) and len(o.value) == 1
+                ):
+                    raise ValueError(
+                        f"Go compares a character with one-character strings: {expr}"
+                    )
+            node.left = rune(node.left)
+            node.comparators = [rune(c) for c in node.comparators]
+            return node
+
+    def pieces(node: ast.expr) -> list[ast.expr]:
+        # The strings concatenated into a value of str.join(), a character
+        # passed to chr() and any other value of an f-string to str()
+        if isinstance(node, ast.BinOp) and isinstance(node.op, ast.Add):
+            return pieces(node.left) + pieces(node.right)
+        if isinstance(node, ast.JoinedStr):
+            return [p for v in node.values for p in pieces(v)]
+        if isinstance(node, ast.FormattedValue):
+            if node.format_spec or node.conversion not in (-1, ord("s")):
+                raise ValueError(f"Go joins f-strings without format specs: {expr}")
+            if is_char(node.value):
+                return [ast.Call(ast.Name("chr"), [node.value], [])]
+            return [ast.Call(ast.Name("str"), [node.value], [])]
+        return [ast.Call(ast.Name("chr"), [node], [])] if is_char(node) else [node]
+
+    body = Convert().visit(tree).body
+    if value == "chr":
+        parts = pieces(body)
+        body = parts[0]
+        for part in parts[1:]:
+            body = ast.BinOp(body, ast.Add(), part)
+    elif value and is_char(body):
+        body = ast.Call(ast.Name(value), [body], [])
+    # Any other use of a character, as a number or a value, is an error
+    converted = {"int", "string", "chr"}
+    converted |= {f"unicode.{f}" for tests in _RUNE_TESTS.values() for f in tests}
+    converted |= {f"unicode.{f}" for f in _RUNE_MAPS.values()}
+    parents = {c: p for p in ast.walk(body) for c in ast.iter_child_nodes(p)}
+    for node in ast.walk(body):
+        parent = parents.get(node)
+        if (
+            isinstance(node, ast.Name)
+            and node.id in runes
+            and not isinstance(parent, ast.Compare)
+            and not (
+                isinstance(parent, ast.Call) and ast.unparse(parent.func) in converted
+            )
+        ):
+            raise ValueError(f"Go needs ord() to compute with a character: {expr}")
+    return ast.unparse(body)
+
+
+def _optimize(ir: IRComp) -> IRComp:
+    """
+    The optimizer pass of render_go over ir: generators over an inner
+    comprehension fused into its loops (see _fuse_sources), then modulo
+    filters turned into strided ranges (see _stride_filters). Loop-invariant
+    code is hoisted later, where the loops are rendered (see
+    _hoist_invariants).
+    """
+    return _stride_filters(_fuse_sources(ir))
+
+
+def _comprehension_source(gen: IRGenerator) -> ast.expr | None:
+    """The comprehension a generator iterates, None for any other source."""
+    if not isinstance(gen.source, str):
+        return None
+    node = ast.parse(gen.source, mode="eval").body
+    return node if isinstance(node, _COMPREHENSIONS) else None
+
+
+def _fuse_sources(ir: IRComp) -> IRComp:
+    """
+    ir with each generator over a list comprehension or generator
+    expression, as in `[y * 2 for y in (x + 1 for x in range(9) if x % 3)]`,
+    replaced by the inner comprehension's own generators: the map and filter
+    chain then runs as one loop, the inner filters first, and every later
+    use of the outer variable reads the inner element instead, here
+    `[(x + 1) * 2 for x in range(9) if x % 3]`. An inner variable whose name
+    is taken elsewhere is renamed first. Sets and dicts, which drop
+    repeated values, are left as they are, and so are takewhile() sources,
+    whose loop ends at a value of the inner comprehension.
+    """
+    generators = list(ir.generators)
+    element, key_expr, val_expr = ir.element, ir.key_expr, ir.val_expr
+    i = 0
+    while i < len(generators):
+        gen = generators[i]
+        comp = _comprehension_source(gen)
+        if not (
+            isinstance(comp, (ast.GeneratorExp, ast.ListComp))
+            and gen.var.isidentifier()
+            and not gen.take_while
+            and all(
+                isinstance(c.target, ast.Name) and not is_takewhile(c.iter)
+                for c in comp.generators
+            )
+        ):
+            i += 1
+            continue
+        # Names read or bound outside the inner comprehension; the outer
+        # variable's is free once its uses read the element instead
+        taken = {
+            n.id
+            for expr in [element, key_expr, val_expr, *gen.filters]
+            + [e for g in generators if g is not gen for e in [g.var, *g.filters]]
+            + [
+                g.source
+                for g in generators
+                if g is not gen and isinstance(g.source, str)
+            ]
+            if expr
+            for n in ast.walk(ast.parse(expr, mode="eval"))
+            if isinstance(n, ast.Name) and n.id != gen.var
+        }
+        if [g.var for g in generators].count(gen.var) > 1:
+            taken.add(gen.var)
+        renames: dict[str, ast.expr] = {}
+        inner = []
+        for clause in comp.generators:
+            # A clause's source is evaluated before its variable is bound
+            source = _substitute_names(ast.unparse(clause.iter), renames)
+            var = clause.target.id
+            if var in taken:
+                suffixes = range(1, len(taken) + 2)
+                var = next(f"{var}{n}" for n in suffixes if f"{var}{n}" not in taken)
+            taken.add(var)
+            renames[clause.target.id] = ast.Name(var)
+            filters = [_substitute_names(ast.unparse(f), renames) for f in clause.ifs]
+            inner.append(IRGenerator(var=var, source=source, filters=filters))
+        elt = _substitute_names(ast.unparse(comp.elt), renames)
+        value = {gen.var: ast.parse(elt, mode="eval").body}
+        inner[-1].filters += [_substitute_names(f, value) for f in gen.filters]
+        rest = [
+            replace(
+                g,
+                source=_substitute_names(g.source, value)
+                if isinstance(g.source, str)
+                else g.source,
+                filters=[_substitute_names(f, value) for f in g.filters],
+            )
+            for g in generators[i + 1 :]
+        ]
+        generators[i:] = inner + rest
+        element = _substitute_names(element, value)
+        key_expr = _substitute_names(key_expr, value)
+        val_expr = _substitute_names(val_expr, value)
+    if generators == ir.generators:
+        return ir
+    return replace(
+        ir,
+        generators=generators,
+        element=element,
+        key_expr=key_expr,
+        val_expr=val_expr,
+    )
+
+
+def _stride_filters(ir: IRComp) -> IRComp:
+    """
+    ir with the first `var % m == r` filter of each generator over a
+    constant range with step 1 or -1 folded into the range: it steps by m
+    from the first value that passes, so the loop only visits those.
+    m and r are int literals with 0 <= r < m. A generator with takewhile()
+    conditions keeps its range, as they test every value.
+    """
+    generators = []
+    for gen in ir.generators:
+        bounds = _loop_bounds(gen) if not isinstance(gen.source, str) else None
+        if gen.take_while:
+            bounds = None
+        for index, f in enumerate(gen.filters):
+            modulus = _modulo_filter(f, gen.var)
+            if bounds and bounds[2] in (1, -1) and modulus:
+                start, stop, step = bounds
+                m, r = modulus
+                if step == 1:
+                    start += (r - start) % m
+                else:
+                    start -= (start - r) % m
+                filters = gen.filters[:index] + gen.filters[index + 1 :]
+                source = replace(gen.source, start=start, stop=stop, step=step * m)
+                gen = replace(gen, source=source, filters=filters)
+                break
+        generators.append(gen)
+    return replace(ir, generators=generators)
+
+
+def _hoist_invariants(ir: IRComp) -> tuple[IRComp, dict[str, list[str]]]:
+    """
+    ir with the loop-invariant code of its nest of loops moved out of the
+    loops it does not depend on, and the statements each loop then runs
+    first, by loop variable. A filter that reads only the variables of
+    outer generators joins the filters of the innermost of those, and each
+    operation or call in the element, key or value that does not read the
+    innermost variable is computed into a variable hoisted0, hoisted1, ...
+    once per value of the loop binding the last variable it reads. Code that
+    may divide by zero stays where it is, as Python might never run it.
+    """
+    generators = [replace(g, filters=list(g.filters)) for g in ir.generators]
+    variables = [g.var for g in generators]
+    if len(generators) < 2 or len(set(variables)) < len(variables):
+        return ir, {}
+
+    def level(node: ast.AST) -> int:
+        read = {n.id for n in ast.walk(node) if isinstance(n, ast.Name)}
+        return max((i for i, v in enumerate(variables) if v in read), default=-1)
+
+    def safe(node: ast.AST) -> bool:
+        return not any(
+            isinstance(n, ast.BinOp)
+            and isinstance(n.op, (ast.Div, ast.FloorDiv, ast.Mod))
+            and const_int(n.right) in (None, 0)
+            # The floor division and modulo helpers of _int_division
+            or isinstance(n, ast.Call)
+            and isinstance(n.func, ast.Name)
+            and n.func.id.endswith(("FloorDiv", "Mod"))
+            and len(n.args) == 2
+            and const_int(n.args[1]) in (None, 0)
+            for n in ast.walk(node)
+        )
+
+    for i, gen in enumerate(generators[1:], 1):
+        kept = []
+        for f in gen.filters:
+            node = ast.parse(f, mode="eval").body
+            depth = level(node)
+            if 0 <= depth < i and safe(node):
+                generators[depth].filters.append(f)
+            else:
+                kept.append(f)
+        gen.filters[:] = kept
+
+    names = {
+        n.id
+        for expr in [ir.element, ir.key_expr, ir.val_expr] + variables
+        if expr
+        for n in ast.walk(ast.parse(expr, mode="eval"))
+        if isinstance(n, ast.Name)
+    }
+    lets: dict[str, list[str]] = {}
+    innermost = len(generators) - 1
+
+    class Hoist(ast.NodeTransformer):
+        def generic_visit(self, node: ast.AST) -> ast.AST:
+            if isinstance(node, (ast.BinOp, ast.Call)) and safe(node):
+                depth = level(node)
+                if 0 <= depth < innermost:
+                    index = sum(len(v) for v in lets.values())
+                    while f"hoisted{index}" in names:
+                        index += 1
+                    name = f"hoisted{index}"
+                    names.add(name)
+                    lets.setdefault(variables[depth], []).append(
+                        f"{name} := {ast.unparse(node)}"
+                    )
+                    return ast.Name(name)
+            return super().generic_visit(node)
+
+    def hoist(expr: str | None) -> str | None:
+        if not expr:
+            return expr
+        return ast.unparse(Hoist().visit(ast.parse(expr, mode="eval")))
+
+    hoisted = replace(
+        ir,
+        generators=generators,
+        element=hoist(ir.element),
+        key_expr=hoist(ir.key_expr),
+        val_expr=hoist(ir.val_expr),
+    )
+    return hoisted, lets
+
+
+def _modulo_filter(expr: str, var: str) -> tuple[int, int] | None:
+    """m and r of a filter `var % m == r` of int literals, 0 <= r < m."""
+    node = ast.parse(expr, mode="eval").body
+    if not (
+        isinstance(node, ast.Compare)
+        and len(node.ops) == 1
+        and isinstance(node.ops[0], ast.Eq)
+        and isinstance(node.left, ast.BinOp)
+        and isinstance(node.left.op, ast.Mod)
+        and isinstance(node.left.left, ast.Name)
+        and node.left.left.id == var
+    ):
+        return None
+    m, r = node.left.right, node.comparators[0]
+    if not all(isinstance(c, ast.Constant) and type(c.value) is int for c in (m, r)):
+        return None
+    if not 0 <= r.value < m.value:
+        return None
+    return m.value, r.value
+
+
+def _const_range(node: ast.expr, source: str) -> tuple[int, int, int]:
+    """start, stop and step of a range() with constant bounds."""
+    args = _range_args(node)
+    bounds = [const_int(ast.parse(a, mode="eval").body) for a in args or []]
+    if not (len(bounds) == 3 and None not in bounds and bounds[2]):
+        raise ValueError(f"Go can only zip or enumerate constant ranges: {source}")
+    start, stop, step = bounds
+    return start, stop, step
+
+
+def _index_expr(index: str, start: int, step: int) -> ast.expr:
+    """The value at index of a range from start by step."""
+    expr = f"{index} * {step}" if step != 1 else index
+    return ast.parse(f"{start} + {expr}" if start else expr, mode="eval").body
+
+
+def _range_args(node: ast.expr) -> tuple[str, str, str] | None:
+    """start, stop and step of a range(...) call as written, else None."""
+    if not (
+        isinstance(node, ast.Call)
+        and isinstance(node.func, ast.Name)
+        and node.func.id == "range"
+        and 1 <= len(node.args) <= 3
+        and not node.keywords
+    ):
+        return None
+    bounds = [ast.unparse(a) for a in node.args]
+    if len(bounds) == 1:
+        bounds.insert(0, "0")
+    start, stop, step = (bounds + ["1"])[:3]
+    return start, stop, step
+
+
+def _range_step(step: str, source: str) -> int | str:
+    """
+    step of the range source as an int when it is a constant, as written
+    when it is computed at run time. A zero step is rejected: Python raises
+    on it, where a Go loop would never end.
+    """
+    value = const_int(ast.parse(step, mode="eval").body)
+    if value == 0:
+        raise ValueError(f"range() arg 3 must not be zero: {source}")
+    return step if value is None else value
+
+
+def _for_clause(
+    var: str, start: int | str, stop: int | str, step: int | str
+) -> str:
+    """
+    The Go for-clause of range(start, stop, step). A step computed at run
+    time is tested for its sign in the condition, as range() does.
+    """
+    if isinstance(step, str):
+        cond = f"{step} > 0 && {var} < {stop} || {step} < 0 && {var} > {stop}"
+    else:
+        cond = f"{var} {'<' if step > 0 else '>'} {stop}"
+    return f"for {var} := {start}; {cond}; {var} += {step}"
+
+
+def _chunk_loop(var: str, start: int, step: int) -> str:
+    """The for-clause of a parallel worker over its chunk [lo, hi) of a range."""
+    cmp = "<" if step > 0 else ">"
+    return (
+        f"for {var} := {start} + lo*{step}; "
+        f"{var} {cmp} {start} + hi*{step}; {var} += {step}"
+    )
+
+
+def _loop_bounds(
+    gen: IRGenerator,
+) -> tuple[int | str, int | str, int | str] | None:
+    """
+    start, stop and step of a generator over a range: ints when they are
+    constants, the bounds as written when they read a variable, as the inner
+    range of range(x, 2 * x) does. None for a source that is no range.
+    """
+    if hasattr(gen.source, "start") and hasattr(gen.source, "stop"):
+        start, stop, step = gen.source.start, gen.source.stop, gen.source.step
+        if step == 0:
+            source = f"range({start}, {stop}, 0)"
+            raise ValueError(f"range() arg 3 must not be zero: {source}")
+        return start, stop, step
+    if not isinstance(gen.source, str):
+        return None
+    args = _range_args(ast.parse(gen.source, mode="eval").body)
+    if args is None:
+        return None
+    return args[0], args[1], _range_step(args[2], gen.source)
+
+
+def _input_slice(gen: IRGenerator) -> str | None:
+    """
+    The name of the []int a generator iterates when its source is a plain
+    name, as data in `for x in data`: the caller provides it as a parameter.
+    None for a range or any other source.
+    """
+    source = gen.source
+    if isinstance(source, str) and source.isidentifier():
+        if source not in _GO_KEYWORDS:
+            return source
+    return None
+
+
+def _input_params(ir: IRComp) -> list[str]:
+    """The input slices of ir's generators, each once, in order of use."""
+    names = (_input_slice(g) for g in ir.generators)
+    return list(dict.fromkeys(n for n in names if n))
+
+
+def _signature_params(inputs: list[str]) -> str:
+    return f"{', '.join(inputs)} []int" if inputs else ""
+
+
+def _loop_clause(gen: IRGenerator, body: list[str]) -> str:
+    """
+    The Go for-clause of a generator whose loop runs body: a range over the
+    values of its input slice or the runes of its string, without the
+    variable when neither the filters nor body read it, else the for-clause
+    of its range bounds.
+    """
+    data = _input_slice(gen)
+    tests = gen.take_while + gen.filters
+    if isinstance(gen.source, _StringSource):
+        if _uses(gen.var, tests + body):
+            return f"for _, {gen.var} := range {gen.source.expr}"
+        return f"for range {gen.source.expr}"
+    if data is None:
+        return _for_clause(gen.var, *(_loop_bounds(gen) or (0, 1000, 1)))
+    if _uses(gen.var, tests + body):
+        return f"for _, {gen.var} := range {data}"
+    return f"for range {data}"
+
+
+def _inner_loops(
+    generators: list[IRGenerator],
+    body: list[str],
+    lets: dict[str, list[str]] | None = None,
+) -> list[str]:
+    """
+    body nested in one loop per generator, the first outermost, each loop
+    opening with its generator's takewhile() conditions, which break out of
+    it, its filters and then the statements lets has
+    for its variable (see _hoist_invariants): the for-clauses that follow a
+    comprehension's first, run in full for every value of the ones before.
+    """
+    for gen in reversed(generators):
+        text = isinstance(gen.source, _StringSource)
+        if _input_slice(gen) is None and _loop_bounds(gen) is None and not text:
+            raise ValueError(
+                "Go backend can only nest loops over a range or an input slice: "
+                f"{gen.source}"
+            )
+        body = (lets or {}).get(gen.var, []) + body
+        lines = [f"{_loop_clause(gen, body)} {{"]
+        lines += [f"    if !({c}) {{ break }}" for c in gen.take_while]
+        lines += [f"    if !({f}) {{ continue }}" for f in gen.filters]
+        lines += [f"    {line}" for line in body]
+        body = lines + ["}"]
+    return body
+
+
+def _render_helper_calls(
+    ir: IRComp, func_name: str, return_type: str, result_type: str
+) -> str:
+    """
+    render_go with emit="helpers": the comprehension as a chain of calls into
+    the generic helpers of pcs/backends/go/pcs_helpers.go (Range, Filter,
+    Map, MapKV, SetOf, Reduce, Sum, Max, Min, Any, All) instead of a loop.
+    """
+    if len(ir.generators) != 1:
+        raise ValueError("Helper emission supports a single generator only")
+    gen = ir.generators[0]
+    var = gen.var
+    data = _input_slice(gen)
+    seq = "xs" if var != "xs" and data != "xs" else "ys"
+    if data is None:
+        start, stop, step = _loop_bounds(gen) or (0, 1000, 1)
+        data = f"Range({start}, {stop}, {step})"
+
+    def fn(result: str, expr: str) -> str:
+        return f"func({var} int) {result} {{ return {expr} }}"
+
+    params = _signature_params(_input_params(ir))
+    lines = [
+        "// Requires pcs_helpers.go (pcs/backends/go) in the same package.",
+        f"func {func_name}({params}) {return_type} {{",
+        f"    {seq} := {data}",
+    ]
+    if gen.filters:
+        cond = " && ".join(f"({f})" for f in gen.filters)
+        if len(gen.filters) == 1:
+            cond = gen.filters[0]
+        lines.append(f"    {seq} = Filter({seq}, {fn('bool', cond)})")
+
+    element = ir.element or var
+    mapped = seq if element == var else f"Map({seq}, {fn('int', element)})"
+    k = ir.reduce.kind if ir.reduce else None
+    if k == "sum":
+        result = f"Sum({mapped})"
+    elif k == "prod":
+        result = f"Reduce({mapped}, 1, func(acc, v int) int {{ return acc * v }})"
+    elif k in ("max", "min"):
+        result = f"{k.capitalize()}({mapped})"
+    elif k in ("any", "all"):
+        result = f"{k.capitalize()}({seq}, {fn('bool', element)})"
+    elif ir.kind == "set":
+        result = f"SetOf({mapped})"
+    elif ir.kind == "dict":
+        kv = f"{ir.key_expr or var}, {ir.val_expr or var}"
+        result = f"MapKV({seq}, {fn('(int, int)', kv)})"
+    else:
+        result = mapped
+    if result_type != "int":
+        result = f"{result_type}({result})"
+    lines.append(f"    return {result}")
+    lines.append("}")
+    return "\n".join(lines) + "\n"
+
+
+def _render_iter(
+    ir: IRComp, func_name: str, return_type: str, result_type: str, empty: str = "zero"
+) -> str:
+    """
+    render_go with emit="iter": the comprehension as a lazy range-over-func
+    iterator (Go 1.23+) that computes each value only when the consumer asks
+    for it and stops as soon as it stops. Lists and bare generators become
+    iter.Seq[int], sets an iter.Seq[int] that skips values already yielded
+    and dicts an iter.Seq2[int, int] of key/value pairs, in which a later
+    pair for a key overrides an earlier one once collected (maps.Collect).
+    A reduction consumes the iterator of its elements, rendered as
+    func_name + "Seq", and keeps its usual result type.
+    """
+    if len(ir.generators) != 1:
+        raise ValueError("Iterator emission supports a single generator only")
+    gen = ir.generators[0]
+    var = gen.var
+    inputs = _input_params(ir)
+    element = ir.element or var
+    k = ir.reduce.kind if ir.reduce else None
+
+    seq_name, seq_type, yield_sig = func_name, "iter.Seq[int]", "int"
+    body = [f"if !yield({element}) {{ return }}"]
+    if k:
+        seq_name = f"{func_name}Seq"
+        if k in ("any", "all"):
+            seq_type, yield_sig = "iter.Seq[bool]", "bool"
+    elif ir.kind == "dict":
+        seq_type, yield_sig = "iter.Seq2[int, int]", "int, int"
+        key, val = ir.key_expr or var, ir.val_expr or var
+        body = [f"if !yield({key}, {val}) {{ return }}"]
+    elif ir.kind == "set":
+        body = [
+            f"v := {element}",
+            "if _, dup := seen[v]; dup { continue }",
+            "seen[v] = struct{}{}",
+            "if !yield(v) { return }",
+        ]
+
+    lines = ["import (", '    "iter"', ")", ""]
+    params = _signature_params(inputs)
+    lines.append(f"func {seq_name}({params}) {seq_type} {{")
+    lines.append(f"    return func(yield func({yield_sig}) bool) {{")
+    if ir.kind == "set" and not k:
+        lines.append("        seen := make(map[int]struct{})")
+    loop = _loop_clause(gen, body)
+    lines.append(f"        {loop} {{")
+    for f in gen.filters:
+        lines.append(f"            if !({f}) {{ continue }}")
+    lines += [f"            {stmt}" for stmt in body]
+    lines += ["        }", "    }", "}"]
+
+    if k:
+        lines += [
+            "",
+            f"func {func_name}({params}) {return_type} {{",
+            f"    acc := {_reduce_initial(ir.reduce)}",
+        ]
+        if k in ("max", "min"):
+            lines.append("    seen := false")
+        lines.append(f"    for v := range {seq_name}({', '.join(inputs)}) {{")
+        for stmt in _reduce_stmt(k, "acc", "seen", "v", early_exit=True):
+            lines.append(f"        {stmt}")
+        lines.append("    }")
+        lines += _empty_check(ir.reduce, empty)
+        if result_type != "int":
+            lines.append(f"    return {result_type}(acc)")
+        else:
+            lines.append("    return acc")
+        lines.append("}")
+    return "\n".join(lines) + "\n"
+
+
+def _render_chan(
+    ir: IRComp, func_name: str, return_type: str, result_type: str, empty: str = "zero"
+) -> str:
+    """
+    render_go with emit="chan": the comprehension's values sent over a
+    channel as they are computed. func_name + "To" sends them into a channel
+    the caller provides, without closing it; func_name returns a buffered
+    channel that a goroutine fills and closes, so a consumer must drain it.
+    Lists and generators send ints, sets each distinct int once and dicts
+    [2]int key/value pairs. A reduction sends its elements and func_name
+    reduces them, draining the channel even once any/all are decided.
+    """
+    if len(ir.generators) != 1:
+        raise ValueError("Channel emission supports a single generator only")
+    gen = ir.generators[0]
+    var = gen.var
+    inputs = _input_params(ir)
+    element = ir.element or var
+    k = ir.reduce.kind if ir.reduce else None
+
+    value_type = "bool" if k in ("any", "all") else "int"
+    send = [f"out <- {element}"]
+    if not k and ir.kind == "dict":
+        value_type = "[2]int"
+        send = [f"out <- [2]int{{{ir.key_expr or var}, {ir.val_expr or var}}}"]
+    elif not k and ir.kind == "set":
+        send = [
+            f"v := {element}",
+            "if _, dup := seen[v]; dup { continue }",
+            "seen[v] = struct{}{}",
+            "out <- v",
+        ]
+
+    params = _signature_params(inputs)
+    to_params = ", ".join(filter(None, [f"out chan<- {value_type}", params]))
+    lines = [f"func {func_name}To({to_params}) {{"]
+    if not k and ir.kind == "set":
+        lines.append("    seen := make(map[int]struct{})")
+    loop = _loop_clause(gen, send)
+    lines.append(f"    {loop} {{")
+    for f in gen.filters:
+        lines.append(f"        if !({f}) {{ continue }}")
+    lines += [f"        {stmt}" for stmt in send]
+    lines += ["    }", "}", ""]
+
+    if k:
+        lines.append(f"func {func_name}({params}) {return_type} {{")
+    else:
+        lines.append(f"func {func_name}({params}) <-chan {value_type} {{")
+    lines.append(f"    out := make(chan {value_type}, {_CHAN_BUFFER})")
+    lines.append("    go func() {")
+    lines.append("        defer close(out)")
+    lines.append(f"        {func_name}To({', '.join(['out', *inputs])})")
+    lines.append("    }()")
+    if k:
+        lines.append(f"    acc := {_reduce_initial(ir.reduce)}")
+        if k in ("max", "min"):
+            lines.append("    seen := false")
+        lines.append("    for v := range out {")
+        for stmt in _reduce_stmt(k, "acc", "seen", "v", early_exit=False):
+            lines.append(f"        {stmt}")
+        lines.append("    }")
+        lines += _empty_check(ir.reduce, empty)
+        if result_type != "int":
+            lines.append(f"    return {result_type}(acc)")
+        else:
+            lines.append("    return acc")
+    else:
+        lines.append("    return out")
+    lines.append("}")
+    return "\n".join(lines) + "\n"
+
+
+def _with_take_while(ir: IRComp) -> IRComp:
+    """
+    ir with every generator a pcs.core.IRGenerator: the IR of the legacy
+    pcs_step3_ts parser has no takewhile() conditions, read here as none,
+    as pcs/renderer_api.py reads them.
+    """
+    if all(hasattr(g, "take_while") for g in ir.generators):
+        return ir
+    generators = [
+        g
+        if hasattr(g, "take_while")
+        else IRGenerator(var=g.var, source=g.source, filters=g.filters)
+        for g in ir.generators
+    ]
+    return replace(ir, generators=generators)
 
 
 def render_go(
-    ir: IRComp, func_name: str = "program", parallel: bool = False, type_info=None
+    ir: IRComp,
+    func_name: str = "program",
+    parallel: bool = False,
+    type_info=None,
+    presize: bool = True,
+    map_impl: str = "builtin",
+    shard_merge: str = "sized",
+    result_type: str = "int",
+    emit: str = "loops",
+    parallel_style: str = "waitgroup",
+    cancellable: bool = False,
+    set_result: str = "map",
+    dict_result: str = "map",
+    number_type: str = "int",
+    overflow: str = "wrap",
+    return_error: bool = False,
+    optimize: bool = True,
+    fold: str = "off",
+    doc: str | None = None,
+    go_version: str | None = None,
+    input_types: dict[str, str] | None = None,
+    chunking: str = "even",
+    zero_alloc: bool = False,
+    empty: str = "zero",
+) -> str:
+    """
+    Go backend with goroutines parallel support:
+      list -> []int
+      set  -> map[int]struct{}
+      dict -> map[int]int
+      reductions: sum/max/min -> int, any/all -> bool
+    Notes:
+      - parallel=True splits the range across GOMAXPROCS goroutines (see
+        _render_parallel and _render_sharded_dict)
+      - Type-safe with compile-time guarantees
+      - Loop-based implementation for performance
+      - Maps and lists are pre-sized when the filtered range length can be
+        estimated, over nested ranges by the product of their lengths
+        (disable with presize=False to benchmark the difference)
+      - map_impl="swiss" builds sequential dict results into the vendored
+        swissMap from pcs/backends/go/pcs_swiss.go instead of a built-in map;
+        map_impl="sync" builds dict results, parallel ones too, into a
+        *sync.Map for consumers sharing it across goroutines (see
+        _render_sync_map)
+      - Parallel dict comprehensions are sharded per worker and merged with
+        the shard_merge strategy (see _render_sharded_dict)
+      - Reductions over inner comprehensions, as in nested comprehensions,
+        are computed by helper functions (see _lower_nested), and so are
+        inner comprehensions used as values: a list of lists returns
+        [][]int, a dict of lists map[int][]int. type_info then carries the
+        Go types of the elements and dict values ({"element": ...,
+        "value": ...}, int when absent) and the helpers
+      - sum/prod/max/min/any/all reductions follow Python: max/min start
+        from the first value, any/all break out once decided (see
+        _reduce_stmt). sum()'s and math.prod()'s start and max()'s and
+        min()'s default= seed the accumulator (see _reduce_initial); a
+        max/min of no values without one returns 0, or with empty="panic"
+        panics as Python raises ValueError (see _empty_check)
+      - A dict of reductions keyed by a group filter, as in
+        {k: sum(x for x in data if x % 10 == k) for k in range(10)}, is
+        built in one pass over the values (see _grouped_aggregate) when the
+        loops are sequential and the map is builtin
+      - Filters become short-circuiting Go conditions (see _go_cond)
+      - Conditional expressions become helper functions too (see
+        _render_cond_helper)
+      - zip() and enumerate() of constant ranges loop over the index of
+        their values (see _unpack_sources)
+      - A generator over a plain name iterates a []int the function takes
+        as a parameter of that name (see _input_slice); it has no parallel
+        form
+      - result_type declares sum/prod/max/min results as another numeric
+        type (one of GO_RESULT_TYPES), converting the int accumulator on return
+      - emit="helpers" renders sequential comprehensions as calls into the
+        generic helpers of pcs/backends/go/pcs_helpers.go instead of loops
+        (see _render_helper_calls), emit="iter" as lazy iter.Seq/iter.Seq2
+        iterators (see _render_iter), emit="chan" as values streamed over a
+        channel (see _render_chan); "loops" is the fast default
+      - parallel_style="errgroup" runs the workers in a
+        golang.org/x/sync/errgroup instead: the function takes a
+        context.Context, returns (result, error), stops on cancellation and
+        reports a panicking worker as an error; parallel_style="pool" takes
+        the number of workers as a parameter, each draining chunks from a
+        channel
+      - cancellable=True gives parallel functions a context.Context
+        parameter and an error result: workers stop soon after the context
+        is cancelled and its error is returned
+      - set_result="sorted" returns a set comprehension's elements as an
+        ascending []int, built through the set and sorted with slices.Sort
+      - dict_result="sorted" returns a dict comprehension's entries as
+        [][2]int key/value pairs in ascending key order
+      - sorted() around a comprehension returns an ascending []int: a list
+        built and then sorted, a set or a dict's keys as set_result="sorted"
+      - itertools.takewhile() breaks out of its clause's loop at the first
+        value failing it, and next() returns the first value from inside
+        the loops, then its default or a StopIteration panic
+      - A comment above the function records whether its result has an
+        order: none for a map, which Go iterates differently from run to
+        run, ascending for the sorted forms (see _order_note)
+      - number_type builds list and set elements, dict values and
+        sum/prod/max/min accumulators as another numeric type (one of
+        GO_RESULT_TYPES) instead of int; loop variables stay int and are
+        converted where the values are computed (see _number_expr), and a
+        reduction returns number_type unless result_type says otherwise
+      - overflow="panic", "saturate" or "big" computes a sum or prod in
+        int64 instead of int and checks every step, of the accumulator
+        and of each value's arithmetic, for overflow (see _checked_stmt and
+        _checked_value), which then panics, stops at the int64 bound or
+        continues in a *big.Int the function returns; "wrap" keeps int
+        arithmetic, which wraps silently, a 32-bit int soon
+      - return_error=True declares a sequential function as returning
+        (result, error): a panic at run time, such as a division by zero,
+        and an overflow="panic" check become its error (see _error_result).
+        Parallel functions return errors with parallel_style="errgroup"
+      - An optimizer pass fuses a generator over an inner list comprehension
+        or generator expression into one loop (see _fuse_sources), loops
+        over a range with stride m instead of testing `x % m == r` (see
+        _stride_filters) and hoists loop-invariant filters and expressions
+        out of inner loops (see _hoist_invariants); optimize=False turns it
+        off, to debug the loops as written
+      - fold="const" computes a reduction over constant ranges at generation
+        time and renders a function returning the value (see _fold_value),
+        under the build constraint !pcs_verify; fold="verify" renders the
+        loops as usual under pcs_verify, a file to keep next to it, so that
+        benchmarks can time the arithmetic apart from the generated loops
+      - doc, the Python expression the IR was parsed from, becomes the
+        function's doc comment (see _doc_comment)
+      - go_version, the oldest Go release the code has to build with, as
+        "1.21", rewrites the code with the slices and maps packages of that
+        release (see _for_go_version); None keeps it as rendered
+      - A generator over a str or bytes literal, or an input named in
+        input_types as a "string", "bytes", "arrow" or "parquet" (see
+        GO_INPUT_TYPES), loops over the string's runes, or the bytes or
+        the values of the Arrow column by index (see _typed_sources)
+      - chunking="auto" sizes a parallel function's chunks at run time from
+        the range's length and GOMAXPROCS, running short ranges on fewer
+        goroutines (see _adaptive_chunks); "even" splits every range over
+        all of them
+      - zero_alloc=True guarantees a reduction to one value allocates
+        nothing per call: the IR must be a sum/prod/max/min/any/all/next
+        rendered as sequential loops, and the code is rejected if it, or a
+        helper it calls, builds anything on the heap (see _check_zero_alloc)
+    """
+    ir = _with_take_while(ir)
+    if zero_alloc and (
+        not ir.reduce
+        or ir.reduce.kind not in _ZERO_ALLOC_REDUCTIONS
+        or parallel
+        or emit != "loops"
+        or overflow == "big"
+    ):
+        raise ValueError(
+            "zero_alloc needs a sum/prod/max/min/any/all/next reduction with "
+            "emit='loops', without parallel or overflow='big'"
+        )
+    if dict_result not in GO_DICT_RESULTS:
+        raise ValueError(f"Unknown Go dict result: {dict_result}")
+    if fold not in GO_FOLD_MODES:
+        raise ValueError(f"Unknown Go fold mode: {fold}")
+    if chunking not in GO_CHUNKINGS:
+        raise ValueError(f"Unknown Go chunking: {chunking}")
+    if chunking != "even" and not parallel:
+        raise ValueError(f"chunking={chunking!r} needs parallel=True")
+    version = _parse_go_version(go_version) if go_version else None
+    if version and version < (1, 23) and emit == "iter":
+        raise ValueError("emit='iter' needs Go 1.23 or later")
+    if fold != "off" and (
+        emit != "loops"
+        or cancellable
+        or return_error
+        or (result_type, number_type, overflow) != ("int", "int", "wrap")
+    ):
+        raise ValueError(
+            "fold needs emit='loops' and the plain signature: no result or number "
+            "type, overflow check, context or error result"
+        )
+    early = ir.reduce and ir.reduce.kind == "next"
+    if fold != "off" and (early or any(g.take_while for g in ir.generators)):
+        raise ValueError("fold does not cover takewhile() or next()")
+    if return_error and emit != "loops":
+        raise ValueError("return_error=True needs emit='loops'")
+    if return_error and parallel and parallel_style != "errgroup":
+        raise ValueError(
+            "return_error=True with parallel=True needs parallel_style='errgroup', "
+            "which returns worker panics as errors"
+        )
+    if any(t not in GO_INPUT_TYPES for t in (input_types or {}).values()):
+        raise ValueError(f"Unknown Go input types: {input_types}")
+    ir, consts, inputs, columns = _typed_sources(ir, func_name, input_types or {})
+    text = any(isinstance(g.source, _StringSource) for g in ir.generators)
+    text = text or bool(consts or inputs)
+    if text and (parallel or emit != "loops" or map_impl != "builtin"):
+        raise ValueError(
+            "Loops over strings, bytes and columns need emit='loops' and a builtin "
+            "map, without parallel"
+        )
+    if columns and fold != "off":
+        raise ValueError("Parquet columns are read at run time; fold needs ranges")
+    returns_element = not ir.reduce or ir.reduce.kind == "next"
+    if text and returns_element and re.match(r"string\(", ir.element or ""):
+        type_info = {**(type_info or {}), "element": "string"}
+    if optimize:
+        ir = _optimize(ir)
+    if fold != "off":
+        value = _fold_value(ir)
+        if fold == "const":
+            go_type = "bool" if isinstance(value, bool) else "int"
+            code = "\n".join(
+                [
+                    "//go:build !pcs_verify",
+                    "",
+                    f"// {func_name} returns the value its loops compute, folded at",
+                    "// generation time; build with -tags pcs_verify to run them.",
+                    f"func {func_name}() {go_type} {{",
+                    f"    return {str(value).lower()}",
+                    "}",
+                    "",
+                ]
+            )
+            return _doc_comment(code, func_name, doc)
+    if _is_sorted(ir):
+        if emit != "loops":
+            raise ValueError("sorted() needs emit='loops'")
+        if ir.kind == "dict":
+            ir = replace(
+                ir, kind="set", element=ir.key_expr, key_expr=None, val_expr=None
+            )
+        elif ir.kind == "generator":
+            ir = replace(ir, kind="list")
+        if ir.kind == "set":
+            set_result = "sorted"
+    code = _render_go(
+        ir,
+        func_name,
+        parallel,
+        type_info,
+        presize,
+        map_impl,
+        shard_merge,
+        result_type,
+        emit,
+        parallel_style,
+        cancellable,
+        set_result,
+        dict_result,
+        number_type,
+        overflow,
+        optimize,
+        contains=version is not None and version >= (1, 21),
+        empty=empty,
+    )
+    code += _division_helpers(code, func_name)
+    if chunking == "auto":
+        code = _adaptive_chunks(code)
+    # Reading a Parquet file may fail, so its error is returned
+    if return_error and not parallel or columns:
+        code = _error_result(code, func_name)
+    if version:
+        code = _for_go_version(code, version)
+    if text:
+        code = _source_declarations(code, func_name, consts, inputs, columns)
+    if zero_alloc:
+        _check_zero_alloc(code)
+    if fold == "verify":
+        code = "//go:build pcs_verify\n\n" + code
+    code = _order_note(code, ir, func_name, emit, set_result, dict_result)
+    return _doc_comment(code, func_name, doc)
+
+
+def _parse_go_version(go_version: str) -> tuple[int, int]:
+    """go_version, such as "1.21", as (1, 21)."""
+    m = re.fullmatch(r"1\.(\d+)", go_version)
+    if not m:
+        raise ValueError(f"Invalid Go version: {go_version!r}, expected 1.N")
+    return 1, int(m.group(1))
+
+
+def _for_go_version(code: str, version: tuple[int, int]) -> str:
+    """
+    code rewritten for Go version and later. Before 1.21, which added the
+    slices and maps packages, sorting goes through sort.Slice. From 1.21
+    maps.Copy merges the maps of parallel workers and slices.SortFunc orders
+    shards, from 1.22 slices.Concat joins their slices, and from 1.23 a
+    sorted set or dict is slices.Sorted(maps.Keys(result)). The import
+    block then lists the packages the code uses.
+    """
+    if version < (1, 21):
+        code = re.sub(
+            r"^(\s+)slices\.Sort\((\w+)\)$",
+            r"\1sort.Slice(\2, func(i, j int) bool { return \2[i] < \2[j] })",
+            code,
+            flags=re.M,
+        )
+    else:
+        code = re.sub(
+            r"^(\s+)for k, v := range (\w+) \{ result\[k\] = v \}$",
+            r"\1maps.Copy(result, \2)",
+            code,
+            flags=re.M,
+        )
+        code = re.sub(
+            r"^(\s+)for v := range (\w+) \{ result\[v\] = struct\{\}\{\} \}$",
+            r"\1maps.Copy(result, \2)",
+            code,
+            flags=re.M,
+        )
+        shards = re.search(r"shards := make\(\[\](\S+), ", code)
+        if shards:
+            code = code.replace(
+                "sort.Slice(shards, func(i, j int) bool "
+                "{ return len(shards[i]) > len(shards[j]) })",
+                f"slices.SortFunc(shards, func(a, b {shards.group(1)}) int "
+                "{ return len(b) - len(a) })",
+            )
+    if version >= (1, 22):
+        code = re.sub(
+            r"^    n := 0\n"
+            r"    for _, part := range partials \{ n \+= len\(part\) \}\n"
+            r"    result := make\(\[\]\w+, 0, n\)\n"
+            r"    for _, part := range partials \{\n"
+            r"        result = append\(result, part\.\.\.\)\n"
+            r"    \}$",
+            "    result := slices.Concat(partials...)",
+            code,
+            flags=re.M,
+        )
+    if version >= (1, 23):
+        code = re.sub(
+            r"^    (values|keys) := make\(\[\]\w+, 0, len\(result\)\)\n"
+            r"    for (v|k) := range result \{ \1 = append\(\1, \2\) \}\n"
+            r"    slices\.Sort\(\1\)$",
+            r"    \1 := slices.Sorted(maps.Keys(result))",
+            code,
+            flags=re.M,
+        )
+    return _fix_imports(code, ("maps", "slices", "sort"))
+
+
+def _fix_imports(code: str, packages: tuple[str, ...]) -> str:
+    """
+    code with its import block, added if need be, listing each of packages
+    just when code calls into it.
+    """
+    m = _IMPORT_BLOCK.search(code)
+    imports = set(re.findall(r'"([^"]+)"', m.group(1))) if m else set()
+    start, end = (m.start(), m.end()) if m else (0, 0)
+    for package in packages:
+        imports.discard(package)
+        if re.search(rf"\b{package.rsplit('/', 1)[-1]}\.", code[end:]):
+            imports.add(package)
+    block = "".join(f'    "{imp}"\n' for imp in sorted(imports))
+    if block:
+        block = f"import (\n{block})\n\n"
+    return code[:start] + block + code[end:]
+
+
+def _source_declarations(
+    code: str,
+    func_name: str,
+    consts: list[str],
+    inputs: dict[str, str],
+    columns: list[str],
+) -> str:
+    """
+    code of _typed_sources' ir with the const bytes literals declared above
+    func_name, its parameters typed by inputs, the Parquet columns read
+    first thing (see _parquet_reader), code returning an error already, and
+    the packages all these need imported.
+    """
+    if any(t != "[]int" for t in inputs.values()):
+        params = ", ".join(f"{name} {t}" for name, t in inputs.items())
+        code = re.sub(
+            rf"^func {re.escape(func_name)}\([^)]*\)",
+            lambda m: f"func {func_name}({params})",
+            code,
+            count=1,
+            flags=re.M,
+        )
+    if consts:
+        code = re.sub(
+            rf"^func {re.escape(func_name)}\(",
+            lambda m: "\n".join(consts) + "\n\n" + m.group(0),
+            code,
+            count=1,
+            flags=re.M,
+        )
+    if columns:
+        signature = rf"^func {re.escape(func_name)}\(.*\) \(_ (.+), err"
+        zero = _zero_value(re.search(signature, code, re.M).group(1))
+        reads = []
+        for name in columns:
+            reads += [
+                f'    {name}, err := {func_name}ReadColumn({name}Path, "{name}")',
+                "    if err != nil {",
+                f"        return {zero}, err",
+                "    }",
+                f"    defer {name}.Release()",
+            ]
+        # After the deferred recover of _error_result
+        code = code.replace("    }()\n", "    }()\n" + "\n".join(reads) + "\n", 1)
+        code = code.rstrip("\n") + "\n\n" + _parquet_reader(func_name)
+    packages = ("unicode", "context", "fmt", "os")
+    packages += tuple(
+        f"{_ARROW_MODULE}/{p}"
+        for p in (
+            "arrow",
+            "arrow/array",
+            "arrow/memory",
+            "parquet/file",
+            "parquet/pqarrow",
+        )
+    )
+    return _fix_imports(code, packages)
+
+
+def _zero_value(go_type: str) -> str:
+    """The zero value of go_type, as a return statement writes it."""
+    if go_type == "bool":
+        return "false"
+    if go_type == "string":
+        return '""'
+    if go_type.startswith(("[]", "map[", "*", "chan ", "func(")):
+        return "nil"
+    return "0"
+
+
+def _parquet_reader(func_name: str) -> str:
+    """
+    The function reading a Parquet input of func_name: the int64 column of
+    a file, its row groups concatenated into one Arrow array.
+    """
+    name = f"{func_name}ReadColumn"
+    lines = [
+        f"// {name} reads the int64 column named column of the Parquet file at",
+        "// path into one Arrow array.",
+        f"func {name}(path, column string) (*array.Int64, error) {{",
+        "    f, err := os.Open(path)",
+        "    if err != nil {",
+        "        return nil, err",
+        "    }",
+        "    defer f.Close()",
+        "    pf, err := file.NewParquetReader(f)",
+        "    if err != nil {",
+        "        return nil, err",
+        "    }",
+        "    defer pf.Close()",
+        "    index := pf.MetaData().Schema.ColumnIndexByName(column)",
+        "    if index < 0 {",
+        '        return nil, fmt.Errorf("%s: no column %q", path, column)',
+        "    }",
+        "    reader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, "
+        "memory.DefaultAllocator)",
+        "    if err != nil {",
+        "        return nil, err",
+        "    }",
+        "    values, err := reader.GetColumn(context.Background(), index)",
+        "    if err != nil {",
+        "        return nil, err",
+        "    }",
+        "    chunked, err := values.NextBatch(pf.NumRows())",
+        "    if err != nil {",
+        "        return nil, err",
+        "    }",
+        "    defer chunked.Release()",
+        "    if chunked.DataType().ID() != arrow.INT64 {",
+        '        return nil, fmt.Errorf("%s: column %q is %s, not int64", '
+        "path, column, chunked.DataType())",
+        "    }",
+        "    merged, err := array.Concatenate(chunked.Chunks(), "
+        "memory.DefaultAllocator)",
+        "    if err != nil {",
+        "        return nil, err",
+        "    }",
+        "    return merged.(*array.Int64), nil",
+        "}",
+    ]
+    return "\n".join(lines) + "\n"
+
+
+def _doc_comment(code: str, func_name: str, doc: str | None) -> str:
+    """
+    code with a doc comment on func_name naming doc, the Python expression
+    it computes, as a gofmt code block; a comment already above the
+    declaration (see _order_note) follows as a paragraph of its own.
+    """
+    if not doc:
+        return code
+    block = [f"// {func_name} is generated from the Python expression", "//"]
+    block += [f"//\t{line}" for line in doc.strip().splitlines()]
+    m = re.search(
+        rf"^((?://.*\n)*)func {re.escape(func_name)}\(", code, flags=re.M
+    )
+    if not m:
+        return code
+    if m.group(1):
+        block.append("//")
+    return code[: m.start()] + "\n".join(block) + "\n" + code[m.start() :]
+
+
+def _fold_value(ir: IRComp) -> int | bool:
+    """
+    The value of the sum/prod/max/min/any/all reduction ir, computed the
+    way its Go loops would. Every generator loops over a constant range,
+    and the element and filters are int arithmetic and comparisons of the
+    loop variables; where Go's int could disagree with Python's, the value
+    is refused: a value outside int64, a % of a negative operand, a shift by
+    a negative count or 64 and more. A sum of a polynomial, over one range
+    and without filters, is summed in closed form (see _closed_sum), where
+    only the result has to fit, since + - and * wrap consistently; anything
+    else is evaluated value by value, up to _FOLD_LIMIT of them.
+    """
+    kind = ir.reduce.kind if ir.reduce else None
+    if kind not in ("sum", "prod", "max", "min", "any", "all"):
+        raise ValueError("Go folds sum/prod/max/min/any/all reductions only")
+    variables = [g.var for g in ir.generators]
+    arithmetic = (ast.BinOp, ast.UnaryOp, ast.Constant, ast.Name)
+    logic = (ast.Compare, ast.BoolOp, ast.cmpop, ast.boolop, ast.Not)
+    ops = (ast.Add, ast.Sub, ast.Mult, ast.Mod, ast.BitAnd, ast.BitOr, ast.BitXor)
+    ops += (ast.LShift, ast.RShift, ast.USub, ast.UAdd, ast.Load)
+
+    def parse(expr: str, allowed: tuple, level: int) -> ast.Expression:
+        tree = ast.parse(expr, mode="eval")
+        for node in ast.walk(tree.body):
+            if not (
+                isinstance(node, allowed + ops)
+                and (not isinstance(node, ast.Name) or node.id in variables[:level])
+                and (not isinstance(node, ast.Constant) or type(node.value) is int)
+            ):
+                raise ValueError(
+                    f"Go folds int arithmetic of the loop variables only: {expr}"
+                )
+        return tree
+
+    # The bounds of a range, and a generator's filters, read the variables
+    # of the generators before it; the variables after are passed as 0
+    ranges = []
+    for i, gen in enumerate(ir.generators):
+        bounds = _loop_bounds(gen) if gen.var.isidentifier() else None
+        if not (bounds and type(bounds[2]) is int):
+            raise ValueError(
+                f"Go folds loops over ranges with a constant step only: {gen.source}"
+            )
+        ranges.append(
+            [
+                (
+                    b
+                    if type(b) is int
+                    else _fold_function(parse(b, arithmetic, i), variables)
+                )
+                for b in bounds
+            ]
+        )
+    # any/all render their element as is, so it takes no and/or/not
+    conditions = (ast.Compare, ast.cmpop) if kind in ("any", "all") else ()
+    element = parse(ir.element, arithmetic + conditions, len(variables))
+    filters = [
+        (i, _fold_function(parse(f, arithmetic + logic, i + 1), variables))
+        for i, gen in enumerate(ir.generators)
+        for f in gen.filters
+    ]
+    initial = None
+    if ir.reduce.initial is not None:
+        initial = const_int(ast.parse(ir.reduce.initial, mode="eval").body)
+        if initial is None:
+            raise ValueError(f"Go folds from an int literal start only: {ir.reduce.initial}")
+    constant = all(type(b) is int for bounds in ranges for b in bounds)
+    if kind == "sum" and constant and len(ranges) == 1 and not filters:
+        value = _closed_sum(element, variables[0], range(*ranges[0]))
+        if value is not None:
+            return _fold_check(value + (initial or 0))
+    too_many = ValueError(
+        f"Go folds at most {_FOLD_LIMIT} values one by one, or a sum of a "
+        "polynomial over one constant range without filters in closed form"
+    )
+    if constant and math.prod(len(range(*r)) for r in ranges) > _FOLD_LIMIT:
+        raise too_many
+    element_fn = _fold_function(element, variables)
+    count = 0
+
+    def values(prefix: tuple, level: int):
+        nonlocal count
+        if level == len(ranges):
+            count += 1
+            if count > _FOLD_LIMIT:
+                raise too_many
+            yield element_fn(*prefix)
+            return
+        padded = prefix + (0,) * (len(ranges) - level)
+        bounds = [b if type(b) is int else b(*padded) for b in ranges[level]]
+        for x in range(*bounds):
+            env = prefix + (x,) + (0,) * (len(ranges) - level - 1)
+            if all(fn(*env) for i, fn in filters if i == level):
+                yield from values(prefix + (x,), level + 1)
+
+    if kind == "any":
+        return any(values((), 0))
+    if kind == "all":
+        return all(values((), 0))
+    acc = {"sum": 0, "prod": 1}.get(kind) if initial is None else initial
+    seen = False
+    for v in values((), 0):
+        if kind == "sum":
+            acc = _fold_check(acc + v)
+        elif kind == "prod":
+            acc = _fold_check(acc * v)
+        elif not seen:
+            acc = v
+        else:
+            acc = max(acc, v) if kind == "max" else min(acc, v)
+        seen = True
+    if acc is None:
+        raise ValueError(f"{kind}() of no values has no value to fold")
+    return acc
+
+
+def _fold_check(value: int) -> int:
+    """value, unless Go's int64 cannot hold it."""
+    if not -(2**63) <= value < 2**63:
+        raise ValueError(f"Go folds values within int64 only, not {value}")
+    return value
+
+
+def _fold_binop(op: str, left: int, right: int) -> int:
+    """left op right, op an ast operator's name, refused where Go differs."""
+    if op == "Mod" and (left < 0 or right <= 0):
+        raise ValueError(f"Go's % differs from Python's for {left} % {right}")
+    if op in ("LShift", "RShift") and not 0 <= right < 64:
+        raise ValueError(f"Go folds shifts by 0 to 63 only, not {right}")
+    return _fold_check(_FOLD_OPERATORS[op](left, right))
+
+
+_FOLD_OPERATORS = {
+    "Add": operator.add,
+    "Sub": operator.sub,
+    "Mult": operator.mul,
+    "Mod": operator.mod,
+    "BitAnd": operator.and_,
+    "BitOr": operator.or_,
+    "BitXor": operator.xor,
+    "LShift": operator.lshift,
+    "RShift": operator.rshift,
+}
+
+
+def _fold_function(tree: ast.Expression, variables: list[str]):
+    """
+    tree as a Python function of the loop variables, each int it computes
+    going through _fold_binop or _fold_check.
+    """
+
+    class Checked(ast.NodeTransformer):
+        def visit_BinOp(self, node: ast.BinOp) -> ast.expr:
+            self.generic_visit(node)
+            op = ast.Constant(type(node.op).__name__)
+            return ast.Call(
+                ast.Name("_fold_binop", ast.Load()), [op, node.left, node.right], []
+            )
+
+        def visit_UnaryOp(self, node: ast.UnaryOp) -> ast.expr:
+            self.generic_visit(node)
+            if isinstance(node.op, ast.Not):
+                return node
+            return ast.Call(ast.Name("_fold_check", ast.Load()), [node], [])
+
+    body = Checked().visit(ast.parse(ast.unparse(tree), mode="eval")).body
+    params = ast.arguments([], [ast.arg(v) for v in variables], None, [], [], None, [])
+    code = ast.fix_missing_locations(ast.Expression(ast.Lambda(params, body)))
+    scope = {"_fold_binop": _fold_binop, "_fold_check": _fold_check}
+    return eval(compile(code, "<fold>", "eval"), scope)
+
+
+def _closed_sum(tree: ast.Expression, var: str, values: range) -> int | None:
+    """
+    The sum of the polynomial tree in var over values, from its first
+    differences: a polynomial q of degree d sums over k = 0 .. n-1 to
+    q(0) C(n, 1) + dq(0) C(n, 2) + ... + d^d q(0) C(n, d+1), with dq the
+    forward difference q(k+1) - q(k). None when tree is no polynomial.
+    """
+    polynomial = (ast.Constant, ast.Name, ast.Load, ast.BinOp, ast.UnaryOp)
+    polynomial += (ast.Add, ast.Sub, ast.Mult, ast.USub, ast.UAdd)
+    nodes = list(ast.walk(tree.body))
+    if not all(isinstance(n, polynomial) for n in nodes):
+        return None
+    # Each occurrence of var raises the degree by at most one
+    degree = sum(isinstance(n, ast.Name) for n in nodes)
+    q = compile(tree, "<fold>", "eval")
+    terms = [
+        eval(q, {}, {var: values.start + values.step * k})
+        for k in range(degree + 1)
+    ]
+    total = 0
+    for j in range(degree + 1):
+        total += terms[0] * math.comb(len(values), j + 1)
+        terms = [b - a for a, b in zip(terms, terms[1:])]
+    return total
+
+
+def _order_note(
+    code: str,
+    ir: IRComp,
+    func_name: str,
+    emit: str,
+    set_result: str,
+    dict_result: str,
 ) -> str:
     """
-    Go backend with goroutines parallel support:
-      list -> []int
-      set  -> map[int]struct{}
-      dict -> map[int]int
-      reductions: sum/max/min -> int, any/all -> bool
-    Notes:
-      - Uses goroutines and channels for parallel processing
-      - Type-safe with compile-time guarantees
-      - Loop-based implementation for performance
+    code with a comment above func_name's declaration saying whether the
+    order of its result is guaranteed. Maps, which Go iterates in a
+    different order from run to run, have none; a sorted set, list or dict
+    result is ascending. Lists otherwise keep Python's order, iterators and
+    channels yield in it and reductions have no order, so they get no
+    comment.
+    """
+    if ir.reduce or emit in ("iter", "chan"):
+        return code
+    sorted_set = ir.kind == "set" and set_result == "sorted"
+    if sorted_set or ir.kind == "list" and _is_sorted(ir):
+        note = "returns its values in ascending order."
+    elif ir.kind == "dict" and dict_result == "sorted":
+        note = "returns its key/value pairs in ascending key order."
+    elif ir.kind in ("set", "dict"):
+        note = "returns a map; Go iterates maps in no fixed order."
+    else:
+        return code
+    return re.sub(
+        rf"^func {re.escape(func_name)}\(",
+        lambda m: f"// {func_name} {note}\n{m.group(0)}",
+        code,
+        count=1,
+        flags=re.M,
+    )
+
+
+def _error_result(code: str, func_name: str) -> str:
+    """
+    code with func_name returning (result, error) instead of its result: a
+    deferred recover turns a panic while it runs into its error, and an
+    overflow check of _checked_stmt returns one rather than panicking.
+    Every return of a result returns a nil error next to it.
+    """
+    lines = code.split("\n")
+    start = next(
+        i for i, line in enumerate(lines) if line.startswith(f"func {func_name}(")
+    )
+    end = lines.index("}", start)
+    signature, result = re.fullmatch(r"(func .*\)) (.+) \{", lines[start]).groups()
+    imports = {"fmt"}
+    body = [
+        "    defer func() {",
+        "        if r := recover(); r != nil {",
+        f'            err = fmt.Errorf("{func_name}: %v", r)',
+        "        }",
+        "    }()",
+    ]
+    for line in lines[start + 1 : end]:
+        m = re.fullmatch(r'(\s+)panic\(("[^"]+ overflows int64")\)', line)
+        if m:
+            imports.add("errors")
+            line = f"{m.group(1)}return 0, errors.New({m.group(2)})"
+        body.append(re.sub(r"^(\s+return [^,]+)$", r"\1, nil", line))
+    lines[start : end] = [f"{signature} (_ {result}, err error) {{"] + body
+    m = _IMPORT_BLOCK.search("\n".join(lines))
+    if m:
+        imports.update(re.findall(r'"([^"]+)"', m.group(1)))
+        lines = "\n".join(lines).replace(m.group(0), "", 1).split("\n")
+    block = ["import ("] + [f'    "{imp}"' for imp in sorted(imports)] + [")", ""]
+    return "\n".join(block + lines)
+
+
+def _render_go(
+    ir: IRComp,
+    func_name: str,
+    parallel: bool,
+    type_info,
+    presize: bool,
+    map_impl: str,
+    shard_merge: str,
+    result_type: str,
+    emit: str,
+    parallel_style: str,
+    cancellable: bool,
+    set_result: str,
+    dict_result: str,
+    number_type: str,
+    overflow: str,
+    optimize: bool,
+    contains: bool = False,
+    empty: str = "zero",
+) -> str:
+    """
+    render_go without the comment on the order of the result, contains
+    writing membership tests as slices.Contains (see _go_cond).
     """
+    if map_impl not in GO_MAP_IMPLS:
+        raise ValueError(f"Unknown Go map implementation: {map_impl}")
+    if shard_merge not in SHARD_MERGE_STRATEGIES:
+        raise ValueError(f"Unknown Go shard merge strategy: {shard_merge}")
+    if result_type not in GO_RESULT_TYPES:
+        raise ValueError(f"Unknown Go result type: {result_type}")
+    if result_type != "int" and not (
+        ir.reduce and ir.reduce.kind in ("sum", "prod", "max", "min")
+    ):
+        raise ValueError("A Go result type applies to sum/prod/max/min reductions only")
+    if emit not in GO_EMIT_STYLES:
+        raise ValueError(f"Unknown Go emission style: {emit}")
+    if emit != "loops" and parallel:
+        raise ValueError(f"emit={emit!r} has no parallel form; use emit='loops'")
+    if parallel_style not in GO_PARALLEL_STYLES:
+        raise ValueError(f"Unknown Go parallel style: {parallel_style}")
+    if parallel_style != "waitgroup" and not parallel:
+        raise ValueError(f"parallel_style={parallel_style!r} needs parallel=True")
+    if cancellable and not parallel:
+        raise ValueError("cancellable=True needs parallel=True")
+    if set_result not in GO_SET_RESULTS:
+        raise ValueError(f"Unknown Go set result: {set_result}")
+    if set_result != "map" and (ir.kind != "set" or ir.reduce or emit != "loops"):
+        raise ValueError(
+            f"set_result={set_result!r} applies to set comprehensions with emit='loops'"
+        )
+    if dict_result != "map" and (
+        ir.kind != "dict"
+        or ir.reduce
+        or emit != "loops"
+        or map_impl != "builtin"
+        or parallel and shard_merge == "wrap"
+    ):
+        raise ValueError(
+            f"dict_result={dict_result!r} applies to dict comprehensions with "
+            "emit='loops' into a builtin map, merged when parallel"
+        )
+    if number_type not in GO_RESULT_TYPES:
+        raise ValueError(f"Unknown Go number type: {number_type}")
+    if not number_type.startswith("float") and _makes_floats(ir):
+        raise ValueError(
+            "/ and float literals make float values, which Go's "
+            f"{number_type} cannot hold: render with number_type='float64' "
+            "(--go-number-type float64)"
+        )
+    if number_type != "int":
+        if emit != "loops" or map_impl != "builtin":
+            raise ValueError(
+                f"number_type={number_type!r} needs emit='loops' and a builtin map"
+            )
+        if ir.reduce and ir.reduce.kind in ("any", "all"):
+            raise ValueError("A Go number type does not apply to any/all reductions")
+    if ir.reduce and ir.reduce.kind == "join":
+        if parallel or emit != "loops" or number_type != "int":
+            raise ValueError(
+                "str.join() needs emit='loops', without parallel or a number type"
+            )
+    if overflow not in GO_OVERFLOW_MODES:
+        raise ValueError(f"Unknown Go overflow mode: {overflow}")
+    if empty not in GO_EMPTY_MODES:
+        raise ValueError(f"Unknown Go empty reduction: {empty}")
+    if empty != "zero" and not (ir.reduce and ir.reduce.kind in ("max", "min")):
+        raise ValueError(f"empty={empty!r} applies to max/min reductions")
+    seeded = ir.reduce and ir.reduce.kind != "next" and ir.reduce.initial is not None
+    if emit == "helpers" and (seeded or empty != "zero"):
+        raise ValueError(
+            "A start, default= or empty='panic' needs emit other than 'helpers', "
+            "whose Sum/Max/Min start from 0"
+        )
+    if overflow != "wrap":
+        if not (ir.reduce and ir.reduce.kind in ("sum", "prod")) or emit != "loops":
+            raise ValueError(
+                f"overflow={overflow!r} applies to sum/prod reductions "
+                "with emit='loops'"
+            )
+        if result_type != "int" or number_type != "int":
+            raise ValueError(
+                f"overflow={overflow!r} needs result_type and number_type int"
+            )
+        if parallel and overflow == "big":
+            raise ValueError("overflow='big' has no parallel form")
+
+    ir = _int_division(_unpack_sources(ir), func_name)
+    _check_tuple_values(ir)
+    exprs = [ir.element, ir.key_expr, ir.val_expr] + [
+        e for g in ir.generators for e in [*g.filters, *g.take_while]
+    ]
+    if overflow != "wrap" and any(
+        e and re.search(rf"\b{func_name}(FloorDiv|Mod)\(", e) for e in exprs
+    ):
+        # The helpers take and return int, where the checked values are int64
+        raise ValueError(
+            f"overflow={overflow!r} does not check // or the % of values that "
+            "may be negative, which Python floors"
+        )
+    for gen in ir.generators:
+        if _comprehension_source(gen):
+            raise ValueError(
+                "Go loops over a list comprehension or generator expression only "
+                f"when optimize=True fuses it: {gen.source}"
+            )
+    # takewhile() and next() leave the loops early, which only the sequential
+    # loops rendered below do
+    early = (ir.reduce and ir.reduce.kind == "next") or any(
+        g.take_while for g in ir.generators
+    )
+    if early and (
+        parallel
+        or emit != "loops"
+        or ir.kind == "dict" and map_impl == "sync"
+        or number_type != "int"
+    ):
+        raise ValueError(
+            "takewhile() and next() need emit='loops' and number_type='int', "
+            "without parallel or a sync map"
+        )
+    grouped = _grouped_aggregate(ir)
+    if (
+        grouped
+        and not early
+        and emit == "loops"
+        and not parallel
+        and map_impl == "builtin"
+        and dict_result == "map"
+    ):
+        return _render_grouped(ir, func_name, *grouped, presize, number_type)
+    # Reductions over inner comprehensions become helper functions
+    helpers: dict[str, str] = {}
+    lowered = replace(
+        ir,
+        generators=[
+            replace(
+                g,
+                filters=[_lower_nested(f, func_name, helpers) for f in g.filters],
+                take_while=[
+                    _lower_nested(c, func_name, helpers) for c in g.take_while
+                ],
+            )
+            for g in ir.generators
+        ],
+        element=_lower_nested(ir.element, func_name, helpers),
+        key_expr=_lower_nested(ir.key_expr, func_name, helpers),
+        val_expr=_lower_nested(ir.val_expr, func_name, helpers),
+    )
+    if helpers:
+        element_type = _expr_type(lowered.element, helpers)
+        value_type = _expr_type(lowered.val_expr, helpers)
+        if ir.kind == "set" and element_type != "int" or ir.reduce and (
+            element_type != "int" or value_type != "int"
+        ):
+            raise ValueError("Go sets and reductions cannot hold collections")
+        if _expr_type(lowered.key_expr, helpers) != "int":
+            raise ValueError("Go map keys cannot be collections")
+        if number_type != "int":
+            raise ValueError("Nested comprehensions need number_type='int'")
+        if overflow != "wrap":
+            raise ValueError("Nested comprehensions need overflow='wrap'")
+        code = _render_go(
+            lowered,
+            func_name,
+            parallel,
+            {"element": element_type, "value": value_type, "helpers": helpers},
+            presize,
+            map_impl,
+            shard_merge,
+            result_type,
+            emit,
+            parallel_style,
+            cancellable,
+            set_result,
+            dict_result,
+            number_type,
+            overflow,
+            optimize,
+            contains,
+            empty,
+        )
+        return code + "".join("\n" + h for h in helpers.values())
+
+    use_swiss = (
+        map_impl == "swiss"
+        and ir.kind == "dict"
+        and not ir.reduce
+        and not parallel
+        and emit == "loops"
+    )
+    # Sharded and sync.Map dicts loop on their own, without hoisting
+    lets: dict[str, list[str]] = {}
+    own_loops = ir.kind == "dict" and not ir.reduce and (parallel or map_impl == "sync")
+    # A joined value is written piece by piece, so none is computed ahead
+    join = ir.reduce is not None and ir.reduce.kind == "join"
+    if optimize and emit == "loops" and not own_loops and not join:
+        ir, lets = _hoist_invariants(ir)
+    ir = _go_filters(ir, (type_info or {}).get("helpers"), contains)
+    element_type = (type_info or {}).get("element", "int")
+    value_type = (type_info or {}).get("value", "int")
+    if element_type != "int" or value_type != "int":
+        if use_swiss or emit != "loops":
+            raise ValueError(
+                "Nested collections need emit='loops' and a builtin or sync map"
+            )
+    tuple_key = None
+    if ir.kind == "dict" and not ir.reduce:
+        tuple_key = _tuple_key(ir.key_expr)
+    elif ir.kind == "set" and not ir.reduce:
+        # A set of tuples holds them as keys of the same struct type
+        tuple_key = _tuple_key(ir.element)
+        if tuple_key and (set_result != "map" or emit != "loops"):
+            raise ValueError("Tuple set elements need emit='loops' and a map result")
+    if tuple_key and (use_swiss or emit != "loops"):
+        raise ValueError("Tuple dict keys need emit='loops' and a builtin or sync map")
+    if number_type != "int":
+        if ir.kind == "set" and tuple_key:
+            raise ValueError("Tuple set elements need number_type='int'")
+        # Values and accumulators take number_type; keys stay int
+        element_type = value_type = number_type
+        var = ir.generators[0].var
+        if ir.kind == "dict":
+            ir = replace(ir, val_expr=_number_expr(ir.val_expr or var, number_type))
+        else:
+            ir = replace(ir, element=_number_expr(ir.element or var, number_type))
+    if overflow != "wrap":
+        # The values too are computed in int64, as they may overflow an int
+        var = ir.generators[0].var
+        if ir.kind == "dict":
+            ir = replace(ir, val_expr=_int64_expr(ir.val_expr or var))
+        else:
+            ir = replace(ir, element=_int64_expr(ir.element or var))
+    if dict_result == "sorted" and (tuple_key or value_type != "int"):
+        raise ValueError("dict_result='sorted' needs int keys and values")
+    if _is_sorted(ir) and element_type not in GO_RESULT_TYPES:
+        raise ValueError("sorted() needs numeric elements")
 
     # Determine return type
     if ir.reduce:
         k = ir.reduce.kind
-        if k in ("sum", "prod", "max", "min"):
-            return_type = "int"
+        if overflow == "big":
+            return_type = "*big.Int"
+        elif overflow != "wrap":
+            return_type = "int64"
+        elif k in ("sum", "prod", "max", "min"):
+            return_type = number_type if result_type == "int" else result_type
         elif k in ("any", "all"):
             return_type = "bool"
+        elif k == "join":
+            return_type = "string"
+        elif k == "next":
+            return_type = element_type
         else:
             return_type = "int"
     else:
         if ir.kind == "list":
-            return_type = "[]int"
+            return_type = f"[]{element_type}"
+        elif ir.kind == "set" and tuple_key:
+            return_type = f"map[{tuple_key[0]}]struct{{}}"
+        elif ir.kind == "set" and set_result == "sorted":
+            return_type = f"[]{element_type}"
         elif ir.kind == "set":
-            return_type = "map[int]struct{}"
+            return_type = f"map[{element_type}]struct{{}}"
+        elif ir.kind == "dict" and tuple_key:
+            return_type = f"map[{tuple_key[0]}]{value_type}"
+        elif ir.kind == "dict" and dict_result == "sorted":
+            return_type = "[][2]int"
         elif ir.kind == "dict":
-            return_type = "map[int]int"
+            return_type = "*swissMap" if use_swiss else f"map[int]{value_type}"
         else:
             return_type = "[]int"
 
+    if emit == "helpers":
+        return _render_helper_calls(ir, func_name, return_type, result_type)
+    if emit == "iter":
+        return _render_iter(ir, func_name, return_type, result_type, empty)
+    if emit == "chan":
+        return _render_chan(ir, func_name, return_type, result_type, empty)
+
     # Build the function
     lines = []
 
+    if use_swiss:
+        lines.append("// Requires pcs_swiss.go (pcs/backends/go) in the same package.")
+
     # Add imports if needed
     if parallel:
         lines.append("import (")
@@ -49,202 +3818,1682 @@ def render_go(
         lines.append('    "sync"')
         lines.append(")")
         lines.append("")
+    else:
+        imports = set()
+        if set_result == "sorted" or dict_result == "sorted" or _is_sorted(ir):
+            imports.add("slices")
+        if overflow != "wrap":
+            imports.add("math")
+        if overflow == "big":
+            imports.add("math/big")
+        if join:
+            writes, size = _join_writes(ir.element, _int_widths(ir))
+            imports.add("strings")
+            if any("strconv." in w for w in writes):
+                imports.add("strconv")
+        if imports:
+            lines.append("import (")
+            lines += [f'    "{imp}"' for imp in sorted(imports)]
+            lines.append(")")
+            lines.append("")
 
-    # Function signature
-    lines.append(f"func {func_name}() {return_type} {{")
+    if tuple_key:
+        lines += tuple_key[1]
 
-    # Handle single generator case (most common)
-    if len(ir.generators) == 1:
-        gen = ir.generators[0]
-        var = gen.var
+    # Function signature: the input slices iterated are its parameters
+    inputs = _input_params(ir)
+    lines.append(f"func {func_name}({_signature_params(inputs)}) {return_type} {{")
+
+    gen = ir.generators[0]
+    var = gen.var
+    data = _input_slice(gen)
+    text = gen.source if isinstance(gen.source, _StringSource) else None
+    bounds = _loop_bounds(gen)
+    if text:
+        # A string has at most as many runes as bytes
+        bounds = 0, text.length if text.length is not None else f"len({text.expr})", 1
+    elif bounds is None:
+        # Fallback for other sources
+        bounds = 0, 1000, 1
+    start, stop, step = bounds
+    constant = all(type(b) is int for b in bounds) and not data
+    if parallel and not constant:
+        raise ValueError(f"Parallel Go needs a constant outer range: {gen.source}")
+    hint = None
+    # A loop cut short by takewhile() may fill a fraction of its range
+    if any(g.take_while for g in ir.generators):
+        presize = False
+    if presize and constant and len(ir.generators) == 1:
+        hint = _size_hint(gen, start, stop, step)
+    elif presize and constant:
+        hint = _nested_size_hint(ir.generators)
+    elif presize and (data or text) and len(ir.generators) == 1 and not gen.filters:
+        hint = f"len({data or text.expr})"
+
+    if map_impl == "sync" and ir.kind == "dict" and not ir.reduce:
+        return _render_sync_map(
+            ir,
+            func_name,
+            start,
+            stop,
+            step,
+            parallel,
+            parallel_style,
+            cancellable,
+        )
+
+    if parallel and ir.kind == "dict" and not ir.reduce:
+        return _render_sharded_dict(
+            ir,
+            func_name,
+            start,
+            stop,
+            step,
+            hint,
+            shard_merge,
+            parallel_style,
+            cancellable,
+            value_type,
+            dict_result,
+        )
+
+    if parallel:
+        return _render_parallel(
+            ir,
+            func_name,
+            start,
+            stop,
+            step,
+            return_type,
+            result_type,
+            parallel_style,
+            cancellable,
+            set_result,
+            element_type,
+            overflow,
+            lets,
+            empty,
+        )
+
+    # Sequential implementation: the first for-clause's loop, its takewhile()
+    # conditions and filters, then a nested loop for every further clause
+    # around stmts
+    def loops(stmts: list[str]) -> list[str]:
+        inner = lets.get(gen.var, []) + _inner_loops(ir.generators[1:], stmts, lets)
+        nest = [f"    {_loop_clause(gen, inner)} {{"]
+        for cond in gen.take_while:
+            nest.append(f"        if !({cond}) {{ break }}")
+        for filter_expr in gen.filters:
+            nest.append(f"        if !({filter_expr}) {{ continue }}")
+        nest += [f"        {s}" for s in inner]
+        return nest + ["    }"]
 
-        # Get range bounds
-        if hasattr(gen.source, "start") and hasattr(gen.source, "stop"):
-            start, stop, step = gen.source.start, gen.source.stop, gen.source.step
+    if ir.reduce and overflow != "wrap":
+        k = ir.reduce.kind
+        expr = ir.val_expr if ir.kind == "dict" else ir.element
+        lines.append(f"    acc := {_reduce_initial(ir.reduce, 'int64')}")
+        if overflow == "big":
+            lines.append("    var total *big.Int")
+        body, checked_ops = _checked_value(overflow, k, func_name, expr)
+        lines += loops(body + _checked_stmt(overflow, k, func_name, "v"))
+        if overflow == "big":
+            lines.append("    if total != nil {")
+            lines.append("        return total")
+            lines.append("    }")
+            lines.append("    return big.NewInt(acc)")
+        else:
+            lines.append("    return acc")
+        lines.append("}")
+        checked_ops.add("Add" if k == "sum" else "Mul")
+        return "\n".join(lines) + "\n\n" + _checked_helpers(checked_ops, func_name)
+    elif join:
+        sep = ir.reduce.op or ""
+        lines.append("    var result strings.Builder")
+        # Every value takes at most size bytes and the separator before it
+        size += len(sep.encode())
+        if hint and size:
+            grow = hint * size if type(hint) is int else f"{hint} * {size}"
+            lines.append(f"    result.Grow({grow})")
+        if "strconv" in imports:
+            lines.append(f"    var digits [{_INT_DIGITS}]byte")
+        if sep:
+            lines.append("    first := true")
+            writes = [
+                f"if !first {{ result.WriteString({_go_string(sep)}) }}",
+                "first = false",
+            ] + writes
+        lines += loops(writes)
+        lines.append("    return result.String()")
+    elif ir.reduce and ir.reduce.kind == "next":
+        # The first value returns from inside the loops; after them there is
+        # the default, or else the StopIteration Python raises
+        lines += loops([f"return {ir.element}"])
+        default = ir.reduce.initial
+        node = ast.parse(default, mode="eval").body if default else None
+        if default is None:
+            lines.append('    panic("StopIteration")')
+        elif element_type == "int" and const_int(node) is not None:
+            lines.append(f"    return {default}")
+        elif element_type == "string" and isinstance(node, ast.Constant):
+            if not isinstance(node.value, str):
+                raise ValueError(f"Go needs a str next() default: {default}")
+            lines.append(f"    return {_go_string(node.value)}")
+        else:
+            raise ValueError(
+                f"Go needs an {element_type} literal as the next() default: {default}"
+            )
+    elif ir.reduce:
+        k = ir.reduce.kind
+        if ir.kind == "dict":
+            expr = ir.val_expr or "0"
+        else:
+            expr = ir.element or "0"
+        lines.append(f"    acc := {_reduce_initial(ir.reduce, number_type)}")
+        if k in ("max", "min"):
+            lines.append("    seen := false")
+        # any/all stop at the first value deciding them, out of the
+        # outermost loop when there are several
+        label = "values" if k in ("any", "all") and len(ir.generators) > 1 else ""
+        nest = loops(_reduce_stmt(k, "acc", "seen", expr, True, label))
+        if label:
+            nest[0] = f"    {label}: {nest[0].lstrip()}"
+        lines += nest
+        lines += _empty_check(ir.reduce, empty)
+        lines.append("    return acc")
+    # Collection operations
+    elif ir.kind == "list":
+        capacity = "" if hint is None else f", {hint}"
+        lines.append(f"    result := make({return_type}, 0{capacity})")
+        lines += loops([f"result = append(result, {ir.element or var})"])
+        if _is_sorted(ir):
+            lines.append("    slices.Sort(result)")
+        lines.append("    return result")
+    elif ir.kind == "set":
+        element = ir.element or var
+        if tuple_key:
+            element = tuple_key[2]
+        set_type = return_type if tuple_key else f"map[{element_type}]struct{{}}"
+        lines.append(f"    result := {_make_map(set_type, hint)}")
+        lines += loops([f"result[{element}] = struct{{}}{{}}"])
+        if set_result == "sorted":
+            lines += _sorted_set("", element_type)
+        else:
+            lines.append("    return result")
+    elif ir.kind == "dict":
+        if use_swiss:
+            lines.append(f"    result := newSwissMap({hint or 0})")
         else:
-            # Fallback for other sources
-            start, stop, step = 0, 1000, 1
+            map_type = "map[int]int" if dict_result == "sorted" else return_type
+            lines.append(f"    result := {_make_map(map_type, hint)}")
+        key, value = ir.key_expr or var, ir.val_expr or var
+        if tuple_key:
+            key = tuple_key[2]
+        if use_swiss:
+            lines += loops([f"result.Put({key}, {value})"])
+        else:
+            lines += loops([f"result[{key}] = {value}"])
+        if dict_result == "sorted":
+            lines += _sorted_pairs()
+        else:
+            lines.append("    return result")
 
-        if parallel:
-            # Parallel implementation with goroutines
-            lines.append("    numWorkers := runtime.NumCPU()")
-            lines.append(f"    chunkSize := ({stop} - {start}) / numWorkers")
-            lines.append("    if chunkSize == 0 { chunkSize = 1 }")
-            lines.append("")
-            lines.append("    results := make(chan int, numWorkers)")
-            lines.append("    var wg sync.WaitGroup")
-            lines.append("")
-            lines.append("    for w := 0; w < numWorkers; w++ {{")
-            lines.append("        wg.Add(1)")
-            lines.append("        go func(workerID int) {{")
-            lines.append("            defer wg.Done()")
-            lines.append(f"            start := {start} + workerID * chunkSize")
-            lines.append("            end := start + chunkSize")
-            lines.append(f"            if workerID == numWorkers-1 {{ end = {stop} }}")
-            lines.append("")
-            lines.append("            acc := 0")
-            lines.append(
-                f"            for {var} := start; {var} < end; {var} += {step} {{"
+    if result_type not in ("int", number_type):
+        lines = [
+            re.sub(r"^    return (\w+)$", rf"    return {result_type}(\1)", line)
+            for line in lines
+        ]
+    lines.append("}")
+    return "\n".join(lines) + "\n"
+
+
+def _fusion_source(irs: list[IRComp]) -> tuple[str, int, int, int]:
+    """
+    Check that every IR is a reduction over one range generator and that all
+    ranges are identical; return the shared loop variable and range bounds.
+    """
+    bounds = None
+    for i, ir in enumerate(irs):
+        if not ir.reduce or len(ir.generators) != 1:
+            raise ValueError(
+                f"Expression {i} is not a single-generator reduction; only "
+                "reductions can share a pass"
+            )
+        src = ir.generators[0].source
+        if not hasattr(src, "start"):
+            raise ValueError(f"Expression {i} does not iterate over a range")
+        if ir.reduce.kind not in ("sum", "prod", "max", "min", "any", "all"):
+            raise ValueError(f"Unsupported reduction for fusion: {ir.reduce.kind}")
+        if ir.generators[0].take_while:
+            raise ValueError(
+                f"Expression {i} stops at takewhile(); it cannot share a pass"
             )
+        this = (src.start, src.stop, src.step)
+        if bounds is None:
+            bounds = this
+        elif this != bounds:
+            raise ValueError(
+                f"Expression {i} iterates range{this}, expression 0 range{bounds}; "
+                "only reductions over the same range can be combined"
+            )
+    return (irs[0].generators[0].var,) + bounds
+
+
+def _rename(expr: str, old: str, new: str) -> str:
+    if old == new:
+        return expr
+    return re.sub(rf"\b{re.escape(old)}\b", new, expr)
+
+
+# Python operators Go applies to floats as well as ints
+_FLOAT_OPS = (ast.Add, ast.Sub, ast.Mult, ast.Div)
+
+
+def _number_expr(expr: str, number_type: str) -> str:
+    """
+    The Go expression of a value of number_type computed by the Python
+    expression expr of int variables. An integer type converts expr's int
+    result. A float type converts the int operands of its float arithmetic
+    instead, that is of a true division or a float literal, so that / does
+    not truncate as it does between Go ints.
+    """
+    if number_type == "int":
+        return expr
+    if not number_type.startswith("float"):
+        return f"{number_type}({expr})"
+
+    def is_float(node: ast.expr) -> bool:
+        if isinstance(node, ast.Constant):
+            return type(node.value) is float
+        if isinstance(node, ast.UnaryOp):
+            return is_float(node.operand)
+        if isinstance(node, ast.BinOp):
+            operands = is_float(node.left) or is_float(node.right)
+            return isinstance(node.op, ast.Div) or operands
+        return False
+
+    def convert(node: ast.expr) -> ast.expr:
+        if not is_float(node):
+            return ast.Call(ast.Name(number_type), [node], [])
+        if isinstance(node, ast.UnaryOp):
+            return ast.UnaryOp(node.op, convert(node.operand))
+        if isinstance(node, ast.Constant):
+            return node
+        if not isinstance(node.op, _FLOAT_OPS):
+            raise ValueError(f"Go {number_type} has no {ast.unparse(node)}")
+        # Literals operands become untyped float constants
+        left, right = (
+            ast.Constant(float(n.value)) if isinstance(n, ast.Constant) else convert(n)
+            for n in (node.left, node.right)
+        )
+        return ast.BinOp(left, node.op, right)
+
+    node = ast.parse(expr, mode="eval").body
+    value = convert(node)
+    if is_float(node) and not any(isinstance(n, ast.Name) for n in ast.walk(node)):
+        # A constant expression would default to float64
+        value = ast.Call(ast.Name(number_type), [value], [])
+    return ast.unparse(value)
+
+
+def _int64_expr(expr: str) -> str:
+    """expr with its variables converted to int64, so that it computes in int64."""
+
+    class Widen(ast.NodeTransformer):
+        def visit_Call(self, node: ast.Call) -> ast.AST:
+            # Only the arguments: the function name is no variable
+            node.args = [self.visit(a) for a in node.args]
+            return node
+
+        def visit_Name(self, node: ast.Name) -> ast.AST:
+            return ast.Call(ast.Name("int64"), [node], [])
+
+    return ast.unparse(Widen().visit(ast.parse(expr, mode="eval")))
+
+
+def _checked_stmt(overflow: str, kind: str, func_name: str, value: str) -> list[str]:
+    """
+    One step of a sum or prod into the int64 acc with the int64 value,
+    through the checked operation of _checked_helpers: an overflow panics,
+    saturates acc or, with overflow="big", moves the reduction into the
+    *big.Int total, which from then on takes every value.
+    """
+    op = "Add" if kind == "sum" else "Mul"
+    checked = f"{func_name}Checked{op}(acc, {value})"
+    if overflow == "saturate":
+        return [f"acc, _ = {checked}"]
+    if overflow == "panic":
+        return [
+            f"next, ok := {checked}",
+            "if !ok {",
+            f'    panic("{func_name}: {kind} overflows int64")',
+            "}",
+            "acc = next",
+        ]
+    return [
+        "if total != nil {",
+        f"    total.{op}(total, big.NewInt({value}))",
+        f"}} else if next, ok := {checked}; ok {{",
+        "    acc = next",
+        "} else {",
+        f"    total = new(big.Int).{op}(big.NewInt(acc), big.NewInt({value}))",
+        "}",
+    ]
+
+
+def _checked_value(
+    overflow: str, kind: str, func_name: str, expr: str
+) -> tuple[list[str], set[str]]:
+    """
+    The statements computing the int64 value v of a sum or prod from expr,
+    every +, - and * of it, outside conditional and call arguments, through
+    the checked operations of _checked_helpers, and the operations they
+    call. An overflow panics, saturates that operation or, with
+    overflow="big", recomputes the value in math/big, adds or multiplies it
+    into the *big.Int total and goes on with the next one. Conditional
+    expressions and calls are computed as they are.
+    """
+    names = {ast.Add: "Add", ast.Sub: "Sub", ast.Mult: "Mul"}
+    stmts: list[str] = []
+    used: set[str] = set()
+
+    def checked(node: ast.expr) -> str:
+        if isinstance(node, ast.BinOp) and type(node.op) in names:
+            op = names[type(node.op)]
+            left, right = checked(node.left), checked(node.right)
+            step = len(steps)
+            steps.append(step)
+            used.add(op)
+            flag = "_" if overflow == "saturate" else f"ok{step}"
+            stmts.append(f"v{step}, {flag} := {func_name}Checked{op}({left}, {right})")
+            return f"v{step}"
+        if isinstance(node, ast.UnaryOp) and isinstance(node.op, ast.USub):
+            return checked(ast.BinOp(ast.Constant(0), ast.Sub(), node.operand))
+        if isinstance(node, ast.BinOp):
+            left, right = checked(node.left), checked(node.right)
+            return f"({ast.unparse(ast.BinOp(ast.Name(left), node.op, ast.Name(right)))})"
+        return ast.unparse(node)
+
+    def exact(node: ast.expr) -> str:
+        if isinstance(node, ast.BinOp) and type(node.op) in names:
+            return f"new(big.Int).{names[type(node.op)]}({exact(node.left)}, {exact(node.right)})"
+        if isinstance(node, ast.UnaryOp) and isinstance(node.op, ast.USub):
+            return f"new(big.Int).Neg({exact(node.operand)})"
+        if isinstance(node, ast.BinOp) and isinstance(node.op, ast.Mod):
+            # A % left to Go has non-negative operands (_int_division), where
+            # the truncating Rem agrees with Python
+            return f"new(big.Int).Rem({exact(node.left)}, {exact(node.right)})"
+        return f"big.NewInt({ast.unparse(node)})"
+
+    steps: list[int] = []
+    tree = ast.parse(expr, mode="eval").body
+    value = checked(tree)
+    if not steps:
+        return [f"v := {expr}"], used
+    stmts.append(f"v := {value}")
+    fits = " && ".join(f"ok{step}" for step in steps)
+    if overflow == "panic":
+        stmts += [
+            f"if !({fits}) {{",
+            f'    panic("{func_name}: value overflows int64")',
+            "}",
+        ]
+    elif overflow == "big":
+        op = "Add" if kind == "sum" else "Mul"
+        stmts += [
+            f"if !({fits}) {{",
+            "    if total == nil {",
+            "        total = big.NewInt(acc)",
+            "    }",
+            f"    total.{op}(total, {exact(tree)})",
+            "    continue",
+            "}",
+        ]
+    return stmts, used
 
-            # Add filters
-            for filter_expr in gen.filters:
-                lines.append(f"                if !({filter_expr}) {{ continue }}")
 
-            # Add the operation
-            if ir.reduce:
-                k = ir.reduce.kind
-                if ir.kind == "dict":
-                    expr = ir.val_expr or "0"
+def _checked_helpers(ops: set[str], func_name: str) -> str:
+    """The int64 additions, subtractions and multiplications of ops."""
+    helpers = []
+    if "Add" in ops:
+        name = f"{func_name}CheckedAdd"
+        helpers.append([
+            f"// {name} returns a + b and true, or the int64 bound the sum passes",
+            "// and false when it overflows.",
+            f"func {name}(a, b int64) (int64, bool) {{",
+            "    c := a + b",
+            "    if (c > a) == (b > 0) {",
+            "        return c, true",
+            "    }",
+            "    if b > 0 {",
+        ])
+    if "Sub" in ops:
+        name = f"{func_name}CheckedSub"
+        helpers.append([
+            f"// {name} returns a - b and true, or the int64 bound the difference",
+            "// passes and false when it overflows.",
+            f"func {name}(a, b int64) (int64, bool) {{",
+            "    c := a - b",
+            "    if (c < a) == (b > 0) {",
+            "        return c, true",
+            "    }",
+            "    if b < 0 {",
+        ])
+    if "Mul" in ops:
+        name = f"{func_name}CheckedMul"
+        helpers.append([
+            f"// {name} returns a * b and true, or the int64 bound the product",
+            "// passes and false when it overflows.",
+            f"func {name}(a, b int64) (int64, bool) {{",
+            "    c := a * b",
+            "    if a == 0 || c/a == b && !(a == -1 && b == math.MinInt64) {",
+            "        return c, true",
+            "    }",
+            "    if (a < 0) == (b < 0) {",
+        ])
+    tail = [
+        "        return math.MaxInt64, false",
+        "    }",
+        "    return math.MinInt64, false",
+        "}",
+    ]
+    return "\n\n".join("\n".join(lines + tail) for lines in helpers) + "\n"
+
+
+def _reduce_stmt(
+    kind: str, acc: str, seen: str, expr: str, early_exit: bool, label: str = ""
+) -> list[str]:
+    """
+    One loop iteration of a reduction into acc with Python semantics; max/min
+    also track whether any value was seen. early_exit lets any/all break out
+    of the loop once decided, or out of the loop labelled label.
+    """
+    stop = f"    break {label}" if label else "    break"
+    if kind == "sum":
+        return [f"{acc} += {expr}"]
+    if kind == "prod":
+        return [f"{acc} *= {expr}"]
+    if kind in ("max", "min"):
+        cmp = ">" if kind == "max" else "<"
+        return [
+            f"if v := {expr}; !{seen} || v {cmp} {acc} {{",
+            f"    {acc} = v",
+            f"    {seen} = true",
+            "}",
+        ]
+    if kind == "any":
+        if early_exit:
+            return [f"if {expr} {{", f"    {acc} = true", stop, "}"]
+        return [f"{acc} = {acc} || ({expr})"]
+    # all
+    if early_exit:
+        return [f"if !({expr}) {{", f"    {acc} = false", stop, "}"]
+    return [f"{acc} = {acc} && ({expr})"]
+
+
+def _go_string(value: str) -> str:
+    """value as a Go interpreted string literal."""
+    return json.dumps(value, ensure_ascii=False)
+
+
+def _join_writes(element: str, widths: dict[str, int]) -> tuple[list[str], int]:
+    """
+    The statements writing element, a value of str.join(), into the
+    strings.Builder result, and the most bytes they write for one value.
+    element concatenates with + string literals, f-strings without format
+    specs, and str() or chr() of an int: str() appends the digits into the
+    stack buffer digits, so that no value allocates. widths has the longest
+    str() of the loop variables whose ranges are constant; str() of
+    anything else may take _INT_DIGITS.
+    """
+    writes: list[str] = []
+    size = 0
+
+    def write(node: ast.expr) -> None:
+        nonlocal size
+        call = (
+            node.func.id
+            if isinstance(node, ast.Call)
+            and isinstance(node.func, ast.Name)
+            and len(node.args) == 1
+            and not node.keywords
+            else None
+        )
+        if isinstance(node, ast.BinOp) and isinstance(node.op, ast.Add):
+            write(node.left)
+            write(node.right)
+        elif isinstance(node, ast.Constant) and isinstance(node.value, str):
+            if node.value:
+                writes.append(f"result.WriteString({_go_string(node.value)})")
+                size += len(node.value.encode())
+        elif isinstance(node, ast.JoinedStr):
+            for part in node.values:
+                if not isinstance(part, ast.FormattedValue):
+                    write(part)
+                elif part.format_spec or part.conversion not in (-1, ord("s")):
+                    raise ValueError(
+                        f"Go joins f-strings without format specs: {element}"
+                    )
                 else:
-                    expr = ir.element or "0"
-
-                if k == "sum":
-                    lines.append(f"                acc += {expr}")
-                elif k == "max":
-                    lines.append(f"                if {expr} > acc {{ acc = {expr} }}")
-                elif k == "min":
-                    lines.append(f"                if {expr} < acc {{ acc = {expr} }}")
-                elif k == "any":
-                    lines.append(f"                if {expr} {{ acc = 1; break }}")
-                elif k == "all":
-                    lines.append(f"                if !{expr} {{ acc = 0; break }}")
-            else:
-                # Collection operations
-                if ir.kind == "list":
-                    if ir.element:
-                        lines.append(f"                acc += {ir.element}")
-                    else:
-                        lines.append(f"                acc += {var}")
-                elif ir.kind == "set":
-                    lines.append("                acc += 1")  # Count unique elements
-                elif ir.kind == "dict":
-                    if ir.element:
-                        lines.append(f"                acc += {ir.element}")
-                    else:
-                        lines.append(f"                acc += {var}")
+                    write(ast.Call(ast.Name("str"), [part.value], []))
+        elif call == "str":
+            arg = ast.unparse(node.args[0])
+            writes.append(
+                f"result.Write(strconv.AppendInt(digits[:0], int64({arg}), 10))"
+            )
+            size += widths.get(arg, _INT_DIGITS)
+        elif call == "chr":
+            writes.append(f"result.WriteRune(rune({ast.unparse(node.args[0])}))")
+            size += 4
+        else:
+            raise ValueError(
+                "Go joins string literals, f-strings and str() or chr() of ints: "
+                f"{element}"
+            )
 
-            lines.append("            }")
-            lines.append("            results <- acc")
-            lines.append("        }(w)")
+    write(ast.parse(element, mode="eval").body)
+    return writes, size
+
+
+def _int_widths(ir: IRComp) -> dict[str, int]:
+    """The longest str() of each loop variable of ir over a constant range."""
+    widths = {}
+    for gen in ir.generators:
+        bounds = _loop_bounds(gen) if _input_slice(gen) is None else None
+        if bounds and all(type(b) is int for b in bounds):
+            start, stop, step = bounds
+            n = _range_len(start, stop, step)
+            if n:
+                last = start + (n - 1) * step
+                widths[gen.var] = max(len(str(start)), len(str(last)))
+    return widths
+
+
+def render_go_multi(
+    irs: list[IRComp],
+    func_name: str = "program",
+    fuse: bool = False,
+    sources: list[str] | None = None,
+) -> str:
+    """
+    Several reductions over the same range rendered into one function that
+    returns all results in a struct (fields R0, R1, ... in input order).
+
+      fuse=False - one loop per reduction (separate passes)
+      fuse=True  - a single loop computing every reduction
+
+    Both variants return identical results, so they can be benchmarked
+    against each other. Unlike render_go, max/min track whether any value
+    was seen and any/all start from False/True as in Python; an empty max/min
+    yields its default=, else 0.
+    """
+    if not irs:
+        raise ValueError("render_go_multi needs at least one expression")
+    var, start, stop, step = _fusion_source(irs)
+    irs = [_go_filters(_int_division(ir, func_name)) for ir in irs]
+    type_name = f"{func_name}Result"
+
+    lines = [f"type {type_name} struct {{"]
+    for i, ir in enumerate(irs):
+        go_type = "bool" if ir.reduce.kind in ("any", "all") else "int"
+        comment = f" // {sources[i].strip()}" if sources else ""
+        lines.append(f"    R{i} {go_type}{comment}")
+    lines.append("}")
+    lines.append("")
+    lines.append(f"func {func_name}() {type_name} {{")
+    lines.append(f"    var res {type_name}")
+    for i, ir in enumerate(irs):
+        # The struct starts out zero: 0 and false need no assignment
+        initial = _reduce_initial(ir.reduce)
+        if initial not in ("0", "false"):
+            lines.append(f"    res.R{i} = {initial}")
+        if ir.reduce.kind in ("max", "min"):
+            lines.append(f"    seen{i} := false")
+
+    def body(i: int, ir: IRComp, indent: str, early_exit: bool) -> list[str]:
+        gen = ir.generators[0]
+        expr = _rename(ir.element or gen.var, gen.var, var)
+        conds = [f"({_rename(f, gen.var, var)})" for f in gen.filters]
+        stmt = _reduce_stmt(ir.reduce.kind, f"res.R{i}", f"seen{i}", expr, early_exit)
+        if conds:
+            guard = f"if {' && '.join(conds)} {{"
+            stmt = [guard] + [f"    {s}" for s in stmt] + ["}"]
+        return [indent + s for s in stmt]
+
+    loop = f"    {_for_clause(var, start, stop, step)} {{"
+    if fuse:
+        lines.append(loop)
+        for i, ir in enumerate(irs):
+            lines.extend(body(i, ir, "        ", early_exit=False))
+        lines.append("    }")
+    else:
+        for i, ir in enumerate(irs):
+            lines.append(loop)
+            lines.extend(body(i, ir, "        ", early_exit=True))
             lines.append("    }")
-            lines.append("")
-            lines.append("    wg.Wait()")
-            lines.append("    close(results)")
-            lines.append("")
+    lines.append("    return res")
+    lines.append("}")
+    code = "\n".join(lines) + "\n"
+    return code + _division_helpers(code, func_name)
 
-            if ir.reduce:
-                if ir.reduce.kind in ("any", "all"):
-                    lines.append("    for result := range results {")
-                    lines.append("        if result == 1 { return true }")
-                    lines.append("    }")
-                    lines.append("    return false")
-                else:
-                    lines.append("    total := 0")
-                    lines.append("    for result := range results {")
-                    lines.append("        total += result")
-                    lines.append("    }")
-                    lines.append("    return total")
-            else:
-                lines.append("    result := make([]int, 0)")
-                lines.append("    for result := range results {")
-                lines.append("        result = append(result, result)")
-                lines.append("    }")
-                lines.append("    return result")
-        else:
-            # Sequential implementation
-            if ir.reduce:
-                lines.append("    acc := 0")
-                lines.append(
-                    f"    for {var} := {start}; {var} < {stop}; {var} += {step} {{"
-                )
 
-                # Add filters
-                for filter_expr in gen.filters:
-                    lines.append(f"        if !({filter_expr}) {{ continue }}")
+# Names a pipeline stage cannot take: Go keywords and predeclared
+# identifiers the generated code relies on, and its own locals.
+_RESERVED_STAGE_NAMES = frozenset(
+    """
+    break case chan const continue default defer else fallthrough for func go
+    goto if import interface map package range return select struct switch
+    type var append make int bool true false result seen v
+    """.split()
+)
+
 
-                # Add the operation
-                k = ir.reduce.kind
-                if ir.kind == "dict":
-                    expr = ir.val_expr or "0"
-                else:
-                    expr = ir.element or "0"
-
-                if k == "sum":
-                    lines.append(f"        acc += {expr}")
-                elif k == "max":
-                    lines.append(f"        if {expr} > acc {{ acc = {expr} }}")
-                elif k == "min":
-                    lines.append(f"        if {expr} < acc {{ acc = {expr} }}")
-                elif k == "any":
-                    lines.append(f"        if {expr} {{ return true }}")
-                elif k == "all":
-                    lines.append(f"        if !{expr} {{ return false }}")
-
-                lines.append("    }")
-
-                if k in ("any", "all"):
-                    lines.append("    return false")
-                else:
-                    lines.append("    return acc")
-            else:
-                # Collection operations
-                if ir.kind == "list":
-                    lines.append("    result := make([]int, 0)")
-                    lines.append(
-                        f"    for {var} := {start}; {var} < {stop}; {var} += {step} {{"
-                    )
+def _uses(var: str, exprs: list[str | None]) -> bool:
+    return any(e and re.search(rf"\b{re.escape(var)}\b", e) for e in exprs)
 
-                    # Add filters
-                    for filter_expr in gen.filters:
-                        lines.append(f"        if !({filter_expr}) {{ continue }}")
-
-                    if ir.element:
-                        lines.append(f"        result = append(result, {ir.element})")
-                    else:
-                        lines.append(f"        result = append(result, {var})")
-
-                    lines.append("    }")
-                    lines.append("    return result")
-                elif ir.kind == "set":
-                    lines.append("    result := make(map[int]struct{})")
-                    lines.append(
-                        f"    for {var} := {start}; {var} < {stop}; {var} += {step} {{"
-                    )
 
-                    # Add filters
-                    for filter_expr in gen.filters:
-                        lines.append(f"        if !({filter_expr}) {{ continue }}")
-
-                    if ir.element:
-                        lines.append(f"        result[{ir.element}] = struct{{}}{{}}")
-                    else:
-                        lines.append(f"        result[{var}] = struct{{}}{{}}")
-
-                    lines.append("    }")
-                    lines.append("    return result")
-                elif ir.kind == "dict":
-                    lines.append("    result := make(map[int]int)")
-                    lines.append(
-                        f"    for {var} := {start}; {var} < {stop}; {var} += {step} {{"
-                    )
+def _check_pipeline(stages: list[tuple[str, IRComp]]) -> None:
+    names = set()
+    for i, (name, ir) in enumerate(stages):
+        if not name.isidentifier() or name in _RESERVED_STAGE_NAMES:
+            raise ValueError(f"Invalid stage name: {name!r}")
+        if name in names:
+            raise ValueError(f"Duplicate stage name: {name!r}")
+        names.add(name)
+        if len(ir.generators) != 1:
+            raise ValueError(f"Stage {name!r} must have a single generator")
+        if ir.generators[0].take_while:
+            raise ValueError(
+                f"Stage {name!r}: takewhile() is not supported in a pipeline"
+            )
+        source = ir.generators[0].source
+        if i == 0 and not hasattr(source, "start"):
+            raise ValueError(f"The first stage, {name!r}, must iterate over a range")
+        if i > 0 and source != stages[i - 1][0]:
+            raise ValueError(
+                f"Stage {name!r} must iterate over the previous stage "
+                f"{stages[i - 1][0]!r}, not {source!r}"
+            )
+        if i < len(stages) - 1 and (ir.reduce or ir.kind not in ("list", "generator")):
+            raise ValueError(
+                f"Stage {name!r} feeds another stage, so it must be a list or "
+                "generator expression"
+            )
+        reductions = ("sum", "prod", "max", "min", "any", "all")
+        if ir.reduce and ir.reduce.kind not in reductions:
+            raise ValueError(f"Unsupported reduction in a pipeline: {ir.reduce.kind}")
+
+
+def render_go_pipeline(
+    stages: list[tuple[str, IRComp]],
+    func_name: str = "program",
+    fuse: bool = False,
+) -> str:
+    """
+    A linear pipeline of named comprehensions rendered into one function:
+    the first stage iterates over a range, every later stage over the stage
+    before it by name, e.g.
+
+      evens = [x*x for x in range(100) if x%2==0]
+      total = sum(y for y in evens if y%3==0)
+
+    Every stage but the last must be a list or generator expression; the
+    function returns the last stage's result (types as in render_go, with
+    reductions following Python semantics as in render_go_multi).
 
-                    # Add filters
-                    for filter_expr in gen.filters:
-                        lines.append(f"        if !({filter_expr}) {{ continue }}")
+      fuse=False - each intermediate stage is materialized into a []int
+                   named after it, then walked by the next stage
+      fuse=True  - a single loop over the range, each value flowing through
+                   every stage's filters and expression in turn
 
-                    if ir.element:
-                        lines.append(f"        result[{var}] = {ir.element}")
-                    else:
-                        lines.append(f"        result[{var}] = {var}")
+    Both variants return identical results, so they can be benchmarked
+    against each other.
+    """
+    if not stages:
+        raise ValueError("render_go_pipeline needs at least one stage")
+    _check_pipeline(stages)
+    for _, ir in stages:
+        _check_tuple_values(ir)
+    stages = [
+        (name, _go_filters(_int_division(ir, func_name))) for name, ir in stages
+    ]
+    final = stages[-1][1]
+    final_gen = final.generators[0]
+    kind = final.reduce.kind if final.reduce else None
+
+    if kind in ("any", "all"):
+        return_type, init = "bool", _reduce_initial(final.reduce)
+    elif kind is not None:
+        return_type, init = "int", _reduce_initial(final.reduce)
+    elif final.kind == "set":
+        return_type, init = "map[int]struct{}", "make(map[int]struct{})"
+    elif final.kind == "dict":
+        return_type, init = "map[int]int", "make(map[int]int)"
+    else:
+        return_type, init = "[]int", "make([]int, 0)"
 
-                    lines.append("    }")
-                    lines.append("    return result")
+    if kind is not None:
+        expr = final.element or final_gen.var
+        emit = _reduce_stmt(kind, "result", "seen", expr, early_exit=True)
+    elif final.kind == "set":
+        emit = [f"result[{final.element or final_gen.var}] = struct{{}}{{}}"]
+    elif final.kind == "dict":
+        key = final.key_expr or final_gen.var
+        emit = [f"result[{key}] = {final.val_expr or final_gen.var}"]
     else:
-        # Multiple generators - fallback to sequential
-        lines.append("    // Multiple generators - using sequential implementation")
-        lines.append("    // TODO: Implement parallel multi-generator support")
-        lines.append("    return nil")
+        emit = [f"result = append(result, {final.element or final_gen.var})"]
+
+    def uses_var(ir: IRComp) -> bool:
+        gen = ir.generators[0]
+        return _uses(gen.var, gen.filters + [ir.element, ir.key_expr, ir.val_expr])
+
+    def guards(ir: IRComp) -> list[str]:
+        return [f"if !({f}) {{ continue }}" for f in ir.generators[0].filters]
 
+    src = stages[0][1].generators[0]
+    start, stop, step = src.source.start, src.source.stop, src.source.step
+    head = f"{_for_clause(src.var, start, stop, step)} {{"
+
+    lines = [f"func {func_name}() {return_type} {{"]
+    if fuse:
+        lines.append(f"    result := {init}")
+        if kind in ("max", "min"):
+            lines.append("    seen := false")
+        lines.append(f"    {head}")
+        for i, (_, ir) in enumerate(stages):
+            if i > 0 and uses_var(ir):
+                prev = stages[i - 1][1]
+                value = prev.element or prev.generators[0].var
+                var = ir.generators[0].var
+                if value != var:
+                    lines.append(f"        {var} := {value}")
+            lines += [f"        {g}" for g in guards(ir)]
+        lines += [f"        {s}" for s in emit]
+        lines.append("    }")
+    else:
+        for i, (name, ir) in enumerate(stages):
+            gen = ir.generators[0]
+            if i == len(stages) - 1:
+                lines.append(f"    result := {init}")
+                if kind in ("max", "min"):
+                    lines.append("    seen := false")
+                body = emit
+            else:
+                lines.append(f"    {name} := make([]int, 0)")
+                body = [f"{name} = append({name}, {ir.element or gen.var})"]
+            if i == 0:
+                lines.append(f"    {head}")
+            elif uses_var(ir):
+                lines.append(f"    for _, {gen.var} := range {stages[i - 1][0]} {{")
+            else:
+                lines.append(f"    for range {stages[i - 1][0]} {{")
+            lines += [f"        {g}" for g in guards(ir)]
+            lines += [f"        {s}" for s in body]
+            lines.append("    }")
+    lines.append("    return result")
     lines.append("}")
+    code = "\n".join(lines) + "\n"
+    return code + _division_helpers(code, func_name)
+
+
+_IMPORT_BLOCK = re.compile(r'^import \(\n((?:    "[^"\n]+"\n)*)\)\n\n', re.M)
+
+_GO_KEYWORDS = frozenset(
+    """
+    break case chan const continue default defer else fallthrough for func go
+    goto if import interface map package range return select struct switch
+    type var
+    """.split()
+)
+
+
+def render_go_package(
+    fragment: str,
+    func_name: str = "program",
+    package: str = "main",
+    protocol: bool = False,
+) -> str:
+    """
+    Wrap a function rendered by render_go, render_go_multi or
+    render_go_pipeline into a complete Go source file of the given package.
+    The fragment's own import block joins the file's. For package main the
+    file is a program, runnable with `go run`, whose main prints the
+    function's result with fmt.Println (an iterator's values collected into
+    a slice or map, a channel's one per line, an errgroup function's error to
+    stderr instead); any other package gets the function alone, to drop into
+    an existing module. A program over an input slice reads it from stdin
+    (see _READ_INPUT); only one fits there. One over Parquet files takes
+    their paths as its arguments. protocol=True makes the program one a
+    harness can drive without rebuilding it (see _protocol_main).
+    """
+    if protocol and package != "main":
+        raise ValueError("protocol=True needs package main")
+    if not re.fullmatch(r"[A-Za-z_]\w*", package) or package in _GO_KEYWORDS:
+        raise ValueError(f"Invalid Go package name: {package!r}")
+    imports = {"fmt"} if package == "main" else set()
+    # A build constraint (fold) has to come before the package clause
+    constraint = re.match(r"(//go:build .*)\n\n", fragment)
+    if constraint:
+        fragment = fragment[constraint.end() :]
+    m = _IMPORT_BLOCK.search(fragment)
+    if m:
+        imports.update(re.findall(r'"([^"]+)"', m.group(1)))
+        fragment = fragment[: m.start()] + fragment[m.end() :]
+    call = f"{func_name}()"
+    read = []
+    m = re.search(rf"^func {func_name}\((\w+(?:, \w+)*) \[\]int\)", fragment, re.M)
+    if m and package == "main":
+        inputs = m.group(1).split(", ")
+        if len(inputs) > 1:
+            raise ValueError(
+                f"A Go program reads one input slice from stdin, not {len(inputs)}"
+            )
+        imports.update({"bytes", "encoding/json", "io", "os", "strconv", "strings"})
+        call = f"{func_name}({inputs[0]})"
+        read = [f"    {inputs[0]} := readInput()"]
+    # Parquet inputs (input_types) are files named on the command line
+    path = r"\w+Path string"
+    m = re.search(rf"^func {func_name}\(({path}(?:, {path})*)\)", fragment, re.M)
+    if m and package == "main":
+        paths = [p.split()[0] for p in m.group(1).split(", ")]
+        imports.add("os")
+        read = [
+            f"    if len(os.Args) != {len(paths) + 1} {{",
+            f'        fmt.Fprintln(os.Stderr, "usage: {func_name} {" ".join(paths)}")',
+            "        os.Exit(2)",
+            "    }",
+        ]
+        args = ", ".join(f"os.Args[{i + 1}]" for i in range(len(paths)))
+        call = f"{func_name}({args})"
+    main = [f"    fmt.Println({call})"]
+    if package == "main":
+        # An iterator (emit="iter") prints as what it yields, collected
+        m = re.search(rf"^func {func_name}\([^)]*\) iter\.Seq(2?)\[", fragment, re.M)
+        if m:
+            collect = "maps" if m.group(1) else "slices"
+            imports.add(collect)
+            main = [f"    fmt.Println({collect}.Collect({call}))"]
+        # A channel (emit="chan") prints each value as it arrives
+        if re.search(rf"^func {func_name}\([^)]*\) <-chan ", fragment, re.M):
+            main = [
+                f"    for v := range {call} {{",
+                "        fmt.Println(v)",
+                "    }",
+            ]
+        # A pool (parallel_style="pool") gets its default number of workers,
+        # and a function taking a context (cancellable=True, errgroup) one
+        # never cancelled and reports its error instead of a result
+        m = re.search(rf"^func {func_name}\(((?:ctx|workers) [^)]*)\)", fragment, re.M)
+        if m:
+            args = [
+                "context.Background()" if param.startswith("ctx") else "0"
+                for param in m.group(1).split(", ")
+            ]
+            call = f"{func_name}({', '.join(args)})"
+            main = [f"    fmt.Println({call})"]
+            if "ctx context.Context" in m.group(1):
+                imports.add("context")
+        # and so does one returning an error of its own (return_error=True)
+        error_result = rf"^func {func_name}\(.*\) \(_ .+, err error\) \{{$"
+        if m and "ctx context.Context" in m.group(1) or re.search(
+            error_result, fragment, re.M
+        ):
+            imports.add("os")
+            main = [
+                f"    result, err := {call}",
+                "    if err != nil {",
+                "        fmt.Fprintln(os.Stderr, err)",
+                "        os.Exit(1)",
+                "    }",
+                "    fmt.Println(result)",
+            ]
+        params = re.search(rf"^func {func_name}\(([^)]*)\)", fragment, re.M)
+        if params and params.group(1) and call == f"{func_name}()":
+            raise ValueError(
+                f"A Go program has no value for {params.group(1)}; "
+                "render it into another package"
+            )
+        # A sync.Map (map_impl="sync") prints as the entries it holds
+        sync_map = rf"^func {func_name}\(.*\) \(?(?:_ )?\*sync\.Map\b"
+        if re.search(sync_map, fragment, re.M):
+            result = main[-1][len("    fmt.Println(") : -1]
+            main[-1:] = [
+                "    entries := map[any]any{}",
+                f"    {result}.Range(func(k, v any) bool {{",
+                "        entries[k] = v",
+                "        return true",
+                "    })",
+                "    fmt.Println(entries)",
+            ]
+    if protocol:
+        if read:
+            raise ValueError("A protocol program takes no inputs")
+        run, main = _protocol_main(func_name, main)
+        imports.update(
+            {"crypto/sha256", "encoding/hex", "encoding/json", "flag", "os", "time"}
+        )
+        if not re.search(r"^(?:var|const) n\b", fragment, re.M):
+            run += ["", "// n is the expression's n, set by -n.", "var n int"]
+        fragment = fragment.rstrip("\n") + "\n" + "\n".join(run)
+    lines = [f"package {package}", ""]
+    if constraint:
+        lines[:0] = [constraint.group(1), ""]
+    if imports:
+        lines.append("import (")
+        lines += [f'    "{imp}"' for imp in sorted(imports)]
+        lines += [")", ""]
+    lines += fragment.splitlines()
+    if package == "main":
+        lines += ["", "func main() {", *read, *main, "}"]
+        if read and "readInput()" in read[0]:
+            lines += ["", *_READ_INPUT]
     return "\n".join(lines) + "\n"
+
+
+def _protocol_main(func_name: str, main: list[str]) -> tuple[list[str], list[str]]:
+    """
+    The function a protocol program gets its result from, and its main.
+    main is what prints the result in a plain program: its last print
+    becomes the function's return, a channel's values collected into a
+    slice. The program takes -n, the value of the free name n in the
+    expression, -reps, the calls to time, and -format: text prints the
+    result (a channel's values as one slice), json one object with n, reps, each
+    call's time in nanoseconds and the SHA-256 of the result as text
+    prints it, so a harness can rerun one build at other sizes and compare
+    results without knowing their types.
+    """
+    run_name = f"{func_name}Result"
+    if main[-1] == "    }":
+        body = [
+            "    var values []any",
+            main[0],
+            "        values = append(values, v)",
+            "    }",
+            "    return values",
+        ]
+    else:
+        body = [*main[:-1], "    return " + main[-1][len("    fmt.Println(") : -1]]
+    run = [
+        "",
+        f"// {run_name} calls {func_name} once for main to time.",
+        f"func {run_name}() any {{",
+        *body,
+        "}",
+    ]
+    main = [
+        '    flag.IntVar(&n, "n", n, "value of n in the expression")',
+        '    reps := flag.Int("reps", 1, "calls to time")',
+        '    format := flag.String("format", "text", "output: text or json")',
+        "    flag.Parse()",
+        '    if *reps < 1 || *format != "text" && *format != "json" {',
+        "        flag.Usage()",
+        "        os.Exit(2)",
+        "    }",
+        "    var result any",
+        "    times := make([]int64, *reps)",
+        "    for i := range times {",
+        "        start := time.Now()",
+        f"        result = {run_name}()",
+        "        times[i] = time.Since(start).Nanoseconds()",
+        "    }",
+        "    text := fmt.Sprint(result)",
+        '    if *format == "text" {',
+        "        fmt.Println(text)",
+        "        return",
+        "    }",
+        "    sum := sha256.Sum256([]byte(text))",
+        "    json.NewEncoder(os.Stdout).Encode(map[string]any{",
+        '        "n": n, "reps": *reps, "times_ns": times,',
+        '        "result_sha256": hex.EncodeToString(sum[:]),',
+        "    })",
+    ]
+    return run, main
+
+
+def go_result_shape(fragment: str, func_name: str = "program") -> dict:
+    """
+    A JSON-ready description of what func_name in a fragment rendered by
+    render_go returns, for tools that marshal or compare its results
+    without knowing the expression: the declared Go type, whether an error
+    comes with it, the accumulator the function returns (None when it
+    returns an expression, such as next()'s default or an iterator), and
+    the type's shape. A shape has a kind (scalar, list, array, map, set,
+    iter, iter2, chan or opaque, for *swissMap and *sync.Map), its Go type
+    and the shapes of its element, or key and value.
+    """
+    m = re.search(
+        rf"^func {re.escape(func_name)}\((.*)\) (.+) \{{$", fragment, re.M
+    )
+    if not m:
+        raise ValueError(f"No function {func_name} in the Go code")
+    returns = m.group(2)
+    errors = re.fullmatch(r"\((?:_ )?(.+), (?:err )?error\)", returns)
+    go_type = errors.group(1) if errors else returns
+    body = fragment[m.end() : fragment.find("\n}", m.end())]
+    results = re.findall(r"^    return ([A-Za-z_]\w*)(?:, nil)?$", body, re.M)
+    return {
+        "func": func_name,
+        "type": go_type,
+        "error": bool(errors),
+        "accumulator": results[-1] if results else None,
+        "shape": _type_shape(go_type),
+    }
+
+
+def _type_shape(go_type: str) -> dict:
+    """The shape of go_type, as go_result_shape describes it."""
+    shape: dict = {"type": go_type}
+    if go_type.startswith("map["):
+        depth = 0
+        for i, ch in enumerate(go_type):
+            depth += {"[": 1, "]": -1}.get(ch, 0)
+            if ch == "]" and depth == 0:
+                break
+        key, value = go_type[4:i], go_type[i + 1 :]
+        if value == "struct{}":
+            return {**shape, "kind": "set", "element": _type_shape(key)}
+        return {
+            **shape,
+            "kind": "map",
+            "key": _type_shape(key),
+            "value": _type_shape(value),
+        }
+    if go_type.startswith("[]"):
+        return {**shape, "kind": "list", "element": _type_shape(go_type[2:])}
+    m = re.fullmatch(r"\[(\d+)\](.+)", go_type)
+    if m:
+        return {
+            **shape,
+            "kind": "array",
+            "length": int(m.group(1)),
+            "element": _type_shape(m.group(2)),
+        }
+    m = re.fullmatch(r"iter\.Seq2\[(\w+), (.+)\]", go_type)
+    if m:
+        return {
+            **shape,
+            "kind": "iter2",
+            "key": _type_shape(m.group(1)),
+            "value": _type_shape(m.group(2)),
+        }
+    m = re.fullmatch(r"iter\.Seq\[(.+)\]", go_type)
+    if m:
+        return {**shape, "kind": "iter", "element": _type_shape(m.group(1))}
+    m = re.fullmatch(r"<-chan (.+)", go_type)
+    if m:
+        return {**shape, "kind": "chan", "element": _type_shape(m.group(1))}
+    if go_type in ("*swissMap", "*sync.Map"):
+        return {**shape, "kind": "opaque"}
+    return {**shape, "kind": "scalar"}
+
+
+def render_go_test(
+    fragment: str,
+    ir: IRComp,
+    func_name: str = "program",
+    package: str = "main",
+    benchmark: bool = False,
+    zero_alloc: bool = False,
+) -> str:
+    """
+    A _test.go file for the package render_go_package puts fragment in,
+    whose test calls func_name and fails unless it returns the value Python
+    computes for ir (see _reference_value). Results compare as fmt prints
+    them, which lists maps in key order and a nil slice as an empty one. An
+    iterator is collected and an error result fails the test; a function
+    over input slices, returning a channel or a sync.Map, has no test.
+    benchmark=True adds the benchmark of render_go_benchmark, and with
+    zero_alloc=True its allocation test.
+    """
+    call, result, error, imports, _ = _test_call(fragment, func_name, inputs=False)
+    imports |= {"fmt", "testing"}
+    seq = re.fullmatch(r"iter\.Seq(2?)\[(.+)\]", result)
+    if seq:
+        collect = "maps" if seq.group(1) else "slices"
+        imports.add(collect)
+        call = f"{collect}.Collect({call})"
+        if seq.group(1):
+            key, value = seq.group(2).split(", ", 1)
+            result = f"map[{key}]{value}"
+        else:
+            result = f"[]{seq.group(2)}"
+    if result.startswith(("<-chan ", "*sync.Map")):
+        raise ValueError(f"A Go test cannot compare a {result} result")
+    source = _python_source(ir)
+    want = _go_literal(_reference_value(source), result)
+    name = f"Test{func_name[:1].upper()}{func_name[1:]}"
+    lines = [
+        f"// {name} checks {func_name} against the value Python computes",
+        f"// for {source}.",
+        f"func {name}(t *testing.T) {{",
+    ]
+    if error:
+        lines += [
+            f"    got, err := {call}",
+            "    if err != nil {",
+            "        t.Fatal(err)",
+            "    }",
+        ]
+    else:
+        lines.append(f"    got := {call}")
+    lines += [
+        f"    want := {want}",
+        "    if fmt.Sprint(got) != fmt.Sprint(want) {",
+        f'        t.Errorf("{func_name}() = %v, want %v", got, want)',
+        "    }",
+        "}",
+    ]
+    if benchmark:
+        bench_lines, bench_imports = _benchmark_func(fragment, func_name)
+        lines += ["", *bench_lines]
+        imports |= bench_imports
+        if zero_alloc:
+            lines += ["", *_zero_alloc_test(fragment, func_name)]
+    return _go_test_file(package, imports, lines)
+
+
+def render_go_benchmark(
+    fragment: str,
+    func_name: str = "program",
+    package: str = "main",
+    zero_alloc: bool = False,
+) -> str:
+    """
+    A _test.go file for the package render_go_package puts fragment in,
+    whose BenchmarkProgram (after func_name) times func_name and reports
+    its allocations, for `go test -bench .` to run without the harness.
+    The result goes to a package variable, so the call cannot be optimized
+    away; an iterator or channel is drained into it value by value. Input
+    slices are the ints 0 to _BENCH_INPUT - 1, filled before the timer
+    starts. zero_alloc=True, for a function rendered with it, adds a test
+    failing once a call allocates (see _zero_alloc_test), so `go test` in
+    CI holds the code to render_go's guarantee.
+    """
+    lines, imports = _benchmark_func(fragment, func_name)
+    if zero_alloc:
+        lines += ["", *_zero_alloc_test(fragment, func_name)]
+    return _go_test_file(package, imports | {"testing"}, lines)
+
+
+def _zero_alloc_test(fragment: str, func_name: str) -> list[str]:
+    """
+    A test of func_name's allocations per call, by testing.AllocsPerRun, into
+    the benchmark's sink; it fails on any. The benchmark reports the same
+    as allocs/op.
+    """
+    call, _, error, _, setup = _test_call(fragment, func_name, inputs=True)
+    exported = f"{func_name[:1].upper()}{func_name[1:]}"
+    sink = f"benchmark{exported}Sink"
+    store = f"{sink}, _ = {call}" if error else f"{sink} = {call}"
+    return [
+        f"// Test{exported}Allocs fails when {func_name} allocates, which code",
+        "// rendered with zero_alloc must not.",
+        f"func Test{exported}Allocs(t *testing.T) {{",
+        *setup,
+        f"    if allocs := testing.AllocsPerRun({_ALLOC_RUNS}, func() {{ {store} }}); allocs > 0 {{",
+        f'        t.Errorf("{func_name}() allocates %v times per call, want 0", allocs)',
+        "    }",
+        "}",
+    ]
+
+
+# Calls testing.AllocsPerRun averages a zero_alloc function's allocations over
+_ALLOC_RUNS = 100
+
+
+# Length of the input slices render_go_benchmark passes
+_BENCH_INPUT = 1024
+
+# Import paths of the packages a result type may name, by package name
+_GO_PACKAGE_PATHS = {"big": "math/big"}
+
+
+def _go_test_file(package: str, imports: set[str], lines: list[str]) -> str:
+    """A Go source file of package with the given imports and body lines."""
+    if not re.fullmatch(r"[A-Za-z_]\w*", package) or package in _GO_KEYWORDS:
+        raise ValueError(f"Invalid Go package name: {package!r}")
+    header = [f"package {package}", "", "import ("]
+    header += [f'    "{imp}"' for imp in sorted(imports)]
+    return "\n".join([*header, ")", "", *lines]) + "\n"
+
+
+def _test_call(
+    fragment: str, func_name: str, inputs: bool
+) -> tuple[str, str, bool, set[str], list[str]]:
+    """
+    How a test calls func_name in fragment: the call, its result type,
+    whether it returns an error as well, the imports the call needs and the
+    statements building its arguments. A context is context.Background(), a
+    number of workers 0 (the default) and, with inputs, an input slice the
+    ints 0 to _BENCH_INPUT - 1.
+    """
+    m = re.search(rf"^func {re.escape(func_name)}\(([^)]*)\) (.+) \{{$", fragment, re.M)
+    if not m:
+        raise ValueError(f"No Go function {func_name} to test")
+    imports = set()
+    args = []
+    setup = []
+    slices = re.fullmatch(r"(\w+(?:, \w+)*) \[\]int", m.group(1))
+    if slices and not inputs:
+        raise ValueError("A Go test has no reference value for input slices")
+    for name in slices.group(1).split(", ") if slices else []:
+        setup += [
+            f"    {name} := make([]int, {_BENCH_INPUT})",
+            f"    for i := range {name} {{",
+            f"        {name}[i] = i",
+            "    }",
+        ]
+        args.append(name)
+    for param in filter(None, m.group(1).split(", ")) if not slices else []:
+        if param == "ctx context.Context":
+            imports.add("context")
+            args.append("context.Background()")
+        elif param == "workers int":
+            args.append("0")
+        else:
+            raise ValueError(f"A Go test has no value for the parameter {param}")
+    result = m.group(2)
+    error = re.fullmatch(r"\((?:_ )?(.+), (?:err )?error\)", result)
+    if error:
+        result = error.group(1)
+    call = f"{func_name}({', '.join(args)})"
+    return call, result, bool(error), imports, setup
+
+
+def _benchmark_func(fragment: str, func_name: str) -> tuple[list[str], set[str]]:
+    """The benchmark of render_go_benchmark and the imports it needs."""
+    call, result, error, imports, setup = _test_call(fragment, func_name, inputs=True)
+    exported = f"{func_name[:1].upper()}{func_name[1:]}"
+    sink = f"benchmark{exported}Sink"
+    seq = re.fullmatch(r"iter\.Seq(2?)\[(.+)\]", result)
+    chan = re.fullmatch(r"<-chan (.+)", result)
+    if seq or chan:
+        values = "_, v" if seq and seq.group(1) else "v"
+        result = seq.group(2).split(", ")[-1] if seq else chan.group(1)
+        body = [f"for {values} := range {call} {{", f"    {sink} = v", "}"]
+    elif error:
+        body = [
+            "var err error",
+            f"if {sink}, err = {call}; err != nil {{",
+            "    b.Fatal(err)",
+            "}",
+        ]
+    else:
+        body = [f"{sink} = {call}"]
+    # The sink's type may come from a package, as *sync.Map or *big.Int do
+    imports |= {_GO_PACKAGE_PATHS.get(p, p) for p in re.findall(r"(\w+)\.", result)}
+    lines = [
+        f"// {sink} keeps the result of {func_name}, which the compiler might",
+        "// otherwise drop together with the call.",
+        f"var {sink} {result}",
+        "",
+        f"// Benchmark{exported} times {func_name}, allocations included.",
+        f"func Benchmark{exported}(b *testing.B) {{",
+        *setup,
+        "    b.ReportAllocs()",
+    ]
+    if setup:
+        lines.append("    b.ResetTimer()")
+    lines += [
+        "    for i := 0; i < b.N; i++ {",
+        *[f"        {line}" for line in body],
+        "    }",
+        "}",
+    ]
+    return lines, imports | {"testing"}
+
+
+def _python_source(ir: IRComp) -> str:
+    """ir written back as the Python expression it was parsed from."""
+    clauses = []
+    for gen in ir.generators:
+        source = gen.source
+        if not isinstance(source, str):
+            source = f"range({source.start}, {source.stop}, {source.step})"
+        for cond in gen.take_while:
+            source = f"itertools.takewhile(lambda {gen.var}: {cond}, {source})"
+        clauses.append(f"for {gen.var} in {source}")
+        clauses += [f"if {f}" for f in gen.filters]
+    body = " ".join(clauses)
+    if ir.kind == "dict":
+        code = f"{{{ir.key_expr}: {ir.val_expr} {body}}}"
+    elif ir.kind == "set":
+        code = f"{{{ir.element} {body}}}"
+    elif ir.kind == "list":
+        code = f"[{ir.element} {body}]"
+    else:
+        code = f"({ir.element} {body})"
+    if ir.reduce and ir.reduce.kind == "join":
+        code = f"{ir.reduce.op!r}.join({code[1:-1]})"
+    elif ir.reduce and ir.reduce.kind == "next":
+        default = "" if ir.reduce.initial is None else f", {ir.reduce.initial}"
+        code = f"next({code}{default})"
+    elif ir.reduce:
+        func = "math.prod" if ir.reduce.kind == "prod" else ir.reduce.kind
+        if ir.reduce.initial is not None:
+            name = "start" if ir.reduce.kind in ("sum", "prod") else "default"
+            code = f"{func}({code}, {name}={ir.reduce.initial})"
+        elif ir.kind == "generator":
+            code = f"{func}({code[1:-1]})"
+        else:
+            code = f"{func}({code})"
+    if getattr(ir, "sort", False):
+        code = f"sorted({code})"
+    return code
+
+
+def _reference_value(source: str):
+    """What Python computes for source, a generator's values as a list."""
+    try:
+        value = eval(source, {"math": math, "itertools": itertools})
+    except Exception as e:
+        raise ValueError(f"Python computes no reference value for {source}: {e}")
+    if isinstance(value, types.GeneratorType):
+        value = list(value)
+    return value
+
+
+def _go_literal(value, go_type: str) -> str:
+    """value, a Python result, as a Go expression of go_type."""
+    if go_type == "*big.Int":
+        # compared as fmt prints it
+        return f'"{value}"'
+    if go_type.startswith("[]"):
+        element = go_type[2:]
+        if isinstance(value, dict):
+            value = sorted(value.items())
+        elif isinstance(value, (set, frozenset)):
+            value = sorted(value)
+        items = [_go_literal(v, element) for v in value]
+        return f"{go_type}{{{', '.join(items)}}}"
+    m = re.fullmatch(r"map\[(\w+)\](.+)", go_type)
+    if m:
+        key_type, value_type = m.groups()
+        if value_type == "struct{}":
+            items = [f"{_go_literal(k, key_type)}: {{}}" for k in sorted(value)]
+        else:
+            items = [
+                f"{_go_literal(k, key_type)}: {_go_literal(v, value_type)}"
+                for k, v in sorted(value.items())
+            ]
+        return f"{go_type}{{{', '.join(items)}}}"
+    m = re.fullmatch(r"\[(\d+)\](.+)", go_type)
+    if m:
+        return f"{{{', '.join(_go_literal(v, m.group(2)) for v in value)}}}"
+    if go_type == "bool":
+        return "true" if value else "false"
+    if go_type == "string":
+        return _go_string(value)
+    literal = repr(value) if isinstance(value, float) else str(int(value))
+    return literal if go_type == "int" else f"{go_type}({literal})"
+
+
+# The input slice of a program, read from stdin as a JSON array of ints or
+# as ints separated by whitespace, such as one per line
+_READ_INPUT = [
+    "func readInput() []int {",
+    "    data, err := io.ReadAll(os.Stdin)",
+    "    var xs []int",
+    "    if err == nil && bytes.HasPrefix(bytes.TrimSpace(data), []byte(\"[\")) {",
+    "        err = json.Unmarshal(data, &xs)",
+    "    } else if err == nil {",
+    "        for _, f := range strings.Fields(string(data)) {",
+    "            var x int",
+    "            if x, err = strconv.Atoi(f); err != nil {",
+    "                break",
+    "            }",
+    "            xs = append(xs, x)",
+    "        }",
+    "    }",
+    "    if err != nil {",
+    '        fmt.Fprintln(os.Stderr, "reading input:", err)',
+    "        os.Exit(1)",
+    "    }",
+    "    return xs",
+    "}",
+]
+
+
+STREAM_FORMATS = ("lines", "binary")
+
+# Shared by every streaming program: value input/output for each format.
+# Binary streams are frames of a little-endian uint32 count followed by that
+# many little-endian int64 values; bools are written as 0/1.
+_STREAM_IO = {
+    "lines": """\
+func readValues(r io.Reader, each func(v int) bool) error {
+    sc := bufio.NewScanner(r)
+    for sc.Scan() {
+        line := strings.TrimSpace(sc.Text())
+        if line == "" {
+            continue
+        }
+        v, err := strconv.Atoi(line)
+        if err != nil {
+            return err
+        }
+        if !each(v) {
+            return nil
+        }
+    }
+    return sc.Err()
+}
+
+type valueWriter struct {
+    w   *bufio.Writer
+    buf []byte
+}
+
+func newValueWriter(w io.Writer) *valueWriter {
+    return &valueWriter{w: bufio.NewWriterSize(w, 1<<16)}
+}
+
+func (vw *valueWriter) write(vs ...int) {
+    vw.buf = vw.buf[:0]
+    for i, v := range vs {
+        if i > 0 {
+            vw.buf = append(vw.buf, ' ')
+        }
+        vw.buf = strconv.AppendInt(vw.buf, int64(v), 10)
+    }
+    vw.buf = append(vw.buf, '\\n')
+    vw.w.Write(vw.buf)
+}
+
+func (vw *valueWriter) writeBool(b bool) {
+    vw.w.WriteString(strconv.FormatBool(b) + "\\n")
+}
+
+func (vw *valueWriter) flush() error {
+    return vw.w.Flush()
+}
+""",
+    "binary": """\
+func readValues(r io.Reader, each func(v int) bool) error {
+    br := bufio.NewReaderSize(r, 1<<16)
+    var head [4]byte
+    var buf []byte
+    for {
+        if _, err := io.ReadFull(br, head[:]); err == io.EOF {
+            return nil
+        } else if err != nil {
+            return err
+        }
+        n := int(binary.LittleEndian.Uint32(head[:]))
+        if cap(buf) < 8*n {
+            buf = make([]byte, 8*n)
+        }
+        buf = buf[:8*n]
+        if _, err := io.ReadFull(br, buf); err != nil {
+            return err
+        }
+        for i := 0; i < n; i++ {
+            if !each(int(int64(binary.LittleEndian.Uint64(buf[8*i:])))) {
+                return nil
+            }
+        }
+    }
+}
+
+const frameValues = 4096
+
+type valueWriter struct {
+    w     *bufio.Writer
+    frame []int
+}
+
+func newValueWriter(w io.Writer) *valueWriter {
+    return &valueWriter{w: bufio.NewWriterSize(w, 1<<16)}
+}
+
+func (vw *valueWriter) write(vs ...int) {
+    vw.frame = append(vw.frame, vs...)
+    if len(vw.frame) >= frameValues {
+        vw.emit()
+    }
+}
+
+func (vw *valueWriter) writeBool(b bool) {
+    if b {
+        vw.write(1)
+    } else {
+        vw.write(0)
+    }
+}
+
+func (vw *valueWriter) emit() {
+    if len(vw.frame) == 0 {
+        return
+    }
+    var b [8]byte
+    binary.LittleEndian.PutUint32(b[:4], uint32(len(vw.frame)))
+    vw.w.Write(b[:4])
+    for _, v := range vw.frame {
+        binary.LittleEndian.PutUint64(b[:], uint64(int64(v)))
+        vw.w.Write(b[:])
+    }
+    vw.frame = vw.frame[:0]
+}
+
+func (vw *valueWriter) flush() error {
+    vw.emit()
+    return vw.w.Flush()
+}
+""",
+}
+
+
+def render_go_stream(ir: IRComp, stream_format: str = "lines") -> str:
+    """
+    A complete Go program (package main) that applies the comprehension to
+    values read from stdin and streams results to stdout, usable as a Unix
+    filter. The generator's own source (range or name) is replaced by stdin.
+
+      list  -> one output value per surviving input
+      set   -> first occurrence of each value only
+      dict  -> one "key value" pair per surviving input (last pair wins)
+      reductions -> a single value at end of input; any/all stop reading
+                    as soon as the answer is known
+
+    stream_format selects text ("lines": one integer per line) or "binary"
+    (see _STREAM_IO) for both stdin and stdout.
+    """
+    if stream_format not in STREAM_FORMATS:
+        raise ValueError(f"Unknown Go stream format: {stream_format}")
+    if len(ir.generators) != 1:
+        raise ValueError("Streaming programs support a single generator only")
+    if ir.generators[0].take_while:
+        raise ValueError("Streaming programs do not support takewhile()")
+    _check_tuple_values(ir)
+    ir = _go_filters(_int_division(ir, "py"))
+    gen = ir.generators[0]
+    var = gen.var
+    reduce_kind = ir.reduce.kind if ir.reduce else None
+    if reduce_kind not in (None, "sum", "prod", "max", "min", "any", "all"):
+        raise ValueError(f"Unsupported reduction for streaming: {reduce_kind}")
+
+    imports = ["bufio", "fmt", "io", "os"]
+    if stream_format == "lines":
+        imports += ["strconv", "strings"]
+    else:
+        imports.append("encoding/binary")
+    lines = ["package main", "", "import ("]
+    lines += [f'    "{imp}"' for imp in sorted(imports)]
+    lines += [")", ""]
+    lines += _STREAM_IO[stream_format].splitlines()
+    lines += ["", "func main() {", "    out := newValueWriter(os.Stdout)"]
+
+    if ir.kind == "dict" and not ir.reduce:
+        key = ir.key_expr or var
+        value = ir.val_expr or ir.element or var
+        emit = [f"out.write({key}, {value})"]
+    elif ir.kind == "set" and not ir.reduce:
+        lines.append("    seen := make(map[int]struct{})")
+        emit = [
+            f"if v := {ir.element or var}; !has(seen, v) {{",
+            "    seen[v] = struct{}{}",
+            "    out.write(v)",
+            "}",
+        ]
+    elif reduce_kind is None:
+        emit = [f"out.write({ir.element or var})"]
+    else:
+        expr = (ir.val_expr if ir.kind == "dict" else ir.element) or var
+        if reduce_kind in ("any", "all"):
+            # The answer flips on the first deciding value; stop reading there
+            decided = "true" if reduce_kind == "any" else "false"
+            undecided = "false" if reduce_kind == "any" else "true"
+            want = "" if reduce_kind == "any" else "!"
+            lines.append(f"    acc := {undecided}")
+            emit = [
+                f"if {want}({expr}) {{",
+                f"    acc = {decided}",
+                "    return false",
+                "}",
+            ]
+        else:
+            lines.append(f"    acc := {1 if reduce_kind == 'prod' else 0}")
+            if reduce_kind == "sum":
+                emit = [f"acc += {expr}"]
+            elif reduce_kind == "prod":
+                emit = [f"acc *= {expr}"]
+            else:
+                cmp = ">" if reduce_kind == "max" else "<"
+                lines.append("    seen := false")
+                emit = [
+                    f"if v := {expr}; !seen || v {cmp} acc {{",
+                    "    acc = v",
+                    "    seen = true",
+                    "}",
+                ]
+
+    if gen.filters:
+        guard = f"if {' && '.join(f'({f})' for f in gen.filters)} {{"
+        emit = [guard] + [f"    {s}" for s in emit] + ["}"]
+    lines.append(f"    err := readValues(os.Stdin, func({var} int) bool {{")
+    lines += [f"        {s}" for s in emit]
+    lines.append("        return true")
+    lines.append("    })")
+    if reduce_kind in ("any", "all"):
+        lines += ["    if err == nil {", "        out.writeBool(acc)", "    }"]
+    elif reduce_kind is not None:
+        lines += ["    if err == nil {", "        out.write(acc)", "    }"]
+    lines += [
+        "    if ferr := out.flush(); err == nil {",
+        "        err = ferr",
+        "    }",
+        "    if err != nil {",
+        '        fmt.Fprintln(os.Stderr, "error:", err)',
+        "        os.Exit(1)",
+        "    }",
+        "}",
+    ]
+    if ir.kind == "set" and not ir.reduce:
+        lines += [
+            "",
+            "func has(m map[int]struct{}, v int) bool {",
+            "    _, ok := m[v]",
+            "    return ok",
+            "}",
+        ]
+    code = "\n".join(lines) + "\n"
+    return code + _division_helpers(code, "py")
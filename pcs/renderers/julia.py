@@ -5,6 +5,9 @@ Julia renderer for Polyglot Code Sampler
 from ..backends.julia import lower_program
 from ..core import IRComp
 
+# Results are annotated ::Int and the lowerer rejects nested generators.
+CAPABILITIES = frozenset({"list", "set", "dict", "reduce", "parallel", "sharded_dict"})
+
 
 def render_julia(
     ir: IRComp,
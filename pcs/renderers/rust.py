@@ -4,6 +4,9 @@ Rust renderer for Polyglot Code Sampler
 
 from ..core import IRComp
 
+# Element types are fixed to --int-type, so no floats; nested is a stub.
+CAPABILITIES = frozenset({"list", "set", "dict", "reduce", "parallel"})
+
 
 def render_rust(
     ir: IRComp,
@@ -4,6 +4,9 @@ SQL renderer for Polyglot Code Sampler
 
 from ..core import IRComp
 
+# SQL has no parallel flavour here, and nested generators are a stub.
+CAPABILITIES = frozenset({"list", "set", "dict", "reduce", "float"})
+
 
 def render_sql(ir: IRComp, func_name: str = "program", dialect: str = "sqlite") -> str:
     """
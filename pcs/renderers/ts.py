@@ -4,6 +4,9 @@ TypeScript renderer for Polyglot Code Sampler
 
 from ..core import IRComp
 
+# `number` already covers floats; nested generators are still a stub.
+CAPABILITIES = frozenset({"list", "set", "dict", "reduce", "parallel", "float"})
+
 
 def render_ts(ir: IRComp, func_name: str = "program", parallel: bool = False) -> str:
     """
@@ -77,6 +77,8 @@ def load_all_results():
                         continue
                     try:
                         data = json.loads(line)
+                        if "record" in data:
+                            continue  # run header, not a result
 
                         # Validate against schema
                         warnings = validate_record(data, schema)
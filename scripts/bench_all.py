@@ -78,8 +78,14 @@ def run_backend_bench(backend, script_name, description):
         cmd = ["node", str(script_path)]
     elif script_name.endswith(".go"):
         # Compile and run Go script
+        # The harness is split across bench_go*.go files in package main
         go_binary = TARGETDIR / f"bench_{backend}"
-        compile_cmd = ["go", "build", "-o", str(go_binary), str(script_path)]
+        go_sources = sorted(
+            str(p)
+            for p in script_path.parent.glob(f"{script_path.stem}*.go")
+            if not p.name.endswith("_test.go")
+        )
+        compile_cmd = ["go", "build", "-o", str(go_binary), *go_sources]
         if run(compile_cmd):
             cmd = [str(go_binary)]
         else:
@@ -117,16 +123,18 @@ def run_backend_bench(backend, script_name, description):
 
     # Parse NDJSON output
     lines = []
+    results = 0
     for line in output.strip().splitlines():
         line = line.strip()
         if line and line.startswith("{"):
             try:
-                json.loads(line)  # Validate JSON
+                data = json.loads(line)  # Validate JSON
                 lines.append(line)
+                results += "record" not in data  # run headers are not results
             except json.JSONDecodeError:
                 print(f"⚠️ Invalid JSON line: {line}", file=sys.stderr)
 
-    print(f"✅ {description}: {len(lines)} benchmark results")
+    print(f"✅ {description}: {results} benchmark results")
     return lines
 
 
@@ -202,6 +210,8 @@ def main():
     for line in all_lines:
         try:
             data = json.loads(line)
+            if "record" in data:
+                continue
             backend = data.get("backend", "unknown")
             backend_counts[backend] = backend_counts.get(backend, 0) + 1
         except json.JSONDecodeError:
@@ -8,8 +8,56 @@ namespace PCSBenchmark
 {
     class Program
     {
-        static (long mean, long std) Bench(Action action, int reps = 10)
+        // Untimed calls before measuring, per PCS_BENCH_PROTOCOL (same protocols
+        // as the Go driver): "cold" none, "warmup" a fixed PCS_BENCH_WARMUP,
+        // "steady" until five calls in a row vary by under 5% (at most 50).
+        // Tiered JIT recompiles hot methods after the first calls, so "steady"
+        // is the default.
+        static int Warmup(Action action, string protocol, int fixedWarmup)
         {
+            if (protocol == "cold")
+            {
+                return 0;
+            }
+            if (protocol == "warmup")
+            {
+                for (int i = 0; i < fixedWarmup; i++)
+                {
+                    action();
+                }
+                return fixedWarmup;
+            }
+
+            var window = new System.Collections.Generic.Queue<double>();
+            for (int i = 1; i <= 50; i++)
+            {
+                var stopwatch = Stopwatch.StartNew();
+                action();
+                stopwatch.Stop();
+                window.Enqueue(stopwatch.ElapsedTicks);
+                if (window.Count > 5)
+                {
+                    window.Dequeue();
+                }
+                if (window.Count == 5)
+                {
+                    double mean = 0;
+                    foreach (var t in window) mean += t;
+                    mean /= 5;
+                    double variance = 0;
+                    foreach (var t in window) variance += (t - mean) * (t - mean);
+                    if (Math.Sqrt(variance / 5) < 0.05 * mean)
+                    {
+                        return i;
+                    }
+                }
+            }
+            return 50;
+        }
+
+        static (long mean, long std, int warmup) Bench(Action action, int reps = 10, string protocol = "steady", int fixedWarmup = 3)
+        {
+            int warmed = Warmup(action, protocol, fixedWarmup);
             var times = new long[reps];
 
             for (int i = 0; i < reps; i++)
@@ -34,7 +82,7 @@ namespace PCSBenchmark
             }
             long std = (long)Math.Sqrt(variance / (double)times.Length);
 
-            return (mean, std);
+            return (mean, std, warmed);
         }
 
         static string GetEnv(string key, string defaultValue)
@@ -50,6 +98,8 @@ namespace PCSBenchmark
             var cpu = GetEnv("CPU_INFO", Environment.ProcessorCount.ToString());
             var nStr = GetEnv("PCS_BENCH_N", "1000000");
             int n = int.TryParse(nStr, out int parsedN) ? parsedN : 1000000;
+            var protocol = GetEnv("PCS_BENCH_PROTOCOL", "steady");
+            int fixedWarmup = int.TryParse(GetEnv("PCS_BENCH_WARMUP", "3"), out int parsedWarmup) ? parsedWarmup : 3;
 
             // Test cases to benchmark
             var testCases = new[]
@@ -134,7 +184,7 @@ namespace PCSBenchmark
                     }
 
                     // Run the benchmark
-                    var (mean, std) = Bench(() =>
+                    var (mean, std, warmed) = Bench(() =>
                     {
                         // This would call the actual generated function
                         // For now, we'll simulate the work
@@ -146,7 +196,7 @@ namespace PCSBenchmark
                                 sum += i * i;
                             }
                         }
-                    }, 10);
+                    }, 10, protocol, fixedWarmup);
 
                     var result = new
                     {
@@ -160,7 +210,9 @@ namespace PCSBenchmark
                         parallel = testCase.Parallel,
                         n,
                         mean_ns = mean,
-                        std_ns = std
+                        std_ns = std,
+                        protocol,
+                        warmup_iters = warmed
                     };
 
                     Console.WriteLine(JsonSerializer.Serialize(result));
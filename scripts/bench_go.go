@@ -1,56 +1,239 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// BenchmarkResult is one NDJSON record. RunID refers to the run header that
+// opens the stream (see runHeader). Git holds the branch, nearest tag, dirty
+// flag and pull request of Commit (see gitInfo). CPUs is the Linux CPU list
+// the benchmark process was pinned to, if any; GOGC and GOMemLimit are the
+// GC settings it ran with (see gcSettings.effective), and Nice its niceness
+// (-nice; absent on Windows and runners), and Cgroup the limits of the
+// cgroup it was confined to (-cgroup-cpus, -cgroup-memory). Env is the
+// harness's environment, cgroup limits and virtualization (see envSnapshot).
+// Binary is set on results of a previously built binary (-compare-binary).
+// Artifacts locates the case's kept sources, build log and binary
+// (-keep-artifacts, -artifacts-dir). MachineBefore and MachineAfter are the
+// machine's load, frequency and thermal state around the timed runs (see
+// machineState). CooldownNs is how long the harness paused before the run
+// (-cooldown).
+//
+// CodegenMs is the wall time of generating the case's code, absent when it
+// came from the cache or an earlier size of the case. WarmupMs and MeasureMs
+// split the benchmark process's wall time into the timed calls and the rest,
+// startup and warmup calls, as the -otlp spans do (see traceRun). CompileMs
+// is the wall time of go build for the generated program and BinaryBytes the
+// size of the binary it produced; BuildCached marks a binary taken from the
+// build cache (-cache) or an earlier case of the run, whose CompileMs is
+// that of the build that filled it. BuildFlags are the case's extra go build
+// flags. Target is the GOOS/GOARCH of a cross-compiled case (-targets), with
+// OS and CPU set to match; it is absent for the host. Toolchain is the
+// compiler, gc or tinygo, and GoVersion the version of Go a gc build used
+// (-go-versions), as stamped in the binary, with the rest of its stamped
+// build settings in BuildSettings. ModuleHash hashes the Go sources the
+// binary was built from and HarnessVersion identifies the harness build (see
+// harnessVersion), which Harness describes in full (see harnessBuild).
+// ContainerImage is the digest of the image the case ran in (-container).
+//
+// Estimator names the estimator MeanNs and StdNs were computed with (see
+// estimator). PGO marks results of a case's profile-guided rebuild (-pgo).
+// Perf holds hardware counters per call (-perf) and Sched what the scheduler
+// sampler saw during a parallel case's timed calls (-sched). Energy is what
+// the machine's RAPL counters measured over the run (-energy). CPUNs is the
+// benchmark process's user+system CPU time per call, warmup calls and
+// process startup included, and Resources the rest of what the OS accounted
+// to the process, with null for what it does not report (see procPlatform).
+// Protocol names the warmup protocol the timings were taken under. Verified
+// marks results whose program computed what its Python snippet does
+// (-verify), and AllocsPerOp holds the heap allocations per call of a
+// zero_alloc case (-allocs). Samples are the raw per-call timings the
+// statistics were computed from, and LatencyHDR the same timings as an
+// encoded HDR histogram (see hdrHistogram). Attempts counts the attempts of
+// its steps when the run retries them (-retries).
+//
+// A failed result has an Error message, an ErrorClass (see errSetup) and,
+// where a process failed, an ErrorDetail. A skipped result was never run:
+// SkipReason is a machine-readable code (see skipUnsupported) and Missing
+// lists the constructs the backend lacks. Data is the distribution a data
+// case's input was drawn from at N and DataSeed the seed that drew it (see
+// dataSpec). Labels are the run's -label and -labels-file labels.
 type BenchmarkResult struct {
-	Commit    string `json:"commit"`
-	Timestamp string `json:"timestamp"`
-	OS        string `json:"os"`
-	CPU       string `json:"cpu"`
-	Backend   string `json:"backend"`
-	Test      string `json:"test"`
-	Mode      string `json:"mode"`
-	Parallel  bool   `json:"parallel"`
-	N         int    `json:"n"`
-	MeanNs    int64  `json:"mean_ns"`
-	StdNs     int64  `json:"std_ns"`
-	Error     string `json:"error,omitempty"`
+	SchemaVersion  int               `json:"schema_version,omitempty"`
+	RunID          string            `json:"run_id,omitempty"`
+	Commit         string            `json:"commit"`
+	Git            *gitInfo          `json:"git,omitempty"`
+	Timestamp      string            `json:"timestamp"`
+	OS             string            `json:"os"`
+	CPU            string            `json:"cpu"`
+	Backend        string            `json:"backend"`
+	Test           string            `json:"test"`
+	Mode           string            `json:"mode"`
+	Parallel       bool              `json:"parallel"`
+	N              int               `json:"n"`
+	MeanNs         int64             `json:"mean_ns"`
+	StdNs          int64             `json:"std_ns"`
+	MedianNs       int64             `json:"median_ns"`
+	P99Ns          int64             `json:"p99_ns"`
+	CPUNs          int64             `json:"cpu_ns,omitempty"`
+	Resources      *resourceUsage    `json:"resources,omitempty"`
+	CodegenMs      float64           `json:"codegen_ms,omitempty"`
+	CompileMs      float64           `json:"compile_ms,omitempty"`
+	WarmupMs       float64           `json:"warmup_ms,omitempty"`
+	MeasureMs      float64           `json:"measure_ms,omitempty"`
+	BuildCached    bool              `json:"build_cached,omitempty"`
+	BinaryBytes    int64             `json:"binary_bytes,omitempty"`
+	BuildFlags     []string          `json:"build_flags,omitempty"`
+	Target         string            `json:"target,omitempty"`
+	Toolchain      string            `json:"toolchain,omitempty"`
+	GoVersion      string            `json:"go_version,omitempty"`
+	BuildSettings  map[string]string `json:"build_settings,omitempty"`
+	ModuleHash     string            `json:"module_hash,omitempty"`
+	HarnessVersion string            `json:"harness_version,omitempty"`
+	Harness        *harnessBuild     `json:"harness,omitempty"`
+	ContainerImage string            `json:"container_image,omitempty"`
+	Estimator      string            `json:"estimator,omitempty"`
+	GOMAXPROCS     int               `json:"gomaxprocs,omitempty"`
+	CPUs           string            `json:"cpu_affinity,omitempty"`
+	GOGC           string            `json:"gogc,omitempty"`
+	GOMemLimit     string            `json:"gomemlimit,omitempty"`
+	Nice           *int              `json:"nice,omitempty"`
+	Cgroup         *cgroupLimit      `json:"cgroup,omitempty"`
+	Env            *envSnapshot      `json:"env,omitempty"`
+	Binary         string            `json:"binary,omitempty"`
+	PGO            bool              `json:"pgo,omitempty"`
+	Artifacts      *caseArtifacts    `json:"artifacts,omitempty"`
+	MachineBefore  *machineState     `json:"machine_before,omitempty"`
+	MachineAfter   *machineState     `json:"machine_after,omitempty"`
+	CooldownNs     int64             `json:"cooldown_ns,omitempty"`
+	Perf           *perfCounts       `json:"perf,omitempty"`
+	Sched          *schedStats       `json:"sched,omitempty"`
+	Energy         *energyUse        `json:"energy,omitempty"`
+	Protocol       string            `json:"protocol,omitempty"`
+	Verified       bool              `json:"verified,omitempty"`
+	AllocsPerOp    *float64          `json:"allocs_per_op,omitempty"`
+	Warmup         int               `json:"warmup_iters,omitempty"`
+	Samples        []int64           `json:"samples_ns,omitempty"`
+	LatencyHDR     string            `json:"latency_hdr,omitempty"`
+	Attempts       *phaseAttempts    `json:"attempts,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	ErrorClass     string            `json:"error_class,omitempty"`
+	ErrorDetail    *errorDetail      `json:"error_detail,omitempty"`
+	Skipped        bool              `json:"skipped,omitempty"`
+	SkipReason     string            `json:"skip_reason,omitempty"`
+	Missing        []string          `json:"missing,omitempty"`
+	Data           string            `json:"data,omitempty"`
+	DataSeed       *int64            `json:"data_seed,omitempty"`
+	Labels         runLabels         `json:"labels,omitempty"`
+	Aggregate      *dailyAggregate   `json:"aggregate,omitempty"`
 }
 
-func bench(f func(), reps int) (int64, int64) {
-	times := make([]int64, reps)
+// skipUnsupported is the SkipReason for cases that need constructs the
+// backend's capability matrix does not list.
+const skipUnsupported = "unsupported_construct"
 
-	for i := 0; i < reps; i++ {
-		start := time.Now()
-		f()
-		elapsed := time.Since(start)
-		times[i] = elapsed.Nanoseconds()
-	}
+// measured reports whether r carries timings, i.e. it neither failed nor
+// was skipped.
+func (r BenchmarkResult) measured() bool {
+	return r.Error == "" && !r.Skipped
+}
 
-	// Calculate mean
-	var sum int64
-	for _, t := range times {
-		sum += t
+// benchCase is one entry of the benchmark matrix. Flags are passed to the
+// code generator verbatim; Runtime lists vendored Go sources the generated
+// code depends on. Measure "lookup" times reads from the built result
+// instead of building it. Requires names the constructs (see
+// `pcs --capabilities`) the case exercises; cases the backend does not
+// support are skipped rather than reported as failures. Sizes, when set,
+// replaces the -sizes list for this entry. More holds further reductions over
+// the same range that are rendered into the same function as Code. Stream
+// ("lines" or "binary") benchmarks Code as a generated stdin-to-stdout
+// filter program instead (see bench_go_stream.go). Data, when set, is the
+// distribution of a generated input the Code iterates as data (see
+// bench_go_data.go). Stages, when set, replaces
+// Code with a pipeline of "name=expr" stages (pcs --stage). GC overrides
+// -gogc and -gomemlimit for this entry. BuildFlags are passed to go build,
+// e.g. -gcflags=-B to drop bounds checks. Estimator overrides -estimator.
+// Target cross-compiles the entry for a GOOS/GOARCH pair (see crossCases).
+// Toolchain "tinygo" builds it with TinyGo instead of gc; Go, when set, is
+// the gc toolchain to build with (see goVersionCases). Backend, set only on
+// the copies backendCases makes, runs the entry on another backend than Go.
+// After and Needs order the entry
+// after other cases (see orderCases).
+type benchCase struct {
+	Test       string
+	Mode       string
+	Parallel   bool
+	Code       string
+	More       []string
+	Stages     []string
+	Flags      []string
+	Runtime    []string
+	Measure    string
+	Stream     string
+	Data       string
+	GC         gcSettings
+	BuildFlags []string
+	Estimator  string
+	Target     string
+	Toolchain  string
+	Go         goToolchain
+	Backend    string
+	Requires   []string
+	Sizes      []int
+	After      []string
+	Needs      []string
+	// ZeroAlloc marks a case whose calls must not allocate (-allocs)
+	ZeroAlloc bool
+}
+
+type benchStats struct {
+	Mean   int64
+	Std    int64
+	Median int64
+	P99    int64
+}
+
+func summarize(times []int64) benchStats {
+	return summarizeWith(classicEstimator{}, times)
+}
+
+// summarizeWith is summarize with Mean and Std taken from est.
+func summarizeWith(est estimator, times []int64) benchStats {
+	if len(times) == 0 {
+		return benchStats{}
 	}
-	mean := sum / int64(len(times))
 
-	// Calculate standard deviation
-	var variance int64
-	for _, t := range times {
-		diff := t - mean
-		variance += diff * diff
+	sorted := append([]int64(nil), times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	center, spread := est.estimate(sorted)
+
+	return benchStats{
+		Mean:   int64(center),
+		Std:    int64(spread),
+		Median: percentile(sorted, 50),
+		P99:    percentile(sorted, 99),
 	}
-	std := int64(float64(variance) / float64(len(times)))
+}
 
-	return mean, std
+// percentile uses the nearest-rank method on an already sorted slice.
+func percentile(sorted []int64, p float64) int64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
 }
 
 func getEnv(key, defaultValue string) string {
@@ -60,117 +243,1277 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-func main() {
-	commit := getEnv("GITHUB_SHA", "local")
-	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05Z")
-	os := runtime.GOOS
-	cpu := getEnv("CPU_INFO", runtime.GOARCH)
-	nStr := getEnv("PCS_BENCH_N", "1000000")
-	n, _ := strconv.Atoi(nStr)
+// generateCase runs the code generator for one case (see runPCS). dir is
+// the checkout to run it from ("" for the current directory).
+func generateCase(dir string, tc benchCase, n int) ([]byte, error) {
+	return runPCS(dir, 0, generatorArgs(tc, n)[2:]...)
+}
+
+// generatorArgs are the python3 arguments generating tc at size n.
+func generatorArgs(tc benchCase, n int) []string {
+	args := []string{"-m", "pcs", "--target", tc.pcsTarget()}
+	if tc.Stages != nil {
+		for _, stage := range tc.Stages {
+			args = append(args, "--stage", strings.ReplaceAll(stage, "{N}", strconv.Itoa(n)))
+		}
+	} else {
+		for _, code := range append([]string{tc.Code}, tc.More...) {
+			args = append(args, "--code", strings.ReplaceAll(code, "{N}", strconv.Itoa(n)))
+		}
+	}
+	if tc.Parallel {
+		args = append(args, "--parallel")
+	}
+	if tc.Stream != "" {
+		args = append(args, "--go-stream", tc.Stream)
+	}
+	return append(args, tc.Flags...)
+}
+
+// fusedReductions are cheap, loop-bound reductions over the same range as the
+// fusion cases' Code, so one pass vs four shows the cost of re-walking the
+// input rather than of the arithmetic.
+var fusedReductions = []string{
+	"sum(i*i for i in range(1, {N}) if i%3==0)",
+	"max(i%1000 for i in range(1, {N}) if i%7==1)",
+	"sum(1 for i in range(1, {N}) if i%2==0)",
+}
+
+// pipelineStages feeds a filtered, mapped intermediate into a reduction, so
+// materializing it costs an allocation and a second pass that fusing avoids.
+var pipelineStages = []string{
+	"evens=[x*x for x in range(1, {N}) if x%2==0]",
+	"total=sum(y%1000 for y in evens if y%3==0)",
+}
+
+// dictBaseline is the sequential build the sharded dict variants are
+// compared against.
+var dictBaseline = []string{"dict_comp_loops"}
+
+// benchCases is the benchmark matrix; {N} in each snippet is replaced by
+// each input size (-sizes, default PCS_BENCH_N) in turn.
+func benchCases() []benchCase {
+	return []benchCase{
+		{Test: "sum_even_squares", Mode: "loops", Code: "sum(i*i for i in range(1, {N}) if i%2==0)", Requires: []string{"reduce"}, ZeroAlloc: true},
+		{Test: "sum_even_squares", Mode: "parallel", Parallel: true, Code: "sum(i*i for i in range(1, {N}) if i%2==0)", Requires: []string{"reduce", "parallel"},
+			After: []string{"sum_even_squares_loops"}},
+		{Test: "sum_even_squares", Mode: "helpers", Code: "sum(i*i for i in range(1, {N}) if i%2==0)", Flags: []string{"--go-emit", "helpers"},
+			Runtime: []string{"pcs/backends/go/pcs_helpers.go"}, Requires: []string{"reduce"}},
+		{Test: "sum_even_squares", Mode: "iter", Code: "sum(i*i for i in range(1, {N}) if i%2==0)", Flags: []string{"--go-emit", "iter"}, Requires: []string{"reduce"}},
+		{Test: "sum_even_squares", Mode: "chan", Code: "sum(i*i for i in range(1, {N}) if i%2==0)", Flags: []string{"--go-emit", "chan"}, Requires: []string{"reduce"}},
+		{Test: "set_comp", Mode: "loops", Code: "{x*x % 10007 for x in range(1, {N}) if x%3==0}", Requires: []string{"set"}},
+		{Test: "set_comp", Mode: "sorted", Code: "{x*x % 10007 for x in range(1, {N}) if x%3==0}", Flags: []string{"--go-set-result", "sorted"}, Requires: []string{"set"}},
+		{Test: "dict_comp", Mode: "loops", Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Requires: []string{"dict"}},
+		{Test: "dict_comp", Mode: "loops_no_presize", Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Flags: []string{"--no-presize"}, Requires: []string{"dict"}},
+		{Test: "dict_comp", Mode: "loops_gogc_off", Code: "{x: x*x for x in range(1, {N}) if x%3==0}", GC: gcSettings{GOGC: "off"}, Requires: []string{"dict"}},
+		{Test: "dict_comp", Mode: "loops_swiss", Code: "{x: x*x for x in range(1, {N}) if x%3==0}",
+			Flags: []string{"--go-map-impl", "swiss"}, Runtime: []string{"pcs/backends/go/pcs_swiss.go"}, Requires: []string{"dict"}},
+		{Test: "dict_comp", Mode: "helpers", Code: "{x: x*x for x in range(1, {N}) if x%3==0}",
+			Flags: []string{"--go-emit", "helpers"}, Runtime: []string{"pcs/backends/go/pcs_helpers.go"}, Requires: []string{"dict"}},
+		{Test: "dict_comp", Mode: "loops_no_inline", Code: "{x: x*x for x in range(1, {N}) if x%3==0}", BuildFlags: []string{"-gcflags=-l"}, Requires: []string{"dict"}},
+		{Test: "dict_comp", Mode: "loops_stripped", Code: "{x: x*x for x in range(1, {N}) if x%3==0}", BuildFlags: []string{"-trimpath", "-ldflags=-s -w"}, Requires: []string{"dict"}},
+		{Test: "dict_comp", Mode: "loops_tinygo", Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Toolchain: "tinygo", Requires: []string{"dict"}},
+		{Test: "dict_comp", Mode: "sharded_ordered", Parallel: true, Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Flags: []string{"--go-shard-merge", "ordered"}, Requires: []string{"sharded_dict"}, After: dictBaseline},
+		{Test: "dict_comp", Mode: "sharded_sized", Parallel: true, Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Flags: []string{"--go-shard-merge", "sized"}, Requires: []string{"sharded_dict"}, After: dictBaseline},
+		{Test: "dict_comp", Mode: "sharded_adopt", Parallel: true, Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Flags: []string{"--go-shard-merge", "adopt"}, Requires: []string{"sharded_dict"}, After: dictBaseline},
+		{Test: "dict_comp", Mode: "sharded_wrap", Parallel: true, Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Flags: []string{"--go-shard-merge", "wrap"}, Requires: []string{"sharded_dict"}, After: dictBaseline},
+		{Test: "dict_comp", Mode: "sharded_wrap_tinygo", Parallel: true, Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Flags: []string{"--go-shard-merge", "wrap"}, Toolchain: "tinygo",
+			Requires: []string{"sharded_dict"}, After: dictBaseline},
+		{Test: "dict_comp", Mode: "sync_map", Parallel: true, Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Flags: []string{"--go-map-impl", "sync"}, Requires: []string{"sharded_dict"}, After: dictBaseline},
+		{Test: "dict_lookup", Mode: "merged", Parallel: true, Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Measure: "lookup", Requires: []string{"sharded_dict"}},
+		{Test: "fusion", Mode: "separate", Code: "sum(i for i in range(1, {N}))", More: fusedReductions, Requires: []string{"reduce", "fusion"}},
+		{Test: "fusion", Mode: "fused", Code: "sum(i for i in range(1, {N}))", More: fusedReductions, Flags: []string{"--fuse"}, Requires: []string{"reduce", "fusion"}},
+		{Test: "pipeline", Mode: "materialized", Stages: pipelineStages, Requires: []string{"list", "reduce", "pipeline"}},
+		{Test: "pipeline", Mode: "materialized_no_bounds_check", Stages: pipelineStages, BuildFlags: []string{"-gcflags=-B"}, Requires: []string{"list", "reduce", "pipeline"}},
+		{Test: "pipeline", Mode: "fused", Stages: pipelineStages, Flags: []string{"--fuse"}, Requires: []string{"list", "reduce", "pipeline"}},
+		{Test: "stream_filter", Mode: "lines", Code: "[x*x for x in range(1, {N}) if x%3==0]", Stream: "lines", Requires: []string{"list", "stream"}},
+		{Test: "stream_filter", Mode: "binary", Code: "[x*x for x in range(1, {N}) if x%3==0]", Stream: "binary", Requires: []string{"list", "stream"}},
+		{Test: "data_filter_sum", Mode: "uniform", Code: "sum(x for x in data if x % 7 == 0)", Data: "uniform", Requires: []string{"reduce"}},
+		{Test: "data_filter_sum", Mode: "zipf", Code: "sum(x for x in data if x % 7 == 0)", Data: "zipf", Requires: []string{"reduce"}},
+		{Test: "data_filter_sum", Mode: "permutation", Code: "sum(x for x in data if x % 7 == 0)", Data: "permutation", Requires: []string{"reduce"}},
+		{Test: "dict_lookup", Mode: "sharded_wrap", Parallel: true, Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Flags: []string{"--go-shard-merge", "wrap"}, Measure: "lookup", Requires: []string{"sharded_dict"}},
+		{Test: "dict_lookup", Mode: "sync_map", Parallel: true, Code: "{x: x*x for x in range(1, {N}) if x%3==0}", Flags: []string{"--go-map-impl", "sync"}, Measure: "lookup", Requires: []string{"sharded_dict"}},
+	}
+}
+
+// procsLevels returns the GOMAXPROCS levels of a scaling sweep: powers of
+// two below max, then max itself.
+func procsLevels(max int) []int {
+	var levels []int
+	for p := 1; p < max; p *= 2 {
+		levels = append(levels, p)
+	}
+	return append(levels, max)
+}
+
+// parseSizes reads a comma-separated list of input sizes. Each size may be
+// written as an integer (1000000, 1_000_000) or in exponent form (1e6).
+func parseSizes(list string) ([]int, error) {
+	var sizes []int
+	for _, f := range strings.Split(list, ",") {
+		f = strings.TrimSpace(f)
+		n, err := strconv.ParseInt(f, 0, 64)
+		if err != nil {
+			v, ferr := strconv.ParseFloat(f, 64)
+			if ferr != nil || v != math.Trunc(v) || v > math.MaxInt64 {
+				return nil, fmt.Errorf("invalid size %q", f)
+			}
+			n = int64(v)
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("size %q must be positive", f)
+		}
+		sizes = append(sizes, int(n))
+	}
+	return sizes, nil
+}
+
+// runBench implements `run`, the default command: it generates, builds and
+// times every case and writes one result per case and size.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench [run] [flags]\n")
+		fmt.Fprintf(fs.Output(), "Run 'pcs-bench help' for the other commands.\n")
+		fs.PrintDefaults()
+	}
+	backendName := fs.String("backend", "go", "backends to generate, build and time cases with, comma-separated: go, rust, ts, julia or cgo; with several, the portable cases run on each and a comparison table ends the run")
+	format := fs.String("format", "ndjson", "result output format: ndjson, influx, gbench (one Google Benchmark JSON document at the end) or tap (TAP 13, not ok for failures and -baseline regressions)")
+	output := fs.String("output", "", "write results in -format to this file, renamed into place once the run is over (see -append), instead of standard output")
+	appendOutput := fs.Bool("append", false, "append each result to the -output NDJSON file as it is measured, so a crash keeps the results so far, instead of renaming a complete file into place")
+	fsyncFlag := fs.Bool("fsync", true, "with -append, fsync the -output file after each record (false: once the run is over)")
+	pretty := fs.Bool("pretty", false, "show a table of results with deltas vs -baseline and a summary on standard output instead of -format (see -output)")
+	junitPath := fs.String("junit", "", "write a JUnit XML report to this file")
+	baselinePath := fs.String("baseline", "", "NDJSON results file to compare against")
+	threshold := fs.Float64("threshold", 0.15, "relative slowdown vs baseline counted as a regression; when not given, this machine's -calibration if it has one")
+	calibrationPath := fs.String("calibration", "bench/calibration.json", "per-machine minimum detectable effects measured by pcs-bench calibrate")
+	minSpeedup := fs.Float64("min-speedup", 0, "exit 1 when a parallel case is less than this many times faster than its loops case (0: no floor)")
+	historyPath := fs.String("history", "", "append results to this SQLite history database")
+	procsSweep := fs.Bool("procs-sweep", false, "run each parallel case at GOMAXPROCS = 1, 2, 4, ... up to -max-procs")
+	maxProcs := fs.Int("max-procs", runtime.NumCPU(), "highest GOMAXPROCS level for -procs-sweep")
+	chunkSweepFlag := fs.Bool("chunk-sweep", false, "also run each parallel case with run-time chunk sizing (pcs --go-chunking auto), by default at -sizes 1e3 up to 1e7, and compare the two")
+	cpus := fs.String("cpus", os.Getenv("PCS_BENCH_CPUS"), "pin benchmark processes to these CPUs, e.g. 2-3 (Linux via taskset; Windows via the affinity mask each process inherits at creation)")
+	niceFlag := fs.String("nice", os.Getenv("PCS_BENCH_NICE"), "niceness of benchmark processes, -20 to 19; below the current level needs root or CAP_SYS_NICE; on Windows 19, 10, 0, -5 or -10 for a priority class (default: inherit)")
+	physicalCores := fs.Bool("physical-cores", false, "pin benchmark processes to one logical CPU per physical core, within -cpus if set (Linux)")
+	var gc gcSettings
+	fs.StringVar(&gc.GOGC, "gogc", "", "GOGC for benchmark processes, e.g. 50 or off (default: inherit)")
+	fs.StringVar(&gc.GOMemLimit, "gomemlimit", "", "GOMEMLIMIT for benchmark processes, e.g. 512MiB or off (default: inherit)")
+	profile := fs.String("profile", os.Getenv("PCS_BENCH_PROFILE"), "name of this run's benchmark profile, e.g. ci or nightly, recorded in the run header")
+	fs.Int64Var(&dataSeed, "seed", dataSeed, "seed for randomized orders in the timing driver (lookup cases) and generated inputs (data cases)")
+	pgo := fs.Bool("pgo", false, "also rebuild each case with a CPU profile of its own run (go build -pgo) and time both builds")
+	perf := fs.Bool("perf", false, "record hardware counters (instructions, cycles, branch and cache misses) via perf stat (Linux)")
+	redact := fs.Bool("redact", false, "hash the hostname and username and strip or hash file paths in results, so they can be published")
+	energy := fs.Bool("energy", false, "read RAPL energy counters (Linux, Intel and AMD) around each run and report joules per call and watts")
+	fs.BoolVar(&schedSample, "sched", false, "sample the Go scheduler (goroutines, threads, scheduling latency, mutex wait) during the timed calls of parallel cases")
+	fs.BoolVar(&schedTrace, "sched-trace", false, "with -sched, also record a runtime/trace of those calls in the case's artifacts and summarize its blocking")
+	estimatorFlag := fs.String("estimator", "classic", "estimator for mean_ns and std_ns: classic (mean/std), robust (median/MAD), trimmed or trimmed:<fraction>")
+	cooldownFlag := fs.String("cooldown", "0", "pause before each measured run after the first: a duration such as 5s, or adaptive")
+	cooldownLoad := fs.Float64("cooldown-load", 0.5, "adaptive cooldown: wait until the 1-minute load average is at most this")
+	cooldownMax := fs.Duration("cooldown-max", 2*time.Minute, "adaptive cooldown: longest wait before each run")
+	maxRSSFlag := fs.String("max-rss", os.Getenv("PCS_BENCH_MAX_RSS"), "kill a benchmark process whose RSS exceeds this, e.g. 4GiB, and report oom_guard (default: no limit)")
+	cgroupCPUs := fs.Float64("cgroup-cpus", 0, "confine each benchmark process to a transient cgroup v2 with this CPU quota, e.g. 1.5 (Linux; 0: no limit)")
+	cgroupMemory := fs.String("cgroup-memory", "", "confine each benchmark process to a transient cgroup v2 with this memory.max, e.g. 2GiB (Linux)")
+	cgroupParent := fs.String("cgroup-parent", "", "cgroup v2 directory to create -cgroup-cpus and -cgroup-memory cgroups in (default: the harness's own)")
+	timeout := fs.Duration("timeout", 0, "kill a benchmark process running longer than this and report a timeout (0: no limit)")
+	var retry retryPolicy
+	fs.IntVar(&retry.Retries, "retries", 0, "attempt a case's failed generate or compile step up to this many more times")
+	fs.DurationVar(&retry.Backoff, "retry-backoff", 2*time.Second, "wait before the first retry, doubled before each further one")
+	fs.Float64Var(&retry.CV, "retry-cv", 0, "with -retries, also re-time a case whose std_ns/mean_ns exceeds this, e.g. 0.05 (0: never)")
+	targetsFlag := fs.String("targets", "", "also cross-compile every case for these GOOS/GOARCH pairs, e.g. linux/arm64,darwin/arm64")
+	var remoteSpecs []string
+	fs.Func("remote", "run cross-compiled cases on a remote runner: GOOS/GOARCH=COMMAND, e.g. linux/arm64='ssh bench@arm64-box' (repeatable)", func(s string) error {
+		remoteSpecs = append(remoteSpecs, s)
+		return nil
+	})
+	goVersionsFlag := fs.String("go-versions", "", "build and time every case with each of these Go toolchains: GOROOT directories, go binaries or commands such as go1.22.5 (golang.org/dl)")
+	containerImage := fs.String("container", "", "build and run host cases in this container image (pin it by digest, e.g. golang:1.22@sha256:...) via docker or podman")
+	containerEngine := fs.String("container-engine", "", "container CLI for -container: docker or podman (default: docker if installed)")
+	containerCPUs := fs.String("container-cpus", "2", "CPU limit of -container runs (--cpus)")
+	containerMemory := fs.String("container-memory", "2g", "memory limit of -container runs (--memory)")
+	wasmFlag := fs.String("wasm", "", "also build every case for WebAssembly and run it in this runtime: node (js/wasm), wazero or wasmtime (wasip1/wasm)")
+	compareBinary := fs.String("compare-binary", "", "re-time this previously built case binary, or directory of them, alongside this build")
+	var caseFiles []string
+	fs.Func("cases", "also run the cases of this JSON file, an array of {test, mode, code | code_file | stages | stages_file, ...} entries (repeatable)", func(s string) error {
+		caseFiles = append(caseFiles, s)
+		return nil
+	})
+	var suites []string
+	fs.Func("suite", "also run the cases of this embedded suite: "+strings.Join(suiteNames(), ", ")+" (repeatable)", func(s string) error {
+		suites = append(suites, s)
+		return nil
+	})
+	labels := runLabels{}
+	fs.Func("label", "label every result of the run with key=value, e.g. experiment=exp-42; overrides -labels-file (repeatable)", labels.set)
+	labelsFile := fs.String("labels-file", "", "label every result with the keys and values of this JSON object")
+	stockCases := fs.Bool("stock-cases", true, "run the built-in matrix; -stock-cases=false runs only the -suite and -cases files' cases")
+	sizesFlag := fs.String("sizes", getEnv("PCS_BENCH_N", "1000000"), "comma-separated input sizes, e.g. 1e4,1e6,1e8; one result per size")
+	var keep retention
+	fs.StringVar(&keep.Keep, "keep-artifacts", "failed", "per-case sources, build logs and binaries to keep: failed, all or none")
+	fs.DurationVar(&keep.MaxAge, "artifacts-max-age", 7*24*time.Hour, "delete kept runs older than this (0 keeps them forever)")
+	maxMB := fs.Int64("artifacts-max-mb", 1024, "delete the oldest kept runs beyond this many MiB (0 for no limit)")
+	fs.StringVar(&keep.Dir, "artifacts-dir", "", "keep every case's sources, build log, binary and profiles under this directory's <run_id>, with a manifest.json linking them to their results (implies -keep-artifacts all; never pruned)")
+	cacheDir := fs.String("cache", "target/go_bench_cache", "directory caching generated code and binaries by content hash between runs (empty caches them for the run only)")
+	// On one CPU a build ahead would only compete with the timed run
+	pipelineDepth := fs.Int("pipeline", 0, "cases generated and built ahead of the one being timed, competing with it for the CPUs (0 prepares each case after the previous one was timed)")
+	vet := fs.Bool("vet", true, "run go vet over each generated program and fail it as vet_failed on any diagnostic")
+	staticcheck := fs.Bool("staticcheck", false, "with -vet, also run staticcheck (must be on PATH)")
+	raceN := fs.Int("race-n", 1000, "before timing a parallel case, build it with -race at this size and fail it as data_race on any race (0 skips the check)")
+	verify := fs.Bool("verify", true, "run each case once before timing it and fail it as wrong_result when it disagrees with its Python snippet")
+	allocCheck := fs.Bool("allocs", true, "before timing a case marked zero_alloc, count the heap allocations of a call and fail it as allocates on any")
+	fs.StringVar(&codegenMode, "codegen", codegenMode, "how to render Go cases: auto (natively, with python3 -m pcs for the rest), native or python")
+	fs.Parse(args)
+	keep.MaxBytes = *maxMB << 20
 
-	// Test cases to benchmark
-	testCases := [][]interface{}{
-		{"sum_even_squares", "loops", false},
-		{"sum_even_squares", "parallel", true},
+	if *pipelineDepth < 0 {
+		fmt.Fprintf(os.Stderr, "-pipeline must be at least 0\n")
+		return 2
+	}
+	vetter := &staticChecker{staticcheck: *vet && *staticcheck}
+	if vetter.staticcheck {
+		if _, err := exec.LookPath("staticcheck"); err != nil {
+			fmt.Fprintf(os.Stderr, "-staticcheck: %v (go install honnef.co/go/tools/cmd/staticcheck@latest)\n", err)
+			return 2
+		}
+	}
+	if !codegenModes[codegenMode] {
+		fmt.Fprintf(os.Stderr, "unknown -codegen %q (want auto, native or python)\n", codegenMode)
+		return 2
+	}
+	if !keepPolicies[keep.Keep] {
+		fmt.Fprintf(os.Stderr, "unknown -keep-artifacts %q (want failed, all or none)\n", keep.Keep)
+		return 2
+	}
+	if keep.Dir != "" {
+		keepSet := false
+		fs.Visit(func(f *flag.Flag) { keepSet = keepSet || f.Name == "keep-artifacts" })
+		if keepSet && keep.Keep != "all" {
+			fmt.Fprintf(os.Stderr, "-artifacts-dir keeps all artifacts and cannot be combined with -keep-artifacts %s\n", keep.Keep)
+			return 2
+		}
+		keep.Keep = "all"
+	}
+	backendNames, err := parseBackends(*backendName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-backend: %v\n", err)
+		return 2
+	}
+	cache, err := openBuildCache(*cacheDir, "pcs")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-cache: %v\n", err)
+		return 2
 	}
 
-	for _, testCase := range testCases {
-		testName := testCase[0].(string)
-		mode := testCase[1].(string)
-		parallel := testCase[2].(bool)
+	if *minSpeedup < 0 {
+		fmt.Fprintf(os.Stderr, "-min-speedup must be at least 0\n")
+		return 2
+	}
 
-		// Generate Go code using PCS
-		cmd := exec.Command("python3", "-m", "pcs",
-			"--code", "sum(i*i for i in range(1, 1000000) if i%2==0)",
-			"--target", "go")
+	if *procsSweep && *maxProcs < 1 {
+		fmt.Fprintf(os.Stderr, "-max-procs must be at least 1\n")
+		return 2
+	}
 
-		if parallel {
-			cmd.Args = append(cmd.Args, "--parallel")
+	if err := gc.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	// Elsewhere the run header has core counts only, or no topology
+	topology, topologyErr := detectTopology()
+	if topologyErr != nil {
+		topology = countCores()
+	}
+	if *physicalCores {
+		if topologyErr != nil {
+			fmt.Fprintf(os.Stderr, "-physical-cores: %v\n", topologyErr)
+			return 2
 		}
+		if *cpus, err = topology.pinPhysicalCores(*cpus); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
 
-		output, err := cmd.Output()
+	// A calibrated machine gates on the smallest slowdown it can detect
+	thresholdSet := false
+	fs.Visit(func(f *flag.Flag) { thresholdSet = thresholdSet || f.Name == "threshold" })
+	if !thresholdSet && *calibrationPath != "" {
+		mde, ok, err := calibratedThreshold(*calibrationPath, newMachineFingerprint(topology))
 		if err != nil {
-			result := BenchmarkResult{
-				Commit:    commit,
-				Timestamp: timestamp,
-				OS:        os,
-				CPU:       cpu,
-				Backend:   "go",
-				Test:      testName,
-				Mode:      mode,
-				Parallel:  parallel,
-				N:         n,
-				Error:     fmt.Sprintf("Failed to generate Go code: %v", err),
-			}
-			json.NewEncoder(os.Stdout).Encode(result)
-			continue
-		}
-
-		// Write generated code to file
-		err = os.WriteFile("generated/go_bench.go", output, 0644)
+			fmt.Fprintf(os.Stderr, "-calibration: %v\n", err)
+			return 2
+		}
+		if ok {
+			*threshold = mde
+			fmt.Fprintf(os.Stderr, "threshold: %.1f%%, calibrated for this machine in %s\n", mde*100, *calibrationPath)
+		}
+	}
+
+	pinned := 0
+	if *cpus != "" {
+		var err error
+		if *cpus, pinned, err = checkAffinity(*cpus); err != nil {
+			fmt.Fprintf(os.Stderr, "-cpus: %v\n", err)
+			return 2
+		}
+		// Sweeping GOMAXPROCS past the pinned CPUs only oversubscribes them
+		maxSet := false
+		fs.Visit(func(f *flag.Flag) { maxSet = maxSet || f.Name == "max-procs" })
+		if !maxSet {
+			*maxProcs = pinned
+		}
+	}
+
+	var maxRSS int64
+	if *maxRSSFlag != "" {
+		if maxRSS, err = parseByteSize(*maxRSSFlag); err == nil {
+			err = checkRSSWatch()
+		}
 		if err != nil {
-			result := BenchmarkResult{
-				Commit:    commit,
-				Timestamp: timestamp,
-				OS:        os,
-				CPU:       cpu,
-				Backend:   "go",
-				Test:      testName,
-				Mode:      mode,
-				Parallel:  parallel,
-				N:         n,
-				Error:     fmt.Sprintf("Failed to write generated Go code: %v", err),
-			}
-			json.NewEncoder(os.Stdout).Encode(result)
-			continue
-		}
-
-		// Compile the generated code
-		buildCmd := exec.Command("go", "build", "-o", "target/go_bench", "generated/go_bench.go")
-		err = buildCmd.Run()
+			fmt.Fprintf(os.Stderr, "-max-rss: %v\n", err)
+			return 2
+		}
+	}
+	niceLevel, niceIncrement, err := checkNice(*niceFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-nice: %v\n", err)
+		return 2
+	}
+	confiner, err := confinerFlags(*cgroupParent, *cgroupCPUs, *cgroupMemory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-cgroup: %v\n", err)
+		return 2
+	}
+	if confiner != nil {
+		defer confiner.sweep()
+	}
+
+	if *labelsFile != "" {
+		if labels, err = labels.withFile(*labelsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "-labels-file: %v\n", err)
+			return 2
+		}
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+
+	if *format != "ndjson" && *format != "influx" && *format != "gbench" && *format != "tap" {
+		fmt.Fprintf(os.Stderr, "unknown -format %q (want ndjson, influx, gbench or tap)\n", *format)
+		return 2
+	}
+	if *appendOutput && (*output == "" || *format != "ndjson") {
+		fmt.Fprintln(os.Stderr, "-append needs -output and -format ndjson")
+		return 2
+	}
+
+	var base baseline
+	if *baselinePath != "" {
+		var err error
+		if base, err = loadBaseline(*baselinePath); err != nil {
+			fmt.Fprintf(os.Stderr, "baseline: %v\n", err)
+			return 2
+		}
+	}
+
+	if *perf {
+		if err := checkPerf(); err != nil {
+			fmt.Fprintf(os.Stderr, "-perf: %v\n", err)
+			return 2
+		}
+	}
+	if *redact {
+		redaction = newRedactor()
+	}
+	var rapl []raplDomain
+	if *energy {
+		if rapl = raplDomains(); len(rapl) == 0 {
+			fmt.Fprintf(os.Stderr, "-energy: no readable RAPL counters under %s; results carry no energy\n", raplRoot)
+		}
+	}
+
+	targets, err := parseTargets(*targetsFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-targets: %v\n", err)
+		return 2
+	}
+	runners, err := parseRemotes(remoteSpecs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-remote: %v\n", err)
+		return 2
+	}
+	if *wasmFlag != "" {
+		if targets, err = addWasmTarget(*wasmFlag, targets, runners); err != nil {
+			fmt.Fprintf(os.Stderr, "-wasm: %v\n", err)
+			return 2
+		}
+	}
+
+	var container *containerRunner
+	if *containerImage != "" {
+		if *perf || *pgo {
+			fmt.Fprintln(os.Stderr, "-container: -perf and -pgo run on the host and cannot be combined with it")
+			return 2
+		}
+		if confiner != nil {
+			fmt.Fprintln(os.Stderr, "-container: the container's own -container-cpus and -container-memory limit it; -cgroup-cpus and -cgroup-memory cannot be combined with it")
+			return 2
+		}
+		if container, err = newContainerRunner(*containerEngine, *containerImage, *containerCPUs, *containerMemory, *cpus); err != nil {
+			fmt.Fprintf(os.Stderr, "-container: %v\n", err)
+			return 2
+		}
+		runners[""] = container
+	}
+
+	goVersions, err := parseGoVersions(*goVersionsFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-go-versions: %v\n", err)
+		return 2
+	}
+	defaultGo, err := resolveGo("go")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "go version: %v\n", err)
+	}
+	harness := readHarnessBuild()
+	snapshot := takeEnvSnapshot()
+
+	est, err := parseEstimator(*estimatorFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-estimator: %v\n", err)
+		return 2
+	}
+
+	if retry.Retries < 0 || retry.Backoff < 0 || retry.CV < 0 || retry.CV > 0 && retry.Retries == 0 {
+		fmt.Fprintln(os.Stderr, "-retries: want -retries, -retry-backoff and -retry-cv at least 0, and -retries above 0 with -retry-cv")
+		return 2
+	}
+
+	pause, err := parseCooldown(*cooldownFlag, *cooldownLoad, *cooldownMax)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-cooldown: %v\n", err)
+		return 2
+	}
+
+	var previous previousBinaries
+	if *compareBinary != "" {
+		var err error
+		if previous, err = loadPreviousBinaries(*compareBinary); err != nil {
+			fmt.Fprintf(os.Stderr, "-compare-binary: %v\n", err)
+			return 2
+		}
+	}
+
+	commit, gitMeta := detectGit()
+	started := time.Now().UTC()
+	timestamp := started.Format("2006-01-02T15:04:05Z")
+	goos := runtime.GOOS
+	cpu := cpuName()
+	sizes, err := parseSizes(*sizesFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-sizes: %v\n", err)
+		return 2
+	}
+	if *chunkSweepFlag {
+		sizesSet := false
+		fs.Visit(func(f *flag.Flag) { sizesSet = sizesSet || f.Name == "sizes" })
+		if !sizesSet {
+			sizes = chunkSweepSizes
+		}
+	}
+	matrix, err := loadMatrix(*stockCases, suites, caseFiles)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *chunkSweepFlag {
+		matrix = chunkSweepCases(matrix)
+	}
+	protocol := getEnv("PCS_BENCH_PROTOCOL", "steady")
+	if _, ok := measureProtocols[protocol]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown PCS_BENCH_PROTOCOL %q (want cold, warmup or steady)\n", protocol)
+		return 2
+	}
+	fixedWarmup, _ := strconv.Atoi(getEnv("PCS_BENCH_WARMUP", "3"))
+
+	// Results go to -output, else to standard output unless the table does
+	stdout := claimStdout()
+	defer func() { os.Stdout = stdout }()
+	var out io.Writer = stdout
+	var outFile resultFile
+	if *output != "" {
+		if outFile, err = openResults(*output, *appendOutput, *fsyncFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "-output: %v\n", err)
+			return 2
+		}
+		defer outFile.abort()
+		out = outFile
+	} else if *pretty {
+		out = io.Discard
+	}
+	records := &ndjsonWriter{w: out}
+	// writeErr is the first error writing the results: the run goes on for
+	// its other sinks, but does not commit -output and exits 1
+	var writeErr error
+	checkWrite := func(err error) {
+		if err != nil && writeErr == nil {
+			writeErr = err
+			fmt.Fprintf(os.Stderr, "writing results: %v\n", err)
+		}
+	}
+
+	runID, err := newRunWorkspace(started)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "artifacts: %v\n", err)
+		return 1
+	}
+	var manifest *runManifest
+	if keep.Dir != "" {
+		if err := os.MkdirAll(keep.runDir(runID), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "-artifacts-dir: %v\n", err)
+			closeRunWorkspace(runID)
+			return 1
+		}
+		manifest = &runManifest{SchemaVersion: runSchemaVersion, RunID: runID, Commit: commit, Timestamp: timestamp}
+	}
+
+	tr, err := newTracer()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "otlp: %v; not tracing\n", err)
+	}
+	runSpan := tr.start("bench_go", nil, map[string]any{"run_id": runID, "commit": commit, "profile": *profile})
+
+	if *format == "ndjson" {
+		header := newRunHeader(runID, timestamp, commit, gitMeta, *profile, dataSeed, topology, matrix)
+		if tr != nil {
+			header.TraceID = tr.traceID
+		}
+		header.Labels = labels
+		checkWrite(records.write(redaction.header(header)))
+	}
+
+	var results []BenchmarkResult
+	// gbench output is one document, written once the run is over
+	var written []BenchmarkResult
+	var tap *tapWriter
+	if *format == "tap" {
+		tap = newTAPWriter(out, base, *threshold)
+	}
+	write := func(result BenchmarkResult) {
+		switch *format {
+		case "influx":
+			checkWrite(writeInflux(out, result))
+		case "gbench":
+			written = append(written, result)
+		case "tap":
+			tap.write(result)
+		default:
+			checkWrite(records.write(result))
+		}
+	}
+	// Cases with a result that failed or was skipped, for Needs
+	unmeasured := map[string]bool{}
+	// Speedups of parallel cases over their loops case, as both are measured
+	var speedups speedupTracker
+	var speedupRecords []speedupRecord
+	var chunks chunkSweep
+	var table *prettyTable
+	var caseSpan *span
+	emit := func(result BenchmarkResult) {
+		manifest.add(result)
+		result = redaction.result(result)
+		write(result)
+		results = append(results, result)
+		if table != nil {
+			table.result(result)
+		}
+		if s, ok := speedups.add(result); ok {
+			if *format == "ndjson" {
+				checkWrite(records.write(s))
+			}
+			if table != nil {
+				table.speedup(s)
+			} else {
+				fmt.Fprintf(os.Stderr, "speedup: %s\n", s)
+			}
+			speedupRecords = append(speedupRecords, s)
+		}
+		chunks.add(result)
+		if result.Error != "" {
+			caseSpan.fail(result.Error)
+		}
+		if !result.measured() {
+			unmeasured[benchCase{Test: result.Test, Mode: result.Mode, Target: result.Target, Backend: caseBackend(result.Backend)}.name()] = true
+		}
+	}
+
+	testCases, err := orderCases(backendCases(goVersionCases(crossCases(matrix, targets), goVersions), backendNames))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		closeRunWorkspace(runID)
+		cache.close()
+		return 2
+	}
+	if *pretty {
+		table = newPrettyTable(stdout, testCases, sizes, base, *threshold)
+	}
+	measuredAny := false
+	var refs referenceCache
+	checks := preflight{verify: *verify, raceN: *raceN, allocs: *allocCheck, timeout: *timeout, maxRSS: maxRSS}
+	raced := false
+	allocated := false
+
+	caps, err := loadCapabilities()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v; running every case\n", err)
+	}
+
+	handleInterrupts()
+
+	// Cases are generated and built by a producer running up to -pipeline
+	// cases ahead, while this goroutine times them one at a time in order.
+	// The compiler then shares the machine with the case being timed, so
+	// pipelining is opt-in, for runs that care more about wall time.
+	// A token is taken before each case is prepared and returned once it
+	// has been timed, so at most -pipeline cases wait built.
+	ready := make(chan preparedCase, *pipelineDepth)
+	turns := make(chan struct{}, *pipelineDepth+1)
+	for i := 0; i < cap(turns); i++ {
+		turns <- struct{}{}
+	}
+	stop := make(chan struct{})
+	go func() {
+		defer close(ready)
+	cases:
+		for _, tc := range testCases {
+			be := backends[tc.backend()]
+			runner := be.Runner
+			caseSizes := sizes
+			if len(tc.Sizes) > 0 {
+				caseSizes = tc.Sizes
+			}
+			caseEst, estErr := est, error(nil)
+			if tc.Estimator != "" {
+				caseEst, estErr = parseEstimator(tc.Estimator)
+			}
+			// Rendered on the first size that gets as far as codegen
+			var sized []byte
+			sizedTried := false
+			for _, n := range caseSizes {
+				select {
+				case <-turns:
+				case <-stop:
+					break cases
+				}
+				if interrupted() {
+					break cases
+				}
+				p := preparedCase{tc: tc, n: n, est: caseEst}
+				base := BenchmarkResult{
+					SchemaVersion:  runSchemaVersion,
+					RunID:          runID,
+					Commit:         commit,
+					Git:            gitMeta,
+					Timestamp:      timestamp,
+					OS:             goos,
+					CPU:            cpu,
+					Backend:        tc.backend(),
+					Test:           tc.Test,
+					Mode:           tc.Mode,
+					Parallel:       tc.Parallel,
+					N:              n,
+					GOMAXPROCS:     runtime.GOMAXPROCS(0), // inherited by the benchmark process
+					CPUs:           *cpus,
+					Protocol:       protocol,
+					BuildFlags:     tc.BuildFlags,
+					Estimator:      tc.Estimator,
+					Toolchain:      tc.toolchain(),
+					HarnessVersion: harness.Version,
+					Harness:        harness,
+					Env:            snapshot,
+					Labels:         labels,
+				}
+				if d, err := parseDataSpec(tc.Data, n); tc.Data != "" && err == nil {
+					base.Data, base.DataSeed = d.String(), &dataSeed
+				}
+				if tc.backend() != "go" {
+					base.GOMAXPROCS = 0
+				}
+				if tc.toolchain() == "gc" {
+					base.GoVersion = defaultGo.Version
+					if tc.Go.Version != "" {
+						base.GoVersion = tc.Go.Version
+					}
+				}
+				if estErr == nil {
+					base.Estimator = caseEst.name()
+				}
+				p.remote = runners[tc.Target]
+				if tc.Target != "" {
+					base.Target = tc.Target
+					base.OS, base.CPU, _ = strings.Cut(tc.Target, "/")
+				}
+				if p.remote != nil {
+					base.GOMAXPROCS = 0 // the runner's default, unknown here
+				}
+				if p.remote == nil || p.remote.local() {
+					base.Nice = niceLevel
+					if confiner != nil {
+						base.Cgroup = &confiner.Limit
+					}
+				}
+				if container != nil && tc.Target == "" {
+					base.ContainerImage = container.Digest
+				}
+				base.Attempts = retry.attempts()
+				p.gc = tc.GC.over(gc).effective()
+				base.GOGC, base.GOMemLimit = p.gc.GOGC, p.gc.GOMemLimit
+				p.name = tc.name()
+				if len(caseSizes) > 1 {
+					p.name += "_n" + strconv.Itoa(n)
+				}
+				p.span = tr.start(p.name, runSpan, map[string]any{"test": tc.Test, "mode": tc.Mode, "n": n})
+				var err error
+				p.artifacts, err = keep.caseArtifacts(runID, p.name)
+				if keep.keepCase(false) {
+					base.Artifacts = &p.artifacts
+				}
+				p.base = base
+				p.unbuilt = base
+				send := func() bool {
+					select {
+					case ready <- p:
+						return true
+					case <-stop:
+						p.artifacts.remove()
+						return false
+					}
+				}
+				// A case cut short by an interrupt is dropped, not reported failed
+				fail := func(class, format string, err error) bool {
+					if interrupted() {
+						if !keep.keepCase(false) {
+							p.artifacts.remove()
+						}
+						return false
+					}
+					result := p.failure(base, keep, class, format, err)
+					p.done = &result
+					return send()
+				}
+				skip := func(result BenchmarkResult, discard bool) bool {
+					result.Skipped = true
+					p.done, p.discard = &result, discard
+					return send()
+				}
+				var sent bool
+				gcErr := p.gc.validate()
+				switch {
+				case err != nil:
+					sent = fail(errSetup, "Failed to create artifact directories: %v", err)
+				case gcErr != nil:
+					sent = fail(errSetup, "Invalid GC settings: %v", gcErr)
+				case estErr != nil:
+					sent = fail(errSetup, "Invalid estimator: %v", estErr)
+				default:
+					if gaps := caps.missing(tc.pcsTarget(), tc.Requires); caps != nil && len(gaps) > 0 {
+						result := base
+						result.SkipReason = skipUnsupported
+						result.Missing = gaps
+						result.Artifacts = nil
+						sent = skip(result, true)
+						break
+					}
+					// Needs are checked when the case is due to run, once
+					// the cases it depends on have been timed
+					p.gated = true
+
+					// Generate code using PCS, unless it is cached or serves
+					// every size
+					generateSpan := tr.start("generate", p.span, nil)
+					if sg, ok := runner.(sizedGenerator); ok && !sizedTried {
+						start := time.Now()
+						sized, sizedTried = sg.GenerateSized(cache, tc, caseSizes), true
+						if sized != nil {
+							base.CodegenMs = float64(time.Since(start).Microseconds()) / 1000
+						}
+					}
+					output, cached := sized, sized != nil
+					p.sized = cached
+					if !cached {
+						attempts, err := retry.do(p.name, "generate", func() (err error) {
+							start := time.Now()
+							output, cached, err = runner.Generate(cache, tc, n)
+							base.CodegenMs = float64(time.Since(start).Microseconds()) / 1000
+							return err
+						})
+						if cached {
+							base.CodegenMs = 0
+						}
+						if base.Attempts != nil {
+							base.Attempts.Generate = attempts
+						}
+						if err != nil {
+							generateSpan.finish(err)
+							sent = fail(errCodegen, "Failed to generate "+be.Label+" code: %v", err)
+							break
+						}
+					}
+					generateSpan.set("cached", cached)
+					generateSpan.finish(nil)
+
+					// Write generated code with its timing driver and runtime files
+					prefix := filepath.Join(p.artifacts.Dir, tc.backend()+"_bench")
+					if p.prog, err = runner.Build(tc, output, prefix, n); err != nil {
+						sent = fail(errCodegen, "Failed to write generated "+be.Label+" code: %v", err)
+						break
+					}
+					if base.ModuleHash, err = hashFiles(p.prog.Sources...); err != nil {
+						sent = fail(errCodegen, "Failed to hash generated "+be.Label+" code: %v", err)
+						break
+					}
+
+					// Compile the generated code, or reuse an identical earlier build
+					compileSpan := tr.start("compile", p.span, map[string]any{"toolchain": base.Toolchain})
+					binKey := cache.binaryKey(base)
+					if base.CompileMs, cached = cache.loadBinary(binKey, p.artifacts.Binary); cached {
+						base.BuildCached = true
+					} else {
+						attempts, err := retry.do(p.name, "compile", func() error {
+							buildCmd, err := p.prog.Compile(p.artifacts.Binary)
+							if base.ContainerImage != "" && tc.toolchain() == "gc" && tc.Go.Cmd == "" {
+								buildCmd, err = container.build(tc, p.artifacts.Binary, p.prog.Sources)
+							}
+							if err != nil {
+								return err
+							}
+							buildStart := time.Now()
+							buildLog, err := buildCmd.CombinedOutput()
+							base.CompileMs = float64(time.Since(buildStart).Microseconds()) / 1000
+							os.WriteFile(filepath.Join(p.artifacts.Dir, "build.log"), buildLog, 0644)
+							if err != nil {
+								return &commandError{buildCmd.Args, err, buildLog}
+							}
+							return nil
+						})
+						if base.Attempts != nil {
+							base.Attempts.Compile = attempts
+						}
+						if errors.Is(err, exec.ErrNotFound) {
+							result := base
+							result.SkipReason = skipToolchain
+							sent = skip(result, false)
+							break
+						}
+						if err != nil {
+							compileSpan.finish(err)
+							sent = fail(errCompile, "Failed to compile "+be.Label+" code: %v", err)
+							break
+						}
+						cache.storeBinary(binKey, p.artifacts.Binary, base.CompileMs)
+					}
+					compileSpan.set("cached", base.BuildCached)
+					compileSpan.finish(nil)
+					if info, err := os.Stat(p.artifacts.Binary); err == nil {
+						base.BinaryBytes = info.Size()
+					}
+					if goVersion, settings, ok := binaryBuild(p.artifacts.Binary); ok {
+						base.GoVersion, base.BuildSettings = goVersion, settings
+					}
+					if *vet && tc.backend() == "go" {
+						if err := vetter.check(tc, p.prog.Sources, base.ModuleHash); err != nil {
+							sent = fail(errVet, "Generated "+be.Label+" code fails static checks: %v", err)
+							break
+						}
+					}
+
+					// Stream cases are timed per process, which a runner's own
+					// startup would swamp, so they are only built
+					// and data cases read their input from local files
+					if tc.Target != "" && p.remote == nil || (tc.Stream != "" || tc.Data != "") && p.remote != nil && !p.remote.local() {
+						result := base
+						result.SkipReason = skipCrossCompiled
+						if p.remote != nil {
+							result.SkipReason = skipRunner
+						}
+						sent = skip(result, false)
+						break
+					}
+					p.base = base
+					sent = send()
+				}
+				if !sent {
+					break cases
+				}
+			}
+		}
+	}()
+
+	// measure times one prepared case at every GOMAXPROCS level
+	measure := func(p preparedCase) {
+		tc, name, artifacts, remote, prog := p.tc, p.name, p.artifacts, p.remote, p.prog
+		be := backends[tc.backend()]
+		runner := be.Runner
+		finish := func(failed bool) {
+			if !keep.keepCase(failed) {
+				artifacts.remove()
+			}
+		}
+		if unmet := tc.unmetNeeds(unmeasured); p.gated && len(unmet) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: skipped, prerequisite %s did not run\n", name, strings.Join(unmet, ", "))
+			result := p.unbuilt
+			result.Skipped = true
+			result.SkipReason = skipDependency
+			result.Artifacts = nil
+			emit(result)
+			artifacts.remove()
+			return
+		}
+		if p.done != nil {
+			emit(*p.done)
+			if p.discard {
+				artifacts.remove()
+			} else {
+				finish(p.done.Error != "")
+			}
+			return
+		}
+		if remote != nil {
+			if err := remote.prepare(artifacts.Binary, runID+"_"+name); err != nil {
+				if !interrupted() {
+					emit(p.failure(p.base, keep, errSetup, "Failed to prepare the runner: %v", err))
+				}
+				finish(!interrupted())
+				return
+			}
+		}
+		base, failure := checks.check(p, &refs, cache, keep)
+		if failure != nil {
+			if !interrupted() {
+				raced = raced || failure.ErrorClass == errDataRace
+				allocated = allocated || failure.ErrorClass == errAllocs
+				emit(*failure)
+			}
+			if remote != nil {
+				remote.cleanup(artifacts.Binary)
+			}
+			finish(!interrupted())
+			return
+		}
+
+		// Run the benchmark, once per GOMAXPROCS level when sweeping
+		const reps = 10
+		levels := []int{0}
+		if *procsSweep && tc.Parallel && tc.backend() == "go" {
+			levels = procsLevels(*maxProcs)
+		}
+		failed := false
+		pgoBinary := ""
+		var err error
+		for _, procs := range levels {
+			result := base
+			if procs > 0 {
+				result.GOMAXPROCS = procs
+			} else if pinned > 0 && remote == nil {
+				// The Go runtime sizes GOMAXPROCS to the affinity mask
+				result.GOMAXPROCS = pinned
+			}
+			env := runEnv{Procs: procs, CPUs: *cpus, GOGC: p.gc.GOGC, GOMemLimit: p.gc.GOMemLimit, Seed: dataSeed, Runner: remote, Timeout: *timeout}
+			if p.sized {
+				env.Size = p.n
+			}
+			if remote == nil || remote.local() {
+				env.Nice, env.MaxRSS, env.Cgroup = niceIncrement, maxRSS, confiner
+			}
+			// perf stat appends to these across calls; start each level empty
+			perfOut := func(binary string) string {
+				switch binary {
+				case artifacts.Binary:
+					return filepath.Join(artifacts.Dir, "perf_current.csv")
+				case pgoBinary:
+					return filepath.Join(artifacts.Dir, "perf_pgo.csv")
+				}
+				return filepath.Join(artifacts.Dir, "perf_previous.csv")
+			}
+			timeBinary := func(binary string, reps int) (runOutput, error) {
+				env := env
+				if *perf && (remote == nil || remote.local()) {
+					env.PerfOut = perfOut(binary)
+				}
+				if schedTrace && schedCase(tc) && binary == artifacts.Binary {
+					env.Trace = schedTracePath(artifacts.Dir, procs)
+				}
+				metered := len(rapl) > 0 && (remote == nil || remote.local())
+				var before energyReading
+				if metered {
+					before = readEnergy(rapl)
+				}
+				start := time.Now()
+				out, err := runner.Run(tc, prog, binary, env, reps, protocol, fixedWarmup)
+				if metered && err == nil {
+					var energyErr error
+					if out.Energy, energyErr = energyBetween(rapl, before, readEnergy(rapl), reps+out.Warmup); energyErr != nil {
+						fmt.Fprintf(os.Stderr, "energy: %s: %v\n", name, energyErr)
+					}
+				}
+				traceRun(tr, p.span, binaryRole(binary, artifacts.Binary, pgoBinary), start, out, err)
+				return out, err
+			}
+			var run, prevRun runOutput
+			prevBinary, comparing := previous[name]
+			comparing = comparing && tc.Target == ""
+			os.Remove(perfOut(artifacts.Binary))
+			os.Remove(perfOut(prevBinary))
+			os.Remove(perfOut(pgoBinary))
+			if measuredAny {
+				result.CooldownNs = pause.wait().Nanoseconds()
+			}
+			measuredAny = true
+			if remote == nil || remote.local() || tc.Target == "" {
+				result.MachineBefore = sampleMachine()
+			}
+			if comparing {
+				run, prevRun, err = timeAlongside(timeBinary, artifacts.Binary, prevBinary, reps)
+			} else {
+				run, err = timeBinary(artifacts.Binary, reps)
+				// Timings noisier than -retry-cv are taken again
+				attempts := 1
+				for err == nil && attempts <= retry.Retries && retry.noisy(runner.Metrics(result, run, p.est, reps)) {
+					fmt.Fprintf(os.Stderr, "%s: timings vary more than -retry-cv %g (attempt %d of %d), re-timing in %s\n",
+						name, retry.CV, attempts, retry.Retries+1, retry.wait(attempts))
+					if !retry.pause(attempts) {
+						break
+					}
+					os.Remove(perfOut(artifacts.Binary))
+					attempts++
+					run, err = timeBinary(artifacts.Binary, reps)
+				}
+				if result.Attempts != nil {
+					counts := *result.Attempts
+					counts.Run = attempts
+					result.Attempts = &counts
+				}
+			}
+			if remote == nil || remote.local() || tc.Target == "" {
+				result.MachineAfter = sampleMachine()
+			}
+			if err != nil && interrupted() {
+				break
+			}
+			if err != nil {
+				emit(p.failure(result, keep, runErrorClass(err), "Failed to run generated "+be.Label+" code: %v", err))
+				failed = true
+				continue
+			}
+			record := func(result BenchmarkResult, run runOutput, binary string) BenchmarkResult {
+				result = runner.Metrics(result, run, p.est, reps)
+				if *perf {
+					counts, err := readPerf(perfOut(binary), reps+run.Warmup)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "perf: %s: %v\n", name, err)
+					}
+					result.Perf = counts
+					// The first read of a level is the one reported
+					if keep.Dir != "" {
+						kept := keptPerfPath(perfOut(binary), result.GOMAXPROCS)
+						if _, err := os.Stat(kept); os.IsNotExist(err) {
+							os.Rename(perfOut(binary), kept)
+						}
+					}
+					os.Remove(perfOut(binary))
+				}
+				result.Sched = run.Sched
+				result.Energy = run.Energy
+				if run.Sched != nil && schedTrace && binary == artifacts.Binary {
+					result.Sched.Trace = schedTracePath(artifacts.Dir, procs)
+					if err := summarizeTrace(result.Sched); err != nil {
+						fmt.Fprintf(os.Stderr, "sched-trace: %s: %v\n", name, err)
+					}
+				}
+				return result
+			}
+			result = record(result, run, artifacts.Binary)
+			emit(result)
+
+			if comparing {
+				prevResult := record(result, prevRun, prevBinary)
+				prevResult.Binary, prevResult.Artifacts = prevBinary, nil
+				if prevResult.Commit, err = binaryCommit(prevBinary); err != nil {
+					prevResult.Commit = "binary"
+				}
+				// Only written out: the baseline, JUnit, history and
+				// metrics sinks describe this commit's builds
+				write(redaction.result(prevResult))
+				reportDelta("compare-binary", name, "previous", "current", prevResult, result)
+			}
+
+			if *pgo && tc.Stream == "" && tc.Target == "" && tc.Toolchain == "" {
+				pgoResult := result
+				pgoResult.Mode += "_pgo"
+				pgoResult.PGO = true
+				if pgoBinary == "" {
+					pgoSpan := tr.start("compile_pgo", p.span, nil)
+					pgoBinary, err = buildPGO(artifacts.Dir, artifacts.Binary, tc, prog, env, result.MedianNs, fixedWarmup)
+					pgoSpan.finish(err)
+				}
+				var pgoRun runOutput
+				if err == nil {
+					run, pgoRun, err = timeAlongside(timeBinary, artifacts.Binary, pgoBinary, reps)
+				}
+				if err != nil && interrupted() {
+					break
+				}
+				if err != nil {
+					emit(p.failure(pgoResult, keep, runErrorClass(err), "PGO comparison failed: %v", err))
+					failed = true
+					continue
+				}
+				pgoResult = record(pgoResult, pgoRun, pgoBinary)
+				if _, settings, ok := binaryBuild(pgoBinary); ok {
+					pgoResult.BuildSettings = settings
+				}
+				emit(pgoResult)
+				// Against the default build's samples from the same rounds
+				reportDelta("pgo", name, "default", "pgo", record(result, run, artifacts.Binary), pgoResult)
+			}
+		}
+		if remote != nil {
+			remote.cleanup(artifacts.Binary)
+		}
+		finish(failed)
+	}
+
+	for p := range ready {
+		if interrupted() {
+			p.artifacts.remove()
+			break
+		}
+		caseSpan = p.span
+		if table != nil {
+			table.progress(p.name, p.n)
+		}
+		measure(p)
+		caseSpan.finish(nil)
+		turns <- struct{}{}
+	}
+	// Stop the producer and drop the cases it built ahead
+	close(stop)
+	for p := range ready {
+		p.artifacts.remove()
+		p.span.finish(nil)
+	}
+
+	if *format == "gbench" {
+		checkWrite(writeGBench(out, written))
+	}
+	if tap != nil {
+		tap.finish()
+	}
+	if table != nil {
+		table.summary()
+	}
+	if len(backendNames) > 1 {
+		if table != nil {
+			writeBackendTable(stdout, results, backendNames)
+		} else {
+			writeBackendTable(os.Stderr, results, backendNames)
+		}
+	}
+	if writeErr != nil {
+		// -output is left as it was, or with the records appended before
+		// the failure
+		closeRunWorkspace(runID)
+		cache.close()
+		return 1
+	}
+	if outFile != nil {
+		if err := outFile.commit(); err != nil {
+			fmt.Fprintf(os.Stderr, "-output: %v\n", err)
+			return 1
+		}
+	}
+
+	caseSpan.finish(nil)
+	runSpan.finish(nil)
+	if err := tr.export(); err != nil {
+		fmt.Fprintf(os.Stderr, "otlp: %v\n", err)
+	}
+
+	if err := manifest.write(keep.runDir(runID)); err != nil {
+		fmt.Fprintf(os.Stderr, "-artifacts-dir: %v\n", err)
+	} else if manifest != nil {
+		fmt.Fprintf(os.Stderr, "artifacts: %s\n", filepath.Join(keep.runDir(runID), manifestName))
+	}
+	closeRunWorkspace(runID)
+	cache.close()
+	if err := keep.prune(); err != nil {
+		fmt.Fprintf(os.Stderr, "artifacts: %v\n", err)
+	}
+	// Unused cache entries age out with the kept artifacts
+	cache.prune(keep.MaxAge)
+
+	if *chunkSweepFlag {
+		chunks.report(os.Stderr, *threshold)
+	}
+
+	publishResults(results, base, *threshold, *historyPath, *junitPath)
+
+	if interrupted() {
+		fmt.Fprintf(os.Stderr, "interrupted: wrote %d completed results\n", len(results))
+		return exitInterrupted
+	}
+	if raced {
+		fmt.Fprintln(os.Stderr, "race: generated code raced in at least one case (see data_race results)")
+		return 1
+	}
+	if allocated {
+		fmt.Fprintln(os.Stderr, "allocs: generated code allocated in at least one zero_alloc case (see allocates results)")
+		return 1
+	}
+	if *minSpeedup > 0 && reportSpeedupFloor(speedupRecords, *minSpeedup, *procsSweep, *maxProcs) {
+		return 1
+	}
+	return 0
+}
+
+// publishResults hands the results to the sinks other than -output: the
+// Pushgateway at PCS_PUSHGATEWAY_URL, regressions vs base to the webhook at
+// PCS_WEBHOOK_URL, the -history database, the GitHub step summary and the
+// -junit report. Their failures are reported without failing the run.
+func publishResults(results []BenchmarkResult, base baseline, threshold float64, historyPath, junitPath string) {
+	if url := os.Getenv("PCS_PUSHGATEWAY_URL"); url != "" {
+		job := getEnv("PCS_PUSHGATEWAY_JOB", "pcs_bench")
+		if err := pushMetrics(url, job, results); err != nil {
+			fmt.Fprintf(os.Stderr, "pushgateway: %v\n", err)
+		}
+	}
+
+	if url := os.Getenv("PCS_WEBHOOK_URL"); url != "" && len(base) > 0 {
+		top, _ := strconv.Atoi(getEnv("PCS_WEBHOOK_TOP", "5"))
+		if n, err := notifyRegressions(url, results, base, threshold, top); err != nil {
+			fmt.Fprintf(os.Stderr, "webhook: %d regressions not sent: %v\n", n, err)
+		}
+	}
+
+	if historyPath != "" {
+		h, err := openHistory(historyPath)
+		if err == nil {
+			err = h.Append(results)
+		}
 		if err != nil {
-			result := BenchmarkResult{
-				Commit:    commit,
-				Timestamp: timestamp,
-				OS:        os,
-				CPU:       cpu,
-				Backend:   "go",
-				Test:      testName,
-				Mode:      mode,
-				Parallel:  parallel,
-				N:         n,
-				Error:     fmt.Sprintf("Failed to compile Go code: %v", err),
-			}
-			json.NewEncoder(os.Stdout).Encode(result)
-			continue
-		}
-
-		// Run the benchmark
-		mean, std := bench(func() {
-			// This would call the actual generated function
-			// For now, we'll simulate the work
-			sum := 0
-			for i := 1; i < n; i++ {
-				if i%2 == 0 {
-					sum += i * i
-				}
-			}
-		}, 10)
-
-		result := BenchmarkResult{
-			Commit:    commit,
-			Timestamp: timestamp,
-			OS:        os,
-			CPU:       cpu,
-			Backend:   "go",
-			Test:      testName,
-			Mode:      mode,
-			Parallel:  parallel,
-			N:         n,
-			MeanNs:    mean,
-			StdNs:     std,
-		}
-
-		json.NewEncoder(os.Stdout).Encode(result)
+			fmt.Fprintf(os.Stderr, "history: %v\n", err)
+		}
+	}
+
+	if summaryPath := os.Getenv("GITHUB_STEP_SUMMARY"); summaryPath != "" {
+		if err := writeStepSummary(summaryPath, results, base, threshold); err != nil {
+			fmt.Fprintf(os.Stderr, "step summary: %v\n", err)
+		}
+	}
+
+	if junitPath != "" {
+		if err := writeJUnit(junitPath, results, base, threshold); err != nil {
+			fmt.Fprintf(os.Stderr, "junit: %v\n", err)
+		}
 	}
 }
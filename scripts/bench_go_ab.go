@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runAB implements `ab`: it builds two generated variants into one binary,
+// times them interleaved (see abDriverSource) and reports the distribution
+// of the paired differences B - A.
+func runAB(args []string) int {
+	fs := flag.NewFlagSet("ab", flag.ExitOnError)
+	code := fs.String("code", "", "Python snippet for both variants; {N} is replaced by -n")
+	codeA := fs.String("a-code", "", "snippet for A (default -code)")
+	codeB := fs.String("b-code", "", "snippet for B (default -code)")
+	flagsA := fs.String("a", "", "space-separated pcs flags for A, e.g. \"--parallel\"")
+	flagsB := fs.String("b", "", "space-separated pcs flags for B")
+	n := fs.Int("n", 1000000, "value substituted for {N}")
+	reps := fs.Int("reps", 20, "number of A/B pairs")
+	protocol := fs.String("protocol", getEnv("PCS_BENCH_PROTOCOL", "steady"), "warmup protocol: cold, warmup or steady")
+	fixed := fs.Int("warmup", 3, "untimed calls per variant under -protocol warmup")
+	asJSON := fs.Bool("json", false, "print the result as JSON, raw pairs included")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench ab -code snippet -a 'flags' -b 'flags' [-n N] [-reps R]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *codeA == "" {
+		*codeA = *code
+	}
+	if *codeB == "" {
+		*codeB = *code
+	}
+	if *codeA == "" || *codeB == "" {
+		fs.Usage()
+		return 2
+	}
+	if _, ok := measureProtocols[*protocol]; !ok {
+		fmt.Fprintf(os.Stderr, "ab: unknown protocol %q\n", *protocol)
+		return 2
+	}
+
+	fragments := map[string][]byte{}
+	var runtime []string
+	for _, v := range []struct{ name, code, flags string }{
+		{"A", *codeA, *flagsA},
+		{"B", *codeB, *flagsB},
+	} {
+		args := []string{"--code", strings.ReplaceAll(v.code, "{N}", strconv.Itoa(*n)),
+			"--target", "go", "--func-name", "program" + v.name}
+		out, err := runPCS("", 0, append(args, strings.Fields(v.flags)...)...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ab: generating %s: %v\n", v.name, err)
+			return 1
+		}
+		fragments["_"+strings.ToLower(v.name)] = out
+		runtime = append(runtime, vendoredRuntime(out)...)
+	}
+
+	sources, err := writeSources("generated/go_bench_ab", abDriverSource, fragments, runtime)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ab: %v\n", err)
+		return 1
+	}
+	build := exec.Command("go", append([]string{"build", "-o", "target/go_bench_ab"}, sources...)...)
+	if out, err := build.CombinedOutput(); err != nil {
+		// Both variants share a package, so helper types such as shardedMap
+		// must not be emitted by both.
+		fmt.Fprintf(os.Stderr, "ab: build failed: %v\n%s", err, out)
+		return 1
+	}
+
+	res, err := runABProgram("target/go_bench_ab", *reps, *protocol, *fixed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ab: %v\n", err)
+		return 1
+	}
+	res.Protocol = *protocol
+
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(res)
+		return 0
+	}
+	d := res.Diff
+	fmt.Printf("pairs      %d (interleaved, %s protocol, %d warmup calls)\n", len(res.Pairs), res.Protocol, res.Warmup)
+	fmt.Printf("median     A %s   B %s   B/A %.3f\n", time.Duration(res.MedianA), time.Duration(res.MedianB), res.Ratio)
+	fmt.Printf("B - A      min %s  p5 %s  p25 %s  median %s  p75 %s  p95 %s  max %s\n",
+		time.Duration(d.Min), time.Duration(d.P5), time.Duration(d.P25), time.Duration(d.Median),
+		time.Duration(d.P75), time.Duration(d.P95), time.Duration(d.Max))
+	fmt.Printf("           mean %s, B faster in %d of %d pairs\n", time.Duration(d.Mean), res.BFaster, len(res.Pairs))
+	return 0
+}
+
+// abResult summarises one interleaved session.
+type abResult struct {
+	Protocol string     `json:"protocol"`
+	Warmup   int        `json:"warmup_iters"`
+	Pairs    [][2]int64 `json:"pairs_ns"`
+	MedianA  int64      `json:"median_a_ns"`
+	MedianB  int64      `json:"median_b_ns"`
+	// Ratio is the median of the per-pair ratios B/A.
+	Ratio   float64      `json:"ratio"`
+	BFaster int          `json:"b_faster"`
+	Diff    distribution `json:"diff_ns"`
+}
+
+// distribution is a percentile summary of int64 samples.
+type distribution struct {
+	Min    int64 `json:"min"`
+	P5     int64 `json:"p5"`
+	P25    int64 `json:"p25"`
+	Median int64 `json:"median"`
+	P75    int64 `json:"p75"`
+	P95    int64 `json:"p95"`
+	Max    int64 `json:"max"`
+	Mean   int64 `json:"mean"`
+}
+
+func distributionOf(v []int64) distribution {
+	s := append([]int64(nil), v...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	var sum int64
+	for _, x := range s {
+		sum += x
+	}
+	return distribution{
+		Min: s[0], P5: percentile(s, 5), P25: percentile(s, 25), Median: percentile(s, 50),
+		P75: percentile(s, 75), P95: percentile(s, 95), Max: s[len(s)-1], Mean: sum / int64(len(s)),
+	}
+}
+
+func runABProgram(binary string, reps int, protocol string, fixed int) (abResult, error) {
+	out, err := exec.Command(binary, strconv.Itoa(reps), protocol, strconv.Itoa(fixed)).Output()
+	if err != nil {
+		return abResult{}, err
+	}
+
+	var res abResult
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		f := strings.Fields(scanner.Text())
+		switch {
+		case len(f) == 2 && f[0] == "warmup":
+			res.Warmup, err = strconv.Atoi(f[1])
+		case len(f) == 3 && f[0] == "pair":
+			var a, b int64
+			if a, err = strconv.ParseInt(f[1], 10, 64); err == nil {
+				b, err = strconv.ParseInt(f[2], 10, 64)
+			}
+			res.Pairs = append(res.Pairs, [2]int64{a, b})
+		case len(f) == 0:
+		default:
+			err = fmt.Errorf("unexpected driver output %q", scanner.Text())
+		}
+		if err != nil {
+			return abResult{}, err
+		}
+	}
+	if len(res.Pairs) != reps || reps == 0 {
+		return abResult{}, fmt.Errorf("driver reported %d pairs, want %d", len(res.Pairs), reps)
+	}
+
+	as := make([]int64, reps)
+	bs := make([]int64, reps)
+	diffs := make([]int64, reps)
+	ratios := make([]float64, reps)
+	for i, p := range res.Pairs {
+		as[i], bs[i], diffs[i] = p[0], p[1], p[1]-p[0]
+		ratios[i] = float64(p[1]) / float64(p[0])
+		if p[1] < p[0] {
+			res.BFaster++
+		}
+	}
+	res.MedianA, res.MedianB = medianOf(as), medianOf(bs)
+	res.Ratio = medianFloat(ratios)
+	res.Diff = distributionOf(diffs)
+	return res, nil
+}
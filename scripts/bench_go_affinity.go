@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// checkAffinity verifies that cpus can be used for pinning here and returns
+// it in canonical form with the number of CPUs it names.
+func checkAffinity(cpus string) (string, int, error) {
+	list, err := parseCPUList(cpus)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := hostProc.checkPinning(list); err != nil {
+		return "", 0, err
+	}
+	return formatCPUList(list), len(list), nil
+}
+
+// parseCPUList parses a Linux CPU list such as "0-3,6" into sorted,
+// de-duplicated CPU numbers.
+func parseCPUList(s string) ([]int, error) {
+	seen := map[int]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("invalid CPU list %q", s)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(hi); err != nil || last < first {
+				return nil, fmt.Errorf("invalid CPU list %q", s)
+			}
+		}
+		for c := first; c <= last; c++ {
+			seen[c] = true
+		}
+	}
+	cpus := make([]int, 0, len(seen))
+	for c := range seen {
+		cpus = append(cpus, c)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// formatCPUList is the inverse of parseCPUList, collapsing runs into ranges.
+func formatCPUList(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
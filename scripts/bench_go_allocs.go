@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cases marked zero_alloc, the scalar reductions pcs renders into plain
+// loops (see render_go's zero_alloc), must not allocate: before such a case
+// is timed its program counts the heap allocations of a call, averaged
+// over allocRuns calls as testing.AllocsPerRun does, and a case that
+// allocates at all fails as errAllocs (-allocs). A codegen change boxing an
+// accumulator or building a slice in the loop fails the run instead of
+// passing as a slowdown within the threshold.
+
+// errAllocs: a case marked zero_alloc allocated on the heap in its calls
+// (-allocs)
+const errAllocs = "allocates"
+
+// allocRuns is the number of calls a case's allocations are averaged over.
+const allocRuns = 100
+
+// allocCounter is a BackendRunner that can count the heap allocations of a
+// call of a build.
+type allocCounter interface {
+	Allocs(tc benchCase, p program, binary string, env runEnv) (float64, error)
+}
+
+// allocError is a zero_alloc case whose calls allocated.
+type allocError struct {
+	perCall float64
+}
+
+func (e *allocError) Error() string {
+	return fmt.Sprintf("%g heap allocations per call, want 0", e.perCall)
+}
+
+func (goRunner) Allocs(tc benchCase, p program, binary string, env runEnv) (float64, error) {
+	if tc.Data != "" {
+		env.Data = p.Input
+	}
+	output, err := runWithin(env.command(binary, strconv.Itoa(allocRuns), "allocs", "cold", "0"), env.Timeout, env.MaxRSS)
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "allocs "); ok {
+			return strconv.ParseFloat(rest, 64)
+		}
+	}
+	return 0, fmt.Errorf("driver reported no allocations")
+}
+
+// checkAllocs counts the allocations of a call of tc's build, returning nil
+// when it is not counted: only zero_alloc cases built by gc for the host
+// are. An allocating case returns its count and an allocError.
+func checkAllocs(r BackendRunner, tc benchCase, p program, binary string, env runEnv) (*float64, error) {
+	a, ok := r.(allocCounter)
+	if !ok || !tc.ZeroAlloc || tc.Stream != "" || tc.Target != "" || tc.toolchain() != "gc" {
+		return nil, nil
+	}
+	perCall, err := a.Allocs(tc, p, binary, env)
+	if err != nil {
+		return nil, err
+	}
+	if perCall > 0 {
+		return &perCall, &allocError{perCall}
+	}
+	return &perCall, nil
+}
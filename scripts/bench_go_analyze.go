@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// runAnalyze implements `analyze`: it walks every series in the history
+// store in timestamp order against a rolling median baseline and reports
+// step changes and gradual drifts as a JSON document.
+func runAnalyze(args []string) int {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	db := fs.String("db", "bench/history.db", "SQLite history database")
+	out := fs.String("o", "", "file to write the JSON report to (default stdout)")
+	threshold := fs.Float64("threshold", 0.15, "relative slowdown vs the rolling baseline counted as a regression")
+	window := fs.Int("window", 10, "number of previous results forming the rolling baseline")
+	confirm := fs.Int("confirm", 2, "consecutive slow results needed to call a step change")
+	fs.Parse(args)
+
+	if *window < 2 || *confirm < 1 {
+		fmt.Fprintln(os.Stderr, "analyze: -window must be at least 2 and -confirm at least 1")
+		return 2
+	}
+
+	h, err := openHistory(*db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "analyze: %v\n", err)
+		return 1
+	}
+	results, err := h.Query(historyQuery{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "analyze: %v\n", err)
+		return 1
+	}
+
+	report := analysisReport{
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		DB:        *db,
+		Threshold: *threshold,
+		Window:    *window,
+		Confirm:   *confirm,
+	}
+	for _, s := range historySeries(results) {
+		report.Series++
+		report.Regressions = append(report.Regressions, analyzeSeries(s, *threshold, *window, *confirm)...)
+	}
+	if report.Regressions == nil {
+		report.Regressions = []suspectedRegression{}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "analyze: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		fmt.Fprintf(os.Stderr, "analyze: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "analyzed %d series, %d suspected regressions\n", report.Series, len(report.Regressions))
+	return 0
+}
+
+type analysisReport struct {
+	Generated   string                `json:"generated"`
+	DB          string                `json:"db"`
+	Threshold   float64               `json:"threshold"`
+	Window      int                   `json:"window"`
+	Confirm     int                   `json:"confirm"`
+	Series      int                   `json:"series"`
+	Regressions []suspectedRegression `json:"regressions"`
+}
+
+type suspectedRegression struct {
+	Backend  string `json:"backend"`
+	Test     string `json:"test"`
+	Mode     string `json:"mode"`
+	N        int    `json:"n"`
+	Parallel bool   `json:"parallel"`
+	// Kind is "step" for an abrupt change or "drift" for a slow creep.
+	Kind           string  `json:"kind"`
+	FirstCommit    string  `json:"first_commit"`
+	FirstTimestamp string  `json:"first_timestamp"`
+	BaselineNs     int64   `json:"baseline_ns"`
+	CurrentNs      int64   `json:"current_ns"`
+	Change         float64 `json:"change"`
+}
+
+// historySeries splits successful results into per-benchmark series in
+// timestamp order.
+func historySeries(results []BenchmarkResult) [][]BenchmarkResult {
+	byKey := map[mergeKey][]BenchmarkResult{}
+	var keys []mergeKey
+	for _, r := range results {
+		if !r.measured() || r.MeanNs <= 0 {
+			continue
+		}
+		k := mergeKeyOf(r)
+		k.Commit, k.OS = "", ""
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], r)
+	}
+
+	series := make([][]BenchmarkResult, 0, len(keys))
+	for _, k := range keys {
+		s := byKey[k]
+		sort.SliceStable(s, func(i, j int) bool { return s[i].Timestamp < s[j].Timestamp })
+		series = append(series, s)
+	}
+	return series
+}
+
+// analyzeSeries looks for step changes first: confirm consecutive results
+// all slower than the rolling median of the window before them. After a
+// step the baseline is re-learned from the new level. A series with no step
+// is then checked for drift by comparing its first and last windows.
+func analyzeSeries(s []BenchmarkResult, threshold float64, window, confirm int) []suspectedRegression {
+	means := make([]int64, len(s))
+	for i, r := range s {
+		means[i] = r.MeanNs
+	}
+	suspect := func(kind string, i int, base, cur int64) suspectedRegression {
+		r := s[i]
+		return suspectedRegression{
+			Backend: r.Backend, Test: r.Test, Mode: r.Mode, N: r.N, Parallel: r.Parallel,
+			Kind: kind, FirstCommit: r.Commit, FirstTimestamp: r.Timestamp,
+			BaselineNs: base, CurrentNs: cur, Change: float64(cur-base) / float64(base),
+		}
+	}
+
+	var found []suspectedRegression
+	start := 0
+	const minHistory = 3
+	for i := minHistory; i+confirm <= len(s); i++ {
+		if i-start < minHistory {
+			continue
+		}
+		base := medianOf(means[max(start, i-window):i])
+		limit := float64(base) * (1 + threshold)
+		slow := true
+		for j := i; j < i+confirm; j++ {
+			if float64(means[j]) <= limit {
+				slow = false
+				break
+			}
+		}
+		if slow {
+			found = append(found, suspect("step", i, base, medianOf(means[i:i+confirm])))
+			start = i
+			i += confirm - 1
+		}
+	}
+	if len(found) > 0 || len(s) < 2*window {
+		return found
+	}
+
+	initial := medianOf(means[:window])
+	final := medianOf(means[len(means)-window:])
+	limit := float64(initial) * (1 + threshold)
+	if float64(final) <= limit {
+		return nil
+	}
+	// Blame the first result of the first window whose median crossed the
+	// threshold that is itself over it.
+	for end := window; end <= len(means); end++ {
+		if float64(medianOf(means[end-window:end])) <= limit {
+			continue
+		}
+		for i := end - window; i < end; i++ {
+			if float64(means[i]) > limit {
+				return []suspectedRegression{suspect("drift", i, initial, final)}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// BackendRunner is the part of the harness that differs per target
+// language. The main loop owns the rest: case order, sizes, the build
+// cache, artifacts, GOMAXPROCS sweeps, cooldowns and every result sink.
+type BackendRunner interface {
+	// Generate renders tc at size n through pcs, from cache when it holds
+	// the code already.
+	Generate(cache *buildCache, tc benchCase, n int) (code []byte, cached bool, err error)
+	// Build writes code with the backend's timing driver next to prefix.
+	Build(tc benchCase, code []byte, prefix string, n int) (program, error)
+	// Run times a build of p: reps calls after those the warmup protocol
+	// makes.
+	Run(tc benchCase, p program, binary string, env runEnv, reps int, protocol string, fixed int) (runOutput, error)
+	// Metrics fills result's timing fields from a run of reps calls.
+	Metrics(result BenchmarkResult, run runOutput, est estimator, reps int) BenchmarkResult
+}
+
+// program is a case's code as written by BackendRunner.Build.
+type program struct {
+	// Sources are the files written, hashed into module_hash
+	Sources []string
+	// Input is a file fed to the program on stdin, or the input data of
+	// a data case, if any
+	Input string
+	// Compile returns the command building Sources into binary
+	Compile func(binary string) (*exec.Cmd, error)
+}
+
+// sizedGenerator is a BackendRunner that can render a case once for all of
+// its sizes (see sizedCode), nil when the case does not allow it.
+type sizedGenerator interface {
+	GenerateSized(cache *buildCache, tc benchCase, sizes []int) []byte
+}
+
+type backend struct {
+	// Label names the language in messages, e.g. Go
+	Label string
+	// Toolchain is the compiler results of the backend's cases record
+	// (see benchCase.toolchain); Go cases name their own
+	Toolchain string
+	Runner    BackendRunner
+}
+
+// backends are the registered runners by result backend name.
+var backends = map[string]backend{}
+
+// standaloneBackends still run from their own script rather than through
+// a registered runner; -backend points there.
+var standaloneBackends = map[string]string{
+	"csharp": "scripts/bench_csharp.cs",
+}
+
+// pcsTargets are the pcs --target values of backends whose cases pcs
+// renders under another name than the backend's: cgo times C code.
+var pcsTargets = map[string]string{"cgo": "c"}
+
+// pcsTarget is the pcs --target tc is rendered with, and the capability
+// matrix row it is checked against.
+func (tc benchCase) pcsTarget() string {
+	if target, ok := pcsTargets[tc.backend()]; ok {
+		return target
+	}
+	return tc.backend()
+}
+
+func registerBackend(name, label, toolchain string, r BackendRunner) {
+	if _, dup := backends[name]; dup {
+		panic("backend " + name + " registered twice")
+	}
+	backends[name] = backend{Label: label, Toolchain: toolchain, Runner: r}
+}
+
+func init() {
+	registerBackend("go", "Go", "gc", goRunner{})
+}
+
+// lookupBackend returns the runner registered as name.
+func lookupBackend(name string) (backend, error) {
+	if b, ok := backends[name]; ok {
+		return b, nil
+	}
+	if script, ok := standaloneBackends[name]; ok {
+		return backend{}, fmt.Errorf("%s has no runner yet; run %s", name, script)
+	}
+	names := make([]string, 0, len(backends))
+	for n := range backends {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return backend{}, fmt.Errorf("unknown backend %q (want %s)", name, strings.Join(names, ", "))
+}
+
+// goRunner builds cases with the Go timing driver (see driverSource), or
+// as stream programs timed per process.
+type goRunner struct{}
+
+func (goRunner) Generate(cache *buildCache, tc benchCase, n int) ([]byte, bool, error) {
+	return generateCached(cache, tc, n)
+}
+
+// generateCached renders tc at size n through pcs for its backend, from
+// cache when it holds the code already.
+func generateCached(cache *buildCache, tc benchCase, n int) ([]byte, bool, error) {
+	key := cache.codeKey(generatorArgs(tc, n))
+	if code, ok := cache.loadCode(key); ok {
+		return code, true, nil
+	}
+	code, err := generateCase("", tc, n)
+	if err != nil {
+		return nil, false, err
+	}
+	cache.storeCode(key, code)
+	return code, false, nil
+}
+
+func (goRunner) GenerateSized(cache *buildCache, tc benchCase, sizes []int) []byte {
+	return sizedCode(cache, tc, sizes)
+}
+
+func (goRunner) Build(tc benchCase, code []byte, prefix string, n int) (program, error) {
+	var p program
+	var err error
+	switch {
+	case tc.Stream != "":
+		p.Sources, p.Input, err = writeStreamProgram(prefix, code, tc.Stream, n)
+	case tc.Data != "":
+		p.Input = prefix + "_data.bin"
+		if err = writeDataInput(p.Input, tc, n); err == nil {
+			p.Sources, err = writeSources(prefix, dataDriverSource, map[string][]byte{"": code}, tc.Runtime)
+		}
+	default:
+		p.Sources, err = writeProgram(prefix, code, tc.Runtime)
+	}
+	if err == nil && schedCase(tc) {
+		var path string
+		path, err = writeSchedSource(prefix)
+		p.Sources = append(p.Sources, path)
+	}
+	p.Compile = func(binary string) (*exec.Cmd, error) {
+		return buildCommand(tc, binary, p.Sources)
+	}
+	return p, err
+}
+
+func (goRunner) Run(tc benchCase, p program, binary string, env runEnv, reps int, protocol string, fixed int) (runOutput, error) {
+	if tc.Stream != "" {
+		return runStream(binary, env, reps, p.Input, protocol, fixed)
+	}
+	if tc.Data != "" {
+		env.Data = p.Input
+	}
+	return runProgram(binary, env, reps, tc.Measure, protocol, fixed)
+}
+
+// Result runs a build once for what it computes: a stream program over
+// its input, or the driver in "verify" mode.
+func (goRunner) Result(tc benchCase, p program, binary string, env runEnv) ([]byte, error) {
+	if tc.Stream != "" {
+		in, err := os.Open(p.Input)
+		if err != nil {
+			return nil, err
+		}
+		defer in.Close()
+		cmd := env.command(binary)
+		cmd.Stdin = in
+		return runWithin(cmd, env.Timeout, env.MaxRSS)
+	}
+	if tc.Data != "" {
+		env.Data = p.Input
+	}
+	return runWithin(env.command(binary, "1", "verify", "cold", "0"), env.Timeout, env.MaxRSS)
+}
+
+func (goRunner) Metrics(result BenchmarkResult, run runOutput, est estimator, reps int) BenchmarkResult {
+	return timingMetrics(result, run, est, reps)
+}
+
+// timingMetrics fills result's timing fields from the per-call times of a
+// driver run, as every backend's driver reports them.
+func timingMetrics(result BenchmarkResult, run runOutput, est estimator, reps int) BenchmarkResult {
+	stats := summarizeWith(est, run.Times)
+	result.MeanNs = stats.Mean
+	result.StdNs = stats.Std
+	result.MedianNs = stats.Median
+	result.P99Ns = stats.P99
+	result.CPUNs = run.CPU.Nanoseconds() / int64(reps+run.Warmup)
+	result.Resources = run.Usage
+	result.Warmup = run.Warmup
+	result.Samples = run.Times
+	result.LatencyHDR = hdrOf(run.Times).encode()
+	if run.Wall > 0 {
+		timed := run.timed()
+		result.MeasureMs = float64(timed.Microseconds()) / 1000
+		result.WarmupMs = float64(max(run.Wall-timed, 0).Microseconds()) / 1000
+	}
+	return result
+}
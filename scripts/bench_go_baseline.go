@@ -0,0 +1,61 @@
+package main
+
+import "sort"
+
+// resultKey identifies the same benchmark across runs, each GOMAXPROCS
+// level of a -procs-sweep being its own (see sweepLevel), each Go version of
+// -go-versions too, and a previously built binary timed with
+// -compare-binary apart from this build.
+type resultKey struct {
+	Backend, Test, Mode, Target, GoVersion, Binary string
+	N, GOMAXPROCS                                  int
+}
+
+func keyOf(r BenchmarkResult) resultKey {
+	return resultKey{r.Backend, r.Test, r.Mode, r.Target, r.GoVersion, r.Binary, r.N, sweepLevel(r)}
+}
+
+// baseline holds the reference mean per benchmark, taken as the median of
+// all successful records for that benchmark in the baseline file.
+type baseline map[resultKey]int64
+
+// loadBaseline reads an NDJSON results file. Malformed lines and failed
+// records are skipped.
+func loadBaseline(path string) (baseline, error) {
+	results, err := readResults(path)
+	if err != nil {
+		return nil, err
+	}
+
+	means := map[resultKey][]int64{}
+	for _, r := range results {
+		if !r.measured() || r.MeanNs <= 0 {
+			continue
+		}
+		means[keyOf(r)] = append(means[keyOf(r)], r.MeanNs)
+	}
+
+	b := baseline{}
+	for k, v := range means {
+		sort.Slice(v, func(i, j int) bool { return v[i] < v[j] })
+		b[k] = v[len(v)/2]
+	}
+	return b, nil
+}
+
+// delta returns the relative change of r's mean against the baseline
+// (0.10 means 10% slower) and whether a baseline exists for r.
+func (b baseline) delta(r BenchmarkResult) (float64, bool) {
+	ref, ok := b[keyOf(r)]
+	if !ok || ref <= 0 || !r.measured() {
+		return 0, false
+	}
+	return float64(r.MeanNs-ref) / float64(ref), true
+}
+
+// regressed reports whether r is slower than the baseline by more than
+// threshold.
+func (b baseline) regressed(r BenchmarkResult, threshold float64) bool {
+	d, ok := b.delta(r)
+	return ok && d > threshold
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// batchJob is one line of `batch`'s input: a snippet as POST /bench takes
+// it, and the test and mode its result is filed under (snippet and loops or
+// parallel by default). ID, when set, comes back as the result's "job"
+// label, to match results to jobs when several run at once.
+type batchJob struct {
+	serveRequest
+	ID     string    `json:"id"`
+	Test   string    `json:"test"`
+	Mode   string    `json:"mode"`
+	Labels runLabels `json:"labels"`
+}
+
+// runBatch implements `batch`: it reads jobs as NDJSON from a file or
+// stdin and writes one BenchmarkResult per job to stdout as each
+// completes, so the harness composes with jq, xargs and queue workers
+// without a cases file. A job that fails, or asks for what cannot run,
+// still gets its result, with the error set; a line that is no job at all,
+// malformed or for an unknown target, is reported on stderr.
+//
+//	{"code": "sum(i*i for i in range(1, {N}))", "n": 1000000, "reps": 5}
+//	{"id": "7", "code": "{x: x for x in range({N})}", "target": "rust", "mode": "dict"}
+func runBatch(args []string) int {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", 1, "jobs run at once; results then come in the order they complete, and timings skew each other")
+	timeout := fs.Duration("timeout", 5*time.Minute, "limit on each generate, compile and benchmark process")
+	maxRSSFlag := fs.String("max-rss", os.Getenv("PCS_BENCH_MAX_RSS"), "kill a benchmark process whose RSS exceeds this, e.g. 1GiB")
+	cacheDir := fs.String("cache", "target/go_bench_cache", "directory caching generated code and binaries by content hash")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench batch [flags] [jobs.ndjson] > results.ndjson\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 || *concurrency < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	in := io.Reader(os.Stdin)
+	if path := fs.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "batch: %v\n", err)
+			return 2
+		}
+		defer f.Close()
+		in = f
+	}
+	s := &server{timeout: *timeout}
+	var err error
+	if *maxRSSFlag != "" {
+		if s.maxRSS, err = parseByteSize(*maxRSSFlag); err == nil {
+			err = checkRSSWatch()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "batch: -max-rss: %v\n", err)
+			return 2
+		}
+	}
+	if s.cache, err = openBuildCache(*cacheDir, "pcs"); err != nil {
+		fmt.Fprintf(os.Stderr, "batch: -cache: %v\n", err)
+		return 2
+	}
+	defer s.cache.close()
+	if s.dir, err = os.MkdirTemp("", "pcs-batch-"); err != nil {
+		fmt.Fprintf(os.Stderr, "batch: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(s.dir)
+	s.commit, s.git = detectGit()
+	s.harness = readHarnessBuild()
+	if g, err := resolveGo("go"); err == nil {
+		s.goVer = g.Version
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runCtx = ctx
+
+	type line struct {
+		n    int
+		data []byte
+	}
+	lines := make(chan line)
+	var mu sync.Mutex
+	out := json.NewEncoder(os.Stdout)
+	jobs, failed := 0, 0
+	var wg sync.WaitGroup
+	for range *concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l := range lines {
+				result, err := s.batch(l.data)
+				mu.Lock()
+				jobs++
+				if err != nil || result.Error != "" {
+					failed++
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "batch: line %d: %v\n", l.n, err)
+				} else if err := out.Encode(result); err != nil {
+					fmt.Fprintf(os.Stderr, "batch: %v\n", err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	n := 0
+	for scanner.Scan() && ctx.Err() == nil {
+		n++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		select {
+		case lines <- line{n, bytes.Clone(data)}:
+		case <-ctx.Done():
+		}
+	}
+	close(lines)
+	wg.Wait()
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "batch: %v\n", err)
+		return 1
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "batch: interrupted")
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "batch: %d jobs, %d failed\n", jobs, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// batch runs the job data and returns its result, or an error when data
+// is not a job.
+func (s *server) batch(data []byte) (BenchmarkResult, error) {
+	var job batchJob
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&job); err != nil {
+		return BenchmarkResult{}, err
+	}
+	if job.Target == "" {
+		job.Target = "go"
+	}
+	be, err := lookupBackend(job.Target)
+	if err != nil {
+		return BenchmarkResult{}, err
+	}
+	if job.Test == "" {
+		job.Test = "snippet"
+	}
+	if job.Mode == "" {
+		job.Mode = map[bool]string{false: "loops", true: "parallel"}[job.Parallel]
+	}
+	if job.N == 0 {
+		job.N = 100000
+	}
+	if job.Reps == 0 {
+		job.Reps = 10
+	}
+	if err := job.check(); err != nil {
+		return BenchmarkResult{
+			SchemaVersion: runSchemaVersion,
+			Commit:        s.commit,
+			Git:           s.git,
+			Timestamp:     time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+			OS:            runtime.GOOS,
+			CPU:           cpuName(),
+			Backend:       job.Target,
+			Test:          job.Test,
+			Mode:          job.Mode,
+			Parallel:      job.Parallel,
+			N:             max(job.N, 0),
+			Labels:        job.labels(),
+			Error:         "invalid job: " + err.Error(),
+			ErrorClass:    errSetup,
+		}, nil
+	}
+	result := s.bench(be, job.serveRequest)
+	result.Test, result.Mode, result.Labels = job.Test, job.Mode, job.labels()
+	return result, nil
+}
+
+// check reports what keeps the job from running.
+func (job batchJob) check() error {
+	if strings.TrimSpace(job.Code) == "" {
+		return fmt.Errorf("code is required")
+	}
+	if job.N < 1 || job.Reps < 1 {
+		return fmt.Errorf("n and reps must be positive")
+	}
+	for key := range job.Labels {
+		if err := checkLabelKey(key); err != nil {
+			return err
+		}
+	}
+	if _, ok := job.Labels["job"]; ok && job.ID != "" {
+		return fmt.Errorf(`label "job" is the id's`)
+	}
+	return nil
+}
+
+// labels are the job's labels and its ID.
+func (job batchJob) labels() runLabels {
+	if job.ID == "" {
+		return job.Labels
+	}
+	labels := runLabels{"job": job.ID}
+	for k, v := range job.Labels {
+		if k != "job" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// runBisect implements `bisect -bench test/mode <good> <bad>`: it runs
+// `git bisect` in a scratch worktree and, at each step, regenerates and
+// re-benchmarks the case. A commit is bad when its median is more than
+// -threshold slower than the good commit's.
+func runBisect(args []string) int {
+	fs := flag.NewFlagSet("bisect", flag.ExitOnError)
+	bench := fs.String("bench", "", "case to track, as test/mode (see the harness case list)")
+	threshold := fs.Float64("threshold", 0.10, "relative slowdown over the good commit that marks a commit bad")
+	n := fs.Int("n", 1000000, "value substituted for {N}")
+	rounds := fs.Int("rounds", 3, "runs of the binary per commit")
+	reps := fs.Int("reps", 10, "timed calls per run")
+	protocol := fs.String("protocol", getEnv("PCS_BENCH_PROTOCOL", "steady"), "warmup protocol: cold, warmup or steady")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench bisect -bench test/mode [-threshold 0.10] <good> <bad>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 || *bench == "" || *threshold <= 0 || *rounds < 1 || *reps < 1 {
+		fs.Usage()
+		return 2
+	}
+	if _, ok := measureProtocols[*protocol]; !ok {
+		fmt.Fprintf(os.Stderr, "bisect: unknown protocol %q\n", *protocol)
+		return 2
+	}
+	var tc benchCase
+	found := false
+	for _, c := range benchCases() {
+		if c.Test+"/"+c.Mode == *bench {
+			tc, found = c, true
+		}
+	}
+	if !found {
+		fmt.Fprintf(os.Stderr, "bisect: unknown case %q\n", *bench)
+		return 2
+	}
+
+	work, err := os.MkdirTemp("", "pcs-bisect-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bisect: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(work)
+	good, err := checkoutSide(work, "good", fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bisect: %v\n", err)
+		return 1
+	}
+	defer good.remove()
+	bad, err := checkoutSide(work, "bad", fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bisect: %v\n", err)
+		return 1
+	}
+	defer bad.remove()
+
+	b := &bisector{work: work, tc: tc, n: *n, rounds: *rounds, reps: *reps, protocol: *protocol, seen: map[[32]byte]int64{}}
+	goodMedian, err := b.measure(good.dir, good.sha)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bisect: good commit %s: %v\n", good.ref, err)
+		return 1
+	}
+	badMedian, err := b.measure(bad.dir, bad.sha)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bisect: bad commit %s: %v\n", bad.ref, err)
+		return 1
+	}
+	limit := int64(float64(goodMedian) * (1 + *threshold))
+	fmt.Fprintf(os.Stderr, "good %s: %s, bad %s: %s, limit %s\n", good.sha[:12], time.Duration(goodMedian),
+		bad.sha[:12], time.Duration(badMedian), time.Duration(limit))
+	if badMedian <= limit {
+		fmt.Fprintf(os.Stderr, "bisect: %s is not more than %.0f%% slower than %s; nothing to bisect\n",
+			bad.ref, *threshold*100, good.ref)
+		return 1
+	}
+
+	// The bisection runs in the "bad" worktree so the caller's checkout and
+	// bisect state are never touched.
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = bad.dir
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+	defer git("bisect", "reset")
+	out, err := git("bisect", "start", bad.sha, good.sha)
+	for err == nil {
+		if sha, ok := firstBadCommit(out); ok {
+			subject, _ := git("log", "-1", "--format=%h %s", sha)
+			fmt.Printf("first slow commit: %s", subject)
+			return 0
+		}
+		var head string
+		if head, err = git("rev-parse", "HEAD"); err != nil {
+			break
+		}
+		head = strings.TrimSpace(head)
+		verdict := "skip"
+		median, merr := b.measure(bad.dir, head)
+		switch {
+		case merr != nil:
+			fmt.Fprintf(os.Stderr, "%s: %v, skipping\n", head[:12], merr)
+		case median > limit:
+			verdict = "bad"
+		default:
+			verdict = "good"
+		}
+		if merr == nil {
+			fmt.Fprintf(os.Stderr, "%s: %s, %s\n", head[:12], time.Duration(median), verdict)
+		}
+		out, err = git("bisect", verdict)
+	}
+	if strings.Contains(out, "only 'skip'ped commits left") {
+		fmt.Print(out)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "bisect: git bisect: %v\n%s", err, out)
+	return 1
+}
+
+var firstBadRE = regexp.MustCompile(`(?m)^([0-9a-f]{40}) is the first bad commit`)
+
+func firstBadCommit(out string) (string, bool) {
+	m := firstBadRE.FindStringSubmatch(out)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// bisector measures one case at successive commits. Commits whose generated
+// code is identical to one already measured reuse that median, so unrelated
+// commits cannot flip the verdict through noise alone.
+type bisector struct {
+	work     string
+	tc       benchCase
+	n        int
+	rounds   int
+	reps     int
+	protocol string
+	seen     map[[32]byte]int64
+}
+
+func (b *bisector) measure(src, sha string) (int64, error) {
+	binary, code, err := buildCaseAt(src, filepath.Join(b.work, "build", sha), b.tc, b.n)
+	if err != nil {
+		return 0, err
+	}
+	key := sha256.Sum256(code)
+	if m, ok := b.seen[key]; ok {
+		return m, nil
+	}
+	var samples []int64
+	for i := 0; i < b.rounds; i++ {
+		run, err := runProgram(binary, runEnv{}, b.reps, b.tc.Measure, b.protocol, 3)
+		if err != nil {
+			return 0, err
+		}
+		samples = append(samples, run.Times...)
+	}
+	m := medianOf(samples)
+	b.seen[key] = m
+	return m, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// Results describe how they were built so a file can be reproduced long
+// after the run: the harness build that produced them, a hash of the
+// generated sources and the Go version and settings the gc toolchain stamped
+// into the benchmark binary.
+
+// harnessVersion identifies this harness build: bench_go@ the VCS revision
+// it was built from, when go build stamped one, or else the sha256 prefix of
+// the executable, as a build from a file list carries no version.
+func harnessVersion() string {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		rev, dirty := "", false
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				rev = s.Value
+			case "vcs.modified":
+				dirty = s.Value == "true"
+			}
+		}
+		if rev != "" {
+			if dirty {
+				rev += "-dirty"
+			}
+			return "bench_go@" + rev
+		}
+		if v := bi.Main.Version; v != "" && v != "(devel)" {
+			return "bench_go@" + v
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "bench_go"
+	}
+	sum, err := hashFiles(exe)
+	if err != nil {
+		return "bench_go"
+	}
+	return "bench_go@" + sum
+}
+
+// harnessBuild describes this harness build, as `pcs-bench version` prints
+// it and every result carries it: Version as harnessVersion, the VCS
+// Revision and whether the checkout was Modified, BuildDate (the commit
+// time go build stamped, or else the executable's modification time) and
+// the GoVersion it was compiled with.
+type harnessBuild struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+func readHarnessBuild() *harnessBuild {
+	b := &harnessBuild{Version: harnessVersion(), GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		b.GoVersion = bi.GoVersion
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				b.Revision = s.Value
+			case "vcs.modified":
+				b.Modified = s.Value == "true"
+			case "vcs.time":
+				b.BuildDate = s.Value
+			}
+		}
+	}
+	if b.BuildDate == "" {
+		if exe, err := os.Executable(); err == nil {
+			if info, err := os.Stat(exe); err == nil {
+				b.BuildDate = info.ModTime().UTC().Format(time.RFC3339)
+			}
+		}
+	}
+	return b
+}
+
+// runVersion implements `version`: it prints the harness build.
+func runVersion(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the build as one JSON object")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench version [-json]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	b := readHarnessBuild()
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(b)
+		return 0
+	}
+	fmt.Println(b.Version)
+	if b.Revision != "" {
+		modified := ""
+		if b.Modified {
+			modified = " (modified)"
+		}
+		fmt.Printf("  revision   %s%s\n", b.Revision, modified)
+	}
+	if b.BuildDate != "" {
+		fmt.Printf("  built      %s\n", b.BuildDate)
+	}
+	fmt.Printf("  go         %s %s/%s\n", b.GoVersion, runtime.GOOS, runtime.GOARCH)
+	return 0
+}
+
+// hashFiles is the "sha256:" prefix over the base names and contents of
+// paths, in name order.
+func hashFiles(paths ...string) (string, error) {
+	sorted := append([]string(nil), paths...)
+	sort.Slice(sorted, func(i, j int) bool { return filepath.Base(sorted[i]) < filepath.Base(sorted[j]) })
+	h := sha256.New()
+	for _, p := range sorted {
+		f, err := os.Open(p)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, filepath.Base(p)+"\n")
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// binaryBuild reads the Go version and build settings (-gcflags, -ldflags,
+// -trimpath, -pgo, CGO_ENABLED, GOOS, GOARCH, GOAMD64, ...) the gc
+// toolchain embeds in binary. TinyGo binaries carry none.
+func binaryBuild(binary string) (goVersion string, settings map[string]string, ok bool) {
+	bi, err := buildinfo.ReadFile(binary)
+	if err != nil {
+		return "", nil, false
+	}
+	settings = map[string]string{}
+	for _, s := range bi.Settings {
+		settings[s.Key] = s.Value
+	}
+	return bi.GoVersion, settings, true
+}
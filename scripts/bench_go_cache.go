@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// buildCache keeps generated code and built binaries by content hash
+// (-cache), so re-running the matrix after a change to the harness alone
+// skips codegen and go build for every case whose inputs are unchanged.
+// Generated code is keyed by the pcs sources and the generator's arguments,
+// binaries by the sources they were built from and everything that affects
+// go build's output. Without a directory the cache lives in a temporary
+// one for the run, so cases sharing a build still share it. A nil cache
+// never hits.
+type buildCache struct {
+	// mu guards Dir, which a run-scoped cache sets on its first store while
+	// other cases may be reading it
+	mu  sync.Mutex
+	Dir string
+	// temp is set for a run-scoped cache, whose Dir is created on the first
+	// store and removed by close
+	temp bool
+	// generator hashes the pcs package, so code is regenerated when the
+	// renderers change
+	generator string
+}
+
+// buildEnvVars are the environment variables that change what go build
+// produces for the same sources and flags.
+var buildEnvVars = []string{"GOFLAGS", "GOEXPERIMENT", "GOAMD64", "GOARM", "GOARM64", "GO386", "CGO_ENABLED", "CC"}
+
+// openBuildCache opens the cache in dir, a run-scoped one when dir is
+// empty. Code is only cached when the pcs package can be found under
+// generatorDir.
+func openBuildCache(dir, generatorDir string) (*buildCache, error) {
+	c := &buildCache{Dir: dir, temp: dir == ""}
+	if !c.temp {
+		if err := c.makeDirs(); err != nil {
+			return nil, err
+		}
+	}
+	var files []string
+	filepath.WalkDir(generatorDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(path, ".py") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if len(files) > 0 {
+		h := sha256.New()
+		for _, path := range files {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return c, nil
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(path), len(data))
+			h.Write(data)
+		}
+		c.generator = hex.EncodeToString(h.Sum(nil))
+	}
+	return c, nil
+}
+
+// cacheKey hashes parts, which must not contain NUL bytes.
+func cacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// codeKey is the key of the code pcs generates for args.
+func (c *buildCache) codeKey(args []string) string {
+	if c == nil || c.generator == "" {
+		return ""
+	}
+	return cacheKey(append([]string{"code", c.generator}, args...)...)
+}
+
+// binaryKey is the key of the binary r's case builds from sources with the
+// module hash r.ModuleHash. TinyGo builds are not cached, as nothing
+// identifies the installed TinyGo cheaply.
+func (c *buildCache) binaryKey(r BenchmarkResult) string {
+	if c == nil || r.Toolchain != "gc" || r.ModuleHash == "" || r.GoVersion == "" {
+		return ""
+	}
+	parts := []string{"bin", r.ModuleHash, r.GoVersion, r.Target, r.ContainerImage, strings.Join(r.BuildFlags, "\x01")}
+	for _, name := range buildEnvVars {
+		parts = append(parts, name+"="+os.Getenv(name))
+	}
+	return cacheKey(parts...)
+}
+
+func (c *buildCache) makeDirs() error {
+	for _, sub := range []string{"code", "bin"} {
+		if err := os.MkdirAll(filepath.Join(c.Dir, sub), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dir is the cache's directory, "" until a run-scoped cache's first store.
+func (c *buildCache) dir() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Dir
+}
+
+// writable creates a run-scoped cache's directory on first use. It reports
+// whether entries can be stored.
+func (c *buildCache) writable() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Dir != "" {
+		return true
+	}
+	dir, err := os.MkdirTemp("", "go_bench_cache")
+	if err != nil {
+		return false
+	}
+	c.Dir = dir
+	return c.makeDirs() == nil
+}
+
+// close removes a run-scoped cache.
+func (c *buildCache) close() {
+	if c == nil || !c.temp {
+		return
+	}
+	if dir := c.dir(); dir != "" {
+		os.RemoveAll(dir)
+	}
+}
+
+func (c *buildCache) path(kind, key string) string {
+	return filepath.Join(c.dir(), kind, key)
+}
+
+// loadCode returns cached generated code.
+func (c *buildCache) loadCode(key string) ([]byte, bool) {
+	if key == "" || c.dir() == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path("code", key))
+	if err != nil {
+		return nil, false
+	}
+	c.touch(c.path("code", key))
+	return data, true
+}
+
+func (c *buildCache) storeCode(key string, code []byte) {
+	if key != "" && c.writable() {
+		writeAtomic(c.path("code", key), 0644, func(w io.Writer) error {
+			_, err := w.Write(code)
+			return err
+		})
+	}
+}
+
+// loadBinary copies a cached binary to dst, returning how long its original
+// build took.
+func (c *buildCache) loadBinary(key, dst string) (compileMs float64, ok bool) {
+	if key == "" || c.dir() == "" {
+		return 0, false
+	}
+	bin := c.path("bin", key)
+	meta, err := os.ReadFile(bin + ".ms")
+	if err != nil {
+		return 0, false
+	}
+	if compileMs, err = strconv.ParseFloat(strings.TrimSpace(string(meta)), 64); err != nil {
+		return 0, false
+	}
+	if err := copyFile(bin, dst, 0755); err != nil {
+		return 0, false
+	}
+	c.touch(bin)
+	c.touch(bin + ".ms")
+	return compileMs, true
+}
+
+// storeBinary adds a built binary with its compile time. The binary is
+// written before its metadata, which loadBinary checks first, so a
+// concurrent run never copies a partial binary.
+func (c *buildCache) storeBinary(key, src string, compileMs float64) {
+	if key == "" || !c.writable() {
+		return
+	}
+	bin := c.path("bin", key)
+	if err := copyFile(src, bin, 0755); err != nil {
+		return
+	}
+	writeAtomic(bin+".ms", 0644, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%g\n", compileMs)
+		return err
+	})
+}
+
+// touch marks an entry used, for prune.
+func (c *buildCache) touch(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// prune deletes entries unused for longer than maxAge (none when zero).
+func (c *buildCache) prune(maxAge time.Duration) {
+	if c == nil || c.temp || maxAge <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-maxAge)
+	for _, sub := range []string{"code", "bin"} {
+		entries, _ := os.ReadDir(filepath.Join(c.dir(), sub))
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(filepath.Join(c.dir(), sub, e.Name()))
+			}
+		}
+	}
+}
+
+// copyFile copies src to dst through a temporary file, so dst is either
+// absent or complete.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeAtomic(dst, perm, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// writeAtomic writes path through a temporary file in the same directory.
+func writeAtomic(path string, perm os.FileMode, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
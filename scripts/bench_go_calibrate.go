@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// `calibrate` measures how much a known-stable workload's mean moves from
+// one run to the next on this machine, and from that noise floor derives
+// the smallest slowdown a single run can be trusted to detect. It stores
+// that minimum detectable effect (MDE) per machine fingerprint in
+// -calibration, and `run` uses it as -threshold on the same machine unless
+// -threshold is given, so a quiet bare-metal runner gates on 2% while a
+// noisy shared one does not fail on 10% of jitter.
+
+// The MDE is (zAlpha + zPower) * sqrt(2) * CV: a one-sided test at 5%
+// with 80% power, comparing one run's mean against a baseline run's, both
+// with the run-to-run coefficient of variation CV.
+const (
+	calibrateZAlpha = 1.6449
+	calibrateZPower = 0.8416
+	// minDetectableFloor keeps a machine that measured no noise at all
+	// from gating on rounding.
+	minDetectableFloor = 0.01
+)
+
+// calibrationWorkload is the snippet calibrate times by default: a tight
+// integer loop with no allocation, whose own speed does not vary.
+const calibrationWorkload = "sum(i*i for i in range(1, {N}) if i%2==0)"
+
+// calibrationFile is -calibration: machine calibrations by fingerprint ID.
+type calibrationFile struct {
+	Machines map[string]machineCalibration `json:"machines"`
+}
+
+// machineCalibration is one machine's noise floor: the CV of the means of
+// Runs runs of Code at N with Reps timed calls each, and the MDE it
+// allows.
+type machineCalibration struct {
+	Machine    machineFingerprint `json:"machine"`
+	MDE        float64            `json:"mde"`
+	CV         float64            `json:"cv"`
+	Runs       int                `json:"runs"`
+	Reps       int                `json:"reps"`
+	N          int                `json:"n"`
+	Code       string             `json:"code"`
+	MeanNs     int64              `json:"mean_ns"`
+	Calibrated string             `json:"calibrated"`
+	Commit     string             `json:"commit"`
+}
+
+// loadCalibration reads path; a missing file holds no calibrations.
+func loadCalibration(path string) (calibrationFile, error) {
+	f := calibrationFile{Machines: map[string]machineCalibration{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("%s: %v", path, err)
+	}
+	if f.Machines == nil {
+		f.Machines = map[string]machineCalibration{}
+	}
+	return f, nil
+}
+
+// save writes f to path, replacing it whole.
+func (f calibrationFile) save(path string) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return writeAtomic(path, 0644, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(f)
+	})
+}
+
+// runCalibrate implements `calibrate`.
+func runCalibrate(args []string) int {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	path := fs.String("calibration", "bench/calibration.json", "file of per-machine calibrations to update")
+	code := fs.String("code", calibrationWorkload, "stable workload to time; {N} is replaced by -n")
+	n := fs.Int("n", 1000000, "value substituted for {N}")
+	runs := fs.Int("runs", 20, "separate benchmark processes to time")
+	reps := fs.Int("reps", 10, "timed calls per run")
+	timeout := fs.Duration("timeout", 5*time.Minute, "limit on each generate, compile and benchmark process")
+	cacheDir := fs.String("cache", "target/go_bench_cache", "directory caching generated code and binaries by content hash")
+	dryRun := fs.Bool("dry-run", false, "print the calibration without storing it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench calibrate [-runs 20] [-calibration bench/calibration.json]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 || *runs < 3 || *reps < 1 || *n < 1 {
+		fs.Usage()
+		return 2
+	}
+	stored, err := loadCalibration(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "calibrate: %v\n", err)
+		return 2
+	}
+
+	s := &server{timeout: *timeout}
+	if s.cache, err = openBuildCache(*cacheDir, "pcs"); err != nil {
+		fmt.Fprintf(os.Stderr, "calibrate: -cache: %v\n", err)
+		return 2
+	}
+	defer s.cache.close()
+	if s.dir, err = os.MkdirTemp("", "pcs-calibrate-"); err != nil {
+		fmt.Fprintf(os.Stderr, "calibrate: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(s.dir)
+	s.commit, s.git = detectGit()
+	s.harness = readHarnessBuild()
+	if g, err := resolveGo("go"); err == nil {
+		s.goVer = g.Version
+	}
+	be, err := lookupBackend("go")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "calibrate: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runCtx = ctx
+
+	means := make([]float64, 0, *runs)
+	req := serveRequest{Code: *code, Target: "go", N: *n, Reps: *reps}
+	for i := range *runs {
+		r := s.bench(be, req)
+		if interrupted() {
+			fmt.Fprintln(os.Stderr, "calibrate: interrupted")
+			return exitInterrupted
+		}
+		if r.Error != "" {
+			fmt.Fprintf(os.Stderr, "calibrate: run %d: %s\n", i+1, r.Error)
+			return 1
+		}
+		means = append(means, float64(r.MeanNs))
+		fmt.Fprintf(os.Stderr, "calibrate: run %d of %d: mean %d ns\n", i+1, *runs, r.MeanNs)
+	}
+
+	mean, variance := meanVar(means)
+	cv := math.Sqrt(variance) / mean
+	topology, err := detectTopology()
+	if err != nil {
+		topology = countCores()
+	}
+	c := machineCalibration{
+		Machine:    newMachineFingerprint(topology),
+		MDE:        math.Max((calibrateZAlpha+calibrateZPower)*math.Sqrt2*cv, minDetectableFloor),
+		CV:         cv,
+		Runs:       *runs,
+		Reps:       *reps,
+		N:          *n,
+		Code:       *code,
+		MeanNs:     int64(math.Round(mean)),
+		Calibrated: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		Commit:     s.commit,
+	}
+	fmt.Fprintf(os.Stderr, "calibrate: machine %s (%s): run-to-run CV %.2f%%, minimum detectable effect %.1f%%\n",
+		c.Machine.ID, c.Machine.CPUModel, cv*100, c.MDE*100)
+	if *dryRun {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(c)
+		return 0
+	}
+	stored.Machines[c.Machine.ID] = c
+	if err := stored.save(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "calibrate: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "calibrate: stored in %s; run uses it as -threshold on this machine\n", *path)
+	return 0
+}
+
+// calibratedThreshold is the MDE calibrated for machine in path, if any.
+func calibratedThreshold(path string, machine machineFingerprint) (float64, bool, error) {
+	stored, err := loadCalibration(path)
+	if err != nil {
+		return 0, false, err
+	}
+	c, ok := stored.Machines[machine.ID]
+	return c.MDE, ok && c.MDE > 0, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// capabilityMatrix is backend -> construct -> supported, as printed by
+// `python3 -m pcs --capabilities`.
+type capabilityMatrix map[string]map[string]bool
+
+// loadCapabilities asks the code generator which constructs each backend
+// renders faithfully.
+func loadCapabilities() (capabilityMatrix, error) {
+	out, err := exec.Command("python3", "-m", "pcs", "--capabilities").Output()
+	if err != nil {
+		return nil, fmt.Errorf("pcs --capabilities: %v", err)
+	}
+	var m capabilityMatrix
+	if err := json.Unmarshal(out, &m); err != nil {
+		return nil, fmt.Errorf("pcs --capabilities: %v", err)
+	}
+	return m, nil
+}
+
+// missing returns the constructs in requires that backend does not support.
+func (m capabilityMatrix) missing(backend string, requires []string) []string {
+	var gaps []string
+	for _, c := range requires {
+		if !m[backend][c] {
+			gaps = append(gaps, c)
+		}
+	}
+	return gaps
+}
+
+// runCapabilities implements `capabilities`: it prints the matrix as a table,
+// or re-emits it as JSON for other tools.
+func runCapabilities(args []string) int {
+	fs := flag.NewFlagSet("capabilities", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the matrix as JSON")
+	fs.Parse(args)
+
+	m, err := loadCapabilities()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "capabilities: %v\n", err)
+		return 1
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(m)
+		return 0
+	}
+
+	var backends []string
+	constructs := map[string]bool{}
+	for b, row := range m {
+		backends = append(backends, b)
+		for c := range row {
+			constructs[c] = true
+		}
+	}
+	sort.Strings(backends)
+	var cols []string
+	for c := range constructs {
+		cols = append(cols, c)
+	}
+	sort.Strings(cols)
+
+	fmt.Printf("%-8s", "")
+	for _, c := range cols {
+		fmt.Printf(" %-*s", len(c), c)
+	}
+	fmt.Println()
+	for _, b := range backends {
+		fmt.Printf("%-8s", b)
+		for _, c := range cols {
+			mark := "-"
+			if m[b][c] {
+				mark = "✓"
+			}
+			fmt.Printf(" %s%s", mark, strings.Repeat(" ", len(c)-1))
+		}
+		fmt.Println()
+	}
+	return 0
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// userCase is one entry of a -cases file: a JSON array of these adds the
+// team's own snippets to the matrix. The snippet is exactly one of Code, an
+// expression that may span lines; CodeFile, a file holding one; Stages, a
+// pipeline of "name=expr" stages; or StagesFile, a file with one stage per
+// line. {N} is replaced by each size as in the stock matrix, and files are
+// read relative to the -cases file. Data makes the snippet iterate a
+// generated input, data (see dataDistributions). The remaining fields are
+// those of benchCase.
+type userCase struct {
+	Test       string   `json:"test"`
+	Mode       string   `json:"mode"`
+	Code       string   `json:"code"`
+	CodeFile   string   `json:"code_file"`
+	More       []string `json:"more"`
+	Stages     []string `json:"stages"`
+	StagesFile string   `json:"stages_file"`
+	Data       string   `json:"data"`
+	Parallel   bool     `json:"parallel"`
+	Flags      []string `json:"flags"`
+	BuildFlags []string `json:"build_flags"`
+	Estimator  string   `json:"estimator"`
+	Requires   []string `json:"requires"`
+	Sizes      []int    `json:"sizes"`
+	After      []string `json:"after"`
+	ZeroAlloc  bool     `json:"zero_alloc"`
+}
+
+// loadMatrix returns the cases of a run: the stock matrix unless stock is
+// false, then those of each -suite and -cases file in turn.
+func loadMatrix(stock bool, suites, caseFiles []string) ([]benchCase, error) {
+	var matrix []benchCase
+	if stock {
+		matrix = benchCases()
+	}
+	for _, name := range suites {
+		cases, err := loadSuite(name, matrix)
+		if err != nil {
+			return nil, fmt.Errorf("-suite: %v", err)
+		}
+		matrix = append(matrix, cases...)
+	}
+	for _, path := range caseFiles {
+		cases, err := loadUserCases(path, matrix)
+		if err != nil {
+			return nil, fmt.Errorf("-cases: %v", err)
+		}
+		matrix = append(matrix, cases...)
+	}
+	if len(matrix) == 0 {
+		return nil, fmt.Errorf("-stock-cases=false: no -suite or -cases file adds a case")
+	}
+	return matrix, nil
+}
+
+// loadUserCases reads the cases of a -cases file. Names (test_mode) must
+// not repeat those of taken, the cases already in the matrix.
+func loadUserCases(path string, taken []benchCase) ([]benchCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	return parseUserCases(data, path, func(name string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(dir, name))
+	}, taken)
+}
+
+// parseUserCases decodes data, the cases file path, reading its code and
+// stages files with readFile.
+func parseUserCases(data []byte, path string, readFile func(name string) ([]byte, error), taken []benchCase) ([]benchCase, error) {
+	var entries []userCase
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	names := map[string]bool{}
+	for _, tc := range taken {
+		names[tc.name()] = true
+	}
+	var cases []benchCase
+	for i, e := range entries {
+		where := fmt.Sprintf("%s: case %d", path, i+1)
+		if e.Test == "" || e.Mode == "" {
+			return nil, fmt.Errorf("%s: test and mode are required", where)
+		}
+		where = fmt.Sprintf("%s: %s_%s", path, e.Test, e.Mode)
+		snippets := 0
+		for _, set := range []bool{e.Code != "", e.CodeFile != "", e.Stages != nil, e.StagesFile != ""} {
+			if set {
+				snippets++
+			}
+		}
+		if snippets != 1 {
+			return nil, fmt.Errorf("%s: want exactly one of code, code_file, stages and stages_file", where)
+		}
+		if e.Estimator != "" {
+			if _, err := parseEstimator(e.Estimator); err != nil {
+				return nil, fmt.Errorf("%s: estimator: %v", where, err)
+			}
+		}
+		if e.Data != "" {
+			if _, err := parseDataSpec(e.Data, 1000); err != nil {
+				return nil, fmt.Errorf("%s: data: %v", where, err)
+			}
+		}
+		tc := benchCase{
+			Test:       e.Test,
+			Mode:       e.Mode,
+			Parallel:   e.Parallel,
+			Code:       e.Code,
+			More:       e.More,
+			Stages:     e.Stages,
+			Data:       e.Data,
+			Flags:      e.Flags,
+			BuildFlags: e.BuildFlags,
+			Estimator:  e.Estimator,
+			Requires:   e.Requires,
+			Sizes:      e.Sizes,
+			After:      e.After,
+			ZeroAlloc:  e.ZeroAlloc,
+		}
+		if e.CodeFile != "" {
+			code, err := readFile(e.CodeFile)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			tc.Code = strings.TrimSpace(string(code))
+		}
+		if e.StagesFile != "" {
+			text, err := readFile(e.StagesFile)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			// Blank lines and comments separate stages
+			tc.Stages = []string{}
+			for _, line := range strings.Split(string(text), "\n") {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					tc.Stages = append(tc.Stages, line)
+				}
+			}
+		}
+		if tc.Code == "" && len(tc.Stages) == 0 {
+			return nil, fmt.Errorf("%s: the snippet is empty", where)
+		}
+		if names[tc.name()] {
+			return nil, fmt.Errorf("%s: a case of that test and mode is already in the matrix", where)
+		}
+		names[tc.name()] = true
+		cases = append(cases, tc)
+	}
+	return cases, nil
+}
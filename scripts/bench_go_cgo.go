@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// The cgo runner times a snippet's C translation (pcs --target c) called
+// from Go through cgo, under the Go timing driver, so -backend go,cgo puts
+// the Go emission's loops next to the same loops compiled by the C
+// compiler with one cgo call per program() around them. The gap is the
+// cost of the crossing plus the difference in codegen; a reduction over a
+// small -sizes value is mostly the crossing. pcs renders reductions to one
+// value only in C, so the other portable cases are skipped as
+// unsupported_construct, and the driver's verify mode checks the results.
+
+func init() {
+	registerBackend("cgo", "cgo", "cgo", cgoRunner{})
+}
+
+// cgoCFlags build the C side as the Go backend's arithmetic behaves:
+// optimized, with signed overflow wrapping as Go's int does rather than
+// undefined. They are passed as CGO_CFLAGS, as cgo refuses -fwrapv in a
+// #cgo directive.
+const cgoCFlags = "-O2 -fwrapv"
+
+// cgoBoolProgram matches the C signature of an any/all reduction.
+var cgoBoolProgram = regexp.MustCompile(`(?m)^bool program\(void\)`)
+
+// cgoSource is the Go file wrapping the C code of a case: the code as the
+// cgo preamble, and program() calling it, returning what the Go backend's
+// program() of the same snippet returns.
+func cgoSource(code []byte) []byte {
+	result, conv := "int", "int"
+	if cgoBoolProgram.Match(code) {
+		result, conv = "bool", "bool"
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "/*\n%s*/\nimport \"C\"\n\n", code)
+	fmt.Fprintf(&b, "func program() %s {\n\treturn %s(C.program())\n}\n", result, conv)
+	return b.Bytes()
+}
+
+// cgoRunner renders cases with pcs's C target and builds them with cgo
+// enabled, whatever CGO_ENABLED the harness runs with.
+type cgoRunner struct{}
+
+func (cgoRunner) Generate(cache *buildCache, tc benchCase, n int) ([]byte, bool, error) {
+	return generateCached(cache, tc, n)
+}
+
+func (cgoRunner) Build(tc benchCase, code []byte, prefix string, n int) (program, error) {
+	if bytes.Contains(code, []byte("*/")) {
+		return program{}, fmt.Errorf("C code closes the cgo preamble's comment")
+	}
+	var p program
+	var err error
+	p.Sources, err = writeProgram(prefix, cgoSource(code), nil)
+	p.Compile = func(binary string) (*exec.Cmd, error) {
+		if err := findCCompiler(); err != nil {
+			return nil, err
+		}
+		cmd, err := buildCommand(tc, binary, p.Sources)
+		if err == nil {
+			cmd.Env = append(cmd.Env, "CGO_ENABLED=1", "CGO_CFLAGS="+cgoCFlags)
+		}
+		return cmd, err
+	}
+	return p, err
+}
+
+// findCCompiler looks for the C compiler go build runs for cgo: $CC, or
+// gcc or clang. Without one the case is skipped as toolchain_unavailable.
+func findCCompiler() error {
+	if cc := strings.Fields(os.Getenv("CC")); len(cc) > 0 {
+		_, err := exec.LookPath(cc[0])
+		return err
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		_, err = exec.LookPath("clang")
+		return err
+	}
+	return nil
+}
+
+func (cgoRunner) Run(tc benchCase, p program, binary string, env runEnv, reps int, protocol string, fixed int) (runOutput, error) {
+	return runProgram(binary, env, reps, tc.Measure, protocol, fixed)
+}
+
+// Result runs the driver in "verify" mode, as for Go cases.
+func (cgoRunner) Result(tc benchCase, p program, binary string, env runEnv) ([]byte, error) {
+	return runWithin(env.command(binary, "1", "verify", "cold", "0"), env.Timeout, env.MaxRSS)
+}
+
+func (cgoRunner) Metrics(result BenchmarkResult, run runOutput, est estimator, reps int) BenchmarkResult {
+	return timingMetrics(result, run, est, reps)
+}
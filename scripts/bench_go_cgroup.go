@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// -cgroup-cpus and -cgroup-memory confine every benchmark process to a
+// transient cgroup v2 of its own with a fixed cpu.max or memory.max, so a
+// shared runner's neighbours cannot lend it idle CPU time one run and take
+// it back the next. The cgroups are created under -cgroup-parent, by
+// default the harness's own cgroup, which must delegate the controllers
+// limited. cgroup v2 allows no processes in a cgroup whose children have
+// controllers, so the harness first moves itself into a leaf under its
+// own, which then must hold no other processes: systemd-run --user --scope
+// -p Delegate=yes starts the harness in such a place. Swap is disabled
+// under a memory limit, so a case reaching it is killed rather than timed
+// while paging.
+
+// cgroupPeriodUs is the cpu.max period quotas are expressed in.
+const cgroupPeriodUs = 100000
+
+// cgroupLimit is the confinement a result's process ran under. CPUs is the
+// cpu.max quota in CPUs and MemoryMax memory.max in bytes, each absent when
+// not limited.
+type cgroupLimit struct {
+	CPUs      float64 `json:"cpus,omitempty"`
+	MemoryMax int64   `json:"memory_max_bytes,omitempty"`
+}
+
+// cgroupConfiner creates the transient cgroups of a run under Parent.
+type cgroupConfiner struct {
+	Parent string
+	Limit  cgroupLimit
+	seq    atomic.Int64
+}
+
+// confinerFlags returns the confiner of -cgroup-cpus and -cgroup-memory, a
+// byte size such as 2GiB, or nil when neither is set.
+func confinerFlags(parent string, cpus float64, memory string) (*cgroupConfiner, error) {
+	if cpus == 0 && memory == "" {
+		return nil, nil
+	}
+	var bytes int64
+	if memory != "" {
+		var err error
+		if bytes, err = parseByteSize(memory); err != nil {
+			return nil, err
+		}
+	}
+	return newCgroupConfiner(parent, cpus, bytes)
+}
+
+// newCgroupConfiner checks that cgroups limiting cpus (0: unlimited) and
+// memory bytes (0: unlimited) can be created under parent, the harness's
+// own cgroup when empty, enabling the controllers for its children if it
+// has to.
+func newCgroupConfiner(parent string, cpus float64, memory int64) (*cgroupConfiner, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("cgroups are Linux-only")
+	}
+	if cpus < 0 || memory < 0 || cpus+float64(memory) == 0 {
+		return nil, fmt.Errorf("want a positive CPU or memory limit")
+	}
+	mount, err := cgroup2Mount()
+	if err != nil {
+		return nil, err
+	}
+	own := parent == ""
+	if own {
+		path, err := ownCgroup()
+		if err != nil {
+			return nil, err
+		}
+		parent = filepath.Join(mount, path)
+	}
+	if rel, err := filepath.Rel(mount, parent); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("%s is not in the cgroup v2 hierarchy at %s", parent, mount)
+	}
+
+	available, err := os.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+	if err != nil {
+		return nil, err
+	}
+	var needed, enable []string
+	if cpus > 0 {
+		needed = append(needed, "cpu")
+	}
+	if memory > 0 {
+		needed = append(needed, "memory")
+	}
+	for _, c := range needed {
+		if !slices.Contains(strings.Fields(string(available)), c) {
+			return nil, fmt.Errorf("%s does not have the %s controller; its parent must delegate it", parent, c)
+		}
+		if !slices.Contains(strings.Fields(string(enabled)), c) {
+			enable = append(enable, "+"+c)
+		}
+	}
+	if len(enable) > 0 {
+		control := filepath.Join(parent, "cgroup.subtree_control")
+		err := os.WriteFile(control, []byte(strings.Join(enable, " ")), 0644)
+		if err != nil && own {
+			// The harness is one of the processes in the way: move it
+			// into a leaf of its own and try again
+			leaf := filepath.Join(parent, fmt.Sprintf("pcs-bench-harness-%d", os.Getpid()))
+			if mkErr := os.Mkdir(leaf, 0755); mkErr == nil || os.IsExist(mkErr) {
+				if os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0644) == nil {
+					err = os.WriteFile(control, []byte(strings.Join(enable, " ")), 0644)
+				}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot enable %s for the children of %s (%v): it must be delegated to this user and hold no processes but the harness; run under systemd-run --user --scope -p Delegate=yes, or name such a cgroup with -cgroup-parent",
+				strings.Join(enable, " "), parent, err)
+		}
+	}
+
+	c := &cgroupConfiner{Parent: parent, Limit: cgroupLimit{CPUs: cpus, MemoryMax: memory}}
+	dir, err := c.create()
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(dir)
+	return c, nil
+}
+
+// cgroup2Mount is where the cgroup v2 hierarchy is mounted.
+func cgroup2Mount() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// ID parent major:minor root mountpoint options... - fstype source options
+		pre, post, ok := strings.Cut(scanner.Text(), " - ")
+		fields := strings.Fields(pre)
+		if ok && len(fields) >= 5 && strings.HasPrefix(post, "cgroup2 ") {
+			return fields[4], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no cgroup v2 hierarchy is mounted")
+}
+
+// ownCgroup is the harness's cgroup v2 path, relative to the hierarchy.
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("the harness is not in a cgroup v2 hierarchy")
+}
+
+// create makes a new cgroup with the run's limits.
+func (c *cgroupConfiner) create() (string, error) {
+	c.sweep()
+	dir := filepath.Join(c.Parent, fmt.Sprintf("pcs-bench-%d-%d", os.Getpid(), c.seq.Add(1)))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", err
+	}
+	type setting struct{ file, value string }
+	var settings []setting
+	if c.Limit.CPUs > 0 {
+		quota := max(int64(c.Limit.CPUs*cgroupPeriodUs), 1000) // the kernel's minimum
+		settings = append(settings, setting{"cpu.max", fmt.Sprintf("%d %d", quota, cgroupPeriodUs)})
+	}
+	if c.Limit.MemoryMax > 0 {
+		settings = append(settings, setting{"memory.max", strconv.FormatInt(c.Limit.MemoryMax, 10)}, setting{"memory.swap.max", "0"})
+	}
+	for _, w := range settings {
+		err := os.WriteFile(filepath.Join(dir, w.file), []byte(w.value), 0644)
+		if err != nil && !(w.file == "memory.swap.max" && os.IsNotExist(err)) {
+			os.Remove(dir)
+			return "", fmt.Errorf("cgroup %s: %v", w.file, err)
+		}
+	}
+	return dir, nil
+}
+
+// wrap is the command prefix that moves itself into dir and then execs the
+// rest of the command line in place, as nice and taskset do.
+func (c *cgroupConfiner) wrap(dir string) []string {
+	return []string{"sh", "-c", `echo $$ > "$0/cgroup.procs" && exec "$@"`, dir}
+}
+
+// sweep removes this run's cgroups whose processes have exited; removing
+// one that still has processes fails and leaves it for later.
+func (c *cgroupConfiner) sweep() {
+	if c == nil {
+		return
+	}
+	for _, dir := range glob(filepath.Join(c.Parent, fmt.Sprintf("pcs-bench-%d-*", os.Getpid()))) {
+		os.Remove(dir)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+)
+
+// -chunk-sweep checks the run-time chunk sizing of pcs --go-chunking auto
+// against the even split it replaces: every parallel Go case gets a twin
+// rendered with auto chunks, both run at each size of a ladder from a
+// thousand values, where auto falls back to fewer goroutines, to ten
+// million, where both split evenly, and the run ends with the ratio of
+// their means per size.
+
+// chunkSweepMode is appended to the mode of a case's auto-chunked twin.
+const chunkSweepMode = "_auto_chunks"
+
+// chunkSweepSizes are the -sizes of -chunk-sweep unless -sizes is given.
+var chunkSweepSizes = []int{1e3, 1e4, 1e5, 1e6, 1e7}
+
+// chunkSweepCases returns matrix with an auto-chunked twin after each
+// parallel Go case that renders one expression, run after its even build.
+func chunkSweepCases(matrix []benchCase) []benchCase {
+	out := make([]benchCase, 0, 2*len(matrix))
+	for _, tc := range matrix {
+		out = append(out, tc)
+		if !tc.Parallel || tc.backend() != "go" || tc.Stages != nil || tc.More != nil ||
+			tc.Stream != "" || slices.Contains(tc.Flags, "--go-chunking") {
+			continue
+		}
+		twin := tc
+		twin.Mode += chunkSweepMode
+		twin.Flags = append(slices.Clip(tc.Flags), "--go-chunking", "auto")
+		twin.After = append(slices.Clip(tc.After), tc.name())
+		out = append(out, twin)
+	}
+	return out
+}
+
+// chunkKey identifies the even result an auto-chunked one is compared
+// with: the same key but for the mode, at the same GOMAXPROCS.
+type chunkKey struct {
+	speedupKey
+	mode  string
+	procs int
+}
+
+// chunkSweepRow is one size of one case: the even and auto means and
+// their ratio, below 1 when auto chunks are faster.
+type chunkSweepRow struct {
+	name         string
+	n, procs     int
+	even, auto   int64
+	ratio, noise float64
+}
+
+// chunkSweep pairs results as they are emitted; the twin runs after the
+// case it was made from (see chunkSweepCases), so one pass is enough.
+type chunkSweep struct {
+	even map[chunkKey]BenchmarkResult
+	rows []chunkSweepRow
+}
+
+// add records r, pairing an auto-chunked result with its even one.
+func (c *chunkSweep) add(r BenchmarkResult) {
+	if !r.measured() || r.MeanNs <= 0 || r.PGO || !r.Parallel {
+		return
+	}
+	mode, auto := strings.CutSuffix(r.Mode, chunkSweepMode)
+	key := chunkKey{speedupKeyOf(r), mode, r.GOMAXPROCS}
+	if !auto {
+		if c.even == nil {
+			c.even = map[chunkKey]BenchmarkResult{}
+		}
+		c.even[key] = r
+		return
+	}
+	even, ok := c.even[key]
+	if !ok {
+		return
+	}
+	c.rows = append(c.rows, chunkSweepRow{
+		name:  benchCase{Test: r.Test, Mode: mode, Target: r.Target}.name(),
+		n:     r.N,
+		procs: r.GOMAXPROCS,
+		even:  even.MeanNs,
+		auto:  r.MeanNs,
+		ratio: float64(r.MeanNs) / float64(even.MeanNs),
+		noise: math.Hypot(relStderr(even), relStderr(r)),
+	})
+}
+
+// report writes a line per row to w, marking those where auto chunks were
+// more than threshold slower than the even split, and a summary.
+func (c *chunkSweep) report(w io.Writer, threshold float64) {
+	slower := 0
+	for _, row := range c.rows {
+		procs := ""
+		if row.procs > 0 {
+			procs = fmt.Sprintf(" GOMAXPROCS=%d", row.procs)
+		}
+		verdict := ""
+		if row.ratio > 1+threshold {
+			verdict = ", auto slower"
+			slower++
+		}
+		fmt.Fprintf(w, "chunk sweep: %s n=%d%s: even %d ns, auto %d ns, %.2fx ± %.2f%s\n",
+			row.name, row.n, procs, row.even, row.auto, row.ratio, row.ratio*row.noise, verdict)
+	}
+	fmt.Fprintf(w, "chunk sweep: auto chunks more than %.0f%% slower in %d of %d comparisons\n",
+		threshold*100, slower, len(c.rows))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// command is one pcs-bench subcommand. Each parses its own flags, prints
+// its own help for -h, and returns the process exit code.
+type command struct {
+	Name    string
+	Summary string
+	Run     func(args []string) int
+}
+
+// commands are listed by `pcs-bench help` in this order.
+var commands = []command{
+	{"run", "generate, build and time every case (the default)", runBench},
+	{"compare", "test whether two result files differ significantly", runCompare},
+	{"report", "render results as an HTML report", runReport},
+	{"merge", "merge result files into one stream", runMerge},
+	{"upload", "copy results, profiles and reports to S3, GCS or a directory", runUpload},
+	{"validate", "check result files against the schema", runValidate},
+	{"export", "reshape results for Bencher, Codespeed or Google Benchmark", runExport},
+	{"serve", "serve codegen and quick benchmarks over HTTP", runServe},
+	{"daemon", "queue benchmark jobs over HTTP or a unix socket and run them one at a time", runDaemon},
+	{"watch", "re-time a snippet or cases whenever the generator changes", runWatch},
+	{"batch", "time NDJSON snippet jobs from stdin, one result line per job", runBatch},
+	{"pr-comment", "post deltas vs the base branch on a pull request", runPRComment},
+	{"history", "import results into or query the SQLite history", runHistory},
+	{"dashboard", "serve the history with charts and regressions over HTTP", runDashboard},
+	{"analyze", "report step changes and drifts in the history", runAnalyze},
+	{"pareto", "plot wall against CPU time across GOMAXPROCS levels", runPareto},
+	{"usl", "fit the Universal Scalability Law to GOMAXPROCS sweeps", runUSL},
+	{"ab", "time two variants of a snippet interleaved", runAB},
+	{"compare-commits", "build and time cases at two commits", runCompareCommits},
+	{"bisect", "find the commit that slowed a case down", runBisect},
+	{"calibrate", "measure this machine's noise floor and the slowdown -threshold it can detect", runCalibrate},
+	{"codegen", "render pcs's Go backend without Python", runCodegen},
+	{"codegen-report", "compare a snippet's Go emission strategies: code, lines, vet and timings", runCodegenReport},
+	{"parallel-check", "check parallel cases against sequential ones at edge-case sizes", runParallelCheck},
+	{"fuzz", "check random comprehensions' Go output against Python", runFuzz},
+	{"check-generated", "build and vet every Go file under generated/", runCheckGenerated},
+	{"capabilities", "print the backend x construct capability matrix", runCapabilities},
+	{"version", "print the harness version, revision, build date and Go toolchain", runVersion},
+}
+
+func main() {
+	os.Exit(dispatch(os.Args[1:]))
+}
+
+// dispatch runs the command args name. Arguments that start with a flag,
+// or none at all, mean run, as they did before there were subcommands.
+func dispatch(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runBench(args)
+	}
+	name, rest := args[0], args[1:]
+	if name == "help" {
+		if len(rest) == 0 {
+			usage(os.Stdout)
+			return 0
+		}
+		// Each command prints its help and exits on -h
+		name, rest = rest[0], []string{"-h"}
+	}
+	for _, c := range commands {
+		if c.Name == name {
+			return c.Run(rest)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "pcs-bench: unknown command %q\n\n", name)
+	usage(os.Stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: pcs-bench <command> [flags] [args]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", c.Name, c.Summary)
+	}
+	fmt.Fprintf(w, "\nRun 'pcs-bench help <command>' for a command's flags.\n")
+}
@@ -0,0 +1,1459 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The harness renders the Go backend itself when it can, so runners
+// without Python can still generate and time cases. This is a port of
+// pcs/renderers/go.py (render_go, render_go_multi, render_go_pipeline and
+// render_go_package) that must stay byte-for-byte identical to it: generated code is cached
+// under its pcs arguments whichever path produced it. Streaming programs,
+// headers and options other than the ones below still go through
+// `python3 -m pcs`.
+
+// codegenModes are the values of -codegen and PCS_BENCH_CODEGEN: auto
+// renders natively and falls back to python3 for anything unsupported,
+// native never runs python3, python always does.
+var codegenModes = map[string]bool{"auto": true, "native": true, "python": true}
+
+var codegenMode = getEnv("PCS_BENCH_CODEGEN", "auto")
+
+// runPCS renders pcs arguments args, as `python3 -m pcs args...` prints
+// them. dir is the checkout to run pcs from; one other than the current
+// directory ("") has its own renderer and is never rendered natively. limit
+// bounds the python3 process as in runWithin.
+func runPCS(dir string, limit time.Duration, args ...string) ([]byte, error) {
+	if dir == "" && codegenMode != "python" {
+		out, err := renderNative(args)
+		if err == nil || codegenMode == "native" {
+			return out, err
+		}
+	}
+	cmd := commandContext("python3", append([]string{"-m", "pcs"}, args...)...)
+	cmd.Dir = dir
+	return runWithin(cmd, limit, 0)
+}
+
+// pcsOptions are the pcs command-line options the native generator reads.
+type pcsOptions struct {
+	Target     string
+	Codes      []string
+	Stages     []string
+	Parallel   bool
+	Fuse       bool
+	Presize    bool
+	MapImpl    string
+	ShardMerge string
+	FuncName   string
+	Package    string // "" for a bare function
+	ResultType string
+	Emit       string
+}
+
+// parsePCSArgs reads args like pcs's argparse parser, as far as the native
+// generator goes: other options are errNotNative.
+func parsePCSArgs(args []string) (pcsOptions, error) {
+	o := pcsOptions{Target: "rust", Presize: true, MapImpl: "builtin", ShardMerge: "sized", FuncName: "program", ResultType: "int", Emit: "loops"}
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		arg := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 == len(args) {
+				return "", fmt.Errorf("argument %s: expected one argument", name)
+			}
+			i++
+			return args[i], nil
+		}
+		var err error
+		switch name {
+		case "--parallel", "--fuse", "--no-presize", "--no-header":
+			if hasValue {
+				return o, fmt.Errorf("argument %s: ignored explicit argument %q", name, value)
+			}
+			o.Parallel = o.Parallel || name == "--parallel"
+			o.Fuse = o.Fuse || name == "--fuse"
+			o.Presize = o.Presize && name != "--no-presize"
+		case "--go-package":
+			// An optional argument: argparse takes the next one unless it
+			// is an option
+			o.Package = "main"
+			if hasValue {
+				o.Package = value
+			} else if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				o.Package = args[i]
+			}
+		case "--go-emit":
+			if o.Emit, err = arg(); err == nil && !contains(goEmitStyles, o.Emit) {
+				err = fmt.Errorf("argument --go-emit: invalid choice: %q", o.Emit)
+			}
+		case "--go-result-type":
+			if o.ResultType, err = arg(); err == nil && !contains(goResultTypes, o.ResultType) {
+				err = fmt.Errorf("argument --go-result-type: invalid choice: %q", o.ResultType)
+			}
+		case "--target":
+			o.Target, err = arg()
+		case "--code":
+			var code string
+			code, err = arg()
+			o.Codes = append(o.Codes, code)
+		case "--stage":
+			var stage string
+			stage, err = arg()
+			o.Stages = append(o.Stages, stage)
+		case "--go-map-impl":
+			if o.MapImpl, err = arg(); err == nil && o.MapImpl == "sync" {
+				return o, notNative("--go-map-impl sync")
+			} else if err == nil && o.MapImpl != "builtin" && o.MapImpl != "swiss" {
+				err = fmt.Errorf("argument --go-map-impl: invalid choice: %q", o.MapImpl)
+			}
+		case "--go-shard-merge":
+			if o.ShardMerge, err = arg(); err == nil && !contains(shardMergeStrategies, o.ShardMerge) {
+				err = fmt.Errorf("argument --go-shard-merge: invalid choice: %q", o.ShardMerge)
+			}
+		case "--func-name":
+			o.FuncName, err = arg()
+		default:
+			return o, notNative("option %s", name)
+		}
+		if err != nil {
+			return o, err
+		}
+	}
+	return o, nil
+}
+
+// renderNative renders pcs arguments args without Python.
+func renderNative(args []string) ([]byte, error) {
+	o, err := parsePCSArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if o.Target != "go" {
+		return nil, notNative("target %s", o.Target)
+	}
+	// pcs reads header settings from here when present
+	if _, err := os.Stat(".pcs.json"); err == nil {
+		return nil, notNative("header config .pcs.json")
+	}
+
+	var output string
+	switch {
+	case o.Stages != nil:
+		if o.Codes != nil {
+			return nil, errors.New("--stage cannot be combined with --code or --go-stream")
+		}
+		if o.ResultType != "int" {
+			return nil, errors.New("--go-result-type needs --target go and a single --code expression")
+		}
+		var names []string
+		var irs []irComp
+		for _, spec := range o.Stages {
+			name, code, ok := strings.Cut(spec, "=")
+			if !ok {
+				return nil, fmt.Errorf("--stage expects NAME=EXPR, got %q", spec)
+			}
+			ir, err := parseComprehension(strings.TrimSpace(code))
+			if err != nil {
+				return nil, err
+			}
+			names, irs = append(names, strings.TrimSpace(name)), append(irs, ir)
+		}
+		output, err = renderGoPipeline(names, irs, o.FuncName, o.Fuse)
+	case o.Codes == nil:
+		return nil, errors.New("the following arguments are required: --code")
+	case o.Fuse && len(o.Codes) < 2:
+		return nil, errors.New("--fuse needs at least two --code expressions")
+	case o.ResultType != "int" && len(o.Codes) > 1:
+		return nil, errors.New("--go-result-type needs --target go and a single --code expression")
+	default:
+		var irs []irComp
+		for _, code := range o.Codes {
+			ir, err := parseComprehension(code)
+			if err != nil {
+				return nil, err
+			}
+			irs = append(irs, ir)
+		}
+		// pcs takes a name a lone expression iterates as an input slice
+		// parameter (_input_slice), which is not ported; a pipeline stage
+		// iterating the one before it is
+		if src := irs[0].Generators[0].Source; len(irs) == 1 && identifier.MatchString(src) && !contains(goKeywords, src) {
+			return nil, notNative("input slice %s", src)
+		}
+		if len(irs) == 1 {
+			irs[0] = strideFilters(irs[0])
+		}
+		switch {
+		case len(irs) > 1:
+			output, err = renderGoMulti(irs, o.FuncName, o.Fuse, o.Codes)
+		case o.ResultType != "int" && !contains([]string{"sum", "prod", "max", "min"}, irs[0].Reduce):
+			err = errors.New("a Go result type applies to sum/prod/max/min reductions only")
+		case o.Emit != "loops" && o.Parallel:
+			err = fmt.Errorf("--go-emit %s has no parallel form; use --go-emit loops", o.Emit)
+		case o.Emit != "loops" && len(irs[0].Generators) != 1:
+			err = fmt.Errorf("--go-emit %s supports a single generator only", o.Emit)
+		case len(irs[0].Generators) != 1:
+			err = notNative("several for clauses")
+		case o.Parallel && o.ShardMerge == "wrap" && keyedByExpr(irs[0]):
+			err = errors.New("shard_merge='wrap' needs the loop variable as key")
+		default:
+			output = orderNote(renderGo(irs[0], o), irs[0], o)
+		}
+	}
+	if err == nil && o.Package != "" {
+		output, err = renderGoPackage(output, o.FuncName, o.Package)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// print() ends the output with one more newline
+	return []byte(output + "\n"), nil
+}
+
+// importBlock is the import block of a rendered function, as _IMPORT_BLOCK.
+var importBlock = regexp.MustCompile(`(?m)^import \(\n((?:    "[^"\n]+"\n)*)\)\n\n`)
+
+var importPath = regexp.MustCompile(`"([^"]+)"`)
+
+// goKeywords are Go's keywords, which cannot name a package.
+var goKeywords = strings.Fields(`
+	break case chan const continue default defer else fallthrough for func go
+	goto if import interface map package range return select struct switch
+	type var`)
+
+// renderGoPackage is render_go_package: fragment as a complete source file
+// of package pkg, a program printing funcName's result for package main.
+func renderGoPackage(fragment, funcName, pkg string) (string, error) {
+	if !identifier.MatchString(pkg) || contains(goKeywords, pkg) {
+		return "", fmt.Errorf("invalid Go package name %q", pkg)
+	}
+	var imports []string
+	if pkg == "main" {
+		imports = append(imports, "fmt")
+	}
+	if m := importBlock.FindStringSubmatchIndex(fragment); m != nil {
+		for _, p := range importPath.FindAllStringSubmatch(fragment[m[2]:m[3]], -1) {
+			if !contains(imports, p[1]) {
+				imports = append(imports, p[1])
+			}
+		}
+		fragment = fragment[:m[0]] + fragment[m[1]:]
+	}
+	call := funcName + "()"
+	main := []string{"    fmt.Println(" + call + ")"}
+	if pkg == "main" {
+		// An iterator (--go-emit iter) prints as what it yields, collected
+		if m := regexp.MustCompile(`(?m)^func ` + regexp.QuoteMeta(funcName) + `\(\) iter\.Seq(2?)\[`).FindStringSubmatch(fragment); m != nil {
+			collect := "slices"
+			if m[1] != "" {
+				collect = "maps"
+			}
+			if !contains(imports, collect) {
+				imports = append(imports, collect)
+			}
+			main = []string{"    fmt.Println(" + collect + ".Collect(" + call + "))"}
+		}
+		// A channel (--go-emit chan) prints each value as it arrives
+		if regexp.MustCompile(`(?m)^func ` + regexp.QuoteMeta(funcName) + `\(\) <-chan `).MatchString(fragment) {
+			main = []string{"    for v := range " + call + " {", "        fmt.Println(v)", "    }"}
+		}
+	}
+	sort.Strings(imports)
+	lines := []string{"package " + pkg, ""}
+	if imports != nil {
+		lines = append(lines, "import (")
+		for _, imp := range imports {
+			lines = append(lines, `    "`+imp+`"`)
+		}
+		lines = append(lines, ")", "")
+	}
+	lines = append(lines, strings.Split(strings.TrimSuffix(fragment, "\n"), "\n")...)
+	if pkg == "main" {
+		lines = append(append(append(lines, "", "func main() {"), main...), "}")
+	}
+	return joinLines(lines), nil
+}
+
+// goEmitStyles are the values of --go-emit, as GO_EMIT_STYLES.
+var goEmitStyles = []string{"loops", "helpers", "iter", "chan"}
+
+// chanBuffer is the buffer of the channel --go-emit chan returns, as
+// _CHAN_BUFFER.
+const chanBuffer = 256
+
+// goResultTypes are the values of --go-result-type, as GO_RESULT_TYPES.
+var goResultTypes = strings.Fields("int int8 int16 int32 int64 uint uint8 uint16 uint32 uint64 float32 float64")
+
+var shardMergeStrategies = []string{"ordered", "sized", "adopt", "wrap"}
+
+// rangeLen is the number of values range(start, stop, step) produces.
+func rangeLen(start, stop, step int64) int64 {
+	if step > 0 && stop > start {
+		return (stop - start + step - 1) / step
+	}
+	if step < 0 && stop < start {
+		return (start - stop - step - 1) / -step
+	}
+	return 0
+}
+
+// sizeHint estimates how many values survive gen's filters, or -1 when
+// a filter other than a comparison with an int constant, `var % k == c` or
+// `var % k != c` makes it unknown.
+func sizeHint(gen irGenerator, start, stop, step int64) int64 {
+	v := regexp.QuoteMeta(gen.Var)
+	modulo := regexp.MustCompile(`^\(?\s*` + v + `\s*%\s*(\d+)\s*(==|!=)\s*\d+\s*\)?$`)
+	compare := regexp.MustCompile(`^\(?\s*(?:(-?\d+)\s*([<>]=?)\s*)?` + v + `\s*(?:([<>]=?)\s*(-?\d+))?\s*\)?$`)
+	flip := map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<="}
+	var lo, hi *int64
+	type modulus struct {
+		k  int64
+		op string
+	}
+	var moduli []modulus
+	for _, filter := range gen.Filters {
+		if m := modulo.FindStringSubmatch(strings.TrimSpace(filter)); m != nil {
+			k, err := strconv.ParseInt(m[1], 10, 64)
+			if err != nil || k == 0 {
+				return -1
+			}
+			moduli = append(moduli, modulus{k, m[2]})
+			continue
+		}
+		m := compare.FindStringSubmatch(strings.TrimSpace(filter))
+		if m == nil || (m[1] == "" && m[4] == "") {
+			return -1
+		}
+		type bound struct {
+			op string
+			c  string
+		}
+		var bounds []bound
+		if m[1] != "" {
+			// `c < var` bounds var as `var > c` does
+			bounds = append(bounds, bound{flip[m[2]], m[1]})
+		}
+		if m[4] != "" {
+			bounds = append(bounds, bound{m[3], m[4]})
+		}
+		for _, b := range bounds {
+			c, err := strconv.ParseInt(b.c, 10, 64)
+			if err != nil {
+				return -1
+			}
+			if b.op[0] == '>' {
+				if b.op == ">" {
+					c++
+				}
+				if lo == nil || c > *lo {
+					lo = &c
+				}
+			} else {
+				if b.op == "<" {
+					c--
+				}
+				if hi == nil || c < *hi {
+					hi = &c
+				}
+			}
+		}
+	}
+	// The values of the range inside [lo, hi]
+	if step > 0 {
+		if lo != nil && *lo > start {
+			start += (*lo - start + step - 1) / step * step
+		}
+		if hi != nil {
+			stop = min(stop, *hi+1)
+		}
+	} else if step < 0 {
+		if hi != nil && *hi < start {
+			start += (start - *hi - step - 1) / -step * step
+		}
+		if lo != nil {
+			stop = max(stop, *lo-1)
+		}
+	}
+	size := rangeLen(start, stop, step)
+	for _, m := range moduli {
+		if m.op == "==" {
+			size = (size + m.k - 1) / m.k
+		} else {
+			size -= size / m.k
+		}
+	}
+	return size
+}
+
+func makeMap(mapType string, hint int64) string {
+	if hint < 0 {
+		return fmt.Sprintf("make(%s)", mapType)
+	}
+	return fmt.Sprintf("make(%s, %d)", mapType, hint)
+}
+
+func joinLines(lines []string) string {
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// strideFilters is _stride_filters: the first `var % m == r` filter of a
+// generator over a range with step 1 or -1, 0 <= r < m, folded into the
+// range, which then steps by m from the first value that passes.
+func strideFilters(ir irComp) irComp {
+	generators := make([]irGenerator, len(ir.Generators))
+	copy(generators, ir.Generators)
+	for i, gen := range generators {
+		if gen.Range == nil || (gen.Range.Step != 1 && gen.Range.Step != -1) {
+			continue
+		}
+		for j, f := range gen.Ifs {
+			cmp, ok := f.(pyCompare)
+			if !ok || len(cmp.Ops) != 1 || cmp.Ops[0] != "==" {
+				continue
+			}
+			mod, ok := cmp.Left.(pyBinary)
+			if !ok || mod.Op != "%" || mod.L != (pyName{gen.Var}) {
+				continue
+			}
+			m, okM := mod.R.(pyInt)
+			r, okR := cmp.Comparators[0].(pyInt)
+			if !okM || !okR || !m.V.IsInt64() || r.V.Sign() < 0 || r.V.Cmp(m.V) >= 0 {
+				continue
+			}
+			start, step := gen.Range.Start, gen.Range.Step
+			// Python's % takes the sign of the divisor
+			floorMod := func(a, b int64) int64 { return ((a % b) + b) % b }
+			if step == 1 {
+				start += floorMod(r.V.Int64()-start, m.V.Int64())
+			} else {
+				start -= floorMod(start-r.V.Int64(), m.V.Int64())
+			}
+			generators[i].Range = &irRange{Start: start, Stop: gen.Range.Stop, Step: step * m.V.Int64()}
+			generators[i].Filters = append(append([]string{}, gen.Filters[:j]...), gen.Filters[j+1:]...)
+			generators[i].Ifs = append(append([]pyExpr{}, gen.Ifs[:j]...), gen.Ifs[j+1:]...)
+			break
+		}
+	}
+	ir.Generators = generators
+	return ir
+}
+
+// renderGo is render_go: one comprehension as a Go function, parallel
+// with goroutines when o.Parallel is set.
+func renderGo(ir irComp, o pcsOptions) string {
+	useSwiss := o.MapImpl == "swiss" && ir.Kind == "dict" && ir.Reduce == "" && !o.Parallel && o.Emit == "loops"
+
+	returnType := "[]int"
+	switch {
+	case ir.Reduce == "any" || ir.Reduce == "all":
+		returnType = "bool"
+	case ir.Reduce != "":
+		returnType = o.ResultType
+	case ir.Kind == "set":
+		returnType = "map[int]struct{}"
+	case ir.Kind == "dict" && useSwiss:
+		returnType = "*swissMap"
+	case ir.Kind == "dict":
+		returnType = "map[int]int"
+	}
+	switch o.Emit {
+	case "helpers":
+		return renderHelperCalls(ir, o, returnType)
+	case "iter":
+		return renderIter(ir, o, returnType)
+	case "chan":
+		return renderChan(ir, o, returnType)
+	}
+
+	var lines []string
+	if useSwiss {
+		lines = append(lines, "// Requires pcs_swiss.go (pcs/backends/go) in the same package.")
+	}
+	lines = append(lines, fmt.Sprintf("func %s() %s {", o.FuncName, returnType))
+	// ret returns a reduction's accumulator, converted to o.ResultType
+	ret := func(acc string) string {
+		if o.ResultType != "int" {
+			return fmt.Sprintf("    return %s(%s)", o.ResultType, acc)
+		}
+		return "    return " + acc
+	}
+
+	gen := ir.Generators[0]
+	v := gen.Var
+	start, stop, step := int64(0), int64(1000), int64(1)
+	if gen.Range != nil {
+		start, stop, step = gen.Range.Start, gen.Range.Stop, gen.Range.Step
+	}
+	hint := int64(-1)
+	if o.Presize {
+		hint = sizeHint(gen, start, stop, step)
+	}
+	if o.Parallel && ir.Kind == "dict" && ir.Reduce == "" {
+		return renderShardedDict(ir, o.FuncName, start, stop, step, hint, o.ShardMerge)
+	}
+
+	loop := forClause(v, start, stop, step) + " {"
+	guards := func(indent string) {
+		for _, f := range gen.Filters {
+			lines = append(lines, fmt.Sprintf("%sif !(%s) { continue }", indent, f))
+		}
+	}
+	expr := ir.Element
+	if expr == "" {
+		expr = "0"
+	}
+
+	if o.Parallel {
+		return renderParallel(ir, o, start, stop, step, returnType)
+	}
+
+	if ir.Reduce != "" {
+		lines = append(lines, "    acc := "+reduceInit(ir.Reduce))
+		if ir.Reduce == "max" || ir.Reduce == "min" {
+			lines = append(lines, "    seen := false")
+		}
+		lines = append(lines, "    "+loop)
+		guards("        ")
+		for _, stmt := range reduceStmt(ir.Reduce, "acc", "seen", expr, true) {
+			lines = append(lines, "        "+stmt)
+		}
+		lines = append(lines, "    }", ret("acc"), "}")
+		return joinLines(lines)
+	}
+
+	switch ir.Kind {
+	case "list":
+		capacity := ""
+		if hint >= 0 {
+			capacity = fmt.Sprintf(", %d", hint)
+		}
+		lines = append(lines, "    result := make([]int, 0"+capacity+")", "    "+loop)
+		guards("        ")
+		lines = append(lines, fmt.Sprintf("        result = append(result, %s)", ir.Element))
+	case "set":
+		lines = append(lines, "    result := "+makeMap("map[int]struct{}", hint), "    "+loop)
+		guards("        ")
+		lines = append(lines, fmt.Sprintf("        result[%s] = struct{}{}", ir.Element))
+	case "dict":
+		if useSwiss {
+			lines = append(lines, fmt.Sprintf("    result := newSwissMap(%d)", max(hint, 0)))
+		} else {
+			lines = append(lines, "    result := "+makeMap("map[int]int", hint))
+		}
+		lines = append(lines, "    "+loop)
+		guards("        ")
+		key, val := orElse(ir.Key, v), orElse(ir.Value, v)
+		if useSwiss {
+			lines = append(lines, fmt.Sprintf("        result.Put(%s, %s)", key, val))
+		} else {
+			lines = append(lines, fmt.Sprintf("        result[%s] = %s", key, val))
+		}
+	default:
+		// A bare generator expression renders an empty body
+		lines = append(lines, "}")
+		return joinLines(lines)
+	}
+	lines = append(lines, "    }", "    return result", "}")
+	return joinLines(lines)
+}
+
+// orderNote is _order_note for the results the native generator renders:
+// a set or dict comprehension returns a map, whose order Go leaves
+// unspecified, except as an iterator or channel.
+func orderNote(code string, ir irComp, o pcsOptions) string {
+	if ir.Reduce != "" || ir.Kind != "set" && ir.Kind != "dict" || o.Emit == "iter" || o.Emit == "chan" {
+		return code
+	}
+	decl := regexp.MustCompile(`(?m)^func ` + regexp.QuoteMeta(o.FuncName) + `\(`)
+	if loc := decl.FindStringIndex(code); loc != nil {
+		note := "// " + o.FuncName + " returns a map; Go iterates maps in no fixed order.\n"
+		return code[:loc[0]] + note + code[loc[0]:]
+	}
+	return code
+}
+
+// renderIter is _render_iter: ir, which has a single generator, as a lazy
+// range-over-func iterator, and for a reduction a function consuming it.
+func renderIter(ir irComp, o pcsOptions, returnType string) string {
+	gen := ir.Generators[0]
+	v := gen.Var
+	start, stop, step := int64(0), int64(1000), int64(1)
+	if gen.Range != nil {
+		start, stop, step = gen.Range.Start, gen.Range.Stop, gen.Range.Step
+	}
+	element := ir.Element
+	if element == "" {
+		element = v
+	}
+
+	seqName, seqType, yieldSig := o.FuncName, "iter.Seq[int]", "int"
+	body := []string{"if !yield(" + element + ") { return }"}
+	switch {
+	case ir.Reduce != "":
+		seqName = o.FuncName + "Seq"
+		if ir.Reduce == "any" || ir.Reduce == "all" {
+			seqType, yieldSig = "iter.Seq[bool]", "bool"
+		}
+	case ir.Kind == "dict":
+		key, value := ir.Key, ir.Value
+		if key == "" {
+			key = v
+		}
+		if value == "" {
+			value = v
+		}
+		seqType, yieldSig = "iter.Seq2[int, int]", "int, int"
+		body = []string{"if !yield(" + key + ", " + value + ") { return }"}
+	case ir.Kind == "set":
+		body = []string{
+			"v := " + element,
+			"if _, dup := seen[v]; dup { continue }",
+			"seen[v] = struct{}{}",
+			"if !yield(v) { return }",
+		}
+	}
+
+	lines := []string{"import (", `    "iter"`, ")", ""}
+	lines = append(lines,
+		fmt.Sprintf("func %s() %s {", seqName, seqType),
+		fmt.Sprintf("    return func(yield func(%s) bool) {", yieldSig))
+	if ir.Kind == "set" && ir.Reduce == "" {
+		lines = append(lines, "        seen := make(map[int]struct{})")
+	}
+	lines = append(lines, "        "+forClause(v, start, stop, step)+" {")
+	for _, f := range gen.Filters {
+		lines = append(lines, "            if !("+f+") { continue }")
+	}
+	for _, stmt := range body {
+		lines = append(lines, "            "+stmt)
+	}
+	lines = append(lines, "        }", "    }", "}")
+
+	if ir.Reduce != "" {
+		lines = append(lines, "", fmt.Sprintf("func %s() %s {", o.FuncName, returnType), "    acc := "+reduceInit(ir.Reduce))
+		if ir.Reduce == "max" || ir.Reduce == "min" {
+			lines = append(lines, "    seen := false")
+		}
+		lines = append(lines, fmt.Sprintf("    for v := range %s() {", seqName))
+		for _, stmt := range reduceStmt(ir.Reduce, "acc", "seen", "v", true) {
+			lines = append(lines, "        "+stmt)
+		}
+		lines = append(lines, "    }")
+		if o.ResultType != "int" {
+			lines = append(lines, "    return "+o.ResultType+"(acc)")
+		} else {
+			lines = append(lines, "    return acc")
+		}
+		lines = append(lines, "}")
+	}
+	return joinLines(lines)
+}
+
+// renderChan is _render_chan: ir, which has a single generator, as values
+// sent over a channel, and for a reduction a function draining it.
+func renderChan(ir irComp, o pcsOptions, returnType string) string {
+	gen := ir.Generators[0]
+	v := gen.Var
+	start, stop, step := int64(0), int64(1000), int64(1)
+	if gen.Range != nil {
+		start, stop, step = gen.Range.Start, gen.Range.Stop, gen.Range.Step
+	}
+	element := ir.Element
+	if element == "" {
+		element = v
+	}
+
+	valueType := "int"
+	if ir.Reduce == "any" || ir.Reduce == "all" {
+		valueType = "bool"
+	}
+	send := []string{"out <- " + element}
+	switch {
+	case ir.Reduce == "" && ir.Kind == "dict":
+		key, value := ir.Key, ir.Value
+		if key == "" {
+			key = v
+		}
+		if value == "" {
+			value = v
+		}
+		valueType = "[2]int"
+		send = []string{fmt.Sprintf("out <- [2]int{%s, %s}", key, value)}
+	case ir.Reduce == "" && ir.Kind == "set":
+		send = []string{
+			"v := " + element,
+			"if _, dup := seen[v]; dup { continue }",
+			"seen[v] = struct{}{}",
+			"out <- v",
+		}
+	}
+
+	lines := []string{fmt.Sprintf("func %sTo(out chan<- %s) {", o.FuncName, valueType)}
+	if ir.Reduce == "" && ir.Kind == "set" {
+		lines = append(lines, "    seen := make(map[int]struct{})")
+	}
+	lines = append(lines, "    "+forClause(v, start, stop, step)+" {")
+	for _, f := range gen.Filters {
+		lines = append(lines, "        if !("+f+") { continue }")
+	}
+	for _, stmt := range send {
+		lines = append(lines, "        "+stmt)
+	}
+	lines = append(lines, "    }", "}", "")
+
+	if ir.Reduce != "" {
+		lines = append(lines, fmt.Sprintf("func %s() %s {", o.FuncName, returnType))
+	} else {
+		lines = append(lines, fmt.Sprintf("func %s() <-chan %s {", o.FuncName, valueType))
+	}
+	lines = append(lines,
+		fmt.Sprintf("    out := make(chan %s, %d)", valueType, chanBuffer),
+		"    go func() {",
+		"        defer close(out)",
+		fmt.Sprintf("        %sTo(out)", o.FuncName),
+		"    }()")
+	if ir.Reduce == "" {
+		lines = append(lines, "    return out", "}")
+		return joinLines(lines)
+	}
+	lines = append(lines, "    acc := "+reduceInit(ir.Reduce))
+	if ir.Reduce == "max" || ir.Reduce == "min" {
+		lines = append(lines, "    seen := false")
+	}
+	lines = append(lines, "    for v := range out {")
+	for _, stmt := range reduceStmt(ir.Reduce, "acc", "seen", "v", false) {
+		lines = append(lines, "        "+stmt)
+	}
+	lines = append(lines, "    }")
+	if o.ResultType != "int" {
+		lines = append(lines, "    return "+o.ResultType+"(acc)")
+	} else {
+		lines = append(lines, "    return acc")
+	}
+	lines = append(lines, "}")
+	return joinLines(lines)
+}
+
+// renderHelperCalls is _render_helper_calls: ir, which has a single
+// generator, as calls into pcs/backends/go/pcs_helpers.go.
+func renderHelperCalls(ir irComp, o pcsOptions, returnType string) string {
+	gen := ir.Generators[0]
+	v := gen.Var
+	start, stop, step := int64(0), int64(1000), int64(1)
+	if gen.Range != nil {
+		start, stop, step = gen.Range.Start, gen.Range.Stop, gen.Range.Step
+	}
+	seq := "xs"
+	if v == "xs" {
+		seq = "ys"
+	}
+	fn := func(result, expr string) string {
+		return fmt.Sprintf("func(%s int) %s { return %s }", v, result, expr)
+	}
+
+	lines := []string{
+		"// Requires pcs_helpers.go (pcs/backends/go) in the same package.",
+		fmt.Sprintf("func %s() %s {", o.FuncName, returnType),
+		fmt.Sprintf("    %s := Range(%d, %d, %d)", seq, start, stop, step),
+	}
+	if len(gen.Filters) > 0 {
+		cond := gen.Filters[0]
+		if len(gen.Filters) > 1 {
+			conds := make([]string, len(gen.Filters))
+			for i, f := range gen.Filters {
+				conds[i] = "(" + f + ")"
+			}
+			cond = strings.Join(conds, " && ")
+		}
+		lines = append(lines, fmt.Sprintf("    %s = Filter(%s, %s)", seq, seq, fn("bool", cond)))
+	}
+
+	element := ir.Element
+	if element == "" {
+		element = v
+	}
+	mapped := seq
+	if element != v {
+		mapped = fmt.Sprintf("Map(%s, %s)", seq, fn("int", element))
+	}
+	var result string
+	switch {
+	case ir.Reduce == "sum":
+		result = "Sum(" + mapped + ")"
+	case ir.Reduce == "prod":
+		result = "Reduce(" + mapped + ", 1, func(acc, v int) int { return acc * v })"
+	case ir.Reduce == "max" || ir.Reduce == "min":
+		result = strings.ToUpper(ir.Reduce[:1]) + ir.Reduce[1:] + "(" + mapped + ")"
+	case ir.Reduce == "any" || ir.Reduce == "all":
+		result = fmt.Sprintf("%s%s(%s, %s)", strings.ToUpper(ir.Reduce[:1]), ir.Reduce[1:], seq, fn("bool", element))
+	case ir.Kind == "set":
+		result = "SetOf(" + mapped + ")"
+	case ir.Kind == "dict":
+		key, value := ir.Key, ir.Value
+		if key == "" {
+			key = v
+		}
+		if value == "" {
+			value = v
+		}
+		result = fmt.Sprintf("MapKV(%s, %s)", seq, fn("(int, int)", key+", "+value))
+	default:
+		result = mapped
+	}
+	if o.ResultType != "int" {
+		result = o.ResultType + "(" + result + ")"
+	}
+	lines = append(lines, "    return "+result, "}")
+	return joinLines(lines)
+}
+
+// renderParallel is _render_parallel: a list, set or reduction over one
+// chunk of the range per GOMAXPROCS, combined in chunk order.
+func renderParallel(ir irComp, o pcsOptions, start, stop, step int64, returnType string) string {
+	gen := ir.Generators[0]
+	v := gen.Var
+	element := ir.Element
+	if element == "" {
+		element = v
+	}
+	k := ir.Reduce
+	partialType := "[]int"
+	switch {
+	case k == "any" || k == "all":
+		partialType = "bool"
+	case k != "":
+		partialType = "int"
+	case ir.Kind == "set":
+		partialType = "map[int]struct{}"
+	}
+
+	lines := []string{
+		"import (",
+		`    "runtime"`,
+		`    "sync"`,
+		")",
+		"",
+		fmt.Sprintf("func %s() %s {", o.FuncName, returnType),
+		"    numWorkers := runtime.GOMAXPROCS(0)",
+		fmt.Sprintf("    total := %d", rangeLen(start, stop, step)),
+		"    chunkSize := (total + numWorkers - 1) / numWorkers",
+		"",
+		fmt.Sprintf("    partials := make([]%s, numWorkers)", partialType),
+	}
+	if k == "max" || k == "min" {
+		lines = append(lines, "    seen := make([]bool, numWorkers)")
+	}
+	lines = append(lines,
+		"    var wg sync.WaitGroup",
+		"",
+		"    for w := 0; w < numWorkers; w++ {",
+		"        wg.Add(1)",
+		"        go func(workerID int) {",
+		"            defer wg.Done()",
+		"            lo := workerID * chunkSize",
+		"            hi := lo + chunkSize",
+		"            if hi > total { hi = total }",
+		"            if lo > hi { lo = hi }",
+		"")
+	switch {
+	case k != "":
+		lines = append(lines, "            acc := "+reduceInit(k))
+		if k == "max" || k == "min" {
+			lines = append(lines, "            found := false")
+		}
+	case ir.Kind == "set":
+		lines = append(lines, "            part := make(map[int]struct{})")
+	case len(gen.Filters) > 0:
+		lines = append(lines, "            part := make([]int, 0)")
+	default:
+		lines = append(lines, "            part := make([]int, 0, hi-lo)")
+	}
+	lines = append(lines, "            "+chunkLoop(v, start, step)+" {")
+	for _, f := range gen.Filters {
+		lines = append(lines, fmt.Sprintf("                if !(%s) { continue }", f))
+	}
+	switch {
+	case k != "":
+		for _, stmt := range reduceStmt(k, "acc", "found", element, true) {
+			lines = append(lines, "                "+stmt)
+		}
+	case ir.Kind == "set":
+		lines = append(lines, fmt.Sprintf("                part[%s] = struct{}{}", element))
+	default:
+		lines = append(lines, fmt.Sprintf("                part = append(part, %s)", element))
+	}
+	lines = append(lines, "            }")
+	switch k {
+	case "":
+		lines = append(lines, "            partials[workerID] = part")
+	case "max", "min":
+		lines = append(lines, "            partials[workerID] = acc", "            seen[workerID] = found")
+	default:
+		lines = append(lines, "            partials[workerID] = acc")
+	}
+	lines = append(lines, "        }(w)", "    }", "    wg.Wait()", "")
+
+	switch {
+	case k == "any":
+		lines = append(lines, "    for _, p := range partials {", "        if p { return true }", "    }", "    return false")
+	case k == "all":
+		lines = append(lines, "    for _, p := range partials {", "        if !p { return false }", "    }", "    return true")
+	case k != "":
+		if k == "max" || k == "min" {
+			lines = append(lines, "    acc, found := 0, false", "    for w, p := range partials {", "        if !seen[w] { continue }")
+			for _, stmt := range reduceStmt(k, "acc", "found", "p", false) {
+				lines = append(lines, "        "+stmt)
+			}
+		} else {
+			op := "+="
+			if k == "prod" {
+				op = "*="
+			}
+			lines = append(lines, "    acc := "+reduceInit(k), "    for _, p := range partials {", "        acc "+op+" p")
+		}
+		result := "acc"
+		if o.ResultType != "int" {
+			result = o.ResultType + "(acc)"
+		}
+		lines = append(lines, "    }", "    return "+result)
+	case ir.Kind == "set":
+		lines = append(lines,
+			"    result := partials[0]",
+			"    for _, part := range partials[1:] {",
+			"        for v := range part { result[v] = struct{}{} }",
+			"    }",
+			"    return result")
+	default:
+		lines = append(lines,
+			"    n := 0",
+			"    for _, part := range partials { n += len(part) }",
+			"    result := make([]int, 0, n)",
+			"    for _, part := range partials {",
+			"        result = append(result, part...)",
+			"    }",
+			"    return result")
+	}
+	lines = append(lines, "}")
+	return joinLines(lines)
+}
+
+// orElse is Python's `s or alt` for an optional IR expression.
+func orElse(s, alt string) string {
+	if s == "" {
+		return alt
+	}
+	return s
+}
+
+// keyedByExpr reports whether ir is a single-generator dict comprehension
+// whose key is not its loop variable, so that its shards can share keys.
+func keyedByExpr(ir irComp) bool {
+	if ir.Kind != "dict" || ir.Reduce != "" || len(ir.Generators) != 1 {
+		return false
+	}
+	return ir.Key != "" && ir.Key != ir.Generators[0].Var
+}
+
+// renderShardedDict is _render_sharded_dict: each worker fills its own
+// shard map, merged with the shardMerge strategy or wrapped in a
+// read-only shardedMap. A key other than the loop variable merges in chunk
+// order, so the last value wins as in Python.
+func renderShardedDict(ir irComp, funcName string, start, stop, step, hint int64, shardMerge string) string {
+	gen := ir.Generators[0]
+	v := gen.Var
+	key, val := orElse(ir.Key, v), orElse(ir.Value, v)
+	total := rangeLen(start, stop, step)
+	if key != v {
+		shardMerge = "ordered"
+	}
+	wrap := shardMerge == "wrap"
+
+	lines := []string{"import (", `    "runtime"`}
+	if shardMerge == "sized" || shardMerge == "adopt" {
+		lines = append(lines, `    "sort"`)
+	}
+	lines = append(lines, `    "sync"`, ")", "")
+	returnType := "map[int]int"
+	if wrap {
+		lines = append(lines, shardedMapType(start, step)...)
+		returnType = "*shardedMap"
+	}
+	lines = append(lines,
+		fmt.Sprintf("func %s() %s {", funcName, returnType),
+		"    numWorkers := runtime.GOMAXPROCS(0)",
+		fmt.Sprintf("    total := %d", total),
+		"    chunkSize := (total + numWorkers - 1) / numWorkers",
+		"",
+		"    shards := make([]map[int]int, numWorkers)",
+		"    var wg sync.WaitGroup",
+		"",
+		"    for w := 0; w < numWorkers; w++ {",
+		"        wg.Add(1)",
+		"        go func(workerID int) {",
+		"            defer wg.Done()",
+		"            lo := workerID * chunkSize",
+		"            hi := lo + chunkSize",
+		"            if hi > total { hi = total }",
+		"            if lo > hi { lo = hi }",
+		"")
+	if hint < 0 {
+		lines = append(lines, "            shard := make(map[int]int)")
+	} else {
+		lines = append(lines, fmt.Sprintf("            shard := make(map[int]int, %d/numWorkers+1)", hint))
+	}
+	lines = append(lines, "            "+chunkLoop(v, start, step)+" {")
+	for _, f := range gen.Filters {
+		lines = append(lines, fmt.Sprintf("                if !(%s) { continue }", f))
+	}
+	lines = append(lines,
+		fmt.Sprintf("                shard[%s] = %s", key, val),
+		"            }",
+		"            shards[workerID] = shard",
+		"        }(w)",
+		"    }",
+		"    wg.Wait()",
+		"")
+
+	switch shardMerge {
+	case "wrap":
+		lines = append(lines,
+			"    n := 0",
+			"    for _, shard := range shards { n += len(shard) }",
+			"    return &shardedMap{shards: shards, chunkSize: chunkSize, total: total, n: n}",
+			"}")
+		return joinLines(lines)
+	case "ordered":
+		lines = append(lines,
+			"    result := make(map[int]int)",
+			"    for _, shard := range shards {")
+	case "sized":
+		lines = append(lines,
+			"    // Largest shards first into a destination sized for every entry",
+			"    size := 0",
+			"    for _, shard := range shards { size += len(shard) }",
+			"    sort.Slice(shards, func(i, j int) bool { return len(shards[i]) > len(shards[j]) })",
+			"    result := make(map[int]int, size)",
+			"    for _, shard := range shards {")
+	default:
+		lines = append(lines,
+			"    // Adopt the largest shard as the result and merge the rest into it",
+			"    sort.Slice(shards, func(i, j int) bool { return len(shards[i]) > len(shards[j]) })",
+			"    result := shards[0]",
+			"    for _, shard := range shards[1:] {")
+	}
+	lines = append(lines,
+		"        for k, v := range shard { result[k] = v }",
+		"    }",
+		"    return result",
+		"}")
+	return joinLines(lines)
+}
+
+// forClause is _for_clause for constant bounds.
+func forClause(v string, start, stop, step int64) string {
+	cmp := "<"
+	if step <= 0 {
+		cmp = ">"
+	}
+	return fmt.Sprintf("for %s := %d; %s %s %d; %s += %d", v, start, v, cmp, stop, v, step)
+}
+
+// chunkLoop is _chunk_loop.
+func chunkLoop(v string, start, step int64) string {
+	cmp := "<"
+	if step <= 0 {
+		cmp = ">"
+	}
+	return fmt.Sprintf("for %s := %d + lo*%d; %s %s %d + hi*%d; %s += %d", v, start, step, v, cmp, start, step, v, step)
+}
+
+// shardedMapType is _sharded_map_type, the view returned by the wrap merge.
+func shardedMapType(start, step int64) []string {
+	bounds := []string{
+		fmt.Sprintf("    if k < %d { return 0, false }", start),
+		fmt.Sprintf("    i := k - %d", start),
+	}
+	if step != 1 {
+		// Keys run down from start on a negative step
+		before := "<"
+		if step < 0 {
+			before = ">"
+		}
+		bounds = []string{
+			fmt.Sprintf("    if k %s %d || (k-%d)%%%d != 0 { return 0, false }", before, start, start, step),
+			fmt.Sprintf("    i := (k - %d) / %d", start, step),
+		}
+	}
+	lines := []string{
+		"// shardedMap is a read-only view over per-worker shard maps. Shard i",
+		"// holds the keys of the i-th contiguous chunk of the range, so Get goes",
+		"// straight to one shard. It is safe for concurrent readers.",
+		"type shardedMap struct {",
+		"    shards    []map[int]int",
+		"    chunkSize int",
+		"    total     int",
+		"    n         int",
+		"}",
+		"",
+		"func (m *shardedMap) Get(k int) (int, bool) {",
+	}
+	lines = append(lines, bounds...)
+	return append(lines,
+		"    if i >= m.total || m.chunkSize == 0 { return 0, false }",
+		"    v, ok := m.shards[i/m.chunkSize][k]",
+		"    return v, ok",
+		"}",
+		"",
+		"func (m *shardedMap) Len() int { return m.n }",
+		"",
+		"// Range calls f for every entry until f returns false, shard by shard.",
+		"func (m *shardedMap) Range(f func(k, v int) bool) {",
+		"    for _, shard := range m.shards {",
+		"        for k, v := range shard {",
+		"            if !f(k, v) { return }",
+		"        }",
+		"    }",
+		"}",
+		"")
+}
+
+// fusionSource is _fusion_source: the loop variable and range every
+// reduction in irs shares.
+func fusionSource(irs []irComp) (string, irRange, error) {
+	var bounds *irRange
+	for i, ir := range irs {
+		if ir.Reduce == "" || len(ir.Generators) != 1 {
+			return "", irRange{}, fmt.Errorf("Expression %d is not a single-generator reduction; only reductions can share a pass", i)
+		}
+		r := ir.Generators[0].Range
+		if r == nil {
+			return "", irRange{}, fmt.Errorf("Expression %d does not iterate over a range", i)
+		}
+		if bounds == nil {
+			bounds = r
+		} else if *r != *bounds {
+			return "", irRange{}, fmt.Errorf("Expression %d iterates range(%d, %d, %d), expression 0 range(%d, %d, %d); only reductions over the same range can be combined",
+				i, r.Start, r.Stop, r.Step, bounds.Start, bounds.Stop, bounds.Step)
+		}
+	}
+	return irs[0].Generators[0].Var, *bounds, nil
+}
+
+// renameVar replaces the identifier old in expr with new.
+func renameVar(expr, old, new string) string {
+	if old == new {
+		return expr
+	}
+	return regexp.MustCompile(`\b`+regexp.QuoteMeta(old)+`\b`).ReplaceAllLiteralString(expr, new)
+}
+
+// reduceInit is the value a reduction's accumulator starts from.
+func reduceInit(kind string) string {
+	switch kind {
+	case "prod":
+		return "1"
+	case "any":
+		return "false"
+	case "all":
+		return "true"
+	}
+	return "0"
+}
+
+// reduceStmt is _reduce_stmt: one iteration of reduction kind into acc
+// with Python semantics.
+func reduceStmt(kind, acc, seen, expr string, earlyExit bool) []string {
+	switch kind {
+	case "sum":
+		return []string{fmt.Sprintf("%s += %s", acc, expr)}
+	case "prod":
+		return []string{fmt.Sprintf("%s *= %s", acc, expr)}
+	case "max", "min":
+		cmp := ">"
+		if kind == "min" {
+			cmp = "<"
+		}
+		return []string{
+			fmt.Sprintf("if v := %s; !%s || v %s %s {", expr, seen, cmp, acc),
+			fmt.Sprintf("    %s = v", acc),
+			fmt.Sprintf("    %s = true", seen),
+			"}",
+		}
+	case "any":
+		if earlyExit {
+			return []string{fmt.Sprintf("if %s {", expr), fmt.Sprintf("    %s = true", acc), "    break", "}"}
+		}
+		return []string{fmt.Sprintf("%s = %s || (%s)", acc, acc, expr)}
+	}
+	if earlyExit {
+		return []string{fmt.Sprintf("if !(%s) {", expr), fmt.Sprintf("    %s = false", acc), "    break", "}"}
+	}
+	return []string{fmt.Sprintf("%s = %s && (%s)", acc, acc, expr)}
+}
+
+func indentLines(indent string, stmts []string) []string {
+	out := make([]string, len(stmts))
+	for i, s := range stmts {
+		out[i] = indent + s
+	}
+	return out
+}
+
+// renderGoMulti is render_go_multi: several reductions over one range
+// returned in one struct, in a pass each or, fused, in a single loop.
+func renderGoMulti(irs []irComp, funcName string, fuse bool, sources []string) (string, error) {
+	v, r, err := fusionSource(irs)
+	if err != nil {
+		return "", err
+	}
+	typeName := funcName + "Result"
+
+	lines := []string{fmt.Sprintf("type %s struct {", typeName)}
+	for i, ir := range irs {
+		goType := "int"
+		if ir.Reduce == "any" || ir.Reduce == "all" {
+			goType = "bool"
+		}
+		lines = append(lines, fmt.Sprintf("    R%d %s // %s", i, goType, strings.TrimSpace(sources[i])))
+	}
+	lines = append(lines, "}", "", fmt.Sprintf("func %s() %s {", funcName, typeName), fmt.Sprintf("    var res %s", typeName))
+	for i, ir := range irs {
+		switch ir.Reduce {
+		case "prod":
+			lines = append(lines, fmt.Sprintf("    res.R%d = 1", i))
+		case "all":
+			lines = append(lines, fmt.Sprintf("    res.R%d = true", i))
+		case "max", "min":
+			lines = append(lines, fmt.Sprintf("    seen%d := false", i))
+		}
+	}
+
+	body := func(i int, ir irComp, earlyExit bool) []string {
+		gen := ir.Generators[0]
+		expr := renameVar(ir.Element, gen.Var, v)
+		var conds []string
+		for _, f := range gen.Filters {
+			conds = append(conds, "("+renameVar(f, gen.Var, v)+")")
+		}
+		stmt := reduceStmt(ir.Reduce, fmt.Sprintf("res.R%d", i), fmt.Sprintf("seen%d", i), expr, earlyExit)
+		if conds != nil {
+			guarded := []string{fmt.Sprintf("if %s {", strings.Join(conds, " && "))}
+			guarded = append(guarded, indentLines("    ", stmt)...)
+			stmt = append(guarded, "}")
+		}
+		return indentLines("        ", stmt)
+	}
+
+	loop := "    " + forClause(v, r.Start, r.Stop, r.Step) + " {"
+	if fuse {
+		lines = append(lines, loop)
+		for i, ir := range irs {
+			lines = append(lines, body(i, ir, false)...)
+		}
+		lines = append(lines, "    }")
+	} else {
+		for i, ir := range irs {
+			lines = append(lines, loop)
+			lines = append(lines, body(i, ir, true)...)
+			lines = append(lines, "    }")
+		}
+	}
+	lines = append(lines, "    return res", "}")
+	return joinLines(lines), nil
+}
+
+// reservedStageNames are the names a pipeline stage cannot take, as in
+// _RESERVED_STAGE_NAMES.
+var reservedStageNames = strings.Fields(`
+	break case chan const continue default defer else fallthrough for func go
+	goto if import interface map package range return select struct switch
+	type var append make int bool true false result seen v`)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// usesVar reports whether any of exprs mentions the identifier v.
+func usesVar(v string, exprs ...string) bool {
+	word := regexp.MustCompile(`\b` + regexp.QuoteMeta(v) + `\b`)
+	for _, e := range exprs {
+		if e != "" && word.MatchString(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkPipeline(names []string, irs []irComp) error {
+	seen := map[string]bool{}
+	for i, ir := range irs {
+		name := names[i]
+		if !identifier.MatchString(name) || contains(reservedStageNames, name) {
+			return fmt.Errorf("Invalid stage name: '%s'", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("Duplicate stage name: '%s'", name)
+		}
+		seen[name] = true
+		if len(ir.Generators) != 1 {
+			return fmt.Errorf("Stage '%s' must have a single generator", name)
+		}
+		gen := ir.Generators[0]
+		if i == 0 && gen.Range == nil {
+			return fmt.Errorf("The first stage, '%s', must iterate over a range", name)
+		}
+		if i > 0 && (gen.Range != nil || gen.Source != names[i-1]) {
+			return fmt.Errorf("Stage '%s' must iterate over the previous stage '%s'", name, names[i-1])
+		}
+		if i < len(irs)-1 && (ir.Reduce != "" || ir.Kind != "list" && ir.Kind != "generator") {
+			return fmt.Errorf("Stage '%s' feeds another stage, so it must be a list or generator expression", name)
+		}
+	}
+	return nil
+}
+
+// renderGoPipeline is render_go_pipeline: named stages, each iterating over
+// the one before, materialized one after another or fused into one loop.
+func renderGoPipeline(names []string, irs []irComp, funcName string, fuse bool) (string, error) {
+	if len(irs) == 0 {
+		return "", errors.New("render_go_pipeline needs at least one stage")
+	}
+	if err := checkPipeline(names, irs); err != nil {
+		return "", err
+	}
+	final := irs[len(irs)-1]
+	finalVar := final.Generators[0].Var
+	kind := final.Reduce
+
+	var returnType, init string
+	switch {
+	case kind == "any" || kind == "all":
+		returnType, init = "bool", "false"
+		if kind == "all" {
+			init = "true"
+		}
+	case kind != "":
+		returnType, init = "int", "0"
+		if kind == "prod" {
+			init = "1"
+		}
+	case final.Kind == "set":
+		returnType, init = "map[int]struct{}", "make(map[int]struct{})"
+	case final.Kind == "dict":
+		returnType, init = "map[int]int", "make(map[int]int)"
+	default:
+		returnType, init = "[]int", "make([]int, 0)"
+	}
+
+	var emit []string
+	switch {
+	case kind != "":
+		emit = reduceStmt(kind, "result", "seen", orElse(final.Element, finalVar), true)
+	case final.Kind == "set":
+		emit = []string{fmt.Sprintf("result[%s] = struct{}{}", orElse(final.Element, finalVar))}
+	case final.Kind == "dict":
+		emit = []string{fmt.Sprintf("result[%s] = %s", orElse(final.Key, finalVar), orElse(final.Value, finalVar))}
+	default:
+		emit = []string{fmt.Sprintf("result = append(result, %s)", orElse(final.Element, finalVar))}
+	}
+
+	uses := func(ir irComp) bool {
+		gen := ir.Generators[0]
+		return usesVar(gen.Var, append(append([]string{}, gen.Filters...), ir.Element, ir.Key, ir.Value)...)
+	}
+	guards := func(ir irComp) []string {
+		var out []string
+		for _, f := range ir.Generators[0].Filters {
+			out = append(out, fmt.Sprintf("if !(%s) { continue }", f))
+		}
+		return out
+	}
+
+	src := irs[0].Generators[0]
+	r := src.Range
+	head := forClause(src.Var, r.Start, r.Stop, r.Step) + " {"
+
+	lines := []string{fmt.Sprintf("func %s() %s {", funcName, returnType)}
+	if fuse {
+		lines = append(lines, "    result := "+init)
+		if kind == "max" || kind == "min" {
+			lines = append(lines, "    seen := false")
+		}
+		lines = append(lines, "    "+head)
+		for i, ir := range irs {
+			if i > 0 && uses(ir) {
+				prev := irs[i-1]
+				value := orElse(prev.Element, prev.Generators[0].Var)
+				if v := ir.Generators[0].Var; value != v {
+					lines = append(lines, fmt.Sprintf("        %s := %s", v, value))
+				}
+			}
+			lines = append(lines, indentLines("        ", guards(ir))...)
+		}
+		lines = append(lines, indentLines("        ", emit)...)
+		lines = append(lines, "    }")
+	} else {
+		for i, ir := range irs {
+			gen := ir.Generators[0]
+			body := emit
+			if i == len(irs)-1 {
+				lines = append(lines, "    result := "+init)
+				if kind == "max" || kind == "min" {
+					lines = append(lines, "    seen := false")
+				}
+			} else {
+				lines = append(lines, fmt.Sprintf("    %s := make([]int, 0)", names[i]))
+				body = []string{fmt.Sprintf("%s = append(%s, %s)", names[i], names[i], orElse(ir.Element, gen.Var))}
+			}
+			switch {
+			case i == 0:
+				lines = append(lines, "    "+head)
+			case uses(ir):
+				lines = append(lines, fmt.Sprintf("    for _, %s := range %s {", gen.Var, names[i-1]))
+			default:
+				lines = append(lines, fmt.Sprintf("    for range %s {", names[i-1]))
+			}
+			lines = append(lines, indentLines("        ", guards(ir))...)
+			lines = append(lines, indentLines("        ", body)...)
+			lines = append(lines, "    }")
+		}
+	}
+	lines = append(lines, "    return result", "}")
+	return joinLines(lines), nil
+}
+
+// runCodegen implements `codegen`: it renders pcs arguments natively and
+// prints the result as `python3 -m pcs` would, failing where that would
+// need Python.
+func runCodegen(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprintf(os.Stderr, "usage: pcs-bench codegen --target go --code EXPR [pcs options]\n")
+		fmt.Fprintf(os.Stderr, "Renders pcs's Go backend without Python. Supported options: --code, --stage,\n"+
+			"--parallel, --fuse, --no-presize, --go-map-impl, --go-shard-merge, --go-package,\n"+
+			"--go-result-type, --go-emit, --func-name.\n")
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	out, err := renderNative(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "codegen: %v\n", err)
+		var nn *errNotNative
+		if errors.As(err, &nn) {
+			return 2
+		}
+		return 1
+	}
+	os.Stdout.Write(out)
+	return 0
+}
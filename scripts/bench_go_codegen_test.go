@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// paritySizes are the {N} the parity test renders cases at: the default
+// -sizes, and one small enough for different size hints.
+var paritySizes = []int{1000, 1000000}
+
+// TestCodegenParity renders the Go cases of the stock matrix and of every
+// embedded suite, in each emission strategy of codegen-report, with the
+// native generator and with python3 -m pcs, and diffs the two: the native
+// port must stay byte-identical to pcs/renderers/go.py. What the native
+// generator does not cover falls back to Python in the harness, so it is
+// skipped here; what it refuses, pcs must refuse too.
+func TestCodegenParity(t *testing.T) {
+	// pcs runs from the repository root, as the harness runs it
+	pcs := func(args ...string) *exec.Cmd {
+		cmd := exec.Command("python3", args...)
+		cmd.Dir = ".."
+		return cmd
+	}
+	if err := pcs("-c", "import pcs").Run(); err != nil {
+		t.Skipf("python3 cannot import pcs: %v", err)
+	}
+	matrix := benchCases()
+	for _, name := range suiteNames() {
+		cases, err := loadSuite(name, matrix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matrix = append(matrix, cases...)
+	}
+
+	compared, skipped := 0, 0
+	for _, tc := range matrix {
+		if tc.backend() != "go" {
+			continue
+		}
+		for _, strategy := range emitStrategies {
+			if strategy.name == "parallel" && tc.Parallel {
+				continue
+			}
+			for _, n := range paritySizes {
+				args := append(generatorArgs(tc, n)[2:], strategy.flags...)
+				native, err := renderNative(args)
+				var nn *errNotNative
+				if errors.As(err, &nn) {
+					skipped++
+					continue
+				}
+				python, pyErr := pcs(append([]string{"-m", "pcs"}, args...)...).Output()
+				name := strings.Join(args, " ")
+				switch {
+				case err != nil && pyErr == nil:
+					t.Errorf("%s: native generator refuses what pcs renders: %v", name, err)
+				case err == nil && pyErr != nil:
+					t.Errorf("%s: native generator renders what pcs refuses: %v", name, pyErr)
+				case err == nil && string(native) != string(python):
+					t.Errorf("%s: native output differs from pcs\n--- pcs\n%s\n--- native\n%s", name, python, native)
+				}
+				compared++
+			}
+		}
+	}
+	if compared == 0 {
+		t.Fatal("no case is rendered natively")
+	}
+	t.Logf("compared %d renderings, %d not covered natively", compared, skipped)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// emitStrategies are the ways pcs's Go backend can emit a snippet, as
+// codegen-report compares them: inline loops, their --parallel form, calls
+// into the generic helpers, and the two streaming forms, which hand values
+// on lazily through an iter.Seq or a channel instead of materializing them.
+var emitStrategies = []struct {
+	name  string
+	flags []string
+}{
+	{"loops", nil},
+	{"parallel", []string{"--parallel"}},
+	{"helpers", []string{"--go-emit", "helpers"}},
+	{"iter", []string{"--go-emit", "iter"}},
+	{"chan", []string{"--go-emit", "chan"}},
+}
+
+// emitReport is one strategy's row of codegen-report. Error is why the
+// strategy could not be generated, built or timed, when it could not.
+// Lazy is set when program returns the iterator or channel itself: the
+// timing driver keeps the result without consuming it, so MedianNs is the
+// cost of starting the stream, not of the values.
+type emitReport struct {
+	Strategy string   `json:"strategy"`
+	Flags    []string `json:"flags"`
+	Code     string   `json:"code,omitempty"`
+	Lines    int      `json:"lines,omitempty"`
+	Lazy     bool     `json:"lazy,omitempty"`
+	Vet      string   `json:"vet,omitempty"`
+	MedianNs int64    `json:"median_ns,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// runCodegenReport implements `codegen-report`: it renders one snippet in
+// every Go emission strategy and shows the programs side by side with
+// their line counts, go vet verdicts and a quick benchmark each, so the
+// choice between them is made from the numbers rather than by trying each
+// flag in turn. A strategy the snippet has no form in is reported with
+// pcs's reason and does not fail the report; it exits 1 only when no
+// strategy could be generated.
+func runCodegenReport(args []string) int {
+	fs := flag.NewFlagSet("codegen-report", flag.ExitOnError)
+	code := fs.String("code", "", "Python snippet over a range, not input data, to render; {N} is replaced by -n")
+	n := fs.Int("n", 100000, "value substituted for {N}, and the size timed at")
+	reps := fs.Int("reps", 10, "timed calls per strategy")
+	bench := fs.Bool("bench", true, "time each strategy (false: generate and vet only)")
+	vet := fs.Bool("vet", true, "run go vet over each strategy's program")
+	pcsFlags := fs.String("flags", "", "further pcs options for every strategy, space-separated, e.g. '--no-presize'")
+	showCode := fs.Bool("show-code", true, "print each strategy's generated code before the summary")
+	asJSON := fs.Bool("json", false, "print the report as JSON, code included")
+	timeout := fs.Duration("timeout", 30*time.Second, "limit on each generate, compile and benchmark process")
+	cacheDir := fs.String("cache", "target/go_bench_cache", "directory caching generated code and binaries by content hash")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench codegen-report -code snippet [flags]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *code == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	handleInterrupts()
+
+	cache, err := openBuildCache(*cacheDir, "pcs")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "codegen-report: -cache: %v\n", err)
+		return 2
+	}
+	defer cache.close()
+	dir, err := os.MkdirTemp("", "pcs-codegen-report-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "codegen-report: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	be, err := lookupBackend("go")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "codegen-report: %v\n", err)
+		return 1
+	}
+	goVersion := ""
+	if g, err := resolveGo("go"); err == nil {
+		goVersion = g.Version
+	}
+
+	var reports []emitReport
+	checker := &staticChecker{}
+	for _, s := range emitStrategies {
+		if interrupted() {
+			break
+		}
+		tc := benchCase{Test: "snippet", Mode: s.name, Code: *code, Flags: append(append([]string(nil), s.flags...), strings.Fields(*pcsFlags)...)}
+		if s.name == "parallel" {
+			tc.Parallel, tc.Flags = true, tc.Flags[1:]
+		}
+		report := emitReport{Strategy: s.name, Flags: s.flags}
+		if report.Flags == nil {
+			report.Flags = []string{}
+		}
+		fmt.Fprintf(os.Stderr, "codegen-report: %s\n", s.name)
+		generated, _, err := be.Runner.Generate(cache, tc, *n)
+		if err != nil {
+			report.Error = "generate: " + oneLine(err.Error())
+			reports = append(reports, report)
+			continue
+		}
+		report.Code = string(generated)
+		report.Lines = codeLines(generated)
+		report.Lazy = lazyProgram.Match(generated)
+
+		if *vet {
+			tc.Runtime = vendoredRuntime(generated)
+			var prog program
+			err := os.MkdirAll(filepath.Join(dir, s.name), 0755)
+			if err == nil {
+				prog, err = be.Runner.Build(tc, generated, filepath.Join(dir, s.name, "go_bench"), *n)
+			}
+			if err == nil {
+				var hash string
+				if hash, err = hashFiles(prog.Sources...); err == nil {
+					err = checker.check(tc, prog.Sources, hash)
+				}
+			}
+			report.Vet = "ok"
+			if err != nil {
+				report.Vet = "failed"
+				report.Error = "vet: " + oneLine(err.Error())
+			}
+		}
+
+		if *bench && report.Error == "" {
+			result := BenchmarkResult{
+				Backend:   "go",
+				Test:      tc.Test,
+				Mode:      tc.Mode,
+				Parallel:  tc.Parallel,
+				N:         *n,
+				OS:        runtime.GOOS,
+				Protocol:  "steady",
+				Toolchain: tc.toolchain(),
+				GoVersion: goVersion,
+			}
+			result = benchSnippet(be, tc, result, dir, cache, runEnv{Timeout: *timeout}, *reps)
+			if result.measured() {
+				report.MedianNs = result.MedianNs
+			} else {
+				report.Error = oneLine(result.Error)
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	status := 1
+	for _, r := range reports {
+		if r.Code != "" {
+			status = 0
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(reports)
+		return status
+	}
+	if *showCode {
+		for _, r := range reports {
+			if r.Code == "" {
+				continue
+			}
+			fmt.Printf("// ---- %s %s\n%s\n", r.Strategy, strings.Join(r.Flags, " "), strings.TrimRight(r.Code, "\n"))
+			fmt.Println()
+		}
+	}
+	writeEmitTable(reports)
+	return status
+}
+
+// lazyProgram matches the signature of a program returning its values as
+// an iter.Seq, iter.Seq2 or channel.
+var lazyProgram = regexp.MustCompile(`(?m)^func program\(\) (iter\.Seq|<-chan|chan)`)
+
+// writeEmitTable prints the summary of a report, timings relative to the
+// fastest strategy that computes its values in the call.
+func writeEmitTable(reports []emitReport) {
+	var fastest int64
+	width := len("STRATEGY")
+	for _, r := range reports {
+		width = max(width, len(r.Strategy))
+		if r.MedianNs > 0 && !r.Lazy && (fastest == 0 || r.MedianNs < fastest) {
+			fastest = r.MedianNs
+		}
+	}
+	fmt.Printf("%-*s  %5s  %-6s  %12s  %7s  %s\n", width, "STRATEGY", "LINES", "VET", "MEDIAN", "VS BEST", "FLAGS")
+	for _, r := range reports {
+		lines, vet, median, rel := "-", orElse(r.Vet, "-"), "-", "-"
+		if r.Lines > 0 {
+			lines = fmt.Sprint(r.Lines)
+		}
+		if r.MedianNs > 0 {
+			median = time.Duration(r.MedianNs).String()
+			if r.Lazy {
+				rel = "lazy"
+			} else {
+				rel = fmt.Sprintf("%.2fx", float64(r.MedianNs)/float64(fastest))
+			}
+		}
+		fmt.Printf("%-*s  %5s  %-6s  %12s  %7s  %s\n", width, r.Strategy, lines, vet, median, rel, strings.Join(r.Flags, " "))
+		if r.Error != "" {
+			fmt.Printf("%-*s  %s\n", width, "", r.Error)
+		}
+	}
+	for _, r := range reports {
+		if r.Lazy && r.MedianNs > 0 {
+			fmt.Println("lazy: program returns an unconsumed iterator or channel, so its median is the cost of starting it")
+			break
+		}
+	}
+}
+
+// codeLines counts the non-blank lines of generated code.
+func codeLines(code []byte) int {
+	lines := 0
+	for _, line := range bytes.Split(code, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			lines++
+		}
+	}
+	return lines
+}
+
+// oneLine is the first line of an error, which python3 -m pcs ends with
+// its traceback.
+func oneLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
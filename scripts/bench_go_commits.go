@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCompareCommits implements `compare-commits <old> <new>`: it checks both
+// revisions of the generator out into temporary worktrees, generates and
+// builds every bench case from each, runs the two binaries back to back in
+// alternating rounds and prints the per-case delta of new vs old.
+func runCompareCommits(args []string) int {
+	fs := flag.NewFlagSet("compare-commits", flag.ExitOnError)
+	n := fs.Int("n", 1000000, "value substituted for {N}")
+	rounds := fs.Int("rounds", 3, "alternating old/new rounds per case")
+	reps := fs.Int("reps", 10, "timed calls per binary per round")
+	protocol := fs.String("protocol", getEnv("PCS_BENCH_PROTOCOL", "steady"), "warmup protocol: cold, warmup or steady")
+	run := fs.String("run", "", "only cases whose test/mode matches this regexp")
+	out := fs.String("o", "", "also write both sides' results as NDJSON to this file")
+	keepDir := fs.Bool("keep", false, "keep the worktrees and builds instead of deleting them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench compare-commits [flags] <old> <new>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 || *rounds < 1 || *reps < 1 {
+		fs.Usage()
+		return 2
+	}
+	if _, ok := measureProtocols[*protocol]; !ok {
+		fmt.Fprintf(os.Stderr, "compare-commits: unknown protocol %q\n", *protocol)
+		return 2
+	}
+	var filter *regexp.Regexp
+	if *run != "" {
+		var err error
+		if filter, err = regexp.Compile(*run); err != nil {
+			fmt.Fprintf(os.Stderr, "compare-commits: %v\n", err)
+			return 2
+		}
+	}
+
+	work, err := os.MkdirTemp("", "pcs-compare-commits-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compare-commits: %v\n", err)
+		return 1
+	}
+	if *keepDir {
+		fmt.Fprintf(os.Stderr, "working in %s\n", work)
+	} else {
+		defer os.RemoveAll(work)
+	}
+
+	var sides [2]commitSide
+	for i, ref := range fs.Args() {
+		side, err := checkoutSide(work, []string{"old", "new"}[i], ref)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "compare-commits: %v\n", err)
+			return 1
+		}
+		if !*keepDir {
+			defer side.remove()
+		}
+		sides[i] = side
+	}
+	fmt.Fprintf(os.Stderr, "old %s (%s), new %s (%s)\n", sides[0].sha[:12], sides[0].ref, sides[1].sha[:12], sides[1].ref)
+
+	var results []BenchmarkResult
+	var rows []commitDelta
+	for _, tc := range benchCases() {
+		name := tc.Test + "/" + tc.Mode
+		if filter != nil && !filter.MatchString(name) {
+			continue
+		}
+		row, rs := compareCase(work, sides, tc, *n, *rounds, *reps, *protocol)
+		rows = append(rows, row)
+		results = append(results, rs...)
+	}
+
+	fmt.Printf("%-30s %12s %12s %8s %9s  %s\n", "case", "old median", "new median", "delta", "p", "verdict")
+	for _, r := range rows {
+		if r.Error != "" {
+			fmt.Printf("%-30s %s\n", r.Case, r.Error)
+			continue
+		}
+		note := r.Verdict
+		if r.SameCode {
+			note += " (identical generated code)"
+		}
+		fmt.Printf("%-30s %12s %12s %+7.1f%% %9.2g  %s\n", r.Case,
+			time.Duration(r.OldMedian), time.Duration(r.NewMedian), r.Delta*100, r.P, note)
+	}
+
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "compare-commits: %v\n", err)
+			return 1
+		}
+		enc := json.NewEncoder(f)
+		for _, r := range results {
+			enc.Encode(r)
+		}
+		if err := f.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "compare-commits: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// commitSide is one revision checked out as a detached git worktree.
+type commitSide struct {
+	name, ref, sha, dir string
+}
+
+func checkoutSide(work, name, ref string) (commitSide, error) {
+	out, err := exec.Command("git", "rev-parse", "--verify", ref+"^{commit}").Output()
+	if err != nil {
+		return commitSide{}, fmt.Errorf("unknown revision %q", ref)
+	}
+	side := commitSide{name: name, ref: ref, sha: strings.TrimSpace(string(out)), dir: filepath.Join(work, name)}
+	if out, err := exec.Command("git", "worktree", "add", "--detach", side.dir, side.sha).CombinedOutput(); err != nil {
+		return commitSide{}, fmt.Errorf("git worktree add %s: %v\n%s", ref, err, out)
+	}
+	return side, nil
+}
+
+func (s commitSide) remove() {
+	exec.Command("git", "worktree", "remove", "--force", s.dir).Run()
+}
+
+// commitDelta is one row of the report.
+type commitDelta struct {
+	Case      string
+	OldMedian int64
+	NewMedian int64
+	Delta     float64
+	P         float64
+	Verdict   string
+	SameCode  bool
+	Error     string
+}
+
+// compareCase builds tc from both sides and alternates their binaries,
+// swapping which runs first each round so drift affects both equally.
+func compareCase(work string, sides [2]commitSide, tc benchCase, n, rounds, reps int, protocol string) (commitDelta, []BenchmarkResult) {
+	row := commitDelta{Case: tc.Test + "/" + tc.Mode}
+	var binaries [2]string
+	var code [2][]byte
+	for i, side := range sides {
+		binary, output, err := buildCaseAt(side.dir, filepath.Join(work, "build", side.name), tc, n)
+		if err != nil {
+			row.Error = fmt.Sprintf("%s: %v", side.name, err)
+			return row, nil
+		}
+		binaries[i], code[i] = binary, output
+	}
+	row.SameCode = bytes.Equal(code[0], code[1])
+
+	var samples [2][]int64
+	for round := 0; round < rounds; round++ {
+		order := []int{0, 1}
+		if round%2 == 1 {
+			order = []int{1, 0}
+		}
+		for _, i := range order {
+			run, err := runProgram(binaries[i], runEnv{}, reps, tc.Measure, protocol, 3)
+			if err != nil {
+				row.Error = fmt.Sprintf("%s: run failed: %v", sides[i].name, err)
+				return row, nil
+			}
+			samples[i] = append(samples[i], run.Times...)
+		}
+	}
+
+	var results []BenchmarkResult
+	var floats [2][]float64
+	for i, side := range sides {
+		stats := summarize(samples[i])
+		results = append(results, BenchmarkResult{
+			Commit: side.sha, Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Backend: "go", Test: tc.Test, Mode: tc.Mode, Parallel: tc.Parallel, N: n,
+			MeanNs: stats.Mean, StdNs: stats.Std, MedianNs: stats.Median, P99Ns: stats.P99,
+			Protocol: protocol, Samples: samples[i], LatencyHDR: hdrOf(samples[i]).encode(), SchemaVersion: runSchemaVersion,
+		})
+		for _, t := range samples[i] {
+			floats[i] = append(floats[i], float64(t))
+		}
+	}
+
+	row.OldMedian, row.NewMedian = results[0].MedianNs, results[1].MedianNs
+	row.Delta = float64(row.NewMedian-row.OldMedian) / float64(row.OldMedian)
+	_, row.P, _ = mannWhitney(floats[0], floats[1])
+	switch {
+	case math.IsNaN(row.P) || row.P >= 0.05:
+		row.Verdict = "no significant change"
+	case row.NewMedian > row.OldMedian:
+		row.Verdict = "slower"
+	default:
+		row.Verdict = "faster"
+	}
+	return row, results
+}
+
+// buildCaseAt generates tc with the generator checked out at src and builds
+// it under buildDir, returning the binary and the generated fragment.
+func buildCaseAt(src, buildDir string, tc benchCase, n int) (string, []byte, error) {
+	output, err := generateCase(src, tc, n)
+	if err != nil {
+		return "", nil, fmt.Errorf("codegen failed: %v", err)
+	}
+	var runtime []string
+	for _, rt := range tc.Runtime {
+		runtime = append(runtime, filepath.Join(src, rt))
+	}
+	prefix := filepath.Join(buildDir, tc.Test+"_"+tc.Mode, "go_bench")
+	if err := os.MkdirAll(filepath.Dir(prefix), 0755); err != nil {
+		return "", nil, err
+	}
+	sources, err := writeProgram(prefix, output, runtime)
+	if err != nil {
+		return "", nil, err
+	}
+	build, err := buildCommand(tc, prefix, sources)
+	if err != nil {
+		return "", nil, fmt.Errorf("build failed: %v", err)
+	}
+	if out, err := build.CombinedOutput(); err != nil {
+		return "", nil, fmt.Errorf("build failed: %v: %s", err, firstLine(out))
+	}
+	return prefix, output, nil
+}
+
+func firstLine(b []byte) string {
+	s := strings.TrimSpace(string(b))
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// `history prune` and `history compact` bound a long-lived history, in the
+// SQLite database or in NDJSON results files. prune keeps the newest -keep
+// results of every benchmark; compact replaces each benchmark's results of
+// a day older than -days with one daily aggregate, so old history still
+// charts and analyzes at a day's resolution. Both group results into
+// benchmarks as analyze does (see historySeries), across commits and OSes.
+
+// retainHistory runs prune (keep > 0 results per benchmark) or compact
+// (results older than days) over files, the NDJSON results files or
+// directories named, or else the database db.
+func retainHistory(command, db string, files []string, keep, days int, dryRun bool) int {
+	var results []BenchmarkResult
+	var parsed []historyFile
+	var h *historyStore
+	var err error
+	if len(files) > 0 {
+		parsed, results, err = readHistoryFiles(files)
+	} else if h, err = openHistory(db); err == nil {
+		results, err = h.Query(historyQuery{})
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "history: %v\n", err)
+		return 1
+	}
+
+	var plan historyPlan
+	if command == "prune" {
+		plan = planPrune(results, keep)
+	} else {
+		plan = planCompact(results, time.Now().AddDate(0, 0, -days))
+	}
+	if !dryRun {
+		switch {
+		case plan.empty():
+		case h != nil:
+			err = compactDB(h, results, plan)
+		default:
+			err = compactFiles(parsed, plan)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "history: %v\n", err)
+			return 1
+		}
+	}
+	done := map[bool]string{true: "would have ", false: ""}[dryRun]
+	if command == "prune" {
+		fmt.Fprintf(os.Stderr, "history prune: %sdropped %d of %d results\n", done, len(plan.drop), len(results))
+	} else {
+		fmt.Fprintf(os.Stderr, "history compact: %scompacted %d of %d results into %d daily aggregates\n", done, len(plan.drop)+len(plan.replace), len(results), len(plan.replace))
+	}
+	return 0
+}
+
+// dailyAggregate marks a result compact wrote in place of Runs measured
+// results of one benchmark on Day (UTC), and Failed failed or skipped
+// ones it dropped.
+type dailyAggregate struct {
+	Day     string   `json:"day"`
+	Runs    int      `json:"runs"`
+	Failed  int      `json:"failed,omitempty"`
+	First   string   `json:"first"`
+	Last    string   `json:"last"`
+	Commits []string `json:"commits"`
+}
+
+// historyPlan is how prune or compact changes a list of results: the
+// indexes to drop and the results to put in place of others.
+type historyPlan struct {
+	drop    map[int]bool
+	replace map[int]BenchmarkResult
+}
+
+func (p historyPlan) empty() bool {
+	return len(p.drop) == 0 && len(p.replace) == 0
+}
+
+// benchmarkGroups splits the indexes of results into benchmarks, each in
+// timestamp order.
+func benchmarkGroups(results []BenchmarkResult) [][]int {
+	byKey := map[mergeKey][]int{}
+	var keys []mergeKey
+	for i, r := range results {
+		k := mergeKeyOf(r)
+		k.Commit, k.OS = "", ""
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], i)
+	}
+	groups := make([][]int, 0, len(keys))
+	for _, k := range keys {
+		g := byKey[k]
+		sort.SliceStable(g, func(i, j int) bool { return results[g[i]].Timestamp < results[g[j]].Timestamp })
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// planPrune drops all but the newest keep results of each benchmark.
+func planPrune(results []BenchmarkResult, keep int) historyPlan {
+	plan := historyPlan{drop: map[int]bool{}}
+	for _, g := range benchmarkGroups(results) {
+		for _, i := range g[:max(len(g)-keep, 0)] {
+			plan.drop[i] = true
+		}
+	}
+	return plan
+}
+
+// planCompact merges each benchmark's results of a UTC day before cutoff
+// into one aggregate, kept in the place of the day's last result. Days
+// holding one result are left as they are; a day with no measured result
+// keeps only its last failure.
+func planCompact(results []BenchmarkResult, cutoff time.Time) historyPlan {
+	plan := historyPlan{drop: map[int]bool{}, replace: map[int]BenchmarkResult{}}
+	for _, g := range benchmarkGroups(results) {
+		var day string
+		var members []int
+		flush := func() {
+			if len(members) > 1 {
+				last := members[len(members)-1]
+				agg, ok := aggregateDay(results, members, day)
+				for _, i := range members {
+					plan.drop[i] = true
+				}
+				delete(plan.drop, last)
+				if ok {
+					plan.replace[last] = agg
+				}
+			}
+			members = nil
+		}
+		for _, i := range g {
+			t, err := time.Parse(time.RFC3339, results[i].Timestamp)
+			if err != nil || !t.Before(cutoff) {
+				continue
+			}
+			if d := t.UTC().Format(time.DateOnly); d != day {
+				flush()
+				day = d
+			}
+			members = append(members, i)
+		}
+		flush()
+	}
+	return plan
+}
+
+// aggregateDay summarizes the results at members, all of one benchmark
+// and day, oldest first. Earlier aggregates count with their runs. It
+// returns false when none of them was measured.
+func aggregateDay(results []BenchmarkResult, members []int, day string) (BenchmarkResult, bool) {
+	var measured []BenchmarkResult
+	agg := &dailyAggregate{Day: day}
+	seen := map[string]bool{}
+	for _, i := range members {
+		r := results[i]
+		runs, failed, first, commits := 1, 0, r.Timestamp, []string{r.Commit}
+		if a := r.Aggregate; a != nil {
+			runs, failed, first, commits = a.Runs, a.Failed, a.First, a.Commits
+		}
+		if !r.measured() {
+			agg.Failed++
+			continue
+		}
+		measured = append(measured, r)
+		agg.Runs += runs
+		agg.Failed += failed
+		if agg.First == "" {
+			agg.First = first
+		}
+		agg.Last = r.Timestamp
+		for _, c := range commits {
+			if !seen[c] {
+				seen[c] = true
+				agg.Commits = append(agg.Commits, c)
+			}
+		}
+	}
+	if len(measured) == 0 {
+		return BenchmarkResult{}, false
+	}
+
+	// The latest run describes the build and machine
+	out := measured[len(measured)-1]
+	var mean, cpu, codegen, compile, warmup, measure, variance float64
+	medians := make([]int64, 0, len(measured))
+	out.P99Ns = 0
+	for _, r := range measured {
+		w := float64(r.aggregateRuns()) / float64(agg.Runs)
+		mean += w * float64(r.MeanNs)
+		cpu += w * float64(r.CPUNs)
+		codegen += w * r.CodegenMs
+		compile += w * r.CompileMs
+		warmup += w * r.WarmupMs
+		measure += w * r.MeasureMs
+		medians = append(medians, r.MedianNs)
+		out.P99Ns = max(out.P99Ns, r.P99Ns)
+	}
+	for _, r := range measured {
+		w := float64(r.aggregateRuns()) / float64(agg.Runs)
+		d := float64(r.MeanNs) - mean
+		variance += w * (float64(r.StdNs)*float64(r.StdNs) + d*d)
+	}
+	sort.Slice(medians, func(i, j int) bool { return medians[i] < medians[j] })
+	out.MeanNs = int64(math.Round(mean))
+	out.StdNs = int64(math.Round(math.Sqrt(variance)))
+	out.MedianNs = medians[len(medians)/2]
+	out.CPUNs = int64(math.Round(cpu))
+	out.CodegenMs, out.CompileMs = codegen, compile
+	out.WarmupMs, out.MeasureMs = warmup, measure
+	// Per-run detail that no longer describes the aggregate
+	out.RunID, out.Samples, out.LatencyHDR = "", nil, ""
+	out.Binary, out.Artifacts, out.BuildCached = "", nil, false
+	out.MachineBefore, out.MachineAfter, out.CooldownNs = nil, nil, 0
+	out.Perf, out.Sched, out.Energy = nil, nil, nil
+	out.Aggregate = agg
+	return out, true
+}
+
+// aggregateRuns is the number of runs r stands for.
+func (r BenchmarkResult) aggregateRuns() int {
+	if r.Aggregate != nil {
+		return r.Aggregate.Runs
+	}
+	return 1
+}
+
+// Rewrite removes results and inserts add in one transaction. Rows are
+// matched by the table's unique key.
+func (h *historyStore) Rewrite(remove, add []BenchmarkResult) error {
+	var b strings.Builder
+	b.WriteString("BEGIN;\n")
+	for _, r := range remove {
+		fmt.Fprintf(&b, "DELETE FROM results WHERE commit_sha = %s AND timestamp = %s AND backend = %s AND test = %s AND mode = %s AND n = %d;\n",
+			sqlQuote(r.Commit), sqlQuote(r.Timestamp), sqlQuote(r.Backend), sqlQuote(r.Test), sqlQuote(r.Mode), r.N)
+	}
+	for _, r := range add {
+		if err := writeInsert(&b, r); err != nil {
+			return err
+		}
+	}
+	b.WriteString("COMMIT;\nVACUUM;\n")
+	_, err := h.exec(b.String())
+	return err
+}
+
+// compactDB applies plan to the database's results.
+func compactDB(h *historyStore, results []BenchmarkResult, plan historyPlan) error {
+	var remove, add []BenchmarkResult
+	for i, r := range results {
+		if plan.drop[i] {
+			remove = append(remove, r)
+		} else if agg, ok := plan.replace[i]; ok {
+			remove = append(remove, r)
+			add = append(add, agg)
+		}
+	}
+	return h.Rewrite(remove, add)
+}
+
+// historyFile is an NDJSON results file read for prune or compact: its
+// lines, and for each result read from it the line it came from.
+type historyFile struct {
+	path  string
+	lines []string
+	at    map[int]int // result index to line
+}
+
+// readHistoryFiles reads the results of the NDJSON files in paths, each a
+// file or a directory of them.
+func readHistoryFiles(paths []string) ([]historyFile, []BenchmarkResult, error) {
+	var files []historyFile
+	var results []BenchmarkResult
+	for _, path := range resultPaths(paths) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		hf := historyFile{path: path, at: map[int]int{}}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			hf.lines = append(hf.lines, line)
+			var kind struct {
+				Record string `json:"record"`
+			}
+			trimmed := []byte(strings.TrimSpace(line))
+			if len(trimmed) == 0 || json.Unmarshal(trimmed, &kind) != nil || kind.Record != "" {
+				continue
+			}
+			r, err := decodeResult(trimmed)
+			if err != nil {
+				continue
+			}
+			hf.at[len(results)] = len(hf.lines) - 1
+			results = append(results, r)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		files = append(files, hf)
+	}
+	return files, results, nil
+}
+
+// compactFiles applies plan to the files the results came from, rewriting
+// each in place. Unchanged lines are kept byte for byte; a file left with
+// no results is removed.
+func compactFiles(files []historyFile, plan historyPlan) error {
+	for _, hf := range files {
+		changed := map[int]*string{}
+		remaining := len(hf.at)
+		for i, line := range hf.at {
+			if plan.drop[i] {
+				changed[line] = nil
+				remaining--
+			} else if agg, ok := plan.replace[i]; ok {
+				data, err := json.Marshal(agg)
+				if err != nil {
+					return err
+				}
+				s := string(data)
+				changed[line] = &s
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		if remaining == 0 {
+			if err := os.Remove(hf.path); err != nil {
+				return err
+			}
+			continue
+		}
+		err := writeAtomic(hf.path, 0644, func(w io.Writer) error {
+			for n, line := range hf.lines {
+				if s, ok := changed[n]; ok {
+					if s == nil {
+						continue
+					}
+					line = *s
+				}
+				if _, err := io.WriteString(w, line+"\n"); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resultPaths expands the directories among paths to the NDJSON files in
+// them.
+func resultPaths(paths []string) []string {
+	var out []string
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			matches, _ := filepath.Glob(filepath.Join(p, "*.ndjson"))
+			out = append(out, matches...)
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// runCompare implements `compare`: it tests, per benchmark, whether run B's
+// raw samples differ from run A's, with Mann-Whitney U (default) or Welch's
+// t-test, and reports the p-value and an effect size.
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	test := fs.String("test", "mw", "statistical test: mw (Mann-Whitney U) or welch (Welch's t)")
+	alpha := fs.Float64("alpha", 0.05, "significance level")
+	asJSON := fs.Bool("json", false, "print one JSON object per benchmark instead of a table")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench compare [-test mw|welch] [-alpha 0.05] a.ndjson b.ndjson\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 || (*test != "mw" && *test != "welch") {
+		fs.Usage()
+		return 2
+	}
+
+	a, err := readResults(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compare: %v\n", err)
+		return 1
+	}
+	b, err := readResults(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compare: %v\n", err)
+		return 1
+	}
+
+	comparisons := compareRuns(a, b, *test, *alpha)
+	if len(comparisons) == 0 {
+		fmt.Fprintln(os.Stderr, "compare: no benchmark appears in both files")
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, c := range comparisons {
+			enc.Encode(c)
+		}
+		return 0
+	}
+	fmt.Printf("%-44s %4s %4s %12s %12s %8s %9s %7s  %s\n", "benchmark", "nA", "nB", "median A", "median B", "change", "p", "effect", "verdict")
+	for _, c := range comparisons {
+		fmt.Printf("%-44s %4d %4d %12s %12s %+7.1f%% %9.2g %+7.2f  %s\n",
+			c.Benchmark, c.NA, c.NB, time.Duration(c.MedianA), time.Duration(c.MedianB),
+			c.Change*100, c.P, c.Effect, c.Verdict)
+	}
+	return 0
+}
+
+// comparison is the outcome for one benchmark. Effect is the rank-biserial
+// correlation for Mann-Whitney and Cohen's d for Welch; positive means B is
+// slower.
+type comparison struct {
+	Benchmark string  `json:"benchmark"`
+	Test      string  `json:"test"`
+	NA        int     `json:"n_a"`
+	NB        int     `json:"n_b"`
+	MedianA   int64   `json:"median_a_ns"`
+	MedianB   int64   `json:"median_b_ns"`
+	Change    float64 `json:"change"`
+	Statistic float64 `json:"statistic"`
+	P         float64 `json:"p"`
+	Effect    float64 `json:"effect"`
+	Verdict   string  `json:"verdict"`
+}
+
+// resultSamples returns the raw per-iteration timings of a result, or its
+// mean as a single sample for records written before samples were kept.
+func resultSamples(r BenchmarkResult) []int64 {
+	if len(r.Samples) > 0 {
+		return r.Samples
+	}
+	return []int64{r.MeanNs}
+}
+
+func compareRuns(a, b []BenchmarkResult, test string, alpha float64) []comparison {
+	pool := func(results []BenchmarkResult) map[string][]float64 {
+		m := map[string][]float64{}
+		for _, r := range results {
+			if !r.measured() || r.MeanNs <= 0 {
+				continue
+			}
+			// A -procs-sweep level and a -compare-binary record are
+			// benchmarks of their own, not more samples of the run's
+			name := fmt.Sprintf("%s/%s/%s n=%d", r.Backend, r.Test, r.Mode, r.N)
+			if procs := sweepLevel(r); procs > 0 {
+				name += fmt.Sprintf(" GOMAXPROCS=%d", procs)
+			}
+			if r.Binary != "" {
+				name += " binary=" + r.Binary
+			}
+			for _, t := range resultSamples(r) {
+				m[name] = append(m[name], float64(t))
+			}
+		}
+		return m
+	}
+	sa, sb := pool(a), pool(b)
+
+	var out []comparison
+	for name, xa := range sa {
+		xb, ok := sb[name]
+		if !ok {
+			continue
+		}
+		c := comparison{Benchmark: name, Test: test, NA: len(xa), NB: len(xb)}
+		c.MedianA, c.MedianB = int64(medianFloat(xa)), int64(medianFloat(xb))
+		c.Change = float64(c.MedianB-c.MedianA) / float64(c.MedianA)
+		if test == "welch" {
+			c.Statistic, c.P, c.Effect = welchTest(xa, xb)
+		} else {
+			c.Statistic, c.P, c.Effect = mannWhitney(xa, xb)
+		}
+		switch {
+		case math.IsNaN(c.P) || len(xa) < 2 || len(xb) < 2:
+			c.Verdict = "too few samples"
+		case c.P >= alpha:
+			c.Verdict = "no significant change"
+		case c.MedianB > c.MedianA:
+			c.Verdict = "slower"
+		default:
+			c.Verdict = "faster"
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Benchmark < out[j].Benchmark })
+	return out
+}
+
+func medianFloat(v []float64) float64 {
+	s := append([]float64(nil), v...)
+	sort.Float64s(s)
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}
+
+// mannWhitney returns U for sample b, the two-sided p-value from the normal
+// approximation with tie correction, and the rank-biserial correlation.
+func mannWhitney(a, b []float64) (u, p, effect float64) {
+	type obs struct {
+		v     float64
+		fromB bool
+	}
+	all := make([]obs, 0, len(a)+len(b))
+	for _, v := range a {
+		all = append(all, obs{v, false})
+	}
+	for _, v := range b {
+		all = append(all, obs{v, true})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	n := n1 + n2
+	var rankB, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // average of ranks i+1..j
+		for k := i; k < j; k++ {
+			if all[k].fromB {
+				rankB += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	u = rankB - n2*(n2+1)/2
+	mean := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	effect = 2*u/(n1*n2) - 1
+	if sigma == 0 {
+		return u, math.NaN(), effect
+	}
+	// Continuity correction towards the mean
+	z := (math.Abs(u-mean) - 0.5) / sigma
+	if z < 0 {
+		z = 0
+	}
+	return u, math.Erfc(z / math.Sqrt2), effect
+}
+
+// welchTest returns t for mean(b) - mean(a), its two-sided p-value with
+// Welch-Satterthwaite degrees of freedom, and Cohen's d.
+func welchTest(a, b []float64) (t, p, d float64) {
+	ma, va := meanVar(a)
+	mb, vb := meanVar(b)
+	na, nb := float64(len(a)), float64(len(b))
+
+	se2 := va/na + vb/nb
+	pooled := math.Sqrt((va + vb) / 2)
+	if pooled > 0 {
+		d = (mb - ma) / pooled
+	}
+	if se2 == 0 || len(a) < 2 || len(b) < 2 {
+		return 0, math.NaN(), d
+	}
+	t = (mb - ma) / math.Sqrt(se2)
+	df := se2 * se2 / ((va/na)*(va/na)/(na-1) + (vb/nb)*(vb/nb)/(nb-1))
+	// Two-sided tail of Student's t via the regularised incomplete beta
+	p = regIncBeta(df/2, 0.5, df/(df+t*t))
+	return t, p, d
+}
+
+// meanVar returns the mean and unbiased sample variance.
+func meanVar(v []float64) (mean, variance float64) {
+	for _, x := range v {
+		mean += x
+	}
+	mean /= float64(len(v))
+	if len(v) < 2 {
+		return mean, 0
+	}
+	for _, x := range v {
+		variance += (x - mean) * (x - mean)
+	}
+	return mean, variance / float64(len(v)-1)
+}
+
+// regIncBeta is the regularised incomplete beta function I_x(a, b),
+// evaluated with Lentz's continued fraction.
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	if x > (a+1)/(a+b+2) {
+		return 1 - regIncBeta(b, a, 1-x)
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab-la-lb+a*math.Log(x)+b*math.Log(1-x)) / a
+
+	const tiny, eps = 1e-300, 1e-14
+	f, c, d := 1.0, 1.0, 0.0
+	for i := 0; i <= 300; i++ {
+		m := float64(i / 2)
+		var num float64
+		switch {
+		case i == 0:
+			num = 1
+		case i%2 == 0:
+			num = m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		default:
+			num = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		}
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		d = 1 / d
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		f *= c * d
+		if math.Abs(1-c*d) < eps {
+			return front * (f - 1)
+		}
+	}
+	return front * (f - 1)
+}
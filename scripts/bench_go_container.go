@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// -container builds and runs each host case inside a pinned container image
+// through the Docker or Podman CLI, with fixed CPU and memory limits and the
+// image's Go toolchain, so a run can be reproduced elsewhere from the image
+// digest recorded in its results. The working directory, which holds the
+// generated sources and built binaries, is mounted at containerDir; build
+// and run times include container startup, and CPU time is not measured, as
+// the local process is only the engine's client.
+
+const containerDir = "/bench"
+
+// containerCache is the named volume holding the build cache across cases.
+const containerCache = "pcs-bench-gocache"
+
+// containerRunner runs binaries in Image under Engine.
+type containerRunner struct {
+	Engine string
+	Image  string
+	Digest string
+	CPUs   string // --cpus, e.g. 2
+	Memory string // --memory, e.g. 2g
+	// Pin is the CPU list from -cpus, applied as --cpuset-cpus
+	Pin string
+	// Root is the working directory mounted at containerDir
+	Root string
+}
+
+// newContainerRunner resolves the engine (docker, else podman, when empty)
+// and the image's digest, pulling the image if it is not present.
+func newContainerRunner(engine, image, cpus, memory, pin string) (*containerRunner, error) {
+	if engine == "" {
+		engine = "docker"
+		if _, err := exec.LookPath(engine); err != nil {
+			engine = "podman"
+		}
+	}
+	if _, err := exec.LookPath(engine); err != nil {
+		return nil, err
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	c := &containerRunner{Engine: engine, Image: image, CPUs: cpus, Memory: memory, Pin: pin, Root: root}
+	digest, err := c.digest()
+	if err != nil {
+		if out, err := exec.Command(engine, "pull", image).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("%s pull %s: %v: %s", engine, image, err, firstLine(out))
+		}
+		if digest, err = c.digest(); err != nil {
+			return nil, err
+		}
+	}
+	c.Digest = digest
+	return c, nil
+}
+
+// digest is the image's repository digest, or its ID for a local image.
+func (c *containerRunner) digest() (string, error) {
+	out, err := exec.Command(c.Engine, "image", "inspect", "--format", "{{if .RepoDigests}}{{index .RepoDigests 0}}{{else}}{{.Id}}{{end}}", c.Image).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s image inspect %s: %v", c.Engine, c.Image, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// path is where the local path p appears in the container.
+func (c *containerRunner) path(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(c.Root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is outside the mounted %s", p, c.Root)
+	}
+	return containerDir + "/" + filepath.ToSlash(rel), nil
+}
+
+// run is the engine command line running args in the image; opts are
+// further engine options.
+func (c *containerRunner) run(opts []string, args ...string) []string {
+	argv := []string{c.Engine, "run", "--rm", "-i", "-v", c.Root + ":" + containerDir, "-w", containerDir}
+	if c.CPUs != "" {
+		argv = append(argv, "--cpus", c.CPUs)
+	}
+	if c.Memory != "" {
+		argv = append(argv, "--memory", c.Memory)
+	}
+	if c.Pin != "" {
+		argv = append(argv, "--cpuset-cpus", c.Pin)
+	}
+	argv = append(argv, opts...)
+	return append(append(argv, c.Image), args...)
+}
+
+// build is the go build of binary from sources with the image's toolchain.
+func (c *containerRunner) build(tc benchCase, binary string, sources []string) (*exec.Cmd, error) {
+	out, err := c.path(binary)
+	if err != nil {
+		return nil, err
+	}
+	var in []string
+	for _, s := range sources {
+		p, err := c.path(s)
+		if err != nil {
+			return nil, err
+		}
+		in = append(in, p)
+	}
+	cache := []string{"-v", containerCache + ":/root/.cache/go-build"}
+	argv := c.run(cache, append([]string{"go"}, buildArgs(out, tc.BuildFlags, in)...)...)
+	return commandContext(argv[0], argv[1:]...), nil
+}
+
+func (c *containerRunner) cleanup(binary string) {}
+
+func (c *containerRunner) local() bool { return false }
+
+// prepare checks that binary is inside the mounted directory.
+func (c *containerRunner) prepare(binary, name string) error {
+	_, err := c.path(binary)
+	return err
+}
+
+// argv runs binary through the mount. Pinning comes from Pin rather than
+// wrap, as taskset is not assumed in the image.
+func (c *containerRunner) argv(binary string, env, wrap, args []string) []string {
+	path, _ := c.path(binary) // checked by prepare
+	var opts []string
+	for _, kv := range env {
+		opts = append(opts, "-e", kv)
+	}
+	return c.run(opts, append([]string{path}, args...)...)
+}
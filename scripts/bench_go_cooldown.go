@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// cooldown is the pause before each measured run after the first, so heat
+// and load left behind by a heavy case do not penalize the next one. It is
+// either a fixed duration or adaptive: poll the 1-minute load average until
+// it drops to MaxLoad, giving up after MaxWait.
+type cooldown struct {
+	Fixed    time.Duration
+	Adaptive bool
+	MaxLoad  float64
+	MaxWait  time.Duration
+}
+
+// parseCooldown accepts a Go duration ("5s", "0" for none) or "adaptive".
+func parseCooldown(s string, maxLoad float64, maxWait time.Duration) (cooldown, error) {
+	if s == "adaptive" {
+		if sampleMachine() == nil {
+			return cooldown{}, fmt.Errorf("adaptive cooldown needs the load average, which this platform does not expose")
+		}
+		if maxLoad < 0 || maxWait <= 0 {
+			return cooldown{}, fmt.Errorf("adaptive cooldown needs a non-negative load and a positive maximum wait")
+		}
+		return cooldown{Adaptive: true, MaxLoad: maxLoad, MaxWait: maxWait}, nil
+	}
+	if s == "0" || s == "" {
+		return cooldown{}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return cooldown{}, fmt.Errorf("invalid cooldown %q (want a duration such as 5s, or adaptive)", s)
+	}
+	return cooldown{Fixed: d}, nil
+}
+
+// wait pauses and returns how long it waited; an interrupt ends it early.
+func (c cooldown) wait() time.Duration {
+	start := time.Now()
+	if !c.Adaptive {
+		sleep(c.Fixed)
+		return time.Since(start)
+	}
+	const poll = time.Second
+	for {
+		m := sampleMachine()
+		if m == nil || m.Load1 <= c.MaxLoad || interrupted() {
+			break
+		}
+		if time.Since(start)+poll > c.MaxWait {
+			fmt.Fprintf(os.Stderr, "cooldown: load average still %.2f after %s\n", m.Load1, c.MaxWait)
+			break
+		}
+		sleep(poll)
+	}
+	return time.Since(start)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Results name the CPU model they ran on, so runs on different machines of
+// the same architecture are not compared as if they were alike. CPU_INFO
+// still overrides it, e.g. for CI runners whose model varies between jobs.
+
+// cpuModel reads the CPU model name: /proc/cpuinfo on Linux, sysctl on
+// macOS, the registry on Windows. It is empty where none can be read.
+func cpuModel() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return commandOutput("sysctl", "-n", "machdep.cpu.brand_string")
+	case "windows":
+		out := commandOutput("reg", "query", `HKLM\HARDWARE\DESCRIPTION\System\CentralProcessor\0`, "/v", "ProcessorNameString")
+		// ProcessorNameString    REG_SZ    <model>
+		if _, model, ok := strings.Cut(out, "REG_SZ"); ok {
+			return strings.TrimSpace(model)
+		}
+		return ""
+	}
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	// ARM kernels report no model name, only the board or SoC, if anything
+	fields := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if key = strings.TrimSpace(key); ok && fields[key] == "" {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	for _, key := range []string{"model name", "Hardware", "Model", "cpu model"} {
+		if fields[key] != "" {
+			return fields[key]
+		}
+	}
+	return ""
+}
+
+// cpuName is the cpu field of results: CPU_INFO, else the detected model,
+// else GOARCH.
+func cpuName() string {
+	if v := os.Getenv("CPU_INFO"); v != "" {
+		return v
+	}
+	if model := cpuModel(); model != "" {
+		return model
+	}
+	return runtime.GOARCH
+}
+
+// countCores reads the physical and logical core counts where
+// detectTopology cannot map them (macOS, Windows). The result has no
+// per-core CPU lists, so it describes the machine but cannot pin.
+func countCores() *cpuTopology {
+	var physical, logical string
+	switch runtime.GOOS {
+	case "darwin":
+		physical = commandOutput("sysctl", "-n", "hw.physicalcpu")
+		logical = commandOutput("sysctl", "-n", "hw.logicalcpu")
+	case "windows":
+		out := commandOutput("powershell", "-NoProfile", "-Command",
+			"$p = Get-CimInstance Win32_Processor; "+
+				"($p | Measure-Object NumberOfCores -Sum).Sum; "+
+				"($p | Measure-Object NumberOfLogicalProcessors -Sum).Sum")
+		physical, logical, _ = strings.Cut(out, "\n")
+	default:
+		return nil
+	}
+	p, err1 := strconv.Atoi(strings.TrimSpace(physical))
+	l, err2 := strconv.Atoi(strings.TrimSpace(logical))
+	if err1 != nil || err2 != nil || p <= 0 || l < p {
+		return nil
+	}
+	return &cpuTopology{Logical: l, Physical: p, ThreadsPerCore: (l + p - 1) / p}
+}
+
+// commandOutput is the trimmed output of a command, or empty if it failed.
+func commandOutput(name string, args ...string) string {
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
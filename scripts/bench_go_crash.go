@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// A generated program that panics, hits a fatal runtime error or dies of
+// a signal fails as errCrash rather than a bare runtime_failed: the Go
+// runtime's report on stderr is parsed into a crashReport in the result's
+// error_detail, with the kind of crash, the panic message and the stack of
+// the goroutine that crashed, so a nil map write in a sharded merge and an
+// index out of range in a presized list can be told apart, and found,
+// without rerunning the case.
+
+// errCrash: the benchmark process panicked, hit a fatal runtime error or
+// was killed by SIGSEGV, SIGBUS, SIGFPE, SIGILL or SIGABRT
+const errCrash = "crashed"
+
+// Kinds of crash, by the message the Go runtime reports it with. A panic
+// or fatal error matching none of them is crashPanic or crashFatal.
+const (
+	crashNilMapWrite    = "nil_map_write"
+	crashIndexRange     = "index_out_of_range"
+	crashConcurrentMap  = "concurrent_map_write"
+	crashNilDereference = "nil_dereference"
+	crashDivideByZero   = "divide_by_zero"
+	crashStackOverflow  = "stack_overflow"
+	crashDeadlock       = "deadlock"
+	crashPanic          = "panic"
+	crashFatal          = "fatal_error"
+	// crashSignal: killed by a signal without a Go report, as a Rust or
+	// Julia program is
+	crashSignal = "signal"
+)
+
+// crashKinds maps a fragment of the runtime's message to its kind, in
+// the order they are tried.
+var crashKinds = []struct{ fragment, kind string }{
+	{"assignment to entry in nil map", crashNilMapWrite},
+	{"index out of range", crashIndexRange},
+	{"slice bounds out of range", crashIndexRange},
+	{"concurrent map", crashConcurrentMap},
+	{"nil pointer dereference", crashNilDereference},
+	{"integer divide by zero", crashDivideByZero},
+	{"stack overflow", crashStackOverflow},
+	{"all goroutines are asleep", crashDeadlock},
+}
+
+// crashSignals are the signals a crash dies of; SIGKILL is the OOM
+// killer's (see runErrorClass) and SIGTERM and SIGINT the harness's own.
+var crashSignals = map[string]bool{
+	syscall.SIGSEGV.String(): true,
+	syscall.SIGBUS.String():  true,
+	syscall.SIGFPE.String():  true,
+	syscall.SIGILL.String():  true,
+	syscall.SIGABRT.String(): true,
+}
+
+// maxCrashFrames caps the frames kept of a crashed goroutine's stack;
+// unbounded recursion would otherwise keep thousands.
+const maxCrashFrames = 32
+
+// crashReport is what the Go runtime reported about a crash. Fatal marks
+// a fatal error, which no recover() stops, rather than a panic. Frames is
+// the crashed goroutine's stack, innermost first; Site is its innermost
+// frame outside the runtime, the line of generated or driver code that
+// crashed.
+type crashReport struct {
+	Kind      string       `json:"kind"`
+	Message   string       `json:"message,omitempty"`
+	Fatal     bool         `json:"fatal,omitempty"`
+	Signal    string       `json:"signal,omitempty"`
+	Goroutine int          `json:"goroutine,omitempty"`
+	Site      *crashFrame  `json:"site,omitempty"`
+	Frames    []crashFrame `json:"frames,omitempty"`
+	CreatedBy *crashFrame  `json:"created_by,omitempty"`
+}
+
+// crashFrame is one call in a stack. File is the source file's base name:
+// generated sources live in the case's artifacts directory, whatever path
+// they were built from.
+type crashFrame struct {
+	Func string `json:"func"`
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+var (
+	crashHeader    = regexp.MustCompile(`^(panic|fatal error): (.*)$`)
+	crashSignalRe  = regexp.MustCompile(`^\[signal (\w+)`)
+	crashGoroutine = regexp.MustCompile(`^goroutine (\d+)(?: gp=\S+ m=\S+(?: mp=\S+)?)? \[[^\]]*\]:$`)
+	crashLocation  = regexp.MustCompile(`^\t(.+?):(\d+)(?: .*)?$`)
+	crashCall      = regexp.MustCompile(`^(.+?)(?:\(.*\))?$`)
+)
+
+// parseCrash reads a crash from a failed process's stderr and the signal
+// it died of (empty if it exited). It returns nil when the process did
+// not crash: it exited without a runtime report, or ran out of memory,
+// which is errOOM.
+func parseCrash(stderr []byte, signal string) *crashReport {
+	lines := strings.Split(string(stderr), "\n")
+	var r *crashReport
+	i := 0
+	for ; i < len(lines); i++ {
+		m := crashHeader.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		message := strings.TrimSuffix(m[2], " [recovered]")
+		if strings.Contains(message, "out of memory") {
+			return nil
+		}
+		r = &crashReport{Kind: crashPanic, Message: message, Fatal: m[1] == "fatal error"}
+		if r.Fatal {
+			r.Kind = crashFatal
+		}
+		for _, k := range crashKinds {
+			if strings.Contains(message, k.fragment) {
+				r.Kind = k.kind
+				break
+			}
+		}
+		break
+	}
+	if r == nil {
+		if !crashSignals[signal] {
+			return nil
+		}
+		return &crashReport{Kind: crashSignal, Signal: signal}
+	}
+	// The first goroutine the runtime lists is the one that crashed
+	for i++; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if m := crashSignalRe.FindStringSubmatch(line); m != nil && r.Signal == "" {
+			r.Signal = m[1]
+			continue
+		}
+		if m := crashGoroutine.FindStringSubmatch(line); m != nil {
+			r.Goroutine, _ = strconv.Atoi(m[1])
+			r.Frames, r.CreatedBy = parseCrashStack(lines[i+1:])
+			break
+		}
+	}
+	for i := range r.Frames {
+		if f := r.Frames[i].Func; f != "panic" && !strings.HasPrefix(f, "runtime.") {
+			r.Site = &r.Frames[i]
+			break
+		}
+	}
+	return r
+}
+
+// parseCrashStack reads the frames of a goroutine's stack, up to the blank
+// line that ends it, and the frame that started the goroutine.
+func parseCrashStack(lines []string) ([]crashFrame, *crashFrame) {
+	var frames []crashFrame
+	var created *crashFrame
+	for i := 0; i < len(lines); i++ {
+		call := strings.TrimRight(lines[i], "\r")
+		if call == "" {
+			break
+		}
+		frame := crashFrame{}
+		name, isCreator := strings.CutPrefix(call, "created by ")
+		if isCreator {
+			name, _, _ = strings.Cut(name, " in goroutine ")
+			frame.Func = name
+		} else if m := crashCall.FindStringSubmatch(call); m != nil {
+			frame.Func = m[1]
+		}
+		if i+1 < len(lines) {
+			if m := crashLocation.FindStringSubmatch(strings.TrimRight(lines[i+1], "\r")); m != nil {
+				frame.File = filepath.Base(m[1])
+				frame.Line, _ = strconv.Atoi(m[2])
+				i++
+			}
+		}
+		if isCreator {
+			created = &frame
+		} else if len(frames) < maxCrashFrames {
+			frames = append(frames, frame)
+		}
+	}
+	return frames, created
+}
+
+// String is the report in one line, for the result's error message.
+func (r *crashReport) String() string {
+	s := "panic: " + r.Message
+	if r.Kind == crashSignal {
+		s = "killed by " + r.Signal
+	} else if r.Fatal {
+		s = "fatal error: " + r.Message
+	}
+	if r.Site != nil {
+		s += fmt.Sprintf(" in %s at %s:%d", r.Site.Func, r.Site.File, r.Site.Line)
+	}
+	return s
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A run may drive several backends (-backend go,rust,ts,julia): every
+// backend times the same snippets at the same sizes, in one process on one
+// machine snapshot and under one warmup protocol and estimator, so their
+// results differ only in the generated code and its runtime. The Go matrix
+// is run as is; the other backends run the portable cases of it, those
+// that need nothing Go-specific, as entries with Backend set, and the run
+// ends with a table comparing their means (see writeBackendTable).
+
+// parseBackends splits -backend into registered backend names.
+func parseBackends(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if _, err := lookupBackend(name); err != nil {
+			return nil, err
+		}
+		if contains(names, name) {
+			return nil, fmt.Errorf("%s listed twice", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// backend is the backend tc runs on: Backend, or go for the Go matrix.
+func (tc benchCase) backend() string {
+	if tc.Backend == "" {
+		return "go"
+	}
+	return tc.Backend
+}
+
+// caseBackend is the Backend of the cases a result with backend name
+// comes from.
+func caseBackend(name string) string {
+	if name == "go" {
+		return ""
+	}
+	return name
+}
+
+// portable reports whether tc is nothing but a snippet and the constructs
+// it requires, so any backend with those constructs can run it.
+func (tc benchCase) portable() bool {
+	return tc.Backend == "" && tc.Stream == "" && tc.Data == "" && tc.Measure == "" &&
+		tc.Toolchain == "" && tc.Target == "" && tc.Go.Cmd == "" && tc.GC == (gcSettings{}) &&
+		tc.Runtime == nil && tc.Flags == nil && tc.BuildFlags == nil
+}
+
+// backendCases returns the cases names run: the matrix itself for go and
+// a copy of its portable cases per other backend, their names suffixed
+// with the backend. After entries naming cases a backend does not run are
+// dropped; cases that Need one are left out.
+func backendCases(cases []benchCase, names []string) []benchCase {
+	portable := map[string]bool{}
+	for _, tc := range cases {
+		if tc.portable() {
+			portable[tc.name()] = true
+		}
+	}
+	var out []benchCase
+	for _, name := range names {
+		if name == "go" {
+			out = append(out, cases...)
+			continue
+		}
+		be, _ := lookupBackend(name)
+		suffix := "_" + name
+	copies:
+		for _, tc := range cases {
+			if !tc.portable() {
+				continue
+			}
+			for _, need := range tc.Needs {
+				if !portable[need] {
+					continue copies
+				}
+			}
+			var after []string
+			for _, a := range tc.After {
+				if portable[a] {
+					after = append(after, a)
+				}
+			}
+			tc.Backend, tc.Toolchain = name, be.Toolchain
+			tc.After = withSuffix(after, suffix)
+			tc.Needs = withSuffix(tc.Needs, suffix)
+			out = append(out, tc)
+		}
+	}
+	return out
+}
+
+// backendRow is one row of the comparison table: a case and size.
+type backendRow struct {
+	test, mode string
+	n          int
+}
+
+// writeBackendTable writes the mean of every measured result of the
+// portable cases per backend, in the order of names, with each mean's
+// ratio to the first backend's. Of several Go results for a row, the one
+// at the highest GOMAXPROCS (-procs-sweep) and else the first (the default
+// toolchain's, before -go-versions) is compared; cross-compiled, PGO and
+// previous binaries' results are left out.
+func writeBackendTable(w io.Writer, results []BenchmarkResult, names []string) {
+	chosen := map[backendRow]map[string]BenchmarkResult{}
+	var rows []backendRow
+	for _, r := range results {
+		if !r.measured() || r.Target != "" || r.PGO || r.Binary != "" || r.Backend == "go" && r.Toolchain != "gc" {
+			continue
+		}
+		row := backendRow{r.Test, r.Mode, r.N}
+		if chosen[row] == nil {
+			chosen[row] = map[string]BenchmarkResult{}
+			rows = append(rows, row)
+		}
+		if prev, ok := chosen[row][r.Backend]; !ok || r.GOMAXPROCS > prev.GOMAXPROCS {
+			chosen[row][r.Backend] = r
+		}
+	}
+	// Only rows more than one backend measured compare anything
+	kept := rows[:0]
+	for _, row := range rows {
+		if len(chosen[row]) > 1 {
+			kept = append(kept, row)
+		}
+	}
+	rows = kept
+	if len(rows) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].test != rows[j].test {
+			return rows[i].test < rows[j].test
+		}
+		if rows[i].mode != rows[j].mode {
+			return rows[i].mode < rows[j].mode
+		}
+		return rows[i].n < rows[j].n
+	})
+
+	caseWidth := len("CASE")
+	for _, row := range rows {
+		caseWidth = max(caseWidth, len(row.test)+1+len(row.mode))
+	}
+	fmt.Fprintf(w, "\n%-*s  %10s", caseWidth, "CASE", "N")
+	for i, name := range names {
+		if i == 0 {
+			fmt.Fprintf(w, "  %10s", strings.ToUpper(name))
+		} else {
+			fmt.Fprintf(w, "  %18s", strings.ToUpper(name))
+		}
+	}
+	fmt.Fprintln(w)
+	for _, row := range rows {
+		line := fmt.Sprintf("%-*s  %10d", caseWidth, row.test+"/"+row.mode, row.n)
+		first, hasFirst := chosen[row][names[0]]
+		for i, name := range names {
+			r, ok := chosen[row][name]
+			mean := r.MeanNs
+			switch {
+			case !ok && i == 0:
+				line += fmt.Sprintf("  %10s", "-")
+			case !ok:
+				line += fmt.Sprintf("  %18s", "-")
+			case i == 0:
+				line += "  " + prettyDuration(mean)
+			case hasFirst && first.MeanNs > 0:
+				line += fmt.Sprintf("  %s %6.2fx", prettyDuration(mean), float64(mean)/float64(first.MeanNs))
+			default:
+				line += fmt.Sprintf("  %s %7s", prettyDuration(mean), "")
+			}
+		}
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// runDaemon implements `daemon`: the owner of a dedicated runner box. It
+// takes benchmark jobs, each the flags of one `pcs-bench run`, over HTTP
+// on a local address or unix socket, queues them, and runs them strictly
+// one at a time as child processes, so timings never overlap and no cron
+// entry or lockfile is needed to keep them apart. Jobs live in -dir, one
+// directory each with job.json, the results stream and the run's log, so
+// a restarted daemon picks the queue up again; a job that was running
+// when the daemon stopped is marked failed.
+//
+//	POST   /jobs              {"args": ["-sizes", "1e6", ...]} -> job
+//	GET    /jobs              -> [job...], oldest first
+//	GET    /jobs/{id}         -> job
+//	GET    /jobs/{id}/results -> the run's results
+//	GET    /jobs/{id}/log     -> the run's standard error
+//	DELETE /jobs/{id}         cancels a queued or running job, or removes a finished one
+//	GET    /healthz
+//
+// The API runs jobs as the daemon's user, so it listens on the loopback
+// interface or a unix socket only, takes the run flags in daemonFlags
+// only, and refuses requests a browser could send (see sameClient).
+func runDaemon(args []string) int {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	addr := fs.String("addr", getEnv("PCS_DAEMON_ADDR", "127.0.0.1:8090"), "loopback address to listen on")
+	socket := fs.String("socket", "", "listen on this unix socket instead of -addr")
+	dir := fs.String("dir", "target/pcs-bench-jobs", "directory holding the queue, each job's results and its log")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench daemon [-addr 127.0.0.1:port | -socket path] [-dir jobs]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var ln net.Listener
+	var err error
+	if *socket != "" {
+		os.Remove(*socket) // left behind by a daemon that did not stop cleanly
+		ln, err = net.Listen("unix", *socket)
+	} else {
+		var host string
+		if host, _, err = net.SplitHostPort(*addr); err == nil {
+			if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+				err = fmt.Errorf("%s is not a loopback address", host)
+			} else {
+				ln, err = net.Listen("tcp", *addr)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "daemon: %v\n", err)
+		return 2
+	}
+	defer ln.Close()
+
+	q, err := openJobQueue(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "daemon: %v\n", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runCtx = ctx
+	done := make(chan struct{})
+	go func() {
+		q.work(ctx)
+		close(done)
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("POST /jobs", q.handleSubmit)
+	mux.HandleFunc("GET /jobs", q.handleList)
+	mux.HandleFunc("GET /jobs/{id}", q.handleJob)
+	mux.HandleFunc("GET /jobs/{id}/results", q.handleFile(jobResultsFile, "application/x-ndjson"))
+	mux.HandleFunc("GET /jobs/{id}/log", q.handleFile(jobLogFile, "text/plain; charset=utf-8"))
+	mux.HandleFunc("DELETE /jobs/{id}", q.handleDelete)
+	srv := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	fmt.Fprintf(os.Stderr, "daemon: listening on %s, jobs in %s\n", ln.Addr(), *dir)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "daemon: %v\n", err)
+		return 1
+	}
+	// A running job was sent SIGTERM with the rest of runCtx's children and
+	// writes the results it completed before it exits
+	<-done
+	return 0
+}
+
+// Job statuses.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+)
+
+// Files of a job's directory.
+const (
+	jobFile        = "job.json"
+	jobResultsFile = "results.ndjson"
+	jobLogFile     = "log.txt"
+)
+
+// job is one queued run. Args are its run flags; Position is its place in
+// the queue while queued (1 runs next).
+type job struct {
+	ID       string   `json:"id"`
+	Args     []string `json:"args"`
+	Status   string   `json:"status"`
+	Created  string   `json:"created"`
+	Started  string   `json:"started,omitempty"`
+	Finished string   `json:"finished,omitempty"`
+	ExitCode *int     `json:"exit_code,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Position int      `json:"position,omitempty"`
+}
+
+// daemonFlags are the run flags a job may pass, as -name, -name=value or
+// -name value. They choose the cases and how they are measured; flags
+// naming commands, toolchains, containers, runtimes, binaries or files to
+// read or write are left out, so a job cannot run anything else. The
+// daemon names the output itself.
+var daemonFlags = map[string]bool{
+	"backend": true, "format": true, "append": true, "fsync": true, "threshold": true,
+	"min-speedup": true, "procs-sweep": true, "max-procs": true, "chunk-sweep": true,
+	"cpus": true, "nice": true, "physical-cores": true, "gogc": true, "gomemlimit": true,
+	"profile": true, "seed": true, "pgo": true, "perf": true, "redact": true, "energy": true,
+	"sched": true, "sched-trace": true, "estimator": true, "cooldown": true,
+	"cooldown-load": true, "cooldown-max": true, "max-rss": true, "cgroup-cpus": true,
+	"cgroup-memory": true, "timeout": true, "retries": true, "retry-backoff": true,
+	"retry-cv": true, "targets": true, "suite": true, "label": true, "stock-cases": true,
+	"sizes": true, "keep-artifacts": true, "pipeline": true, "vet": true, "staticcheck": true,
+	"race-n": true, "verify": true, "allocs": true, "codegen": true,
+}
+
+// jobQueue is the daemon's jobs and the order the queued ones run in.
+type jobQueue struct {
+	dir string
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	queue  []string
+	cancel context.CancelFunc // of the running job
+	wake   chan struct{}
+}
+
+// openJobQueue loads the jobs in dir, requeueing the queued ones.
+func openJobQueue(dir string) (*jobQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &jobQueue{dir: dir, jobs: map[string]*job{}, wake: make(chan struct{}, 1)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name(), jobFile))
+		if err != nil {
+			continue
+		}
+		var j job
+		if err := json.Unmarshal(data, &j); err != nil || j.ID != e.Name() {
+			fmt.Fprintf(os.Stderr, "daemon: skipping %s: not a job\n", e.Name())
+			continue
+		}
+		switch j.Status {
+		case jobRunning:
+			j.Status, j.Error = jobFailed, "the daemon stopped while it ran"
+			j.Finished = time.Now().UTC().Format(time.RFC3339)
+			if err := q.save(&j); err != nil {
+				return nil, err
+			}
+		case jobQueued:
+			q.queue = append(q.queue, j.ID)
+		}
+		q.jobs[j.ID] = &j
+	}
+	// IDs start with the submission time
+	sort.Strings(q.queue)
+	return q, nil
+}
+
+// save writes j's job.json; the caller holds mu or owns j alone.
+func (q *jobQueue) save(j *job) error {
+	copied := *j
+	copied.Position = 0
+	return writeAtomic(filepath.Join(q.dir, j.ID, jobFile), 0644, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(copied)
+	})
+}
+
+// submit queues a run with args.
+func (q *jobQueue) submit(args []string) (job, error) {
+	// Every argument starting with - is checked, values included: one that
+	// looks like a flag is refused rather than guessed at (write -nice=-5)
+	for _, a := range args {
+		name, _, _ := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if strings.HasPrefix(a, "-") && !daemonFlags[name] {
+			return job{}, fmt.Errorf("flag %q is not allowed", a)
+		}
+	}
+	now := time.Now().UTC()
+	j := &job{
+		ID:      fmt.Sprintf("%s_%08x", now.Format("20060102T150405.000000Z"), rand.Uint32()),
+		Args:    append([]string{}, args...),
+		Status:  jobQueued,
+		Created: now.Format(time.RFC3339),
+	}
+	if err := os.MkdirAll(filepath.Join(q.dir, j.ID), 0755); err != nil {
+		return job{}, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.save(j); err != nil {
+		return job{}, err
+	}
+	q.jobs[j.ID] = j
+	q.queue = append(q.queue, j.ID)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return q.view(j), nil
+}
+
+// view is a copy of j with its queue position; the caller holds mu.
+func (q *jobQueue) view(j *job) job {
+	copied := *j
+	for i, id := range q.queue {
+		if id == j.ID {
+			copied.Position = i + 1
+		}
+	}
+	return copied
+}
+
+// work runs queued jobs one at a time until ctx ends.
+func (q *jobQueue) work(ctx context.Context) {
+	for {
+		q.mu.Lock()
+		var j *job
+		if len(q.queue) > 0 {
+			j = q.jobs[q.queue[0]]
+			q.queue = q.queue[1:]
+		}
+		q.mu.Unlock()
+		if j == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+			}
+			continue
+		}
+		q.run(ctx, j)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// run executes j as `pcs-bench run`, with its results going to the job's
+// directory, and records how it ended.
+func (q *jobQueue) run(ctx context.Context, j *job) {
+	exe, err := os.Executable()
+	jobDir := filepath.Join(q.dir, j.ID)
+	var log *os.File
+	if err == nil {
+		log, err = os.Create(filepath.Join(jobDir, jobLogFile))
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	q.mu.Lock()
+	j.Status, j.Started = jobRunning, time.Now().UTC().Format(time.RFC3339)
+	q.cancel = cancel
+	q.save(j)
+	q.mu.Unlock()
+
+	if err == nil {
+		args := append([]string{"run", "-output", filepath.Join(jobDir, jobResultsFile)}, j.Args...)
+		cmd := exec.CommandContext(jobCtx, exe, args...)
+		cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+		cmd.WaitDelay = childGrace
+		cmd.Stderr = log
+		err = cmd.Run()
+		log.Close()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cancel = nil
+	j.Finished = time.Now().UTC().Format(time.RFC3339)
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		j.Status = jobSucceeded
+		j.ExitCode = new(int)
+	case j.Status == jobCanceled:
+	case errors.As(err, &exit):
+		code := exit.ExitCode()
+		j.Status, j.ExitCode = jobFailed, &code
+		if ctx.Err() != nil {
+			j.Error = "the daemon stopped while it ran"
+		}
+	default:
+		j.Status, j.Error = jobFailed, err.Error()
+	}
+	if err := q.save(j); err != nil {
+		fmt.Fprintf(os.Stderr, "daemon: %s: %v\n", j.ID, err)
+	}
+	fmt.Fprintf(os.Stderr, "daemon: job %s %s\n", j.ID, j.Status)
+}
+
+// lookup returns the job named by the request path, writing a 404 when
+// there is none.
+func (q *jobQueue) lookup(w http.ResponseWriter, r *http.Request) (*job, bool) {
+	j, ok := q.jobs[r.PathValue("id")]
+	if !ok {
+		serveError(w, http.StatusNotFound, "no such job")
+	}
+	return j, ok
+}
+
+// sameClient refuses a request a web page could have sent: one with an
+// Origin header, or with a body that is not JSON, which a page can POST
+// cross-origin without a preflight. The daemon has no other
+// authentication than listening on loopback or a unix socket.
+func sameClient(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Origin") != "" {
+		serveError(w, http.StatusForbidden, "cross-origin requests are not accepted")
+		return false
+	}
+	if r.Method == http.MethodPost {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			serveError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return false
+		}
+	}
+	return true
+}
+
+func (q *jobQueue) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	if !sameClient(w, r) {
+		return
+	}
+	var req struct {
+		Args []string `json:"args"`
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		serveError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	j, err := q.submit(req.Args)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	serveJSON(w, http.StatusAccepted, j)
+}
+
+func (q *jobQueue) handleList(w http.ResponseWriter, r *http.Request) {
+	q.mu.Lock()
+	list := make([]job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		list = append(list, q.view(j))
+	}
+	q.mu.Unlock()
+	sort.Slice(list, func(i, k int) bool { return list[i].ID < list[k].ID })
+	serveJSON(w, http.StatusOK, list)
+}
+
+func (q *jobQueue) handleJob(w http.ResponseWriter, r *http.Request) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if j, ok := q.lookup(w, r); ok {
+		serveJSON(w, http.StatusOK, q.view(j))
+	}
+}
+
+// handleFile serves one of a job's files, as far as it is written.
+func (q *jobQueue) handleFile(name, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q.mu.Lock()
+		j, ok := q.lookup(w, r)
+		q.mu.Unlock()
+		if !ok {
+			return
+		}
+		data, err := os.ReadFile(filepath.Join(q.dir, j.ID, name))
+		if err != nil {
+			serveError(w, http.StatusNotFound, fmt.Sprintf("job %s has no %s yet", j.ID, name))
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(data)
+	}
+}
+
+// handleDelete takes a queued job off the queue, stops a running one (it
+// still writes the results it completed) or removes a finished one.
+func (q *jobQueue) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if !sameClient(w, r) {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.lookup(w, r)
+	if !ok {
+		return
+	}
+	switch j.Status {
+	case jobQueued:
+		for i, id := range q.queue {
+			if id == j.ID {
+				q.queue = append(q.queue[:i], q.queue[i+1:]...)
+				break
+			}
+		}
+		j.Status, j.Finished = jobCanceled, time.Now().UTC().Format(time.RFC3339)
+		q.save(j)
+	case jobRunning:
+		j.Status = jobCanceled
+		q.cancel()
+	default:
+		if err := os.RemoveAll(filepath.Join(q.dir, j.ID)); err != nil {
+			serveError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		delete(q.jobs, j.ID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	serveJSON(w, http.StatusOK, q.view(j))
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dashboard serves the benchmark history for browsing: every series with
+// its latest numbers, the regressions analyze would report, and one page
+// per series with its time-series chart annotated by commit. The history
+// is re-read on every request, so results imported or committed while it
+// runs show up on the next reload.
+type dashboard struct {
+	db        string
+	files     []string
+	threshold float64
+	window    int
+	confirm   int
+	// commitURL links a commit when set; %s is replaced by the full SHA
+	commitURL string
+}
+
+// dashSeries is one benchmark's results in timestamp order.
+type dashSeries struct {
+	ID     string
+	Label  string
+	Points []BenchmarkResult
+	// Marks are the series' suspected regressions
+	Marks []suspectedRegression
+}
+
+func (s dashSeries) Latest() BenchmarkResult { return s.Points[len(s.Points)-1] }
+
+// Change is the latest mean relative to the one before it, 0 for a series
+// of one result.
+func (s dashSeries) Change() float64 {
+	if len(s.Points) < 2 {
+		return 0
+	}
+	prev := s.Points[len(s.Points)-2].MeanNs
+	return float64(s.Latest().MeanNs-prev) / float64(prev)
+}
+
+// runDashboard implements `dashboard`.
+func runDashboard(args []string) int {
+	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8090", "address to listen on")
+	db := fs.String("db", "", "SQLite history database (see history import) to serve instead of NDJSON files")
+	d := dashboard{}
+	fs.Float64Var(&d.threshold, "threshold", 0.15, "relative slowdown vs the rolling baseline counted as a regression")
+	fs.IntVar(&d.window, "window", 10, "number of previous results forming the rolling baseline")
+	fs.IntVar(&d.confirm, "confirm", 2, "consecutive slow results needed to call a step change")
+	fs.StringVar(&d.commitURL, "commit-url", defaultCommitURL(), "commit link, %s standing for the SHA")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench dashboard [-addr host:port] (-db history.db | results.ndjson-or-dirs...)\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	d.db, d.files = *db, fs.Args()
+	if (d.db == "") == (len(d.files) == 0) {
+		fs.Usage()
+		return 2
+	}
+	if d.window < 2 || d.confirm < 1 {
+		fmt.Fprintln(os.Stderr, "dashboard: -window must be at least 2 and -confirm at least 1")
+		return 2
+	}
+	if _, err := d.load(); err != nil {
+		fmt.Fprintf(os.Stderr, "dashboard: %v\n", err)
+		return 1
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", d.handleIndex)
+	mux.HandleFunc("/series/", d.handleSeries)
+	mux.HandleFunc("/api/series", d.handleAPI)
+	fmt.Fprintf(os.Stderr, "dashboard: serving on http://%s/\n", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		fmt.Fprintf(os.Stderr, "dashboard: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// defaultCommitURL links commits on GitHub when running in Actions.
+func defaultCommitURL() string {
+	server, repo := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY")
+	if server == "" || repo == "" {
+		return ""
+	}
+	return server + "/" + repo + "/commit/%s"
+}
+
+// load reads the history and splits it into series, most recently updated
+// first, each with its suspected regressions.
+func (d *dashboard) load() ([]dashSeries, error) {
+	var results []BenchmarkResult
+	if d.db != "" {
+		h, err := openHistory(d.db)
+		if err == nil {
+			results, err = h.Query(historyQuery{})
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if results, err = readResults(resultPaths(d.files)...); err != nil {
+			return nil, err
+		}
+	}
+
+	var series []dashSeries
+	for _, points := range historySeries(results) {
+		s := dashSeries{ID: seriesID(points[0]), Label: seriesLabel(points[0]), Points: points}
+		s.Marks = analyzeSeries(points, d.threshold, d.window, d.confirm)
+		series = append(series, s)
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		a, b := series[i].Latest().Timestamp, series[j].Latest().Timestamp
+		if a != b {
+			return a > b
+		}
+		return series[i].Label < series[j].Label
+	})
+	return series, nil
+}
+
+// seriesID names a series in URLs; it is stable across reloads.
+func seriesID(r BenchmarkResult) string {
+	k := mergeKeyOf(r)
+	return cacheKey(k.Backend, k.Test, k.Mode, fmt.Sprint(k.N), fmt.Sprint(k.Parallel), k.GOGC, k.GOMemLimit, k.Estimator, k.Target, k.GoVersion)[:12]
+}
+
+// seriesLabel describes a series, e.g. go dict_comp/loops n=10000.
+func seriesLabel(r BenchmarkResult) string {
+	label := fmt.Sprintf("%s %s/%s n=%d", r.Backend, r.Test, r.Mode, r.N)
+	if r.Parallel && !strings.Contains(r.Mode, "parallel") {
+		label += " parallel"
+	}
+	for _, extra := range []struct{ name, value string }{
+		{"target", r.Target}, {"go", r.GoVersion}, {"GOGC", r.GOGC}, {"GOMEMLIMIT", r.GOMemLimit}, {"estimator", r.Estimator},
+	} {
+		if extra.value != "" && !(extra.name == "estimator" && extra.value == "classic") {
+			label += " " + extra.name + "=" + extra.value
+		}
+	}
+	return label
+}
+
+func (d *dashboard) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	series, err := d.load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	type regression struct {
+		suspectedRegression
+		ID, Label string
+	}
+	page := struct {
+		Source      string
+		Threshold   float64
+		Series      []dashSeries
+		Regressions []regression
+	}{Source: d.source(), Threshold: d.threshold, Series: series}
+	for _, s := range series {
+		for _, m := range s.Marks {
+			page.Regressions = append(page.Regressions, regression{m, s.ID, s.Label})
+		}
+	}
+	sort.SliceStable(page.Regressions, func(i, j int) bool {
+		return page.Regressions[i].FirstTimestamp > page.Regressions[j].FirstTimestamp
+	})
+	d.render(w, "index", page)
+}
+
+func (d *dashboard) handleSeries(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/series/")
+	series, err := d.load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, s := range series {
+		if s.ID == id {
+			d.render(w, "series", struct {
+				Source string
+				dashSeries
+				Chart template.HTML
+			}{d.source(), s, historyChart(s)})
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// handleAPI answers with every series as JSON, for scripts and bots.
+func (d *dashboard) handleAPI(w http.ResponseWriter, r *http.Request) {
+	series, err := d.load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	type apiSeries struct {
+		ID          string                `json:"id"`
+		Label       string                `json:"label"`
+		Points      []BenchmarkResult     `json:"points"`
+		Regressions []suspectedRegression `json:"regressions"`
+	}
+	out := make([]apiSeries, 0, len(series))
+	for _, s := range series {
+		if s.Marks == nil {
+			s.Marks = []suspectedRegression{}
+		}
+		out = append(out, apiSeries{s.ID, s.Label, s.Points, s.Marks})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (d *dashboard) source() string {
+	if d.db != "" {
+		return d.db
+	}
+	return strings.Join(d.files, ", ")
+}
+
+func (d *dashboard) render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	t := template.Must(dashboardTemplates.Clone())
+	t.Funcs(template.FuncMap{
+		"commitURL": func(sha string) string {
+			if d.commitURL == "" || sha == "" {
+				return ""
+			}
+			return strings.ReplaceAll(d.commitURL, "%s", sha)
+		},
+	})
+	if err := t.ExecuteTemplate(w, name, data); err != nil {
+		fmt.Fprintf(os.Stderr, "dashboard: %v\n", err)
+	}
+}
+
+// historyChart draws a series' mean over time, one point per result, with
+// a band of one standard deviation, the commit of each point on hover and
+// along the axis, and a marker at the first result of every suspected
+// regression.
+func historyChart(s dashSeries) template.HTML {
+	const width, height, pad, bottom = 900, 320, 60, 70
+	points := s.Points
+	var top int64
+	for _, p := range points {
+		top = max(top, p.MeanNs+p.StdNs)
+	}
+	if top == 0 {
+		top = 1
+	}
+	plotW := float64(width - 2*pad)
+	plotH := float64(height - pad - bottom)
+	x := func(i int) float64 {
+		if len(points) == 1 {
+			return pad + plotW/2
+		}
+		return pad + plotW*float64(i)/float64(len(points)-1)
+	}
+	y := func(ns int64) float64 {
+		return pad + plotH - plotH*float64(ns)/float64(top)
+	}
+	baseY := float64(height - bottom)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" width="%d" height="%d" role="img"><title>%s: mean over time</title>`, width, height, template.HTMLEscapeString(s.Label))
+	fmt.Fprintf(&b, `<line x1="%d" y1="%.0f" x2="%d" y2="%.0f" stroke="#999"/>`, pad, baseY, width-pad, baseY)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%.0f" stroke="#999"/>`, pad, pad, pad, baseY)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, pad-4, pad+4, time.Duration(top))
+	fmt.Fprintf(&b, `<text x="%d" y="%.0f" text-anchor="end">0</text>`, pad-4, baseY+4)
+
+	var upper, lower []string
+	for i, p := range points {
+		upper = append(upper, fmt.Sprintf("%.1f,%.1f", x(i), y(p.MeanNs+p.StdNs)))
+		lower = append([]string{fmt.Sprintf("%.1f,%.1f", x(i), y(max(p.MeanNs-p.StdNs, 0)))}, lower...)
+	}
+	fmt.Fprintf(&b, `<polygon fill="#4e79a7" fill-opacity="0.15" points="%s"/>`, strings.Join(append(upper, lower...), " "))
+
+	firsts := map[string]suspectedRegression{}
+	for _, m := range s.Marks {
+		firsts[m.FirstTimestamp+"\x00"+m.FirstCommit] = m
+	}
+	// Label at most about 20 commits along the axis
+	every := max(1, (len(points)+19)/20)
+	var line []string
+	for i, p := range points {
+		line = append(line, fmt.Sprintf("%.1f,%.1f", x(i), y(p.MeanNs)))
+		if m, ok := firsts[p.Timestamp+"\x00"+p.Commit]; ok {
+			fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.0f" stroke="#e15759" stroke-dasharray="4 3"/>`, x(i), pad, x(i), baseY)
+			fmt.Fprintf(&b, `<text x="%.1f" y="%d" fill="#e15759" text-anchor="middle">%s %+.0f%%</text>`, x(i), pad-8, m.Kind, m.Change*100)
+		}
+		if i%every == 0 || i == len(points)-1 {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.0f" transform="rotate(45 %.1f %.0f)">%s</text>`, x(i), baseY+14, x(i), baseY+14, template.HTMLEscapeString(shortCommit(p.Commit)))
+		}
+	}
+	fmt.Fprintf(&b, `<polyline fill="none" stroke="#4e79a7" stroke-width="2" points="%s"/>`, strings.Join(line, " "))
+	for i, p := range points {
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="#4e79a7"><title>%s %s: %s ± %s</title></circle>`,
+			x(i), y(p.MeanNs), template.HTMLEscapeString(shortCommit(p.Commit)), template.HTMLEscapeString(p.Timestamp), time.Duration(p.MeanNs), time.Duration(p.StdNs))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// sparkline draws a series' means as a small line for the index.
+func sparkline(s dashSeries) template.HTML {
+	const width, height = 120, 24
+	var lo, hi int64 = s.Points[0].MeanNs, s.Points[0].MeanNs
+	for _, p := range s.Points {
+		lo, hi = min(lo, p.MeanNs), max(hi, p.MeanNs)
+	}
+	span := float64(max(hi-lo, 1))
+	var pts []string
+	for i, p := range s.Points {
+		x := float64(width) / 2
+		if len(s.Points) > 1 {
+			x = float64(width) * float64(i) / float64(len(s.Points)-1)
+		}
+		pts = append(pts, fmt.Sprintf("%.1f,%.1f", x, 2+float64(height-4)*(1-float64(p.MeanNs-lo)/span)))
+	}
+	return template.HTML(fmt.Sprintf(`<svg width="%d" height="%d"><polyline fill="none" stroke="#4e79a7" stroke-width="1.5" points="%s"/></svg>`,
+		width, height, strings.Join(pts, " ")))
+}
+
+// shortCommit abbreviates a full SHA; other commit names are kept whole.
+func shortCommit(sha string) string {
+	if len(sha) == 40 && strings.Trim(sha, "0123456789abcdef") == "" {
+		return sha[:8]
+	}
+	return sha
+}
+
+var dashboardTemplates = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"dur":       func(ns int64) string { return time.Duration(ns).String() },
+	"pct":       func(f float64) string { return fmt.Sprintf("%+.1f%%", f*100) },
+	"short":     shortCommit,
+	"sparkline": sparkline,
+	"commitURL": func(string) string { return "" },
+	"severity":  prSeverity,
+}).Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; font-size: 0.9em; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; }
+th { background: #f4f4f4; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+.chart { display: block; margin: 0.5em 0; font-size: 11px; }
+.meta { color: #666; }
+a { color: #2b5d9c; }
+</style>
+</head>
+<body>
+{{end}}
+
+{{define "commit"}}{{with commitURL .}}<a href="{{.}}"><code>{{short $}}</code></a>{{else}}<code>{{short .}}</code>{{end}}{{end}}
+
+{{define "index"}}{{template "head" "PCS benchmark history"}}
+<h1>PCS benchmark history</h1>
+<p class="meta">{{len .Series}} series from <code>{{.Source}}</code> · <a href="/api/series">JSON</a></p>
+
+<h2>Suspected regressions</h2>
+{{if .Regressions}}<table>
+<thead><tr><th>First seen</th><th>Commit</th><th>Benchmark</th><th>Kind</th><th>Baseline</th><th>Now</th><th>Change</th></tr></thead>
+<tbody>
+{{range .Regressions}}<tr>
+<td>{{.FirstTimestamp}}</td><td>{{template "commit" .FirstCommit}}</td>
+<td><a href="/series/{{.ID}}">{{.Label}}</a></td><td>{{.Kind}}</td>
+<td class="num">{{dur .BaselineNs}}</td><td class="num">{{dur .CurrentNs}}</td><td class="num">{{pct .Change}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+{{else}}<p>None over {{pct .Threshold}}.</p>{{end}}
+
+<h2>Benchmarks</h2>
+<table>
+<thead><tr><th>Benchmark</th><th>Results</th><th>Latest</th><th>Commit</th><th>Mean</th><th>vs previous</th><th>Trend</th></tr></thead>
+<tbody>
+{{range .Series}}{{$latest := .Latest}}<tr>
+<td><a href="/series/{{.ID}}">{{.Label}}</a></td><td class="num">{{len .Points}}</td>
+<td>{{$latest.Timestamp}}</td><td>{{template "commit" $latest.Commit}}</td>
+<td class="num">{{dur $latest.MeanNs}}</td>
+<td class="num">{{if gt (len .Points) 1}}{{severity .Change $.Threshold}} {{pct .Change}}{{end}}</td>
+<td>{{sparkline .}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+{{end}}
+
+{{define "series"}}{{template "head" .Label}}
+<p><a href="/">← all benchmarks</a></p>
+<h1>{{.Label}}</h1>
+<p class="meta">{{len .Points}} results from <code>{{.Source}}</code></p>
+{{.Chart}}
+<table>
+<thead><tr><th>Timestamp</th><th>Commit</th><th>Mean</th><th>Median</th><th>p99</th><th>Std</th></tr></thead>
+<tbody>
+{{range .Points}}<tr>
+<td>{{.Timestamp}}</td><td>{{template "commit" .Commit}}</td>
+<td class="num">{{dur .MeanNs}}</td><td class="num">{{dur .MedianNs}}</td><td class="num">{{dur .P99Ns}}</td><td class="num">{{dur .StdNs}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+{{end}}
+`))
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Data cases (benchCase.Data) time code over a generated input collection
+// instead of a range: the snippet iterates data, which pcs renders as the
+// []int parameter of program, and the driver passes it n values drawn from
+// a distribution by a PRNG seeded with -seed. The same seed, distribution
+// and size give the same values on every machine and run, so results stay
+// comparable; they record both (data, data_seed).
+
+// dataSeed seeds the generators of data cases (-seed).
+var dataSeed int64 = 1
+
+// dataDistributions are the distributions of data cases, with the
+// parameters they take after their name, colon-separated. {N} in a
+// parameter is replaced by the case's size, as in Code.
+var dataDistributions = map[string]string{
+	"uniform":     "uniform[:LO:HI]: integers in [LO, HI), by default [0, N)",
+	"normal":      "normal[:MEAN:STDDEV]: rounded normal variates, by default N/2 and N/6",
+	"zipf":        "zipf[:S[:MAX]]: Zipf-distributed integers in [0, MAX] with exponent S > 1, by default 1.1 and N",
+	"permutation": "permutation: 0..N-1 in shuffled order",
+}
+
+// dataSpec is a parsed Data distribution at one size.
+type dataSpec struct {
+	dist   string
+	params []float64
+}
+
+// parseDataSpec parses spec at size n.
+func parseDataSpec(spec string, n int) (dataSpec, error) {
+	fields := strings.Split(strings.ReplaceAll(spec, "{N}", strconv.Itoa(n)), ":")
+	d := dataSpec{dist: fields[0]}
+	usage, ok := dataDistributions[d.dist]
+	if !ok {
+		return d, fmt.Errorf("unknown distribution %q (want uniform, normal, zipf or permutation)", d.dist)
+	}
+	for _, f := range fields[1:] {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return d, fmt.Errorf("%s: parameter %q is not a number; want %s", spec, f, usage)
+		}
+		d.params = append(d.params, v)
+	}
+	size := float64(n)
+	var valid bool
+	switch d.dist {
+	case "uniform":
+		d.params = defaultParams(d.params, 0, size)
+		valid = len(d.params) == 2 && d.params[0] < d.params[1] &&
+			d.params[0] == math.Trunc(d.params[0]) && d.params[1] == math.Trunc(d.params[1])
+	case "normal":
+		d.params = defaultParams(d.params, size/2, size/6)
+		valid = len(d.params) == 2 && d.params[1] >= 0
+	case "zipf":
+		if len(d.params) == 1 {
+			d.params = append(d.params, size)
+		}
+		d.params = defaultParams(d.params, 1.1, size)
+		valid = len(d.params) == 2 && d.params[0] > 1 && d.params[1] >= 0
+	case "permutation":
+		valid = len(d.params) == 0
+	}
+	if !valid {
+		return d, fmt.Errorf("%s: want %s", spec, usage)
+	}
+	return d, nil
+}
+
+// String is d with every parameter, defaults included, as results record
+// it.
+func (d dataSpec) String() string {
+	s := d.dist
+	for _, p := range d.params {
+		s += ":" + strconv.FormatFloat(p, 'g', -1, 64)
+	}
+	return s
+}
+
+// defaultParams is params, or defaults when none were given.
+func defaultParams(params []float64, defaults ...float64) []float64 {
+	if len(params) == 0 {
+		return defaults
+	}
+	return params
+}
+
+// generate draws n values from d with a PRNG seeded with seed.
+func (d dataSpec) generate(n int, seed int64) []int64 {
+	r := rand.New(rand.NewSource(seed))
+	values := make([]int64, n)
+	switch d.dist {
+	case "uniform":
+		lo, hi := int64(d.params[0]), int64(d.params[1])
+		for i := range values {
+			values[i] = lo + r.Int63n(hi-lo)
+		}
+	case "normal":
+		for i := range values {
+			values[i] = int64(math.Round(d.params[0] + d.params[1]*r.NormFloat64()))
+		}
+	case "zipf":
+		z := rand.NewZipf(r, d.params[0], 1, uint64(d.params[1]))
+		for i := range values {
+			values[i] = int64(z.Uint64())
+		}
+	case "permutation":
+		for i, v := range r.Perm(n) {
+			values[i] = int64(v)
+		}
+	}
+	return values
+}
+
+// writeDataInput writes the values of tc's data at size n to path as
+// little-endian int64s, the form the driver's readBenchData and the
+// Python reference read.
+func writeDataInput(path string, tc benchCase, n int) error {
+	d, err := parseDataSpec(tc.Data, n)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(f, 1<<16)
+	var b [8]byte
+	for _, v := range d.generate(n, dataSeed) {
+		binary.LittleEndian.PutUint64(b[:], uint64(v))
+		w.Write(b[:])
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dataDriverSource is driverSource passing the generated data to program.
+var dataDriverSource = strings.ReplaceAll(driverSource, "program()", "program(benchData)")
@@ -0,0 +1,645 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// driverSource is compiled next to the generated program. It times each call
+// of program() and prints one nanosecond duration per line, so the harness
+// measures the generated code rather than a stand-in loop. With a second
+// argument "lookup" it builds the result once and instead times a pass of
+// lookups over every key, for map-like results (map[int]int, *sync.Map or
+// any type with Get and Range methods). The third and fourth arguments select the
+// measurement protocol (see measureProtocols) and its warmup count; the
+// number of untimed warmup calls is reported first as "warmup <n>".
+// With "verify" as the second argument it calls program() once and prints
+// its result as canonical JSON instead (see canonical); with "allocs" it
+// prints "allocs <n>", the heap allocations of a call (see allocsPerCall).
+// PCS_BENCH_CPUPROFILE names a file to write a CPU profile of the run to.
+// Builds with the scheduler sampler (-sched) print a "sched" line after the
+// timings (see schedSource).
+// Data cases are built with dataDriverSource, which passes program their
+// input.
+const driverSource = "package main\n\n" + driverImports + `
+func main() {
+	defer startProfile()()
+	reps, err := strconv.Atoi(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fixed, err := strconv.Atoi(os.Args[4])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if os.Args[2] == "verify" {
+		fmt.Printf("%s\n", canonical(nil, reflect.ValueOf(program())))
+		return
+	}
+	if os.Args[2] == "allocs" {
+		// A typed result, so storing it does not box it
+		result := program()
+		fmt.Println("allocs", allocsPerCall(func() { result = program() }, reps))
+		sink = result
+		return
+	}
+	call := func() int64 {
+		start := time.Now()
+		sink = program()
+		return time.Since(start).Nanoseconds()
+	}
+	if os.Args[2] == "lookup" {
+		call = lookups(program())
+	}
+
+	fmt.Println("warmup", warmup(call, os.Args[3], fixed))
+	stop := startSched(reps)
+	for i := 0; i < reps; i++ {
+		fmt.Println(call())
+	}
+	stop()
+}
+` + driverLib
+
+// abDriverSource times two variants, programA() and programB(), in one
+// process. After warming both up it alternates them, swapping which goes
+// first on every pair (A,B then B,A) so drift and ordering effects hit both
+// equally, and prints "pair <a ns> <b ns>" per pair.
+const abDriverSource = "package main\n\n" + driverImports + `
+func main() {
+	defer startProfile()()
+	reps, err := strconv.Atoi(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fixed, err := strconv.Atoi(os.Args[3])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	callA := func() int64 {
+		start := time.Now()
+		sink = programA()
+		return time.Since(start).Nanoseconds()
+	}
+	callB := func() int64 {
+		start := time.Now()
+		sink = programB()
+		return time.Since(start).Nanoseconds()
+	}
+
+	fmt.Println("warmup", warmup(callA, os.Args[2], fixed)+warmup(callB, os.Args[2], fixed))
+	for i := 0; i < reps; i++ {
+		var a, b int64
+		if i%2 == 0 {
+			a = callA()
+			b = callB()
+		} else {
+			b = callB()
+			a = callA()
+		}
+		fmt.Println("pair", a, b)
+	}
+}
+` + driverLib
+
+// driverImports and driverLib are shared by both drivers.
+const driverImports = `import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+`
+
+const driverLib = `var sink interface{}
+
+// startSched brackets the timed calls; builds with the scheduler sampler
+// replace it (see schedSource).
+var startSched = func(reps int) func() { return func() {} }
+
+// benchN is the input size of code built for several sizes (see sizedCode).
+var benchN, _ = strconv.Atoi(os.Getenv("PCS_BENCH_SIZE"))
+
+// benchData is the input of data cases, read from the little-endian int64s
+// in $PCS_BENCH_DATA (see writeDataInput); nil for other cases.
+var benchData = readBenchData()
+
+func readBenchData() []int {
+	path := os.Getenv("PCS_BENCH_DATA")
+	if path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "data:", err)
+		os.Exit(2)
+	}
+	data := make([]int, len(raw)/8)
+	for i := range data {
+		data[i] = int(int64(binary.LittleEndian.Uint64(raw[8*i:])))
+	}
+	return data
+}
+
+// allocsPerCall is the heap allocations of a call of f, averaged over runs
+// calls after one untimed call, on one P as testing.AllocsPerRun counts them.
+func allocsPerCall(f func(), runs int) float64 {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	f()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < runs; i++ {
+		f()
+	}
+	runtime.ReadMemStats(&after)
+	return float64(after.Mallocs-before.Mallocs) / float64(runs)
+}
+
+// startProfile starts a CPU profile into $PCS_BENCH_CPUPROFILE, if set, and
+// returns the function that stops it.
+func startProfile() func() {
+	path := os.Getenv("PCS_BENCH_CPUPROFILE")
+	if path == "" {
+		return func() {}
+	}
+	f, err := os.Create(path)
+	if err == nil {
+		err = pprof.StartCPUProfile(f)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cpuprofile:", err)
+		os.Exit(2)
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		f.Close()
+	}
+}
+
+type readMap interface {
+	Get(k int) (int, bool)
+	Range(f func(k, v int) bool)
+}
+
+// warmup runs untimed calls according to the protocol and returns how many
+// it made. "steady" stops once the last steadyWindow calls vary by less than
+// steadyCV (coefficient of variation), giving up after maxWarmup calls.
+func warmup(call func() int64, protocol string, fixed int) int {
+	const steadyWindow, steadyCV, maxWarmup = 5, 0.05, 50
+
+	switch protocol {
+	case "cold":
+		return 0
+	case "warmup":
+		for i := 0; i < fixed; i++ {
+			call()
+		}
+		return fixed
+	}
+
+	var window []float64
+	for i := 1; i <= maxWarmup; i++ {
+		window = append(window, float64(call()))
+		if len(window) > steadyWindow {
+			window = window[1:]
+		}
+		if len(window) == steadyWindow {
+			var mean, variance float64
+			for _, t := range window {
+				mean += t
+			}
+			mean /= steadyWindow
+			for _, t := range window {
+				variance += (t - mean) * (t - mean)
+			}
+			if math.Sqrt(variance/steadyWindow) < steadyCV*mean {
+				return i
+			}
+		}
+	}
+	return maxWarmup
+}
+
+// canonical appends the JSON form of a result the harness compares with
+// Python's: sets (maps to struct{}) as sorted lists, maps as key-sorted
+// [key, value] pairs, several results (a struct) as a list and strings as
+// JSON strings.
+func canonical(b []byte, v reflect.Value) []byte {
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if m, ok := v.Interface().(readMap); ok {
+			pairs := map[int]int{}
+			m.Range(func(k, val int) bool { pairs[k] = val; return true })
+			return canonical(b, reflect.ValueOf(pairs))
+		}
+		if m, ok := v.Interface().(*sync.Map); ok {
+			pairs := map[int]int{}
+			m.Range(func(k, val any) bool { pairs[k.(int)] = val.(int); return true })
+			return canonical(b, reflect.ValueOf(pairs))
+		}
+		return canonical(b, v.Elem())
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.AppendBool(b, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(b, v.Int(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(b, v.Float(), 'g', -1, 64)
+	case reflect.String:
+		s, _ := json.Marshal(v.String())
+		return append(b, s...)
+	case reflect.Slice, reflect.Array, reflect.Struct:
+		n := v.Len
+		at := v.Index
+		if v.Kind() == reflect.Struct {
+			n, at = v.NumField, v.Field
+		}
+		b = append(b, '[')
+		for i := 0; i < n(); i++ {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = canonical(b, at(i))
+		}
+		return append(b, ']')
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Int() < keys[j].Int() })
+		set := v.Type().Elem().Size() == 0
+		b = append(b, '[')
+		for i, k := range keys {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if set {
+				b = canonical(b, k)
+				continue
+			}
+			b = canonical(append(b, '['), k)
+			b = canonical(append(b, ','), v.MapIndex(k))
+			b = append(b, ']')
+		}
+		return append(b, ']')
+	}
+	fmt.Fprintf(os.Stderr, "verify: unsupported result type %s\n", v.Type())
+	os.Exit(2)
+	return nil
+}
+
+// lookups returns a call that times one pass of lookups over every key of
+// the result, visited in a fixed shuffled order (seeded by PCS_BENCH_SEED,
+// default 1).
+func lookups(result interface{}) func() int64 {
+	var get func(k int) (int, bool)
+	var keys []int
+	switch m := result.(type) {
+	case map[int]int:
+		get = func(k int) (int, bool) { v, ok := m[k]; return v, ok }
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case readMap:
+		get = m.Get
+		m.Range(func(k, _ int) bool { keys = append(keys, k); return true })
+	case *sync.Map:
+		get = func(k int) (int, bool) {
+			v, ok := m.Load(k)
+			if !ok {
+				return 0, false
+			}
+			return v.(int), true
+		}
+		m.Range(func(k, _ any) bool { keys = append(keys, k.(int)); return true })
+	default:
+		fmt.Fprintf(os.Stderr, "lookup: unsupported result type %T\n", result)
+		os.Exit(2)
+	}
+	seed, _ := strconv.ParseInt(os.Getenv("PCS_BENCH_SEED"), 10, 64)
+	if seed == 0 {
+		seed = 1
+	}
+	rand.New(rand.NewSource(seed)).Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+	return func() int64 {
+		start := time.Now()
+		total := 0
+		for _, k := range keys {
+			v, _ := get(k)
+			total += v
+		}
+		elapsed := time.Since(start)
+		sink = total
+		return elapsed.Nanoseconds()
+	}
+}
+`
+
+// writeProgram writes the generated fragment as a package main source file
+// alongside the timing driver and copies of any runtime files, all named
+// after prefix. It returns the source files to pass to go build.
+func writeProgram(prefix string, fragment []byte, runtime []string) ([]string, error) {
+	return writeSources(prefix, driverSource, map[string][]byte{"": fragment}, runtime)
+}
+
+// requiresRuntime matches the line pcs emits above code that needs one of
+// the vendored files in pcs/backends/go.
+var requiresRuntime = regexp.MustCompile(`(?m)^// Requires (\w+\.go) \(pcs/backends/go\)`)
+
+// vendoredRuntime lists the runtime files code asks for, for code that does
+// not come from a benchCase naming them in Runtime.
+func vendoredRuntime(code []byte) []string {
+	var runtime []string
+	for _, m := range requiresRuntime.FindAllSubmatch(code, -1) {
+		if path := "pcs/backends/go/" + string(m[1]); !contains(runtime, path) {
+			runtime = append(runtime, path)
+		}
+	}
+	return runtime
+}
+
+// buildArgs is the go build command line producing binary from sources
+// with a case's build flags.
+func buildArgs(binary string, flags, sources []string) []string {
+	args := append([]string{"build"}, flags...)
+	args = append(args, "-o", binary)
+	return append(args, sources...)
+}
+
+// writeSources writes each fragment to prefix+suffix+".go", the driver to
+// prefix+"_main.go" and one copy of every distinct runtime file.
+func writeSources(prefix, driver string, fragments map[string][]byte, runtime []string) ([]string, error) {
+	var sources []string
+	suffixes := make([]string, 0, len(fragments))
+	for suffix := range fragments {
+		suffixes = append(suffixes, suffix)
+	}
+	sort.Strings(suffixes)
+	for _, suffix := range suffixes {
+		path := prefix + suffix + ".go"
+		src := append([]byte("package main\n\n"), fragments[suffix]...)
+		if err := writeGo(path, src); err != nil {
+			return nil, err
+		}
+		sources = append(sources, path)
+	}
+
+	driverPath := prefix + "_main.go"
+	if err := os.WriteFile(driverPath, []byte(driver), 0644); err != nil {
+		return nil, err
+	}
+	sources = append(sources, driverPath)
+
+	// go build wants every file in one directory, so runtime files are copied
+	copied := map[string]bool{}
+	for _, rt := range runtime {
+		dst := prefix + "_rt_" + filepath.Base(rt)
+		if copied[dst] {
+			continue
+		}
+		copied[dst] = true
+		data, err := os.ReadFile(rt)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return nil, err
+		}
+		sources = append(sources, dst)
+	}
+	return sources, nil
+}
+
+// writeGo writes generated Go source to path as gofmt formats it. Source
+// that does not parse is written as is, for inspection, and reported with
+// the position of its first syntax error.
+func writeGo(path string, src []byte) error {
+	formatted, err := format.Source(src)
+	if err != nil {
+		os.WriteFile(path, src, 0644)
+		return fmt.Errorf("invalid Go: %s:%v", path, err)
+	}
+	return os.WriteFile(path, formatted, 0644)
+}
+
+// measureProtocols are the warmup protocols the driver understands. They
+// match the protocol field written by the other backends' harnesses, so
+// cross-backend tables can tell steady-state numbers from cold ones.
+var measureProtocols = map[string]string{
+	"cold":   "no warmup; the first, possibly page-faulting call is timed",
+	"warmup": "a fixed number of untimed calls (PCS_BENCH_WARMUP) before timing",
+	"steady": "untimed calls until five in a row vary by under 5%, at most 50",
+}
+
+// runOutput is what one execution of a driver binary reports.
+type runOutput struct {
+	Times []int64
+	// Warmup is the number of untimed calls made before Times.
+	Warmup int
+	// Sched is what the scheduler sampler saw, in builds with it (-sched)
+	Sched *schedStats
+	// Energy is what RAPL measured over the process (-energy)
+	Energy *energyUse
+	// CPU is the user+system CPU time of the whole process.
+	CPU time.Duration
+	// Usage is what else the OS accounted to it; nil for a process on
+	// another machine
+	Usage *resourceUsage
+	// Wall is the whole process's wall time, startup included.
+	Wall time.Duration
+}
+
+// timed is the time spent in the timed calls.
+func (out runOutput) timed() time.Duration {
+	var timed time.Duration
+	for _, ns := range out.Times {
+		timed += time.Duration(ns)
+	}
+	return timed
+}
+
+// runEnv is the execution environment of one benchmark process: its
+// GOMAXPROCS (0 inherits ours), the CPUs it is pinned to in taskset list
+// form ("" leaves the scheduler free), and its GOGC and GOMEMLIMIT (""
+// inherits ours).
+type runEnv struct {
+	Procs      int
+	CPUs       string
+	GOGC       string
+	GOMemLimit string
+	// PerfOut, when set, is the file perf stat appends counts to (-perf)
+	PerfOut string
+	// Seed shuffles lookup order in the driver (0 keeps its default)
+	Seed int64
+	// CPUProfile, when set, makes the driver write a CPU profile there
+	CPUProfile string
+	// Runner, when set, runs the binary for a cross-compiled target
+	// (-remote, -wasm)
+	Runner runner
+	// Timeout, when set, is how long one process may run (-timeout)
+	Timeout time.Duration
+	// Size is the input size, for binaries built for several (see
+	// sizedCode)
+	Size int
+	// Data, when set, is the input file of a data case (see
+	// writeDataInput)
+	Data string
+	// Trace, when set, makes a build with the scheduler sampler trace its
+	// timed calls there (-sched-trace)
+	Trace string
+	// Nice is added to the harness's niceness, through nice(1) or, on
+	// Windows, the priority class (-nice)
+	Nice int
+	// MaxRSS, when set, is the RSS in bytes at which the process is killed
+	// (-max-rss)
+	MaxRSS int64
+	// Cgroup, when set, confines the process to a cgroup of its own
+	// (-cgroup-cpus, -cgroup-memory)
+	Cgroup *cgroupConfiner
+}
+
+// command builds the exec.Cmd for binary under e. Niceness and pinning go
+// the way hostProc runs them (nice and taskset on Linux and remote
+// machines) and the cgroup through a shell, which all exec the binary in
+// place, so the process's rusage is the benchmark's own; under perf stat
+// it also includes perf's own small share.
+// The process is terminated if the run is interrupted.
+func (e runEnv) command(binary string, args ...string) *exec.Cmd {
+	var wrap []string
+	var cgroupErr error
+	if e.Cgroup != nil {
+		var dir string
+		if dir, cgroupErr = e.Cgroup.create(); cgroupErr == nil {
+			wrap = append(wrap, e.Cgroup.wrap(dir)...)
+		}
+	}
+	local := e.Runner == nil || e.Runner.local()
+	if local {
+		wrap = append(wrap, hostProc.wrap(e)...)
+	} else {
+		wrap = append(wrap, posixWrap(e)...)
+	}
+	if e.PerfOut != "" {
+		wrap = append(wrap, perfCommand(e.PerfOut)...)
+	}
+	// The crashed goroutine's stack, whatever GOTRACEBACK the harness
+	// runs under, for parseCrash
+	env := []string{"GOTRACEBACK=single"}
+	if e.Procs > 0 {
+		env = append(env, "GOMAXPROCS="+strconv.Itoa(e.Procs))
+	}
+	if e.GOGC != "" {
+		env = append(env, "GOGC="+e.GOGC)
+	}
+	if e.GOMemLimit != "" {
+		env = append(env, "GOMEMLIMIT="+e.GOMemLimit)
+	}
+	if e.Seed != 0 {
+		env = append(env, "PCS_BENCH_SEED="+strconv.FormatInt(e.Seed, 10))
+	}
+	if e.CPUProfile != "" {
+		env = append(env, "PCS_BENCH_CPUPROFILE="+e.CPUProfile)
+	}
+	if e.Size > 0 {
+		env = append(env, "PCS_BENCH_SIZE="+strconv.Itoa(e.Size))
+	}
+	if e.Data != "" {
+		env = append(env, "PCS_BENCH_DATA="+e.Data)
+	}
+	if e.Trace != "" {
+		env = append(env, "PCS_BENCH_TRACE="+e.Trace)
+	}
+	var cmd *exec.Cmd
+	if e.Runner != nil {
+		argv := e.Runner.argv(binary, env, wrap, args)
+		cmd = commandContext(argv[0], argv[1:]...)
+	} else {
+		argv := append(append(wrap, binary), args...)
+		cmd = commandContext(argv[0], argv[1:]...)
+		if env != nil {
+			cmd.Env = append(os.Environ(), env...)
+		}
+	}
+	if local {
+		hostProc.prepare(cmd, e)
+	}
+	if cgroupErr != nil {
+		// Start reports it
+		cmd.Err = fmt.Errorf("creating the cgroup: %v", cgroupErr)
+	}
+	return cmd
+}
+
+// runProgram executes a built driver binary and collects its per-iteration
+// timings under env (GOMAXPROCS and CPU pinning). measure selects what the
+// driver times ("" or "lookup"); protocol and fixed select the warmup.
+func runProgram(binary string, env runEnv, reps int, measure, protocol string, fixed int) (runOutput, error) {
+	if measure == "" {
+		measure = "build"
+	}
+	cmd := env.command(binary, strconv.Itoa(reps), measure, protocol, strconv.Itoa(fixed))
+	start := time.Now()
+	output, err := runWithin(cmd, env.Timeout, env.MaxRSS)
+	if err != nil {
+		return runOutput{}, err
+	}
+
+	out := runOutput{CPU: cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime(), Wall: time.Since(start)}
+	if env.Runner != nil && !env.Runner.local() {
+		out.CPU = 0 // the local process is only the runner's client
+	} else {
+		out.Usage = hostProc.usage(cmd.ProcessState)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "warmup "); ok {
+			if out.Warmup, err = strconv.Atoi(rest); err != nil {
+				return runOutput{}, fmt.Errorf("unexpected driver output %q", line)
+			}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "sched "); ok {
+			if out.Sched, err = parseSched(rest); err != nil {
+				return runOutput{}, err
+			}
+			continue
+		}
+		t, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return runOutput{}, fmt.Errorf("unexpected driver output %q", line)
+		}
+		out.Times = append(out.Times, t)
+	}
+	if len(out.Times) != reps {
+		return runOutput{}, fmt.Errorf("driver reported %d timings, want %d", len(out.Times), reps)
+	}
+	return out, nil
+}
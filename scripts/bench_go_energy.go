@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// -energy reads the RAPL (Running Average Power Limit) energy counters of
+// Intel and AMD processors, which Linux exposes under /sys/class/powercap,
+// before and after each timed process, so results report the energy a call
+// costs next to its latency. The counters cover the whole package (and
+// DRAM where the CPU meters it), not the benchmark process alone: idle
+// cores and anything else running are included, which -cpus and a quiet
+// machine keep small.
+
+// raplRoot is where the kernel's powercap framework lists RAPL zones.
+const raplRoot = "/sys/class/powercap"
+
+// raplZone matches the package zones (intel-rapl:0) and their subzones
+// (intel-rapl:0:2); AMD processors are listed under the same names.
+var raplZone = regexp.MustCompile(`^intel-rapl:\d+(:\d+)?$`)
+
+// raplDomain is one energy counter: a package, or the DRAM subzone of one.
+// The counter wraps to zero after MaxUJ microjoules.
+type raplDomain struct {
+	Name  string
+	Path  string
+	MaxUJ int64
+}
+
+// raplDomains lists the readable package and DRAM counters. Core and
+// uncore subzones are left out, as the package counter includes them.
+func raplDomains() []raplDomain {
+	var domains []raplDomain
+	for _, dir := range glob(filepath.Join(raplRoot, "intel-rapl:*")) {
+		zone := filepath.Base(dir)
+		if !raplZone.MatchString(zone) {
+			continue
+		}
+		name, err := os.ReadFile(filepath.Join(dir, "name"))
+		if err != nil {
+			continue
+		}
+		d := raplDomain{Name: strings.TrimSpace(string(name)), Path: filepath.Join(dir, "energy_uj")}
+		if strings.Count(zone, ":") == 2 && d.Name != "dram" {
+			continue
+		}
+		if _, ok := readInt(d.Path); !ok {
+			continue // energy_uj is root-only on kernels since 5.10 unless made readable
+		}
+		d.MaxUJ, _ = readInt(filepath.Join(dir, "max_energy_range_uj"))
+		domains = append(domains, d)
+	}
+	return domains
+}
+
+// energyReading is the counters of domains at one instant.
+type energyReading struct {
+	At  time.Time
+	UJ  []int64
+	Err error
+}
+
+func readEnergy(domains []raplDomain) energyReading {
+	r := energyReading{At: time.Now(), UJ: make([]int64, len(domains))}
+	for i, d := range domains {
+		uj, ok := readInt(d.Path)
+		if !ok {
+			r.Err = fmt.Errorf("reading %s", d.Path)
+		}
+		r.UJ[i] = uj
+	}
+	return r
+}
+
+// energyUse is the energy of a timed process per call, warmup calls and
+// process startup included as for CPUNs, and its average power draw.
+// Domains names the counters summed, e.g. package-0 and dram.
+type energyUse struct {
+	JoulesPerCall float64  `json:"joules_per_call"`
+	Watts         float64  `json:"watts"`
+	Domains       []string `json:"domains"`
+}
+
+// energyBetween is the use of domains from before to after over calls
+// calls, allowing for counters that wrapped once.
+func energyBetween(domains []raplDomain, before, after energyReading, calls int) (*energyUse, error) {
+	if before.Err != nil {
+		return nil, before.Err
+	}
+	if after.Err != nil {
+		return nil, after.Err
+	}
+	use := &energyUse{}
+	var uj int64
+	for i, d := range domains {
+		delta := after.UJ[i] - before.UJ[i]
+		if delta < 0 {
+			if d.MaxUJ <= 0 {
+				return nil, fmt.Errorf("%s wrapped with no max_energy_range_uj", d.Name)
+			}
+			delta += d.MaxUJ
+		}
+		uj += delta
+		use.Domains = append(use.Domains, d.Name)
+	}
+	joules := float64(uj) / 1e6
+	use.JoulesPerCall = joules / float64(max(calls, 1))
+	if elapsed := after.At.Sub(before.At).Seconds(); elapsed > 0 {
+		use.Watts = joules / elapsed
+	}
+	return use, nil
+}
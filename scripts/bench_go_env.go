@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// envSnapshot is what of the harness's surroundings can change timings
+// without showing up in the case definition: Go runtime and build settings
+// from the environment, the container's resource limits and whether the
+// machine is virtual. It is taken once per run and attached to every
+// result.
+type envSnapshot struct {
+	// Vars are the curated environment variables (see envVarPrefixes),
+	// with secret-looking values redacted
+	Vars map[string]string `json:"vars,omitempty"`
+	// CgroupCPUs is the CPU quota of the harness's cgroup, in CPUs
+	CgroupCPUs float64 `json:"cgroup_cpus,omitempty"`
+	// CgroupMemory is the memory limit of the harness's cgroup, in bytes
+	CgroupMemory int64 `json:"cgroup_memory_bytes,omitempty"`
+	// Virtualization is systemd-detect-virt's answer (kvm, docker, ...),
+	// else container or vm from weaker hints
+	Virtualization string `json:"virtualization,omitempty"`
+}
+
+// envVarPrefixes select the variables worth recording: the Go runtime and
+// toolchain (GOMAXPROCS, GOGC, GODEBUG, GOAMD64, ...), cgo, the harness's
+// own and the CI runner's.
+var envVarPrefixes = []string{"GO", "CGO_", "PCS_", "RUNNER_", "GITHUB_"}
+
+// envVarNames are further variables recorded by exact name.
+var envVarNames = map[string]bool{"CI": true, "CPU_INFO": true}
+
+// redacted replaces secret values in snapshots.
+const redacted = "[redacted]"
+
+var (
+	secretName  = regexp.MustCompile(`(?i)token|secret|passw|credential|auth|cookie|session|private|(^|_)key($|_)`)
+	secretValue = regexp.MustCompile(`^(gh[pousr]_|github_pat_|glpat-|xox[abpr]-|AKIA|sk-)`)
+)
+
+// takeEnvSnapshot reads the environment, cgroup limits and virtualization
+// of this process. It is nil when there is nothing to record.
+func takeEnvSnapshot() *envSnapshot {
+	s := &envSnapshot{Vars: map[string]string{}}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if envVarNames[name] || hasAnyPrefix(name, envVarPrefixes) {
+			s.Vars[name] = redactEnv(name, value)
+		}
+	}
+	if len(s.Vars) == 0 {
+		s.Vars = nil
+	}
+	s.CgroupCPUs, s.CgroupMemory = cgroupLimits()
+	s.Virtualization = detectVirtualization()
+	if s.Vars == nil && s.CgroupCPUs == 0 && s.CgroupMemory == 0 && s.Virtualization == "" {
+		return nil
+	}
+	return s
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactEnv hides the value of a variable whose name or value looks like a
+// credential, and the password of URLs with user info.
+func redactEnv(name, value string) string {
+	if secretName.MatchString(name) || secretValue.MatchString(value) {
+		return redacted
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return value
+}
+
+// cgroupLimits reads the CPU quota and memory limit of this process's
+// cgroup, under cgroup v2 or v1, as zero where unlimited or unreadable.
+func cgroupLimits() (cpus float64, memory int64) {
+	const root = "/sys/fs/cgroup"
+	read := func(parts ...string) string {
+		data, err := os.ReadFile(filepath.Join(append([]string{root}, parts...)...))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+	// v2: "<quota> <period>" or "max <period>"
+	quota, period, v2 := strings.Cut(read("cpu.max"), " ")
+	mem := read("memory.max")
+	if !v2 {
+		quota, period = read("cpu", "cpu.cfs_quota_us"), read("cpu", "cpu.cfs_period_us")
+		mem = read("memory", "memory.limit_in_bytes")
+	}
+	q, err1 := strconv.ParseFloat(quota, 64)
+	p, err2 := strconv.ParseFloat(period, 64)
+	if err1 == nil && err2 == nil && q > 0 && p > 0 {
+		cpus = q / p
+	}
+	// v1 reports no limit as a page-rounded maximum int64
+	if m, err := strconv.ParseInt(mem, 10, 64); err == nil && m < 1<<62 {
+		memory = m
+	}
+	return cpus, memory
+}
+
+// detectVirtualization asks systemd-detect-virt, falling back to container
+// marker files and the CPU's hypervisor flag.
+func detectVirtualization() string {
+	if v := commandOutput("systemd-detect-virt"); v != "" && v != "none" {
+		return v
+	}
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return "container"
+		}
+	}
+	if data, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if key, flags, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "flags" {
+				if slices.Contains(strings.Fields(flags), "hypervisor") {
+					return "vm"
+				}
+				break
+			}
+		}
+	}
+	return ""
+}
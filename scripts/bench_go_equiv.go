@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runParallelCheck implements `parallel-check`: benchmarks aside, it runs
+// the sequential and parallel renderings of every parallel case's snippet
+// at sizes where chunking goes wrong first (empty and one-element ranges,
+// primes, multiples of the worker count and their neighbours) and reports
+// any size where the two disagree.
+//
+// Generated parallel code starts one worker per GOMAXPROCS, which the Go
+// runtime sets to the CPUs the program may run on, so on Linux each worker
+// count is tried by pinning the program to that many CPUs.
+func runParallelCheck(args []string) int {
+	fs := flag.NewFlagSet("parallel-check", flag.ExitOnError)
+	sizesFlag := fs.String("sizes", "", "comma-separated N to check (default: edge cases for each worker count)")
+	workersFlag := fs.String("workers", "", "comma-separated worker counts to pin the program to (default: powers of two up to the CPU count, on Linux)")
+	timeout := fs.Duration("timeout", 30*time.Second, "limit on each run of a checked program")
+	cacheDir := fs.String("cache", "target/go_bench_cache", "directory caching generated code by content hash")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench parallel-check [flags]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	handleInterrupts()
+
+	workers, err := checkWorkers(*workersFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parallel-check: -workers: %v\n", err)
+		return 2
+	}
+	sizes := edgeSizes(workers)
+	if *sizesFlag != "" {
+		// Unlike -sizes of run, 0 is a size worth checking here
+		sizes = nil
+		for _, f := range strings.Split(*sizesFlag, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil || n < 0 {
+				fmt.Fprintf(os.Stderr, "parallel-check: -sizes: invalid size %q\n", f)
+				return 2
+			}
+			sizes = append(sizes, n)
+		}
+	}
+	cache, err := openBuildCache(*cacheDir, "pcs")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parallel-check: -cache: %v\n", err)
+		return 2
+	}
+	defer cache.close()
+	dir, err := os.MkdirTemp("", "pcs-parallel-check-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parallel-check: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	be, err := lookupBackend("go")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parallel-check: %v\n", err)
+		return 1
+	}
+	checked, failed := 0, 0
+	for _, tc := range parallelSnippets() {
+		if interrupted() {
+			break
+		}
+		name := tc.Test + "_" + tc.Mode
+		seq := tc
+		seq.Parallel = false
+		seqBuilds := &snippetBuilds{runner: be.Runner, cache: cache, tc: seq, dir: filepath.Join(dir, name+"_seq"), sizes: sizes}
+		parBuilds := &snippetBuilds{runner: be.Runner, cache: cache, tc: tc, dir: filepath.Join(dir, name+"_par"), sizes: sizes}
+		before := failed
+	check:
+		for _, n := range sizes {
+			want, err := seqBuilds.result(n, runEnv{Timeout: *timeout})
+			if err != nil {
+				failed++
+				fmt.Printf("FAIL  %s n=%d sequential: %v\n", name, n, err)
+				break
+			}
+			for _, w := range workers {
+				if interrupted() {
+					break check
+				}
+				env := runEnv{Timeout: *timeout}
+				if w > 0 {
+					env.CPUs = "0-" + strconv.Itoa(w-1)
+				}
+				got, err := parBuilds.result(n, env)
+				if err == nil {
+					err = checkResult(got, want, "sequential")
+				}
+				checked++
+				if err == nil {
+					continue
+				}
+				failed++
+				fmt.Printf("FAIL  %s n=%d workers=%s: %v\n", name, n, workerLabel(w), err)
+				var wrong *wrongResultError
+				if !errors.As(err, &wrong) {
+					// A build or run failure repeats at every other size
+					break check
+				}
+			}
+		}
+		if failed == before && !interrupted() {
+			fmt.Printf("ok    %s\n", name)
+		}
+	}
+	fmt.Printf("parallel-check: %d comparisons, %d failed\n", checked, failed)
+	if interrupted() {
+		return exitInterrupted
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// parallelSnippets are the parallel host cases of the benchmark matrix
+// built by gc, one per distinct snippet and flags.
+func parallelSnippets() []benchCase {
+	var out []benchCase
+	seen := map[string]bool{}
+	for _, tc := range benchCases() {
+		if !tc.Parallel || tc.Stream != "" || tc.Target != "" || tc.toolchain() != "gc" {
+			continue
+		}
+		key := strings.Join(generatorArgs(tc, 0), "\x00")
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, tc)
+		}
+	}
+	return out
+}
+
+// checkWorkers parses -workers, defaulting to procsLevels of the CPU count
+// on Linux. 0 stands for an unpinned run, the only one elsewhere.
+func checkWorkers(list string) ([]int, error) {
+	if list == "" {
+		if runtime.GOOS != "linux" || runtime.NumCPU() == 1 {
+			return []int{0}, nil
+		}
+		return procsLevels(runtime.NumCPU()), nil
+	}
+	var workers []int
+	for _, f := range strings.Split(list, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || w < 1 {
+			return nil, fmt.Errorf("invalid worker count %q", f)
+		}
+		if _, _, err := checkAffinity("0-" + strconv.Itoa(w-1)); err != nil {
+			return nil, err
+		}
+		workers = append(workers, w)
+	}
+	return workers, nil
+}
+
+func workerLabel(w int) string {
+	if w == 0 {
+		return strconv.Itoa(runtime.NumCPU())
+	}
+	return strconv.Itoa(w)
+}
+
+// edgeSizes are the N each snippet is checked at. The snippets range over
+// 1..N-1, so N = k*w+1 fills k chunks of w workers exactly and k*w and
+// k*w+2 fall either side of that.
+func edgeSizes(workers []int) []int {
+	set := map[int]bool{0: true, 1: true, 2: true, 3: true, 7: true, 13: true, 101: true, 1009: true}
+	for _, w := range workers {
+		if w == 0 {
+			w = runtime.NumCPU()
+		}
+		for k := 1; k <= 3; k++ {
+			set[k*w], set[k*w+1], set[k*w+2] = true, true, true
+		}
+		set[w*w+1] = true
+	}
+	var sizes []int
+	for n := range set {
+		sizes = append(sizes, n)
+	}
+	sort.Ints(sizes)
+	return sizes
+}
+
+// snippetBuilds builds one rendering of a snippet: once for every size when
+// the runner can render it so (see sizedCode), else once per size.
+type snippetBuilds struct {
+	runner BackendRunner
+	cache  *buildCache
+	tc     benchCase
+	dir    string
+	sizes  []int
+
+	tried  bool
+	sized  *builtProgram
+	latest *builtProgram
+}
+
+type builtProgram struct {
+	n      int
+	prog   program
+	binary string
+}
+
+// result runs the build for size n once and returns its canonical result.
+func (b *snippetBuilds) result(n int, env runEnv) ([]byte, error) {
+	v, ok := b.runner.(verifier)
+	if !ok {
+		return nil, fmt.Errorf("the runner cannot report results")
+	}
+	if !b.tried {
+		b.tried = true
+		if sg, ok := b.runner.(sizedGenerator); ok {
+			if code := sg.GenerateSized(b.cache, b.tc, b.sizes); code != nil {
+				built, err := b.build(code, 0)
+				if err != nil {
+					return nil, err
+				}
+				b.sized = built
+			}
+		}
+	}
+	built := b.sized
+	if built != nil {
+		env.Size = n
+	} else if b.latest != nil && b.latest.n == n {
+		built = b.latest
+	} else {
+		code, _, err := b.runner.Generate(b.cache, b.tc, n)
+		if err != nil {
+			return nil, fmt.Errorf("generate: %w", err)
+		}
+		if built, err = b.build(code, n); err != nil {
+			return nil, err
+		}
+		b.latest = built
+	}
+	out, err := v.Result(b.tc, built.prog, built.binary, env)
+	if err != nil {
+		return nil, fmt.Errorf("run: %w", err)
+	}
+	return out, nil
+}
+
+func (b *snippetBuilds) build(code []byte, n int) (*builtProgram, error) {
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return nil, err
+	}
+	prog, err := b.runner.Build(b.tc, code, filepath.Join(b.dir, "check"), n)
+	if err != nil {
+		return nil, err
+	}
+	binary := filepath.Join(b.dir, "check_bin")
+	cmd, err := prog.Compile(binary)
+	if err != nil {
+		return nil, fmt.Errorf("compile: %w", err)
+	}
+	if log, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("compile: %w", &commandError{cmd.Args, err, log})
+	}
+	return &builtProgram{n: n, prog: prog, binary: binary}, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Failed results carry an ErrorClass from this list next to the Error
+// message, and what is known about the failing process in ErrorDetail, so
+// failures can be counted by kind without parsing messages.
+const (
+	// errSetup: the harness could not prepare the case (artifact
+	// directories, invalid settings, a runner that would not take the
+	// binary)
+	errSetup = "setup_failed"
+	// errCodegen: pcs could not render the case, its sources could not be
+	// written, or they do not parse as Go
+	errCodegen = "codegen_failed"
+	// errCompile: the toolchain rejected the generated code
+	errCompile = "compile_failed"
+	// errRuntime: the benchmark process failed or misreported its timings
+	errRuntime = "runtime_failed"
+	// errTimeout: the benchmark process outlived -timeout
+	errTimeout = "timeout"
+	// errOOM: the benchmark process ran out of memory, by the Go runtime's
+	// account or the kernel's OOM killer
+	errOOM = "oom"
+	// errOOMGuard: the harness killed the benchmark process for exceeding
+	// -max-rss
+	errOOMGuard = "oom_guard"
+)
+
+// errorDetail describes the process behind a failure.
+type errorDetail struct {
+	// Command is the failing command line, shell-quoted
+	Command  string `json:"command,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+	// Output is the end of the process's stderr or build log
+	Output    string `json:"output,omitempty"`
+	TimeoutNs int64  `json:"timeout_ns,omitempty"`
+	// RSSBytes is the resident set size the process was killed at, over
+	// RSSLimitBytes (-max-rss)
+	RSSBytes      int64 `json:"rss_bytes,omitempty"`
+	RSSLimitBytes int64 `json:"rss_limit_bytes,omitempty"`
+	// Crash is the Go runtime's report of a panic, fatal error or
+	// crashing signal (errCrash)
+	Crash *crashReport `json:"crash,omitempty"`
+}
+
+// How much of a failing process's output is kept: the last lines, and at
+// most this many bytes of them.
+const (
+	errorOutputLines = 20
+	errorOutputBytes = 4096
+)
+
+// commandError is a failed command with its arguments and output. Its
+// message adds the first diagnostic of the output to the exit status, so
+// the error line alone shows what went wrong.
+type commandError struct {
+	args   []string
+	err    error
+	output []byte
+}
+
+func (e *commandError) Error() string {
+	// A crash's report starts with the panic, then points at where it was
+	if crash := parseCrash(e.output, exitSignal(e.err)); crash != nil {
+		return e.err.Error() + ": " + crash.String()
+	}
+	for _, line := range strings.Split(string(e.output), "\n") {
+		// go build heads its diagnostics with "# package"
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			return e.err.Error() + ": " + line
+		}
+	}
+	return e.err.Error()
+}
+
+func (e *commandError) Unwrap() error { return e.err }
+
+// timeoutError is a benchmark process killed after its time limit.
+type timeoutError struct {
+	limit time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("killed after the %v timeout", e.limit)
+}
+
+// runWithin runs cmd to completion like Output, terminating it when it
+// takes longer than limit and killing it when its RSS exceeds maxRSS bytes
+// (no limit when zero). Stdout is returned unless the caller redirected it;
+// stderr is kept for the error.
+func runWithin(cmd *exec.Cmd, limit time.Duration, maxRSS int64) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	if cmd.Stdout == nil {
+		cmd.Stdout = &stdout
+	}
+	cmd.Stderr = &stderr
+	if err := hostProc.start(cmd); err != nil {
+		return nil, err
+	}
+	var timedOut atomic.Bool
+	if limit > 0 {
+		timer := time.AfterFunc(limit, func() {
+			timedOut.Store(true)
+			cmd.Cancel()
+		})
+		defer timer.Stop()
+	}
+	var overRSS <-chan error
+	if maxRSS > 0 {
+		stop := make(chan struct{})
+		overRSS = watchRSS(cmd.Process.Pid, maxRSS, stop)
+		defer close(stop)
+	}
+	err := cmd.Wait()
+	if timedOut.Load() {
+		err = &timeoutError{limit}
+	}
+	if overRSS != nil {
+		select {
+		case rssErr := <-overRSS:
+			err = rssErr
+		default:
+		}
+	}
+	if err != nil {
+		return nil, &commandError{cmd.Args, err, stderr.Bytes()}
+	}
+	return stdout.Bytes(), nil
+}
+
+// describeError is the detail of err, nil when there is none.
+func describeError(err error) *errorDetail {
+	d := &errorDetail{}
+	var timeout *timeoutError
+	if errors.As(err, &timeout) {
+		d.TimeoutNs = timeout.limit.Nanoseconds()
+	}
+	var overRSS *rssLimitError
+	if errors.As(err, &overRSS) {
+		d.RSSBytes, d.RSSLimitBytes = overRSS.rss, overRSS.limit
+	}
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		d.ExitCode = exit.ExitCode()
+		d.Signal = exitSignal(err)
+	}
+	var command *commandError
+	if errors.As(err, &command) {
+		d.Crash = parseCrash(command.output, d.Signal)
+		quoted := make([]string, len(command.args))
+		for i, a := range command.args {
+			quoted[i] = shellQuote(a)
+		}
+		d.Command = strings.Join(quoted, " ")
+		d.Output = lastLines(command.output, errorOutputLines, errorOutputBytes)
+	}
+	if *d == (errorDetail{}) {
+		return nil
+	}
+	return d
+}
+
+// exitSignal is the signal that killed the process err reports the exit
+// of, empty if it exited.
+func exitSignal(err error) string {
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		if status, ok := exit.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return status.Signal().String()
+		}
+	}
+	return ""
+}
+
+// runErrorClass classifies a failure of a benchmark process.
+func runErrorClass(err error) string {
+	var timeout *timeoutError
+	if errors.As(err, &timeout) {
+		return errTimeout
+	}
+	var overRSS *rssLimitError
+	if errors.As(err, &overRSS) {
+		return errOOMGuard
+	}
+	d := describeError(err)
+	if d == nil {
+		return errRuntime
+	}
+	// The OOM killer sends SIGKILL; container engines report it as 137
+	if d.Signal == syscall.SIGKILL.String() || d.ExitCode == 137 ||
+		strings.Contains(d.Output, "out of memory") {
+		return errOOM
+	}
+	if d.Crash != nil {
+		return errCrash
+	}
+	return errRuntime
+}
+
+// lastLines is the end of b: its last n lines, cut to the last max bytes.
+func lastLines(b []byte, n, max int) string {
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	s := strings.Join(lines, "\n")
+	if len(s) > max {
+		s = "..." + s[len(s)-max:]
+	}
+	return s
+}
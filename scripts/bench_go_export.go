@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Teams already running Bencher or Codespeed can feed them PCS results
+// through `export`, which reshapes measured records into each service's
+// upload format. Failed and skipped records are left out. It also writes
+// Google Benchmark JSON (see toGBench).
+
+// exportName names a result's benchmark in the exported formats, e.g.
+// go/dict_comp/loops/n=10000, with the target of cross-compiled cases.
+func exportName(r BenchmarkResult) string {
+	name := r.Backend + "/" + r.Test + "/" + r.Mode + "/n=" + strconv.Itoa(r.N)
+	if r.Target != "" {
+		name += "/" + r.Target
+	}
+	return name
+}
+
+// bencherMetric is a measure in the Bencher Metric Format.
+type bencherMetric struct {
+	Value      float64  `json:"value"`
+	LowerValue *float64 `json:"lower_value,omitempty"`
+	UpperValue *float64 `json:"upper_value,omitempty"`
+}
+
+// toBencher reshapes results into the Bencher Metric Format: benchmark name
+// to measure to metric. Latency is the mean in nanoseconds, bounded by one
+// standard deviation either side; records of the same benchmark keep the
+// last one.
+func toBencher(results []BenchmarkResult) map[string]map[string]bencherMetric {
+	out := map[string]map[string]bencherMetric{}
+	for _, r := range results {
+		if !r.measured() {
+			continue
+		}
+		mean, std := float64(r.MeanNs), float64(r.StdNs)
+		lower, upper := max(mean-std, 0), mean+std
+		out[exportName(r)] = map[string]bencherMetric{
+			"latency": {Value: mean, LowerValue: &lower, UpperValue: &upper},
+		}
+	}
+	return out
+}
+
+// codespeedResult is one entry of Codespeed's /result/add/json/ payload.
+type codespeedResult struct {
+	CommitID    string   `json:"commitid"`
+	Branch      string   `json:"branch"`
+	Project     string   `json:"project"`
+	Executable  string   `json:"executable"`
+	Benchmark   string   `json:"benchmark"`
+	Environment string   `json:"environment"`
+	ResultValue float64  `json:"result_value"`
+	ResultDate  string   `json:"result_date,omitempty"`
+	StdDev      *float64 `json:"std_dev,omitempty"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+}
+
+// toCodespeed reshapes results into Codespeed results, in seconds (its
+// default unit). The executable is the backend and toolchain, the
+// environment the CPU and OS unless set; the branch comes from the
+// results' git metadata unless set.
+func toCodespeed(results []BenchmarkResult, project, branch, environment string) []codespeedResult {
+	var out []codespeedResult
+	for _, r := range results {
+		if !r.measured() {
+			continue
+		}
+		c := codespeedResult{
+			CommitID:    r.Commit,
+			Branch:      branch,
+			Project:     project,
+			Executable:  r.Backend,
+			Benchmark:   r.Test + "/" + r.Mode + "/n=" + strconv.Itoa(r.N),
+			Environment: environment,
+			ResultValue: float64(r.MeanNs) / 1e9,
+		}
+		if r.Toolchain != "" {
+			c.Executable += " " + r.Toolchain
+		}
+		if r.Target != "" {
+			c.Benchmark += "/" + r.Target
+		}
+		if c.Branch == "" && r.Git != nil {
+			c.Branch = r.Git.Branch
+		}
+		if c.Branch == "" {
+			c.Branch = "default"
+		}
+		if c.Environment == "" {
+			c.Environment = r.CPU + " " + r.OS
+		}
+		if t, err := time.Parse(time.RFC3339, r.Timestamp); err == nil {
+			c.ResultDate = t.UTC().Format("2006-01-02 15:04:05")
+		}
+		std := float64(r.StdNs) / 1e9
+		c.StdDev = &std
+		if len(r.Samples) > 0 {
+			lo, hi := float64(slices.Min(r.Samples))/1e9, float64(slices.Max(r.Samples))/1e9
+			c.Min, c.Max = &lo, &hi
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// runExport implements `export`.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "bencher", "output format: bencher (Bencher Metric Format), codespeed (/result/add/json/ payload) or gbench (Google Benchmark JSON)")
+	out := fs.String("o", "", "file to write (default stdout)")
+	project := fs.String("project", "pcs", "Codespeed project")
+	branch := fs.String("branch", "", "Codespeed branch (default: the results' branch, else default)")
+	environment := fs.String("environment", "", "Codespeed environment (default: each result's CPU and OS)")
+	redact := fs.Bool("redact", false, "hash the hostname and username and strip or hash file paths, as run -redact does")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench export [-format bencher|codespeed|gbench] [-o file.json] [-redact] results.ndjson...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	results, err := readResults(fs.Args()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	if *redact {
+		redaction = newRedactor()
+		for i := range results {
+			results[i] = redaction.result(results[i])
+		}
+	}
+	var payload any
+	switch *format {
+	case "bencher":
+		payload = toBencher(results)
+	case "codespeed":
+		payload = toCodespeed(results, *project, *branch, *environment)
+	case "gbench":
+		payload = toGBench(results)
+	default:
+		fmt.Fprintf(os.Stderr, "export: unknown format %q (want bencher, codespeed or gbench)\n", *format)
+		return 2
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "export: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(payload); err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	return 0
+}
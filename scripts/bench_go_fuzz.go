@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The fuzz command generates random comprehensions within the grammar pcs
+// accepts, renders each through the Go backend, builds and runs it, and
+// checks its result against Python's (see verifyCase). A failing case is
+// shrunk to a smaller one failing the same way before it is reported.
+
+// fuzzExpr is an integer or, when Bool is set, a boolean expression over
+// the loop variables. A leaf has no Op and holds a variable or literal.
+type fuzzExpr struct {
+	Op   string
+	Leaf string
+	Args []*fuzzExpr
+	Bool bool
+}
+
+func (e *fuzzExpr) String() string {
+	switch {
+	case e.Op == "":
+		return e.Leaf
+	case e.Op == "not":
+		return "not (" + e.Args[0].String() + ")"
+	}
+	return "(" + e.Args[0].String() + " " + e.Op + " " + e.Args[1].String() + ")"
+}
+
+// uses reports whether v occurs in e.
+func (e *fuzzExpr) uses(v string) bool {
+	if e.Op == "" {
+		return e.Leaf == v
+	}
+	for _, a := range e.Args {
+		if a.uses(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// shrinks are e with one node replaced by something simpler: one of its
+// operands of the same type, or for integers a literal.
+func (e *fuzzExpr) shrinks() []*fuzzExpr {
+	var out []*fuzzExpr
+	for _, a := range e.Args {
+		if a.Bool == e.Bool {
+			out = append(out, a)
+		}
+	}
+	if !e.Bool {
+		for _, lit := range []string{"0", "1"} {
+			if e.Leaf != lit {
+				out = append(out, &fuzzExpr{Leaf: lit})
+			}
+		}
+	}
+	for i, a := range e.Args {
+		for _, s := range a.shrinks() {
+			c := *e
+			c.Args = append([]*fuzzExpr(nil), e.Args...)
+			c.Args[i] = s
+			out = append(out, &c)
+		}
+	}
+	return out
+}
+
+// fuzzFor is one `for Var in range(Start, Stop, Step) if ...` clause.
+type fuzzFor struct {
+	Var               string
+	Start, Stop, Step int
+	Filters           []*fuzzExpr
+}
+
+func (g fuzzFor) String() string {
+	r := fmt.Sprintf("range(%d, %d)", g.Start, g.Stop)
+	if g.Step != 1 {
+		r = fmt.Sprintf("range(%d, %d, %d)", g.Start, g.Stop, g.Step)
+	}
+	s := "for " + g.Var + " in " + r
+	for _, f := range g.Filters {
+		s += " if " + f.String()
+	}
+	return s
+}
+
+// fuzzCase is a generated comprehension: Kind list, set or dict, or the
+// reduction wrapping a generator expression (sum, max, min, any, all).
+// Value is the dict's value, Elem its key or the element otherwise.
+type fuzzCase struct {
+	Kind     string
+	Elem     *fuzzExpr
+	Value    *fuzzExpr
+	Fors     []fuzzFor
+	Parallel bool
+}
+
+func (c fuzzCase) String() string {
+	var fors []string
+	for _, g := range c.Fors {
+		fors = append(fors, g.String())
+	}
+	tail := " " + strings.Join(fors, " ")
+	switch c.Kind {
+	case "list":
+		return "[" + c.Elem.String() + tail + "]"
+	case "set":
+		return "{" + c.Elem.String() + tail + "}"
+	case "dict":
+		return "{" + c.Elem.String() + ": " + c.Value.String() + tail + "}"
+	}
+	return c.Kind + "(" + c.Elem.String() + tail + ")"
+}
+
+// cost orders cases for shrinking: shorter code over fewer iterations.
+func (c fuzzCase) cost() int {
+	n := len(c.String())
+	for _, g := range c.Fors {
+		n += max(g.Stop-g.Start, g.Start-g.Stop)
+	}
+	if c.Parallel {
+		n++
+	}
+	return n
+}
+
+// shrinks are the one-step simplifications of c, biggest first.
+func (c fuzzCase) shrinks() []fuzzCase {
+	var out []fuzzCase
+	with := func(edit func(*fuzzCase)) {
+		d := c
+		d.Fors = append([]fuzzFor(nil), c.Fors...)
+		for i := range d.Fors {
+			d.Fors[i].Filters = append([]*fuzzExpr(nil), c.Fors[i].Filters...)
+		}
+		edit(&d)
+		out = append(out, d)
+	}
+	for i, g := range c.Fors {
+		if len(c.Fors) > 1 && !c.uses(g.Var) {
+			with(func(d *fuzzCase) { d.Fors = append(d.Fors[:i], d.Fors[i+1:]...) })
+		}
+	}
+	for i, g := range c.Fors {
+		for j := range g.Filters {
+			with(func(d *fuzzCase) { d.Fors[i].Filters = append(d.Fors[i].Filters[:j], d.Fors[i].Filters[j+1:]...) })
+		}
+	}
+	if c.Parallel {
+		with(func(d *fuzzCase) { d.Parallel = false })
+	}
+	for i, g := range c.Fors {
+		if span := g.Stop - g.Start; span/2 != 0 {
+			with(func(d *fuzzCase) { d.Fors[i].Stop = g.Start + span/2 })
+		}
+		if g.Start != 0 {
+			with(func(d *fuzzCase) { d.Fors[i].Start, d.Fors[i].Stop = 0, g.Stop-g.Start })
+		}
+		if g.Step != 1 && g.Step > 0 {
+			with(func(d *fuzzCase) { d.Fors[i].Step = 1 })
+		}
+	}
+	for _, s := range c.Elem.shrinks() {
+		with(func(d *fuzzCase) { d.Elem = s })
+	}
+	if c.Value != nil {
+		for _, s := range c.Value.shrinks() {
+			with(func(d *fuzzCase) { d.Value = s })
+		}
+	}
+	for i, g := range c.Fors {
+		for j, f := range g.Filters {
+			for _, s := range f.shrinks() {
+				with(func(d *fuzzCase) { d.Fors[i].Filters[j] = s })
+			}
+		}
+	}
+	return out
+}
+
+// uses reports whether v occurs outside its own for clause.
+func (c fuzzCase) uses(v string) bool {
+	if c.Elem.uses(v) || c.Value != nil && c.Value.uses(v) {
+		return true
+	}
+	for _, g := range c.Fors {
+		if g.Var == v {
+			continue
+		}
+		for _, f := range g.Filters {
+			if f.uses(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fuzzGen draws random cases.
+type fuzzGen struct {
+	rng      *rand.Rand
+	maxRange int
+	depth    int
+	parallel float64
+}
+
+var fuzzVars = []string{"x", "y"}
+
+func (f *fuzzGen) pick(options ...string) string {
+	return options[f.rng.Intn(len(options))]
+}
+
+// intExpr is an integer expression over vars. Divisors are positive
+// literals, so no case divides by zero; the operands may be negative.
+func (f *fuzzGen) intExpr(vars []string, depth int) *fuzzExpr {
+	if depth == 0 || f.rng.Intn(3) == 0 {
+		if f.rng.Intn(10) < 7 {
+			return &fuzzExpr{Leaf: vars[f.rng.Intn(len(vars))]}
+		}
+		return &fuzzExpr{Leaf: strconv.Itoa(f.rng.Intn(15) - 5)}
+	}
+	op := f.pick("+", "-", "*", "%", "//")
+	right := f.intExpr(vars, depth-1)
+	if op == "%" || op == "//" {
+		right = &fuzzExpr{Leaf: strconv.Itoa(1 + f.rng.Intn(7))}
+	}
+	return &fuzzExpr{Op: op, Args: []*fuzzExpr{f.intExpr(vars, depth-1), right}}
+}
+
+func (f *fuzzGen) boolExpr(vars []string, depth int) *fuzzExpr {
+	if depth > 0 {
+		switch f.rng.Intn(6) {
+		case 0:
+			return &fuzzExpr{Op: "not", Args: []*fuzzExpr{f.boolExpr(vars, depth-1)}, Bool: true}
+		case 1:
+			return &fuzzExpr{Op: f.pick("and", "or"), Args: []*fuzzExpr{f.boolExpr(vars, depth-1), f.boolExpr(vars, depth-1)}, Bool: true}
+		}
+	}
+	left := f.intExpr(vars, max(depth-1, 0))
+	right := &fuzzExpr{Leaf: strconv.Itoa(f.rng.Intn(10))}
+	if f.rng.Intn(3) == 0 {
+		right = f.intExpr(vars, 0)
+	}
+	return &fuzzExpr{Op: f.pick("==", "!=", "<", "<=", ">", ">="), Args: []*fuzzExpr{left, right}, Bool: true}
+}
+
+func (f *fuzzGen) forClause(v string, vars []string) fuzzFor {
+	g := fuzzFor{Var: v, Start: f.rng.Intn(16) - 5, Step: 1}
+	g.Stop = g.Start + f.rng.Intn(f.maxRange+1)
+	switch f.rng.Intn(8) {
+	case 0:
+		g.Step = -1 - f.rng.Intn(2)
+		g.Start, g.Stop = g.Stop, g.Start
+	case 1, 2:
+		g.Step = 2 + f.rng.Intn(2)
+	}
+	for n := f.rng.Intn(3); n > 0; n-- {
+		g.Filters = append(g.Filters, f.boolExpr(vars, f.depth))
+	}
+	return g
+}
+
+func (f *fuzzGen) next() fuzzCase {
+	c := fuzzCase{Kind: f.pick("list", "set", "dict", "sum", "max", "min", "any", "all")}
+	vars := fuzzVars[:1]
+	c.Fors = append(c.Fors, f.forClause(vars[0], vars))
+	if f.rng.Intn(3) == 0 {
+		vars = fuzzVars[:2]
+		c.Fors = append(c.Fors, f.forClause(vars[1], vars))
+	}
+	if c.Kind == "any" || c.Kind == "all" {
+		c.Elem = f.boolExpr(vars, f.depth)
+	} else {
+		c.Elem = f.intExpr(vars, f.depth)
+	}
+	if c.Kind == "dict" {
+		c.Value = f.intExpr(vars, f.depth)
+	}
+	c.Parallel = f.rng.Float64() < f.parallel
+	return c
+}
+
+// fuzzFinding is one reported failure, as written to -out.
+type fuzzFinding struct {
+	Seed      int64  `json:"seed"`
+	Case      int    `json:"case"`
+	Class     string `json:"error_class"`
+	Code      string `json:"code"`
+	Minimized string `json:"minimized"`
+	Parallel  bool   `json:"parallel"`
+	Error     string `json:"error"`
+}
+
+// fuzzer checks cases in a scratch directory.
+type fuzzer struct {
+	dir     string
+	timeout time.Duration
+	refs    referenceCache
+}
+
+// check renders, builds and runs c and compares its result with Python's.
+// class is "" when they agree and "invalid" when Python itself fails (say,
+// max() of nothing), which is not the backend's fault.
+func (z *fuzzer) check(c fuzzCase) (class, msg string) {
+	tc := benchCase{Test: "fuzz", Mode: "loops", Code: c.String(), Parallel: c.Parallel}
+	want, err := z.refs.reference(tc, 0, "", z.timeout)
+	if err != nil {
+		return "invalid", err.Error()
+	}
+	args := []string{"--target", "go", "--code", tc.Code}
+	if c.Parallel {
+		args = append(args, "--parallel")
+	}
+	code, err := runPCS("", z.timeout, args...)
+	if err != nil {
+		return errCodegen, err.Error()
+	}
+	var r goRunner
+	prog, err := r.Build(tc, code, filepath.Join(z.dir, "fuzz"), 0)
+	if err != nil {
+		return errCodegen, err.Error()
+	}
+	binary := filepath.Join(z.dir, "fuzz_bin")
+	cmd, err := prog.Compile(binary)
+	if err == nil {
+		_, err = runWithin(cmd, z.timeout, 0)
+	}
+	if err != nil {
+		return errCompile, err.Error()
+	}
+	got, err := r.Result(tc, prog, binary, runEnv{Timeout: z.timeout})
+	if err != nil {
+		return runErrorClass(err), err.Error()
+	}
+	if err := checkResult(got, want, "Python"); err != nil {
+		return errWrongResult, err.Error()
+	}
+	return "", ""
+}
+
+// minimize shrinks c while it keeps failing with class, trying at most
+// budget candidates, and returns the smallest case with its message.
+func (z *fuzzer) minimize(c fuzzCase, class, msg string, budget int) (fuzzCase, string) {
+	for improved := true; improved && budget > 0; {
+		improved = false
+		for _, s := range c.shrinks() {
+			if budget == 0 || interrupted() {
+				break
+			}
+			if s.cost() >= c.cost() {
+				continue
+			}
+			budget--
+			if got, m := z.check(s); got == class {
+				c, msg, improved = s, m, true
+				break
+			}
+		}
+	}
+	return c, msg
+}
+
+// runFuzz implements `fuzz`: a differential fuzzer of the Go backend
+// against Python.
+func runFuzz(args []string) int {
+	fs := flag.NewFlagSet("fuzz", flag.ExitOnError)
+	cases := fs.Int("cases", 100, "random cases to check")
+	seed := fs.Int64("seed", 0, "random seed (0: from the clock; printed for reruns)")
+	maxRange := fs.Int("max-range", 40, "largest number of iterations of one for clause")
+	depth := fs.Int("depth", 2, "nesting depth of generated expressions")
+	parallel := fs.Float64("parallel", 0.25, "fraction of cases rendered with --parallel")
+	budget := fs.Int("shrink", 200, "most candidates tried when minimizing one failure")
+	timeout := fs.Duration("timeout", 30*time.Second, "limit on each pcs, go build, program and python3 process")
+	out := fs.String("out", "", "append findings as NDJSON to this file")
+	fs.StringVar(&codegenMode, "codegen", codegenMode, "how to render cases: auto, native or python (see run -codegen)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench fuzz [flags]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if _, ok := codegenModes[codegenMode]; !ok {
+		fmt.Fprintf(os.Stderr, "fuzz: unknown -codegen %q (want auto, native or python)\n", codegenMode)
+		return 2
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	fmt.Fprintf(os.Stderr, "fuzz: seed %d\n", *seed)
+	handleInterrupts()
+
+	dir, err := os.MkdirTemp("", "pcs-fuzz-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fuzz: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	var sink *os.File
+	if *out != "" {
+		if sink, err = os.OpenFile(*out, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "fuzz: %v\n", err)
+			return 1
+		}
+		defer sink.Close()
+	}
+
+	gen := &fuzzGen{rng: rand.New(rand.NewSource(*seed)), maxRange: *maxRange, depth: *depth, parallel: *parallel}
+	z := &fuzzer{dir: dir, timeout: *timeout}
+	seen := map[string]bool{}
+	checked, invalid, findings := 0, 0, 0
+	for i := 1; i <= *cases && !interrupted(); i++ {
+		c := gen.next()
+		class, msg := z.check(c)
+		if interrupted() {
+			break
+		}
+		checked++
+		switch class {
+		case "":
+			continue
+		case "invalid":
+			invalid++
+			continue
+		}
+		small, msg := z.minimize(c, class, msg, *budget)
+		key := class + " " + strconv.FormatBool(small.Parallel) + " " + small.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		findings++
+		f := fuzzFinding{Seed: *seed, Case: i, Class: class, Code: c.String(), Minimized: small.String(), Parallel: small.Parallel, Error: msg}
+		flags := ""
+		if f.Parallel {
+			flags = " (--parallel)"
+		}
+		detail, _, _ := strings.Cut(msg, "\n")
+		fmt.Printf("%s in case %d:\n  %s\n  minimized%s: %s\n  %s\n", class, i, f.Code, flags, f.Minimized, detail)
+		if sink != nil {
+			json.NewEncoder(sink).Encode(f)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "fuzz: %d cases, %d invalid in Python, %d distinct failures\n", checked, invalid, findings)
+	if interrupted() {
+		return exitInterrupted
+	}
+	if findings > 0 {
+		return 1
+	}
+	return 0
+}
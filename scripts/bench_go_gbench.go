@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// gbenchOutput is Google Benchmark's JSON output (--benchmark_format=json),
+// so its tools, compare.py among them, can read PCS results. Each timed
+// call becomes a repetition, which gives compare.py the samples for its
+// U test, followed by mean, median and stddev aggregates.
+type gbenchOutput struct {
+	Context    gbenchContext `json:"context"`
+	Benchmarks []gbenchRun   `json:"benchmarks"`
+}
+
+type gbenchContext struct {
+	Date              string    `json:"date"`
+	HostName          string    `json:"host_name"`
+	Executable        string    `json:"executable"`
+	NumCPUs           int       `json:"num_cpus"`
+	MHzPerCPU         int       `json:"mhz_per_cpu"`
+	CPUScalingEnabled bool      `json:"cpu_scaling_enabled"`
+	Caches            []any     `json:"caches"`
+	LoadAvg           []float64 `json:"load_avg"`
+	LibraryBuildType  string    `json:"library_build_type"`
+	// Not Google Benchmark's: where the results came from
+	Commit string `json:"pcs_commit,omitempty"`
+	RunID  string `json:"pcs_run_id,omitempty"`
+}
+
+type gbenchRun struct {
+	Name                   string  `json:"name"`
+	FamilyIndex            int     `json:"family_index"`
+	PerFamilyInstanceIndex int     `json:"per_family_instance_index"`
+	RunName                string  `json:"run_name"`
+	RunType                string  `json:"run_type"`
+	Repetitions            int     `json:"repetitions"`
+	RepetitionIndex        int     `json:"repetition_index"`
+	Threads                int     `json:"threads"`
+	AggregateName          string  `json:"aggregate_name,omitempty"`
+	AggregateUnit          string  `json:"aggregate_unit,omitempty"`
+	Iterations             int     `json:"iterations"`
+	RealTime               float64 `json:"real_time"`
+	CPUTime                float64 `json:"cpu_time"`
+	TimeUnit               string  `json:"time_unit"`
+	ErrorOccurred          bool    `json:"error_occurred,omitempty"`
+	ErrorMessage           string  `json:"error_message,omitempty"`
+}
+
+// writeGBench writes results as one Google Benchmark JSON document.
+func writeGBench(w io.Writer, results []BenchmarkResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(toGBench(results))
+}
+
+// toGBench reshapes results into Google Benchmark's output. A family is a
+// test and mode (plus target), its instances the sizes, named test/mode/N
+// like a benchmark with one argument. Skipped results are left out; failed
+// ones keep their error.
+func toGBench(results []BenchmarkResult) gbenchOutput {
+	out := gbenchOutput{
+		Context: gbenchContext{
+			Date:             time.Now().Format(time.RFC3339),
+			Executable:       redaction.path(os.Args[0]),
+			NumCPUs:          runtime.NumCPU(),
+			Caches:           []any{},
+			LoadAvg:          []float64{},
+			LibraryBuildType: "release",
+		},
+		Benchmarks: []gbenchRun{},
+	}
+	out.Context.HostName, _ = os.Hostname()
+	out.Context.HostName = redaction.host(out.Context.HostName)
+	if len(results) > 0 {
+		out.Context.Date, out.Context.Commit, out.Context.RunID = results[0].Timestamp, results[0].Commit, results[0].RunID
+	}
+	if m := sampleMachine(); m != nil {
+		out.Context.LoadAvg = []float64{m.Load1}
+		out.Context.MHzPerCPU = int(m.CPUMHz)
+	}
+
+	families := map[string]int{}
+	instances := map[string]int{}
+	for _, r := range results {
+		if r.Skipped {
+			continue
+		}
+		family := r.Test + "/" + r.Mode
+		if r.Target != "" {
+			family += "/" + r.Target
+		}
+		fi, ok := families[family]
+		if !ok {
+			fi = len(families)
+			families[family] = fi
+		}
+		pi := instances[family]
+		instances[family]++
+
+		run := gbenchRun{
+			Name:                   family + "/" + strconv.Itoa(r.N),
+			FamilyIndex:            fi,
+			PerFamilyInstanceIndex: pi,
+			RunType:                "iteration",
+			Threads:                1,
+			Iterations:             1,
+			CPUTime:                float64(r.CPUNs),
+			TimeUnit:               "ns",
+		}
+		run.RunName = run.Name
+		if r.Error != "" {
+			run.Repetitions, run.ErrorOccurred, run.ErrorMessage = 1, true, r.Error
+			out.Benchmarks = append(out.Benchmarks, run)
+			continue
+		}
+		samples := r.Samples
+		if len(samples) == 0 {
+			samples = []int64{r.MeanNs}
+		}
+		run.Repetitions = len(samples)
+		for i, ns := range samples {
+			rep := run
+			rep.RepetitionIndex, rep.RealTime = i, float64(ns)
+			out.Benchmarks = append(out.Benchmarks, rep)
+		}
+		for _, agg := range []struct {
+			name  string
+			value int64
+		}{{"mean", r.MeanNs}, {"median", r.MedianNs}, {"stddev", r.StdNs}} {
+			a := run
+			a.Name = run.Name + "_" + agg.name
+			a.RunType, a.AggregateName, a.AggregateUnit = "aggregate", agg.name, "time"
+			a.Iterations = len(samples)
+			a.RealTime = float64(agg.value)
+			if agg.name == "stddev" {
+				a.CPUTime = 0
+			}
+			out.Benchmarks = append(out.Benchmarks, a)
+		}
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// gcSettings are the garbage collector knobs a benchmark process runs with,
+// in the Go runtime's own environment syntax: GOGC is a percentage or "off",
+// GOMEMLIMIT a byte count with an optional B/KiB/MiB/GiB/TiB suffix or
+// "off".
+type gcSettings struct {
+	GOGC       string
+	GOMemLimit string
+}
+
+var memLimitRE = regexp.MustCompile(`^[0-9]+(B|KiB|MiB|GiB|TiB)?$`)
+
+func (g gcSettings) validate() error {
+	if g.GOGC != "" && g.GOGC != "off" {
+		if v, err := strconv.Atoi(g.GOGC); err != nil || v < 0 {
+			return fmt.Errorf("invalid GOGC %q (want a non-negative percentage or off)", g.GOGC)
+		}
+	}
+	if g.GOMemLimit != "" && g.GOMemLimit != "off" && !memLimitRE.MatchString(g.GOMemLimit) {
+		return fmt.Errorf("invalid GOMEMLIMIT %q (want e.g. 512MiB or off)", g.GOMemLimit)
+	}
+	return nil
+}
+
+// over returns g with any unset knob taken from base.
+func (g gcSettings) over(base gcSettings) gcSettings {
+	if g.GOGC == "" {
+		g.GOGC = base.GOGC
+	}
+	if g.GOMemLimit == "" {
+		g.GOMemLimit = base.GOMemLimit
+	}
+	return g
+}
+
+// effective is what the benchmark process actually runs with: unset knobs
+// fall back to our own environment, then to the runtime defaults (GOGC=100,
+// no memory limit), so every result records a concrete GC configuration.
+func (g gcSettings) effective() gcSettings {
+	g = g.over(gcSettings{GOGC: os.Getenv("GOGC"), GOMemLimit: os.Getenv("GOMEMLIMIT")})
+	return g.over(gcSettings{GOGC: "100", GOMemLimit: "off"})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// gitInfo places a run on the repository's timeline beyond its commit, so
+// results from a laptop and from CI can be lined up. In GitHub Actions the
+// branch and pull request come from the workflow environment, as the
+// checkout is usually a detached merge commit.
+type gitInfo struct {
+	Branch string `json:"branch,omitempty"`
+	// Describe is git describe --tags: the nearest tag, and how far past it
+	Describe string `json:"describe,omitempty"`
+	// Dirty is set when tracked files had uncommitted changes
+	Dirty bool `json:"dirty,omitempty"`
+	PR    int  `json:"pr,omitempty"`
+}
+
+// detectGit returns the commit under test, GITHUB_SHA or else HEAD ("local"
+// outside a repository), and what git and the CI environment tell about it.
+// Nothing is returned for git when it is not installed.
+func detectGit() (string, *gitInfo) {
+	git := func(args ...string) string {
+		out, err := exec.Command("git", args...).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := os.Getenv("GITHUB_SHA")
+	if commit == "" {
+		commit = git("rev-parse", "HEAD")
+	}
+	if commit == "" {
+		commit = "local"
+	}
+
+	info := &gitInfo{Describe: git("describe", "--tags")}
+	// GITHUB_HEAD_REF is the source branch of a pull request
+	info.Branch = os.Getenv("GITHUB_HEAD_REF")
+	if info.Branch == "" {
+		info.Branch = os.Getenv("GITHUB_REF_NAME")
+	}
+	if info.Branch == "" {
+		if b := git("rev-parse", "--abbrev-ref", "HEAD"); b != "HEAD" {
+			info.Branch = b
+		}
+	}
+	// refs/pull/<number>/merge
+	if rest, ok := strings.CutPrefix(os.Getenv("GITHUB_REF"), "refs/pull/"); ok {
+		number, _, _ := strings.Cut(rest, "/")
+		info.PR, _ = strconv.Atoi(number)
+	}
+	if out, err := exec.Command("git", "status", "--porcelain", "--untracked-files=no").Output(); err == nil {
+		info.Dirty = len(strings.TrimSpace(string(out))) > 0
+	}
+	if *info == (gitInfo{}) {
+		return commit, nil
+	}
+	return commit, info
+}
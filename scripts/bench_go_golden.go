@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// goldenSkipDirs are directories under generated/ holding harness
+// artifacts rather than checked-in output.
+var goldenSkipDirs = map[string]bool{"go_bench_runs": true}
+
+var (
+	packageClause = regexp.MustCompile(`(?m)^package \w+`)
+	mainFunc      = regexp.MustCompile(`(?m)^func main\(\)`)
+	// fragmentPosition is a position in the wrapped file in go's output
+	fragmentPosition = regexp.MustCompile(`(?:\./)?fragment\.go:(\d+)`)
+)
+
+// runCheckGenerated implements `check-generated`: it wraps every Go file
+// under the given directories into a package of its own and runs go build
+// and go vet on it, so checked-in output that is not Go (a leftover Python
+// generator, a call to an undefined helper) fails loudly.
+func runCheckGenerated(args []string) int {
+	flags := flag.NewFlagSet("check-generated", flag.ExitOnError)
+	vet := flags.Bool("vet", true, "also run go vet on files that build")
+	timeout := flags.Duration("timeout", 2*time.Minute, "limit on each go build and go vet")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: pcs-bench check-generated [flags] [dir or file...] (default generated)\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	roots := flags.Args()
+	if len(roots) == 0 {
+		roots = []string{"generated"}
+	}
+
+	var files []string
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && path != root && goldenSkipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && strings.HasSuffix(path, ".go") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "check-generated: %v\n", err)
+			return 1
+		}
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "check-generated: no Go files under %s\n", strings.Join(roots, ", "))
+		return 1
+	}
+
+	work, err := os.MkdirTemp("", "pcs-check-generated-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check-generated: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(work)
+
+	failed := 0
+	for i, path := range files {
+		dir := filepath.Join(work, strconv.Itoa(i))
+		diag, err := checkGoldenFile(path, dir, *vet, *timeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "check-generated: %s: %v\n", path, err)
+			return 1
+		}
+		if diag == "" {
+			fmt.Printf("ok    %s\n", path)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL  %s\n", path)
+		for _, line := range strings.Split(strings.TrimRight(diag, "\n"), "\n") {
+			fmt.Printf("      %s\n", line)
+		}
+	}
+	fmt.Printf("check-generated: %d files, %d failed\n", len(files), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkGoldenFile builds (and vets) path in dir as package main, adding the
+// package clause and an empty main a fragment lacks. It returns the
+// diagnostics, with positions in path's own lines, or "" when it passes;
+// err is set only when the check itself could not run.
+func checkGoldenFile(path, dir string, vet bool, limit time.Duration) (string, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	offset := 0
+	if !packageClause.Match(src) {
+		src = append([]byte("package main\n\n"), src...)
+		offset = 2
+	}
+	wrapped := filepath.Join(dir, "fragment.go")
+	if err := os.WriteFile(wrapped, src, 0644); err != nil {
+		return "", err
+	}
+	sources := []string{"fragment.go"}
+	if !mainFunc.Match(src) {
+		stub := []byte("package main\n\nfunc main() {}\n")
+		if err := os.WriteFile(filepath.Join(dir, "main.go"), stub, 0644); err != nil {
+			return "", err
+		}
+		sources = append(sources, "main.go")
+	}
+
+	steps := [][]string{append([]string{"build", "-o", os.DevNull}, sources...)}
+	if vet {
+		steps = append(steps, append([]string{"vet"}, sources...))
+	}
+	for _, step := range steps {
+		cmd := commandContext("go", step...)
+		cmd.Dir = dir
+		_, err := runWithin(cmd, limit, 0)
+		if err == nil {
+			continue
+		}
+		ce, ok := err.(*commandError)
+		if !ok {
+			return "", err
+		}
+		return "go " + step[0] + ": " + goldenPositions(ce.output, path, offset), nil
+	}
+	return "", nil
+}
+
+// goldenPositions rewrites positions in the wrapped fragment to path's
+// lines, which start offset lines earlier, and drops go's "# package"
+// headers.
+func goldenPositions(output []byte, path string, offset int) string {
+	var b strings.Builder
+	for _, line := range strings.Split(string(bytes.TrimSpace(output)), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = fragmentPosition.ReplaceAllStringFunc(line, func(m string) string {
+			n, _ := strconv.Atoi(fragmentPosition.FindStringSubmatch(m)[1])
+			return path + ":" + strconv.Itoa(n-offset)
+		})
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
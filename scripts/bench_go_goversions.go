@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// -go-versions builds and times every gc case under each of several Go
+// toolchains, so a Go release that changes how the generated code performs
+// shows up as a difference between otherwise identical results. Results
+// carry the compiling toolchain's version either way.
+
+// goToolchain is a go command and the version it reports.
+type goToolchain struct {
+	Cmd     string
+	Version string
+}
+
+// resolveGo finds the go command for spec: a GOROOT directory, a path to a
+// go binary, or a command in PATH such as a golang.org/dl shim (go1.22.5).
+func resolveGo(spec string) (goToolchain, error) {
+	cmd := spec
+	if info, err := os.Stat(spec); err == nil && info.IsDir() {
+		cmd = filepath.Join(spec, "bin", "go")
+	} else if !strings.ContainsRune(spec, filepath.Separator) {
+		path, err := exec.LookPath(spec)
+		if err != nil {
+			return goToolchain{}, err
+		}
+		cmd = path
+	}
+	// GOTOOLCHAIN=local keeps go from switching to another toolchain
+	c := exec.Command(cmd, "env", "GOVERSION")
+	c.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	out, err := c.Output()
+	if err != nil {
+		return goToolchain{}, fmt.Errorf("%s env GOVERSION: %v", cmd, err)
+	}
+	return goToolchain{Cmd: cmd, Version: strings.TrimSpace(string(out))}, nil
+}
+
+// parseGoVersions resolves a comma-separated list of toolchains.
+func parseGoVersions(list string) ([]goToolchain, error) {
+	var toolchains []goToolchain
+	seen := map[string]bool{}
+	for _, spec := range strings.Split(list, ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		tc, err := resolveGo(spec)
+		if err != nil {
+			return nil, err
+		}
+		if seen[tc.Version] {
+			return nil, fmt.Errorf("%s resolves to %s, listed twice", spec, tc.Version)
+		}
+		seen[tc.Version] = true
+		toolchains = append(toolchains, tc)
+	}
+	return toolchains, nil
+}
+
+// goVersionCases replaces each gc case by one copy per toolchain, named
+// with the version. Dependencies refer to the copies for the same version.
+func goVersionCases(cases []benchCase, toolchains []goToolchain) []benchCase {
+	if len(toolchains) == 0 {
+		return cases
+	}
+	gc := map[string]bool{}
+	for _, tc := range cases {
+		gc[tc.name()] = tc.toolchain() == "gc"
+	}
+	// Other toolchains' cases keep running once, ordered against the gc
+	// cases of the first version
+	first := func(deps []string) []string {
+		var out []string
+		for _, d := range deps {
+			if gc[d] {
+				d += "_" + toolchains[0].Version
+			}
+			out = append(out, d)
+		}
+		return out
+	}
+	var out []benchCase
+	for _, tc := range cases {
+		if tc.toolchain() != "gc" {
+			tc.After, tc.Needs = first(tc.After), first(tc.Needs)
+			out = append(out, tc)
+		}
+	}
+	for _, gt := range toolchains {
+		for _, tc := range cases {
+			if tc.toolchain() != "gc" {
+				continue
+			}
+			tc.Go = gt
+			tc.After = withSuffix(tc.After, "_"+gt.Version)
+			tc.Needs = withSuffix(tc.Needs, "_"+gt.Version)
+			out = append(out, tc)
+		}
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+// hdrHistogram is an HDR histogram of nanosecond timings in the layout of
+// HdrHistogram (hdrhistogram.org): buckets of doubling width, each split
+// into enough sub-buckets to keep hdrSignificantDigits of every value. Its
+// encode output is the V2 compressed, base64 form HdrHistogram's
+// libraries decode, so report tooling can plot the distribution or merge
+// histograms across results.
+type hdrHistogram struct {
+	counts     []int64
+	maxIndex   int
+	totalCount int64
+}
+
+const (
+	// hdrSignificantDigits is the precision of recorded values: 3 keeps
+	// them to within 0.1%.
+	hdrSignificantDigits = 3
+	// hdrHighest is the highest trackable timing, an hour; longer ones are
+	// recorded as an hour. It is the same for every result so their
+	// histograms merge without resizing.
+	hdrHighest = int64(3600e9)
+
+	hdrSubBucketHalfCountMagnitude = 10 // ceil(log2(2 * 10^3)) - 1
+	hdrSubBucketHalfCount          = 1 << hdrSubBucketHalfCountMagnitude
+	hdrSubBucketCount              = 2 * hdrSubBucketHalfCount
+	hdrSubBucketMask               = hdrSubBucketCount - 1
+
+	hdrEncodingCookie           = 0x1c849303 | 0x10
+	hdrCompressedEncodingCookie = 0x1c849304 | 0x10
+)
+
+func newHDRHistogram() *hdrHistogram {
+	buckets := 1
+	for smallest := int64(hdrSubBucketCount); smallest <= hdrHighest; smallest <<= 1 {
+		buckets++
+	}
+	return &hdrHistogram{counts: make([]int64, (buckets+1)*hdrSubBucketHalfCount)}
+}
+
+// hdrOf records every timing of times.
+func hdrOf(times []int64) *hdrHistogram {
+	h := newHDRHistogram()
+	for _, t := range times {
+		h.record(t)
+	}
+	return h
+}
+
+func (h *hdrHistogram) record(v int64) {
+	v = min(max(v, 0), hdrHighest)
+	bucket := 63 - hdrSubBucketHalfCountMagnitude - bits.LeadingZeros64(uint64(v|hdrSubBucketMask))
+	sub := int(v >> bucket)
+	i := (bucket+1)<<hdrSubBucketHalfCountMagnitude + sub - hdrSubBucketHalfCount
+	h.counts[i]++
+	h.maxIndex = max(h.maxIndex, i)
+	h.totalCount++
+}
+
+// encode returns the histogram in HdrHistogram's V2 compressed encoding,
+// base64'd: a cookie and the zlib'd length, then the zlib'd 40-byte header
+// and counts up to the highest recorded one as ZigZag LEB128 varints, runs
+// of empty buckets as one negative count. An empty histogram encodes as "".
+func (h *hdrHistogram) encode() string {
+	if h.totalCount == 0 {
+		return ""
+	}
+	var payload []byte
+	for i := 0; i <= h.maxIndex; i++ {
+		count := h.counts[i]
+		if count == 0 {
+			zeros := int64(1)
+			for i+1 <= h.maxIndex && h.counts[i+1] == 0 {
+				zeros++
+				i++
+			}
+			if zeros > 1 {
+				count = -zeros
+			}
+		}
+		payload = binary.AppendVarint(payload, count)
+	}
+
+	var plain bytes.Buffer
+	for _, field := range []any{
+		int32(hdrEncodingCookie),
+		int32(len(payload)),
+		int32(0), // normalizing index offset
+		int32(hdrSignificantDigits),
+		int64(1), // lowest discernible value
+		hdrHighest,
+		math.Float64bits(1), // integer to double conversion ratio
+	} {
+		binary.Write(&plain, binary.BigEndian, field)
+	}
+	plain.Write(payload)
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(plain.Bytes())
+	zw.Close()
+
+	out := binary.BigEndian.AppendUint32(nil, hdrCompressedEncodingCookie)
+	out = binary.BigEndian.AppendUint32(out, uint32(compressed.Len()))
+	return base64.StdEncoding.EncodeToString(append(out, compressed.Bytes()...))
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// historyStore keeps benchmark results in a SQLite database. Like the pcs
+// CLI's --execute-sql, it drives the sqlite3 command-line shell rather than
+// linking a driver, so the harness stays dependency-free.
+type historyStore struct {
+	path string
+}
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS results (
+	id         INTEGER PRIMARY KEY,
+	commit_sha TEXT NOT NULL,
+	timestamp  TEXT NOT NULL,
+	backend    TEXT NOT NULL,
+	test       TEXT NOT NULL,
+	mode       TEXT NOT NULL,
+	n          INTEGER NOT NULL,
+	os         TEXT,
+	cpu        TEXT,
+	parallel   INTEGER,
+	mean_ns    INTEGER,
+	median_ns  INTEGER,
+	p99_ns     INTEGER,
+	std_ns     INTEGER,
+	error      TEXT,
+	record     TEXT NOT NULL,
+	UNIQUE (commit_sha, timestamp, backend, test, mode, n)
+);
+CREATE INDEX IF NOT EXISTS results_series ON results (backend, test, mode, timestamp);
+CREATE INDEX IF NOT EXISTS results_commit ON results (commit_sha);
+`
+
+// openHistory creates the database and schema if needed.
+func openHistory(path string) (*historyStore, error) {
+	h := &historyStore{path: path}
+	if _, err := h.exec(historySchema); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *historyStore) exec(script string, args ...string) ([]byte, error) {
+	cmd := exec.Command("sqlite3", append(append([]string{"-bail"}, args...), h.path)...)
+	cmd.Stdin = strings.NewReader(script)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3 %s: %v: %s", h.path, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Append inserts results in one transaction. Re-importing the same record
+// replaces it instead of duplicating it.
+func (h *historyStore) Append(results []BenchmarkResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("BEGIN;\n")
+	for _, r := range results {
+		if err := writeInsert(&b, r); err != nil {
+			return err
+		}
+	}
+	b.WriteString("COMMIT;\n")
+	_, err := h.exec(b.String())
+	return err
+}
+
+// writeInsert writes the statement storing r to b.
+func writeInsert(b *strings.Builder, r BenchmarkResult) error {
+	record, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	parallel := 0
+	if r.Parallel {
+		parallel = 1
+	}
+	fmt.Fprintf(b, "INSERT OR REPLACE INTO results "+
+		"(commit_sha, timestamp, backend, test, mode, n, os, cpu, parallel, mean_ns, median_ns, p99_ns, std_ns, error, record) "+
+		"VALUES (%s, %s, %s, %s, %s, %d, %s, %s, %d, %d, %d, %d, %d, %s, %s);\n",
+		sqlQuote(r.Commit), sqlQuote(r.Timestamp), sqlQuote(r.Backend), sqlQuote(r.Test), sqlQuote(r.Mode), r.N,
+		sqlQuote(r.OS), sqlQuote(r.CPU), parallel, r.MeanNs, r.MedianNs, r.P99Ns, r.StdNs,
+		sqlQuote(r.Error), sqlQuote(string(record)))
+	return nil
+}
+
+// historyQuery selects results; empty fields match everything.
+type historyQuery struct {
+	Backend, Test, Mode, Commit string
+	// Since is an inclusive lower bound on the RFC 3339 timestamp.
+	Since string
+	// Limit keeps only the newest Limit rows when positive.
+	Limit int
+}
+
+// Query returns matching results ordered oldest first.
+func (h *historyStore) Query(q historyQuery) ([]BenchmarkResult, error) {
+	var where []string
+	for _, c := range []struct{ col, val string }{
+		{"backend", q.Backend}, {"test", q.Test}, {"mode", q.Mode}, {"commit_sha", q.Commit},
+	} {
+		if c.val != "" {
+			where = append(where, c.col+" = "+sqlQuote(c.val))
+		}
+	}
+	if q.Since != "" {
+		where = append(where, "timestamp >= "+sqlQuote(q.Since))
+	}
+
+	sql := "SELECT record FROM results"
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	sql += " ORDER BY timestamp DESC, id DESC"
+	if q.Limit > 0 {
+		sql += " LIMIT " + strconv.Itoa(q.Limit)
+	}
+
+	out, err := h.exec(sql+";\n", "-json")
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	var rows []struct {
+		Record string `json:"record"`
+	}
+	if err := json.Unmarshal(out, &rows); err != nil {
+		return nil, err
+	}
+
+	results := make([]BenchmarkResult, 0, len(rows))
+	for i := len(rows) - 1; i >= 0; i-- {
+		r, err := decodeResult([]byte(rows[i].Record))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// runHistory implements `history import`, `history query`, `history prune`
+// and `history compact`.
+func runHistory(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "usage: pcs-bench history import|query|prune|compact -db file.db ...")
+		fmt.Fprintln(os.Stderr, "Run 'pcs-bench history <command> -h' for its flags.")
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			return 0
+		}
+		return 2
+	}
+
+	fs := flag.NewFlagSet("history "+args[0], flag.ExitOnError)
+	db := fs.String("db", "bench/history.db", "SQLite history database")
+	var q historyQuery
+	if args[0] == "query" {
+		fs.StringVar(&q.Backend, "backend", "", "only this backend")
+		fs.StringVar(&q.Test, "test", "", "only this test")
+		fs.StringVar(&q.Mode, "mode", "", "only this mode")
+		fs.StringVar(&q.Commit, "commit", "", "only this commit")
+		fs.StringVar(&q.Since, "since", "", "only results at or after this RFC 3339 timestamp")
+		fs.IntVar(&q.Limit, "limit", 0, "only the newest N results")
+	}
+	var keep, days int
+	var dryRun bool
+	switch args[0] {
+	case "prune":
+		fs.IntVar(&keep, "keep", 100, "keep the newest N results of each benchmark")
+	case "compact":
+		fs.IntVar(&days, "days", 90, "downsample results older than this many days to daily aggregates")
+	}
+	if args[0] == "prune" || args[0] == "compact" {
+		fs.BoolVar(&dryRun, "dry-run", false, "report what would change without changing it")
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "usage: pcs-bench history %s [flags] [-db file.db | results.ndjson|dir...]\n", args[0])
+			fs.PrintDefaults()
+		}
+	}
+	fs.Parse(args[1:])
+	if args[0] == "prune" || args[0] == "compact" {
+		if (args[0] == "prune" && keep < 1) || days < 0 {
+			fmt.Fprintf(os.Stderr, "history: -keep must be at least 1 and -days not negative\n")
+			return 2
+		}
+		return retainHistory(args[0], *db, fs.Args(), keep, days, dryRun)
+	}
+
+	h, err := openHistory(*db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "history: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "import":
+		results, err := readResults(fs.Args()...)
+		if err == nil {
+			err = h.Append(results)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "history: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "imported %d results into %s\n", len(results), *db)
+	case "query":
+		results, err := h.Query(q)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "history: %v\n", err)
+			return 1
+		}
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range results {
+			enc.Encode(r)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "history: unknown command %q\n", args[0])
+		return 2
+	}
+	return 0
+}
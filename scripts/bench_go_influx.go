@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeInflux writes a result as a single InfluxDB line-protocol point in
+// the pcs_bench measurement. Identifying dimensions and the run's labels
+// become tags and every timing statistic becomes an integer field.
+func writeInflux(w io.Writer, r BenchmarkResult) error {
+	var b strings.Builder
+
+	b.WriteString("pcs_bench")
+	for _, tag := range [][2]string{
+		{"backend", r.Backend},
+		{"test", r.Test},
+		{"mode", r.Mode},
+		{"os", r.OS},
+	} {
+		if tag[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ",%s=%s", tag[0], influxEscapeTag(tag[1]))
+	}
+	// Labels are tags too, after the stock ones they may not replace
+	for _, k := range r.Labels.keys() {
+		switch k {
+		case "backend", "test", "mode", "os":
+			continue
+		}
+		if v := r.Labels[k]; v != "" {
+			fmt.Fprintf(&b, ",%s=%s", influxEscapeTag(k), influxEscapeTag(v))
+		}
+	}
+
+	fields := []string{
+		"n=" + strconv.Itoa(r.N) + "i",
+		"parallel=" + strconv.FormatBool(r.Parallel),
+		"commit=" + influxQuote(r.Commit),
+	}
+	switch {
+	case r.Error != "":
+		fields = append(fields, "error="+influxQuote(r.Error))
+		if r.ErrorClass != "" {
+			fields = append(fields, "error_class="+influxQuote(r.ErrorClass))
+		}
+	case r.Skipped:
+		fields = append(fields, "skipped=true", "skip_reason="+influxQuote(r.SkipReason))
+	default:
+		fields = append(fields,
+			"mean_ns="+strconv.FormatInt(r.MeanNs, 10)+"i",
+			"std_ns="+strconv.FormatInt(r.StdNs, 10)+"i",
+			"median_ns="+strconv.FormatInt(r.MedianNs, 10)+"i",
+			"p99_ns="+strconv.FormatInt(r.P99Ns, 10)+"i",
+		)
+	}
+	b.WriteString(" ")
+	b.WriteString(strings.Join(fields, ","))
+
+	if ts, err := time.Parse(time.RFC3339, r.Timestamp); err == nil {
+		fmt.Fprintf(&b, " %d", ts.UnixNano())
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func influxEscapeTag(v string) string {
+	return strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`).Replace(v)
+}
+
+func influxQuote(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
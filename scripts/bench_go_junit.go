@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes a JUnit XML report with one test case per benchmark.
+// Failed cases (codegen, compile or run errors) and regressions beyond
+// threshold against base are reported as failures; skipped cases as skipped.
+func writeJUnit(path string, results []BenchmarkResult, base baseline, threshold float64) error {
+	suite := junitTestSuite{Name: "pcs_bench"}
+	for _, r := range results {
+		tc := junitTestCase{
+			ClassName: r.Backend + "." + r.Test,
+			Name:      r.Mode,
+			Time:      strconv.FormatFloat(float64(r.MeanNs)/1e9, 'f', 9, 64),
+		}
+		if suite.Timestamp == "" {
+			suite.Timestamp = r.Timestamp
+		}
+
+		switch {
+		case r.Error != "":
+			kind := r.ErrorClass
+			if kind == "" {
+				kind = "error"
+			}
+			tc.Failure = &junitFailure{Message: r.Error, Type: kind, Text: r.Error}
+		case r.Skipped:
+			tc.Skipped = &junitSkipped{Message: r.SkipReason + ": " + strings.Join(r.Missing, ", ")}
+			suite.Skipped++
+		case base.regressed(r, threshold):
+			d, _ := base.delta(r)
+			msg := fmt.Sprintf("mean %d ns is %.1f%% slower than baseline %d ns (threshold %.1f%%)",
+				r.MeanNs, d*100, base[keyOf(r)], threshold*100)
+			tc.Failure = &junitFailure{Message: msg, Type: "regression", Text: msg}
+		default:
+			tc.SystemOut = fmt.Sprintf("n=%d mean_ns=%d std_ns=%d median_ns=%d p99_ns=%d",
+				r.N, r.MeanNs, r.StdNs, r.MedianNs, r.P99Ns)
+		}
+
+		if tc.Failure != nil {
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	report := junitTestSuites{
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Suites:   []junitTestSuite{suite},
+	}
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
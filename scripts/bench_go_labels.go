@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// labelKey is what a label's key may look like: a name that needs no
+// quoting in a JSON path, a SQL column or an InfluxDB tag key.
+var labelKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// runLabels are the free-form key=value labels of a run, copied verbatim
+// into its header and every result so results can later be filtered by
+// experiment, runner pool or feature-flag state. Those of -labels-file are
+// read first and -label overrides them key by key.
+type runLabels map[string]string
+
+// set parses one -label key=value.
+func (l runLabels) set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("%q: want key=value", s)
+	}
+	if err := checkLabelKey(key); err != nil {
+		return err
+	}
+	l[key] = value
+	return nil
+}
+
+func checkLabelKey(key string) error {
+	if !labelKey.MatchString(key) {
+		return fmt.Errorf("label key %q: want a letter or _ followed by letters, digits, _, . or -", key)
+	}
+	return nil
+}
+
+// loadLabels reads a -labels-file: a JSON object of string values, e.g.
+// {"experiment": "exp-42", "runner_pool": "c7i"}.
+func loadLabels(path string) (runLabels, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file map[string]string
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	labels := runLabels{}
+	for key, value := range file {
+		if err := checkLabelKey(key); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// withFile returns the labels of the -labels-file path overridden by l's
+// own -label values.
+func (l runLabels) withFile(path string) (runLabels, error) {
+	labels, err := loadLabels(path)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range l {
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// keys returns the label keys in order.
+func (l runLabels) keys() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
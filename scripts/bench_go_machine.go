@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// machineState is a snapshot of the conditions a benchmark ran under, taken
+// right before and after it, so a slow result can be told apart from a busy,
+// throttled or hot machine. Only what the platform exposes is filled in:
+// currently Linux /proc and /sys.
+type machineState struct {
+	Load1 float64 `json:"load1"`
+	// CPUMHz is the mean current frequency over all CPUs
+	CPUMHz float64 `json:"cpu_mhz,omitempty"`
+	// TempC is the hottest thermal zone
+	TempC float64 `json:"temp_c,omitempty"`
+	// Throttles counts thermal throttling events since boot, summed over
+	// cores; compare before and after
+	Throttles int64 `json:"throttle_count,omitempty"`
+}
+
+// sampleMachine returns nil where nothing can be read.
+func sampleMachine() *machineState {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil
+	}
+	var m machineState
+	if fields := strings.Fields(string(data)); len(fields) > 0 {
+		m.Load1, _ = strconv.ParseFloat(fields[0], 64)
+	}
+	m.CPUMHz = cpuMHz()
+	for _, path := range glob("/sys/class/thermal/thermal_zone*/temp") {
+		if milli, ok := readInt(path); ok && float64(milli)/1000 > m.TempC {
+			m.TempC = float64(milli) / 1000
+		}
+	}
+	for _, path := range glob("/sys/devices/system/cpu/cpu*/thermal_throttle/core_throttle_count") {
+		if n, ok := readInt(path); ok {
+			m.Throttles += n
+		}
+	}
+	return &m
+}
+
+// cpuMHz prefers cpufreq's live per-CPU frequency (kHz) and falls back to
+// /proc/cpuinfo, which some virtual machines report as a constant.
+func cpuMHz() float64 {
+	var sum float64
+	var n int
+	for _, path := range glob("/sys/devices/system/cpu/cpu*/cpufreq/scaling_cur_freq") {
+		if khz, ok := readInt(path); ok {
+			sum += float64(khz) / 1000
+			n++
+		}
+	}
+	if n == 0 {
+		f, err := os.Open("/proc/cpuinfo")
+		if err != nil {
+			return 0
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			key, value, ok := strings.Cut(sc.Text(), ":")
+			if !ok || strings.TrimSpace(key) != "cpu MHz" {
+				continue
+			}
+			if mhz, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				sum += mhz
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+func glob(pattern string) []string {
+	paths, _ := filepath.Glob(pattern)
+	return paths
+}
+
+func readInt(path string) (int64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return v, err == nil
+}
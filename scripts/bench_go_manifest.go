@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// -artifacts-dir keeps everything a run generated under DIR/<run_id>: each
+// case's sources and build log in src/<case>, its binary in bin/<case>,
+// and the PGO profile and rebuild, -perf counter dumps and -sched-trace
+// traces next to the sources. manifest.json there links every file to the
+// result record it belongs to, so a regression found in CI can be taken
+// apart from the uploaded directory alone, without rerunning the case.
+
+// manifestName is the file in a run's artifacts directory that indexes it.
+const manifestName = "manifest.json"
+
+// runManifest indexes a run's artifacts directory. Paths are relative to
+// the directory, so it can be moved or unpacked anywhere.
+type runManifest struct {
+	SchemaVersion int             `json:"schema_version"`
+	RunID         string          `json:"run_id"`
+	Commit        string          `json:"commit"`
+	Timestamp     string          `json:"timestamp"`
+	Results       []manifestEntry `json:"results"`
+}
+
+// manifestEntry is one result record and its artifacts. The record is the
+// result's run_id with backend, test, mode, n, gomaxprocs and pgo; Files
+// lists everything in the case's directory, which its results share.
+type manifestEntry struct {
+	Backend    string   `json:"backend"`
+	Test       string   `json:"test"`
+	Mode       string   `json:"mode"`
+	N          int      `json:"n"`
+	GOMAXPROCS int      `json:"gomaxprocs,omitempty"`
+	PGO        bool     `json:"pgo,omitempty"`
+	ErrorClass string   `json:"error_class,omitempty"`
+	Dir        string   `json:"dir"`
+	Binary     string   `json:"binary,omitempty"`
+	Perf       string   `json:"perf,omitempty"`
+	Trace      string   `json:"trace,omitempty"`
+	Files      []string `json:"files"`
+
+	// Where the entry's files are, before they are made relative
+	artifacts caseArtifacts
+	binary    string
+	perf      string
+	trace     string
+}
+
+// add records result, if it kept artifacts.
+func (m *runManifest) add(result BenchmarkResult) {
+	a := result.Artifacts
+	if m == nil || a == nil {
+		return
+	}
+	e := manifestEntry{
+		Backend:    result.Backend,
+		Test:       result.Test,
+		Mode:       result.Mode,
+		N:          result.N,
+		GOMAXPROCS: result.GOMAXPROCS,
+		PGO:        result.PGO,
+		ErrorClass: result.ErrorClass,
+		artifacts:  *a,
+		binary:     a.Binary,
+	}
+	perf := "perf_current.csv"
+	if result.PGO {
+		e.binary = filepath.Join(a.Dir, pgoBinaryName)
+		perf = "perf_pgo.csv"
+	}
+	if result.Perf != nil {
+		e.perf = keptPerfPath(filepath.Join(a.Dir, perf), result.GOMAXPROCS)
+	}
+	if result.Sched != nil {
+		e.trace = result.Sched.Trace
+	}
+	m.Results = append(m.Results, e)
+}
+
+// write resolves the entries against the files that are left and writes
+// the manifest into dir.
+func (m *runManifest) write(dir string) error {
+	if m == nil {
+		return nil
+	}
+	rel := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		if _, err := os.Stat(path); err != nil {
+			return ""
+		}
+		r, err := filepath.Rel(dir, path)
+		if err != nil {
+			return ""
+		}
+		return filepath.ToSlash(r)
+	}
+	listed := map[string][]string{}
+	for i := range m.Results {
+		e := &m.Results[i]
+		e.Dir = rel(e.artifacts.Dir)
+		e.Binary, e.Perf, e.Trace = rel(e.binary), rel(e.perf), rel(e.trace)
+		files, ok := listed[e.artifacts.Dir]
+		if !ok {
+			filepath.WalkDir(e.artifacts.Dir, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					files = append(files, rel(path))
+				}
+				return nil
+			})
+			if bin := rel(e.artifacts.Binary); bin != "" {
+				files = append(files, bin)
+			}
+			sort.Strings(files)
+			listed[e.artifacts.Dir] = files
+		}
+		e.Files = files
+		if e.Files == nil {
+			e.Files = []string{}
+		}
+	}
+	if m.Results == nil {
+		m.Results = []manifestEntry{}
+	}
+	return writeAtomic(filepath.Join(dir, manifestName), 0644, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	})
+}
+
+// keptPerfPath is where -artifacts-dir keeps the counters perf stat wrote
+// to path for a result at GOMAXPROCS procs (0 when not set), which are
+// otherwise deleted once read.
+func keptPerfPath(path string, procs int) string {
+	level := "default"
+	if procs > 0 {
+		level = fmt.Sprintf("gomaxprocs%d", procs)
+	}
+	return strings.TrimSuffix(path, ".csv") + "_" + level + ".csv"
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// mergeKey identifies one measurement across shards, retries and runners:
+// (commit, test, mode, os), plus the backend, N, parallel flag, GOMAXPROCS
+// level (-procs-sweep), GC settings, estimator, cross-compilation target, Go
+// version and previously built binary (-compare-binary) that tell otherwise
+// identically named cases apart.
+type mergeKey struct {
+	Commit, Backend, Test, Mode, OS string
+	N                               int
+	Parallel                        bool
+	GOMAXPROCS                      int
+	GOGC, GOMemLimit, Estimator     string
+	Target, GoVersion, Binary       string
+}
+
+func mergeKeyOf(r BenchmarkResult) mergeKey {
+	return mergeKey{r.Commit, r.Backend, r.Test, r.Mode, r.OS, r.N, r.Parallel, sweepLevel(r), r.GOGC, r.GOMemLimit, r.Estimator, r.Target, r.GoVersion, r.Binary}
+}
+
+// sweepLevel is the GOMAXPROCS a parallel case was timed at, which sets
+// the records of a -procs-sweep apart, and 0 for a sequential case, whose
+// GOMAXPROCS is only the machine's CPU count.
+func sweepLevel(r BenchmarkResult) int {
+	if !r.Parallel {
+		return 0
+	}
+	return r.GOMAXPROCS
+}
+
+// mergeStrategies pick one record out of several with the same key. A
+// measured record always beats a failed or skipped one; the strategy only
+// decides between measured records.
+var mergeStrategies = map[string]func(a, b BenchmarkResult) bool{
+	// latest keeps the record with the newest timestamp, i.e. the last retry.
+	"latest": func(a, b BenchmarkResult) bool { return a.Timestamp > b.Timestamp },
+	// fastest keeps the lowest mean, the usual choice for noisy shared runners.
+	"fastest": func(a, b BenchmarkResult) bool { return a.MeanNs < b.MeanNs },
+}
+
+// runMerge implements `merge`: it reads any number of NDJSON files and
+// writes one canonical stream with a single record per mergeKey, after the
+// distinct run headers of the inputs. The speedup records of the kept
+// parallel results follow them (see mergeSpeedups).
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := fs.String("o", "", "file to write (default stdout)")
+	strategy := fs.String("strategy", "latest", "how to pick between conflicting records: latest or fastest")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench merge [-o merged.ndjson] [-strategy latest|fastest] results.ndjson...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	better, ok := mergeStrategies[*strategy]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "merge: unknown strategy %q\n", *strategy)
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	results, headers, speedups, err := readRecords(fs.Args()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "merge: %v\n", err)
+		return 1
+	}
+	merged, conflicts := mergeResults(results, better)
+	speedupsOf := mergeSpeedups(speedups, merged)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "merge: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	// Keep every input run's header so merged rows' run_id still resolve
+	seenRuns := map[string]bool{}
+	for _, h := range headers {
+		if seenRuns[h.RunID] {
+			continue
+		}
+		seenRuns[h.RunID] = true
+		if err := enc.Encode(h); err != nil {
+			fmt.Fprintf(os.Stderr, "merge: %v\n", err)
+			return 1
+		}
+	}
+	for _, r := range merged {
+		if err := enc.Encode(r); err != nil {
+			fmt.Fprintf(os.Stderr, "merge: %v\n", err)
+			return 1
+		}
+		// A speedup record follows its parallel result, as a run writes it
+		for _, s := range speedupsOf[speedupSourceOf(r)] {
+			if err := enc.Encode(s); err != nil {
+				fmt.Fprintf(os.Stderr, "merge: %v\n", err)
+				return 1
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "merge: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "merged %d records into %d (%d duplicates, %d conflicting)\n",
+		len(results), len(merged), len(results)-len(merged), conflicts)
+	return 0
+}
+
+// mergeResults keeps the best record per key and returns them ordered by
+// timestamp, then key. conflicts counts keys whose duplicates disagreed on
+// the measurement rather than being byte-for-byte repeats.
+func mergeResults(results []BenchmarkResult, better func(a, b BenchmarkResult) bool) (merged []BenchmarkResult, conflicts int) {
+	best := map[mergeKey]BenchmarkResult{}
+	conflicted := map[mergeKey]bool{}
+	var order []mergeKey
+	for _, r := range results {
+		k := mergeKeyOf(r)
+		cur, seen := best[k]
+		if !seen {
+			best[k] = r
+			order = append(order, k)
+			continue
+		}
+		if !reflect.DeepEqual(cur, r) {
+			conflicted[k] = true
+		}
+		switch {
+		case !cur.measured() && r.measured():
+			best[k] = r
+		case cur.measured() && r.measured() && better(r, cur):
+			best[k] = r
+		case cur.Skipped && r.Error != "":
+			// A failure says more than a skip
+			best[k] = r
+		}
+	}
+
+	for _, k := range order {
+		merged = append(merged, best[k])
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Timestamp < merged[j].Timestamp })
+	return merged, len(conflicted)
+}
+
+// speedupSource identifies the parallel result a speedup record was taken
+// from: its run, key and mean.
+type speedupSource struct {
+	runID, mode string
+	key         speedupKey
+	gomaxprocs  int
+	meanNs      int64
+}
+
+func speedupSourceOf(r BenchmarkResult) speedupSource {
+	return speedupSource{r.RunID, r.Mode, speedupKeyOf(r), r.GOMAXPROCS, r.MeanNs}
+}
+
+// mergeSpeedups returns the speedup records of the parallel results the
+// merge kept, each once, by their source. A result the merge dropped takes
+// its speedup with it, as that describes a timing the merged file no longer
+// holds.
+func mergeSpeedups(speedups []speedupRecord, merged []BenchmarkResult) map[speedupSource][]speedupRecord {
+	kept := map[speedupSource]bool{}
+	for _, r := range merged {
+		if r.Parallel {
+			kept[speedupSourceOf(r)] = true
+		}
+	}
+	bySource := map[speedupSource][]speedupRecord{}
+	for _, s := range speedups {
+		src := speedupSource{s.RunID, s.Mode, speedupKey{s.Backend, s.Test, s.Target, s.Toolchain, s.GoVersion, s.N}, s.GOMAXPROCS, s.MeanNs}
+		if !kept[src] || slices.ContainsFunc(bySource[src], func(t speedupRecord) bool { return reflect.DeepEqual(s, t) }) {
+			continue
+		}
+		bySource[src] = append(bySource[src], s)
+	}
+	return bySource
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// decodeResult parses one NDJSON record. Other backends write timing
+// statistics as floats, so those fields are decoded leniently and truncated
+// to whole nanoseconds. Records predating the estimator field are classic.
+func decodeResult(line []byte) (BenchmarkResult, error) {
+	var raw struct {
+		BenchmarkResult
+		MeanNs   float64 `json:"mean_ns"`
+		StdNs    float64 `json:"std_ns"`
+		MedianNs float64 `json:"median_ns"`
+		P99Ns    float64 `json:"p99_ns"`
+	}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return BenchmarkResult{}, err
+	}
+	r := raw.BenchmarkResult
+	r.MeanNs = int64(raw.MeanNs)
+	r.StdNs = int64(raw.StdNs)
+	r.MedianNs = int64(raw.MedianNs)
+	r.P99Ns = int64(raw.P99Ns)
+	if r.Estimator == "" {
+		r.Estimator = classicEstimator{}.name()
+	}
+	return r, nil
+}
+
+// readResults reads every result record from the given NDJSON files in
+// order. Blank and malformed lines, run headers and speedup records are
+// skipped.
+func readResults(paths ...string) ([]BenchmarkResult, error) {
+	results, _, _, err := readRecords(paths...)
+	return results, err
+}
+
+// readRecords is readResults that also returns the run headers and the
+// speedup records.
+func readRecords(paths ...string) ([]BenchmarkResult, []runHeader, []speedupRecord, error) {
+	var results []BenchmarkResult
+	var headers []runHeader
+	var speedups []speedupRecord
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			var kind struct {
+				Record string `json:"record"`
+			}
+			if json.Unmarshal([]byte(line), &kind) == nil && kind.Record != "" {
+				var h runHeader
+				var s speedupRecord
+				switch {
+				case kind.Record == runRecord && json.Unmarshal([]byte(line), &h) == nil:
+					headers = append(headers, h)
+				case kind.Record == speedupRecordKind && json.Unmarshal([]byte(line), &s) == nil:
+					speedups = append(speedups, s)
+				}
+				continue
+			}
+			r, err := decodeResult([]byte(line))
+			if err != nil {
+				continue
+			}
+			results = append(results, r)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return results, headers, speedups, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// checkNice resolves -nice to the niceness benchmark processes run at and
+// the increment over the harness's own that reaches it (see runEnv.Nice).
+// want "" keeps the inherited niceness, which is still reported. level is
+// nil where niceness cannot be read. On Windows a niceness stands for a
+// priority class (see priorityClasses).
+func checkNice(want string) (level *int, increment int, err error) {
+	current, err := hostProc.niceness()
+	if err != nil {
+		if want != "" {
+			return nil, 0, fmt.Errorf("cannot read the current niceness: %v", err)
+		}
+		return nil, 0, nil
+	}
+	if want == "" {
+		return &current, 0, nil
+	}
+	target, err := strconv.Atoi(want)
+	if err != nil || target < -20 || target > 19 {
+		return nil, 0, fmt.Errorf("invalid niceness %q (want -20 to 19)", want)
+	}
+	if err := hostProc.checkNice(current, target); err != nil {
+		return nil, 0, err
+	}
+	return &target, target - current, nil
+}
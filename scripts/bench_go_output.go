@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A run's results stream is the only thing written to its standard output.
+// claimStdout takes the real standard output for the stream and points
+// os.Stdout at standard error, so a stray fmt.Print or a subprocess handed
+// os.Stdout cannot interleave with the records.
+func claimStdout() *os.File {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	return stdout
+}
+
+// ndjsonWriter frames each record as one line written with a single Write,
+// so records from different goroutines never interleave and each is on the
+// stream, unbuffered, as soon as it is written.
+type ndjsonWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (n *ndjsonWriter) write(record any) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err = n.w.Write(append(line, '\n'))
+	return err
+}
+
+// atomicFile is written under a temporary name next to path and renamed
+// onto it by commit, so a reader of path sees either no file or a complete
+// one, never a run still in progress.
+type atomicFile struct {
+	*os.File
+	path string
+	done bool
+}
+
+func createAtomic(path string) (*atomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	// As os.Create would, rather than CreateTemp's 0600
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &atomicFile{File: f, path: path}, nil
+}
+
+// commit syncs the file and renames it onto its path.
+func (f *atomicFile) commit() error {
+	f.done = true
+	err := f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// abort discards the file unless it was committed.
+func (f *atomicFile) abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// resultFile is where -output writes a run's results: an atomicFile, or an
+// appendFile under -append. commit is called once the run is over, abort
+// on every return.
+type resultFile interface {
+	io.Writer
+	commit() error
+	abort()
+}
+
+// openResults opens the -output file path: appended to as results are
+// written with -append, else written whole and renamed into place.
+func openResults(path string, appendOutput, sync bool) (resultFile, error) {
+	if appendOutput {
+		f, err := openAppend(path, sync)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	f, err := createAtomic(path)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// appendFile adds each record to the end of an existing results file as it
+// is written and, with sync, fsyncs it before the next one is measured: a
+// harness that crashes or is killed mid-run leaves every record completed
+// so far on disk, and at worst a truncated last line, which the next
+// -append run cuts off before writing. Only one run may append to a file at
+// a time, as that cut would take a record another run is still writing.
+type appendFile struct {
+	*os.File
+	sync bool
+}
+
+func openAppend(path string, sync bool) (*appendFile, error) {
+	if _, err := recoverNDJSON(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &appendFile{File: f, sync: sync}, nil
+}
+
+// Write is called once per record by ndjsonWriter.
+func (f *appendFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	if err == nil && f.sync {
+		err = f.Sync()
+	}
+	return n, err
+}
+
+func (f *appendFile) commit() error {
+	err := f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// abort keeps what was written: those records are complete.
+func (f *appendFile) abort() {
+	f.Close()
+}
+
+// truncatedTail is the length of what follows the last newline of an
+// NDJSON file when it is not a whole JSON value: the record a writer was
+// partway through when it died. 0 when the file ends in a newline or a
+// complete record, or does not exist.
+func truncatedTail(path string) (int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	tail, err := lastLine(f)
+	if err != nil {
+		return 0, err
+	}
+	if len(bytes.TrimSpace(tail)) == 0 || json.Valid(tail) {
+		return 0, nil
+	}
+	return int64(len(tail)), nil
+}
+
+// tailChunk is how much of a results file lastLine reads at a time.
+const tailChunk = 64 << 10
+
+// lastLine returns what follows the last newline of f, reading backwards
+// from its end rather than the whole file, which grows with every -append
+// run.
+func lastLine(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var tail []byte
+	for end := info.Size(); end > 0; {
+		start := max(end-tailChunk, 0)
+		chunk := make([]byte, end-start)
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return nil, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return append(chunk[i+1:], tail...), nil
+		}
+		tail = append(chunk, tail...)
+		end = start
+	}
+	return tail, nil
+}
+
+// recoverNDJSON truncates a results file back to its last whole line,
+// dropping a truncated final record, and ends a complete final record
+// missing its newline with one, so that records appended after it start on
+// a line of their own. It returns the number of bytes dropped.
+func recoverNDJSON(path string) (int64, error) {
+	dropped, err := truncatedTail(path)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if dropped > 0 {
+		if err := os.Truncate(path, info.Size()-dropped); err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(os.Stderr, "%s: dropped a truncated final record of %d bytes\n", path, dropped)
+		return dropped, nil
+	}
+	if info.Size() == 0 {
+		return 0, nil
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return 0, err
+	}
+	if last[0] != '\n' {
+		_, err = f.Write([]byte{'\n'})
+	}
+	return 0, err
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runPareto implements `pareto`: for every parallel kernel it plots wall time
+// against total CPU time at each GOMAXPROCS level found in the results and
+// marks the points no other level beats on both axes.
+func runPareto(args []string) int {
+	fs := flag.NewFlagSet("pareto", flag.ExitOnError)
+	out := fs.String("o", "bench_pareto.html", "HTML file to write")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench pareto [-o file.html] results.ndjson...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	results, err := readResults(fs.Args()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pareto: %v\n", err)
+		return 1
+	}
+
+	kernels := paretoKernels(results)
+	if len(kernels) == 0 {
+		fmt.Fprintln(os.Stderr, "pareto: no parallel results with cpu_ns and gomaxprocs")
+		return 1
+	}
+
+	for _, k := range kernels {
+		fmt.Printf("%s\n", k.Name)
+		for _, p := range k.Points {
+			mark := " "
+			if p.Frontier {
+				mark = "*"
+			}
+			fmt.Printf("  %s GOMAXPROCS=%-3d wall=%-12s cpu=%s\n", mark, p.Procs, time.Duration(p.WallNs), time.Duration(p.CPUNs))
+		}
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pareto: %v\n", err)
+		return 1
+	}
+	err = paretoTemplate.Execute(f, kernels)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pareto: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+type paretoPoint struct {
+	Procs    int
+	WallNs   int64
+	CPUNs    int64
+	Frontier bool
+}
+
+type paretoKernel struct {
+	Name   string
+	Points []paretoPoint
+	Chart  template.HTML
+}
+
+// paretoKernels groups parallel results by backend/test/mode/N, takes the
+// median wall and CPU time per GOMAXPROCS level and marks the frontier.
+func paretoKernels(results []BenchmarkResult) []paretoKernel {
+	type level struct{ wall, cpu []int64 }
+	groups := map[string]map[int]*level{}
+	for _, r := range results {
+		if !r.Parallel || !r.measured() || r.CPUNs <= 0 || r.GOMAXPROCS <= 0 {
+			continue
+		}
+		name := fmt.Sprintf("%s/%s/%s n=%d", r.Backend, r.Test, r.Mode, r.N)
+		if groups[name] == nil {
+			groups[name] = map[int]*level{}
+		}
+		l := groups[name][r.GOMAXPROCS]
+		if l == nil {
+			l = &level{}
+			groups[name][r.GOMAXPROCS] = l
+		}
+		l.wall = append(l.wall, r.MeanNs)
+		l.cpu = append(l.cpu, r.CPUNs)
+	}
+
+	var kernels []paretoKernel
+	for name, levels := range groups {
+		k := paretoKernel{Name: name}
+		for procs, l := range levels {
+			k.Points = append(k.Points, paretoPoint{Procs: procs, WallNs: medianOf(l.wall), CPUNs: medianOf(l.cpu)})
+		}
+		sort.Slice(k.Points, func(i, j int) bool { return k.Points[i].Procs < k.Points[j].Procs })
+		markFrontier(k.Points)
+		k.Chart = paretoChart(k.Points)
+		kernels = append(kernels, k)
+	}
+	sort.Slice(kernels, func(i, j int) bool { return kernels[i].Name < kernels[j].Name })
+	return kernels
+}
+
+// markFrontier flags every point that no other point dominates, i.e. no
+// other level is at least as good on both wall and CPU time and strictly
+// better on one.
+func markFrontier(points []paretoPoint) {
+	for i := range points {
+		points[i].Frontier = true
+		for j := range points {
+			a, b := points[j], points[i]
+			if a.WallNs <= b.WallNs && a.CPUNs <= b.CPUNs && (a.WallNs < b.WallNs || a.CPUNs < b.CPUNs) {
+				points[i].Frontier = false
+				break
+			}
+		}
+	}
+}
+
+func medianOf(v []int64) int64 {
+	s := append([]int64(nil), v...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s[len(s)/2]
+}
+
+// paretoChart is a scatter plot with CPU time on x and wall time on y.
+func paretoChart(points []paretoPoint) template.HTML {
+	const width, height, pad = 640, 360, 60
+
+	var maxWall, maxCPU int64 = 1, 1
+	for _, p := range points {
+		if p.WallNs > maxWall {
+			maxWall = p.WallNs
+		}
+		if p.CPUNs > maxCPU {
+			maxCPU = p.CPUNs
+		}
+	}
+	x := func(ns int64) float64 { return pad + float64(width-2*pad)*float64(ns)/float64(maxCPU) }
+	y := func(ns int64) float64 {
+		return float64(height-pad) - float64(height-2*pad)*float64(ns)/float64(maxWall)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" width="%d" height="%d" role="img"><title>Wall vs CPU time</title>`, width, height)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`, pad, height-pad, width-pad, height-pad)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`, pad, pad, pad, height-pad)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">CPU time (max %s)</text>`, width-pad, height-pad+32, time.Duration(maxCPU))
+	fmt.Fprintf(&b, `<text x="%d" y="%d">wall time (max %s)</text>`, 4, pad-12, time.Duration(maxWall))
+
+	var frontier []string
+	for _, p := range points {
+		if p.Frontier {
+			frontier = append(frontier, fmt.Sprintf("%.1f,%.1f", x(p.CPUNs), y(p.WallNs)))
+		}
+	}
+	// Frontier points are ordered by GOMAXPROCS, which walks the curve from
+	// cheapest CPU to lowest wall time
+	fmt.Fprintf(&b, `<polyline fill="none" stroke="#e15759" stroke-dasharray="4 3" points="%s"/>`, strings.Join(frontier, " "))
+
+	for _, p := range points {
+		color := "#bab0ac"
+		if p.Frontier {
+			color = "#e15759"
+		}
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="5" fill="%s"><title>GOMAXPROCS=%d wall=%s cpu=%s</title></circle>`,
+			x(p.CPUNs), y(p.WallNs), color, p.Procs, time.Duration(p.WallNs), time.Duration(p.CPUNs))
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f">%d</text>`, x(p.CPUNs)+7, y(p.WallNs)-7, p.Procs)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+var paretoTemplate = template.Must(template.New("pareto").Funcs(template.FuncMap{
+	"dur": func(ns int64) string { return time.Duration(ns).String() },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Parallel efficiency frontier</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; font-size: 0.9em; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: right; }
+tr.frontier td { font-weight: bold; }
+.chart { display: block; margin: 0.5em 0; font-size: 11px; }
+</style>
+</head>
+<body>
+<h1>Parallel efficiency frontier</h1>
+<p>Each point is one GOMAXPROCS level (labelled). Red points are on the efficient frontier: no other level is faster while using less CPU.</p>
+{{range .}}
+<h2>{{.Name}}</h2>
+{{.Chart}}
+<table>
+<tr><th>GOMAXPROCS</th><th>Wall</th><th>CPU</th><th>Frontier</th></tr>
+{{range .Points}}<tr{{if .Frontier}} class="frontier"{{end}}><td>{{.Procs}}</td><td>{{dur .WallNs}}</td><td>{{dur .CPUNs}}</td><td>{{if .Frontier}}✓{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
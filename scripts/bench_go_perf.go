@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// -perf records hardware performance counters for the benchmark process
+// through perf stat, the perf_event_open front end, which runEnv.command
+// wraps around the binary. Going through the tool rather than the syscall
+// keeps the harness building on every platform from its plain file list.
+
+// perfEvents are the counters recorded, in perf's event names.
+var perfEvents = []string{"instructions", "cycles", "branch-misses", "cache-misses"}
+
+// perfCounts are hardware counter totals per call, warmup calls and process
+// startup included as for CPUNs. IPC is instructions per cycle.
+type perfCounts struct {
+	Instructions int64   `json:"instructions"`
+	Cycles       int64   `json:"cycles"`
+	BranchMisses int64   `json:"branch_misses"`
+	CacheMisses  int64   `json:"cache_misses"`
+	IPC          float64 `json:"ipc,omitempty"`
+}
+
+// perfCommand returns the perf stat prefix that appends counts to out.
+func perfCommand(out string) []string {
+	return []string{"perf", "stat", "-x", ",", "--append", "-o", out, "-e", strings.Join(perfEvents, ","), "--"}
+}
+
+// checkPerf verifies that perf can count for our processes here, which also
+// depends on kernel.perf_event_paranoid.
+func checkPerf() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("hardware counters are only supported on Linux")
+	}
+	out, err := os.CreateTemp("", "pcs-perf-")
+	if err != nil {
+		return err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+	argv := append(perfCommand(out.Name()), "true")
+	if msg, err := exec.Command(argv[0], argv[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("perf stat: %v %s", err, strings.TrimSpace(string(msg)))
+	}
+	if _, err := readPerf(out.Name(), 1); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readPerf sums the counts perf stat appended to path over all runs and
+// divides them by calls.
+func readPerf(path string, calls int) (*perfCounts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	totals := map[string]float64{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// value,unit,event,run time,percent running,...
+		fields := strings.Split(sc.Text(), ",")
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue // <not counted> or <not supported>
+		}
+		totals[perfEventName(fields[2])] += value
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(totals) == 0 {
+		return nil, fmt.Errorf("perf stat counted none of %s", strings.Join(perfEvents, ", "))
+	}
+	if calls < 1 {
+		calls = 1
+	}
+	per := func(event string) int64 { return int64(totals[event] / float64(calls)) }
+	p := &perfCounts{
+		Instructions: per("instructions"),
+		Cycles:       per("cycles"),
+		BranchMisses: per("branch-misses"),
+		CacheMisses:  per("cache-misses"),
+	}
+	if totals["cycles"] > 0 {
+		p.IPC = totals["instructions"] / totals["cycles"]
+	}
+	return p, nil
+}
+
+// perfEventName strips modifiers (instructions:u) and PMU prefixes on hybrid
+// CPUs (cpu_core/instructions/).
+func perfEventName(event string) string {
+	if parts := strings.Split(event, "/"); len(parts) >= 2 {
+		event = parts[1]
+	}
+	event, _, _ = strings.Cut(event, ":")
+	return event
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// -pgo rebuilds each generated program with profile-guided optimization
+// from a CPU profile of its own run and benchmarks the rebuild alongside the
+// default build, as mode <mode>_pgo. Stream cases have no timing driver to
+// profile and are left out.
+
+// pgoProfileTime is how long the profiling run aims to spend in timed
+// calls, so the profile holds enough samples at the default 100 Hz.
+const pgoProfileTime = time.Second
+
+// pgoBinaryName is the rebuilt binary's name in the case's directory.
+const pgoBinaryName = "go_bench_pgo"
+
+// buildPGO profiles binary under env, sized from the median call time of a
+// normal run, and rebuilds prog's sources with the profile as tc was built.
+// The profile and the rebuilt binary go into dir.
+func buildPGO(dir, binary string, tc benchCase, prog program, env runEnv, median int64, fixed int) (string, error) {
+	reps := 100000
+	if median > 0 && int64(pgoProfileTime)/median < int64(reps) {
+		reps = max(int(int64(pgoProfileTime)/median), 10)
+	}
+	env.CPUProfile = filepath.Join(dir, "cpu.pprof")
+	if tc.Data != "" {
+		env.Data = prog.Input
+	}
+	if _, err := runProgram(binary, env, reps, tc.Measure, "warmup", fixed); err != nil {
+		return "", fmt.Errorf("profiling run: %v", err)
+	}
+	pgoBinary := filepath.Join(dir, pgoBinaryName)
+	tc.BuildFlags = append([]string{"-pgo=" + env.CPUProfile}, tc.BuildFlags...)
+	build, err := buildCommand(tc, pgoBinary, prog.Sources)
+	if err != nil {
+		return "", err
+	}
+	if out, err := build.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("go build -pgo: %v: %s", err, firstLine(out))
+	}
+	return pgoBinary, nil
+}
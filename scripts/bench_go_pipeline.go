@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// preparedCase is one case at one size as runBench's producer hands it to
+// the timing loop: generated and built, or settled without a run. done is
+// the result to report instead of timing it, a failure or a skip, whose
+// artifacts are removed outright when discard is set. Gated cases passed
+// the checks that come before the case's Needs, which are only checked
+// once it is due, and unbuilt is its result before generation, for the
+// skip reported when they are not met.
+type preparedCase struct {
+	tc        benchCase
+	n         int
+	name      string
+	est       estimator
+	gc        gcSettings
+	remote    runner
+	span      *span
+	artifacts caseArtifacts
+	base      BenchmarkResult
+	unbuilt   BenchmarkResult
+	prog      program
+	// sized marks a build serving every size (see sizedCode)
+	sized   bool
+	done    *BenchmarkResult
+	discard bool
+	gated   bool
+}
+
+// failure is result failed with class and an Error of format applied to
+// err, pointing at the case's artifacts when keep retains them.
+func (p preparedCase) failure(result BenchmarkResult, keep retention, class, format string, err error) BenchmarkResult {
+	result.Error = fmt.Sprintf(format, err)
+	result.ErrorClass, result.ErrorDetail = class, describeError(err)
+	if keep.keepCase(true) {
+		result.Error += " (artifacts in " + p.artifacts.Dir + ")"
+		result.Artifacts = &p.artifacts
+	}
+	return result
+}
+
+// preflight is what a prepared case is checked for before it is timed: its
+// output against Python (-verify), data races (-race-n) and heap
+// allocations (-allocs). Only verification runs on a remote runner.
+type preflight struct {
+	verify  bool
+	raceN   int
+	allocs  bool
+	timeout time.Duration
+	maxRSS  int64
+}
+
+// check runs the preflight checks of p, returning its base result with
+// Verified and AllocsPerOp set, or the failure to report instead.
+func (c preflight) check(p preparedCase, refs *referenceCache, cache *buildCache, keep retention) (BenchmarkResult, *BenchmarkResult) {
+	tc, base, remote := p.tc, p.base, p.remote
+	be := backends[tc.backend()]
+	fail := func(class, format string, err error) (BenchmarkResult, *BenchmarkResult) {
+		failed := p.failure(base, keep, class, format, err)
+		return base, &failed
+	}
+	if c.verify {
+		env := runEnv{Runner: remote, Timeout: c.timeout}
+		if p.sized {
+			env.Size = p.n
+		}
+		if remote == nil || remote.local() {
+			env.MaxRSS = c.maxRSS
+		}
+		checked, err := verifyCase(be.Runner, refs, tc, p.n, p.prog, p.artifacts.Binary, env)
+		if _, wrong := err.(*wrongResultError); wrong {
+			return fail(errWrongResult, "Generated "+be.Label+" code disagrees with Python: %v", err)
+		} else if err != nil {
+			return fail(runErrorClass(err), "Failed to run generated "+be.Label+" code: %v", err)
+		}
+		base.Verified = checked
+	}
+	if c.raceN > 0 && remote == nil {
+		err := checkRaces(be.Runner, cache, tc, p.artifacts.Dir, c.raceN, runEnv{Timeout: c.timeout})
+		if _, race := err.(*raceError); race {
+			return fail(errDataRace, "Generated "+be.Label+" code races under -race: %v", err)
+		} else if err != nil {
+			return fail(runErrorClass(err), "Race check of generated "+be.Label+" code failed: %v", err)
+		}
+	}
+	if c.allocs && remote == nil {
+		env := runEnv{Timeout: c.timeout, MaxRSS: c.maxRSS}
+		if p.sized {
+			env.Size = p.n
+		}
+		allocs, err := checkAllocs(be.Runner, tc, p.prog, p.artifacts.Binary, env)
+		if _, alloc := err.(*allocError); alloc {
+			base.AllocsPerOp = allocs
+			return fail(errAllocs, "Generated "+be.Label+" code allocates: %v", err)
+		} else if err != nil {
+			return fail(runErrorClass(err), "Allocation count of generated "+be.Label+" code failed: %v", err)
+		}
+		base.AllocsPerOp = allocs
+	}
+	return base, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prCommentMarker starts the harness's pull request comment, so later runs
+// find and update it instead of adding another.
+const prCommentMarker = "<!-- pcs-bench-deltas -->"
+
+// runPRComment implements `pr-comment`: it compares results with the base
+// branch's and posts the deltas as a comment on a GitHub pull request, or
+// updates the comment an earlier run posted.
+func runPRComment(args []string) int {
+	fs := flag.NewFlagSet("pr-comment", flag.ExitOnError)
+	basePath := fs.String("base", "", "NDJSON results of the base branch")
+	threshold := fs.Float64("threshold", 0.15, "relative slowdown counted as a regression")
+	repo := fs.String("repo", os.Getenv("GITHUB_REPOSITORY"), "owner/name of the repository")
+	pr := fs.Int("pr", 0, "pull request number (default: from GITHUB_REF)")
+	dryRun := fs.Bool("n", false, "print the comment instead of posting it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench pr-comment -base base.ndjson [-pr N] results.ndjson...\n")
+		fmt.Fprintf(fs.Output(), "The token is read from GITHUB_TOKEN.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *basePath == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	base, err := loadBaseline(*basePath)
+	if err == nil && len(base) == 0 {
+		err = fmt.Errorf("%s has no measured results", *basePath)
+	}
+	var results []BenchmarkResult
+	if err == nil {
+		results, err = readResults(fs.Args()...)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pr-comment: %v\n", err)
+		return 1
+	}
+	body := renderPRComment(results, base, *threshold)
+	if *dryRun {
+		fmt.Print(body)
+		return 0
+	}
+
+	if *pr == 0 {
+		_, git := detectGit()
+		if git != nil {
+			*pr = git.PR
+		}
+	}
+	token := os.Getenv("GITHUB_TOKEN")
+	if *repo == "" || *pr == 0 || token == "" {
+		fmt.Fprintln(os.Stderr, "pr-comment: need -repo, -pr and GITHUB_TOKEN (or run in a pull_request workflow)")
+		return 2
+	}
+	gh := githubClient{api: getEnv("GITHUB_API_URL", "https://api.github.com"), token: token}
+	url, err := gh.upsertComment(*repo, *pr, body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pr-comment: %v\n", err)
+		return 1
+	}
+	fmt.Println(url)
+	return 0
+}
+
+// prSeverity marks a delta: a regression past threshold, a slowdown past
+// half of it, an improvement past threshold, or noise.
+func prSeverity(d, threshold float64) string {
+	switch {
+	case d > threshold:
+		return "🔴"
+	case d > threshold/2:
+		return "🟠"
+	case d < -threshold:
+		return "🟢"
+	}
+	return "⚪"
+}
+
+// renderPRComment is the comment body: a count per severity, then a table
+// of every benchmark with a base result, worst first. Failures are listed
+// whether or not the base has the benchmark.
+func renderPRComment(results []BenchmarkResult, base baseline, threshold float64) string {
+	type row struct {
+		r BenchmarkResult
+		d float64
+	}
+	var rows []row
+	var failed []BenchmarkResult
+	counts := map[string]int{}
+	for _, r := range results {
+		if r.Error != "" {
+			failed = append(failed, r)
+			continue
+		}
+		if d, ok := base.delta(r); ok {
+			rows = append(rows, row{r, d})
+			counts[prSeverity(d, threshold)]++
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].d > rows[j].d })
+
+	var b strings.Builder
+	b.WriteString(prCommentMarker + "\n## Benchmark deltas vs base\n\n")
+	if len(results) > 0 {
+		fmt.Fprintf(&b, "Commit `%s` on %s (%s), threshold %.0f%%\n\n", results[0].Commit, results[0].OS, results[0].CPU, threshold*100)
+	}
+	fmt.Fprintf(&b, "🔴 %d regressed · 🟠 %d slower · 🟢 %d faster · ⚪ %d unchanged · ❌ %d failed\n\n",
+		counts["🔴"], counts["🟠"], counts["🟢"], counts["⚪"], len(failed))
+	if len(rows) > 0 {
+		b.WriteString("| | Benchmark | N | Base | Head | Δ |\n|---|---|---:|---:|---:|---:|\n")
+		for _, row := range rows {
+			r := row.r
+			name := r.Backend + " " + r.Test + "/" + r.Mode
+			if r.Target != "" {
+				name += " (" + r.Target + ")"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %d | %s | %s | %+.1f%% |\n", prSeverity(row.d, threshold),
+				markdownEscape(name), r.N, time.Duration(base[keyOf(r)]), time.Duration(r.MeanNs), row.d*100)
+		}
+		b.WriteString("\n")
+	}
+	if len(failed) > 0 {
+		b.WriteString("<details><summary>❌ Failures</summary>\n\n")
+		for _, r := range failed {
+			fmt.Fprintf(&b, "- %s %s/%s n=%d: %s\n", r.Backend, r.Test, r.Mode, r.N, markdownEscape(r.Error))
+		}
+		b.WriteString("\n</details>\n")
+	}
+	if url := ciRunURL(); url != "" {
+		fmt.Fprintf(&b, "\n[Workflow run](%s)\n", url)
+	}
+	return b.String()
+}
+
+// githubClient calls the GitHub REST API with a token.
+type githubClient struct {
+	api, token string
+}
+
+func (g githubClient) do(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(g.api, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+type githubComment struct {
+	ID      int64  `json:"id"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+}
+
+// upsertComment edits the pull request's comment that starts with
+// prCommentMarker, or posts a new one, and returns its URL.
+func (g githubClient) upsertComment(repo string, pr int, body string) (string, error) {
+	issue := "/repos/" + repo + "/issues/" + strconv.Itoa(pr) + "/comments"
+	var existing *githubComment
+	for page := 1; existing == nil; page++ {
+		var comments []githubComment
+		if err := g.do(http.MethodGet, issue+"?per_page=100&page="+strconv.Itoa(page), nil, &comments); err != nil {
+			return "", err
+		}
+		for i := range comments {
+			if strings.HasPrefix(comments[i].Body, prCommentMarker) {
+				existing = &comments[i]
+				break
+			}
+		}
+		if len(comments) < 100 {
+			break
+		}
+	}
+	var c githubComment
+	var err error
+	if existing != nil {
+		err = g.do(http.MethodPatch, "/repos/"+repo+"/issues/comments/"+strconv.FormatInt(existing.ID, 10), map[string]string{"body": body}, &c)
+	} else {
+		err = g.do(http.MethodPost, issue, map[string]string{"body": body}, &c)
+	}
+	return c.HTMLURL, err
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// prettyTable renders a run for a terminal (-pretty): a row per result as it
+// is measured, with its delta against -baseline colored by -threshold, a
+// status line naming the case being timed, and a summary once the run is
+// over. Color and the status line need a terminal; NO_COLOR turns color
+// off (no-color.org).
+type prettyTable struct {
+	w         io.Writer
+	color     bool
+	live      bool
+	base      baseline
+	threshold float64
+	testWidth int
+	modeWidth int
+	total     int
+	done      int
+	started   time.Time
+
+	measured, failed, skipped, regressed, improved int
+	speedups                                       []speedupRecord
+}
+
+const (
+	ansiReset  = "\033[0m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiDim    = "\033[2m"
+	ansiBold   = "\033[1m"
+)
+
+// newPrettyTable writes the table's header to f. total is the number of
+// cases the run will time, one per case and size.
+func newPrettyTable(f *os.File, cases []benchCase, sizes []int, base baseline, threshold float64) *prettyTable {
+	terminal := false
+	if info, err := f.Stat(); err == nil {
+		terminal = info.Mode()&os.ModeCharDevice != 0
+	}
+	t := &prettyTable{
+		w:         f,
+		color:     terminal && os.Getenv("NO_COLOR") == "",
+		live:      terminal,
+		base:      base,
+		threshold: threshold,
+		testWidth: len("TEST"),
+		modeWidth: len("MODE"),
+		started:   time.Now(),
+	}
+	for _, tc := range cases {
+		t.testWidth = max(t.testWidth, len(tc.Test))
+		t.modeWidth = max(t.modeWidth, len(tc.Mode)+len("_pgo"))
+		if len(tc.Sizes) > 0 {
+			t.total += len(tc.Sizes)
+		} else {
+			t.total += len(sizes)
+		}
+	}
+	header := fmt.Sprintf("%-*s  %-*s  %10s  %10s  %6s  %10s  %8s", t.testWidth, "TEST", t.modeWidth, "MODE", "N", "MEAN", "STD", "P99", "VS BASE")
+	fmt.Fprintln(t.w, t.paint(ansiBold, header))
+	return t
+}
+
+func (t *prettyTable) paint(code, s string) string {
+	if !t.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// clearStatus erases the status line before anything else is written.
+func (t *prettyTable) clearStatus() {
+	if t.live {
+		fmt.Fprint(t.w, "\r\033[K")
+	}
+}
+
+// progress shows the case about to be timed on the status line.
+func (t *prettyTable) progress(name string, n int) {
+	t.done++
+	if !t.live {
+		return
+	}
+	t.clearStatus()
+	elapsed := time.Since(t.started).Round(time.Second)
+	fmt.Fprint(t.w, t.paint(ansiDim, fmt.Sprintf("[%d/%d %s] timing %s n=%d", t.done, t.total, elapsed, name, n)))
+}
+
+func (t *prettyTable) result(r BenchmarkResult) {
+	t.clearStatus()
+	row := fmt.Sprintf("%-*s  %-*s  %10d  ", t.testWidth, r.Test, t.modeWidth, r.Mode, r.N)
+	switch {
+	case r.Error != "":
+		t.failed++
+		class := r.ErrorClass
+		if class == "" {
+			class = "error"
+		}
+		message, _, _ := strings.Cut(r.Error, "\n")
+		row += t.paint(ansiRed, "FAIL "+class+": "+message)
+	case r.Skipped:
+		t.skipped++
+		reason := r.SkipReason
+		if len(r.Missing) > 0 {
+			reason += ": " + strings.Join(r.Missing, ", ")
+		}
+		row += t.paint(ansiYellow, "SKIP "+reason)
+	default:
+		t.measured++
+		spread := 0.0
+		if r.MeanNs > 0 {
+			spread = float64(r.StdNs) / float64(r.MeanNs) * 100
+		}
+		row += fmt.Sprintf("%s  %5.1f%%  %s  ", prettyDuration(r.MeanNs), spread, prettyDuration(r.P99Ns))
+		if d, ok := t.base.delta(r); ok {
+			delta := fmt.Sprintf("%+7.1f%%", d*100)
+			switch {
+			case d > t.threshold:
+				t.regressed++
+				delta = t.paint(ansiRed, delta)
+			case d < -t.threshold:
+				t.improved++
+				delta = t.paint(ansiGreen, delta)
+			}
+			row += delta
+		} else {
+			row += fmt.Sprintf("%8s", "-")
+		}
+	}
+	fmt.Fprintln(t.w, strings.TrimRight(row, " "))
+}
+
+func (t *prettyTable) speedup(s speedupRecord) {
+	t.speedups = append(t.speedups, s)
+}
+
+// summary writes the totals, the speedups of parallel cases and the run's
+// wall time.
+func (t *prettyTable) summary() {
+	t.clearStatus()
+	fmt.Fprintln(t.w)
+	counts := []string{fmt.Sprintf("%d measured", t.measured)}
+	if t.failed > 0 {
+		counts = append(counts, t.paint(ansiRed, fmt.Sprintf("%d failed", t.failed)))
+	}
+	if t.skipped > 0 {
+		counts = append(counts, t.paint(ansiYellow, fmt.Sprintf("%d skipped", t.skipped)))
+	}
+	if len(t.base) > 0 {
+		regressed := fmt.Sprintf("%d regressed", t.regressed)
+		if t.regressed > 0 {
+			regressed = t.paint(ansiRed, regressed)
+		}
+		counts = append(counts, regressed, fmt.Sprintf("%d improved beyond %.0f%%", t.improved, t.threshold*100))
+	}
+	fmt.Fprintf(t.w, "%s in %s\n", strings.Join(counts, ", "), time.Since(t.started).Round(time.Second))
+	for _, s := range t.speedups {
+		fmt.Fprintf(t.w, "  speedup %s\n", s)
+	}
+}
+
+// prettyDuration rounds ns to four significant digits, right-aligned in
+// the table's ten-column duration fields.
+func prettyDuration(ns int64) string {
+	d := time.Duration(ns)
+	for unit := time.Nanosecond; unit < time.Second && d >= 10000*unit; unit *= 10 {
+		d = d.Round(unit * 10)
+	}
+	s := d.String()
+	// µ is two bytes but one column
+	return strings.Repeat(" ", max(10-utf8.RuneCountInString(s), 0)) + s
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// -compare-binary re-times binaries built by an earlier run (for example a
+// release's artifacts) on this machine, alongside this run's builds, so
+// release-to-release comparisons do not mix in machine differences. Binaries
+// are matched to cases by file name, as -keep-artifacts stores them under
+// target/go_bench_runs/<run>/<case>.
+
+// previousBinaries maps case names to previously built binaries.
+type previousBinaries map[string]string
+
+// loadPreviousBinaries accepts one binary, named after its case, or a
+// directory of them.
+func loadPreviousBinaries(path string) (previousBinaries, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return previousBinaries{filepath.Base(path): path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	prev := previousBinaries{}
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			prev[e.Name()] = filepath.Join(path, e.Name())
+		}
+	}
+	if len(prev) == 0 {
+		return nil, fmt.Errorf("no binaries in %s", path)
+	}
+	return prev, nil
+}
+
+// binaryCommit identifies a previous binary in the commit field of its
+// results by a hash of its contents, since its source commit is unknown.
+func binaryCommit(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "binary:" + hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+// timeAlongside times the current build and another binary (a previous one,
+// or a PGO rebuild) in two rounds, current then other and other then
+// current, so drift during the run affects both alike. Each side gets reps
+// timed calls in total.
+func timeAlongside(timeBinary func(binary string, reps int) (runOutput, error), current, other string, reps int) (cur, alt runOutput, err error) {
+	first := reps / 2
+	for round, order := range [][2]string{{current, other}, {other, current}} {
+		n := first
+		if round == 1 {
+			n = reps - first
+		}
+		for _, binary := range order {
+			run, err := timeBinary(binary, n)
+			if err != nil {
+				if binary == other {
+					err = fmt.Errorf("%s: %v", other, err)
+				}
+				return runOutput{}, runOutput{}, err
+			}
+			side := &cur
+			if binary == other {
+				side = &alt
+			}
+			side.Times = append(side.Times, run.Times...)
+			side.CPU += run.CPU
+			side.Warmup += run.Warmup
+		}
+	}
+	return cur, alt, nil
+}
+
+// reportDelta prints the change from one build of a case to another, e.g.
+// from a previous binary to the current build; topic names the flag.
+func reportDelta(topic, name, oldLabel, newLabel string, old, cur BenchmarkResult) {
+	var a, b []float64
+	for _, t := range old.Samples {
+		a = append(a, float64(t))
+	}
+	for _, t := range cur.Samples {
+		b = append(b, float64(t))
+	}
+	_, p, _ := mannWhitney(a, b)
+	verdict := "no significant change"
+	switch {
+	case math.IsNaN(p) || p >= 0.05:
+	case cur.MedianNs > old.MedianNs:
+		verdict = "slower"
+	default:
+		verdict = "faster"
+	}
+	change := float64(cur.MedianNs-old.MedianNs) / float64(old.MedianNs)
+	fmt.Fprintf(os.Stderr, "%s %s: %s %s, %s %s, %+.1f%% (p=%.2g) %s\n", topic, name,
+		oldLabel, time.Duration(old.MedianNs), newLabel, time.Duration(cur.MedianNs), change*100, p, verdict)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// What the harness measures of a benchmark process (its RSS and resource
+// usage) and how it runs one at a niceness or pinned to CPUs differs by
+// OS; hostProc is the procPlatform of the OS the harness runs on. The
+// harness is built from a plain file list, which ignores build constraints,
+// so every platform's code compiles everywhere: it goes through commands
+// (ps, taskset, nice, tasklist, PowerShell) and reflection rather than
+// OS-specific syscalls. A measurement the OS does not provide is null in a
+// result's resources rather than zero, and a flag needing what the OS
+// cannot do (-cpus on macOS) fails before the run starts.
+
+// procPlatform runs and measures benchmark processes on one OS.
+type procPlatform interface {
+	// rss is the resident set size in bytes of pid and, where the OS
+	// lists them, its descendants, which it also returns, pid first.
+	rss(pid int) (int64, []int, error)
+	// usage is what the OS accounted to an exited process.
+	usage(state *os.ProcessState) *resourceUsage
+	// niceness is the harness's own niceness.
+	niceness() (int, error)
+	// checkNice verifies that processes can run at niceness target, from
+	// the harness's current one.
+	checkNice(current, target int) error
+	// checkPinning verifies that processes can be pinned to cpus.
+	checkPinning(cpus []int) error
+	// wrap is the commands the binary of a process under e is exec'd
+	// through; prepare sets what e needs on the command itself, and start
+	// starts a command, prepared or not.
+	wrap(e runEnv) []string
+	prepare(cmd *exec.Cmd, e runEnv)
+	start(cmd *exec.Cmd) error
+}
+
+var hostProc = procPlatformFor(runtime.GOOS)
+
+func procPlatformFor(goos string) procPlatform {
+	switch goos {
+	case "linux":
+		return linuxProc{psProc{goos, 1 << 10}}
+	case "darwin":
+		return darwinProc{psProc{goos, 1}}
+	case "windows":
+		return windowsProc{}
+	case "freebsd", "netbsd", "openbsd", "dragonfly":
+		return psProc{goos, 1 << 10}
+	}
+	return psProc{goos: goos}
+}
+
+// resourceUsage is what the OS accounted to a benchmark process over its
+// whole run, startup and warmup included: its peak RSS, major page faults
+// and context switches, voluntary or not. Each is null where the OS does
+// not report it.
+type resourceUsage struct {
+	PeakRSSBytes    *int64 `json:"peak_rss_bytes"`
+	MajorFaults     *int64 `json:"major_faults"`
+	ContextSwitches *int64 `json:"context_switches"`
+}
+
+// psProc is a Unix without a better source: ps reports the RSS of a
+// process and the niceness, nice sets it and rusage, whose ru_maxrss is
+// in units of maxRSSUnit bytes (0: not reported), has the usage.
+type psProc struct {
+	goos       string
+	maxRSSUnit int64
+}
+
+func (p psProc) rss(pid int) (int64, []int, error) {
+	out, err := exec.Command("ps", "-o", "rss=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, nil, err
+	}
+	kb, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	return kb << 10, []int{pid}, err
+}
+
+// usage reads the rusage by field name: syscall.Rusage differs between
+// OSes, and Windows' has none of these fields.
+func (p psProc) usage(state *os.ProcessState) *resourceUsage {
+	u := &resourceUsage{}
+	ru := reflect.ValueOf(state.SysUsage())
+	if ru.Kind() != reflect.Pointer || ru.IsNil() {
+		return u
+	}
+	field := func(name string) (int64, bool) {
+		f := ru.Elem().FieldByName(name)
+		if !f.IsValid() || !f.CanInt() {
+			return 0, false
+		}
+		return f.Int(), true
+	}
+	if maxRSS, ok := field("Maxrss"); ok && p.maxRSSUnit > 0 {
+		peak := maxRSS * p.maxRSSUnit
+		u.PeakRSSBytes = &peak
+	}
+	if faults, ok := field("Majflt"); ok {
+		u.MajorFaults = &faults
+	}
+	voluntary, ok1 := field("Nvcsw")
+	involuntary, ok2 := field("Nivcsw")
+	if ok1 && ok2 {
+		switches := voluntary + involuntary
+		u.ContextSwitches = &switches
+	}
+	return u
+}
+
+func (p psProc) niceness() (int, error) {
+	return psNiceness(nil)
+}
+
+// checkNice tries target once up front, as nice only warns when it cannot
+// raise priority and runs the command at the old one.
+func (p psProc) checkNice(current, target int) error {
+	got, err := psNiceness([]string{"nice", "-n", strconv.Itoa(target - current)})
+	if err != nil {
+		return err
+	}
+	if got != target {
+		return fmt.Errorf("processes run at niceness %d, not %d: raising priority needs root or CAP_SYS_NICE", got, target)
+	}
+	return nil
+}
+
+func (p psProc) checkPinning(cpus []int) error {
+	return fmt.Errorf("CPU pinning is not supported on %s", p.goos)
+}
+
+// wrap runs a process through nice, and on Linux taskset, which exec the
+// binary in place, so the process's rusage is the benchmark's own.
+func (p psProc) wrap(e runEnv) []string {
+	return posixWrap(e)
+}
+
+func (p psProc) prepare(cmd *exec.Cmd, e runEnv) {}
+
+func (p psProc) start(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+// posixWrap runs a process through nice and taskset, as on Linux and the
+// machines of -remote.
+func posixWrap(e runEnv) []string {
+	var wrap []string
+	if e.Nice != 0 {
+		wrap = append(wrap, "nice", "-n", strconv.Itoa(e.Nice))
+	}
+	if e.CPUs != "" {
+		wrap = append(wrap, "taskset", "-c", e.CPUs)
+	}
+	return wrap
+}
+
+// psNiceness reads the niceness of a shell started through wrap, or of the
+// harness itself when wrap is empty, with ps.
+func psNiceness(wrap []string) (int, error) {
+	var out []byte
+	var err error
+	if len(wrap) == 0 {
+		out, err = exec.Command("ps", "-o", "nice=", "-p", strconv.Itoa(os.Getpid())).Output()
+	} else {
+		argv := append(wrap, "sh", "-c", "ps -o nice= -p $$")
+		out, err = exec.Command(argv[0], argv[1:]...).Output()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+// linuxProc reads /proc for RSS and pins through taskset.
+type linuxProc struct {
+	psProc
+}
+
+func (linuxProc) rss(pid int) (int64, []int, error) {
+	var total int64
+	pids := []int{pid}
+	for i := 0; i < len(pids); i++ {
+		status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pids[i]))
+		if err != nil {
+			if i == 0 {
+				return 0, nil, err
+			}
+			continue // exited meanwhile
+		}
+		for _, line := range strings.Split(string(status), "\n") {
+			if rest, ok := strings.CutPrefix(line, "VmRSS:"); ok {
+				kb, _ := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(rest), " kB"), 10, 64)
+				total += kb << 10
+			}
+		}
+		// Needs CONFIG_PROC_CHILDREN; without it only pid is counted
+		tasks, _ := filepath.Glob(fmt.Sprintf("/proc/%d/task/*/children", pids[i]))
+		for _, task := range tasks {
+			data, _ := os.ReadFile(task)
+			for _, field := range strings.Fields(string(data)) {
+				if child, err := strconv.Atoi(field); err == nil {
+					pids = append(pids, child)
+				}
+			}
+		}
+	}
+	return total, pids, nil
+}
+
+func (linuxProc) checkPinning(cpus []int) error {
+	list := formatCPUList(cpus)
+	if out, err := exec.Command("taskset", "-c", list, "true").CombinedOutput(); err != nil {
+		return fmt.Errorf("taskset -c %s: %v %s", list, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// darwinProc sums the RSS of a process tree from ps's process table. macOS
+// cannot bind a process to CPUs, only hint at affinity between threads,
+// so it does not pin.
+type darwinProc struct {
+	psProc
+}
+
+func (darwinProc) rss(pid int) (int64, []int, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,ppid=,rss=").Output()
+	if err != nil {
+		return 0, nil, err
+	}
+	children := map[int][]int{}
+	rss := map[int]int64{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		p, err1 := strconv.Atoi(fields[0])
+		parent, err2 := strconv.Atoi(fields[1])
+		kb, err3 := strconv.ParseInt(fields[2], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		children[parent] = append(children[parent], p)
+		rss[p] = kb << 10
+	}
+	if _, ok := rss[pid]; !ok {
+		return 0, nil, fmt.Errorf("no process %d", pid)
+	}
+	var total int64
+	pids := []int{pid}
+	for i := 0; i < len(pids); i++ {
+		total += rss[pids[i]]
+		pids = append(pids, children[pids[i]]...)
+	}
+	return total, pids, nil
+}
+
+func (darwinProc) checkPinning(cpus []int) error {
+	return fmt.Errorf("CPU pinning is not supported on macOS, which cannot bind a process to CPUs")
+}
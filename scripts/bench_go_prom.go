@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pushMetrics renders the run's results in the Prometheus text exposition
+// format and PUTs them to a Pushgateway under the given job, replacing the
+// previous push for that job.
+func pushMetrics(gatewayURL, job string, results []BenchmarkResult) error {
+	body := renderPromMetrics(results)
+
+	endpoint := strings.TrimRight(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("push to %s failed: %s", endpoint, resp.Status)
+	}
+	return nil
+}
+
+type promSeries struct {
+	backend, test, mode, commit string
+	n                           int
+}
+
+func (s promSeries) labels() string {
+	return fmt.Sprintf(`backend="%s",test="%s",mode="%s",commit="%s",n="%d"`,
+		promEscape(s.backend), promEscape(s.test), promEscape(s.mode), promEscape(s.commit), s.n)
+}
+
+func renderPromMetrics(results []BenchmarkResult) []byte {
+	var buf bytes.Buffer
+
+	gauges := []struct {
+		name, help string
+		value      func(BenchmarkResult) int64
+	}{
+		{"pcs_bench_mean_ns", "Mean iteration time in nanoseconds.", func(r BenchmarkResult) int64 { return r.MeanNs }},
+		{"pcs_bench_median_ns", "Median iteration time in nanoseconds.", func(r BenchmarkResult) int64 { return r.MedianNs }},
+		{"pcs_bench_p99_ns", "99th percentile iteration time in nanoseconds.", func(r BenchmarkResult) int64 { return r.P99Ns }},
+	}
+
+	for _, g := range gauges {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, r := range results {
+			if !r.measured() {
+				continue
+			}
+			s := promSeries{r.Backend, r.Test, r.Mode, r.Commit, r.N}
+			fmt.Fprintf(&buf, "%s{%s} %d\n", g.name, s.labels(), g.value(r))
+		}
+	}
+
+	// Error counts are keyed by series so repeated failures add up
+	errors := map[promSeries]int{}
+	for _, r := range results {
+		s := promSeries{r.Backend, r.Test, r.Mode, r.Commit, r.N}
+		if _, ok := errors[s]; !ok {
+			errors[s] = 0
+		}
+		if r.Error != "" {
+			errors[s]++
+		}
+	}
+	keys := make([]promSeries, 0, len(errors))
+	for s := range errors {
+		keys = append(keys, s)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].labels() < keys[j].labels() })
+
+	fmt.Fprintf(&buf, "# HELP pcs_bench_errors Number of failed benchmark cases in the run.\n# TYPE pcs_bench_errors gauge\n")
+	for _, s := range keys {
+		fmt.Fprintf(&buf, "pcs_bench_errors{%s} %d\n", s.labels(), errors[s])
+	}
+
+	return buf.Bytes()
+}
+
+func promEscape(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
@@ -0,0 +1,1035 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// This file parses the comprehensions pcs accepts (see pcs/core.py) into
+// the same IR, so the Go backend can be rendered without Python (see
+// bench_go_codegen.go). Expressions are written back the way Python's
+// ast.unparse writes them, since pcs pastes them into the Go source as is.
+// Anything outside the subset (strings, floats, tuples, lambdas, nested
+// comprehensions, keyword arguments) is an errNotNative error.
+
+// irRange is range(Start, Stop, Step) with constant bounds.
+type irRange struct {
+	Start, Stop, Step int64
+}
+
+// irGenerator is one `for Var in ...` clause. Range is nil when the source
+// is not a range call, and Source then holds it as written. Ifs are the
+// parsed Filters, for strideFilters to match.
+type irGenerator struct {
+	Var     string
+	Range   *irRange
+	Source  string
+	Filters []string
+	Ifs     []pyExpr
+}
+
+// irComp mirrors IRComp: Kind is list, set, dict or generator, and Reduce
+// names the sum/max/min/any/all call wrapping a generator expression.
+// Element is empty for dicts, which set Key and Value instead.
+type irComp struct {
+	Kind       string
+	Generators []irGenerator
+	Element    string
+	Key        string
+	Value      string
+	Reduce     string
+}
+
+// errNotNative marks code or options the native generator does not cover.
+type errNotNative struct{ what string }
+
+func (e *errNotNative) Error() string { return "not supported by the native generator: " + e.what }
+
+func notNative(format string, args ...any) error {
+	return &errNotNative{fmt.Sprintf(format, args...)}
+}
+
+// Python operator precedences, as ast.unparse ranks them (_Precedence).
+const (
+	precTuple = iota + 1
+	precYield
+	precTest
+	precOr
+	precAnd
+	precNot
+	precCmp
+	precBor
+	precBxor
+	precBand
+	precShift
+	precArith
+	precTerm
+	precFactor
+	precPower
+	precAwait
+	precAtom
+)
+
+var binaryPrec = map[string]int{
+	"|": precBor, "^": precBxor, "&": precBand, "<<": precShift, ">>": precShift,
+	"+": precArith, "-": precArith, "*": precTerm, "@": precTerm, "/": precTerm,
+	"%": precTerm, "//": precTerm, "**": precPower,
+}
+
+var pyKeywords = map[string]bool{
+	"and": true, "as": true, "assert": true, "async": true, "await": true, "break": true,
+	"class": true, "continue": true, "def": true, "del": true, "elif": true, "else": true,
+	"except": true, "finally": true, "for": true, "from": true, "global": true, "if": true,
+	"import": true, "in": true, "is": true, "lambda": true, "nonlocal": true, "not": true,
+	"or": true, "pass": true, "raise": true, "return": true, "try": true, "while": true,
+	"with": true, "yield": true,
+}
+
+type pyExpr interface{}
+
+type (
+	pyName  struct{ ID string } // True, False and None included
+	pyInt   struct{ V *big.Int }
+	pyUnary struct {
+		Op string
+		X  pyExpr
+	}
+	pyBinary struct {
+		Op   string
+		L, R pyExpr
+	}
+	pyBool struct {
+		Op     string
+		Values []pyExpr
+	}
+	pyCompare struct {
+		Left        pyExpr
+		Ops         []string
+		Comparators []pyExpr
+	}
+	pyIf   struct{ Body, Test, Else pyExpr }
+	pyCall struct {
+		Func pyExpr
+		Args []pyExpr
+	}
+	pyAttr struct {
+		X    pyExpr
+		Name string
+	}
+	pyIndex struct{ X, Index pyExpr }
+	// pyComp is a comprehension: a list, set or dict one at the top level,
+	// or a generator expression anywhere.
+	pyComp struct {
+		Kind          string
+		Elt, Key, Val pyExpr
+		Generators    []pyFor
+	}
+	pyFor struct {
+		Target pyExpr
+		Iter   pyExpr
+		Ifs    []pyExpr
+	}
+)
+
+type pyToken struct {
+	kind string // name, int, op or eof
+	text string
+}
+
+// pyOps are Python's operators and delimiters, longest first.
+var pyOps = []string{
+	"**", "//", "<<", ">>", "<=", ">=", "==", "!=", ":=",
+	"+", "-", "*", "/", "%", "@", "&", "|", "^", "~", "<", ">",
+	"(", ")", "[", "]", "{", "}", ",", ":", ".", "=", ";",
+}
+
+func tokenizePython(src string) ([]pyToken, error) {
+	if src != "" && (src[0] == ' ' || src[0] == '\t') {
+		return nil, fmt.Errorf("unexpected indent")
+	}
+	var toks []pyToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '_' || isASCIILetter(c):
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || isASCIILetter(src[j]) || isASCIIDigit(src[j])) {
+				j++
+			}
+			toks = append(toks, pyToken{"name", src[i:j]})
+			i = j
+		case isASCIIDigit(c):
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || src[j] == '.' || isASCIILetter(src[j]) || isASCIIDigit(src[j])) {
+				j++
+			}
+			toks = append(toks, pyToken{"int", src[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, o := range pyOps {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, notNative("token %q", src[i:i+1])
+			}
+			toks = append(toks, pyToken{"op", op})
+			i += len(op)
+		}
+	}
+	return append(toks, pyToken{kind: "eof"}), nil
+}
+
+func isASCIILetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isASCIIDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+// pyParser is a recursive-descent parser for Python's expression grammar,
+// trimmed to the subset above.
+type pyParser struct {
+	toks []pyToken
+	pos  int
+}
+
+func (p *pyParser) peek() pyToken { return p.toks[p.pos] }
+
+func (p *pyParser) next() pyToken {
+	t := p.toks[p.pos]
+	if t.kind != "eof" {
+		p.pos++
+	}
+	return t
+}
+
+// at reports whether the next token is the operator or keyword s.
+func (p *pyParser) at(s string) bool {
+	t := p.peek()
+	return (t.kind == "op" || t.kind == "name") && t.text == s
+}
+
+func (p *pyParser) accept(s string) bool {
+	if p.at(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *pyParser) expect(s string) error {
+	if !p.accept(s) {
+		return fmt.Errorf("expected %q, found %q", s, p.peek().text)
+	}
+	return nil
+}
+
+// parseComprehension parses code as pcs does: a single list, set or dict
+// comprehension, generator expression, or reduction call over one.
+func parseComprehension(code string) (irComp, error) {
+	toks, err := tokenizePython(code)
+	if err != nil {
+		return irComp{}, err
+	}
+	p := &pyParser{toks: toks}
+	e, err := p.top()
+	if err != nil {
+		return irComp{}, err
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return irComp{}, fmt.Errorf("unexpected %q", t.text)
+	}
+
+	var ir irComp
+	comp, ok := e.(pyComp)
+	if call, isCall := e.(pyCall); isCall {
+		name, _ := call.Func.(pyName)
+		if unparsePython(call.Func) == "math.prod" {
+			name.ID = "prod"
+		}
+		switch name.ID {
+		case "sum", "prod", "max", "min", "any", "all":
+		case "sorted":
+			// pcs sorts the result (render_go), which is not ported
+			return irComp{}, notNative("sorted()")
+		case "next":
+			// pcs returns from inside the loops (render_go), which is not
+			// ported
+			return irComp{}, notNative("next()")
+		default:
+			return irComp{}, fmt.Errorf("unsupported function call: %s", unparsePython(call.Func))
+		}
+		if name.ID == "sum" && len(call.Args) == 2 {
+			// pcs starts the accumulator from it (_reduce_initial), which is
+			// not ported
+			return irComp{}, notNative("sum() start")
+		}
+		if len(call.Args) != 1 {
+			return irComp{}, fmt.Errorf("function %s expects exactly one argument", name.ID)
+		}
+		if comp, ok = call.Args[0].(pyComp); !ok || comp.Kind != "generator" {
+			return irComp{}, fmt.Errorf("function %s expects a generator expression", name.ID)
+		}
+		ir.Reduce = name.ID
+	} else if !ok {
+		return irComp{}, fmt.Errorf("unsupported expression: %s", code)
+	}
+
+	// pcs lowers reductions over inner comprehensions and conditional
+	// expressions into helper functions (_lower_nested), which is not ported
+	exprs := []pyExpr{comp.Elt, comp.Key, comp.Val}
+	for _, f := range comp.Generators {
+		exprs = append(exprs, f.Ifs...)
+	}
+	for _, e := range exprs {
+		if hasComprehension(e) {
+			return irComp{}, notNative("nested comprehension")
+		}
+		if findExpr(e, func(e pyExpr) bool { _, ok := e.(pyIf); return ok }) {
+			return irComp{}, notNative("conditional expression")
+		}
+	}
+
+	ir.Kind = comp.Kind
+	if comp.Kind == "dict" {
+		ir.Key, ir.Value = unparsePython(comp.Key), unparsePython(comp.Val)
+	} else if ir.Reduce == "any" || ir.Reduce == "all" {
+		// pcs writes the predicate as a Go condition (_go_filters)
+		ir.Element = goCond(comp.Elt)
+	} else {
+		ir.Element = unparsePython(comp.Elt)
+	}
+	// pcs asks for a float number type when the values divide (render_go)
+	if findExpr(comp.Elt, isTrueDivision) || findExpr(comp.Val, isTrueDivision) {
+		if ir.Reduce != "any" && ir.Reduce != "all" {
+			return irComp{}, notNative("true division")
+		}
+	}
+	for _, f := range comp.Generators {
+		target, ok := f.Target.(pyName)
+		if !ok {
+			return irComp{}, notNative("loop target %s", unparsePython(f.Target))
+		}
+		// pcs fuses a comprehension source into the loops over it
+		// (_fuse_sources), which is not ported
+		if hasComprehension(f.Iter) {
+			return irComp{}, notNative("comprehension source")
+		}
+		gen := irGenerator{Var: target.ID, Ifs: f.Ifs}
+		if gen.Range, err = rangeSource(f.Iter); err != nil {
+			return irComp{}, err
+		}
+		if gen.Range == nil {
+			// pcs walks zip() and enumerate() of ranges by index
+			// (_unpack_sources), which is not ported
+			if call, ok := f.Iter.(pyCall); ok && (call.Func == pyName{"zip"} || call.Func == pyName{"enumerate"}) {
+				return irComp{}, notNative("%s source", unparsePython(call.Func))
+			}
+			gen.Source = unparsePython(f.Iter)
+		}
+		for _, cond := range f.Ifs {
+			gen.Filters = append(gen.Filters, goCond(cond))
+		}
+		ir.Generators = append(ir.Generators, gen)
+	}
+	// pcs writes // and the % of a possibly negative operand as calls of
+	// its floor division and modulo helpers (_int_division), which is not
+	// ported
+	nonNegative := map[string]bool{}
+	for _, gen := range ir.Generators {
+		r := gen.Range
+		_, bound := nonNegative[gen.Var]
+		nonNegative[gen.Var] = (!bound || nonNegative[gen.Var]) && r != nil &&
+			(r.Step > 0 && r.Start >= 0 || r.Step < 0 && r.Stop >= -1)
+	}
+	for _, e := range exprs {
+		if e != nil && pythonDivision(e, nonNegative) {
+			return irComp{}, notNative("floor division or modulo")
+		}
+	}
+	return ir, nil
+}
+
+// pythonDivision reports whether e has a // or a % whose operands may be
+// negative, where Go's truncating / and % differ from Python's. pcs keeps
+// a remainder compared with zero as it is, which is not ported either.
+func pythonDivision(e pyExpr, nonNegative map[string]bool) bool {
+	var nonNeg func(e pyExpr) bool
+	nonNeg = func(e pyExpr) bool {
+		switch e := e.(type) {
+		case pyInt:
+			return e.V.Sign() >= 0
+		case pyName:
+			return nonNegative[e.ID]
+		case pyCall:
+			return e.Func == (pyName{"abs"}) || e.Func == (pyName{"len"})
+		case pyBinary:
+			switch e.Op {
+			case "%":
+				return nonNeg(e.R)
+			case "+", "*":
+				return nonNeg(e.L) && nonNeg(e.R)
+			}
+		}
+		return false
+	}
+	return findExpr(e, func(e pyExpr) bool {
+		b, ok := e.(pyBinary)
+		return ok && (b.Op == "//" || b.Op == "%" && !(nonNeg(b.L) && nonNeg(b.R)))
+	})
+}
+
+// rangeSource evaluates range(...) with one to three arguments the way
+// PyToIR does: integer literals count, with their signs. A bound that reads a
+// variable is not covered: PyToIR keeps such a range as written, for Go to
+// loop over its bounds. Neither are the other constant expressions const_int
+// computes, nor a zero step, which pcs rejects only where it loops over the
+// range.
+func rangeSource(e pyExpr) (*irRange, error) {
+	call, ok := e.(pyCall)
+	if !ok || call.Func != (pyName{"range"}) || len(call.Args) < 1 || len(call.Args) > 3 {
+		return nil, nil
+	}
+	var vals []int64
+	for _, arg := range call.Args {
+		if readsName(arg) {
+			return nil, notNative("range bound %s", unparsePython(arg))
+		}
+		sign := int64(1)
+		if u, ok := arg.(pyUnary); ok && (u.Op == "-" || u.Op == "+") {
+			if u.Op == "-" {
+				sign = -1
+			}
+			arg = u.X
+		}
+		a, ok := arg.(pyInt)
+		if !ok || a.V.BitLen() > 62 {
+			return nil, notNative("range bound %s", unparsePython(arg))
+		}
+		vals = append(vals, sign*a.V.Int64())
+	}
+	switch len(vals) {
+	case 1:
+		return &irRange{0, vals[0], 1}, nil
+	case 2:
+		return &irRange{vals[0], vals[1], 1}, nil
+	}
+	if vals[2] == 0 {
+		return nil, notNative("range step 0")
+	}
+	return &irRange{vals[0], vals[1], vals[2]}, nil
+}
+
+// top parses what may stand alone in a pcs expression: a comprehension in
+// its brackets, or an expression (a reduction call).
+func (p *pyParser) top() (pyExpr, error) {
+	switch {
+	case p.at("["), p.at("{"):
+		open := p.next().text
+		return p.comprehension(open)
+	case p.at("("):
+		save := p.pos
+		p.next()
+		elt, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if p.at("for") {
+			return p.comprehensionTail("generator", elt, nil, ")")
+		}
+		p.pos = save
+	}
+	return p.expression()
+}
+
+// comprehension parses a list, set or dict comprehension after its
+// opening bracket.
+func (p *pyParser) comprehension(open string) (pyExpr, error) {
+	first, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if open == "[" {
+		return p.comprehensionTail("list", first, nil, "]")
+	}
+	if p.accept(":") {
+		val, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return p.comprehensionTail("dict", first, val, "}")
+	}
+	return p.comprehensionTail("set", first, nil, "}")
+}
+
+func (p *pyParser) comprehensionTail(kind string, first, val pyExpr, closer string) (pyExpr, error) {
+	comp := pyComp{Kind: kind, Elt: first}
+	if kind == "dict" {
+		comp = pyComp{Kind: kind, Key: first, Val: val}
+	}
+	if !p.at("for") {
+		return nil, notNative("%s display", kind)
+	}
+	for p.accept("for") {
+		target, err := p.bitOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.at(",") {
+			return nil, notNative("tuple loop target")
+		}
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		iter, err := p.disjunction()
+		if err != nil {
+			return nil, err
+		}
+		f := pyFor{Target: target, Iter: iter}
+		for p.accept("if") {
+			cond, err := p.disjunction()
+			if err != nil {
+				return nil, err
+			}
+			f.Ifs = append(f.Ifs, cond)
+		}
+		comp.Generators = append(comp.Generators, f)
+	}
+	if p.at("async") {
+		return nil, notNative("async comprehension")
+	}
+	return comp, p.expect(closer)
+}
+
+func (p *pyParser) expression() (pyExpr, error) {
+	if p.at("lambda") || p.at("yield") {
+		return nil, notNative("%s", p.peek().text)
+	}
+	body, err := p.disjunction()
+	if err != nil || !p.accept("if") {
+		return body, err
+	}
+	test, err := p.disjunction()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("else"); err != nil {
+		return nil, err
+	}
+	orElse, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return pyIf{Body: body, Test: test, Else: orElse}, nil
+}
+
+func (p *pyParser) disjunction() (pyExpr, error) { return p.boolOp("or", p.conjunction) }
+
+func (p *pyParser) conjunction() (pyExpr, error) { return p.boolOp("and", p.inversion) }
+
+func (p *pyParser) boolOp(op string, operand func() (pyExpr, error)) (pyExpr, error) {
+	first, err := operand()
+	if err != nil || !p.at(op) {
+		return first, err
+	}
+	values := []pyExpr{first}
+	for p.accept(op) {
+		v, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return pyBool{Op: op, Values: values}, nil
+}
+
+func (p *pyParser) inversion() (pyExpr, error) {
+	if p.accept("not") {
+		x, err := p.inversion()
+		if err != nil {
+			return nil, err
+		}
+		return pyUnary{Op: "not", X: x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *pyParser) comparison() (pyExpr, error) {
+	left, err := p.bitOr()
+	if err != nil {
+		return nil, err
+	}
+	cmp := pyCompare{Left: left}
+	for {
+		var op string
+		switch t := p.peek(); {
+		case t.kind == "op" && (t.text == "<" || t.text == ">" || t.text == "==" ||
+			t.text == "!=" || t.text == "<=" || t.text == ">="):
+			op = p.next().text
+		case p.accept("in"):
+			op = "in"
+		case p.at("not") && p.toks[p.pos+1].text == "in":
+			p.pos += 2
+			op = "not in"
+		case p.accept("is"):
+			op = "is"
+			if p.accept("not") {
+				op = "is not"
+			}
+		}
+		if op == "" {
+			break
+		}
+		right, err := p.bitOr()
+		if err != nil {
+			return nil, err
+		}
+		cmp.Ops = append(cmp.Ops, op)
+		cmp.Comparators = append(cmp.Comparators, right)
+	}
+	if cmp.Ops == nil {
+		return left, nil
+	}
+	return cmp, nil
+}
+
+// binaryLevels are the left-associative binary operators, loosest first.
+var binaryLevels = [][]string{{"|"}, {"^"}, {"&"}, {"<<", ">>"}, {"+", "-"}, {"*", "@", "/", "%", "//"}}
+
+func (p *pyParser) bitOr() (pyExpr, error) { return p.binary(0) }
+
+func (p *pyParser) binary(level int) (pyExpr, error) {
+	if level == len(binaryLevels) {
+		return p.factor()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != "op" || !contains(binaryLevels[level], t.text) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = pyBinary{Op: t.text, L: left, R: right}
+	}
+}
+
+func (p *pyParser) factor() (pyExpr, error) {
+	if t := p.peek(); t.kind == "op" && (t.text == "-" || t.text == "+" || t.text == "~") {
+		p.next()
+		x, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return pyUnary{Op: t.text, X: x}, nil
+	}
+	base, err := p.primary()
+	if err != nil || !p.accept("**") {
+		return base, err
+	}
+	exp, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	return pyBinary{Op: "**", L: base, R: exp}, nil
+}
+
+func (p *pyParser) primary() (pyExpr, error) {
+	x, err := p.atom()
+	for err == nil {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != "name" || pyKeywords[t.text] {
+				return nil, fmt.Errorf("invalid attribute %q", t.text)
+			}
+			x = pyAttr{X: x, Name: t.text}
+		case p.accept("("):
+			x, err = p.callArgs(x)
+		case p.accept("["):
+			var index pyExpr
+			if index, err = p.expression(); err == nil {
+				if p.at(":") || p.at(",") {
+					return nil, notNative("slice or tuple index")
+				}
+				err = p.expect("]")
+				x = pyIndex{X: x, Index: index}
+			}
+		default:
+			return x, nil
+		}
+	}
+	return nil, err
+}
+
+// callArgs parses positional arguments after "(". A lone generator
+// expression may go without its own parentheses.
+func (p *pyParser) callArgs(fn pyExpr) (pyExpr, error) {
+	call := pyCall{Func: fn}
+	for !p.accept(")") {
+		if len(call.Args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if p.accept(")") {
+				break
+			}
+		}
+		if p.at("*") || p.at("**") || p.toks[p.pos+1].text == "=" {
+			return nil, notNative("starred or keyword argument")
+		}
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if p.at("for") {
+			if len(call.Args) > 0 {
+				return nil, fmt.Errorf("generator expression must be parenthesized")
+			}
+			// The call's own parentheses close the generator
+			comp, err := p.comprehensionTail("generator", arg, nil, ")")
+			if err != nil {
+				return nil, err
+			}
+			call.Args = []pyExpr{comp}
+			return call, nil
+		}
+		call.Args = append(call.Args, arg)
+	}
+	return call, nil
+}
+
+func (p *pyParser) atom() (pyExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case "name":
+		if pyKeywords[t.text] {
+			return nil, fmt.Errorf("unexpected %q", t.text)
+		}
+		return pyName{t.text}, nil
+	case "int":
+		return parsePyInt(t.text)
+	case "op":
+		if t.text == "(" {
+			if p.accept(")") {
+				return nil, notNative("tuple")
+			}
+			inner, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if p.at("for") {
+				return p.comprehensionTail("generator", inner, nil, ")")
+			}
+			if p.at(",") {
+				return nil, notNative("tuple")
+			}
+			return inner, p.expect(")")
+		}
+		if t.text == "[" || t.text == "{" {
+			return nil, notNative("nested %s", t.text)
+		}
+	case "eof":
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+// parsePyInt reads an integer literal; floats and imaginary numbers are
+// outside the subset.
+func parsePyInt(lit string) (pyExpr, error) {
+	if strings.ContainsAny(lit, ".jJ") || !strings.HasPrefix(lit, "0x") && !strings.HasPrefix(lit, "0X") && strings.ContainsAny(lit, "eE") {
+		return nil, notNative("number %s", lit)
+	}
+	// Python has no leading-zero octal: 010 is an error, 00 is zero
+	if len(lit) > 1 && lit[0] == '0' && isASCIIDigit(lit[1]) && strings.Trim(lit, "0_") != "" {
+		return nil, fmt.Errorf("invalid decimal literal %s", lit)
+	}
+	v, ok := new(big.Int).SetString(strings.ToLower(lit), 0)
+	if !ok {
+		if strings.Trim(lit, "0_") == "" {
+			return pyInt{new(big.Int)}, nil
+		}
+		return nil, fmt.Errorf("invalid number %s", lit)
+	}
+	return pyInt{v}, nil
+}
+
+// hasComprehension reports whether e contains a generator expression.
+func hasComprehension(e pyExpr) bool {
+	return findExpr(e, func(e pyExpr) bool {
+		_, ok := e.(pyComp)
+		return ok
+	})
+}
+
+// readsName reports whether e reads a variable, as ast.walk finds a Name
+// in it: True, False and None are constants to Python.
+func readsName(e pyExpr) bool {
+	return findExpr(e, func(e pyExpr) bool {
+		n, ok := e.(pyName)
+		return ok && n.ID != "True" && n.ID != "False" && n.ID != "None"
+	})
+}
+
+// isTrueDivision reports whether e divides with /, which makes a float in
+// Python.
+func isTrueDivision(e pyExpr) bool {
+	b, ok := e.(pyBinary)
+	return ok && b.Op == "/"
+}
+
+// findExpr reports whether match holds for e or an expression within it,
+// comprehensions aside.
+func findExpr(e pyExpr, match func(pyExpr) bool) bool {
+	if match(e) {
+		return true
+	}
+	switch e := e.(type) {
+	case pyUnary:
+		return findExpr(e.X, match)
+	case pyBinary:
+		return findExpr(e.L, match) || findExpr(e.R, match)
+	case pyBool:
+		for _, v := range e.Values {
+			if findExpr(v, match) {
+				return true
+			}
+		}
+	case pyCompare:
+		if findExpr(e.Left, match) {
+			return true
+		}
+		for _, c := range e.Comparators {
+			if findExpr(c, match) {
+				return true
+			}
+		}
+	case pyIf:
+		return findExpr(e.Body, match) || findExpr(e.Test, match) || findExpr(e.Else, match)
+	case pyCall:
+		if findExpr(e.Func, match) {
+			return true
+		}
+		for _, a := range e.Args {
+			if findExpr(a, match) {
+				return true
+			}
+		}
+	case pyAttr:
+		return findExpr(e.X, match)
+	case pyIndex:
+		return findExpr(e.X, match) || findExpr(e.Index, match)
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// unparsePython writes e as ast.unparse would, with its parentheses.
+func unparsePython(e pyExpr) string {
+	var b strings.Builder
+	writePython(&b, e, precTest)
+	return b.String()
+}
+
+// goCond is _go_cond: the filter e as a Go condition, with and, or and not
+// as &&, || and !, a chained comparison as one comparison per pair joined
+// by &&, and an int tested against 0 for its Python truth.
+func goCond(e pyExpr) string {
+	text, _ := goCondPrec(e)
+	return text
+}
+
+// goCondPrec returns e as a Go condition and the precedence it binds
+// with: || 1, && 2, comparisons 3, operands of ! 6.
+func goCondPrec(e pyExpr) (string, int) {
+	wrap := func(e pyExpr, prec int) string {
+		text, own := goCondPrec(e)
+		if own < prec {
+			return "(" + text + ")"
+		}
+		return text
+	}
+	switch e := e.(type) {
+	case pyBool:
+		op, prec := "&&", 2
+		if e.Op == "or" {
+			op, prec = "||", 1
+		}
+		parts := make([]string, len(e.Values))
+		for i, v := range e.Values {
+			parts[i] = wrap(v, prec)
+		}
+		return strings.Join(parts, " "+op+" "), prec
+	case pyUnary:
+		if e.Op != "not" {
+			break
+		}
+		if !isCondition(e.X) {
+			return unparsePython(e.X) + " == 0", 3
+		}
+		return "!" + wrap(e.X, 6), 6
+	case pyCompare:
+		if len(e.Ops) == 1 {
+			return unparsePython(e), 3
+		}
+		operands := append([]pyExpr{e.Left}, e.Comparators...)
+		pairs := make([]string, len(e.Ops))
+		for i, op := range e.Ops {
+			pairs[i] = unparsePython(pyCompare{operands[i], []string{op}, []pyExpr{operands[i+1]}})
+		}
+		return strings.Join(pairs, " && "), 2
+	case pyName:
+		if e.ID == "True" || e.ID == "False" {
+			return strings.ToLower(e.ID), 6
+		}
+	}
+	return unparsePython(e) + " != 0", 3
+}
+
+// isCondition reports whether e is a bool to Go already.
+func isCondition(e pyExpr) bool {
+	switch e := e.(type) {
+	case pyBool, pyCompare:
+		return true
+	case pyUnary:
+		return e.Op == "not"
+	case pyName:
+		return e.ID == "True" || e.ID == "False"
+	}
+	return false
+}
+
+// writePython writes e where the surrounding expression binds with
+// precedence ctx, parenthesizing operators that bind more loosely.
+func writePython(b *strings.Builder, e pyExpr, ctx int) {
+	paren := func(own int, body func()) {
+		if ctx > own {
+			b.WriteByte('(')
+			body()
+			b.WriteByte(')')
+			return
+		}
+		body()
+	}
+	switch e := e.(type) {
+	case pyName:
+		b.WriteString(e.ID)
+	case pyInt:
+		b.WriteString(e.V.String())
+	case pyUnary:
+		own := precFactor
+		if e.Op == "not" {
+			own = precNot
+		}
+		paren(own, func() {
+			b.WriteString(e.Op)
+			if own != precFactor {
+				b.WriteByte(' ')
+			}
+			writePython(b, e.X, own)
+		})
+	case pyBinary:
+		own := binaryPrec[e.Op]
+		left, right := own, own+1
+		if e.Op == "**" {
+			left, right = own+1, own
+		}
+		paren(own, func() {
+			writePython(b, e.L, left)
+			b.WriteString(" " + e.Op + " ")
+			writePython(b, e.R, right)
+		})
+	case pyBool:
+		own := precOr
+		if e.Op == "and" {
+			own = precAnd
+		}
+		paren(own, func() {
+			// Each further operand binds one level tighter, as in ast.unparse
+			level := own
+			for i, v := range e.Values {
+				if i > 0 {
+					b.WriteString(" " + e.Op + " ")
+				}
+				if level < precAtom {
+					level++
+				}
+				writePython(b, v, level)
+			}
+		})
+	case pyCompare:
+		paren(precCmp, func() {
+			writePython(b, e.Left, precCmp+1)
+			for i, op := range e.Ops {
+				b.WriteString(" " + op + " ")
+				writePython(b, e.Comparators[i], precCmp+1)
+			}
+		})
+	case pyIf:
+		paren(precTest, func() {
+			writePython(b, e.Body, precTest+1)
+			b.WriteString(" if ")
+			writePython(b, e.Test, precTest+1)
+			b.WriteString(" else ")
+			writePython(b, e.Else, precTest)
+		})
+	case pyCall:
+		writePython(b, e.Func, precAtom)
+		b.WriteByte('(')
+		for i, arg := range e.Args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writePython(b, arg, precTest)
+		}
+		b.WriteByte(')')
+	case pyAttr:
+		writePython(b, e.X, precAtom)
+		if _, ok := e.X.(pyInt); ok {
+			b.WriteByte(' ')
+		}
+		b.WriteString("." + e.Name)
+	case pyIndex:
+		writePython(b, e.X, precAtom)
+		b.WriteByte('[')
+		writePython(b, e.Index, precTest)
+		b.WriteByte(']')
+	case pyComp:
+		// Only generator expressions get this far (see atom)
+		b.WriteByte('(')
+		writePython(b, e.Elt, precTest)
+		for _, f := range e.Generators {
+			b.WriteString(" for ")
+			writePython(b, f.Target, precTuple)
+			b.WriteString(" in ")
+			writePython(b, f.Iter, precTest+1)
+			for _, cond := range f.Ifs {
+				b.WriteString(" if ")
+				writePython(b, cond, precTest+1)
+			}
+		}
+		b.WriteByte(')')
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// errDataRace: the race detector reported a data race in a parallel case's
+// program, built with -race and run at -race-n before timing
+const errDataRace = "data_race"
+
+// raceError is a run of a -race build that reported a data race. Its
+// message names the first racing access; the full reports are in the
+// process output it wraps.
+type raceError struct {
+	access string
+	err    error
+}
+
+func (e *raceError) Error() string {
+	return "data race: " + e.access
+}
+
+func (e *raceError) Unwrap() error { return e.err }
+
+// checkRaces builds tc's program at size n with -race under dir and runs it
+// once, returning a raceError when the detector reports a race. Only
+// parallel cases built by gc for the host are checked; the rest return nil.
+func checkRaces(r BackendRunner, cache *buildCache, tc benchCase, dir string, n int, env runEnv) error {
+	v, ok := r.(verifier)
+	if !ok || !tc.Parallel || tc.Stream != "" || tc.Target != "" || tc.toolchain() != "gc" {
+		return nil
+	}
+	code, _, err := r.Generate(cache, tc, n)
+	if err != nil {
+		return fmt.Errorf("generating at n=%d: %w", n, err)
+	}
+	raced := tc
+	raced.BuildFlags = append(append([]string(nil), tc.BuildFlags...), "-race")
+	prog, err := r.Build(raced, code, filepath.Join(dir, "race"), n)
+	if err != nil {
+		return err
+	}
+	binary := filepath.Join(dir, "race_bin")
+	cmd, err := prog.Compile(binary)
+	if err != nil {
+		return err
+	}
+	if log, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("building with -race: %w", &commandError{cmd.Args, err, log})
+	}
+	if _, err = v.Result(raced, prog, binary, env); err != nil {
+		var ce *commandError
+		if errors.As(err, &ce) && bytes.Contains(ce.output, []byte("WARNING: DATA RACE")) {
+			return &raceError{firstRace(ce.output), err}
+		}
+	}
+	return err
+}
+
+// firstRace summarizes the first report in race detector output as its
+// access and the function making it, e.g. "Write at 0xc0000a0000 by
+// goroutine 7 in main.program.func1()".
+func firstRace(output []byte) string {
+	_, report, _ := strings.Cut(string(output), "WARNING: DATA RACE")
+	var lines []string
+	for _, line := range strings.Split(report, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+		if len(lines) == 2 {
+			break
+		}
+	}
+	switch len(lines) {
+	case 0:
+		return "reported by the race detector"
+	case 1:
+		return strings.TrimSuffix(lines[0], ":")
+	}
+	return strings.TrimSuffix(lines[0], ":") + " in " + lines[1]
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// -redact makes results shareable: the hostname and username become short
+// hashes, which still tell runners apart without naming them; the working
+// directory, home and temporary directories become ".", "~" and "$TMPDIR"
+// wherever they appear, in error output too; and fields that hold a whole
+// path still absolute after that are hashed. Timings, the machine
+// fingerprint and labels are kept as they are.
+
+// redaction is the run's scrubber, nil without -redact.
+var redaction *redactor
+
+// redactor rewrites identifying strings.
+type redactor struct {
+	replacer *strings.Replacer
+	hostname string
+	username string
+}
+
+// identityVars are environment variables that name a person or a machine.
+var identityVars = map[string]bool{
+	"USER": true, "LOGNAME": true, "HOSTNAME": true,
+	"RUNNER_NAME": true, "GITHUB_ACTOR": true, "GITHUB_TRIGGERING_ACTOR": true,
+}
+
+func newRedactor() *redactor {
+	r := &redactor{}
+	r.hostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		r.username = u.Username
+	} else {
+		r.username = os.Getenv("USER")
+	}
+
+	type swap struct{ old, new string }
+	var swaps []swap
+	add := func(old, new string) {
+		if len(old) > 2 && old != string(filepath.Separator) {
+			swaps = append(swaps, swap{old, new})
+		}
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		add(cwd, ".")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		add(home, "~")
+	}
+	add(filepath.Clean(os.TempDir()), "$TMPDIR")
+	add(r.hostname, redactHash("host", r.hostname))
+	add(r.username, redactHash("user", r.username))
+	// The working directory usually lies in home, so longest first
+	sort.SliceStable(swaps, func(i, j int) bool { return len(swaps[i].old) > len(swaps[j].old) })
+	var pairs []string
+	for _, s := range swaps {
+		pairs = append(pairs, s.old, s.new)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+	return r
+}
+
+// redactHash is kind followed by a short hash of s.
+func redactHash(kind, s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return kind + "-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// text rewrites the identifying strings in s.
+func (r *redactor) text(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// path rewrites a field holding one path, hashing it if still absolute.
+func (r *redactor) path(p string) string {
+	if r == nil || p == "" {
+		return p
+	}
+	if p = r.text(p); filepath.IsAbs(p) {
+		return redactHash("path", p)
+	}
+	return p
+}
+
+// host is the hostname to report.
+func (r *redactor) host(name string) string {
+	if r == nil || name == "" {
+		return name
+	}
+	return redactHash("host", name)
+}
+
+// result is res with its identifying fields rewritten. Shared maps and
+// pointers are copied rather than changed.
+func (r *redactor) result(res BenchmarkResult) BenchmarkResult {
+	if r == nil {
+		return res
+	}
+	res.Error = r.text(res.Error)
+	res.Binary = r.path(res.Binary)
+	res.BuildFlags = r.texts(res.BuildFlags)
+	res.BuildSettings = r.values(res.BuildSettings)
+	if d := res.ErrorDetail; d != nil {
+		copied := *d
+		copied.Command, copied.Output = r.text(d.Command), r.text(d.Output)
+		if c := d.Crash; c != nil {
+			crash := *c
+			crash.Message = r.text(c.Message)
+			copied.Crash = &crash
+		}
+		res.ErrorDetail = &copied
+	}
+	if a := res.Artifacts; a != nil {
+		res.Artifacts = &caseArtifacts{Dir: r.path(a.Dir), Binary: r.path(a.Binary)}
+	}
+	if s := res.Sched; s != nil {
+		copied := *s
+		copied.Trace = r.path(s.Trace)
+		res.Sched = &copied
+	}
+	if e := res.Env; e != nil {
+		copied := *e
+		copied.Vars = map[string]string{}
+		for name, value := range e.Vars {
+			if identityVars[name] {
+				copied.Vars[name] = redactHash(strings.ToLower(name), value)
+			} else {
+				copied.Vars[name] = r.path(value)
+			}
+		}
+		res.Env = &copied
+	}
+	return res
+}
+
+// header is h with the paths in its configuration rewritten.
+func (r *redactor) header(h runHeader) runHeader {
+	if r == nil {
+		return h
+	}
+	h.Config = r.values(h.Config)
+	return h
+}
+
+func (r *redactor) texts(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = r.text(s)
+	}
+	return out
+}
+
+func (r *redactor) values(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = r.path(v)
+	}
+	return out
+}
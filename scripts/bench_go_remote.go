@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// -targets cross-compiles every case for other GOOS/GOARCH pairs as well
+// (benchCase.Target). A cross-compiled case is only built, reporting its
+// compile time and binary size, unless it has a runner: -remote ships the
+// binary to another machine and times it there, -wasm (bench_go_wasm.go)
+// runs WebAssembly builds locally. Either way the results join this run's
+// stream with their target recorded.
+
+// skipCrossCompiled is the SkipReason for cross-compiled cases that were
+// built but had no runner for their target.
+const skipCrossCompiled = "cross_compiled"
+
+// skipRunner is the SkipReason for stream cases built for a runner outside
+// this machine's process tree, whose startup would swamp per-process
+// timings.
+const skipRunner = "runner_unsupported"
+
+// hostTarget is this machine's GOOS/GOARCH.
+var hostTarget = runtime.GOOS + "/" + runtime.GOARCH
+
+// parseTargets reads a comma-separated list of GOOS/GOARCH pairs. The host
+// is dropped, as every case already runs on it.
+func parseTargets(list string) ([]string, error) {
+	var targets []string
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || t == hostTarget {
+			continue
+		}
+		goos, goarch, ok := strings.Cut(t, "/")
+		if !ok || goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+			return nil, fmt.Errorf("invalid target %q (want GOOS/GOARCH, e.g. linux/arm64)", t)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// crossCases adds a copy of each case per target after the host cases.
+// Dependencies refer to the copies for the same target.
+func crossCases(cases []benchCase, targets []string) []benchCase {
+	out := append([]benchCase(nil), cases...)
+	for _, target := range targets {
+		suffix := "_" + strings.ReplaceAll(target, "/", "_")
+		for _, tc := range cases {
+			if tc.Target != "" {
+				continue
+			}
+			tc.Target = target
+			tc.After = withSuffix(tc.After, suffix)
+			tc.Needs = withSuffix(tc.Needs, suffix)
+			out = append(out, tc)
+		}
+	}
+	return out
+}
+
+func withSuffix(names []string, suffix string) []string {
+	var out []string
+	for _, n := range names {
+		out = append(out, n+suffix)
+	}
+	return out
+}
+
+// A runner executes binaries built for another target. prepare and cleanup
+// bracket the runs of one binary; argv is the local command line running
+// it with the given environment, wrapped in wrap (taskset, perf stat).
+// Local runners run the binary on this machine, so its CPU time and the
+// machine state still describe the benchmark.
+type runner interface {
+	prepare(binary, name string) error
+	argv(binary string, env, wrap, args []string) []string
+	cleanup(binary string)
+	local() bool
+}
+
+// crossEnv is the go build environment for target.
+func crossEnv(target string) []string {
+	goos, goarch, _ := strings.Cut(target, "/")
+	return append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+}
+
+// remoteRunner runs benchmark binaries on another machine through a command
+// template such as "ssh bench@arm64-box". The remote command line is passed
+// in place of a {cmd} argument of the template, or appended to it.
+type remoteRunner struct {
+	Template []string
+	// shipped maps local binaries to their copies on the remote
+	shipped map[string]string
+}
+
+// parseRemotes reads -remote values of the form GOOS/GOARCH=TEMPLATE.
+func parseRemotes(specs []string) (map[string]runner, error) {
+	remotes := map[string]runner{}
+	for _, spec := range specs {
+		target, template, ok := strings.Cut(spec, "=")
+		if !ok || len(strings.Fields(template)) == 0 {
+			return nil, fmt.Errorf("invalid remote %q (want GOOS/GOARCH=COMMAND, e.g. linux/arm64='ssh bench@arm64-box')", spec)
+		}
+		remotes[strings.TrimSpace(target)] = &remoteRunner{Template: strings.Fields(template), shipped: map[string]string{}}
+	}
+	return remotes, nil
+}
+
+func (r *remoteRunner) local() bool { return false }
+
+// argv runs the shipped copy of binary, passing the settings through
+// env(1); pinning refers to the remote's CPUs.
+func (r *remoteRunner) argv(binary string, env, wrap, args []string) []string {
+	argv := append(append([]string{"env"}, env...), wrap...)
+	argv = append(append(argv, r.shipped[binary]), args...)
+	return r.shell(argv...)
+}
+
+// shell is the local command line running the remote command args.
+func (r *remoteRunner) shell(args ...string) []string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	line := strings.Join(quoted, " ")
+	var argv []string
+	substituted := false
+	for _, f := range r.Template {
+		if f == "{cmd}" {
+			f, substituted = line, true
+		}
+		argv = append(argv, f)
+	}
+	if !substituted {
+		argv = append(argv, line)
+	}
+	return argv
+}
+
+// prepare ships binary to the remote's temporary directory under name.
+func (r *remoteRunner) prepare(binary, name string) error {
+	in, err := os.Open(binary)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	dest := path.Join("/tmp", "pcs-bench-"+name)
+	argv := r.shell("sh", "-c", `cat > "$0" && chmod +x "$0"`, dest)
+	cmd := commandContext(argv[0], argv[1:]...)
+	cmd.Stdin = in
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("shipping to %s: %v: %s", strings.Join(r.Template, " "), err, firstLine(out))
+	}
+	r.shipped[binary] = dest
+	return nil
+}
+
+// cleanup deletes the remote copy of binary.
+func (r *remoteRunner) cleanup(binary string) {
+	if dest, ok := r.shipped[binary]; ok {
+		argv := r.shell("rm", "-f", dest)
+		commandContext(argv[0], argv[1:]...).Run()
+		delete(r.shipped, binary)
+	}
+}
+
+// shellQuote quotes s for a POSIX shell on the remote side.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=/.,:+@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runReport implements `report`: it renders one or more NDJSON result files
+// into a single static HTML page with sortable tables and per-test charts.
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	out := fs.String("o", "bench_report.html", "HTML file to write")
+	title := fs.String("title", "PCS benchmark report", "page title")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench report [-o file.html] results.ndjson...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	results, err := readResults(fs.Args()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "report: %v\n", err)
+		return 1
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "report: %v\n", err)
+		return 1
+	}
+	err = reportTemplate.Execute(f, buildReport(*title, fs.Args(), results))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "report: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d results to %s\n", len(results), *out)
+	return 0
+}
+
+type reportPage struct {
+	Title     string
+	Generated string
+	Files     []string
+	Total     int
+	Failed    int
+	Skipped   int
+	Tests     []reportTest
+	Rows      []BenchmarkResult
+}
+
+type reportTest struct {
+	Name   string
+	Charts []template.HTML
+}
+
+// reportSeries is one line of a chart: a backend/mode pair of a test.
+type reportSeries struct {
+	Label  string
+	Points []BenchmarkResult
+}
+
+func buildReport(title string, files []string, results []BenchmarkResult) reportPage {
+	page := reportPage{
+		Title:     title,
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Files:     files,
+		Total:     len(results),
+		Rows:      results,
+	}
+
+	byTest := map[string]map[string]*reportSeries{}
+	for _, r := range results {
+		if r.Error != "" {
+			page.Failed++
+			continue
+		}
+		if r.Skipped {
+			page.Skipped++
+			continue
+		}
+		if byTest[r.Test] == nil {
+			byTest[r.Test] = map[string]*reportSeries{}
+		}
+		label := r.Backend + "/" + r.Mode
+		s := byTest[r.Test][label]
+		if s == nil {
+			s = &reportSeries{Label: label}
+			byTest[r.Test][label] = s
+		}
+		s.Points = append(s.Points, r)
+	}
+
+	for name, seriesByLabel := range byTest {
+		var series []reportSeries
+		history := false
+		for _, s := range seriesByLabel {
+			sort.SliceStable(s.Points, func(i, j int) bool { return s.Points[i].Timestamp < s.Points[j].Timestamp })
+			series = append(series, *s)
+			if len(s.Points) > 1 {
+				history = true
+			}
+		}
+		sort.Slice(series, func(i, j int) bool { return series[i].Label < series[j].Label })
+
+		t := reportTest{Name: name, Charts: []template.HTML{barChart(series)}}
+		if history {
+			t.Charts = append(t.Charts, lineChart(series))
+		}
+		page.Tests = append(page.Tests, t)
+	}
+	sort.Slice(page.Tests, func(i, j int) bool { return page.Tests[i].Name < page.Tests[j].Name })
+	return page
+}
+
+var chartColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+// barChart draws the latest mean of every series as a horizontal bar.
+func barChart(series []reportSeries) template.HTML {
+	const width, labelW, rowH = 720, 220, 22
+	height := rowH*len(series) + 10
+
+	var max int64
+	for _, s := range series {
+		if m := s.Points[len(s.Points)-1].MeanNs; m > max {
+			max = m
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" width="%d" height="%d" role="img"><title>Latest mean per backend/mode</title>`, width, height)
+	for i, s := range series {
+		last := s.Points[len(s.Points)-1]
+		y := i*rowH + 5
+		w := int(float64(width-labelW-110) * float64(last.MeanNs) / float64(max))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, labelW-8, y+14, template.HTMLEscapeString(s.Label))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`, labelW, y+2, w, rowH-6, chartColors[i%len(chartColors)])
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, labelW+w+6, y+14, time.Duration(last.MeanNs))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// lineChart draws mean over time for every series, one point per record in
+// timestamp order across the whole test.
+func lineChart(series []reportSeries) template.HTML {
+	const width, height, pad, legendW = 720, 240, 40, 200
+
+	var stamps []string
+	seen := map[string]bool{}
+	var max int64
+	for _, s := range series {
+		for _, p := range s.Points {
+			if !seen[p.Timestamp] {
+				seen[p.Timestamp] = true
+				stamps = append(stamps, p.Timestamp)
+			}
+			if p.MeanNs > max {
+				max = p.MeanNs
+			}
+		}
+	}
+	sort.Strings(stamps)
+	index := map[string]int{}
+	for i, ts := range stamps {
+		index[ts] = i
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	plotW := float64(width - legendW - 2*pad)
+	plotH := float64(height - 2*pad)
+	x := func(ts string) float64 {
+		if len(stamps) == 1 {
+			return pad + plotW/2
+		}
+		return pad + plotW*float64(index[ts])/float64(len(stamps)-1)
+	}
+	y := func(ns int64) float64 {
+		return pad + plotH - plotH*float64(ns)/float64(max)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" width="%d" height="%d" role="img"><title>Mean over time</title>`, width, height)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`, pad, height-pad, width-legendW-pad, height-pad)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`, pad, pad, pad, height-pad)
+	fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, 2, pad-8, time.Duration(max))
+	fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, pad, height-pad+16, template.HTMLEscapeString(stamps[0]))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, width-legendW-pad, height-pad+16, template.HTMLEscapeString(stamps[len(stamps)-1]))
+
+	for i, s := range series {
+		color := chartColors[i%len(chartColors)]
+		var pts []string
+		for _, p := range s.Points {
+			pts = append(pts, fmt.Sprintf("%.1f,%.1f", x(p.Timestamp), y(p.MeanNs)))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, color, strings.Join(pts, " "))
+		for _, p := range s.Points {
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s %s: %s</title></circle>`,
+				x(p.Timestamp), y(p.MeanNs), color, template.HTMLEscapeString(s.Label), template.HTMLEscapeString(p.Commit), time.Duration(p.MeanNs))
+		}
+		ly := pad + i*18
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`, width-legendW+8, ly, color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, width-legendW+26, ly+11, template.HTMLEscapeString(s.Label))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"dur": func(ns int64) string {
+		if ns == 0 {
+			return ""
+		}
+		return time.Duration(ns).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; font-size: 0.9em; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; }
+th { background: #f4f4f4; cursor: pointer; user-select: none; }
+th.asc::after { content: " ▲"; }
+th.desc::after { content: " ▼"; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+tr.failed td { background: #fdecea; }
+tr.skipped td { color: #888; }
+.chart { display: block; margin: 0.5em 0; font-size: 11px; }
+.meta { color: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Generated {{.Generated}} from {{range $i, $f := .Files}}{{if $i}}, {{end}}<code>{{$f}}</code>{{end}} · {{.Total}} results, {{.Failed}} failed, {{.Skipped}} skipped</p>
+
+{{range .Tests}}
+<h2>{{.Name}}</h2>
+{{range .Charts}}{{.}}{{end}}
+{{end}}
+
+<h2>All results</h2>
+<table class="sortable">
+<thead><tr>
+<th>Timestamp</th><th>Commit</th><th>OS</th><th>Backend</th><th>Test</th><th>Mode</th>
+<th data-type="num">N</th><th data-type="num">Mean</th><th data-type="num">Median</th><th data-type="num">p99</th><th data-type="num">Std</th><th>Error / skip reason</th>
+</tr></thead>
+<tbody>
+{{range .Rows}}<tr{{if .Error}} class="failed"{{else if .Skipped}} class="skipped"{{end}}>
+<td>{{.Timestamp}}</td><td>{{.Commit}}</td><td>{{.OS}}</td><td>{{.Backend}}</td><td>{{.Test}}</td><td>{{.Mode}}</td>
+<td class="num" data-value="{{.N}}">{{.N}}</td>
+<td class="num" data-value="{{.MeanNs}}">{{dur .MeanNs}}</td>
+<td class="num" data-value="{{.MedianNs}}">{{dur .MedianNs}}</td>
+<td class="num" data-value="{{.P99Ns}}">{{dur .P99Ns}}</td>
+<td class="num" data-value="{{.StdNs}}">{{dur .StdNs}}</td>
+<td>{{.Error}}{{if .Skipped}}{{.SkipReason}}{{range .Missing}} {{.}}{{end}}{{end}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+
+<script>
+document.querySelectorAll("table.sortable").forEach(function (table) {
+  table.querySelectorAll("th").forEach(function (th, col) {
+    th.addEventListener("click", function () {
+      var asc = !th.classList.contains("asc");
+      table.querySelectorAll("th").forEach(function (h) { h.classList.remove("asc", "desc"); });
+      th.classList.add(asc ? "asc" : "desc");
+      var num = th.dataset.type === "num";
+      var body = table.tBodies[0];
+      var rows = Array.prototype.slice.call(body.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[col], y = b.cells[col];
+        var c = num ? (Number(x.dataset.value) - Number(y.dataset.value))
+                    : x.textContent.localeCompare(y.textContent);
+        return asc ? c : -c;
+      });
+      rows.forEach(function (r) { body.appendChild(r); });
+    });
+  });
+});
+</script>
+</body>
+</html>
+`))
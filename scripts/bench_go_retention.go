@@ -0,0 +1,182 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Every harness run builds its cases under these roots, one subdirectory per
+// run and per case, so artifacts can be kept or pruned independently.
+const (
+	generatedRunsDir = "generated/go_bench_runs"
+	targetRunsDir    = "target/go_bench_runs"
+)
+
+// retention decides which per-case artifacts (generated sources, build log,
+// binary) survive a run, and bounds what older runs may accumulate.
+type retention struct {
+	// Keep is "failed" (default), "all" or "none".
+	Keep     string
+	MaxAge   time.Duration
+	MaxBytes int64
+	// Dir, when set, holds every case's artifacts instead of the run
+	// workspace, and is never pruned (-artifacts-dir)
+	Dir string
+}
+
+var keepPolicies = map[string]bool{"failed": true, "all": true, "none": true}
+
+// keepCase reports whether a finished case's artifacts should stay.
+func (r retention) keepCase(failed bool) bool {
+	return r.Keep == "all" || (r.Keep == "failed" && failed)
+}
+
+// activeMarker is a file in the generated directory of a run that has not
+// finished, so concurrent runs do not prune its workspace.
+const activeMarker = ".active"
+
+// newRunWorkspace reserves this run's directories under both roots. The name,
+// the run's start time plus a random suffix from os.MkdirTemp, is unique
+// across concurrent invocations and serves as the run ID.
+func newRunWorkspace(started time.Time) (string, error) {
+	if err := os.MkdirAll(generatedRunsDir, 0755); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(generatedRunsDir, started.Format("20060102T150405Z")+"_")
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, activeMarker), nil, 0644); err != nil {
+		return "", err
+	}
+	runID := filepath.Base(dir)
+	return runID, os.MkdirAll(filepath.Join(targetRunsDir, runID), 0755)
+}
+
+// closeRunWorkspace marks the run finished and drops its directories if no
+// case kept artifacts.
+func closeRunWorkspace(runID string) {
+	dir := filepath.Join(generatedRunsDir, runID)
+	os.Remove(filepath.Join(dir, activeMarker))
+	os.Remove(dir)
+	os.Remove(filepath.Join(targetRunsDir, runID))
+}
+
+// caseArtifacts locates one case's files.
+type caseArtifacts struct {
+	Dir    string `json:"dir"` // generated sources and build.log
+	Binary string `json:"binary"`
+}
+
+// caseArtifacts reserves the directories of the case name in the run.
+func (r retention) caseArtifacts(runID, name string) (caseArtifacts, error) {
+	a := caseArtifacts{
+		Dir:    filepath.Join(generatedRunsDir, runID, name),
+		Binary: filepath.Join(targetRunsDir, runID, name),
+	}
+	if r.Dir != "" {
+		a.Dir = filepath.Join(r.runDir(runID), "src", name)
+		a.Binary = filepath.Join(r.runDir(runID), "bin", name)
+	}
+	if err := os.MkdirAll(a.Dir, 0755); err != nil {
+		return a, err
+	}
+	return a, os.MkdirAll(filepath.Dir(a.Binary), 0755)
+}
+
+// runDir is where -artifacts-dir keeps the run's artifacts and manifest.
+func (r retention) runDir(runID string) string {
+	return filepath.Join(r.Dir, runID)
+}
+
+func (a caseArtifacts) remove() {
+	os.RemoveAll(a.Dir)
+	os.Remove(a.Binary)
+	// Drop the run directories once their last case is gone
+	os.Remove(filepath.Dir(a.Dir))
+	os.Remove(filepath.Dir(a.Binary))
+}
+
+// prune deletes whole runs, across both roots, that are older than MaxAge,
+// then the oldest remaining runs until their total size fits MaxBytes. A zero
+// limit disables that check. Runs still in progress elsewhere are only
+// removed once expired, which also clears the workspaces of crashed runs.
+func (r retention) prune() error {
+	type run struct {
+		name   string
+		mod    time.Time
+		size   int64
+		paths  []string
+		active bool
+	}
+	runs := map[string]*run{}
+	for _, root := range []string{generatedRunsDir, targetRunsDir} {
+		entries, err := os.ReadDir(root)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			path := filepath.Join(root, e.Name())
+			info, err := e.Info()
+			if err != nil {
+				return err
+			}
+			rn := runs[e.Name()]
+			if rn == nil {
+				rn = &run{name: e.Name()}
+				runs[e.Name()] = rn
+			}
+			if info.ModTime().After(rn.mod) {
+				rn.mod = info.ModTime()
+			}
+			rn.size += diskUsage(path)
+			rn.paths = append(rn.paths, path)
+			if _, err := os.Stat(filepath.Join(path, activeMarker)); err == nil {
+				rn.active = true
+			}
+		}
+	}
+
+	var ordered []*run
+	var total int64
+	for _, rn := range runs {
+		ordered = append(ordered, rn)
+		total += rn.size
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].mod.Before(ordered[j].mod) })
+
+	now := time.Now()
+	for _, rn := range ordered {
+		expired := r.MaxAge > 0 && now.Sub(rn.mod) > r.MaxAge
+		oversize := r.MaxBytes > 0 && total > r.MaxBytes && !rn.active
+		if !expired && !oversize {
+			continue
+		}
+		for _, p := range rn.paths {
+			if err := os.RemoveAll(p); err != nil {
+				return err
+			}
+		}
+		total -= rn.size
+	}
+	return nil
+}
+
+func diskUsage(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
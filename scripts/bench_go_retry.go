@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// -retries gives a case's generate and compile steps more attempts when
+// they fail, so that a go build killed under load, a module cache lock or
+// a pcs process that timed out does not fail the case for the whole night.
+// The waits between attempts start at -retry-backoff and double. With
+// -retry-cv a case whose timings vary by more than that coefficient of
+// variation is timed again too, within the same -retries; the last attempt
+// is the one reported. Results of a run that retries carry the attempts
+// each step took.
+
+// retryPolicy is a run's -retries, -retry-backoff and -retry-cv.
+type retryPolicy struct {
+	Retries int
+	Backoff time.Duration
+	CV      float64
+}
+
+// phaseAttempts counts the attempts a case's steps took; a step the case
+// did not reach, or a build taken from the cache, is absent.
+type phaseAttempts struct {
+	Generate int `json:"generate,omitempty"`
+	Compile  int `json:"compile,omitempty"`
+	Run      int `json:"run,omitempty"`
+}
+
+// attempts is the annotation results of the run start from, nil when it
+// does not retry.
+func (p retryPolicy) attempts() *phaseAttempts {
+	if p.Retries == 0 {
+		return nil
+	}
+	return &phaseAttempts{}
+}
+
+// do runs attempt until it succeeds, has failed p.Retries+1 times or the
+// run is interrupted, and returns the attempts made and the last error. A
+// missing program is not retried.
+func (p retryPolicy) do(name, step string, attempt func() error) (int, error) {
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || n > p.Retries || errors.Is(err, exec.ErrNotFound) || interrupted() {
+			return n, err
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s failed (attempt %d of %d), retrying in %s: %s\n",
+			name, step, n, p.Retries+1, p.wait(n), firstLine([]byte(err.Error())))
+		if !p.pause(n) {
+			return n, err
+		}
+	}
+}
+
+// noisy reports whether the timings of r vary more than -retry-cv allows.
+func (p retryPolicy) noisy(r BenchmarkResult) bool {
+	return p.CV > 0 && r.MeanNs > 0 && float64(r.StdNs)/float64(r.MeanNs) > p.CV
+}
+
+// wait is the backoff after the nth failed attempt.
+func (p retryPolicy) wait(n int) time.Duration {
+	return p.Backoff << (n - 1)
+}
+
+// pause waits out the backoff after the nth attempt, and returns false if
+// the run is interrupted meanwhile.
+func (p retryPolicy) pause(n int) bool {
+	t := time.NewTimer(p.wait(n))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-runCtx.Done():
+		return false
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A benchmark process whose resident set grows past -max-rss is killed
+// before it can exhaust the machine, and its case fails with errOOMGuard
+// rather than taking the runner and every later case down with it.
+
+// rssInterval is how often the watchdog samples a process's RSS.
+const rssInterval = 20 * time.Millisecond
+
+// rssLimitError is a benchmark process killed for exceeding its RSS limit.
+type rssLimitError struct {
+	limit, rss int64
+}
+
+func (e *rssLimitError) Error() string {
+	return fmt.Sprintf("killed at %.1f MiB RSS, over the %.1f MiB limit", float64(e.rss)/(1<<20), float64(e.limit)/(1<<20))
+}
+
+// parseByteSize parses a byte count in GOMEMLIMIT syntax, e.g. 2GiB.
+func parseByteSize(s string) (int64, error) {
+	if !memLimitRE.MatchString(s) {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 2GiB)", s)
+	}
+	digits := strings.TrimRight(s, "BKMGTi")
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 2GiB)", s)
+	}
+	shift := map[string]uint{"": 0, "B": 0, "KiB": 10, "MiB": 20, "GiB": 30, "TiB": 40}[s[len(digits):]]
+	return n << shift, nil
+}
+
+// checkRSSWatch verifies that RSS can be sampled here.
+func checkRSSWatch() error {
+	if _, _, err := hostProc.rss(os.Getpid()); err != nil {
+		return fmt.Errorf("cannot read process RSS on %s: %v", runtime.GOOS, err)
+	}
+	return nil
+}
+
+// watchRSS samples the RSS of pid and its descendants until stop is closed,
+// killing all of them once it exceeds limit. The returned channel yields the
+// limit error, or nil if the process stayed within it.
+func watchRSS(pid int, limit int64, stop <-chan struct{}) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(rssInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				done <- nil
+				return
+			case <-ticker.C:
+			}
+			rss, pids, err := hostProc.rss(pid)
+			if err != nil || rss <= limit {
+				continue
+			}
+			// Reported before the kill, so it is in by the time Wait returns
+			done <- &rssLimitError{limit: limit, rss: rss}
+			// Descendants first, so a wrapper such as perf cannot outlive
+			// or respawn them
+			for i := len(pids) - 1; i >= 0; i-- {
+				if p, err := os.FindProcess(pids[i]); err == nil {
+					p.Kill()
+				}
+			}
+			return
+		}
+	}()
+	return done
+}
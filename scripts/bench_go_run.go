@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+)
+
+// runSchemaVersion is the layout of the results stream: version 2 starts
+// with a run header record, version 3 stamps every result with the version
+// (see bench/schema.json; bench_result.schema.json is its JSON Schema).
+const runSchemaVersion = 3
+
+// runRecord marks the run header among result records.
+const runRecord = "run"
+
+// runHeader is the first record of an NDJSON results stream. It holds what
+// is shared by every result of the run, which refer to it by RunID.
+type runHeader struct {
+	Record        string             `json:"record"`
+	RunID         string             `json:"run_id"`
+	SchemaVersion int                `json:"schema_version"`
+	Started       string             `json:"started"`
+	Commit        string             `json:"commit"`
+	Git           *gitInfo           `json:"git,omitempty"`
+	Profile       string             `json:"profile,omitempty"`
+	Seed          int64              `json:"seed"`
+	ConfigHash    string             `json:"config_hash"`
+	Config        map[string]string  `json:"config"`
+	Machine       machineFingerprint `json:"machine"`
+	// TraceID is the OpenTelemetry trace the run was exported as, if any
+	TraceID string `json:"trace_id,omitempty"`
+	// Labels are the run's user labels (see runLabels)
+	Labels runLabels `json:"labels,omitempty"`
+}
+
+// machineFingerprint describes the machine; ID hashes the rest so runs on
+// the same hardware and toolchain can be grouped.
+type machineFingerprint struct {
+	ID          string       `json:"id"`
+	OS          string       `json:"os"`
+	Arch        string       `json:"arch"`
+	CPUModel    string       `json:"cpu_model,omitempty"`
+	LogicalCPUs int          `json:"logical_cpus"`
+	GoVersion   string       `json:"go_version"`
+	Topology    *cpuTopology `json:"topology,omitempty"`
+}
+
+// benchEnvVars are the environment variables that configure a run.
+var benchEnvVars = []string{"PCS_BENCH_N", "PCS_BENCH_PROTOCOL", "PCS_BENCH_WARMUP", "PCS_BENCH_CPUS", "PCS_BENCH_NICE", "PCS_BENCH_MAX_RSS", "CPU_INFO"}
+
+// reportingFlags only label the run or decide where results go and how
+// they are judged, so they are recorded but left out of the config hash.
+var reportingFlags = map[string]bool{
+	"-profile": true, "-format": true, "-junit": true, "-baseline": true, "-threshold": true, "-calibration": true, "-min-speedup": true, "-history": true,
+	"-cache": true, "-label": true, "-labels-file": true,
+}
+
+// newRunHeader describes the run from the parsed flags, the environment and
+// the bench matrix. The config hash covers all three, so two runs with the
+// same hash measured the same cases the same way.
+func newRunHeader(runID, started, commit string, git *gitInfo, profile string, seed int64, topology *cpuTopology, matrix []benchCase) runHeader {
+	config := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) { config["-"+f.Name] = f.Value.String() })
+	for _, name := range benchEnvVars {
+		if v, ok := os.LookupEnv(name); ok {
+			config[name] = v
+		}
+	}
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		if !reportingFlags[k] {
+			fmt.Fprintf(h, "%s=%s\n", k, config[k])
+		}
+	}
+	fmt.Fprintf(h, "%+v\n", matrix)
+
+	return runHeader{
+		Record:        runRecord,
+		RunID:         runID,
+		SchemaVersion: runSchemaVersion,
+		Started:       started,
+		Commit:        commit,
+		Git:           git,
+		Profile:       profile,
+		Seed:          seed,
+		ConfigHash:    "sha256:" + hex.EncodeToString(h.Sum(nil))[:16],
+		Config:        config,
+		Machine:       newMachineFingerprint(topology),
+	}
+}
+
+// newMachineFingerprint describes this machine with its CPU topology, if
+// known.
+func newMachineFingerprint(topology *cpuTopology) machineFingerprint {
+	m := machineFingerprint{
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		CPUModel:    cpuModel(),
+		LogicalCPUs: runtime.NumCPU(),
+		GoVersion:   runtime.Version(),
+		Topology:    topology,
+	}
+	fp := sha256.New()
+	fmt.Fprintf(fp, "%s/%s/%s/%d/%s", m.OS, m.Arch, m.CPUModel, m.LogicalCPUs, m.GoVersion)
+	if topology != nil {
+		fmt.Fprintf(fp, "/%d/%d", topology.Physical, topology.ThreadsPerCore)
+	}
+	m.ID = hex.EncodeToString(fp.Sum(nil))[:16]
+	return m
+}
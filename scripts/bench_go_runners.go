@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+)
+
+// The Rust, TypeScript and Julia runners time pcs's code for those targets
+// with a driver in the target language that speaks the Go driver's
+// protocol: arguments reps, measure, protocol and warmup count, output
+// "warmup <n>" and then one nanosecond timing per call, so runProgram reads
+// them all and every backend warms up and is summarized the same way. They
+// do not report results, so -verify checks Go code only.
+
+func init() {
+	registerBackend("rust", "Rust", "rustc", rustRunner{})
+	registerBackend("ts", "TypeScript", "tsc", tsRunner{})
+	registerBackend("julia", "Julia", "julia", juliaRunner{})
+}
+
+// rustDriverSource is appended to the generated Rust module.
+const rustDriverSource = `
+fn main() {
+    let args: Vec<String> = std::env::args().collect();
+    let reps: usize = args[1].parse().expect("reps");
+    let fixed: usize = args[4].parse().expect("warmup count");
+    let call = || {
+        let start = std::time::Instant::now();
+        std::hint::black_box(program());
+        start.elapsed().as_nanos() as f64
+    };
+    println!("warmup {}", pcs_warmup(&call, &args[3], fixed));
+    for _ in 0..reps {
+        println!("{}", call() as i64);
+    }
+}
+
+fn pcs_warmup(call: &dyn Fn() -> f64, protocol: &str, fixed: usize) -> usize {
+    match protocol {
+        "cold" => return 0,
+        "warmup" => {
+            for _ in 0..fixed {
+                call();
+            }
+            return fixed;
+        }
+        _ => {}
+    }
+    let mut window: Vec<f64> = Vec::new();
+    for i in 1..=50 {
+        window.push(call());
+        if window.len() > 5 {
+            window.remove(0);
+        }
+        if window.len() == 5 {
+            let mean = window.iter().sum::<f64>() / 5.0;
+            let variance = window.iter().map(|t| (t - mean) * (t - mean)).sum::<f64>() / 5.0;
+            if variance.sqrt() < 0.05 * mean {
+                return i;
+            }
+        }
+    }
+    50
+}
+`
+
+// rustCargoManifest builds code that uses rayon (--parallel).
+const rustCargoManifest = `[package]
+name = "pcs_bench"
+version = "0.0.0"
+edition = "2021"
+
+[dependencies]
+rayon = "1"
+
+[profile.release]
+opt-level = 3
+`
+
+// rustRunner builds with rustc -O, or with cargo --offline when the code
+// needs rayon, which must then be in the local cargo registry.
+type rustRunner struct{}
+
+func (rustRunner) Generate(cache *buildCache, tc benchCase, n int) ([]byte, bool, error) {
+	return generateCached(cache, tc, n)
+}
+
+func (rustRunner) Build(tc benchCase, code []byte, prefix string, n int) (program, error) {
+	src := append(append([]byte(nil), code...), rustDriverSource...)
+	if !bytes.Contains(code, []byte("rayon::")) {
+		path := prefix + ".rs"
+		p := program{Sources: []string{path}}
+		p.Compile = func(binary string) (*exec.Cmd, error) {
+			if _, err := exec.LookPath("rustc"); err != nil {
+				return nil, err
+			}
+			return commandContext("rustc", "-O", "--edition", "2021", "-o", binary, path), nil
+		}
+		return p, os.WriteFile(path, src, 0644)
+	}
+
+	crate := prefix + "_crate"
+	manifest := filepath.Join(crate, "Cargo.toml")
+	main := filepath.Join(crate, "src", "main.rs")
+	if err := os.MkdirAll(filepath.Dir(main), 0755); err != nil {
+		return program{}, err
+	}
+	if err := os.WriteFile(manifest, []byte(rustCargoManifest), 0644); err != nil {
+		return program{}, err
+	}
+	p := program{Sources: []string{manifest, main}}
+	p.Compile = func(binary string) (*exec.Cmd, error) {
+		if _, err := exec.LookPath("cargo"); err != nil {
+			return nil, err
+		}
+		target := filepath.Join(crate, "target")
+		return commandContext("sh", "-c", `cargo build --release --offline --quiet --manifest-path "$1" --target-dir "$2" && cp "$2/release/pcs_bench" "$3"`,
+			"sh", manifest, target, binary), nil
+	}
+	return p, os.WriteFile(main, src, 0644)
+}
+
+func (rustRunner) Run(tc benchCase, p program, binary string, env runEnv, reps int, protocol string, fixed int) (runOutput, error) {
+	return runProgram(binary, env, reps, "", protocol, fixed)
+}
+
+func (rustRunner) Metrics(result BenchmarkResult, run runOutput, est estimator, reps int) BenchmarkResult {
+	return timingMetrics(result, run, est, reps)
+}
+
+// tsDriverSource is appended to the generated TypeScript module.
+const tsDriverSource = `
+declare const process: any;
+
+function pcsWarmup(call: () => number, protocol: string, fixed: number): number {
+    if (protocol === "cold") {
+        return 0;
+    }
+    if (protocol === "warmup") {
+        for (let i = 0; i < fixed; i++) {
+            call();
+        }
+        return fixed;
+    }
+    const window: number[] = [];
+    for (let i = 1; i <= 50; i++) {
+        window.push(call());
+        if (window.length > 5) {
+            window.shift();
+        }
+        if (window.length === 5) {
+            const mean = window.reduce((a, b) => a + b, 0) / 5;
+            const variance = window.reduce((sum, t) => sum + (t - mean) * (t - mean), 0) / 5;
+            if (Math.sqrt(variance) < 0.05 * mean) {
+                return i;
+            }
+        }
+    }
+    return 50;
+}
+
+let pcsSink: unknown;
+
+function pcsMain(): void {
+    const reps = parseInt(process.argv[2], 10);
+    const fixed = parseInt(process.argv[5], 10);
+    const call = (): number => {
+        const start = process.hrtime.bigint();
+        pcsSink = program();
+        return Number(process.hrtime.bigint() - start);
+    };
+    const lines: string[] = ["warmup " + pcsWarmup(call, process.argv[4], fixed)];
+    for (let i = 0; i < reps; i++) {
+        lines.push(String(call()));
+    }
+    process.stdout.write(lines.join("\n") + "\n");
+}
+
+pcsMain();
+`
+
+// tsRunner compiles with tsc to a CommonJS script, which becomes the
+// "binary" behind a node shebang line, so it can be cached and run like a
+// native one.
+type tsRunner struct{}
+
+func (tsRunner) Generate(cache *buildCache, tc benchCase, n int) ([]byte, bool, error) {
+	return generateCached(cache, tc, n)
+}
+
+func (tsRunner) Build(tc benchCase, code []byte, prefix string, n int) (program, error) {
+	path := prefix + ".ts"
+	p := program{Sources: []string{path}}
+	p.Compile = func(binary string) (*exec.Cmd, error) {
+		for _, tool := range []string{"tsc", "node"} {
+			if _, err := exec.LookPath(tool); err != nil {
+				return nil, err
+			}
+		}
+		out := filepath.Dir(path)
+		js := filepath.Join(out, filepath.Base(prefix)+".js")
+		return commandContext("sh", "-c", `tsc --target es2020 --module commonjs --outDir "$1" "$2" && { echo '#!/usr/bin/env node'; cat "$3"; } > "$4" && chmod +x "$4"`,
+			"sh", out, path, js, binary), nil
+	}
+	return p, os.WriteFile(path, append(append([]byte(nil), code...), tsDriverSource...), 0644)
+}
+
+func (tsRunner) Run(tc benchCase, p program, binary string, env runEnv, reps int, protocol string, fixed int) (runOutput, error) {
+	return runProgram(binary, env, reps, "", protocol, fixed)
+}
+
+func (tsRunner) Metrics(result BenchmarkResult, run runOutput, est estimator, reps int) BenchmarkResult {
+	return timingMetrics(result, run, est, reps)
+}
+
+// juliaDriverSource is appended to the generated Julia module; %s names
+// the module.
+const juliaDriverSource = `
+function pcs_warmup(call, protocol, fixed)
+    protocol == "cold" && return 0
+    if protocol == "warmup"
+        for _ in 1:fixed
+            call()
+        end
+        return fixed
+    end
+    window = Float64[]
+    for i in 1:50
+        push!(window, call())
+        length(window) > 5 && popfirst!(window)
+        if length(window) == 5
+            mean = sum(window) / 5
+            variance = sum((t - mean)^2 for t in window) / 5
+            sqrt(variance) < 0.05 * mean && return i
+        end
+    end
+    return 50
+end
+
+let reps = parse(Int, ARGS[1]), fixed = parse(Int, ARGS[4])
+    call() = (start = time_ns(); %s.main(); Float64(time_ns() - start))
+    println("warmup ", pcs_warmup(call, ARGS[3], fixed))
+    for _ in 1:reps
+        println(round(Int, call()))
+    end
+end
+`
+
+// juliaModule matches the module pcs wraps Julia code in.
+var juliaModule = regexp.MustCompile(`(?m)^module (\w+)`)
+
+// juliaRuntime is the runtime pcs's Julia code includes.
+const juliaRuntime = "pcs/backends/julia/pcs_runtime.jl"
+
+// juliaRunner runs the generated module with julia, threads on for
+// @threads loops. The runtime is inlined in place of its include, so the
+// script is self-contained and becomes the "binary" behind a julia shebang
+// line.
+type juliaRunner struct{}
+
+func (juliaRunner) Generate(cache *buildCache, tc benchCase, n int) ([]byte, bool, error) {
+	return generateCached(cache, tc, n)
+}
+
+func (juliaRunner) Build(tc benchCase, code []byte, prefix string, n int) (program, error) {
+	m := juliaModule.FindSubmatch(code)
+	if m == nil {
+		return program{}, fmt.Errorf("no module in the generated Julia code")
+	}
+	runtime, err := os.ReadFile(juliaRuntime)
+	if err != nil {
+		return program{}, err
+	}
+	src := bytes.Replace(code, []byte(`include("pcs_runtime.jl")`), runtime, 1)
+	src = append(src, fmt.Sprintf(juliaDriverSource, m[1])...)
+	path := prefix + ".jl"
+	p := program{Sources: []string{path}}
+	p.Compile = func(binary string) (*exec.Cmd, error) {
+		if _, err := exec.LookPath("julia"); err != nil {
+			return nil, err
+		}
+		return commandContext("sh", "-c", `{ echo '#!/usr/bin/env -S julia --threads=auto'; cat "$1"; } > "$2" && chmod +x "$2"`,
+			"sh", path, binary), nil
+	}
+	return p, os.WriteFile(path, src, 0644)
+}
+
+func (juliaRunner) Run(tc benchCase, p program, binary string, env runEnv, reps int, protocol string, fixed int) (runOutput, error) {
+	return runProgram(binary, env, reps, "", protocol, fixed)
+}
+
+func (juliaRunner) Metrics(result BenchmarkResult, run runOutput, est estimator, reps int) BenchmarkResult {
+	return timingMetrics(result, run, est, reps)
+}
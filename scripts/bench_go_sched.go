@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// -sched samples the Go scheduler while a parallel case's timed calls run,
+// to tell whether the sharded emitter spreads work over goroutines and
+// threads or serializes on a lock. The sampler is compiled into those
+// builds only (schedSource), as it needs runtime/metrics, and reports one
+// "sched key=value ..." line after the timings; -sched-trace also records
+// a runtime/trace of the timed calls and summarizes it with go tool trace.
+
+// schedSample and schedTrace are -sched and -sched-trace.
+var schedSample, schedTrace bool
+
+// schedCase reports whether tc is built with the sampler: parallel gc
+// builds for this machine timed by the default driver.
+func schedCase(tc benchCase) bool {
+	return schedSample && tc.Parallel && tc.backend() == "go" && tc.toolchain() == "gc" &&
+		tc.Target == "" && tc.Stream == "" && tc.Measure == ""
+}
+
+// schedStats is what the sampler saw over the timed calls of one run.
+// Goroutine and thread counts are polled every millisecond, plus once
+// before and after, so Samples tells how many polls the maxima and mean
+// rest on; the counters are totals over the calls, divided per call.
+// Scheduling latency is the time goroutines spent runnable before they
+// ran, and mutex wait the time they spent blocked on sync.Mutex,
+// sync.RWMutex or runtime-internal locks. Metrics the case's Go release
+// lacks are left out. TraceSyncNs and TraceSchedNs are the totals of go
+// tool trace's synchronization-blocking and scheduler-latency profiles of
+// Trace (-sched-trace).
+type schedStats struct {
+	Samples           int     `json:"samples"`
+	GoroutinesMax     int     `json:"goroutines_max"`
+	GoroutinesMean    float64 `json:"goroutines_mean"`
+	RunningMax        int     `json:"running_max,omitempty"`
+	ThreadsMax        int     `json:"threads_max,omitempty"`
+	GoroutinesPerCall float64 `json:"goroutines_per_call,omitempty"`
+	LatencyP50Ns      int64   `json:"sched_latency_p50_ns,omitempty"`
+	LatencyP99Ns      int64   `json:"sched_latency_p99_ns,omitempty"`
+	MutexWaitNs       int64   `json:"mutex_wait_ns"`
+	Trace             string  `json:"trace,omitempty"`
+	TraceSyncNs       int64   `json:"trace_sync_ns,omitempty"`
+	TraceSchedNs      int64   `json:"trace_sched_ns,omitempty"`
+}
+
+// parseSched parses the fields of a driver's sched line.
+func parseSched(fields string) (*schedStats, error) {
+	s := &schedStats{}
+	for _, field := range strings.Fields(fields) {
+		key, value, _ := strings.Cut(field, "=")
+		var err error
+		switch key {
+		case "samples":
+			s.Samples, err = strconv.Atoi(value)
+		case "goroutines_max":
+			s.GoroutinesMax, err = strconv.Atoi(value)
+		case "goroutines_mean":
+			s.GoroutinesMean, err = strconv.ParseFloat(value, 64)
+		case "running_max":
+			s.RunningMax, err = strconv.Atoi(value)
+		case "threads_max":
+			s.ThreadsMax, err = strconv.Atoi(value)
+		case "goroutines_per_call":
+			s.GoroutinesPerCall, err = strconv.ParseFloat(value, 64)
+		case "latency_p50_ns":
+			s.LatencyP50Ns, err = strconv.ParseInt(value, 10, 64)
+		case "latency_p99_ns":
+			s.LatencyP99Ns, err = strconv.ParseInt(value, 10, 64)
+		case "mutex_wait_ns":
+			s.MutexWaitNs, err = strconv.ParseInt(value, 10, 64)
+		default:
+			err = fmt.Errorf("unknown field")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sched %s: %v", field, err)
+		}
+	}
+	return s, nil
+}
+
+// writeSchedSource writes the sampler next to prefix's other sources and
+// returns its path.
+func writeSchedSource(prefix string) (string, error) {
+	path := prefix + "_sched.go"
+	return path, os.WriteFile(path, []byte(schedSource), 0644)
+}
+
+// schedTracePath is where the run at GOMAXPROCS procs (0 when inherited)
+// writes its trace.
+func schedTracePath(dir string, procs int) string {
+	if procs == 0 {
+		return filepath.Join(dir, "trace.out")
+	}
+	return filepath.Join(dir, fmt.Sprintf("trace_gomaxprocs%d.out", procs))
+}
+
+// traceProfileTotal matches the total of a delay profile in go tool pprof
+// -top output.
+var traceProfileTotal = regexp.MustCompile(`of (\d+)ns total`)
+
+// summarizeTrace fills TraceSyncNs and TraceSchedNs from s.Trace.
+func summarizeTrace(s *schedStats) error {
+	for _, p := range []struct {
+		kind  string
+		total *int64
+	}{{"sync", &s.TraceSyncNs}, {"sched", &s.TraceSchedNs}} {
+		profile := strings.TrimSuffix(s.Trace, ".out") + "_" + p.kind + ".pprof"
+		out, err := commandContext("go", "tool", "trace", "-pprof="+p.kind, s.Trace).Output()
+		if err != nil {
+			return fmt.Errorf("go tool trace -pprof=%s: %v", p.kind, err)
+		}
+		if err := os.WriteFile(profile, out, 0644); err != nil {
+			return err
+		}
+		if len(out) == 0 {
+			continue // nothing blocked
+		}
+		top, err := commandContext("go", "tool", "pprof", "-top", "-unit=ns", profile).Output()
+		if err != nil {
+			return fmt.Errorf("go tool pprof %s: %v", profile, err)
+		}
+		if m := traceProfileTotal.FindSubmatch(top); m != nil {
+			*p.total, _ = strconv.ParseInt(string(m[1]), 10, 64)
+		}
+	}
+	return nil
+}
+
+// schedSource replaces the driver's startSched with the sampler. With
+// $PCS_BENCH_TRACE set it also traces the timed calls into that file.
+const schedSource = `package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"runtime/trace"
+	"strings"
+	"time"
+)
+
+func init() {
+	startSched = sampleSched
+}
+
+// sampleSched starts sampling the scheduler and returns the function that
+// stops it and prints the sched line.
+func sampleSched(reps int) func() {
+	traceFile := startTrace()
+
+	counters := []metrics.Sample{
+		{Name: "/sched/goroutines-created:goroutines"},
+		{Name: "/sched/latencies:seconds"},
+		{Name: "/sync/mutex/wait/total:seconds"},
+	}
+	metrics.Read(counters)
+	before := snapshotSamples(counters)
+
+	var polls, goroutinesMax, goroutinesSum, runningMax, threadsMax int
+	gauges := []metrics.Sample{
+		{Name: "/sched/goroutines/running:goroutines"},
+		{Name: "/sched/threads/total:threads"},
+	}
+	poll := func() {
+		g := runtime.NumGoroutine() - 1 // not the sampler
+		polls++
+		goroutinesSum += g
+		goroutinesMax = max(goroutinesMax, g)
+		metrics.Read(gauges)
+		if gauges[0].Value.Kind() == metrics.KindUint64 {
+			runningMax = max(runningMax, int(gauges[0].Value.Uint64()))
+		}
+		if gauges[1].Value.Kind() == metrics.KindUint64 {
+			threadsMax = max(threadsMax, int(gauges[1].Value.Uint64()))
+		}
+	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			poll()
+			select {
+			case <-stop:
+				poll()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+		if traceFile != nil {
+			trace.Stop()
+			traceFile.Close()
+		}
+		metrics.Read(counters)
+		after := snapshotSamples(counters)
+
+		fields := []string{
+			fmt.Sprintf("samples=%d", polls),
+			fmt.Sprintf("goroutines_max=%d", goroutinesMax),
+			fmt.Sprintf("goroutines_mean=%.2f", float64(goroutinesSum)/float64(polls)),
+		}
+		if gauges[0].Value.Kind() == metrics.KindUint64 {
+			fields = append(fields, fmt.Sprintf("running_max=%d", runningMax))
+		}
+		if gauges[1].Value.Kind() == metrics.KindUint64 {
+			fields = append(fields, fmt.Sprintf("threads_max=%d", threadsMax))
+		}
+		if created, ok := after[0].(uint64); ok {
+			fields = append(fields, fmt.Sprintf("goroutines_per_call=%.2f", float64(created-before[0].(uint64))/float64(reps)))
+		}
+		if h, ok := after[1].(*metrics.Float64Histogram); ok {
+			counts := make([]uint64, len(h.Counts))
+			for i := range counts {
+				counts[i] = h.Counts[i] - before[1].(*metrics.Float64Histogram).Counts[i]
+			}
+			fields = append(fields,
+				fmt.Sprintf("latency_p50_ns=%d", histogramQuantile(counts, h.Buckets, 0.5)),
+				fmt.Sprintf("latency_p99_ns=%d", histogramQuantile(counts, h.Buckets, 0.99)))
+		}
+		if wait, ok := after[2].(float64); ok {
+			fields = append(fields, fmt.Sprintf("mutex_wait_ns=%d", int64((wait-before[2].(float64))*1e9/float64(reps))))
+		}
+		fmt.Println("sched", strings.Join(fields, " "))
+	}
+}
+
+// startTrace starts a runtime trace into $PCS_BENCH_TRACE, if set.
+func startTrace() *os.File {
+	path := os.Getenv("PCS_BENCH_TRACE")
+	if path == "" {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err == nil {
+		err = trace.Start(f)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "trace:", err)
+		os.Exit(2)
+	}
+	return f
+}
+
+// snapshotSamples copies the values of samples, as metrics.Read may reuse
+// a histogram's memory; nil stands for a metric this release lacks.
+func snapshotSamples(samples []metrics.Sample) []any {
+	values := make([]any, len(samples))
+	for i, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			values[i] = s.Value.Uint64()
+		case metrics.KindFloat64:
+			values[i] = s.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			values[i] = &metrics.Float64Histogram{
+				Counts:  append([]uint64(nil), h.Counts...),
+				Buckets: h.Buckets,
+			}
+		}
+	}
+	return values
+}
+
+// histogramQuantile is the q-quantile of a histogram of seconds in
+// nanoseconds, taking each bucket at its upper bound.
+func histogramQuantile(counts []uint64, buckets []float64, q float64) int64 {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, c := range counts {
+		seen += c
+		if seen >= rank {
+			bound := buckets[i+1]
+			if math.IsInf(bound, 1) {
+				bound = buckets[i]
+			}
+			return int64(bound * 1e9)
+		}
+	}
+	return 0
+}
+`
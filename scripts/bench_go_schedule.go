@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Entries of the bench matrix may constrain the order they run in. After
+// lists cases (by "<test>_<mode>") that must run first, e.g. a sequential
+// baseline before its parallel variants. Needs does the same and also makes
+// the named cases prerequisites: when one of them fails or is skipped, the
+// entry is skipped with skipDependency, for cases that reuse what another
+// case sets up. The harness runs cases one at a time, so honoring the
+// constraints is a matter of ordering the matrix.
+
+// skipDependency is the SkipReason for cases whose prerequisite (Needs)
+// did not produce results.
+const skipDependency = "dependency_failed"
+
+func (tc benchCase) name() string {
+	name := tc.Test + "_" + tc.Mode
+	if tc.Target != "" {
+		name += "_" + strings.ReplaceAll(tc.Target, "/", "_")
+	}
+	if tc.Go.Version != "" {
+		name += "_" + tc.Go.Version
+	}
+	if tc.Backend != "" {
+		name += "_" + tc.Backend
+	}
+	return name
+}
+
+// orderCases sorts cases so every case runs after those in its After and
+// Needs lists, otherwise keeping the matrix order. Unknown names and cycles
+// are errors.
+func orderCases(cases []benchCase) ([]benchCase, error) {
+	index := map[string]int{}
+	for i, tc := range cases {
+		if _, dup := index[tc.name()]; dup {
+			return nil, fmt.Errorf("duplicate bench case %s", tc.name())
+		}
+		index[tc.name()] = i
+	}
+	pending := make([]int, len(cases)) // unmet dependencies per case
+	dependents := make([][]int, len(cases))
+	for i, tc := range cases {
+		for _, dep := range append(append([]string(nil), tc.After...), tc.Needs...) {
+			j, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("bench case %s depends on unknown case %s", tc.name(), dep)
+			}
+			pending[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	ordered := make([]benchCase, 0, len(cases))
+	done := make([]bool, len(cases))
+	for len(ordered) < len(cases) {
+		// The first case in matrix order whose dependencies have all run
+		next := -1
+		for i := range cases {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var cycle []string
+			for i, tc := range cases {
+				if !done[i] {
+					cycle = append(cycle, tc.name())
+				}
+			}
+			return nil, fmt.Errorf("bench case dependencies form a cycle among %s", strings.Join(cycle, ", "))
+		}
+		done[next] = true
+		ordered = append(ordered, cases[next])
+		for _, d := range dependents[next] {
+			pending[d]--
+		}
+	}
+	return ordered, nil
+}
+
+// unmetNeeds lists the prerequisites of tc that failed or were skipped.
+func (tc benchCase) unmetNeeds(unmeasured map[string]bool) []string {
+	var unmet []string
+	for _, dep := range tc.Needs {
+		if unmeasured[dep] {
+			unmet = append(unmet, dep)
+		}
+	}
+	return unmet
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serveRequest is the body of POST /generate and POST /bench. Code is a
+// Python comprehension, with {N} replaced by N when set.
+type serveRequest struct {
+	Code     string   `json:"code"`
+	Target   string   `json:"target"`
+	Parallel bool     `json:"parallel"`
+	Flags    []string `json:"flags"`
+	N        int      `json:"n"`
+	Reps     int      `json:"reps"`
+}
+
+// serveFlags are the pcs options a request may pass, as --name or
+// --name=value. Options reading files or running SQL are left out.
+var serveFlags = map[string]bool{
+	"--mode": true, "--threads": true, "--unsafe": true, "--no-explain": true,
+	"--sql-dialect": true, "--int-type": true, "--strict-types": true, "--no-presize": true,
+	"--go-map-impl": true, "--go-shard-merge": true, "--fuse": true,
+}
+
+// server answers the HTTP API of `serve`. Benchmarks run one at a time
+// (see slots), so concurrent requests do not skew each other's timings.
+type server struct {
+	cache   *buildCache
+	dir     string
+	maxN    int
+	maxReps int
+	timeout time.Duration
+	maxRSS  int64
+	slots   chan struct{}
+	commit  string
+	git     *gitInfo
+	goVer   string
+	harness *harnessBuild
+}
+
+// runServe implements `serve`: an HTTP API over the harness, so the web
+// playground and bots generate and time snippets with the same pipeline as
+// benchmark runs.
+//
+//	POST /generate  {"code", "target", "parallel", "flags"} -> {"target", "code"}
+//	POST /bench     {"code", "parallel", "flags", "n", "reps"} -> BenchmarkResult
+//	GET  /healthz
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", getEnv("PCS_SERVE_ADDR", "127.0.0.1:8080"), "address to listen on")
+	maxN := fs.Int("max-n", 10000000, "largest n a benchmark request may ask for")
+	maxReps := fs.Int("max-reps", 50, "most timed calls a benchmark request may ask for")
+	timeout := fs.Duration("timeout", 30*time.Second, "limit on each generate, compile and benchmark process")
+	maxRSSFlag := fs.String("max-rss", os.Getenv("PCS_BENCH_MAX_RSS"), "kill a benchmark process whose RSS exceeds this, e.g. 1GiB")
+	concurrency := fs.Int("concurrency", 1, "benchmarks run at once")
+	cacheDir := fs.String("cache", "target/go_bench_cache", "directory caching generated code and binaries by content hash")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench serve [-addr host:port] [flags]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "serve: -concurrency must be at least 1")
+		return 2
+	}
+
+	s := &server{maxN: *maxN, maxReps: *maxReps, timeout: *timeout, slots: make(chan struct{}, *concurrency)}
+	var err error
+	if *maxRSSFlag != "" {
+		if s.maxRSS, err = parseByteSize(*maxRSSFlag); err == nil {
+			err = checkRSSWatch()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "serve: -max-rss: %v\n", err)
+			return 2
+		}
+	}
+	if s.cache, err = openBuildCache(*cacheDir, "pcs"); err != nil {
+		fmt.Fprintf(os.Stderr, "serve: -cache: %v\n", err)
+		return 2
+	}
+	defer s.cache.close()
+	if s.dir, err = os.MkdirTemp("", "pcs-serve-"); err != nil {
+		fmt.Fprintf(os.Stderr, "serve: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(s.dir)
+	s.commit, s.git = detectGit()
+	s.harness = readHarnessBuild()
+	if g, err := resolveGo("go"); err == nil {
+		s.goVer = g.Version
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/generate", s.handleGenerate)
+	mux.HandleFunc("/bench", s.handleBench)
+	fmt.Fprintf(os.Stderr, "serve: listening on %s\n", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		fmt.Fprintf(os.Stderr, "serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// decode reads a serveRequest, writing a 4xx response and returning false
+// when it is not usable.
+func (s *server) decode(w http.ResponseWriter, r *http.Request) (serveRequest, bool) {
+	var req serveRequest
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		serveError(w, http.StatusMethodNotAllowed, "use POST")
+		return req, false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		serveError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return req, false
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		serveError(w, http.StatusBadRequest, "code is required")
+		return req, false
+	}
+	for _, f := range req.Flags {
+		name, _, _ := strings.Cut(f, "=")
+		if !serveFlags[name] {
+			serveError(w, http.StatusBadRequest, fmt.Sprintf("flag %q is not allowed", f))
+			return req, false
+		}
+	}
+	if req.Target == "" {
+		req.Target = "go"
+	}
+	return req, true
+}
+
+func (s *server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.decode(w, r)
+	if !ok {
+		return
+	}
+	args := []string{"--target", req.Target, "--code", strings.ReplaceAll(req.Code, "{N}", strconv.Itoa(max(req.N, 0)))}
+	if req.Parallel {
+		args = append(args, "--parallel")
+	}
+	out, err := runPCS("", s.timeout, append(args, req.Flags...)...)
+	if err != nil {
+		serveError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	serveJSON(w, http.StatusOK, map[string]string{"target": req.Target, "code": string(out)})
+}
+
+// handleBench generates, builds and times the snippet like one case of a
+// run, and answers with its result. A failed step still answers with the
+// result, its error and error_class set, as status 422.
+func (s *server) handleBench(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.decode(w, r)
+	if !ok {
+		return
+	}
+	be, err := lookupBackend(req.Target)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.N == 0 {
+		req.N = 100000
+	}
+	if req.Reps == 0 {
+		req.Reps = 10
+	}
+	if req.N < 1 || req.N > s.maxN || req.Reps < 1 || req.Reps > s.maxReps {
+		serveError(w, http.StatusBadRequest, fmt.Sprintf("n must be 1..%d and reps 1..%d", s.maxN, s.maxReps))
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-r.Context().Done():
+		return
+	}
+	result := s.bench(be, req)
+	status := http.StatusOK
+	if result.Error != "" {
+		status = http.StatusUnprocessableEntity
+	}
+	serveJSON(w, status, result)
+}
+
+func (s *server) bench(be backend, req serveRequest) BenchmarkResult {
+	tc := benchCase{Test: "snippet", Mode: "loops", Parallel: req.Parallel, Code: req.Code, Flags: req.Flags}
+	if req.Parallel {
+		tc.Mode = "parallel"
+	}
+	result := BenchmarkResult{
+		SchemaVersion:  runSchemaVersion,
+		Commit:         s.commit,
+		Git:            s.git,
+		Timestamp:      time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		OS:             runtime.GOOS,
+		CPU:            cpuName(),
+		Backend:        req.Target,
+		Test:           tc.Test,
+		Mode:           tc.Mode,
+		Parallel:       tc.Parallel,
+		N:              req.N,
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		Protocol:       "steady",
+		Estimator:      classicEstimator{}.name(),
+		Toolchain:      tc.toolchain(),
+		GoVersion:      s.goVer,
+		HarnessVersion: s.harness.Version,
+		Harness:        s.harness,
+	}
+	env := runEnv{Timeout: s.timeout, MaxRSS: s.maxRSS}
+	return benchSnippet(be, tc, result, s.dir, s.cache, env, req.Reps)
+}
+
+// benchSnippet generates, builds and times tc at result.N in a temporary
+// directory under parent, reusing cache's code and binaries, and returns
+// result with its timings or its failure filled in. It is the quick path
+// of serve and watch, one process and no verification, where a run
+// prepares cases for many checks.
+func benchSnippet(be backend, tc benchCase, result BenchmarkResult, parent string, cache *buildCache, env runEnv, reps int) BenchmarkResult {
+	fail := func(class, step string, err error) BenchmarkResult {
+		result.Error = step + ": " + err.Error()
+		result.ErrorClass, result.ErrorDetail = class, describeError(err)
+		return result
+	}
+
+	dir, err := os.MkdirTemp(parent, "bench-")
+	if err != nil {
+		return fail(errSetup, "setup", err)
+	}
+	defer os.RemoveAll(dir)
+	start := time.Now()
+	code, cached, err := be.Runner.Generate(cache, tc, result.N)
+	if err != nil {
+		return fail(errCodegen, "generate", err)
+	}
+	if !cached {
+		result.CodegenMs = float64(time.Since(start).Microseconds()) / 1000
+	}
+	if tc.Runtime == nil {
+		tc.Runtime = vendoredRuntime(code)
+	}
+	prog, err := be.Runner.Build(tc, code, filepath.Join(dir, result.Backend+"_bench"), result.N)
+	if err == nil {
+		result.ModuleHash, err = hashFiles(prog.Sources...)
+	}
+	if err != nil {
+		return fail(errCodegen, "write", err)
+	}
+
+	binary := filepath.Join(dir, "bench")
+	key := cache.binaryKey(result)
+	if result.CompileMs, result.BuildCached = cache.loadBinary(key, binary); !result.BuildCached {
+		cmd, err := prog.Compile(binary)
+		if err != nil {
+			return fail(errCompile, "compile", err)
+		}
+		start := time.Now()
+		_, err = runWithin(cmd, env.Timeout, 0)
+		result.CompileMs = float64(time.Since(start).Microseconds()) / 1000
+		if err != nil {
+			return fail(errCompile, "compile", err)
+		}
+		cache.storeBinary(key, binary, result.CompileMs)
+	}
+	if info, err := os.Stat(binary); err == nil {
+		result.BinaryBytes = info.Size()
+	}
+
+	run, err := be.Runner.Run(tc, prog, binary, env, reps, result.Protocol, 3)
+	if err != nil {
+		return fail(runErrorClass(err), "run", err)
+	}
+	return be.Runner.Metrics(result, run, classicEstimator{}, reps)
+}
+
+func serveJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func serveError(w http.ResponseWriter, status int, msg string) {
+	serveJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// runCtx is canceled when a harness run is interrupted by SIGINT or SIGTERM:
+// no new cases start, running children are terminated and the results
+// completed so far are still flushed to every sink. A second signal kills
+// the harness immediately.
+var runCtx = context.Background()
+
+// exitInterrupted is the exit status of an interrupted run (128 + SIGINT).
+const exitInterrupted = 130
+
+// childGrace is how long a terminated child may take to exit before it is
+// killed.
+const childGrace = 5 * time.Second
+
+func handleInterrupts() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	runCtx = ctx
+	go func() {
+		<-ctx.Done()
+		stop() // restore the default handler for a second signal
+		fmt.Fprintln(os.Stderr, "interrupted: stopping and writing completed results (interrupt again to quit now)")
+	}()
+}
+
+func interrupted() bool {
+	return runCtx.Err() != nil
+}
+
+// commandContext is exec.Command tied to runCtx: on interrupt the process is
+// asked to terminate, and killed if it is still running after childGrace.
+func commandContext(name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(runCtx, name, args...)
+	cmd.Cancel = func() error {
+		if runtime.GOOS == "windows" {
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = childGrace
+	return cmd
+}
+
+// sleep waits for d or until the run is interrupted.
+func sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-runCtx.Done():
+	}
+}
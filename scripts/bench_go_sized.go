@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+)
+
+// A case measured at several sizes is built once when N only reaches the
+// generated code as a literal: pcs renders it with a sentinel in place of
+// N, the sentinel becomes the driver's sizeParam, and each size is passed
+// to the same binary in PCS_BENCH_SIZE. The case is rendered with two
+// sentinels and used this way only if both agree once substituted, so code
+// where N was folded into other constants is still built per size.
+var sizeSentinels = [2]int{1987654321, 1876543219}
+
+// sizeParam is the driver's variable holding the input size.
+const sizeParam = "benchN"
+
+// constDecl matches Go const declarations, which cannot take a variable.
+var constDecl = regexp.MustCompile(`(?m)^\s*const\b.*` + sizeParam)
+
+// sizedCode renders tc once for all of sizes, nil when it cannot be.
+// Renderings come from and go to cache, keyed like per-size ones.
+func sizedCode(cache *buildCache, tc benchCase, sizes []int) []byte {
+	if tc.Stream != "" || len(sizes) < 2 {
+		return nil
+	}
+	for _, n := range sizes {
+		if n >= sizeSentinels[1] {
+			return nil
+		}
+	}
+	var codes [2][]byte
+	for i, sentinel := range sizeSentinels {
+		key := cache.codeKey(generatorArgs(tc, sentinel))
+		output, cached := cache.loadCode(key)
+		if !cached {
+			var err error
+			if output, err = generateCase("", tc, sentinel); err != nil {
+				return nil
+			}
+			cache.storeCode(key, output)
+		}
+		literal := regexp.MustCompile(`\b` + strconv.Itoa(sentinel) + `\b[^.]`)
+		if !literal.Match(output) {
+			return nil
+		}
+		codes[i] = literal.ReplaceAllFunc(output, func(m []byte) []byte {
+			return append([]byte(sizeParam), m[len(m)-1])
+		})
+	}
+	if !bytes.Equal(codes[0], codes[1]) || constDecl.Match(codes[0]) ||
+		bytes.Contains(codes[0], []byte("["+sizeParam+"]")) {
+		return nil
+	}
+	return codes[0]
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+)
+
+// speedupRecordKind marks derived speedup records among result records.
+const speedupRecordKind = "speedup"
+
+// speedupBaseline is the mode a parallel case's speedup is taken against.
+const speedupBaseline = "loops"
+
+// speedupRecord compares a parallel result with the sequential loops result
+// of the same test, size and build. Speedup is the loops mean over the
+// parallel mean; SpeedupErr is its standard error, propagated from the
+// standard errors of both means.
+type speedupRecord struct {
+	Record         string    `json:"record"`
+	RunID          string    `json:"run_id,omitempty"`
+	Backend        string    `json:"backend"`
+	Test           string    `json:"test"`
+	Mode           string    `json:"mode"`
+	BaselineMode   string    `json:"baseline_mode"`
+	N              int       `json:"n"`
+	Target         string    `json:"target,omitempty"`
+	Toolchain      string    `json:"toolchain,omitempty"`
+	GoVersion      string    `json:"go_version,omitempty"`
+	GOMAXPROCS     int       `json:"gomaxprocs,omitempty"`
+	BaselineMeanNs int64     `json:"baseline_mean_ns"`
+	MeanNs         int64     `json:"mean_ns"`
+	Speedup        float64   `json:"speedup"`
+	SpeedupErr     float64   `json:"speedup_err"`
+	Labels         runLabels `json:"labels,omitempty"`
+}
+
+// speedupKey identifies the results a parallel result is compared with:
+// only the mode may differ.
+type speedupKey struct {
+	backend, test, target, toolchain, goVersion string
+	n                                           int
+}
+
+func speedupKeyOf(r BenchmarkResult) speedupKey {
+	return speedupKey{r.Backend, r.Test, r.Target, r.Toolchain, r.GoVersion, r.N}
+}
+
+// speedupTracker pairs parallel results with the loops results of the same
+// key as they are emitted. orderCases runs the loops case first wherever a
+// parallel case names it in After, so one pass is enough.
+type speedupTracker struct {
+	baselines map[speedupKey]BenchmarkResult
+}
+
+// add records r and returns its speedup record when r is a measured
+// parallel result whose baseline was measured earlier in the run.
+func (t *speedupTracker) add(r BenchmarkResult) (speedupRecord, bool) {
+	if !r.measured() || r.MeanNs <= 0 || r.PGO {
+		return speedupRecord{}, false
+	}
+	if !r.Parallel {
+		if r.Mode == speedupBaseline {
+			if t.baselines == nil {
+				t.baselines = map[speedupKey]BenchmarkResult{}
+			}
+			t.baselines[speedupKeyOf(r)] = r
+		}
+		return speedupRecord{}, false
+	}
+	base, ok := t.baselines[speedupKeyOf(r)]
+	if !ok {
+		return speedupRecord{}, false
+	}
+	speedup := float64(base.MeanNs) / float64(r.MeanNs)
+	rel := math.Hypot(relStderr(base), relStderr(r))
+	return speedupRecord{
+		Record:         speedupRecordKind,
+		RunID:          r.RunID,
+		Backend:        r.Backend,
+		Test:           r.Test,
+		Mode:           r.Mode,
+		BaselineMode:   base.Mode,
+		N:              r.N,
+		Target:         r.Target,
+		Toolchain:      r.Toolchain,
+		GoVersion:      r.GoVersion,
+		GOMAXPROCS:     r.GOMAXPROCS,
+		BaselineMeanNs: base.MeanNs,
+		MeanNs:         r.MeanNs,
+		Speedup:        speedup,
+		SpeedupErr:     speedup * rel,
+		Labels:         r.Labels,
+	}, true
+}
+
+// relStderr is the standard error of r's mean relative to the mean. A
+// record without samples counts as one.
+func relStderr(r BenchmarkResult) float64 {
+	n := max(len(r.Samples), 1)
+	return float64(r.StdNs) / float64(r.MeanNs) / math.Sqrt(float64(n))
+}
+
+func (s speedupRecord) String() string {
+	name := benchCase{Test: s.Test, Mode: s.Mode, Target: s.Target}.name()
+	procs := ""
+	if s.GOMAXPROCS > 0 {
+		procs = fmt.Sprintf(" GOMAXPROCS=%d", s.GOMAXPROCS)
+	}
+	return fmt.Sprintf("%s n=%d%s: %.2fx ± %.2f over %s", name, s.N, procs, s.Speedup, s.SpeedupErr, s.BaselineMode)
+}
+
+// belowFloor returns the records whose speedup is under floor. Under
+// -procs-sweep only the highest level, maxProcs, is held to it: fewer
+// workers are not expected to reach it.
+func belowFloor(records []speedupRecord, floor float64, sweep bool, maxProcs int) []speedupRecord {
+	var slow []speedupRecord
+	for _, s := range records {
+		if sweep && s.GOMAXPROCS < maxProcs {
+			continue
+		}
+		if s.Speedup < floor {
+			slow = append(slow, s)
+		}
+	}
+	return slow
+}
+
+// reportSpeedupFloor prints the records under -min-speedup and reports
+// whether there were any.
+func reportSpeedupFloor(records []speedupRecord, floor float64, sweep bool, maxProcs int) bool {
+	slow := belowFloor(records, floor, sweep, maxProcs)
+	for _, s := range slow {
+		fmt.Fprintf(os.Stderr, "speedup: %s, below -min-speedup %g\n", s, floor)
+	}
+	return len(slow) > 0
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// An estimator reduces a case's per-call timings to the central value and
+// spread reported as mean_ns and std_ns. Median and P99 do not depend on it.
+// The estimator is chosen per run (-estimator) or per case
+// (benchCase.Estimator) and recorded in each result, since numbers from
+// different estimators are not comparable.
+type estimator interface {
+	// name is the estimator as recorded in results and accepted by
+	// parseEstimator.
+	name() string
+	// estimate is given the timings sorted ascending and never empty.
+	estimate(sorted []int64) (center, spread float64)
+}
+
+// classicEstimator is the arithmetic mean and population standard
+// deviation.
+type classicEstimator struct{}
+
+func (classicEstimator) name() string { return "classic" }
+
+func (classicEstimator) estimate(sorted []int64) (float64, float64) {
+	return meanStd(sorted)
+}
+
+// robustEstimator is the median and the median absolute deviation, scaled
+// by 1.4826 to match the standard deviation on normal data. Neither moves
+// much with a few outliers from scheduler noise.
+type robustEstimator struct{}
+
+func (robustEstimator) name() string { return "robust" }
+
+func (robustEstimator) estimate(sorted []int64) (float64, float64) {
+	times := make([]float64, len(sorted))
+	for i, t := range sorted {
+		times[i] = float64(t)
+	}
+	median := medianFloat(times)
+	for i, t := range times {
+		times[i] = math.Abs(t - median)
+	}
+	return median, 1.4826 * medianFloat(times)
+}
+
+// trimmedEstimator is the mean and standard deviation of the timings left
+// after dropping the fraction Trim from each end.
+type trimmedEstimator struct {
+	Trim float64
+}
+
+func (e trimmedEstimator) name() string {
+	return "trimmed:" + strconv.FormatFloat(e.Trim, 'g', -1, 64)
+}
+
+func (e trimmedEstimator) estimate(sorted []int64) (float64, float64) {
+	k := int(e.Trim * float64(len(sorted)))
+	if 2*k >= len(sorted) {
+		k = (len(sorted) - 1) / 2
+	}
+	return meanStd(sorted[k : len(sorted)-k])
+}
+
+// parseEstimator accepts classic, robust, trimmed (10% from each end) or
+// trimmed:<fraction> with a fraction below 0.5.
+func parseEstimator(s string) (estimator, error) {
+	switch s {
+	case "classic", "":
+		return classicEstimator{}, nil
+	case "robust":
+		return robustEstimator{}, nil
+	case "trimmed":
+		return trimmedEstimator{Trim: 0.1}, nil
+	}
+	if frac, ok := strings.CutPrefix(s, "trimmed:"); ok {
+		if t, err := strconv.ParseFloat(frac, 64); err == nil && t >= 0 && t < 0.5 {
+			return trimmedEstimator{Trim: t}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown estimator %q (want classic, robust, trimmed or trimmed:<fraction below 0.5>)", s)
+}
+
+func meanStd(times []int64) (float64, float64) {
+	var sum float64
+	for _, t := range times {
+		sum += float64(t)
+	}
+	mean := sum / float64(len(times))
+	var variance float64
+	for _, t := range times {
+		diff := float64(t) - mean
+		variance += diff * diff
+	}
+	return mean, math.Sqrt(variance / float64(len(times)))
+}
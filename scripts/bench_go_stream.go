@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Stream cases (benchCase.Stream) benchmark a generated stdin-to-stdout
+// filter program (pcs --go-stream) end to end: each timed call is one run of
+// the binary over an input file of the values 1..N-1, process start-up and
+// I/O included.
+
+// writeStreamProgram writes the complete generated program, which needs no
+// driver, and the input file in the given stream format. It returns the
+// sources to build and the input path.
+func writeStreamProgram(prefix string, program []byte, format string, n int) ([]string, string, error) {
+	src := prefix + ".go"
+	if err := writeGo(src, program); err != nil {
+		return nil, "", err
+	}
+	input := prefix + "_input." + format
+	if err := writeStreamInput(input, format, n); err != nil {
+		return nil, "", err
+	}
+	return []string{src}, input, nil
+}
+
+// writeStreamInput writes 1..n-1 one per line, or as binary frames of a
+// little-endian uint32 count and that many little-endian int64 values.
+func writeStreamInput(path, format string, n int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(f, 1<<16)
+	const frame = 4096
+	var b [8]byte
+	var line []byte
+	for v := 1; v < n; v++ {
+		if format == "binary" {
+			if (v-1)%frame == 0 {
+				binary.LittleEndian.PutUint32(b[:4], uint32(min(frame, n-v)))
+				w.Write(b[:4])
+			}
+			binary.LittleEndian.PutUint64(b[:], uint64(v))
+			w.Write(b[:])
+			continue
+		}
+		line = strconv.AppendInt(line[:0], int64(v), 10)
+		line = append(line, '\n')
+		w.Write(line)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runStream times reps runs of binary with input on stdin and stdout
+// discarded, after the protocol's untimed runs. CPU covers every run.
+func runStream(binary string, env runEnv, reps int, input, protocol string, fixed int) (runOutput, error) {
+	var out runOutput
+	call := func() (int64, error) {
+		in, err := os.Open(input)
+		if err != nil {
+			return 0, err
+		}
+		defer in.Close()
+		cmd := env.command(binary)
+		cmd.Stdin = in
+		cmd.Stdout = io.Discard
+		start := time.Now()
+		if _, err := runWithin(cmd, env.Timeout, env.MaxRSS); err != nil {
+			return 0, err
+		}
+		elapsed := time.Since(start).Nanoseconds()
+		out.CPU += cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+		return elapsed, nil
+	}
+
+	// The same protocols as the in-process driver (see driverLib's warmup)
+	const steadyWindow, steadyCV, maxWarmup = 5, 0.05, 50
+	switch protocol {
+	case "cold":
+	case "warmup":
+		for ; out.Warmup < fixed; out.Warmup++ {
+			if _, err := call(); err != nil {
+				return runOutput{}, err
+			}
+		}
+	default:
+		var window []float64
+		for out.Warmup < maxWarmup {
+			t, err := call()
+			if err != nil {
+				return runOutput{}, err
+			}
+			out.Warmup++
+			window = append(window, float64(t))
+			if len(window) > steadyWindow {
+				window = window[1:]
+			}
+			if len(window) == steadyWindow {
+				mean, variance := meanVar(window)
+				// Population variance, as the driver computes it
+				variance = variance * (steadyWindow - 1) / steadyWindow
+				if math.Sqrt(variance) < steadyCV*mean {
+					break
+				}
+			}
+		}
+	}
+
+	for i := 0; i < reps; i++ {
+		t, err := call()
+		if err != nil {
+			return runOutput{}, err
+		}
+		out.Times = append(out.Times, t)
+	}
+	return out, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// -suite adds a suite of cases compiled into the harness, so every team and
+// every backend (-backend) times the same canonical workloads without
+// copying snippets between -cases files. A suite is a cases file (see
+// userCase) named bench_suite_<name>.json next to this one; `standard`
+// covers a scalar reduction, a dict build, a nested loop, a filter-heavy
+// list, float math and a string join, each requiring only the constructs
+// it uses, so a backend without them skips the case rather than failing.
+
+//go:embed bench_suite_*.json
+var suiteFiles embed.FS
+
+// suiteNames lists the embedded suites.
+func suiteNames() []string {
+	entries, _ := suiteFiles.ReadDir(".")
+	var names []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(strings.TrimPrefix(e.Name(), "bench_suite_"), ".json")
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadSuite returns the cases of the embedded suite name. Like a -cases
+// file's, their names must not repeat those of taken.
+func loadSuite(name string, taken []benchCase) ([]benchCase, error) {
+	path := "bench_suite_" + name + ".json"
+	data, err := suiteFiles.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unknown suite %q (want %s)", name, strings.Join(suiteNames(), ", "))
+	}
+	return parseUserCases(data, "suite "+name, func(file string) ([]byte, error) {
+		return nil, fmt.Errorf("%s: a suite's snippets are inline", file)
+	}, taken)
+}
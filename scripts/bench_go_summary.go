@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// writeStepSummary appends a markdown results table to the GitHub Actions
+// job summary file. Deltas are shown when a baseline was loaded.
+func writeStepSummary(path string, results []BenchmarkResult, base baseline, threshold float64) error {
+	var b strings.Builder
+
+	b.WriteString("## Go benchmark results\n\n")
+	if len(results) > 0 {
+		fmt.Fprintf(&b, "Commit `%s` on %s (%s)\n\n", results[0].Commit, results[0].OS, results[0].CPU)
+	}
+	b.WriteString("| Test | Mode | N | Mean | Median | p99 | Δ vs baseline | Status |\n")
+	b.WriteString("|---|---|---:|---:|---:|---:|---:|---|\n")
+
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Fprintf(&b, "| %s | %s | %d | – | – | – | – | ❌ %s |\n",
+				r.Test, r.Mode, r.N, markdownEscape(r.Error))
+			continue
+		}
+		if r.Skipped {
+			fmt.Fprintf(&b, "| %s | %s | %d | – | – | – | – | ⏭️ %s (%s) |\n",
+				r.Test, r.Mode, r.N, markdownEscape(r.SkipReason), markdownEscape(strings.Join(r.Missing, ", ")))
+			continue
+		}
+
+		delta := "–"
+		status := "✅"
+		if d, ok := base.delta(r); ok {
+			delta = fmt.Sprintf("%+.1f%%", d*100)
+			if d > threshold {
+				status = "⚠️ regression"
+			}
+		}
+		fmt.Fprintf(&b, "| %s | %s | %d | %s | %s | %s | %s | %s |\n",
+			r.Test, r.Mode, r.N,
+			time.Duration(r.MeanNs), time.Duration(r.MedianNs), time.Duration(r.P99Ns),
+			delta, status)
+	}
+	b.WriteString("\n")
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func markdownEscape(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// tapWriter streams results as TAP version 13 (testanything.org): one test
+// point per result, as writeJUnit judges them. Failed cases and regressions
+// beyond threshold against base are "not ok" with the reason in a YAML
+// diagnostic block, skipped cases are "ok" with a SKIP directive, and
+// measured ones "ok" with their statistics in the block. The plan comes last,
+// since the number of results is only known once the run is over.
+type tapWriter struct {
+	w         io.Writer
+	base      baseline
+	threshold float64
+	n         int
+}
+
+func newTAPWriter(w io.Writer, base baseline, threshold float64) *tapWriter {
+	fmt.Fprintln(w, "TAP version 13")
+	return &tapWriter{w: w, base: base, threshold: threshold}
+}
+
+func (t *tapWriter) write(r BenchmarkResult) {
+	t.n++
+	name := fmt.Sprintf("%s/%s n=%d", r.Backend, benchCase{Test: r.Test, Mode: r.Mode, Target: r.Target}.name(), r.N)
+	if r.GOMAXPROCS > 0 && r.Parallel {
+		name += fmt.Sprintf(" GOMAXPROCS=%d", r.GOMAXPROCS)
+	}
+	switch {
+	case r.Error != "":
+		kind := r.ErrorClass
+		if kind == "" {
+			kind = "error"
+		}
+		fmt.Fprintf(t.w, "not ok %d - %s\n", t.n, name)
+		t.diagnostic("severity: fail", "error_class: "+kind, "message: |", r.Error)
+	case r.Skipped:
+		reason := r.SkipReason
+		if len(r.Missing) > 0 {
+			reason += ": " + strings.Join(r.Missing, ", ")
+		}
+		fmt.Fprintf(t.w, "ok %d - %s # SKIP %s\n", t.n, name, reason)
+	case t.base.regressed(r, t.threshold):
+		d, _ := t.base.delta(r)
+		fmt.Fprintf(t.w, "not ok %d - %s\n", t.n, name)
+		t.diagnostic("severity: fail", "error_class: regression", "message: |",
+			fmt.Sprintf("mean %d ns is %.1f%% slower than baseline %d ns (threshold %.1f%%)",
+				r.MeanNs, d*100, t.base[keyOf(r)], t.threshold*100))
+	default:
+		fmt.Fprintf(t.w, "ok %d - %s\n", t.n, name)
+		t.diagnostic(fmt.Sprintf("mean_ns: %d", r.MeanNs), fmt.Sprintf("std_ns: %d", r.StdNs),
+			fmt.Sprintf("median_ns: %d", r.MedianNs), fmt.Sprintf("p99_ns: %d", r.P99Ns))
+	}
+}
+
+// diagnostic writes the YAML block under a test point: fields, then, after
+// a field ending in "|", the lines of a message as its literal block
+// scalar, so error output needs no escaping.
+func (t *tapWriter) diagnostic(fields ...string) {
+	fmt.Fprintln(t.w, "  ---")
+	literal := false
+	for _, field := range fields {
+		if !literal {
+			fmt.Fprintf(t.w, "  %s\n", field)
+			literal = strings.HasSuffix(field, "|")
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimRight(field, "\n"), "\n") {
+			fmt.Fprintf(t.w, "    %s\n", line)
+		}
+	}
+	fmt.Fprintln(t.w, "  ...")
+}
+
+// finish writes the plan.
+func (t *tapWriter) finish() {
+	fmt.Fprintf(t.w, "1..%d\n", t.n)
+}
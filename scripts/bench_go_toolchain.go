@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Matrix entries build with the gc toolchain (go build) unless Toolchain
+// asks for TinyGo, whose map, goroutine and GC costs differ enough from gc
+// to be tracked as their own cases.
+
+// skipToolchain is the SkipReason for cases whose toolchain is not
+// installed.
+const skipToolchain = "toolchain_unavailable"
+
+// toolchain is the compiler tc builds with, as recorded in results.
+func (tc benchCase) toolchain() string {
+	if tc.Toolchain == "" {
+		return "gc"
+	}
+	return tc.Toolchain
+}
+
+// buildCommand builds binary from sources for tc's toolchain, target and
+// build flags, with its Go toolchain for gc. TinyGo takes a single package rather than a file list, so it
+// builds the package in the directory holding the sources, outside module
+// mode.
+func buildCommand(tc benchCase, binary string, sources []string) (*exec.Cmd, error) {
+	env := os.Environ()
+	if tc.Target != "" {
+		env = crossEnv(tc.Target)
+	}
+	if tc.toolchain() != "tinygo" {
+		goCmd := "go"
+		if tc.Go.Cmd != "" {
+			goCmd = tc.Go.Cmd
+			env = append(env, "GOTOOLCHAIN=local")
+		}
+		cmd := commandContext(goCmd, buildArgs(binary, tc.BuildFlags, sources)...)
+		cmd.Env = env
+		return cmd, nil
+	}
+	if _, err := exec.LookPath("tinygo"); err != nil {
+		return nil, err
+	}
+	binary, err := filepath.Abs(binary)
+	if err != nil {
+		return nil, err
+	}
+	cmd := commandContext("tinygo", buildArgs(binary, tc.BuildFlags, []string{"."})...)
+	cmd.Dir = filepath.Dir(sources[0])
+	cmd.Env = append(env, "GO111MODULE=off")
+	return cmd, nil
+}
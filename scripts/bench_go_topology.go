@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// cpuTopology is how the online logical CPUs map onto physical cores, so
+// parallel scaling results can be read in terms of real cores rather than
+// SMT (hyperthread) siblings.
+type cpuTopology struct {
+	Logical        int `json:"logical_cpus"`
+	Physical       int `json:"physical_cores"`
+	ThreadsPerCore int `json:"threads_per_core"`
+	// PhysicalOnly is set when the run was restricted to one logical CPU
+	// per physical core (-physical-cores)
+	PhysicalOnly bool `json:"physical_only,omitempty"`
+
+	cores [][]int // sibling CPUs of each core, in CPU order
+}
+
+const sysCPU = "/sys/devices/system/cpu"
+
+// detectTopology groups online CPUs by their thread siblings (Linux only).
+func detectTopology() (*cpuTopology, error) {
+	data, err := os.ReadFile(filepath.Join(sysCPU, "online"))
+	if err != nil {
+		return nil, fmt.Errorf("CPU topology: %v", err)
+	}
+	online, err := parseCPUList(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("CPU topology: %v", err)
+	}
+	t := &cpuTopology{Logical: len(online)}
+	seen := map[string]bool{}
+	for _, cpu := range online {
+		path := filepath.Join(sysCPU, fmt.Sprintf("cpu%d", cpu), "topology", "thread_siblings_list")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("CPU topology: %v", err)
+		}
+		siblings, err := parseCPUList(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("CPU topology: %s: %v", path, err)
+		}
+		key := formatCPUList(siblings)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		t.cores = append(t.cores, siblings)
+		if len(siblings) > t.ThreadsPerCore {
+			t.ThreadsPerCore = len(siblings)
+		}
+	}
+	t.Physical = len(t.cores)
+	return t, nil
+}
+
+// pinPhysicalCores narrows the -cpus list cpus, every online CPU when
+// empty, to one logical CPU per physical core (-physical-cores).
+func (t *cpuTopology) pinPhysicalCores(cpus string) (string, error) {
+	var allowed []int
+	if cpus != "" {
+		var err error
+		if allowed, err = parseCPUList(cpus); err != nil {
+			return "", fmt.Errorf("-cpus: %v", err)
+		}
+	}
+	physical := t.physicalCPUs(allowed)
+	if len(physical) == 0 {
+		return "", fmt.Errorf("-physical-cores: no online CPUs in %q", cpus)
+	}
+	t.PhysicalOnly = true
+	return formatCPUList(physical), nil
+}
+
+// physicalCPUs returns one logical CPU per physical core, the lowest
+// numbered sibling, considering only CPUs in allowed (all when nil). The
+// result is sorted.
+func (t *cpuTopology) physicalCPUs(allowed []int) []int {
+	ok := func(cpu int) bool {
+		if allowed == nil {
+			return true
+		}
+		for _, a := range allowed {
+			if a == cpu {
+				return true
+			}
+		}
+		return false
+	}
+	var cpus []int
+	for _, core := range t.cores {
+		for _, cpu := range core {
+			if ok(cpu) {
+				cpus = append(cpus, cpu)
+				break
+			}
+		}
+	}
+	sort.Ints(cpus)
+	return cpus
+}
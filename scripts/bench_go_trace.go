@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// When an OTLP endpoint is configured through the standard OpenTelemetry
+// variables, the run is exported as one trace: a root span for the run, a
+// span per case, and under it the case's generate, compile, warmup and
+// measure phases. Spans are kept in memory and sent in one OTLP/HTTP JSON
+// request when the run ends, so tracing adds no requests to timed sections.
+
+// tracer collects the run's spans. A nil tracer records nothing.
+type tracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	traceID  string
+
+	mu    sync.Mutex
+	spans []*span
+}
+
+// span is one timed phase. Attributes are strings, integers or booleans.
+type span struct {
+	tr     *tracer
+	id     string
+	parent string
+	name   string
+	start  time.Time
+	end    time.Time
+	attrs  map[string]any
+	err    string
+}
+
+// newTracer configures export from OTEL_EXPORTER_OTLP_TRACES_ENDPOINT (the
+// full URL) or OTEL_EXPORTER_OTLP_ENDPOINT (a base URL, to which /v1/traces
+// is added), with OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME. It is
+// nil when neither endpoint is set.
+func newTracer() (*tracer, error) {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	if _, err := url.ParseRequestURI(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+	t := &tracer{endpoint: endpoint, headers: map[string]string{}, service: getEnv("OTEL_SERVICE_NAME", "pcs-bench"), traceID: randomHex(16)}
+	// key1=value1,key2=value2, values URL-encoded
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if v, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = v
+		}
+		t.headers[strings.TrimSpace(key)] = value
+	}
+	return t, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// start opens a span under parent (the trace root when nil) at the current
+// time.
+func (t *tracer) start(name string, parent *span, attrs map[string]any) *span {
+	return t.record(name, parent, time.Now(), time.Time{}, attrs)
+}
+
+// record adds a span with the given times; an open span has a zero end.
+func (t *tracer) record(name string, parent *span, start, end time.Time, attrs map[string]any) *span {
+	if t == nil {
+		return nil
+	}
+	s := &span{tr: t, id: randomHex(8), name: name, start: start, end: end, attrs: attrs}
+	if parent != nil {
+		s.parent = parent.id
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return s
+}
+
+// finish closes s, marking it failed when err is set. Closing a span twice
+// keeps the first end.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.tr.mu.Lock()
+	defer s.tr.mu.Unlock()
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+	if err != nil && s.err == "" {
+		s.err = err.Error()
+	}
+}
+
+// set adds an attribute to s.
+func (s *span) set(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.tr.mu.Lock()
+	defer s.tr.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = map[string]any{}
+	}
+	s.attrs[key] = value
+}
+
+// fail marks s failed without closing it.
+func (s *span) fail(message string) {
+	if s == nil {
+		return
+	}
+	s.tr.mu.Lock()
+	defer s.tr.mu.Unlock()
+	if s.err == "" {
+		s.err = message
+	}
+}
+
+// export sends every span, closing open ones now.
+func (t *tracer) export() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	now := time.Now()
+	spans := make([]map[string]any, 0, len(t.spans))
+	for _, s := range t.spans {
+		if s.end.IsZero() {
+			s.end = now
+		}
+		spans = append(spans, s.otlp(t.traceID))
+	}
+	t.mu.Unlock()
+
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": otlpAttributes(map[string]any{"service.name": t.service})},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "bench_go"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("export to %s failed: %s", t.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// otlp is s in the OTLP/JSON encoding: hex IDs, nanosecond times as
+// strings, kind internal, status error (2) when failed.
+func (s *span) otlp(traceID string) map[string]any {
+	m := map[string]any{
+		"traceId":           traceID,
+		"spanId":            s.id,
+		"name":              s.name,
+		"kind":              1,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        otlpAttributes(s.attrs),
+	}
+	if s.parent != "" {
+		m["parentSpanId"] = s.parent
+	}
+	if s.err != "" {
+		m["status"] = map[string]any{"code": 2, "message": s.err}
+	}
+	return m
+}
+
+func otlpAttributes(attrs map[string]any) []any {
+	out := make([]any, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]any
+		switch v := v.(type) {
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, map[string]any{"key": k, "value": value})
+	}
+	return out
+}
+
+// traceRun records one execution of a benchmark binary as a warmup span
+// (process startup and untimed calls) followed by a measure span covering
+// the timed calls, which end with the process. Only the timed calls are
+// known, so the split is placed that far before the end.
+func traceRun(t *tracer, parent *span, role string, start time.Time, out runOutput, err error) {
+	end := time.Now()
+	attrs := map[string]any{"binary": role}
+	if err != nil {
+		s := t.record("measure", parent, start, end, attrs)
+		s.finish(err)
+		return
+	}
+	split := end.Add(-out.timed())
+	if split.Before(start) {
+		split = start
+	}
+	t.record("warmup", parent, start, split, map[string]any{"binary": role, "calls": out.Warmup})
+	attrs["calls"] = len(out.Times)
+	t.record("measure", parent, split, end, attrs)
+}
+
+// binaryRole names binary for spans: current, pgo or previous
+// (-compare-binary).
+func binaryRole(binary, current, pgo string) string {
+	switch binary {
+	case current:
+		return "current"
+	case pgo:
+		return "pgo"
+	}
+	return "previous"
+}
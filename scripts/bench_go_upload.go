@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// uploadManifest lists what one upload put under its prefix. It is written
+// last, so a prefix with a manifest holds every file it names.
+type uploadManifest struct {
+	Commit         string         `json:"commit"`
+	Timestamp      string         `json:"timestamp"`
+	Prefix         string         `json:"prefix"`
+	Uploaded       string         `json:"uploaded"`
+	HarnessVersion string         `json:"harness_version"`
+	Files          []uploadedFile `json:"files"`
+}
+
+type uploadedFile struct {
+	// Path is relative to the prefix
+	Path        string `json:"path"`
+	Bytes       int64  `json:"bytes"`
+	SHA256      string `json:"sha256"`
+	ContentType string `json:"content_type"`
+}
+
+// runUpload implements `upload`: it copies results, profiles and
+// reports to <dest>/<commit>/<timestamp>/ in S3 (s3://, through the aws
+// CLI), GCS (gs://, through gcloud storage) or a local directory, then adds
+// manifest.json. The commit and timestamp are those of the first NDJSON
+// file's run unless given.
+func runUpload(args []string) int {
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	dest := fs.String("to", os.Getenv("PCS_UPLOAD_URL"), "destination: s3://bucket/prefix, gs://bucket/prefix or a directory")
+	commit := fs.String("commit", "", "commit for the prefix (default: from the results, else git)")
+	timestamp := fs.String("timestamp", "", "RFC 3339 timestamp for the prefix (default: the run's start, else now)")
+	retries := fs.Int("retries", 3, "retries per file, with exponential backoff")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench upload -to s3://bucket/prefix files-or-dirs...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *dest == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	files, err := uploadFiles(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "upload: %v\n", err)
+		return 1
+	}
+	m := uploadManifest{Commit: *commit, Timestamp: *timestamp, HarnessVersion: harnessVersion()}
+	for _, f := range files {
+		if m.Commit != "" && m.Timestamp != "" {
+			break
+		}
+		if !strings.HasSuffix(f.local, ".ndjson") {
+			continue
+		}
+		results, headers, _, err := readRecords(f.local)
+		if err != nil {
+			continue
+		}
+		for _, h := range headers {
+			m.Commit, m.Timestamp = firstSet(m.Commit, h.Commit), firstSet(m.Timestamp, h.Started)
+		}
+		for _, r := range results {
+			m.Commit, m.Timestamp = firstSet(m.Commit, r.Commit), firstSet(m.Timestamp, r.Timestamp)
+		}
+	}
+	if m.Commit == "" {
+		m.Commit, _ = detectGit()
+	}
+	at := time.Now().UTC()
+	if m.Timestamp != "" {
+		if at, err = time.Parse(time.RFC3339, m.Timestamp); err != nil {
+			fmt.Fprintf(os.Stderr, "upload: invalid timestamp %q\n", m.Timestamp)
+			return 2
+		}
+	}
+	m.Timestamp = at.UTC().Format(time.RFC3339)
+	m.Prefix = strings.TrimRight(*dest, "/") + "/" + m.Commit + "/" + at.UTC().Format("20060102T150405Z")
+
+	put, err := objectStore(m.Prefix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "upload: %v\n", err)
+		return 2
+	}
+	for _, f := range files {
+		sum, err := hashFile(f.local)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "upload: %v\n", err)
+			return 1
+		}
+		info, err := os.Stat(f.local)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "upload: %v\n", err)
+			return 1
+		}
+		entry := uploadedFile{Path: f.remote, Bytes: info.Size(), SHA256: sum, ContentType: contentType(f.local)}
+		if err := withRetries(*retries, func() error { return put(f.local, entry.Path, entry.ContentType) }); err != nil {
+			fmt.Fprintf(os.Stderr, "upload: %s: %v\n", f.local, err)
+			return 1
+		}
+		m.Files = append(m.Files, entry)
+	}
+
+	m.Uploaded = time.Now().UTC().Format(time.RFC3339)
+	manifest, err := os.CreateTemp("", "manifest-*.json")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "upload: %v\n", err)
+		return 1
+	}
+	defer os.Remove(manifest.Name())
+	enc := json.NewEncoder(manifest)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(m)
+	if cerr := manifest.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = withRetries(*retries, func() error { return put(manifest.Name(), "manifest.json", "application/json") })
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "upload: manifest: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "uploaded %d files\n", len(m.Files))
+	fmt.Println(m.Prefix)
+	return 0
+}
+
+func firstSet(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
+
+// uploadFile is a local file and its path under the prefix.
+type uploadFile struct {
+	local, remote string
+}
+
+// uploadFiles expands the arguments: a file goes to the top of the prefix
+// under its base name, a directory's files under the directory's name.
+func uploadFiles(args []string) ([]uploadFile, error) {
+	var files []uploadFile
+	seen := map[string]string{}
+	add := func(local, remote string) error {
+		if prev, ok := seen[remote]; ok {
+			return fmt.Errorf("%s and %s would both upload as %s", prev, local, remote)
+		}
+		seen[remote] = local
+		files = append(files, uploadFile{local, remote})
+		return nil
+	}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if err := add(arg, filepath.Base(arg)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		root := filepath.Base(filepath.Clean(arg))
+		err = filepath.WalkDir(arg, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(arg, p)
+			if err != nil {
+				return err
+			}
+			return add(p, path.Join(root, filepath.ToSlash(rel)))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].remote < files[j].remote })
+	return files, nil
+}
+
+// objectStore returns the function copying a local file to a path under
+// prefix, checking that the tool it needs is installed.
+func objectStore(prefix string) (func(local, remote, contentType string) error, error) {
+	var tool []string
+	switch {
+	case strings.HasPrefix(prefix, "s3://"):
+		tool = []string{"aws", "s3", "cp", "--only-show-errors"}
+	case strings.HasPrefix(prefix, "gs://"):
+		tool = []string{"gcloud", "storage", "cp"}
+	case strings.Contains(prefix, "://"):
+		return nil, fmt.Errorf("unsupported destination %q (want s3://, gs:// or a directory)", prefix)
+	default:
+		return func(local, remote, _ string) error {
+			dst := filepath.Join(prefix, filepath.FromSlash(remote))
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return err
+			}
+			return copyFile(local, dst, 0644)
+		}, nil
+	}
+	if _, err := exec.LookPath(tool[0]); err != nil {
+		return nil, fmt.Errorf("%s needs the %s CLI: %v", prefix, tool[0], err)
+	}
+	return func(local, remote, contentType string) error {
+		argv := append(append([]string(nil), tool...), "--content-type", contentType, local, prefix+"/"+remote)
+		// A stalled transfer is retried rather than waited for
+		_, err := runWithin(commandContext(argv[0], argv[1:]...), 10*time.Minute, 0)
+		return err
+	}, nil
+}
+
+// withRetries calls f until it succeeds, at most retries more times after
+// the first, waiting 1s, 2s, 4s, ... in between.
+func withRetries(retries int, f func() error) error {
+	err := f()
+	for i, wait := 0, time.Second; err != nil && i < retries; i, wait = i+1, wait*2 {
+		fmt.Fprintf(os.Stderr, "upload: %v; retrying in %v\n", err, wait)
+		time.Sleep(wait)
+		err = f()
+	}
+	return err
+}
+
+// hashFile is the hex SHA-256 of the file at p.
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func contentType(p string) string {
+	switch filepath.Ext(p) {
+	case ".ndjson":
+		return "application/x-ndjson"
+	case ".json":
+		return "application/json"
+	case ".html":
+		return "text/html; charset=utf-8"
+	case ".csv":
+		return "text/csv"
+	case ".md", ".txt", ".log":
+		return "text/plain; charset=utf-8"
+	case ".xml":
+		return "application/xml"
+	}
+	return "application/octet-stream"
+}
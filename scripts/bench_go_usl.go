@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// runUSL implements `usl`: for every parallel kernel with results at several
+// GOMAXPROCS levels (including 1) it fits the Universal Scalability Law
+//
+//	C(p) = p / (1 + σ(p-1) + κp(p-1))
+//
+// to the relative capacity C(p) = wall(1)/wall(p), plus the Amdahl special
+// case κ = 0, and reports the coefficients. σ is contention (serialised
+// work such as the shard merge), κ is coherence (cross-worker traffic that
+// makes adding workers counterproductive).
+func runUSL(args []string) int {
+	fs := flag.NewFlagSet("usl", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print one JSON object per kernel instead of a table")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench usl [-json] results.ndjson...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	results, err := readResults(fs.Args()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "usl: %v\n", err)
+		return 1
+	}
+
+	fits := uslFits(results)
+	if len(fits) == 0 {
+		fmt.Fprintln(os.Stderr, "usl: no parallel kernel has results at GOMAXPROCS=1 and at least one other level")
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, f := range fits {
+			enc.Encode(f)
+		}
+		return 0
+	}
+	for _, f := range fits {
+		fmt.Printf("%s\n", f.Kernel)
+		fmt.Printf("  levels     %v\n", f.Procs)
+		fmt.Printf("  USL        σ=%.4f κ=%.6f R²=%.3f", f.Sigma, f.Kappa, f.R2)
+		if f.PeakProcs > 0 {
+			fmt.Printf(" peak at p≈%.1f", f.PeakProcs)
+		}
+		fmt.Printf("\n  Amdahl     serial fraction=%.4f", f.AmdahlSigma)
+		if f.AmdahlMaxSpeedup > 0 {
+			fmt.Printf(" (max speedup %.1fx)", f.AmdahlMaxSpeedup)
+		}
+		fmt.Println()
+		fmt.Printf("  diagnosis  %s\n", f.Diagnosis)
+	}
+	return 0
+}
+
+type uslFit struct {
+	Kernel string    `json:"kernel"`
+	Procs  []int     `json:"procs"`
+	Speed  []float64 `json:"capacity"`
+	Sigma  float64   `json:"sigma"`
+	Kappa  float64   `json:"kappa"`
+	R2     float64   `json:"r2"`
+	// PeakProcs is where the fitted curve peaks, 0 when κ = 0.
+	PeakProcs   float64 `json:"peak_procs,omitempty"`
+	AmdahlSigma float64 `json:"amdahl_sigma"`
+	// AmdahlMaxSpeedup is 1/σ, 0 when the serial fraction fits as zero.
+	AmdahlMaxSpeedup float64 `json:"amdahl_max_speedup,omitempty"`
+	Diagnosis        string  `json:"diagnosis"`
+}
+
+// uslFits groups parallel results the same way as paretoKernels and fits
+// every kernel that has a GOMAXPROCS=1 baseline.
+func uslFits(results []BenchmarkResult) []uslFit {
+	groups := map[string]map[int][]int64{}
+	for _, r := range results {
+		if !r.Parallel || !r.measured() || r.MeanNs <= 0 || r.GOMAXPROCS <= 0 {
+			continue
+		}
+		name := fmt.Sprintf("%s/%s/%s n=%d", r.Backend, r.Test, r.Mode, r.N)
+		if groups[name] == nil {
+			groups[name] = map[int][]int64{}
+		}
+		groups[name][r.GOMAXPROCS] = append(groups[name][r.GOMAXPROCS], r.MeanNs)
+	}
+
+	var fits []uslFit
+	for name, levels := range groups {
+		base, ok := levels[1]
+		if !ok || len(levels) < 2 {
+			continue
+		}
+		f := uslFit{Kernel: name}
+		for p := range levels {
+			f.Procs = append(f.Procs, p)
+		}
+		sort.Ints(f.Procs)
+		wall1 := float64(medianOf(base))
+		for _, p := range f.Procs {
+			f.Speed = append(f.Speed, wall1/float64(medianOf(levels[p])))
+		}
+		f.fit()
+		fits = append(fits, f)
+	}
+	sort.Slice(fits, func(i, j int) bool { return fits[i].Kernel < fits[j].Kernel })
+	return fits
+}
+
+// fit uses the usual linearisation of the USL: with x = p-1 and
+// y = p/C(p) - 1, y = σx + κx(x+1), which is ordinary least squares through
+// the origin on two regressors. Negative coefficients are not physical, so
+// a negative one is pinned to zero and the other refitted alone.
+func (f *uslFit) fit() {
+	var sxx, sxz, szz, sxy, szy float64
+	for i, p := range f.Procs {
+		x := float64(p - 1)
+		z := x * (x + 1)
+		y := float64(p)/f.Speed[i] - 1
+		sxx += x * x
+		sxz += x * z
+		szz += z * z
+		sxy += x * y
+		szy += z * y
+	}
+
+	amdahl := 0.0
+	if sxx > 0 {
+		amdahl = math.Max(sxy/sxx, 0)
+	}
+	f.AmdahlSigma = amdahl
+	if amdahl > 0 {
+		f.AmdahlMaxSpeedup = 1 / amdahl
+	}
+
+	sigma, kappa := amdahl, 0.0
+	if det := sxx*szz - sxz*sxz; det > 0 {
+		sigma = (sxy*szz - szy*sxz) / det
+		kappa = (szy*sxx - sxy*sxz) / det
+		switch {
+		case sigma < 0 && kappa < 0:
+			sigma, kappa = 0, 0
+		case sigma < 0:
+			sigma, kappa = 0, math.Max(szy/szz, 0)
+		case kappa < 0:
+			sigma, kappa = amdahl, 0
+		}
+	}
+	f.Sigma, f.Kappa = sigma, kappa
+	if kappa > 0 {
+		f.PeakProcs = math.Sqrt((1 - sigma) / kappa)
+	}
+
+	var mean float64
+	for _, c := range f.Speed {
+		mean += c
+	}
+	mean /= float64(len(f.Speed))
+	var ssRes, ssTot float64
+	for i, p := range f.Procs {
+		pred := uslCapacity(float64(p), sigma, kappa)
+		ssRes += (f.Speed[i] - pred) * (f.Speed[i] - pred)
+		ssTot += (f.Speed[i] - mean) * (f.Speed[i] - mean)
+	}
+	if ssTot > 0 {
+		f.R2 = 1 - ssRes/ssTot
+	} else {
+		f.R2 = 1
+	}
+
+	f.Diagnosis = uslDiagnosis(f)
+}
+
+func uslCapacity(p, sigma, kappa float64) float64 {
+	return p / (1 + sigma*(p-1) + kappa*p*(p-1))
+}
+
+// uslDiagnosis turns the coefficients into a one-line hint about where the
+// parallel codegen loses time.
+func uslDiagnosis(f *uslFit) string {
+	maxProcs := float64(f.Procs[len(f.Procs)-1])
+	switch {
+	case f.Kappa > 0 && f.PeakProcs < maxProcs:
+		return fmt.Sprintf("coherence-bound: throughput falls past %.1f workers; look for shared writes or false sharing between shards", f.PeakProcs)
+	case f.Sigma >= 0.1:
+		return fmt.Sprintf("contention-bound: %.0f%% of the work is serialised; look at the merge step and per-worker setup", f.Sigma*100)
+	case f.Sigma < 0.02 && f.Kappa == 0:
+		return "near-linear scaling"
+	default:
+		return "moderate contention; scaling is sub-linear but still improving"
+	}
+}
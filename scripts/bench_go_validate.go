@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// resultSchema is the JSON Schema of a results stream record, compiled in so
+// `validate` checks files against the layout this binary writes.
+//
+//go:embed bench_result.schema.json
+var resultSchema []byte
+
+// schemaValidator checks decoded JSON values against the subset of JSON
+// Schema (draft-07) that bench_result.schema.json uses: type, const, enum,
+// properties, required, additionalProperties, propertyNames, items,
+// minimum, maximum, minLength, pattern, anyOf and local $refs. Other keywords are ignored.
+type schemaValidator struct {
+	root     map[string]any
+	patterns map[string]*regexp.Regexp
+}
+
+func newSchemaValidator(schema []byte) (*schemaValidator, error) {
+	var root map[string]any
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return nil, fmt.Errorf("schema: %v", err)
+	}
+	return &schemaValidator{root: root, patterns: map[string]*regexp.Regexp{}}, nil
+}
+
+// definition is the named schema under #/definitions.
+func (v *schemaValidator) definition(name string) (map[string]any, error) {
+	defs, _ := v.root["definitions"].(map[string]any)
+	s, ok := defs[name].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("schema has no definition %q", name)
+	}
+	return s, nil
+}
+
+// check appends a "path: message" line to errs for every way value breaks
+// schema. Values must be decoded with UseNumber so integers are told apart.
+func (v *schemaValidator) check(schema map[string]any, value any, path string, errs *[]string) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		s, err := v.definition(strings.TrimPrefix(ref, "#/definitions/"))
+		if err != nil {
+			fail("%v", err)
+			return
+		}
+		v.check(s, value, path, errs)
+		return
+	}
+	if t, ok := schema["type"].(string); ok && !hasJSONType(value, t) {
+		fail("want %s, got %s", t, jsonType(value))
+		return
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(value, c) {
+		fail("want %v, got %v", c, value)
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			found = found || jsonEqual(value, e)
+		}
+		if !found {
+			fail("%v is not one of %v", value, enum)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		var reasons []string
+		for _, alt := range anyOf {
+			var altErrs []string
+			if s, ok := alt.(map[string]any); ok {
+				v.check(s, value, path, &altErrs)
+			}
+			if len(altErrs) == 0 {
+				reasons = nil
+				break
+			}
+			reasons = append(reasons, strings.TrimPrefix(strings.Join(altErrs, "; "), path+": "))
+		}
+		if len(reasons) > 0 {
+			fail("matches none of: %s", strings.Join(reasons, " | "))
+		}
+	}
+	switch x := value.(type) {
+	case json.Number:
+		f, _ := x.Float64()
+		if min, ok := schema["minimum"].(float64); ok && f < min {
+			fail("%v is below the minimum %v", x, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && f > max {
+			fail("%v is above the maximum %v", x, max)
+		}
+	case string:
+		if min, ok := schema["minLength"].(float64); ok && float64(len(x)) < min {
+			fail("shorter than %v characters", min)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			re, ok := v.patterns[p]
+			if !ok {
+				re = regexp.MustCompile(p)
+				v.patterns[p] = re
+			}
+			if !re.MatchString(x) {
+				fail("%q does not match %s", x, p)
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range x {
+				v.check(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case map[string]any:
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if _, ok := x[name.(string)]; !ok {
+					fail("missing required field %q", name)
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub := path + "." + k
+			if names, ok := schema["propertyNames"].(map[string]any); ok {
+				v.check(names, k, sub, errs)
+			}
+			if p, ok := props[k].(map[string]any); ok {
+				v.check(p, x[k], sub, errs)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					fail("unknown field %q", k)
+				}
+			case map[string]any:
+				v.check(extra, x[k], sub, errs)
+			}
+		}
+	}
+}
+
+// jsonType names the JSON type of a value decoded with UseNumber.
+func jsonType(value any) string {
+	switch x := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := x.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func hasJSONType(value any, t string) bool {
+	got := jsonType(value)
+	return got == t || t == "number" && got == "integer"
+}
+
+// jsonEqual compares a value decoded with UseNumber to one from the schema.
+func jsonEqual(value, want any) bool {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		return err == nil && f == want
+	}
+	return value == want
+}
+
+// runValidate implements `validate`: it checks every record of the given
+// NDJSON files against the embedded schema, run headers and speedup records
+// against their run_header and speedup definitions and everything else
+// against result, and exits 1 if any record is invalid. A truncated final
+// record, left by a crashed run -append, is reported and skipped.
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	printSchema := fs.Bool("print-schema", false, "print the embedded JSON Schema and exit")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench validate [-print-schema] results.ndjson...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *printSchema {
+		os.Stdout.Write(resultSchema)
+		return 0
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	v, err := newSchemaValidator(resultSchema)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "validate: %v\n", err)
+		return 1
+	}
+	headerSchema, err := v.definition("run_header")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "validate: %v\n", err)
+		return 1
+	}
+	speedupSchema, err := v.definition("speedup")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "validate: %v\n", err)
+		return 1
+	}
+	resultDef, err := v.definition("result")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "validate: %v\n", err)
+		return 1
+	}
+
+	records, invalid := 0, 0
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "validate: %v\n", err)
+			return 1
+		}
+		// A record cut short by a crash is not read, as run -append would
+		// drop it
+		var r io.Reader = f
+		tail, err := truncatedTail(path)
+		if info, serr := f.Stat(); err == nil && serr == nil && tail > 0 {
+			r = io.LimitReader(f, info.Size()-tail)
+			fmt.Fprintf(os.Stderr, "validate: %s: ignoring a truncated final record of %d bytes\n", path, tail)
+		}
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			records++
+			var errs []string
+			var record any
+			dec := json.NewDecoder(bytes.NewReader(text))
+			dec.UseNumber()
+			if err := dec.Decode(&record); err != nil {
+				errs = append(errs, "$: "+err.Error())
+			} else {
+				schema := resultDef
+				if m, ok := record.(map[string]any); ok && m["record"] == speedupRecordKind {
+					schema = speedupSchema
+				} else if ok && m["record"] != nil {
+					schema = headerSchema
+				}
+				v.check(schema, record, "$", &errs)
+			}
+			for _, e := range errs {
+				fmt.Printf("%s:%d: %s\n", path, line, e)
+			}
+			if len(errs) > 0 {
+				invalid++
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "validate: %s: %v\n", path, err)
+			return 1
+		}
+	}
+	fmt.Fprintf(os.Stderr, "validate: %d records, %d invalid\n", records, invalid)
+	if invalid > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Before a case is timed its program is run once more and what it computes
+// is compared with the Python snippet it was generated from, evaluated by
+// python3 (-verify). A translation that computes something else is
+// reported as errWrongResult instead of timed: it would otherwise show up
+// as a speedup.
+
+// verifier is a BackendRunner that can report the result a build computes,
+// in the canonical JSON form of referenceSource.
+type verifier interface {
+	Result(tc benchCase, p program, binary string, env runEnv) ([]byte, error)
+}
+
+// referenceSource evaluates a case in Python, with math imported for
+// math.prod, and prints its result as compact JSON: sets as sorted lists,
+// dicts as key-sorted [key, value] pairs, generators as lists and the
+// results of several --code snippets as one list. A stage pipeline's result is its last stage's. For stream
+// cases it prints {"values": [...], "sort": k} instead, the values as the
+// program writes them; k > 0 means only their order as runs of k values
+// (one for a set, two for a dict's pairs) is unspecified. A data case's
+// input is bound to data, read from the file writeDataInput wrote.
+const referenceSource = `import array, json, math, sys
+
+def canon(v):
+    if isinstance(v, (bool, int, float, str)):
+        return v
+    if isinstance(v, dict):
+        return [[k, canon(v[k])] for k in sorted(v)]
+    if isinstance(v, (set, frozenset)):
+        return sorted(v)
+    return [canon(x) for x in v]
+
+def flat(v):
+    if isinstance(v, dict):
+        return [x for k in sorted(v) for x in (k, int(v[k]))], 2
+    if isinstance(v, (set, frozenset)):
+        return sorted(v), 1
+    if isinstance(v, (bool, int)):
+        return [int(v)], 0
+    return [int(x) for x in v], 0
+
+spec = json.load(sys.stdin)
+ns = {"math": math}
+if spec["data"]:
+    data = array.array("q")
+    with open(spec["data"], "rb") as f:
+        data.frombytes(f.read())
+    if sys.byteorder == "big":
+        data.byteswap()
+    ns["data"] = data.tolist()
+if spec["stages"]:
+    for stage in spec["stages"]:
+        name, _, expr = stage.partition("=")
+        result = ns[name.strip()] = eval(expr, ns)
+    results = [result]
+else:
+    results = [eval(code, dict(ns)) for code in spec["codes"]]
+if spec["stream"]:
+    values, k = flat(results[0])
+    out = {"values": values, "sort": k}
+elif len(results) == 1:
+    out = canon(results[0])
+else:
+    out = [canon(r) for r in results]
+json.dump(out, sys.stdout, separators=(",", ":"))
+`
+
+// errWrongResult: the generated program computed something other than the
+// Python snippet (-verify)
+const errWrongResult = "wrong_result"
+
+// referenceCache holds the last Python reference evaluated. Variants of a
+// case share their snippet and run one after another, so one entry saves
+// most evaluations without holding every large result.
+type referenceCache struct {
+	key    string
+	result []byte
+}
+
+// reference returns tc's Python result at size n, bounded by limit. data is
+// the input file of a data case.
+func (c *referenceCache) reference(tc benchCase, n int, data string, limit time.Duration) ([]byte, error) {
+	spec := struct {
+		Codes  []string `json:"codes"`
+		Stages []string `json:"stages"`
+		Stream bool     `json:"stream"`
+		Data   string   `json:"data"`
+	}{Stream: tc.Stream != ""}
+	size := strconv.Itoa(n)
+	for _, s := range tc.Stages {
+		spec.Stages = append(spec.Stages, strings.ReplaceAll(s, "{N}", size))
+	}
+	if tc.Stages == nil {
+		for _, code := range append([]string{tc.Code}, tc.More...) {
+			spec.Codes = append(spec.Codes, strings.ReplaceAll(code, "{N}", size))
+		}
+	}
+	// Variants of a data case read equal inputs from their own files
+	if tc.Data != "" {
+		spec.Data = fmt.Sprintf("%s/%d@%d", tc.Data, n, dataSeed)
+	}
+	key, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	if c.result != nil && c.key == string(key) {
+		return c.result, nil
+	}
+	input := key
+	if tc.Data != "" {
+		spec.Data = data
+		if input, err = json.Marshal(spec); err != nil {
+			return nil, err
+		}
+	}
+	cmd := commandContext("python3", "-c", referenceSource)
+	cmd.Stdin = bytes.NewReader(input)
+	out, err := runWithin(cmd, limit, 0)
+	if err != nil {
+		return nil, err
+	}
+	c.key, c.result = string(key), out
+	return out, nil
+}
+
+// wrongResultError is a program result that differs from the reference.
+type wrongResultError struct {
+	msg string
+}
+
+func (e *wrongResultError) Error() string { return e.msg }
+
+// checkResult compares a program's canonical result got with the reference
+// want, computed by ref (named in the message). Equal bytes match outright;
+// otherwise both are decoded and compared value by value, with floats equal
+// to a relative 1e-9, since a parallel sum adds in a different order than
+// Python does.
+func checkResult(got, want []byte, ref string) error {
+	got, want = bytes.TrimSpace(got), bytes.TrimSpace(want)
+	if bytes.Equal(got, want) {
+		return nil
+	}
+	var g, w any
+	if err := decodeNumbers(got, &g); err != nil {
+		return fmt.Errorf("unreadable program result: %v", err)
+	}
+	if err := decodeNumbers(want, &w); err != nil {
+		return fmt.Errorf("unreadable %s result: %v", ref, err)
+	}
+	if msg := diffValues("result", g, w, ref); msg != "" {
+		return &wrongResultError{msg}
+	}
+	return nil
+}
+
+func decodeNumbers(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// diffValues describes the first difference between decoded results got
+// and want (ref's), "" when there is none. path names where it is.
+func diffValues(path string, got, want any, ref string) string {
+	switch w := want.(type) {
+	case json.Number:
+		if g, ok := got.(json.Number); ok && sameNumber(g, w) {
+			return ""
+		}
+	case bool:
+		if g, ok := got.(bool); ok && g == w {
+			return ""
+		}
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			break
+		}
+		for i := 0; i < len(g) && i < len(w); i++ {
+			if msg := diffValues(fmt.Sprintf("%s[%d]", path, i), g[i], w[i], ref); msg != "" {
+				return msg
+			}
+		}
+		if len(g) != len(w) {
+			return fmt.Sprintf("%s has %d elements, %s %d", path, len(g), ref, len(w))
+		}
+		return ""
+	}
+	return fmt.Sprintf("%s is %s, %s %s", path, shortJSON(got), ref, shortJSON(want))
+}
+
+func sameNumber(a, b json.Number) bool {
+	if x, err := a.Int64(); err == nil {
+		if y, err := b.Int64(); err == nil {
+			return x == y
+		}
+	}
+	x, errX := a.Float64()
+	y, errY := b.Float64()
+	if errX != nil || errY != nil {
+		return false
+	}
+	return x == y || math.Abs(x-y) <= 1e-9*math.Max(math.Abs(x), math.Abs(y))
+}
+
+// shortJSON renders v for a message, cut to a line.
+func shortJSON(v any) string {
+	data, _ := json.Marshal(v)
+	if len(data) > 60 {
+		return string(data[:57]) + "..."
+	}
+	return string(data)
+}
+
+// streamResult is what a stream program wrote for its input, as values in
+// referenceSource's stream form.
+func streamResult(out []byte, format string, reference []byte) ([]byte, error) {
+	var want struct {
+		Sort int `json:"sort"`
+	}
+	if err := json.Unmarshal(reference, &want); err != nil {
+		return nil, fmt.Errorf("unreadable Python result: %v", err)
+	}
+	values, err := readStreamValues(out, format)
+	if err != nil {
+		return nil, err
+	}
+	if k := want.Sort; k > 0 && len(values)%k == 0 {
+		runs := make([][]int64, 0, len(values)/k)
+		for i := 0; i < len(values); i += k {
+			runs = append(runs, values[i:i+k])
+		}
+		sort.SliceStable(runs, func(i, j int) bool { return runs[i][0] < runs[j][0] })
+		sorted := make([]int64, 0, len(values))
+		for _, r := range runs {
+			sorted = append(sorted, r...)
+		}
+		values = sorted
+	}
+	b := []byte(`{"values":[`)
+	for i, v := range values {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendInt(b, v, 10)
+	}
+	return append(b, fmt.Sprintf(`],"sort":%d}`, want.Sort)...), nil
+}
+
+// readStreamValues decodes a stream program's output: whitespace-separated
+// integers and booleans for lines, frames as writeStreamInput writes them
+// for binary.
+func readStreamValues(out []byte, format string) ([]int64, error) {
+	var values []int64
+	if format == "binary" {
+		for len(out) > 0 {
+			if len(out) < 4 {
+				return nil, fmt.Errorf("truncated frame header")
+			}
+			count := int(binary.LittleEndian.Uint32(out))
+			out = out[4:]
+			if len(out) < 8*count {
+				return nil, fmt.Errorf("truncated frame of %d values", count)
+			}
+			for i := 0; i < count; i++ {
+				values = append(values, int64(binary.LittleEndian.Uint64(out[8*i:])))
+			}
+			out = out[8*count:]
+		}
+		return values, nil
+	}
+	for _, f := range strings.Fields(string(out)) {
+		switch f {
+		case "true":
+			values = append(values, 1)
+		case "false":
+			values = append(values, 0)
+		default:
+			v, err := strconv.ParseInt(f, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected output %q", f)
+			}
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// verifyCase runs the build of tc at size n once for its result and
+// compares it with the Python reference. It returns whether the case was
+// checked: runners that cannot report results, and references that fail to
+// evaluate, are warned about and let through.
+func verifyCase(r BackendRunner, refs *referenceCache, tc benchCase, n int, p program, binary string, env runEnv) (bool, error) {
+	v, ok := r.(verifier)
+	if !ok {
+		return false, nil
+	}
+	want, err := refs.reference(tc, n, p.Input, env.Timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verify: %s_%s: no Python reference, timing unchecked: %v\n", tc.Test, tc.Mode, err)
+		return false, nil
+	}
+	got, err := v.Result(tc, p, binary, env)
+	if err == nil && tc.Stream != "" {
+		got, err = streamResult(got, tc.Stream, want)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, checkResult(got, want, "Python")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// errVet: go vet, or staticcheck under -staticcheck, reported a problem in
+// the generated program (-vet)
+const errVet = "vet_failed"
+
+// staticChecker runs go vet, and staticcheck when enabled, over generated
+// programs. Variants of a case often build the same sources, so each
+// verdict is kept by target and module hash.
+type staticChecker struct {
+	staticcheck bool
+	seen        map[string]error
+}
+
+// check vets the sources of tc's program, whose module hash is hash. The
+// error is a commandError holding the diagnostics.
+func (c *staticChecker) check(tc benchCase, sources []string, hash string) error {
+	key := tc.Target + " " + hash
+	if err, ok := c.seen[key]; ok {
+		return err
+	}
+	err := c.run(tc, sources)
+	if c.seen == nil {
+		c.seen = map[string]error{}
+	}
+	c.seen[key] = err
+	return err
+}
+
+func (c *staticChecker) run(tc benchCase, sources []string) error {
+	env := os.Environ()
+	if tc.Target != "" {
+		env = crossEnv(tc.Target)
+	}
+	goCmd := "go"
+	if tc.Go.Cmd != "" {
+		goCmd = tc.Go.Cmd
+		env = append(env, "GOTOOLCHAIN=local")
+	}
+	cmds := []*exec.Cmd{commandContext(goCmd, append([]string{"vet"}, sources...)...)}
+	if c.staticcheck {
+		cmds = append(cmds, commandContext("staticcheck", sources...))
+	}
+	for _, cmd := range cmds {
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return &commandError{cmd.Args, err, out}
+		}
+	}
+	return nil
+}
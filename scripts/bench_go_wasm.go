@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// -wasm builds every case for WebAssembly as well and runs it in a local
+// wasm runtime, so the wasm backend is timed by the same driver as native
+// code. The harness is built from a plain file list with no module, so the
+// runtime is an installed command rather than an embedded one: Node.js with
+// the Go distribution's wasm_exec_node.js for js/wasm, or a WASI runtime
+// (wazero, wasmtime) for wasip1/wasm.
+
+// wasmRunner runs wasm modules under Runtime.
+type wasmRunner struct {
+	Runtime string
+	Path    string
+	// Loader is wasm_exec_node.js, which node runs the module with
+	Loader string
+}
+
+// addWasmTarget adds the target of -wasm runtime to targets, unless it is
+// already one, with the runner running it.
+func addWasmTarget(runtime string, targets []string, runners map[string]runner) ([]string, error) {
+	wasm, err := newWasmRunner(runtime)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(targets, wasm.target()) {
+		targets = append(targets, wasm.target())
+	}
+	runners[wasm.target()] = wasm
+	return targets, nil
+}
+
+func newWasmRunner(runtime string) (*wasmRunner, error) {
+	switch runtime {
+	case "node", "wazero", "wasmtime":
+	default:
+		return nil, fmt.Errorf("unknown wasm runtime %q (want node, wazero or wasmtime)", runtime)
+	}
+	path, err := exec.LookPath(runtime)
+	if err != nil {
+		return nil, err
+	}
+	w := &wasmRunner{Runtime: runtime, Path: path}
+	if runtime == "node" {
+		goroot, err := exec.Command("go", "env", "GOROOT").Output()
+		if err != nil {
+			return nil, fmt.Errorf("go env GOROOT: %v", err)
+		}
+		// lib/wasm since Go 1.24, misc/wasm before
+		for _, dir := range []string{"lib/wasm", "misc/wasm"} {
+			loader := filepath.Join(strings.TrimSpace(string(goroot)), dir, "wasm_exec_node.js")
+			if _, err := os.Stat(loader); err == nil {
+				w.Loader = loader
+				break
+			}
+		}
+		if w.Loader == "" {
+			return nil, fmt.Errorf("wasm_exec_node.js not found in the Go distribution")
+		}
+	}
+	return w, nil
+}
+
+// target is the GOOS/GOARCH the runtime executes.
+func (w *wasmRunner) target() string {
+	if w.Runtime == "node" {
+		return "js/wasm"
+	}
+	return "wasip1/wasm"
+}
+
+func (w *wasmRunner) prepare(binary, name string) error { return nil }
+
+func (w *wasmRunner) cleanup(binary string) {}
+
+func (w *wasmRunner) local() bool { return true }
+
+// argv passes the settings the way each runtime forwards environment
+// variables to the module: node hands its own environment to the Go
+// runtime, the WASI runtimes take them as flags.
+func (w *wasmRunner) argv(binary string, env, wrap, args []string) []string {
+	argv := append([]string(nil), wrap...)
+	switch w.Runtime {
+	case "node":
+		argv = append(argv, "env")
+		argv = append(argv, env...)
+		argv = append(argv, w.Path, w.Loader)
+	case "wazero":
+		argv = append(argv, w.Path, "run")
+		for _, kv := range env {
+			argv = append(argv, "-env="+kv)
+		}
+	case "wasmtime":
+		argv = append(argv, w.Path, "run")
+		for _, kv := range env {
+			argv = append(argv, "--env", kv)
+		}
+	}
+	return append(append(argv, binary), args...)
+}
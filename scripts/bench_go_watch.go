@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runWatch implements `watch`: the inner loop of backend work. It times a
+// snippet file, or stock cases by name, at a small size, then polls the
+// generator source and the snippet and, whenever they change, generates,
+// builds and times them again and prints each one's change from the
+// previous iteration. Code the change did not affect is marked unchanged,
+// so a delta there is noise.
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	n := fs.Int("n", 10000, "input size to time at")
+	reps := fs.Int("reps", 10, "timed calls per iteration")
+	parallel := fs.Bool("parallel", false, "generate the snippet with --parallel")
+	pcsFlags := fs.String("flags", "", "further pcs options for the snippet, space-separated, e.g. '--mode loops --fuse'")
+	var names, paths []string
+	fs.Func("case", "also time this stock case, named test_mode as in results (repeatable)", func(s string) error {
+		names = append(names, s)
+		return nil
+	})
+	fs.Func("watch", "also watch this file or directory (repeatable; pcs and the snippet are always watched)", func(s string) error {
+		paths = append(paths, s)
+		return nil
+	})
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to look for changes")
+	timeout := fs.Duration("timeout", 30*time.Second, "limit on each generate, compile and benchmark process")
+	cacheDir := fs.String("cache", "target/go_bench_cache", "directory caching generated code and binaries by content hash")
+	once := fs.Bool("once", false, "time one iteration and exit")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pcs-bench watch [flags] [snippet.py]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	if _, err := watchCases(fs.Arg(0), *parallel, strings.Fields(*pcsFlags), names); err != nil {
+		fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+		return 2
+	}
+	if fs.NArg() == 1 {
+		paths = append(paths, fs.Arg(0))
+	}
+	paths = append(paths, "pcs")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runCtx = ctx
+	dir, err := os.MkdirTemp("", "pcs-watch-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	be, _ := lookupBackend("go")
+	goVersion := ""
+	if g, err := resolveGo("go"); err == nil {
+		goVersion = g.Version
+	}
+	previous := map[string]BenchmarkResult{}
+	seen := watchSnapshot(paths)
+	for {
+		// The snippet is reread and the cache reopened, so its generator
+		// hash follows the edits
+		cases, err := watchCases(fs.Arg(0), *parallel, strings.Fields(*pcsFlags), names)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+		}
+		cache, err := openBuildCache(*cacheDir, "pcs")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "watch: -cache: %v\n", err)
+			return 2
+		}
+		for _, tc := range cases {
+			if ctx.Err() != nil {
+				break
+			}
+			result := BenchmarkResult{
+				Backend:   "go",
+				Test:      tc.Test,
+				Mode:      tc.Mode,
+				Parallel:  tc.Parallel,
+				N:         *n,
+				Protocol:  "steady",
+				Toolchain: tc.toolchain(),
+				GoVersion: goVersion,
+			}
+			result = benchSnippet(be, tc, result, dir, cache, runEnv{Timeout: *timeout}, *reps)
+			name := tc.name()
+			prev, hasPrev := previous[name]
+			fmt.Fprintln(os.Stderr, watchLine(name, result, prev, hasPrev))
+			if result.measured() {
+				previous[name] = result
+			}
+		}
+		cache.close()
+		if *once || ctx.Err() != nil {
+			break
+		}
+
+		changed, ok := watchWait(ctx, paths, seen, *interval)
+		if !ok {
+			break
+		}
+		seen = watchSnapshot(paths)
+		fmt.Fprintf(os.Stderr, "\nwatch: changed %s\n", strings.Join(changed, ", "))
+	}
+	return 0
+}
+
+// watchCases are the cases watch times: the snippet in path, if any, and
+// the stock cases names.
+func watchCases(path string, parallel bool, flags, names []string) ([]benchCase, error) {
+	var cases []benchCase
+	if path != "" {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		tc := benchCase{Test: "snippet", Mode: "loops", Parallel: parallel, Code: strings.TrimSpace(string(code)), Flags: flags}
+		if parallel {
+			tc.Mode = "parallel"
+		}
+		cases = append(cases, tc)
+	}
+	stock := map[string]benchCase{}
+	for _, tc := range benchCases() {
+		stock[tc.name()] = tc
+	}
+	for _, name := range names {
+		tc, ok := stock[name]
+		if !ok {
+			return nil, fmt.Errorf("-case %s: no stock case by that name", name)
+		}
+		cases = append(cases, tc)
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("name a snippet file or a -case")
+	}
+	return cases, nil
+}
+
+// watchLine describes one iteration's result for name against the
+// previous one.
+func watchLine(name string, r, prev BenchmarkResult, hasPrev bool) string {
+	if r.Error != "" {
+		return fmt.Sprintf("%-32s  %s: %s", name, r.ErrorClass, firstLine([]byte(r.Error)))
+	}
+	build := "cached"
+	if !r.BuildCached {
+		build = fmt.Sprintf("%.0fms", r.CompileMs)
+	}
+	line := fmt.Sprintf("%-32s  n=%-9d %10s ± %4.1f%%  build %7s", name, r.N, prettyDuration(r.MeanNs), 100*float64(r.StdNs)/float64(max(r.MeanNs, 1)), build)
+	if !hasPrev {
+		return line
+	}
+	line += fmt.Sprintf("  %+6.1f%%", 100*(float64(r.MeanNs)/float64(max(prev.MeanNs, 1))-1))
+	if r.ModuleHash == prev.ModuleHash {
+		line += " (code unchanged)"
+	}
+	return line
+}
+
+// watchSnapshot records the modification time and size of every file
+// under paths, leaving out Python's bytecode caches.
+func watchSnapshot(paths []string) map[string]string {
+	files := map[string]string{}
+	for _, root := range paths {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if d.Name() == "__pycache__" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				files[path] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// watchWait polls paths every interval until they differ from seen and
+// then hold still for an interval, as editors save in several writes, and
+// returns the files that changed; false when ctx ends first.
+func watchWait(ctx context.Context, paths []string, seen map[string]string, interval time.Duration) ([]string, bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last map[string]string
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-ticker.C:
+		}
+		now := watchSnapshot(paths)
+		if watchDiff(seen, now) == nil {
+			last = nil
+			continue
+		}
+		if last != nil && watchDiff(last, now) == nil {
+			return watchDiff(seen, now), true
+		}
+		last = now
+	}
+}
+
+// watchDiff lists the files added, removed or modified between two
+// snapshots.
+func watchDiff(before, after map[string]string) []string {
+	var changed []string
+	for path, stamp := range after {
+		if before[path] != stamp {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
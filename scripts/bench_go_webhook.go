@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// webhookRegression is one regressed result in a webhook payload.
+type webhookRegression struct {
+	Test   string  `json:"test"`
+	Mode   string  `json:"mode"`
+	N      int     `json:"n"`
+	Target string  `json:"target,omitempty"`
+	MeanNs int64   `json:"mean_ns"`
+	Delta  float64 `json:"delta"`
+	// Artifacts is the case's kept artifact directory on the runner
+	Artifacts string `json:"artifacts,omitempty"`
+}
+
+// webhookPayload is what notifyRegressions posts. Text is Slack mrkdwn, so
+// a Slack incoming webhook URL can be used as is; other receivers can read
+// the structured fields.
+type webhookPayload struct {
+	Text        string              `json:"text"`
+	Commit      string              `json:"commit"`
+	RunURL      string              `json:"run_url,omitempty"`
+	Threshold   float64             `json:"threshold"`
+	Total       int                 `json:"total"`
+	Regressions []webhookRegression `json:"regressions"`
+}
+
+// notifyRegressions posts the worst top regressions against base to url,
+// worst first, and returns how many results regressed. Nothing is posted
+// when none did.
+func notifyRegressions(url string, results []BenchmarkResult, base baseline, threshold float64, top int) (int, error) {
+	var regressions []webhookRegression
+	for _, r := range results {
+		d, ok := base.delta(r)
+		if !ok || d <= threshold {
+			continue
+		}
+		w := webhookRegression{Test: r.Test, Mode: r.Mode, N: r.N, Target: r.Target, MeanNs: r.MeanNs, Delta: d}
+		if r.Artifacts != nil {
+			w.Artifacts = r.Artifacts.Dir
+		}
+		regressions = append(regressions, w)
+	}
+	if len(regressions) == 0 {
+		return 0, nil
+	}
+	sort.SliceStable(regressions, func(i, j int) bool { return regressions[i].Delta > regressions[j].Delta })
+
+	p := webhookPayload{Commit: results[0].Commit, RunURL: ciRunURL(), Threshold: threshold, Total: len(regressions)}
+	if top > 0 && len(regressions) > top {
+		p.Regressions = regressions[:top]
+	} else {
+		p.Regressions = regressions
+	}
+	p.Text = p.render()
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return len(regressions), err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return len(regressions), err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return len(regressions), fmt.Errorf("post failed: %s", resp.Status)
+	}
+	return len(regressions), nil
+}
+
+// render is the payload's message text.
+func (p webhookPayload) render() string {
+	var b strings.Builder
+	commit := p.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	fmt.Fprintf(&b, ":warning: %d Go benchmark regression(s) over %.0f%% at `%s`", p.Total, p.Threshold*100, commit)
+	if p.RunURL != "" {
+		fmt.Fprintf(&b, " (<%s|run>)", p.RunURL)
+	}
+	b.WriteString("\n")
+	for _, r := range p.Regressions {
+		fmt.Fprintf(&b, "• %s/%s n=%d: %+.1f%% (%s)", r.Test, r.Mode, r.N, r.Delta*100, time.Duration(r.MeanNs))
+		if r.Target != "" {
+			fmt.Fprintf(&b, " on %s", r.Target)
+		}
+		if r.Artifacts != "" {
+			fmt.Fprintf(&b, ", artifacts in `%s`", r.Artifacts)
+		}
+		b.WriteString("\n")
+	}
+	if more := p.Total - len(p.Regressions); more > 0 {
+		fmt.Fprintf(&b, "…and %d more\n", more)
+	}
+	return b.String()
+}
+
+// ciRunURL links the GitHub Actions run, whose page holds the uploaded
+// artifacts and job summary; empty outside Actions.
+func ciRunURL() string {
+	server, repo, id := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID")
+	if server == "" || repo == "" || id == "" {
+		return ""
+	}
+	return server + "/" + repo + "/actions/runs/" + id
+}
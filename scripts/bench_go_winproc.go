@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// windowsProc runs benchmark processes in the priority class standing for
+// their niceness, set on the process as Windows creates it. A process
+// inherits the affinity mask of the process that starts it, so one is
+// pinned by setting the harness's mask to its CPUs just before starting
+// it, and an unpinned one by restoring the harness's own; processes the
+// harness starts in between, such as builds, run under whichever mask it
+// has. tasklist reports a process's working set; Windows keeps no list of
+// its children, so only its own is counted. Its ProcessState holds CPU
+// times only, so resources are null.
+type windowsProc struct{}
+
+// windowsAffinity is the harness's affinity mask: what it started with,
+// and what it is set to now. mu serializes setting it and starting the
+// process it is set for.
+var windowsAffinity struct {
+	mu      sync.Mutex
+	initial uint64
+	current uint64
+	masks   sync.Map // *exec.Cmd -> the mask start runs it under
+}
+
+// harnessAffinity reads the harness's affinity mask.
+var harnessAffinity = sync.OnceValues(func() (uint64, error) {
+	out, err := powershell(fmt.Sprintf("[int64](Get-Process -Id %d).ProcessorAffinity", os.Getpid()))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(out, 10, 64)
+})
+
+// priorityClasses are the classes -nice selects, by the niceness each
+// stands for. REALTIME_PRIORITY_CLASS, which would starve the harness and
+// the OS, is only ever read.
+var priorityClasses = []struct {
+	name  string
+	nice  int
+	class uint32
+}{
+	{"Idle", 19, 0x00000040},
+	{"BelowNormal", 10, 0x00004000},
+	{"Normal", 0, 0x00000020},
+	{"AboveNormal", -5, 0x00008000},
+	{"High", -10, 0x00000080},
+	{"RealTime", -20, 0},
+}
+
+// windowsNiceness is the harness's niceness, read once: PowerShell takes
+// a good fraction of a second to start.
+var windowsNiceness = sync.OnceValues(func() (int, error) {
+	out, err := powershell(fmt.Sprintf("(Get-Process -Id %d).PriorityClass", os.Getpid()))
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range priorityClasses {
+		if p.name == out {
+			return p.nice, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority class %q", out)
+})
+
+func powershell(script string) (string, error) {
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).Output()
+	if err != nil {
+		return "", fmt.Errorf("powershell: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (windowsProc) rss(pid int) (int64, []int, error) {
+	out, err := exec.Command("tasklist", "/FI", fmt.Sprintf("PID eq %d", pid), "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return 0, nil, err
+	}
+	// "go_bench.exe","1234","Console","1","12,345 K", the number in the
+	// locale's grouping
+	record, err := csv.NewReader(strings.NewReader(string(out))).Read()
+	if err != nil || len(record) < 5 {
+		return 0, nil, fmt.Errorf("no process %d", pid)
+	}
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, record[4])
+	kb, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unreadable working set %q", record[4])
+	}
+	return kb << 10, []int{pid}, nil
+}
+
+func (windowsProc) usage(state *os.ProcessState) *resourceUsage {
+	return &resourceUsage{}
+}
+
+func (windowsProc) niceness() (int, error) {
+	return windowsNiceness()
+}
+
+func (windowsProc) checkNice(current, target int) error {
+	if class := priorityClassOf(target); class == 0 {
+		return fmt.Errorf("niceness %d has no Windows priority class (want 19, 10, 0, -5 or -10)", target)
+	}
+	return nil
+}
+
+func priorityClassOf(nice int) uint32 {
+	for _, p := range priorityClasses {
+		if p.nice == nice {
+			return p.class
+		}
+	}
+	return 0
+}
+
+// checkPinning: an affinity mask has a bit per CPU of the harness's
+// processor group, and the CPUs must be among those it may run on.
+func (windowsProc) checkPinning(cpus []int) error {
+	mask, err := affinityMask(cpus)
+	if err != nil {
+		return err
+	}
+	allowed, err := harnessAffinity()
+	if err != nil {
+		return fmt.Errorf("reading the affinity mask: %v", err)
+	}
+	if mask&allowed != mask {
+		return fmt.Errorf("CPUs %s are not all in the affinity mask %#x", formatCPUList(cpus), allowed)
+	}
+	return nil
+}
+
+func affinityMask(cpus []int) (uint64, error) {
+	var mask uint64
+	for _, c := range cpus {
+		if c >= 64 {
+			return 0, fmt.Errorf("CPU %d is outside the first processor group", c)
+		}
+		mask |= 1 << c
+	}
+	return mask, nil
+}
+
+func (windowsProc) wrap(e runEnv) []string {
+	return nil
+}
+
+// prepare records the mask start runs the process under and sets its
+// priority class in its CreationFlags, a field only Windows' SysProcAttr
+// has.
+func (windowsProc) prepare(cmd *exec.Cmd, e runEnv) {
+	if mask, err := harnessAffinity(); err == nil {
+		if cpus, err := parseCPUList(e.CPUs); err == nil {
+			mask, _ = affinityMask(cpus)
+		}
+		windowsAffinity.masks.Store(cmd, mask)
+	}
+	if e.Nice == 0 {
+		return
+	}
+	current, err := windowsNiceness()
+	class := priorityClassOf(current + e.Nice)
+	if err != nil || class == 0 {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if f := reflect.ValueOf(cmd.SysProcAttr).Elem().FieldByName("CreationFlags"); f.IsValid() {
+		f.SetUint(f.Uint() | uint64(class))
+	}
+}
+
+// start sets the harness's affinity mask to the one prepare recorded for
+// cmd, if it differs, and starts cmd while it holds.
+func (windowsProc) start(cmd *exec.Cmd) error {
+	mask, ok := windowsAffinity.masks.LoadAndDelete(cmd)
+	if !ok {
+		return cmd.Start()
+	}
+	a := &windowsAffinity
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.initial == 0 {
+		a.initial, _ = harnessAffinity()
+		a.current = a.initial
+	}
+	if want := mask.(uint64); want != a.current {
+		script := fmt.Sprintf("(Get-Process -Id %d).ProcessorAffinity = %d", os.Getpid(), want)
+		if _, err := powershell(script); err != nil {
+			return fmt.Errorf("setting the affinity mask: %v", err)
+		}
+		a.current = want
+	}
+	return cmd.Start()
+}
@@ -5,8 +5,34 @@ Julia benchmark runner for PCS - produces NDJSON output
 
 using JSON3, Statistics, Dates
 
+# Untimed calls before measuring, per PCS_BENCH_PROTOCOL (same protocols as
+# the Go driver): "cold" none, "warmup" a fixed PCS_BENCH_WARMUP, "steady"
+# until five calls in a row vary by under 5% (at most 50). The first Julia
+# call includes JIT compilation, so "steady" is the default.
+function warmup(f, protocol, fixed)
+    protocol == "cold" && return 0
+    if protocol == "warmup"
+        for _ in 1:fixed
+            f()
+        end
+        return fixed
+    end
+    window = Float64[]
+    for i in 1:50
+        t1 = time_ns()
+        f()
+        push!(window, time_ns() - t1)
+        length(window) > 5 && popfirst!(window)
+        if length(window) == 5 && std(window; corrected=false) < 0.05 * mean(window)
+            return i
+        end
+    end
+    50
+end
+
 # Simple micro-bench without external deps
-function bench(f, reps=10)
+function bench(f, reps=10; protocol="steady", fixed=3)
+    warmed = warmup(f, protocol, fixed)
     ts = Vector{Float64}(undef, reps)
     for i in 1:reps
         t1 = time_ns()
@@ -14,7 +40,7 @@ function bench(f, reps=10)
         t2 = time_ns()
         ts[i] = (t2 - t1)
     end
-    (; mean=mean(ts), std=std(ts))
+    (; mean=mean(ts), std=std(ts), warmup=warmed)
 end
 
 # Get environment variables
@@ -23,6 +49,8 @@ timestamp = Dates.format(now(UTC), dateformat"yyyy-mm-ddTHH:MM:SSZ")
 os = Sys.KERNEL
 cpu = get(ENV, "CPU_INFO", Sys.CPU_NAME)
 N = parse(Int, get(ENV, "PCS_BENCH_N", "1000000"))
+protocol = get(ENV, "PCS_BENCH_PROTOCOL", "steady")
+fixed_warmup = parse(Int, get(ENV, "PCS_BENCH_WARMUP", "3"))
 
 # Test cases to benchmark
 test_cases = [
@@ -68,7 +96,7 @@ for (test_name, mode, parallel) in test_cases
         include("generated/$(test_name)_$(mode).jl")
 
         # Benchmark the generated function
-        res = bench(() -> PCS_Generated.main(), 10)
+        res = bench(() -> PCS_Generated.main(), 10; protocol=protocol, fixed=fixed_warmup)
 
         # Output NDJSON line
         result = Dict(
@@ -82,7 +110,9 @@ for (test_name, mode, parallel) in test_cases
             "parallel" => parallel,
             "n" => N,
             "mean_ns" => round(Int, res.mean),
-            "std_ns" => round(Int, res.std)
+            "std_ns" => round(Int, res.std),
+            "protocol" => protocol,
+            "warmup_iters" => res.warmup
         )
 
         println(JSON3.write(result))
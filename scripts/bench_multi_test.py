@@ -204,11 +204,16 @@ def run_rust_benchmark(test_case: dict[str, Any], env: dict[str, str]) -> list[s
 def run_go_benchmark(test_case: dict[str, Any], env: dict[str, str]) -> list[str]:
     """Run Go benchmark for a test case"""
     try:
-        # Generate Go code
+        # Generate Go code; *_sharded tests build per-worker shard maps
         cmd = ["python3", "-m", "pcs", "--code", env["PCS_TEST_CODE"], "--target", "go"]
+        if test_case["name"].endswith("_sharded"):
+            cmd.append("--parallel")
 
         result = subprocess.run(cmd, capture_output=True, text=True, env=env)
+        gen_file = GENDIR / f"{test_case['name']}_go.go"
         if result.returncode != 0:
+            # Drop code an older pcs generated, which check-generated builds
+            gen_file.unlink(missing_ok=True)
             return [
                 create_error_result(
                     env, "go", test_case["name"], f"Generation failed: {result.stderr}"
@@ -216,7 +221,6 @@ def run_go_benchmark(test_case: dict[str, Any], env: dict[str, str]) -> list[str
             ]
 
         # Write and compile Go code
-        gen_file = GENDIR / f"{test_case['name']}_go.go"
         with open(gen_file, "w") as f:
             f.write(result.stdout)
 
@@ -7,7 +7,43 @@ const { execSync } = require('child_process');
 const fs = require('fs');
 const path = require('path');
 
-function bench(fn, reps = 10) {
+/**
+ * Untimed calls before measuring, per PCS_BENCH_PROTOCOL (same protocols as
+ * the Go driver): "cold" none, "warmup" a fixed PCS_BENCH_WARMUP, "steady"
+ * until five calls in a row vary by under 5% (at most 50). V8 tiers hot
+ * functions up over the first calls, so "steady" is the default.
+ */
+function warmup(fn, protocol, fixed) {
+    if (protocol === 'cold') {
+        return 0;
+    }
+    if (protocol === 'warmup') {
+        for (let i = 0; i < fixed; i++) {
+            fn();
+        }
+        return fixed;
+    }
+    const window = [];
+    for (let i = 1; i <= 50; i++) {
+        const start = process.hrtime.bigint();
+        fn();
+        window.push(Number(process.hrtime.bigint() - start));
+        if (window.length > 5) {
+            window.shift();
+        }
+        if (window.length === 5) {
+            const mean = window.reduce((a, b) => a + b, 0) / 5;
+            const variance = window.reduce((sum, t) => sum + Math.pow(t - mean, 2), 0) / 5;
+            if (Math.sqrt(variance) < 0.05 * mean) {
+                return i;
+            }
+        }
+    }
+    return 50;
+}
+
+function bench(fn, reps = 10, protocol = 'steady', fixed = 3) {
+    const warmed = warmup(fn, protocol, fixed);
     const times = [];
 
     for (let i = 0; i < reps; i++) {
@@ -21,7 +57,7 @@ function bench(fn, reps = 10) {
     const variance = times.reduce((sum, time) => sum + Math.pow(time - mean, 2), 0) / times.length;
     const std = Math.sqrt(variance);
 
-    return { mean: Math.round(mean), std: Math.round(std) };
+    return { mean: Math.round(mean), std: Math.round(std), warmup: warmed };
 }
 
 function getEnv(key, defaultValue) {
@@ -34,6 +70,8 @@ function main() {
     const os = process.platform;
     const cpu = getEnv('CPU_INFO', process.arch);
     const n = parseInt(getEnv('PCS_BENCH_N', '1000000'));
+    const protocol = getEnv('PCS_BENCH_PROTOCOL', 'steady');
+    const fixedWarmup = parseInt(getEnv('PCS_BENCH_WARMUP', '3'));
 
     // Test cases to benchmark
     const testCases = [
@@ -78,7 +116,7 @@ function main() {
                     }
                 }
                 return sum;
-            }, 10);
+            }, 10, protocol, fixedWarmup);
 
             const benchmarkResult = {
                 commit,
@@ -91,7 +129,9 @@ function main() {
                 parallel,
                 n,
                 mean_ns: result.mean,
-                std_ns: result.std
+                std_ns: result.std,
+                protocol,
+                warmup_iters: result.warmup
             };
 
             console.log(JSON.stringify(benchmarkResult));
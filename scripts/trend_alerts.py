@@ -32,7 +32,8 @@ def load_benchmark_data() -> list[dict[str, Any]]:
                     if line and not line.startswith("#"):
                         try:
                             data = json.loads(line)
-                            if "error" not in data:  # Skip error results
+                            # Skip error results and run headers
+                            if "error" not in data and "record" not in data:
                                 all_data.append(data)
                         except json.JSONDecodeError:
                             continue
@@ -0,0 +1,68 @@
+"""
+C renderer tests: the reductions the cgo runner of pcs-bench times
+"""
+
+import pytest
+
+from pcs.core import PyToIR
+from pcs.renderers.c import render_c
+
+
+def _ir(code: str):
+    return PyToIR().parse(code)
+
+
+class TestReductions:
+    def test_sum(self):
+        out = render_c(_ir("sum(i*i for i in range(1, 100) if i % 2 == 0)"))
+        assert "int64_t program(void) {" in out
+        assert "for (int64_t i = 1; i < 100; i += 1) {" in out
+        assert "if (!(i % 2 == 0)) continue;" in out
+        assert "acc += i * i;" in out
+
+    def test_max_nested(self):
+        out = render_c(_ir("max(i*j for i in range(1, 5) for j in range(i, 10, 2))"))
+        assert "for (int64_t j = i; j < 10; j += 2) {" in out
+        assert "if (!seen || pcs_v > acc) { acc = pcs_v; seen = true; }" in out
+
+    def test_any_all_return_once_decided(self):
+        out = render_c(_ir("any(x > 6 and x < 8 for x in range(10))"))
+        assert "bool program(void) {" in out
+        assert "if (x > 6 && x < 8) return true;" in out
+        assert out.rstrip().endswith("return false;\n}")
+        out = render_c(_ir("all(not x < 0 for x in range(10))"))
+        assert "if (!!(x < 0)) return false;" in out
+
+    def test_expressions(self):
+        out = render_c(_ir("sum(abs(x - 5) + x**2 + (1 if 0 < x < 3 else 0) for x in range(9))"))
+        assert "pcs_abs(x - 5) + x * x + (0 < x && x < 3 ? 1 : 0)" in out
+        assert "static inline int64_t pcs_abs" in out
+        assert "if (!(x != 0)) continue;" in render_c(_ir("sum(x for x in range(9) if x)"))
+
+    def test_negative_step(self):
+        out = render_c(_ir("sum(x for x in range(10, 0, -2))"))
+        assert "for (int64_t x = 10; x > 0; x += -2) {" in out
+
+    def test_seed(self):
+        assert "int64_t acc = 100;" in render_c(_ir("sum((x for x in range(9)), 100)"))
+        assert "int64_t acc = -1;" in render_c(_ir("max((x for x in range(0)), default=-1)"))
+
+
+class TestRejections:
+    @pytest.mark.parametrize(
+        "code",
+        [
+            "[x for x in range(9)]",
+            "{x: x for x in range(9)}",
+            "sum(x for x in data)",
+            "sum(x / 2 for x in range(9))",
+            "sum(x ** y for x in range(9) for y in range(3))",
+        ],
+    )
+    def test_unsupported(self, code):
+        with pytest.raises(ValueError):
+            render_c(_ir(code))
+
+    def test_parallel(self):
+        with pytest.raises(ValueError, match="sequential"):
+            render_c(_ir("sum(x for x in range(9))"), parallel=True)
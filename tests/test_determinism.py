@@ -0,0 +1,112 @@
+#!/usr/bin/env python3
+"""
+Determinism tests: every corpus entry must render byte-for-byte identically
+across runs, so golden files and build caches keyed on generated code stay
+valid.
+
+The corpus is the snippet set from test_golden.py rendered for every target,
+sequential and parallel. Each full pass runs in a fresh interpreter with a
+different PYTHONHASHSEED, which catches set/dict-order and hash() leaks that
+a same-process comparison would miss.
+"""
+
+import difflib
+import json
+import os
+import subprocess
+import sys
+from pathlib import Path
+
+import pytest
+
+from test_golden import (
+    GO_PARALLEL_TEST_CASES,
+    GO_TEST_CASES,
+    PARALLEL_TEST_CASES,
+    SQL_TEST_CASES,
+    TEST_CASES,
+    TYPE_TEST_CASES,
+)
+
+ROOT = Path(__file__).parent.parent
+
+SNIPPETS = sorted(
+    {
+        code
+        for cases in (
+            TEST_CASES,
+            PARALLEL_TEST_CASES,
+            TYPE_TEST_CASES,
+            SQL_TEST_CASES,
+            GO_TEST_CASES,
+            GO_PARALLEL_TEST_CASES,
+        )
+        for code, _, _ in cases
+    }
+)
+
+# Renders the corpus passed on stdin and prints {key: output} as JSON
+_RENDER_CORPUS = """
+import json, sys
+from pcs.core import PyToIR
+from pcs.renderer_api import _BACKENDS, render
+
+out = {}
+for code in json.load(sys.stdin):
+    for target in sorted(_BACKENDS):
+        for parallel in (False, True):
+            key = f"{target} parallel={parallel} {code}"
+            try:
+                out[key] = render(target, PyToIR().parse(code), parallel=parallel)
+            except Exception as e:
+                out[key] = f"error: {type(e).__name__}: {e}"
+print(json.dumps(out))
+"""
+
+
+def render_corpus(hash_seed: str) -> dict:
+    env = dict(os.environ, PYTHONHASHSEED=hash_seed)
+    proc = subprocess.run(
+        [sys.executable, "-c", _RENDER_CORPUS],
+        input=json.dumps(SNIPPETS),
+        capture_output=True,
+        text=True,
+        cwd=ROOT,
+        env=env,
+        check=True,
+    )
+    return json.loads(proc.stdout)
+
+
+@pytest.fixture(scope="module")
+def two_runs():
+    return render_corpus("1"), render_corpus("2")
+
+
+def test_corpus_is_not_empty(two_runs):
+    first, _ = two_runs
+    assert len(first) >= len(SNIPPETS) * 2
+
+
+def test_generation_is_byte_for_byte_deterministic(two_runs):
+    first, second = two_runs
+    assert first.keys() == second.keys()
+
+    diffs = []
+    for key in sorted(first):
+        if first[key] != second[key]:
+            diff = difflib.unified_diff(
+                first[key].splitlines(),
+                second[key].splitlines(),
+                "run 1",
+                "run 2",
+                lineterm="",
+            )
+            diffs.append(f"{key}\n" + "\n".join(diff))
+    assert not diffs, "Nondeterministic output:\n\n" + "\n\n".join(diffs)
+
+
+def test_no_timestamps_in_output(two_runs):
+    first, _ = two_runs
+    for key, output in first.items():
+        assert "Generated on" not in output and "Generated at" not in output, key
@@ -0,0 +1,1970 @@
+"""
+Unit tests for Go renderer emission options.
+"""
+
+import pytest
+
+from pcs.core import PyToIR
+from pcs.renderers.go import (
+    _check_zero_alloc,
+    _size_hint,
+    go_result_shape,
+    render_go,
+    render_go_benchmark,
+    render_go_multi,
+    render_go_package,
+    render_go_pipeline,
+    render_go_stream,
+    render_go_test,
+)
+
+
+def _ir(code: str):
+    return PyToIR().parse(code)
+
+
+class TestMapPresize:
+    """Map results get a size hint when the filtered range length is known."""
+
+    def test_hint_for_modulo_filter(self):
+        ir = _ir("{x: x*x for x in range(1, 100000) if x%3==0}")
+        assert "make(map[int]int, 33333)" in render_go(ir)
+
+    def test_hint_for_unfiltered_set(self):
+        ir = _ir("{x for x in range(10)}")
+        assert "make(map[int]struct{}, 10)" in render_go(ir)
+
+    def test_no_hint_for_unknown_filter(self):
+        ir = _ir("{x: x for x in range(100) if x*x > 50}")
+        assert "make(map[int]int)" in render_go(ir)
+
+    def test_presize_can_be_disabled(self):
+        ir = _ir("{x: x*x for x in range(1, 100) if x%3==0}")
+        assert "make(map[int]int)" in render_go(ir, presize=False)
+
+    def test_size_hint_combines_filters(self):
+        gen = _ir("{x for x in range(0, 60) if x % 2 == 0 if x % 3 != 0}").generators[0]
+        assert _size_hint(gen, 0, 60, 1) == 20
+
+    def test_size_hint_narrows_by_comparisons(self):
+        ir = _ir("[x for x in range(1, 100000) if x % 3 == 0 if x < 5000]")
+        assert _size_hint(ir.generators[0], 1, 100000, 1) == 1667
+        gen = _ir("[x for x in range(100, 0, -7) if 10 < x <= 50]").generators[0]
+        assert _size_hint(gen, 100, 0, -7) == 5
+
+    def test_list_capacity(self):
+        ir = _ir("[x * 2 for x in range(100000) if x > 10]")
+        assert "result := make([]int, 0, 99989)" in render_go(ir)
+        ir = _ir("[x for x in data]")
+        assert "result := make([]int, 0, len(data))" in render_go(ir)
+
+    def test_nested_generators_multiply(self):
+        ir = _ir("{(a, b) for a in range(300) for b in range(400) if b % 2 == 0}")
+        assert "make(map[keyAB]struct{}, 60000)" in render_go(ir)
+        ir = _ir("[a * b for a in range(30) for b in range(a)]")
+        assert "result := make([]int, 0)" in render_go(ir)
+
+
+class TestMapImpl:
+    """Dict comprehensions can target the vendored swissMap runtime."""
+
+    def test_swiss_dict(self):
+        ir = _ir("{x: x*x for x in range(1, 100) if x%3==0}")
+        out = render_go(ir, map_impl="swiss")
+        assert "func program() *swissMap {" in out
+        assert "result := newSwissMap(33)" in out
+        assert "result.Put(x, x * x)" in out
+
+    def test_sync_map(self):
+        ir = _ir("{x: x*x for x in range(1, 100) if x%3==0}")
+        out = render_go(ir, map_impl="sync")
+        assert "func program() *sync.Map {" in out
+        assert "result := new(sync.Map)" in out
+        assert "result.Store(x, x * x)" in out
+
+    def test_sync_map_parallel_has_no_merge(self):
+        ir = _ir("{x: x*x for x in range(1, 100) if x%3==0}")
+        out = render_go(ir, parallel=True, map_impl="sync")
+        assert "result.Store(x, x * x)" in out
+        assert "shards" not in out
+        assert "    return result\n" in out
+
+    def test_sync_map_parallel_needs_loop_variable_key(self):
+        ir = _ir("{x % 3: x for x in range(9)}")
+        with pytest.raises(ValueError):
+            render_go(ir, parallel=True, map_impl="sync")
+
+    def test_sync_map_package_main_prints_entries(self):
+        ir = _ir("{x: x*x for x in range(9)}")
+        out = render_go_package(render_go(ir, map_impl="sync"))
+        assert "program().Range(func(k, v any) bool {" in out
+
+    def test_swiss_ignored_for_sets(self):
+        ir = _ir("{x for x in range(10)}")
+        assert "map[int]struct{}" in render_go(ir, map_impl="swiss")
+
+    def test_unknown_map_impl(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("{x: x for x in range(3)}"), map_impl="btree")
+
+
+class TestShardedDict:
+    """Parallel dict comprehensions build per-worker shards and merge them."""
+
+    CODE = "{x: x*x for x in range(1, 100) if x%3==0}"
+
+    def test_default_merge_is_sized(self):
+        out = render_go(_ir(self.CODE), parallel=True)
+        assert "shards := make([]map[int]int, numWorkers)" in out
+        assert "result := make(map[int]int, size)" in out
+        assert '"sort"' in out
+
+    def test_ordered_merge(self):
+        out = render_go(_ir(self.CODE), parallel=True, shard_merge="ordered")
+        assert "result := make(map[int]int)" in out
+        assert '"sort"' not in out
+
+    def test_adopt_merge(self):
+        out = render_go(_ir(self.CODE), parallel=True, shard_merge="adopt")
+        assert "result := shards[0]" in out
+        assert "range shards[1:]" in out
+
+    def test_unknown_merge_strategy(self):
+        with pytest.raises(ValueError):
+            render_go(_ir(self.CODE), parallel=True, shard_merge="random")
+
+    def test_wrap_returns_read_only_view(self):
+        out = render_go(_ir(self.CODE), parallel=True, shard_merge="wrap")
+        assert "type shardedMap struct {" in out
+        assert "func program() *shardedMap {" in out
+        assert "func (m *shardedMap) Get(k int) (int, bool) {" in out
+        assert '"sort"' not in out
+
+    def test_shards_store_key_and_value(self):
+        out = render_go(_ir(self.CODE), parallel=True)
+        assert "shard[x] = x * x" in out
+        assert "shards[workerID] = shard" in out
+
+    def test_computed_key_merges_in_chunk_order(self):
+        out = render_go(_ir("{x % 3: x for x in range(9)}"), parallel=True)
+        assert "shard[x % 3] = x" in out
+        assert "result := make(map[int]int)" in out
+        assert '"sort"' not in out
+
+    def test_computed_key_cannot_wrap(self):
+        ir = _ir("{x % 3: x for x in range(9)}")
+        with pytest.raises(ValueError):
+            render_go(ir, parallel=True, shard_merge="wrap")
+
+
+class TestFusion:
+    """Several reductions over one range render into one function."""
+
+    CODES = [
+        "sum(i for i in range(1, 100))",
+        "max(x%7 for x in range(1, 100) if x%2==0)",
+        "any(i == 50 for i in range(1, 100))",
+    ]
+
+    def test_separate_passes(self):
+        out = render_go_multi([_ir(c) for c in self.CODES])
+        assert out.count("for i := 1; i < 100; i += 1 {") == 3
+        assert "func program() programResult {" in out
+        assert "    R2 bool" in out
+
+    def test_fused_single_loop(self):
+        out = render_go_multi([_ir(c) for c in self.CODES], fuse=True)
+        assert out.count("for i := 1; i < 100; i += 1 {") == 1
+        # Loop variables are unified and no pass can exit early
+        assert "if v := i % 7; !seen1 || v > res.R1 {" in out
+        assert "break" not in out
+
+    def test_rejects_different_ranges(self):
+        irs = [_ir("sum(i for i in range(10))"), _ir("sum(i for i in range(20))")]
+        with pytest.raises(ValueError, match="same range"):
+            render_go_multi(irs, fuse=True)
+
+    def test_rejects_collections(self):
+        irs = [_ir("sum(i for i in range(10))"), _ir("[i for i in range(10)]")]
+        with pytest.raises(ValueError, match="reduction"):
+            render_go_multi(irs)
+
+
+class TestPipeline:
+    """Named stages compose into one function, materialized or fused."""
+
+    STAGES = [
+        ("evens", "[x*x for x in range(1, 50) if x%2==0]"),
+        ("total", "sum(y%7 for y in evens if y%3==0)"),
+    ]
+
+    def _stages(self, specs):
+        return [(name, _ir(code)) for name, code in specs]
+
+    def test_materialized(self):
+        out = render_go_pipeline(self._stages(self.STAGES))
+        assert "func program() int {" in out
+        assert "evens = append(evens, x * x)" in out
+        assert "for _, y := range evens {" in out
+
+    def test_fused_single_loop(self):
+        out = render_go_pipeline(self._stages(self.STAGES), fuse=True)
+        assert out.count("for ") == 1
+        assert "evens" not in out
+        assert "        y := x * x\n        if !(y % 3 == 0) { continue }" in out
+
+    def test_unused_variable_is_not_bound(self):
+        specs = [("a", "[x for x in range(9)]"), ("n", "sum(1 for y in a)")]
+        assert "for range a {" in render_go_pipeline(self._stages(specs))
+        assert "y :=" not in render_go_pipeline(self._stages(specs), fuse=True)
+
+    def test_stage_must_read_previous(self):
+        specs = [("a", "[x for x in range(9)]"), ("b", "[y for y in c]")]
+        with pytest.raises(ValueError, match="previous stage 'a'"):
+            render_go_pipeline(self._stages(specs))
+
+    def test_intermediate_must_be_sequence(self):
+        specs = [("a", "sum(x for x in range(9))"), ("b", "[y for y in a]")]
+        with pytest.raises(ValueError, match="feeds another stage"):
+            render_go_pipeline(self._stages(specs))
+
+    def test_reserved_name(self):
+        with pytest.raises(ValueError, match="Invalid stage name"):
+            render_go_pipeline(self._stages([("range", "[x for x in range(9)]")]))
+
+
+class TestStream:
+    """Streaming filter programs read stdin and write stdout."""
+
+    def test_complete_program(self):
+        out = render_go_stream(_ir("[x*x for x in xs if x%2==0]"))
+        assert out.startswith("package main\n")
+        assert "func main() {" in out
+        assert "if (x % 2 == 0) {" in out
+        assert "out.write(x * x)" in out
+
+    def test_range_source_is_replaced_by_stdin(self):
+        out = render_go_stream(_ir("sum(i for i in range(10))"))
+        assert "i < 10" not in out
+        assert "readValues(os.Stdin, func(i int) bool {" in out
+
+    def test_binary_format(self):
+        out = render_go_stream(_ir("[x for x in xs]"), stream_format="binary")
+        assert '"encoding/binary"' in out
+        assert '"strconv"' not in out
+
+    def test_any_stops_reading(self):
+        out = render_go_stream(_ir("any(x > 3 for x in xs)"))
+        assert "acc = true\n            return false" in out
+
+    def test_unknown_format(self):
+        with pytest.raises(ValueError):
+            render_go_stream(_ir("[x for x in xs]"), stream_format="csv")
+
+
+class TestNestedComprehension:
+    """Reductions over inner comprehensions become helper functions."""
+
+    def test_inner_sum_is_a_helper(self):
+        out = render_go(_ir("sum(sum(x*y for y in range(1, 9)) for x in range(5))"))
+        assert "acc += programInner0(x)" in out
+        assert "func programInner0(x int) int {" in out
+        assert "for y := 1; y < 9; y += 1 {" in out
+        assert "sum(" not in out
+
+    def test_len_of_list_counts(self):
+        code = "sum(len([x for x in range(9) if x > i]) for i in range(5))"
+        out = render_go(_ir(code))
+        assert "acc += programInner0(i)" in out
+        assert "if !(x > i) { continue }" in out
+
+    def test_deeper_nesting(self):
+        code = "[max(x + sum(z for z in range(y)) for y in range(4)) for x in range(3)]"
+        out = render_go(_ir(code))
+        assert "result = append(result, programInner0(x))" in out
+        assert "func programInner0Inner0(y int) int {" in out
+
+    def test_unsupported_inner_comprehension(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("[sorted([y for y in range(x)]) for x in range(3)]"))
+
+
+class TestPackage:
+    """Functions can be wrapped into a runnable package main."""
+
+    def test_wraps_function(self):
+        out = render_go_package(render_go(_ir("[x for x in range(3)]")))
+        assert out.startswith('package main\n\nimport (\n    "fmt"\n)\n\nfunc ')
+        assert out.endswith("func main() {\n    fmt.Println(program())\n}\n")
+
+    def test_merges_imports(self):
+        code = render_go(_ir("sum(x for x in range(9))"), parallel=True)
+        out = render_go_package(code)
+        assert out.count("import (") == 1
+        assert '    "fmt"\n    "runtime"\n    "sync"\n)' in out
+
+    def test_func_name(self):
+        code = render_go_multi([_ir("sum(x for x in range(9))")], func_name="f")
+        assert "fmt.Println(f())" in render_go_package(code, "f")
+
+    def test_library_package(self):
+        code = render_go(_ir("sum(x for x in range(9))"), parallel=True)
+        out = render_go_package(code, package="metrics")
+        assert out.startswith('package metrics\n\nimport (\n    "runtime"\n')
+        assert '"fmt"' not in out
+        assert "func main()" not in out
+
+    def test_invalid_package_name(self):
+        with pytest.raises(ValueError):
+            render_go_package(render_go(_ir("[x for x in range(3)]")), package="func")
+
+
+class TestResultType:
+    """Reductions can declare their result as another numeric type."""
+
+    def test_sequential(self):
+        out = render_go(_ir("sum(x for x in range(9))"), result_type="int64")
+        assert "func program() int64 {" in out
+        assert "return int64(acc)" in out
+
+    def test_parallel(self):
+        code = "max(x for x in range(9))"
+        out = render_go(_ir(code), parallel=True, result_type="uint32")
+        assert "return uint32(acc)" in out
+
+    def test_collections_are_rejected(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("[x for x in range(9)]"), result_type="int64")
+
+    def test_unknown_type(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("sum(x for x in range(9))"), result_type="big.Int")
+
+
+class TestNumberType:
+    """number_type builds values and accumulators as another numeric type."""
+
+    def test_list_of_sized_ints(self):
+        out = render_go(_ir("[x * 2 for x in range(9)]"), number_type="int32")
+        assert "func program() []int32 {" in out
+        assert "result = append(result, int32(x * 2))" in out
+
+    def test_true_division_of_floats(self):
+        out = render_go(_ir("[x / 2 for x in range(9)]"), number_type="float64")
+        assert "append(result, float64(x) / 2.0)" in out
+
+    def test_float_literal(self):
+        out = render_go(_ir("{x: x * 0.5 for x in range(9)}"), number_type="float32")
+        assert "func program() map[int]float32 {" in out
+        assert "result[x] = float32(x) * 0.5" in out
+
+    def test_set_elements(self):
+        out = render_go(_ir("{x / 4 for x in range(9)}"), number_type="float64")
+        assert "make(map[float64]struct{}, 9)" in out
+
+    def test_reduction_accumulator(self):
+        out = render_go(_ir("sum(x / 3 for x in range(9))"), number_type="float64")
+        assert "func program() float64 {" in out
+        assert "acc := float64(0)" in out
+        assert "return acc" in out
+
+    def test_result_type_converts_accumulator(self):
+        ir = _ir("sum(x for x in range(9))")
+        out = render_go(ir, number_type="int64", result_type="float64")
+        assert "acc := int64(0)" in out
+        assert "return float64(acc)" in out
+
+    def test_parallel_reduction(self):
+        ir = _ir("max(x - 0.5 for x in range(9))")
+        out = render_go(ir, parallel=True, number_type="float32")
+        assert "partials := make([]float32, " in out
+        assert "acc, found := float32(0), false" in out
+
+    def test_grouped_aggregation(self):
+        code = "{k: sum(x for x in range(30) if x % 3 == k) for k in range(3)}"
+        out = render_go(_ir(code), number_type="uint64")
+        assert "func program() map[int]uint64 {" in out
+        assert "result[k] += uint64(x)" in out
+
+    def test_sorted(self):
+        out = render_go(_ir("sorted({x / 2 for x in range(9)})"), number_type="float64")
+        assert "values := make([]float64, 0, len(result))" in out
+
+    def test_any_all_are_rejected(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("any(x > 3 for x in range(9))"), number_type="int64")
+
+    def test_float_modulo_is_rejected(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("[x % 2.5 for x in range(9)]"), number_type="float64")
+
+    def test_helpers_are_rejected(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("[x for x in range(9)]"), emit="helpers", number_type="int8")
+
+    def test_unknown_type(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("[x for x in range(9)]"), number_type="complex128")
+
+    @pytest.mark.parametrize(
+        "code", ["sum(x / 2 for x in range(9))", "[x * 1.5 for x in range(9)]"]
+    )
+    def test_floats_need_a_float_type(self, code):
+        with pytest.raises(ValueError, match="--go-number-type float64"):
+            render_go(_ir(code))
+
+
+class TestIntDivision:
+    """// and % of ints floor as in Python, where Go's / and % truncate."""
+
+    def test_floor_division_of_negative_values(self):
+        out = render_go(_ir("sum(x // 2 for x in range(-6, 2))"))
+        assert "acc += programFloorDiv(x, 2)" in out
+        assert "func programFloorDiv(a, b int) int {" in out
+
+    def test_floor_division_in_a_list(self):
+        out = render_go(_ir("[x // 2 for x in range(-6, 2)]"))
+        assert "result = append(result, programFloorDiv(x, 2))" in out
+
+    def test_modulo_of_negative_values(self):
+        out = render_go(_ir("[x for x in range(10) if (x - 10) % 4 == 3]"))
+        assert "if !(programMod(x - 10, 4) == 3) { continue }" in out
+        assert "func programMod(a, b int) int {" in out
+
+    def test_negative_divisor(self):
+        out = render_go(_ir("{x % -3 for x in range(9)}"))
+        assert "result[programMod(x, -3)] = struct{}{}" in out
+
+    def test_modulo_of_non_negative_values(self):
+        out = render_go(_ir("[x*x % 7 for x in range(1, 9)]"))
+        assert "append(result, x * x % 7)" in out
+        assert "programMod" not in out
+
+    def test_zero_remainder(self):
+        out = render_go(_ir("[x for x in range(-9, 9) if x % 3 != 0]"))
+        assert "if !(x % 3 != 0) { continue }" in out
+        assert "programMod" not in out
+        out = render_go(_ir("any(x % 2 and x > 3 for x in range(-9, 9))"))
+        assert "programMod" not in out
+
+    def test_constants_are_computed(self):
+        out = render_go(_ir("[x + -7 // 2 for x in range(9)]"))
+        assert "append(result, x + -4)" in out
+
+    def test_input_slice(self):
+        out = render_go(_ir("sum(x % 7 for x in data)"))
+        assert "acc += programMod(x, 7)" in out
+
+    def test_number_type(self):
+        out = render_go(_ir("[x // 2 for x in range(-6, 2)]"), number_type="float64")
+        assert "append(result, float64(programFloorDiv(x, 2)))" in out
+
+    def test_multi(self):
+        irs = [
+            _ir("sum(x // 3 for x in range(-9, 9))"),
+            _ir("max(x % 4 for x in range(-9, 9))"),
+        ]
+        out = render_go_multi(irs, fuse=True)
+        assert "res.R0 += programFloorDiv(x, 3)" in out
+        assert "func programMod(a, b int) int {" in out
+
+    def test_stream(self):
+        out = render_go_stream(_ir("[x // 3 for x in data]"))
+        assert "out.write(pyFloorDiv(x, 3))" in out
+        assert "func pyFloorDiv(a, b int) int {" in out
+
+
+class TestOverflow:
+    """overflow checks sum/prod in an int64 instead of letting int wrap."""
+
+    CODE = "sum(i*i for i in range(1, 10**7))"
+
+    def test_wrap_is_the_default(self):
+        out = render_go(_ir(self.CODE))
+        assert "acc += i * i" in out
+        assert "Checked" not in out
+
+    def test_panic(self):
+        out = render_go(_ir(self.CODE), overflow="panic")
+        assert "func program() int64 {" in out
+        assert "v0, ok0 := programCheckedMul(int64(i), int64(i))" in out
+        assert "next, ok := programCheckedAdd(acc, v)" in out
+        assert 'panic("program: sum overflows int64")' in out
+        assert "func programCheckedAdd(a, b int64) (int64, bool) {" in out
+        assert '"math"' in out
+
+    def test_saturate(self):
+        out = render_go(_ir("math.prod(x for x in range(1, 30))"), overflow="saturate")
+        assert "acc := int64(1)" in out
+        assert "acc, _ = programCheckedMul(acc, v)" in out
+        assert "func programCheckedMul(a, b int64) (int64, bool) {" in out
+
+    def test_big(self):
+        out = render_go(_ir(self.CODE), overflow="big")
+        assert "func program() *big.Int {" in out
+        assert "var total *big.Int" in out
+        assert "total = new(big.Int).Add(big.NewInt(acc), big.NewInt(v))" in out
+        assert "return big.NewInt(acc)" in out
+        assert '"math/big"' in out
+
+    def test_parallel_checks_the_merge(self):
+        out = render_go(_ir(self.CODE), parallel=True, overflow="panic")
+        assert "partials := make([]int64, " in out
+        assert "next, ok := programCheckedAdd(acc, p)" in out
+        assert out.count("func programCheckedAdd(") == 1
+
+    def test_values_are_checked(self):
+        # x**5 of 20000 passes int64 before the sum does
+        code = "sum(x*x*x*x*x for x in range(20000, 20001))"
+        out = render_go(_ir(code), overflow="panic")
+        assert "v3, ok3 := programCheckedMul(v2, int64(x))" in out
+        assert "if !(ok0 && ok1 && ok2 && ok3) {" in out
+        assert 'panic("program: value overflows int64")' in out
+        out = render_go(_ir(code), overflow="saturate")
+        assert "v0, _ := programCheckedMul(int64(x), int64(x))" in out
+        out = render_go(_ir("sum(x*x - 3 for x in range(9))"), overflow="panic")
+        assert "v1, ok1 := programCheckedSub(v0, 3)" in out
+        assert "func programCheckedSub(a, b int64) (int64, bool) {" in out
+        out = render_go(_ir(code), parallel=True, overflow="panic")
+        assert "if !(ok0 && ok1 && ok2 && ok3) {" in out
+
+    def test_big_computes_overflowing_values_exactly(self):
+        out = render_go(_ir("sum(x*x*x for x in range(9))"), overflow="big")
+        assert "total = big.NewInt(acc)" in out
+        assert (
+            "total.Add(total, new(big.Int).Mul(new(big.Int).Mul("
+            "big.NewInt(int64(x)), big.NewInt(int64(x))), big.NewInt(int64(x))))"
+        ) in out
+        # Values without arithmetic need no check
+        assert "v := int64(x)\n" in render_go(_ir("sum(x for x in range(9))"), overflow="big")
+
+    def test_big_remainder_of_non_negative_values(self):
+        out = render_go(_ir("sum(x % 7 * x for x in range(9))"), overflow="big")
+        assert "new(big.Int).Rem(big.NewInt(int64(x)), big.NewInt(7))" in out
+
+    @pytest.mark.parametrize(
+        "code",
+        [
+            "sum(x // 2 * x for x in range(9))",
+            "sum(x % 7 * x for x in range(-9, 9))",
+            "sum(x for x in range(-9, 9) if (x - 10) % 4 == 3)",
+        ],
+    )
+    def test_floor_division_is_rejected(self, code):
+        for overflow in ("panic", "saturate", "big"):
+            with pytest.raises(ValueError, match="does not check //"):
+                render_go(_ir(code), overflow=overflow)
+
+    def test_big_has_no_parallel_form(self):
+        with pytest.raises(ValueError):
+            render_go(_ir(self.CODE), parallel=True, overflow="big")
+
+    def test_other_results_are_rejected(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("max(x for x in range(9))"), overflow="panic")
+        with pytest.raises(ValueError):
+            render_go(_ir("[x for x in range(9)]"), overflow="saturate")
+
+    def test_unknown_mode(self):
+        with pytest.raises(ValueError):
+            render_go(_ir(self.CODE), overflow="clamp")
+
+
+class TestReturnError:
+    """return_error=True returns run-time problems as an error."""
+
+    def test_signature_and_recover(self):
+        out = render_go(_ir("[100 % x for x in data]"), return_error=True)
+        assert "func program(data []int) (_ []int, err error) {" in out
+        assert "if r := recover(); r != nil {" in out
+        assert 'err = fmt.Errorf("program: %v", r)' in out
+        assert "return result, nil" in out
+        assert '"fmt"' in out
+
+    def test_overflow_is_returned(self):
+        ir = _ir("sum(i*i for i in range(1, 10**7))")
+        out = render_go(ir, overflow="panic", return_error=True)
+        assert 'return 0, errors.New("program: sum overflows int64")' in out
+        assert "panic(" not in out
+        assert "return acc, nil" in out
+        # the helper after the function keeps its own returns
+        assert "return c, true" in out
+
+    def test_imports_are_merged(self):
+        out = render_go(_ir("sorted({x for x in range(9)})"), return_error=True)
+        assert out.startswith('import (\n    "fmt"\n    "slices"\n)\n')
+        assert "// program returns its values in ascending order.\n" in out
+
+    def test_package_main_reports_the_error(self):
+        code = render_go(_ir("[x for x in range(3)]"), return_error=True)
+        out = render_go_package(code)
+        assert "    result, err := program()" in out
+        assert "        fmt.Fprintln(os.Stderr, err)" in out
+
+    def test_parallel_needs_errgroup(self):
+        ir = _ir("sum(x for x in range(9))")
+        with pytest.raises(ValueError):
+            render_go(ir, parallel=True, return_error=True)
+        out = render_go(ir, parallel=True, parallel_style="errgroup", return_error=True)
+        assert "(int, error)" in out
+
+    def test_other_emission_is_rejected(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("[x for x in range(3)]"), emit="iter", return_error=True)
+
+
+class TestHelperEmission:
+    """emit="helpers" calls into pcs/backends/go/pcs_helpers.go."""
+
+    def test_reduction(self):
+        code = "sum(i*i for i in range(1, 9) if i%2==0)"
+        out = render_go(_ir(code), emit="helpers", optimize=False)
+        assert out.startswith("// Requires pcs_helpers.go")
+        assert "xs := Range(1, 9, 1)" in out
+        assert "xs = Filter(xs, func(i int) bool { return i % 2 == 0 })" in out
+        assert "return Sum(Map(xs, func(i int) int { return i * i }))" in out
+
+    def test_dict_uses_key_and_value(self):
+        out = render_go(_ir("{x: x*x for x in range(5)}"), emit="helpers")
+        assert "return MapKV(xs, func(x int) (int, int) { return x, x * x })" in out
+
+    def test_identity_element_is_not_mapped(self):
+        out = render_go(_ir("[x for x in range(5) if x > 1]"), emit="helpers")
+        assert "return xs\n" in out
+
+    def test_result_type(self):
+        ir = _ir("max(x for x in range(5))")
+        out = render_go(ir, emit="helpers", result_type="int64")
+        assert "return int64(Max(xs))" in out
+
+    def test_no_parallel_form(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("sum(x for x in range(5))"), parallel=True, emit="helpers")
+
+
+class TestIterEmission:
+    """emit="iter" renders lazy iter.Seq/iter.Seq2 iterators."""
+
+    def test_list(self):
+        out = render_go(_ir("[i*i for i in range(1, 9) if i%2==0]"), emit="iter")
+        assert '"iter"' in out
+        assert "func program() iter.Seq[int] {" in out
+        assert "if !yield(i * i) { return }" in out
+
+    def test_dict_is_seq2(self):
+        out = render_go(_ir("{x: x*x for x in range(5)}"), emit="iter")
+        assert "func program() iter.Seq2[int, int] {" in out
+        assert "if !yield(x, x * x) { return }" in out
+
+    def test_set_skips_duplicates(self):
+        out = render_go(_ir("{x % 3 for x in range(9)}"), emit="iter")
+        assert "seen := make(map[int]struct{})" in out
+        assert "if _, dup := seen[v]; dup { continue }" in out
+
+    def test_reduction_ranges_over_seq(self):
+        ir = _ir("sum(x for x in range(5))")
+        out = render_go(ir, emit="iter", result_type="int64")
+        assert "func programSeq() iter.Seq[int] {" in out
+        assert "for v := range programSeq() {" in out
+        assert "return int64(acc)" in out
+
+    def test_package_collects(self):
+        out = render_go_package(render_go(_ir("[x for x in range(3)]"), emit="iter"))
+        assert "fmt.Println(slices.Collect(program()))" in out
+        assert '"slices"' in out
+
+    def test_no_parallel_form(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("[x for x in range(5)]"), parallel=True, emit="iter")
+
+
+class TestParallel:
+    """parallel=True reduces one chunk per GOMAXPROCS into local partials."""
+
+    def test_reduction_combines_partials(self):
+        out = render_go(_ir("sum(i*i for i in range(1, 9) if i%2==0)"), parallel=True)
+        assert "numWorkers := runtime.GOMAXPROCS(0)" in out
+        assert "partials := make([]int, numWorkers)" in out
+        assert "wg.Wait()" in out
+        assert "acc += p" in out
+        assert "{{" not in out
+
+    def test_list_keeps_chunk_order(self):
+        out = render_go(_ir("[x*x for x in range(10)]"), parallel=True)
+        assert "part := make([]int, 0, hi-lo)" in out
+        assert "part = append(part, x * x)" in out
+        assert "result = append(result, part...)" in out
+
+    def test_max_skips_empty_chunks(self):
+        out = render_go(_ir("max(x % 7 for x in range(100))"), parallel=True)
+        assert "seen[workerID] = found" in out
+        assert "if !seen[w] { continue }" in out
+
+    def test_all_stops_at_first_failure(self):
+        out = render_go(_ir("all(x < 5 for x in range(10))"), parallel=True)
+        assert "acc := true" in out
+        assert "if !p { return false }" in out
+        assert out.rstrip().endswith("return true\n}")
+
+
+class TestErrgroup:
+    """parallel_style="errgroup" takes a context and returns worker errors."""
+
+    def test_signature_and_imports(self):
+        ir = _ir("sum(x for x in range(9))")
+        out = render_go(ir, parallel=True, parallel_style="errgroup")
+        assert "func program(ctx context.Context) (int, error) {" in out
+        assert '    "golang.org/x/sync/errgroup"\n' in out
+        assert '"sync"' not in out
+        assert "return acc, nil" in out
+
+    def test_panics_become_errors(self):
+        ir = _ir("[x for x in range(9)]")
+        out = render_go(ir, parallel=True, parallel_style="errgroup")
+        assert "if r := recover(); r != nil {" in out
+        assert "if err := g.Wait(); err != nil {\n        return nil, err" in out
+
+    def test_workers_stop_on_cancel(self):
+        ir = _ir("{x: x*x for x in range(9)}")
+        out = render_go(ir, parallel=True, parallel_style="errgroup")
+        assert "g, ctx := errgroup.WithContext(ctx)" in out
+        assert "ctx.Err() != nil { return ctx.Err() }" in out
+
+    def test_package_main_reports_error(self):
+        ir = _ir("any(x > 5 for x in range(9))")
+        out = render_go_package(render_go(ir, parallel=True, parallel_style="errgroup"))
+        assert "result, err := program(context.Background())" in out
+        assert '    "context"\n' in out and '    "os"\n' in out
+
+    def test_needs_parallel(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("sum(x for x in range(9))"), parallel_style="errgroup")
+
+
+class TestWorkerPool:
+    """parallel_style="pool" drains chunks with a given number of workers."""
+
+    def test_workers_parameter(self):
+        ir = _ir("sum(x for x in range(9))")
+        out = render_go(ir, parallel=True, parallel_style="pool")
+        assert "func program(workers int) int {" in out
+        assert "if workers < 1 { workers = runtime.GOMAXPROCS(0) }" in out
+        assert "for w := 0; w < workers; w++ {" in out
+
+    def test_chunks_from_channel(self):
+        ir = _ir("[x for x in range(9)]")
+        out = render_go(ir, parallel=True, parallel_style="pool")
+        assert "chunks := make(chan chunk, numChunks)" in out
+        assert "for c := range chunks {" in out
+        assert "partials[c.id] = part" in out
+
+    def test_sharded_dict(self):
+        ir = _ir("{x: x*x for x in range(9)}")
+        out = render_go(ir, parallel=True, parallel_style="pool")
+        assert "shards := make([]map[int]int, numChunks)" in out
+        assert "shards[c.id] = shard" in out
+
+    def test_package_main_uses_default(self):
+        ir = _ir("sum(x for x in range(9))")
+        out = render_go_package(render_go(ir, parallel=True, parallel_style="pool"))
+        assert "fmt.Println(program(0))" in out
+
+
+class TestAutoChunks:
+    """chunking="auto" sizes parallel chunks at run time."""
+
+    def test_minimum_chunk(self):
+        ir = _ir("sum(x for x in range(100))")
+        out = render_go(ir, parallel=True, chunking="auto")
+        assert "if chunkSize < 4096 { chunkSize = 4096 }" in out
+        assert "numWorkers = (total + chunkSize - 1) / chunkSize" in out
+        assert "partials := make([]int, numWorkers)" in out
+
+    def test_pool_caps_workers(self):
+        ir = _ir("{x: x for x in range(100)}")
+        out = render_go(ir, parallel=True, parallel_style="pool", chunking="auto")
+        assert "numChunks = (total + chunkSize - 1) / chunkSize" in out
+        assert "if workers > numChunks { workers = numChunks }" in out
+
+    def test_even_unchanged(self):
+        ir = _ir("sum(x for x in range(100))")
+        assert render_go(ir, parallel=True) == render_go(
+            ir, parallel=True, chunking="even"
+        )
+
+    def test_needs_parallel(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("sum(x for x in range(100))"), chunking="auto")
+        with pytest.raises(ValueError):
+            render_go(_ir("sum(x for x in range(100))"), parallel=True, chunking="x")
+
+
+
+class TestZeroAlloc:
+    """zero_alloc=True keeps scalar reductions off the heap."""
+
+    def test_loop_unchanged(self):
+        ir = _ir("sum(x * x for x in range(100) if x % 2 == 0)")
+        assert render_go(ir, zero_alloc=True) == render_go(ir)
+
+    def test_rejected_irs(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("[x for x in range(5)]"), zero_alloc=True)
+        with pytest.raises(ValueError):
+            render_go(_ir("sum(x for x in range(5))"), parallel=True, zero_alloc=True)
+        with pytest.raises(ValueError):
+            render_go(_ir("sum(x for x in range(5))"), emit="iter", zero_alloc=True)
+        with pytest.raises(ValueError):
+            render_go(_ir("sum(x for x in range(5))"), overflow="big", zero_alloc=True)
+
+    def test_heap_constructs(self):
+        _check_zero_alloc("func program() int {\n    return 0\n}")
+        with pytest.raises(ValueError, match=r"append \(line 2\)"):
+            _check_zero_alloc("func program() int {\n    xs = append(xs, 1)\n}")
+        with pytest.raises(ValueError, match="a map"):
+            _check_zero_alloc("var seen map[int]bool")
+
+    def test_allocs_test(self):
+        fragment = render_go(_ir("sum(x for x in range(100))"), zero_alloc=True)
+        out = render_go_benchmark(fragment, zero_alloc=True)
+        assert "func TestProgramAllocs(t *testing.T) {" in out
+        assert "testing.AllocsPerRun(100, func() { benchmarkProgramSink = program() })" in out
+        assert "TestProgramAllocs" not in render_go_benchmark(fragment)
+
+class TestReduceInitial:
+    """sum()/math.prod() start and max()/min() default= seed the accumulator."""
+
+    def test_parsed(self):
+        assert _ir("sum((x for x in range(5)), 10)").reduce.initial == "10"
+        assert _ir("sum((x for x in range(5)), start=-1)").reduce.initial == "-1"
+        assert _ir("math.prod((x for x in range(1, 5)), start=2)").reduce.initial == "2"
+        assert _ir("max((x for x in range(5)), default=0)").reduce.initial == "0"
+        assert _ir("min(x for x in range(5))").reduce.initial is None
+        with pytest.raises(ValueError, match="keyword"):
+            _ir("max((x for x in range(5)), key=abs)")
+        with pytest.raises(ValueError, match="keyword"):
+            _ir("any((x > 2 for x in range(5)), default=True)")
+
+    def test_loops(self):
+        assert "acc := 10\n" in render_go(_ir("sum((x for x in range(5)), 10)"))
+        out = render_go(_ir("max((x for x in range(0)), default=-1)"))
+        assert "acc := -1\n    seen := false" in out
+        assert "panic" not in render_go(_ir("max((x for x in range(0)), default=-1)"), empty="panic")
+        out = render_go(_ir("sum((x for x in range(5)), 10)"), number_type="int64")
+        assert "acc := int64(10)" in out
+
+    def test_empty_panic(self):
+        ir = _ir("min(x for x in range(0))")
+        assert "panic" not in render_go(ir)
+        check = '    if !seen { panic("min() iterable argument is empty") }\n    return acc'
+        assert check in render_go(ir, empty="panic")
+        assert check in render_go(ir, emit="iter", empty="panic")
+        out = render_go(ir, parallel=True, empty="panic")
+        assert 'if !found { panic("min() iterable argument is empty") }' in out
+        with pytest.raises(ValueError, match="max/min"):
+            render_go(_ir("sum(x for x in range(0))"), empty="panic")
+        with pytest.raises(ValueError):
+            render_go(ir, empty="raise")
+
+    def test_parallel_merge(self):
+        out = render_go(_ir("sum((x for x in range(100)), 7)"), parallel=True)
+        # Workers sum from 0; the start is added once, in the merge
+        assert "            acc := 0\n" in out
+        assert "    acc := 7\n    for _, p := range partials {" in out
+        out = render_go(_ir("max((x for x in range(100)), default=5)"), parallel=True)
+        assert "acc, found := 5, false" in out
+
+    def test_streaming_and_checked(self):
+        assert "acc := 7" in render_go(_ir("sum((x for x in range(9)), 7)"), emit="chan")
+        out = render_go(_ir("sum((x for x in range(9)), 7)"), overflow="panic")
+        assert "acc := int64(7)" in out
+        with pytest.raises(ValueError, match="helpers"):
+            render_go(_ir("sum((x for x in range(9)), 7)"), emit="helpers")
+
+    def test_int_literal_only(self):
+        with pytest.raises(ValueError, match="int literal"):
+            render_go(_ir("sum((x for x in range(9)), n)"))
+        assert "acc := -8" in render_go(_ir("sum((x for x in range(9)), -2**3)"))
+
+    def test_fold(self):
+        out = render_go(_ir("sum((x for x in range(100)), 7)"), fold="const")
+        assert "return 4957" in out
+        out = render_go(_ir("max((x for x in range(0)), default=5)"), fold="const")
+        assert "return 5" in out
+        with pytest.raises(ValueError, match="no values"):
+            render_go(_ir("max(x for x in range(0))"), fold="const")
+
+    def test_multi_and_pipeline(self):
+        irs = [_ir("sum((x for x in range(9)), 7)"), _ir("max((x for x in range(9)), default=-3)")]
+        out = render_go_multi(irs, fuse=True)
+        assert "res.R0 = 7\n    res.R1 = -3\n    seen1 := false" in out
+        # Without a start nothing changes
+        plain = render_go_multi([_ir("sum(x for x in range(9))"), _ir("all(x for x in range(9))")])
+        assert "res.R0" not in plain.split("for")[0]
+        assert "res.R1 = true" in plain
+        stages = [("a", _ir("[x for x in range(9)]")), ("t", _ir("sum((y for y in a), 100)"))]
+        assert "result := 100" in render_go_pipeline(stages)
+
+    def test_go_test_reference(self):
+        out = render_go_test(
+            render_go(_ir("max((x for x in range(3, 3)), default=9)")),
+            _ir("max((x for x in range(3, 3)), default=9)"),
+        )
+        assert "want := 9" in out
+
+
+class TestTupleKeys:
+    """Tuple dict keys become a comparable struct type."""
+
+    def test_named_fields(self):
+        out = render_go(_ir("{(x, y): x * y for x in range(3) for y in range(4)}"))
+        assert "type keyXY struct {\n    x, y int\n}" in out
+        assert "func program() map[keyXY]int {" in out
+
+    def test_expression_fields(self):
+        out = render_go(_ir("{(x, x % 3): x for x in range(9)}"))
+        assert "type key2 struct {\n    f0, f1 int\n}" in out
+        assert "result := make(map[key2]int, 9)" in out
+        assert "result[key2{x, x % 3}] = x" in out
+
+    def test_parallel_shards(self):
+        out = render_go(_ir("{(x, x % 3): x for x in range(9)}"), parallel=True)
+        assert "shards := make([]map[key2]int, numWorkers)" in out
+        assert "shard[key2{x, x % 3}] = x" in out
+        assert "result := make(map[key2]int)" in out
+
+    def test_loops_only(self):
+        ir = _ir("{(x, x % 3): x for x in range(9)}")
+        with pytest.raises(ValueError):
+            render_go(ir, emit="iter")
+        with pytest.raises(ValueError):
+            render_go(ir, map_impl="swiss")
+
+    def test_list_elements_are_rejected(self):
+        ir = _ir("[(x, y) for x in range(3) for y in range(2)]")
+        with pytest.raises(ValueError, match=r"only as the keys .*: \(x, y\)"):
+            render_go(ir)
+        with pytest.raises(ValueError):
+            render_go(_ir("[[(x, y) for y in range(2)] for x in range(3)]"))
+        with pytest.raises(ValueError):
+            render_go_stream(_ir("[(x, x) for x in data]"))
+
+    def test_dict_values_are_rejected(self):
+        ir = _ir("{x: (x, x + 1) for x in range(3)}")
+        with pytest.raises(ValueError, match=r"only as the keys .*: \(x, x \+ 1\)"):
+            render_go(ir)
+
+
+class TestBooleanFilters:
+    """Filters become short-circuiting Go conditions."""
+
+    def test_and_or_not(self):
+        code = "[x for x in range(30) if (x > 2 or x < 1) and not x == 5]"
+        out = render_go(_ir(code))
+        assert "if !((x > 2 || x < 1) && !(x == 5)) { continue }" in out
+
+    def test_chained_clauses(self):
+        code = "[x for x in range(30) if x > 2 if x % 3 == 0]"
+        out = render_go(_ir(code), optimize=False)
+        assert "if !(x > 2) { continue }\n        if !(x % 3 == 0) { continue }" in out
+
+    def test_chained_comparison(self):
+        out = render_go(_ir("sum(x for x in range(30) if 2 < x < 20)"))
+        assert "if !(2 < x && x < 20) { continue }" in out
+
+    def test_int_truth(self):
+        out = render_go(_ir("[x for x in range(30) if x % 3 and not x % 5]"))
+        assert "if !(x % 3 != 0 && x % 5 == 0) { continue }" in out
+        out = render_go(_ir("{x for x in range(9) if True}"))
+        assert "if !(true) { continue }" in out
+
+    def test_other_methods_are_ints(self):
+        out = render_go(_ir("[x for x in range(9) if x.Isolate()]"))
+        assert "if !(x.Isolate() != 0) { continue }" in out
+
+    def test_bool_helpers(self):
+        code = "[x for x in range(9) if not any(y > 3 for y in range(x))]"
+        out = render_go(_ir(code))
+        assert "if !(!programInner0(x)) { continue }" in out
+        code = "[x for x in range(9) if sum(y for y in range(x))]"
+        assert "if !(programInner0(x) != 0) { continue }" in render_go(_ir(code))
+
+    def test_parallel_and_streams(self):
+        code = "[x for x in range(30) if x > 2 and x % 4]"
+        out = render_go(_ir(code), parallel=True)
+        assert "if !(x > 2 && x % 4 != 0) { continue }" in out
+        assert "x > 2 and" not in render_go_stream(_ir(code))
+
+
+class TestConditionalExpressions:
+    """`a if cond else b` becomes a helper choosing its branch with an if."""
+
+    def test_element(self):
+        out = render_go(_ir("[x if x > 3 else -x for x in range(10)]"))
+        assert "result = append(result, programCond0(x))" in out
+        assert (
+            "func programCond0(x int) int {\n"
+            "    if x > 3 { return x }\n"
+            "    return -x\n"
+            "}\n"
+        ) in out
+
+    def test_nested_and_int_test(self):
+        code = "[(a if a > b else b) if a else 7 for a in range(4) for b in range(3)]"
+        out = render_go(_ir(code))
+        assert "func programCond0(a, b int) int {" in out
+        assert "    if a != 0 { return programCond0(a, b) }" in out
+        assert "result = append(result, programCond1(a, b))" in out
+
+    def test_condition_branches(self):
+        code = "[x for x in range(9) if (x > 2 if x % 2 else x < 1)]"
+        out = render_go(_ir(code))
+        assert "func programCond0(x int) bool {" in out
+        assert "if !(programCond0(x)) { continue }" in out
+
+    def test_inner_comprehension_branch(self):
+        code = "[sum(y for y in range(x)) if x % 2 == 0 else -1 for x in range(6)]"
+        out = render_go(_ir(code))
+        assert "    if x % 2 == 0 { return programInner0(x) }" in out
+
+    def test_parallel_dict_value(self):
+        out = render_go(_ir("{x: 1 if x > 5 else 0 for x in range(10)}"), parallel=True)
+        assert "programCond0(x)" in out and "func programCond0(x int) int {" in out
+
+    def test_mixed_branches_rejected(self):
+        with pytest.raises(ValueError, match="both be conditions"):
+            render_go(_ir("[x > 2 if x else 0 for x in range(9)]"))
+
+
+class TestReductions:
+    """Sequential loops reduce with Python's semantics for every kind."""
+
+    def test_prod(self):
+        for code in ("math.prod(x for x in range(1, 6))", "prod(x for x in data)"):
+            out = render_go(_ir(code))
+            assert "    acc := 1\n" in out
+            assert "acc *= x" in out
+
+    def test_max_min_track_seen(self):
+        out = render_go(_ir("max(-x for x in range(1, 9))"))
+        assert "    seen := false\n" in out
+        assert "if v := -x; !seen || v > acc {" in out
+        assert "v < acc" in render_go(_ir("min(x for x in range(1, 9))"))
+
+    def test_any_all_break_when_decided(self):
+        out = render_go(_ir("any(x > 3 for x in range(9))"))
+        assert "    acc := false\n" in out
+        assert "            acc = true\n            break\n" in out
+        out = render_go(_ir("all(x < 3 for x in range(9))"))
+        assert "    acc := true\n" in out
+        assert "        if !(x < 3) {\n            acc = false\n" in out
+        assert out.endswith("    return acc\n}\n")
+
+    def test_nested_any_breaks_outer_loop(self):
+        out = render_go(_ir("any(i * j == 6 for i in range(9) for j in range(9))"))
+        assert "    values: for i := 0; i < 9; i += 1 {" in out
+        assert "break values" in out
+
+    def test_other_calls_rejected(self):
+        with pytest.raises(ValueError, match="Unsupported function call"):
+            _ir("numpy.prod(x for x in range(3))")
+
+
+class TestGroupedAggregation:
+    """A dict of reductions keyed by a group filter is built in one pass."""
+
+    def test_single_pass(self):
+        code = "{k: sum(x for x in range(100) if x % 10 == k) for k in range(10)}"
+        out = render_go(_ir(code))
+        assert "func program() map[int]int {" in out
+        assert "    for k := 0; k < 10; k += 1 {\n        result[k] = 0\n" in out
+        assert "        k := x % 10\n" in out
+        assert "if _, ok := result[k]; !ok { continue }" in out
+        assert "        result[k] += x\n" in out
+        assert "Inner" not in out
+
+    def test_reductions_and_filters(self):
+        out = render_go(
+            _ir("{k: max(-x for x in data if x > 3 if k == x % 7) for k in keys}")
+        )
+        assert "func program(keys, data []int) map[int]int {" in out
+        assert "    seen := make(map[int]bool, len(result))\n" in out
+        assert "        if !(x > 3) { continue }\n        k := programMod(x, 7)\n" in out
+        code = "{k: all(x < 9 for x in range(20) if x % 3 == k) for k in range(3)}"
+        out = render_go(_ir(code))
+        assert "map[int]bool" in out
+        assert "result[k] = result[k] && (x < 9)" in out
+        code = "{k: len([x for x in range(20) if x % 3 == k]) for k in range(3)}"
+        out = render_go(_ir(code))
+        assert "result[k] += 1" in out
+
+    def test_other_shapes_use_helpers(self):
+        for code in (
+            "{k: sum(x for x in range(9) if x > k) for k in range(3)}",
+            "{k: sum(x * k for x in range(9) if x % 3 == k) for k in range(3)}",
+            "{k + 1: sum(x for x in range(9) if x % 3 == k) for k in range(3)}",
+        ):
+            assert "programInner0" in render_go(_ir(code))
+        code = "{k: sum(x for x in range(9) if x % 3 == k) for k in range(3)}"
+        assert "programInner0" in render_go(_ir(code), parallel=True)
+
+
+class TestInputSlices:
+    """A generator over a name iterates a []int the caller passes in."""
+
+    def test_parameter_and_range_loop(self):
+        out = render_go(_ir("[x * 2 for x in data if x % 3]"))
+        assert "func program(data []int) []int {" in out
+        assert "for _, x := range data {" in out
+
+    def test_unused_variable_dropped(self):
+        out = render_go(_ir("sum(1 for x in data)"))
+        assert "for range data {" in out
+
+    def test_several_slices_and_presize(self):
+        out = render_go(_ir("{x: y for x in xs for y in ys if y > x}"))
+        assert "func program(xs, ys []int) map[int]int {" in out
+        assert "        for _, y := range ys {" in out
+        assert "make(map[int]int, len(data))" in render_go(_ir("{x: 1 for x in data}"))
+
+    def test_emissions(self):
+        ir = _ir("sum(x for x in data if x > 2)")
+        assert "xs := data" in render_go(ir, emit="helpers")
+        out = render_go(ir, emit="iter")
+        assert "func programSeq(data []int) iter.Seq[int] {" in out
+        assert "for v := range programSeq(data) {" in out
+        out = render_go(ir, emit="chan")
+        assert "func programTo(out chan<- int, data []int) {" in out
+        assert "programTo(out, data)" in out
+
+    def test_program_reads_stdin(self):
+        out = render_go_package(render_go(_ir("[x for x in data]")))
+        assert "    data := readInput()\n    fmt.Println(program(data))\n" in out
+        assert "func readInput() []int {" in out
+        assert '"encoding/json"' in out
+        with pytest.raises(ValueError, match="one input slice"):
+            render_go_package(render_go(_ir("[x + y for x in xs for y in ys]")))
+
+    def test_parallel_rejected(self):
+        with pytest.raises(ValueError, match="constant outer range"):
+            render_go(_ir("sum(x for x in data)"), parallel=True)
+
+
+class TestRangeSteps:
+    """Loops count down on a negative step and test a run-time step's sign."""
+
+    def test_constant_bounds(self):
+        assert _ir("[x for x in range(100, 0, -2)]").generators[0].source.step == -2
+        source = _ir("sum(x for x in range(10**3, 2**5, -(3 * 3)))").generators[0]
+        assert (source.source.start, source.source.stop) == (1000, 32)
+
+    def test_negative_step(self):
+        out = render_go(_ir("[x for x in range(100, 0, -2)]"))
+        assert "for x := 100; x > 0; x += -2 {" in out
+
+    def test_parallel_chunks_count_down(self):
+        out = render_go(_ir("sum(x for x in range(100, 0, -2))"), parallel=True)
+        assert "for x := 100 + lo*-2; x > 100 + hi*-2; x += -2 {" in out
+        code = "{x: x for x in range(100, 0, -2)}"
+        out = render_go(_ir(code), parallel=True, shard_merge="wrap")
+        assert "if k > 100 || (k-100)%-2 != 0 { return 0, false }" in out
+
+    def test_runtime_step(self):
+        code = "[y for x in range(-2, 3) if x for y in range(0, 7 * x, x)]"
+        out = render_go(_ir(code))
+        assert (
+            "for y := 0; x > 0 && y < 7 * x || x < 0 && y > 7 * x; y += x {" in out
+        )
+        code = "[sum(y for y in range(10, 0, -x)) for x in range(1, 4)]"
+        assert "-x > 0 && y < 0 || -x < 0 && y > 0; y += -x" in render_go(_ir(code))
+
+    def test_emissions(self):
+        ir = _ir("sum(x for x in range(9, 0, -3))")
+        assert "Range(9, 0, -3)" in render_go(ir, emit="helpers")
+        assert "for x := 9; x > 0; x += -3 {" in render_go(ir, emit="iter")
+        assert "for x := 9; x > 0; x += -3 {" in render_go_multi([ir, ir], fuse=True)
+
+    def test_zero_step_rejected(self):
+        with pytest.raises(ValueError, match="must not be zero"):
+            render_go(_ir("[x for x in range(3, 9, 0)]"))
+        with pytest.raises(ValueError, match="must not be zero"):
+            render_go(_ir("[y for x in range(3) for y in range(x, 9, 0)]"))
+
+
+class TestZipEnumerate:
+    """zip() and enumerate() of ranges loop over the index of their values."""
+
+    def test_zip_stops_at_shortest(self):
+        out = render_go(_ir("[a + b for a, b in zip(range(5), range(3, 9))]"))
+        assert "for i := 0; i < 5; i += 1 {" in out
+        assert "result = append(result, i + (3 + i))" in out
+
+    def test_zip_steps(self):
+        code = "{a: b for a, b in zip(range(0, 20, 3), range(10, 0, -1))}"
+        out = render_go(_ir(code))
+        assert "for i := 0; i < 7; i += 1 {" in out
+        assert "result[i * 3] = 10 + i * -1" in out
+
+    def test_enumerate_count_indexes(self):
+        code = "sum(i * x for i, x in enumerate(range(3, 9)) if x % 2)"
+        out = render_go(_ir(code))
+        assert "for i := 0; i < 6; i += 1 {" in out
+        assert "if !((3 + i) % 2 != 0) { continue }" in out
+        assert "acc += i * (3 + i)" in out
+
+    def test_enumerate_start(self):
+        code = "[n * x for n, x in enumerate(range(4), start=1)]"
+        out = render_go(_ir(code))
+        assert "result = append(result, (1 + i) * i)" in out
+
+    def test_fresh_index_and_later_clauses(self):
+        code = "[i * b for i in range(3) for a, b in zip(range(2), range(5, 9))]"
+        out = render_go(_ir(code))
+        assert "for j := 0; j < 2; j += 1 {" in out
+        assert "result = append(result, i * (5 + j))" in out
+
+    def test_parallel(self):
+        code = "sum(a * b for a, b in zip(range(100), range(7, 500, 2)))"
+        out = render_go(_ir(code), parallel=True)
+        assert "acc += i * (7 + i * 2)" in out
+
+    def test_rejected_sources(self):
+        with pytest.raises(ValueError, match="constant ranges"):
+            render_go(_ir("[a + b for a, b in zip(xs, range(3))]"))
+        with pytest.raises(ValueError, match="one loop variable"):
+            render_go(_ir("[p for p in zip(range(3), range(4))]"))
+        with pytest.raises(ValueError, match="unpack"):
+            render_go(_ir("[a for a, b in range(3)]"))
+
+
+class TestMultipleGenerators:
+    """Every for-clause after the first nests a loop inside the one before."""
+
+    def test_dependent_inner_range(self):
+        code = "[x * y for x in range(5) if x > 1 for y in range(x, 2 * x) if y > 2]"
+        out = render_go(_ir(code))
+        assert (
+            "    for x := 0; x < 5; x += 1 {\n"
+            "        if !(x > 1) { continue }\n"
+            "        for y := x; y < 2 * x; y += 1 {\n"
+            "            if !(y > 2) { continue }\n"
+            "            result = append(result, x * y)\n"
+            "        }\n"
+            "    }\n"
+        ) in out
+        assert "return nil" not in out
+
+    def test_negative_inner_step(self):
+        out = render_go(_ir("sum(x * y for x in range(9) for y in range(x, 0, -1))"))
+        assert "for y := x; y > 0; y += -1 {" in out
+
+    def test_tuple_set(self):
+        out = render_go(_ir("{(i, j) for i in range(3) for j in range(i)}"))
+        assert "func program() map[keyIJ]struct{} {" in out
+        assert "result[keyIJ{i, j}] = struct{}{}" in out
+
+    def test_parallel_splits_first_range(self):
+        code = "any(x * y == 42 for x in range(9) for y in range(x))"
+        out = render_go(_ir(code), parallel=True)
+        assert "values: for x := 0 + lo*1; x < 0 + hi*1; x += 1 {" in out
+        assert "for y := 0; y < x; y += 1 {" in out
+        assert "break values" in out
+        code = "{x: y for x in range(9) for y in range(x)}"
+        assert "shard[x] = y" in render_go(_ir(code), parallel=True)
+
+    def test_unsupported_sources(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("[y for x in range(3) for y in data.values()]"))
+        with pytest.raises(ValueError):
+            render_go(_ir("[x for x in range(n) for y in range(3)]"), parallel=True)
+
+
+class TestNestedCollections:
+    """Inner comprehensions used as values nest the result type."""
+
+    def test_list_of_lists(self):
+        out = render_go(_ir("[[x * y for y in range(3)] for x in range(4)]"))
+        assert "func program() [][]int {" in out
+        assert "result := make([][]int, 0, 4)" in out
+        assert "result = append(result, programInner0(x))" in out
+        assert "func programInner0(x int) []int {" in out
+
+    def test_dict_of_lists(self):
+        code = "{x: [y for y in range(x) if y % 2 == 0] for x in range(5)}"
+        out = render_go(_ir(code))
+        assert "func program() map[int][]int {" in out
+        assert "result[x] = programInner0(x)" in out
+        assert "if !(y % 2 == 0) { continue }" in out
+
+    def test_parallel(self):
+        code = "[[x * y for y in range(3)] for x in range(4)]"
+        out = render_go(_ir(code), parallel=True)
+        assert "func program() [][]int {" in out
+        code = "{x: {y for y in range(x)} for x in range(5)}"
+        out = render_go(_ir(code), parallel=True)
+        assert "shards := make([]map[int]map[int]struct{}, numWorkers)" in out
+
+    def test_unsupported(self):
+        for code in (
+            "{[y for y in range(x)] for x in range(3)}",
+            "{[y for y in range(x)]: 1 for x in range(3)}",
+            "sum([y for y in range(x)] for x in range(3))",
+        ):
+            with pytest.raises(ValueError):
+                render_go(_ir(code))
+        with pytest.raises(ValueError):
+            render_go(_ir("[[y for y in range(x)] for x in range(3)]"), emit="iter")
+
+
+class TestSortedSet:
+    """set_result="sorted" returns a set's elements as an ascending slice."""
+
+    CODE = "{x % 5 for x in range(20)}"
+
+    def test_default_is_map(self):
+        assert "func program() map[int]struct{} {" in render_go(_ir(self.CODE))
+
+    def test_sequential(self):
+        out = render_go(_ir(self.CODE), set_result="sorted")
+        assert '    "slices"' in out
+        assert "func program() []int {" in out
+        assert "slices.Sort(values)" in out
+        assert "return values" in out
+
+    def test_parallel(self):
+        out = render_go(_ir(self.CODE), parallel=True, set_result="sorted")
+        assert '    "slices"' in out
+        assert "for v := range part { result[v] = struct{}{} }" in out
+        assert "slices.Sort(values)" in out
+
+    def test_sets_only(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("[x for x in range(3)]"), set_result="sorted")
+        with pytest.raises(ValueError):
+            render_go(_ir(self.CODE), emit="iter", set_result="sorted")
+
+
+class TestOrdering:
+    """sorted() and dict_result="sorted" give results a deterministic order."""
+
+    def test_sorted_list(self):
+        for code in ("sorted([x % 4 for x in range(9)])", "sorted(x for x in data)"):
+            out = render_go(_ir(code))
+            assert "// program returns its values in ascending order.\n" in out
+            assert "    slices.Sort(result)\n    return result\n" in out
+        out = render_go(_ir("sorted([x % 4 for x in range(9)])"), parallel=True)
+        assert "    slices.Sort(result)\n    return result\n" in out
+
+    def test_sorted_set_and_dict_keys(self):
+        for code in ("sorted({x % 4 for x in data})", "sorted({x % 4: 1 for x in data})"):
+            out = render_go(_ir(code))
+            assert "func program(data []int) []int {" in out
+            assert "slices.Sort(values)" in out
+
+    def test_sorted_dict_pairs(self):
+        code = "{x % 4: x for x in range(9)}"
+        out = render_go(_ir(code), dict_result="sorted")
+        assert "// program returns its key/value pairs in ascending key order.\n" in out
+        assert "func program() [][2]int {" in out
+        assert "    result := make(map[int]int, 9)\n" in out
+        assert "    return pairs\n" in out
+        out = render_go(_ir(code), parallel=True, dict_result="sorted")
+        assert '    "slices"' in out
+        assert "    return pairs\n" in out
+        with pytest.raises(ValueError, match="dict_result"):
+            render_go(_ir(code), map_impl="swiss", dict_result="sorted")
+        with pytest.raises(ValueError, match="dict_result"):
+            render_go(_ir("[x for x in range(3)]"), dict_result="sorted")
+
+    def test_map_results_noted(self):
+        note = "// program returns a map; Go iterates maps in no fixed order.\n"
+        out = render_go(_ir("{x: 1 for x in range(3)}"))
+        assert note + "func program() map[int]int {" in out
+        assert note in render_go(_ir("{x for x in range(3)}"), emit="helpers")
+        assert note not in render_go(_ir("{x for x in range(3)}"), emit="iter")
+        assert "// program" not in render_go(_ir("[x for x in range(3)]"))
+
+    def test_unsupported(self):
+        with pytest.raises(ValueError, match="emit='loops'"):
+            render_go(_ir("sorted([x for x in range(3)])"), emit="iter")
+        with pytest.raises(ValueError, match="key or reverse"):
+            _ir("sorted([x for x in range(3)], reverse=True)")
+
+
+class TestCancellable:
+    """cancellable=True threads a context.Context through the workers."""
+
+    def test_signature_and_checks(self):
+        ir = _ir("sum(x for x in range(9))")
+        out = render_go(ir, parallel=True, cancellable=True)
+        assert "func program(ctx context.Context) (int, error) {" in out
+        assert "if steps++; steps&4095 == 0 && ctx.Err() != nil { return }" in out
+        assert "if err := ctx.Err(); err != nil {" in out
+        assert "return acc, nil" in out
+
+    def test_pool_checks_between_chunks(self):
+        ir = _ir("[x for x in range(9)]")
+        out = render_go(ir, parallel=True, parallel_style="pool", cancellable=True)
+        assert "func program(ctx context.Context, workers int) ([]int, error) {" in out
+        assert "if ctx.Err() != nil { return }" in out
+
+    def test_package_main_passes_background(self):
+        ir = _ir("sum(x for x in range(9))")
+        out = render_go_package(render_go(ir, parallel=True, cancellable=True))
+        assert "result, err := program(context.Background())" in out
+
+    def test_needs_parallel(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("sum(x for x in range(9))"), cancellable=True)
+
+
+class TestChanEmission:
+    """emit="chan" streams values over a channel."""
+
+    def test_list(self):
+        out = render_go(_ir("[x*x for x in range(5) if x > 1]"), emit="chan")
+        assert "func programTo(out chan<- int) {" in out
+        assert "out <- x * x" in out
+        assert "func program() <-chan int {" in out
+        assert "defer close(out)" in out
+
+    def test_dict_sends_pairs(self):
+        out = render_go(_ir("{x: x*x for x in range(5)}"), emit="chan")
+        assert "out <- [2]int{x, x * x}" in out
+
+    def test_any_drains_channel(self):
+        out = render_go(_ir("any(x > 2 for x in range(5))"), emit="chan")
+        assert "func program() bool {" in out
+        assert "acc = acc || (v)" in out
+        assert "break" not in out
+
+    def test_package_prints_each_value(self):
+        out = render_go_package(render_go(_ir("{x % 3 for x in range(9)}"), emit="chan"))
+        assert "    for v := range program() {\n        fmt.Println(v)\n    }" in out
+
+
+class TestOptimizer:
+    """The optimizer fuses, strides and hoists unless optimize=False."""
+
+    def test_fuses_generator_source(self):
+        out = render_go(_ir("[y * 2 for y in (x + 1 for x in range(9) if x % 3)]"))
+        assert "for x := 0; x < 9; x += 1 {" in out
+        assert "if !(x % 3 != 0) { continue }" in out
+        assert "result = append(result, (x + 1) * 2)" in out
+
+    def test_renames_taken_inner_variable(self):
+        out = render_go(_ir("sum(y for x in range(4) for y in (x for x in range(x)))"))
+        assert "for x1 := 0; x1 < x; x1 += 1 {" in out
+        assert "acc += x1" in out
+
+    def test_comprehension_source_needs_optimizer(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("[y for y in (x for x in range(9))]"), optimize=False)
+
+    def test_strides_modulo_filter(self):
+        out = render_go(_ir("[x for x in range(20) if x > 4 if x % 3 == 1]"))
+        assert "for x := 1; x < 20; x += 3 {" in out
+        assert "if !(x > 4) { continue }" in out
+        assert "x % 3" not in out
+
+    def test_strides_descending_range(self):
+        out = render_go(_ir("[x for x in range(20, 0, -1) if x % 3 == 1]"))
+        assert "for x := 19; x > 0; x += -3 {" in out
+
+    def test_leaves_other_steps(self):
+        out = render_go(_ir("[x for x in range(0, 20, 2) if x % 3 == 1]"))
+        assert "if !(x % 3 == 1) { continue }" in out
+
+    def test_hoists_outer_filter(self):
+        out = render_go(_ir("[x * y for x in range(5) for y in range(5) if x % 2]"))
+        assert out.index("if !(x % 2 != 0) { continue }") < out.index("for y :=")
+
+    def test_hoists_invariant_expression(self):
+        out = render_go(_ir("[(x * 3) + y for x in range(5) for y in range(5)]"))
+        assert "        hoisted0 := x * 3\n        for y := 0;" in out
+        assert "result = append(result, hoisted0 + y)" in out
+
+    def test_keeps_division_in_place(self):
+        out = render_go(_ir("[y + 10 // x for x in range(5) for y in range(5) if x]"))
+        assert "hoisted" not in out
+
+    def test_disabled(self):
+        out = render_go(_ir("[x for x in range(20) if x % 3 == 1]"), optimize=False)
+        assert "for x := 0; x < 20; x += 1 {" in out
+        assert "if !(x % 3 == 1) { continue }" in out
+
+
+class TestFold:
+    """fold="const" returns a reduction's value; fold="verify" keeps the loops."""
+
+    def test_const_returns_value(self):
+        out = render_go(_ir("sum(i*i for i in range(1, 100) if i%2==0)"), fold="const")
+        assert out.startswith("//go:build !pcs_verify\n\n")
+        assert "func program() int {\n    return 161700\n}" in out
+        assert "for" not in out
+
+    def test_verify_keeps_loops(self):
+        out = render_go(_ir("sum(i*i for i in range(1, 100) if i%2==0)"), fold="verify")
+        assert out.startswith("//go:build pcs_verify\n\nfunc program() int {")
+        assert "acc += i * i" in out
+
+    def test_closed_form_sum(self):
+        # More values than are evaluated one by one
+        code = "sum(x*x - 3*x for x in range(-50, 2 * 10**6))"
+        out = render_go(_ir(code), fold="const")
+        expected = sum(x * x - 3 * x for x in range(-50, 2 * 10**6))
+        assert f"    return {expected}\n" in out
+
+    def test_nested_and_dependent_ranges(self):
+        code = "max(x*y % 13 for x in range(30) for y in range(x, 40) if y > 3)"
+        assert "    return 12\n" in render_go(_ir(code), fold="const")
+
+    def test_any_returns_bool(self):
+        out = render_go(_ir("any(x > 6 for x in range(9) if x % 2)"), fold="const")
+        assert "func program() bool {\n    return true\n}" in out
+
+    def test_package_puts_constraint_first(self):
+        ir = _ir("sum(x for x in range(9))")
+        out = render_go_package(render_go(ir, fold="const"))
+        assert out.startswith("//go:build !pcs_verify\n\npackage main\n")
+
+    @pytest.mark.parametrize(
+        "code",
+        [
+            "[x for x in range(9)]",
+            "sum(x for x in data)",
+            "sum(x % -3 for x in range(9))",
+            "sum(x * x * x * x * x for x in range(10**6))",
+            "sum(x for x in range(10**8) if x % 3)",
+            "max(x for x in range(0))",
+        ],
+    )
+    def test_refuses(self, code):
+        with pytest.raises(ValueError):
+            render_go(_ir(code), fold="const")
+
+    def test_needs_plain_signature(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("sum(x for x in range(9))"), fold="const", overflow="panic")
+
+
+class TestGoTest:
+    """render_go_test asserts the value Python computes for the expression."""
+
+    def _test(self, code: str, **options) -> str:
+        ir = _ir(code)
+        return render_go_test(render_go(ir, **options), ir)
+
+    def test_scalar(self):
+        out = self._test("sum(i*i for i in range(1, 9) if i%2==0)")
+        assert out.startswith('package main\n\nimport (\n    "fmt"\n    "testing"\n)')
+        assert "func TestProgram(t *testing.T) {\n    got := program()" in out
+        assert "    want := 120\n" in out
+        assert "// for sum(i * i for i in range(1, 9, 1) if i % 2 == 0)." in out
+
+    def test_collections(self):
+        assert "want := []int{0, 1, 4}" in self._test("[x*x for x in range(3)]")
+        out = self._test("{x % 3 for x in range(9)}")
+        assert "want := map[int]struct{}{0: {}, 1: {}, 2: {}}" in out
+        out = self._test("{x: -x for x in range(2)}", dict_result="sorted")
+        assert "want := [][2]int{{0, 0}, {1, -1}}" in out
+
+    def test_typed_result(self):
+        out = self._test("sum(x for x in range(4))", result_type="int64")
+        assert "want := int64(6)" in out
+
+    def test_error_result_fails_test(self):
+        out = self._test("sum(x for x in range(4))", return_error=True)
+        assert "got, err := program()\n    if err != nil {\n        t.Fatal(err)" in out
+
+    def test_iterator_is_collected(self):
+        out = self._test("(x for x in range(3))", emit="iter")
+        assert "got := slices.Collect(program())" in out
+
+    def test_package_and_name(self):
+        ir = _ir("any(x > 3 for x in range(5))")
+        out = render_go_test(render_go(ir, func_name="big"), ir, "big", "lib")
+        assert out.startswith("package lib\n")
+        assert "func TestBig(t *testing.T) {" in out
+        assert "want := true" in out
+
+    def test_input_slice_has_no_reference(self):
+        with pytest.raises(ValueError):
+            self._test("sum(x for x in data)")
+
+
+class TestGoBenchmark:
+    """render_go_benchmark times the function with b.ReportAllocs."""
+
+    def test_stores_result(self):
+        out = render_go_benchmark(render_go(_ir("sum(x for x in range(9))")))
+        assert "var benchmarkProgramSink int" in out
+        assert "func BenchmarkProgram(b *testing.B) {\n    b.ReportAllocs()" in out
+        assert "        benchmarkProgramSink = program()" in out
+
+    def test_input_slices_built_before_timer(self):
+        code = render_go(_ir("[x * y for x in xs for y in ys]"))
+        out = render_go_benchmark(code, "program", "lib")
+        assert out.startswith("package lib\n")
+        assert "    xs := make([]int, 1024)" in out
+        assert "    b.ResetTimer()" in out
+        assert "benchmarkProgramSink = program(xs, ys)" in out
+
+    def test_iterator_is_drained(self):
+        code = render_go(_ir("{x: 1 for x in range(5)}"), emit="iter")
+        out = render_go_benchmark(code)
+        assert "for _, v := range program() {" in out
+        assert "var benchmarkProgramSink int" in out
+
+    def test_package_of_result_type(self):
+        code = render_go(_ir("sum(x for x in range(9))"), overflow="big")
+        out = render_go_benchmark(code)
+        assert '    "math/big"' in out
+        assert "var benchmarkProgramSink *big.Int" in out
+
+    def test_next_to_test(self):
+        ir = _ir("sum(x for x in range(9))")
+        out = render_go_test(render_go(ir), ir, benchmark=True)
+        assert out.index("func TestProgram(") < out.index("func BenchmarkProgram(")
+
+
+class TestDocComment:
+    """doc puts the Python expression in the function's doc comment."""
+
+    def test_code_block(self):
+        code = "sum(x for x in range(9))"
+        out = render_go(_ir(code), doc=code)
+        assert out.startswith(
+            "// program is generated from the Python expression\n//\n"
+            f"//\t{code}\nfunc program() int {{"
+        )
+
+    def test_order_note_follows(self):
+        code = "{x % 3 for x in range(9)}"
+        out = render_go(_ir(code), doc=code)
+        assert f"//\t{code}\n//\n// program returns a map;" in out
+
+    def test_stays_above_function_in_package(self):
+        code = "sum(x for x in range(9))"
+        out = render_go_package(render_go(_ir(code), parallel=True, doc=code))
+        assert f"//\t{code}\nfunc program() int {{" in out
+
+
+class TestGoVersion:
+    """go_version uses the slices and maps packages of that Go release."""
+
+    def test_sort_before_slices(self):
+        out = render_go(_ir("sorted({x % 5 for x in range(12)})"), go_version="1.20")
+        assert (
+            "sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })"
+            in out
+        )
+        assert out.startswith('import (\n    "sort"\n)\n\n')
+        assert "slices" not in out
+
+    def test_sorted_keys(self):
+        out = render_go(_ir("sorted({x % 5 for x in range(12)})"), go_version="1.23")
+        assert "values := slices.Sorted(maps.Keys(result))" in out
+        assert out.startswith('import (\n    "maps"\n    "slices"\n)\n\n')
+
+    def test_contains(self):
+        ir = _ir("[x for x in range(20) if x in (1, 2, 3) if x not in [2]]")
+        out = render_go(ir, go_version="1.21")
+        assert "if !(slices.Contains([]int{1, 2, 3}, x)) { continue }" in out
+        assert "if !(!slices.Contains([]int{2}, x)) { continue }" in out
+
+    def test_parallel_merges(self):
+        ir = _ir("{x: x * x for x in range(100)}")
+        out = render_go(ir, parallel=True, go_version="1.21")
+        assert "maps.Copy(result, shard)" in out
+        assert "slices.SortFunc(shards, func(a, b map[int]int) int" in out
+        assert '    "sort"' not in out
+        out = render_go(_ir("[x for x in range(100)]"), parallel=True, go_version="1.22")
+        assert "result := slices.Concat(partials...)" in out
+        assert "n := 0" not in out
+
+    def test_default_unchanged(self):
+        ir = _ir("sorted({x % 5 for x in range(12)})")
+        assert render_go(ir, go_version="1.21") == render_go(ir)
+
+    def test_iter_needs_1_23(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("(x for x in range(9))"), emit="iter", go_version="1.22")
+
+    def test_invalid_version(self):
+        with pytest.raises(ValueError):
+            render_go(_ir("sum(x for x in range(9))"), go_version="go1.21")
+
+
+class TestJoin:
+    """str.join() of a comprehension builds its string in a strings.Builder."""
+
+    def test_parse(self):
+        ir = _ir('", ".join(str(x) for x in range(3))')
+        assert (ir.kind, ir.element) == ("generator", "str(x)")
+        assert (ir.reduce.kind, ir.reduce.op) == ("join", ", ")
+        assert _ir('"".join([str(x) for x in range(3)])').reduce.kind == "join"
+        with pytest.raises(ValueError):
+            _ir('"".join({str(x) for x in range(3)})')
+
+    def test_builder(self):
+        out = render_go(_ir('", ".join(str(x) for x in range(100) if x % 3 == 0)'))
+        assert "func program() string {" in out
+        assert "    var result strings.Builder" in out
+        # 34 values of at most 2 digits, each after a 2 byte separator
+        assert "    result.Grow(136)" in out
+        assert "if !first { result.WriteString(\", \") }" in out
+        assert "result.Write(strconv.AppendInt(digits[:0], int64(x), 10))" in out
+        assert "    return result.String()" in out
+
+    def test_f_string_and_chr(self):
+        out = render_go(_ir('"".join(f"<{x}>" + chr(65 + x) for x in range(5))'))
+        assert 'result.WriteString("<")' in out
+        assert "result.WriteRune(rune(65 + x))" in out
+        assert "first" not in out
+        assert "    result.Grow(35)" in out
+
+    def test_input_slice(self):
+        out = render_go(_ir('"".join(str(y) for y in data)'))
+        assert "func program(data []int) string {" in out
+        assert "result.Grow(len(data) * 20)" in out
+
+    def test_unsupported_elements(self):
+        with pytest.raises(ValueError):
+            render_go(_ir('"".join(x for x in range(3))'))
+        with pytest.raises(ValueError):
+            render_go(_ir('"".join(f"{x:>3}" for x in range(3))'))
+        with pytest.raises(ValueError):
+            render_go(_ir('"".join(str(x) for x in range(3))'), parallel=True)
+
+    def test_go_test_expects_python_string(self):
+        ir = _ir('"-".join(str(x) for x in range(3))')
+        out = render_go_test(render_go(ir), ir)
+        assert 'want := "0-1-2"' in out
+
+
+class TestTextSources:
+    """Strings loop over their runes, bytes by index."""
+
+    def test_runes(self):
+        ir = _ir('[c for c in "héllo" if c.isalpha() and c not in "lo"]')
+        out = render_go(ir)
+        assert "func program() []string {" in out
+        assert '    for _, c := range "héllo" {' in out
+        assert "if !(unicode.IsLetter(c) && c != 'l' && c != 'o') { continue }" in out
+        assert "result = append(result, string(c))" in out
+        assert '    "unicode"' in out
+
+    def test_ord(self):
+        out = render_go(_ir('[ord(c) - ord("0") for c in "19a2" if c.isdigit()]'))
+        assert "func program() []int {" in out
+        assert "result = append(result, int(c) - 48)" in out
+
+    def test_bytes_by_index(self):
+        out = render_go(_ir('[b ^ 0x20 for b in b"Hi\\x00" if b > 64]'))
+        assert out.startswith('const programBytes = "Hi\\x00"\n\nfunc program()')
+        assert "    for i := 0; i < 3; i += 1 {" in out
+        assert "if !(int(programBytes[i]) > 64) { continue }" in out
+        assert "result = append(result, int(programBytes[i]) ^ 32)" in out
+
+    def test_join_runes(self):
+        out = render_go(_ir('"".join(c.upper() for c in "abc" if not c.isspace())'))
+        assert "result.WriteRune(rune(unicode.ToUpper(c)))" in out
+        assert "if !(!unicode.IsSpace(c)) { continue }" in out
+
+    def test_inputs(self):
+        ir = _ir('"".join(c for c in s if c.isalnum())')
+        out = render_go(ir, input_types={"s": "string"})
+        assert "func program(s string) string {" in out
+        assert "    for _, c := range s {" in out
+        ir = _ir("[x + b for x in data for b in raw]")
+        out = render_go(ir, input_types={"raw": "bytes"})
+        assert "func program(data []int, raw []byte) []int {" in out
+        assert "for i := 0; i < len(raw); i += 1 {" in out
+        assert "result = append(result, x + int(raw[i]))" in out
+
+    def test_rejected(self):
+        with pytest.raises(ValueError):
+            render_go(_ir('[c + 1 for c in "ab"]'))
+        with pytest.raises(ValueError):
+            render_go(_ir('[c for c in "ab"]'), parallel=True)
+        with pytest.raises(ValueError):
+            render_go(_ir("[x for x in s]"), input_types={"s": "text"})
+
+
+class TestColumnSources:
+    """Arrow columns and Parquet files loop by index, skipping nulls."""
+
+    def test_arrow(self):
+        ir = _ir("sum(x * x for x in col if x % 2)")
+        out = render_go(ir, input_types={"col": "arrow"})
+        assert "func program(col *array.Int64) int {" in out
+        assert "    for i := 0; i < col.Len(); i += 1 {" in out
+        assert "        if !(col.IsValid(i)) { continue }" in out
+        assert "acc += int(col.Value(i)) * int(col.Value(i))" in out
+        assert '    "github.com/apache/arrow-go/v18/arrow/array"' in out
+
+    def test_parquet(self):
+        ir = _ir("{x % 7: x for x in data if x > 10}")
+        out = render_go(ir, input_types={"data": "parquet"})
+        assert "func program(dataPath string) (_ map[int]int, err error) {" in out
+        assert '    data, err := programReadColumn(dataPath, "data")' in out
+        assert "        return nil, err" in out
+        assert "    defer data.Release()" in out
+        reader = "func programReadColumn(path, column string) (*array.Int64, error) {"
+        assert reader in out
+        assert '    "github.com/apache/arrow-go/v18/parquet/pqarrow"' in out
+
+    def test_parquet_program_takes_paths(self):
+        ir = _ir("sum(x for x in a for y in b)")
+        code = render_go(ir, input_types={"a": "parquet", "b": "parquet"})
+        out = render_go_package(code)
+        assert "    result, err := program(os.Args[1], os.Args[2])" in out
+        assert 'fmt.Fprintln(os.Stderr, "usage: program aPath bPath")' in out
+
+    def test_arrow_program_rejected(self):
+        code = render_go(_ir("sum(x for x in col)"), input_types={"col": "arrow"})
+        with pytest.raises(ValueError):
+            render_go_package(code)
+        assert "package lib" in render_go_package(code, package="lib")
+
+
+class TestEarlyTermination:
+    """takewhile() breaks out of its loop; next() returns its first value."""
+
+    def test_takewhile_breaks(self):
+        code = "[x for x in itertools.takewhile(lambda v: v*v < 50, range(100)) if x%2]"
+        ir = _ir(code)
+        out = render_go(ir)
+        assert "        if !(x * x < 50) { break }\n        if !(x % 2 != 0)" in out
+        assert "make([]int, 0)" in out
+
+    def test_inner_takewhile(self):
+        code = "sum(x*y for x in range(9) for y in takewhile(lambda y: y < 4, range(x)))"
+        ir = _ir(code)
+        out = render_go(ir)
+        assert "            if !(y < 4) { break }" in out
+
+    def test_takewhile_keeps_range(self):
+        ir = _ir("[x for x in takewhile(lambda x: x != 5, range(10)) if x % 2 == 0]")
+        out = render_go(ir)
+        assert "for x := 0; x < 10; x += 1 {" in out
+        assert "if !(x != 5) { break }" in out
+
+    def test_next(self):
+        out = render_go(_ir("next((x for x in range(1, 100) if x*x > 50), -1)"))
+        assert "func program() int {" in out
+        assert "        return x\n    }\n    return -1\n}" in out
+
+    def test_next_without_default_panics(self):
+        out = render_go(_ir("next(x for x in range(3) if x > 5)"))
+        assert '    panic("StopIteration")\n}' in out
+        out = render_go(_ir("next(x for x in range(3) if x > 5)"), return_error=True)
+        assert "        return x, nil" in out
+        assert 'err = fmt.Errorf("program: %v", r)' in out
+
+    def test_next_rune(self):
+        out = render_go(_ir('next((c for c in "abc" if c > "a"), "")'))
+        assert "func program() string {" in out
+        assert "return string(c)" in out
+        assert '    return ""\n}' in out
+
+    def test_reference_value(self):
+        code = "next(x for x in takewhile(lambda x: x < 50, range(100)) if x*x > 200)"
+        ir = _ir(code)
+        assert "want := 15" in render_go_test(render_go(ir), ir)
+
+    def test_rejected(self):
+        for code in [
+            "[x for x in takewhile(is_small, range(3))]",
+            "[x for x in takewhile(lambda v: v < x, range(3))]",
+            "[x for x in takewhile(lambda x: x < 2, (y for y in range(3)))]",
+        ]:
+            with pytest.raises(ValueError):
+                _ir(code)
+        ir = _ir("[x for x in takewhile(lambda x: x < 5, range(9))]")
+        with pytest.raises(ValueError):
+            render_go(ir, parallel=True)
+        with pytest.raises(ValueError):
+            render_go(ir, emit="iter")
+        with pytest.raises(ValueError):
+            render_go(_ir("next((x for x in range(3)), None)"))
+        with pytest.raises(ValueError):
+            render_go(_ir("next(x for x in range(3))"), fold="const")
+
+
+class TestResultShape:
+    """go_result_shape describes the declared result for generic tools."""
+
+    def test_nested_map(self):
+        ir = _ir("{x: [y for y in range(x)] for x in range(5)}")
+        shape = go_result_shape(render_go(ir))
+        assert shape["type"] == "map[int][]int"
+        assert shape["accumulator"] == "result"
+        assert not shape["error"]
+        assert shape["shape"]["kind"] == "map"
+        assert shape["shape"]["key"] == {"type": "int", "kind": "scalar"}
+        assert shape["shape"]["value"]["kind"] == "list"
+
+    def test_set_and_pairs(self):
+        shape = go_result_shape(render_go(_ir("{x for x in range(5)}")))
+        assert shape["shape"]["kind"] == "set"
+        ir = _ir("{x: x for x in range(5)}")
+        shape = go_result_shape(render_go(ir, dict_result="sorted"))
+        assert shape["accumulator"] == "pairs"
+        element = shape["shape"]["element"]
+        assert (element["kind"], element["length"]) == ("array", 2)
+
+    def test_error_result(self):
+        ir = _ir("sum(x for x in range(5))")
+        out = render_go(ir, return_error=True, func_name="total")
+        shape = go_result_shape(out, "total")
+        assert (shape["func"], shape["type"], shape["error"]) == ("total", "int", True)
+        assert shape["accumulator"] == "acc"
+
+    def test_no_accumulator(self):
+        out = render_go(_ir("next((x for x in range(9) if x > 3), -1)"))
+        assert go_result_shape(out)["accumulator"] is None
+        out = render_go(_ir("[x for x in range(5)]"), emit="iter")
+        shape = go_result_shape(out)
+        assert shape["shape"]["kind"] == "iter"
+        assert shape["accumulator"] is None
+
+    def test_missing_function(self):
+        with pytest.raises(ValueError):
+            go_result_shape(render_go(_ir("[x for x in range(5)]")), "other")
+
+
+class TestProgramProtocol:
+    """protocol=True makes a program a harness drives with flags."""
+
+    def test_flags_and_result(self):
+        out = render_go_package(
+            render_go(_ir("sum(i for i in range(n))")), protocol=True
+        )
+        assert "func programResult() any {\n    return program()\n}" in out
+        assert "var n int" in out
+        assert 'flag.IntVar(&n, "n", n,' in out
+        assert '"result_sha256": hex.EncodeToString(sum[:])' in out
+        for imp in ("crypto/sha256", "encoding/json", "flag", "time"):
+            assert f'"{imp}"' in out
+
+    def test_chan_collected(self):
+        ir = _ir("[x for x in range(n)]")
+        out = render_go_package(render_go(ir, emit="chan"), protocol=True)
+        assert "        values = append(values, v)" in out
+        assert "    return values" in out
+
+    def test_error_result(self):
+        ir = _ir("sum(x for x in range(n))")
+        out = render_go_package(render_go(ir, return_error=True), protocol=True)
+        assert "    result, err := program()" in out
+        assert "    return result\n}" in out
+
+    def test_rejected(self):
+        with pytest.raises(ValueError):
+            render_go_package(render_go(_ir("sum(x for x in xs)")), protocol=True)
+        with pytest.raises(ValueError):
+            render_go_package(
+                render_go(_ir("sum(x for x in range(5))")), package="lib", protocol=True
+            )
@@ -173,6 +173,31 @@ GO_TEST_CASES = [
         "go_any_reduction",
         "Any reduction to Go",
     ),
+    (
+        "any(x > 6 and x < 8 for x in range(10))",
+        "go_any_and",
+        "Any reduction with an and predicate to Go",
+    ),
+    (
+        "all(not x < 0 for x in range(10))",
+        "go_all_not",
+        "All reduction with a not predicate to Go",
+    ),
+    (
+        "any(x or y for x in range(3) for y in range(2))",
+        "go_any_or",
+        "Any reduction over int truth values to Go",
+    ),
+    (
+        "sum(x // 2 for x in range(-6, 2))",
+        "go_floor_div",
+        "Floor division of negative values to Go",
+    ),
+    (
+        "[x for x in range(10) if (x - 10) % 4 == 3]",
+        "go_mod_negative",
+        "Modulo of negative values to Go",
+    ),
 ]
 
 # Go parallel test cases
@@ -197,6 +222,11 @@ GO_PARALLEL_TEST_CASES = [
         "go_parallel_any",
         "Parallel any reduction with goroutines",
     ),
+    (
+        "all(x > 0 or x == -1 for x in range(1,100))",
+        "go_parallel_all_or",
+        "Parallel all reduction with an or predicate",
+    ),
 ]
 
 # Type inference test cases: (python_code, case_name, description)
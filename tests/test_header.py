@@ -0,0 +1,95 @@
+"""
+Tests for license/provenance headers on generated files.
+"""
+
+import json
+import re
+
+import pytest
+
+from pcs.__version__ import __version__
+from pcs.header import (
+    COMMENT_PREFIX,
+    HeaderConfig,
+    expression_hash,
+    load_config,
+    render_header,
+)
+from pcs.renderer_api import _BACKENDS
+
+CODE = "[x*x for x in range(5)]"
+
+
+class TestHeader:
+    def test_disabled_by_default(self):
+        assert render_header("go", CODE, HeaderConfig()) == ""
+
+    def test_every_target_has_a_comment_prefix(self):
+        assert set(COMMENT_PREFIX) == set(_BACKENDS)
+
+    def test_go_provenance_matches_generated_code_convention(self):
+        header = render_header("go", CODE, HeaderConfig(provenance=True))
+        # https://pkg.go.dev/cmd/go#hdr-Generate_Go_files_by_processing_source
+        assert re.search(r"(?m)^// Code generated .* DO NOT EDIT\.$", header)
+        assert expression_hash(CODE) in header
+
+    def test_hash_ignores_surrounding_whitespace(self):
+        assert expression_hash(CODE) == expression_hash(f"  {CODE}\n")
+        assert expression_hash(CODE) != expression_hash("[x for x in range(5)]")
+
+    def test_license_file_and_spdx(self, tmp_path):
+        license_file = tmp_path / "HEADER.txt"
+        license_file.write_text("Copyright Example\n\nAll rights reserved.\n")
+        config = HeaderConfig(
+            provenance=True, license="MIT", license_file=str(license_file)
+        )
+        header = render_header("sql", CODE, config)
+        assert header.splitlines()[:4] == [
+            "-- Copyright Example",
+            "--",
+            "-- All rights reserved.",
+            "-- SPDX-License-Identifier: MIT",
+        ]
+        assert header.endswith("DO NOT EDIT.\n\n")
+
+    def test_load_config_resolves_license_file_relative_to_config(self, tmp_path):
+        (tmp_path / "HEADER.txt").write_text("Copyright Example\n")
+        config_path = tmp_path / "pcs.json"
+        config_path.write_text(
+            json.dumps({"header": {"provenance": True, "license_file": "HEADER.txt"}})
+        )
+        config = load_config(str(config_path))
+        assert config.provenance
+        assert render_header("julia", CODE, config).startswith("# Copyright Example\n")
+
+    def test_load_config_rejects_unknown_keys(self, tmp_path):
+        config_path = tmp_path / "pcs.json"
+        config_path.write_text(json.dumps({"header": {"licence": "MIT"}}))
+        with pytest.raises(ValueError, match="licence"):
+            load_config(str(config_path))
+
+    def test_source_flags_and_timestamp(self, monkeypatch):
+        monkeypatch.setenv("SOURCE_DATE_EPOCH", "86400")
+        config = HeaderConfig(provenance=True, source=True, flags=True, timestamp=True)
+        flags = ["--target", "go", "--func-name", "a b"]
+        header = render_header("go", CODE, config, flags)
+        assert header.rstrip("\n").splitlines()[1:] == [
+            "//",
+            f"// Source: {CODE}",
+            "// Flags: --target go --func-name 'a b'",
+            "// Generated: 1970-01-02T00:00:00Z",
+        ]
+
+    def test_source_without_provenance_names_generator(self):
+        header = render_header("julia", "a\nb", HeaderConfig(source=True))
+        assert header.splitlines()[:3] == [
+            f"# Generator: pcs v{__version__}",
+            "# Source: a",
+            "# Source: b",
+        ]
+
+    def test_load_config_reads_source_keys(self, tmp_path):
+        config_path = tmp_path / "pcs.json"
+        config_path.write_text(json.dumps({"header": {"source": True, "flags": True}}))
+        config = load_config(str(config_path))
+        assert config.source and config.flags and not config.timestamp
@@ -115,3 +115,64 @@ class TestRendererAPI:
         for backend in ["rust", "ts", "go"]:
             output = render(backend, sum_ir)
             assert len(output) > 0, f"{backend} should handle reduction IR"
+
+
+class TestCapabilities:
+    """The capability matrix is what the bench harnesses use to skip cases."""
+
+    def test_matrix_covers_every_backend_and_construct(self):
+        from pcs.renderer_api import CONSTRUCTS, capabilities
+
+        matrix = capabilities()
+        assert sorted(matrix) == ["c", "csharp", "go", "julia", "rust", "sql", "ts"]
+        for backend, row in matrix.items():
+            assert tuple(row) == CONSTRUCTS, backend
+            assert all(isinstance(v, bool) for v in row.values())
+
+    def test_single_target(self):
+        from pcs.renderer_api import capabilities
+
+        go = capabilities("go")["go"]
+        assert go["sharded_dict"] and go["parallel"] and go["nested"]
+        assert go["strings"]
+        assert not capabilities("rust")["rust"]["strings"]
+
+    def test_sorted_needs_capability(self):
+        from pcs.renderer_api import render
+
+        ir = PyToIR().parse("sorted([x for x in range(3)])")
+        assert "slices.Sort(result)" in render("go", ir)
+        with pytest.raises(ValueError, match="sorted"):
+            render("rust", ir)
+
+    def test_join_needs_capability(self):
+        from pcs.renderer_api import render
+
+        ir = PyToIR().parse('"".join(str(x) for x in range(3))')
+        assert "var result strings.Builder" in render("go", ir)
+        with pytest.raises(ValueError, match="join"):
+            render("ts", ir)
+
+    def test_early_exit_needs_capability(self):
+        from pcs.renderer_api import render
+
+        ir = PyToIR().parse("next(x for x in takewhile(lambda x: x < 9, range(20)))")
+        assert "if !(x < 9) { break }" in render("go", ir)
+        with pytest.raises(ValueError, match="takewhile"):
+            render("julia", ir)
+
+    def test_reduce_initial_needs_capability(self):
+        from pcs.renderer_api import render
+
+        ir = PyToIR().parse("sum((x for x in range(9)), 100)")
+        assert "acc := 100" in render("go", ir)
+        with pytest.raises(ValueError, match="start"):
+            render("rust", ir)
+        # Without a seed every backend renders it as before
+        render("rust", PyToIR().parse("sum(x for x in range(9))"))
+
+    def test_unknown_target(self):
+        from pcs.renderer_api import capabilities
+
+        with pytest.raises(ValueError):
+            capabilities("cobol")